@@ -15,13 +15,21 @@ type Config struct {
 	Server          ServerConfig
 	Database        DatabaseConfig
 	Redis           RedisConfig
+	Provider        string // "cognito" (default), "oidc" for Keycloak or another OIDC provider, or "local" for development and CI
 	Cognito         CognitoConfig
+	LocalProvider   LocalProviderConfig
+	OIDCProvider    OIDCProviderConfig
 	JWT             JWTConfig
 	OPA             OPAConfig
 	Observability   ObservabilityConfig
 	RateLimiting    RateLimitingConfig
 	Security        SecurityConfig
 	Features        FeaturesConfig
+	MFA             MFAConfig
+	SSO             SSOConfig
+	Session         SessionConfig
+	Nonce           NonceConfig
+	Reconciliation  ReconciliationConfig
 	Logger          LoggerConfig
 	Instrumentation InstrumentationConfig
 }
@@ -64,6 +72,28 @@ type CognitoConfig struct {
 	Domain          string `mapstructure:"domain"`
 }
 
+// LocalProviderConfig holds configuration for the in-process identity provider.
+type LocalProviderConfig struct {
+	Issuer          string        `mapstructure:"issuer"`          // iss of issued access tokens (default shield-local)
+	ClientID        string        `mapstructure:"clientId"`        // client_id of issued access tokens (default shield-local)
+	AccessTokenTTL  time.Duration `mapstructure:"accessTokenTtl"`  // Default 1h
+	RefreshTokenTTL time.Duration `mapstructure:"refreshTokenTtl"` // Default 30 days
+	CodeTTL         time.Duration `mapstructure:"codeTtl"`         // Lifetime of confirmation and reset codes (default 24h)
+	MaxCodeAttempts int           `mapstructure:"maxCodeAttempts"` // Wrong guesses allowed per code (default 5)
+}
+
+// OIDCProviderConfig holds configuration for a generic OpenID Connect provider such as Keycloak.
+// The client must be confidential with direct access grants enabled; user management through the
+// admin API also needs its service account to hold the manage-users and manage-identity-providers roles.
+type OIDCProviderConfig struct {
+	IssuerURL    string   `mapstructure:"issuerUrl"` // Endpoints are discovered from {issuerUrl}/.well-known/openid-configuration
+	ClientID     string   `mapstructure:"clientId"`
+	ClientSecret string   `mapstructure:"clientSecret"`
+	Scopes       []string `mapstructure:"scopes"`      // Default openid email profile
+	AdminURL     string   `mapstructure:"adminUrl"`    // Keycloak admin API of the realm, e.g. https://idp.example.com/admin/realms/shield
+	VerifyEmail  bool     `mapstructure:"verifyEmail"` // Send a verification link on signup; login waits for it
+}
+
 // JWTConfig holds JWT token configuration.
 type JWTConfig struct {
 	Secret        string        `mapstructure:"secret"`
@@ -73,8 +103,9 @@ type JWTConfig struct {
 
 // OPAConfig holds Open Policy Agent configuration.
 type OPAConfig struct {
-	ServerURL  string `mapstructure:"serverUrl"`
-	PolicyPath string `mapstructure:"policyPath"`
+	Mode       string `mapstructure:"mode"`       // remote (default) publishes active policies to the OPA server and queries it; embedded evaluates them in-process
+	ServerURL  string `mapstructure:"serverUrl"`  // Remote policy decisions are disabled when empty
+	PolicyPath string `mapstructure:"policyPath"` // Path of the data API policies are queried under (default /v1/data)
 }
 
 // ObservabilityConfig holds observability configuration.
@@ -87,9 +118,27 @@ type ObservabilityConfig struct {
 
 // RateLimitingConfig holds rate limiting configuration.
 type RateLimitingConfig struct {
-	Enabled           bool `mapstructure:"enabled"`
-	RequestsPerMinute int  `mapstructure:"requestsPerMinute"`
-	Burst             int  `mapstructure:"burst"`
+	Enabled           bool                    `mapstructure:"enabled"`
+	RequestsPerMinute int                     `mapstructure:"requestsPerMinute"`
+	Burst             int                     `mapstructure:"burst"`
+	Store             string                  `mapstructure:"store"`          // "memory" (default) or "redis" to share counters between replicas
+	Password          PasswordRateLimitConfig `mapstructure:"password"`       // Limits for the forgot, reset and change password endpoints
+	ResendCooldown    time.Duration           `mapstructure:"resendCooldown"` // Minimum time between confirmation codes for one email (default 60s)
+}
+
+// ReconciliationConfig holds settings for rolling back signups that failed between the
+// identity provider and the database.
+type ReconciliationConfig struct {
+	Interval    time.Duration `mapstructure:"interval"`    // Time between reconciler runs and first retry delay (default 1m)
+	GracePeriod time.Duration `mapstructure:"gracePeriod"` // Age at which an unfinished signup is rolled back (default 5m)
+	MaxAttempts int           `mapstructure:"maxAttempts"` // Rollback attempts before a job is marked failed (default 10)
+}
+
+// PasswordRateLimitConfig limits password operations per email and per client IP.
+type PasswordRateLimitConfig struct {
+	PerEmail int           `mapstructure:"perEmail"` // Attempts per email address and window (default 5)
+	PerIP    int           `mapstructure:"perIp"`    // Attempts per client IP and window (default 20)
+	Window   time.Duration `mapstructure:"window"`   // Default 15m
 }
 
 // SecurityConfig holds security-related configuration.
@@ -112,6 +161,52 @@ type FeaturesConfig struct {
 	SessionRotation bool `mapstructure:"sessionRotation"`
 }
 
+// MFAConfig holds multi-factor authentication configuration.
+type MFAConfig struct {
+	Issuer        string `mapstructure:"issuer"`        // Issuer shown in authenticator apps (otpauth:// URI)
+	EncryptionKey string `mapstructure:"encryptionKey"` // Key for local TOTP secrets; the local MFA engine is disabled when empty
+	RecoveryCodes int    `mapstructure:"recoveryCodes"` // Recovery codes issued on local MFA enrollment
+	Skew          int    `mapstructure:"skew"`          // Accepted clock drift in 30s time steps
+
+	ChallengeAttempts int           `mapstructure:"challengeAttempts"` // Failed codes before a login challenge is invalidated (default 5)
+	UserAttempts      int           `mapstructure:"userAttempts"`      // Failed codes per user before a lockout (default 10)
+	LockoutWindow     time.Duration `mapstructure:"lockoutWindow"`     // Window in which failed codes are counted (default 15m)
+}
+
+// SSOConfig holds configuration for the backend-handled SSO login (Cognito hosted UI).
+type SSOConfig struct {
+	HostedUIDomain  string        `mapstructure:"hostedUiDomain"`  // e.g., shield.auth.us-east-1.amazoncognito.com; SSO is disabled when empty
+	CallbackURL     string        `mapstructure:"callbackUrl"`     // Redirect URI registered on the app client, pointing at /auth/callback
+	Scopes          []string      `mapstructure:"scopes"`          // Defaults to openid, email, profile
+	DefaultRedirect string        `mapstructure:"defaultRedirect"` // SPA path used when no redirect is requested
+	StateTTL        time.Duration `mapstructure:"stateTtl"`        // Lifetime of the SSO state cookie
+}
+
+// SessionConfig holds configuration for how sessions are delivered to clients.
+type SessionConfig struct {
+	Mode          string        `mapstructure:"mode"`          // "token" returns bearer tokens in JSON (default); "cookie" sets an HttpOnly session cookie
+	CookieName    string        `mapstructure:"cookieName"`    // Defaults to shield_session
+	CookieDomain  string        `mapstructure:"cookieDomain"`  // Empty for a host-only cookie
+	CookiePath    string        `mapstructure:"cookiePath"`    // Defaults to /
+	SameSite      string        `mapstructure:"sameSite"`      // lax (default), strict or none
+	EncryptionKey string        `mapstructure:"encryptionKey"` // Encrypts provider refresh tokens stored with sessions; required to start
+	Store         string        `mapstructure:"store"`         // "database" (default) or "redis" for a write-through Redis cache in front of the database
+	CacheTTL      time.Duration `mapstructure:"cacheTtl"`      // Maximum lifetime of a cached session (default 15m)
+	MaxLifetime   time.Duration `mapstructure:"maxLifetime"`   // Absolute lifetime of a session from login, however often it is refreshed (default 30d)
+}
+
+// NonceConfig holds configuration for the nonces required on state-changing auth routes.
+type NonceConfig struct {
+	Mode    string        `mapstructure:"mode"`    // "signed" (default) for stateless HMAC nonces, or "stored" for random nonces kept server-side
+	Store   string        `mapstructure:"store"`   // "memory" (default) or "redis"; holds used nonce IDs (signed) or issued nonces (stored)
+	TTL     time.Duration `mapstructure:"ttl"`     // Maximum time between issuing and using a nonce (default 5m)
+	MaxSkew time.Duration `mapstructure:"maxSkew"` // Tolerated clock skew for the nonce iat (default 30s)
+	// Transport is "header" (default) to send nonces in the X-Nonce header, or "cookie" to also set them
+	// as an HttpOnly cookie that the X-Nonce header must match (double submit)
+	Transport string   `mapstructure:"transport"`
+	Exempt    []string `mapstructure:"exempt"` // Routes that skip nonce checks, e.g. "POST /auth/refresh" for clients without a browser
+}
+
 // LoggerConfig holds logger configuration.
 type LoggerConfig struct {
 	Level         string `mapstructure:"level"`
@@ -1,11 +1,17 @@
 package main
 
 import (
+	"context"
+	"errors"
 	log "log/slog"
+	"net/http"
+	"os"
+	"os/signal"
 	"shield/cmd/app/config"
 	"shield/cmd/app/router"
 	"shield/modules/common/database"
 	common "shield/modules/common/telemetry/logger"
+	"syscall"
 	"time"
 
 	_ "shield/docs" // This line is needed for swagger
@@ -35,6 +41,11 @@ import (
 // @in header
 // @name Authorization
 // @description Type "Bearer" followed by a space and the JWT token.
+
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
+// @description API key of a registered application.
 func main() {
 	// Initialize logger first
 	if err := common.InitLogger(); err != nil {
@@ -85,17 +96,34 @@ func main() {
 		db = nil // Explicitly set to nil for clarity
 	}
 
+	// Background work of the modules stops when the process is asked to terminate
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Initialize router with database connection
-	routerInstance := router.InitRoutes(db)
-	if routerInstance == nil {
-		log.Error("Failed to initialize router")
+	routerInstance, err := router.InitRoutes(ctx, db)
+	if err != nil {
+		log.Error("Failed to initialize router", "err", err)
+		os.Exit(1)
 	}
 
 	// Start server
 	serverAddr := config.GetServerAddress()
 	log.Info("Server starting", "address", serverAddr)
 
-	if err := routerInstance.Run(serverAddr); err != nil {
-		log.Error("Failed to start server", "err", err)
+	server := &http.Server{Addr: serverAddr, Handler: routerInstance}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error("Failed to start server", "err", err)
+			stop()
+		}
+	}()
+
+	<-ctx.Done()
+	log.Info("Shutting down server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Error("Server shutdown failed", "err", err)
 	}
 }
@@ -1,6 +1,8 @@
 package router
 
 import (
+	"context"
+	"fmt"
 	"shield/cmd/app/config"
 	"shield/modules/authn"
 	"shield/modules/common/telemetry/instrumentation"
@@ -11,38 +13,42 @@ import (
 	"gorm.io/gorm"
 )
 
-// initAuthRoutes initializes authentication and authorization routes using the authn module
-func initAuthRoutes(router gin.IRouter, db *gorm.DB) {
+// authnPrefixes are the route groups registered by the authn module
+var authnPrefixes = []string{"/auth", "/org", "/apps", "/users", "/authz"}
+
+// initAuthRoutes initializes authentication and authorization routes using the authn module.
+// The module's background work stops when ctx is cancelled.
+func initAuthRoutes(ctx context.Context, router gin.IRouter, db *gorm.DB) error {
 	// Check if database is available
 	if db == nil {
-		// Create placeholder routes when database is not available
-		router.Group("/auth").GET("/*any", func(c *gin.Context) {
-			c.JSON(503, gin.H{"error": "Database not available - authn module unavailable"})
-		})
-		router.Group("/org").GET("/*any", func(c *gin.Context) {
-			c.JSON(503, gin.H{"error": "Database not available - authn module unavailable"})
-		})
-		return
+		// Answer every method under the module's routes until the database is back
+		for _, prefix := range authnPrefixes {
+			router.Group(prefix).Any("/*any", func(c *gin.Context) {
+				c.JSON(503, gin.H{"error": "Database not available - authn module unavailable"})
+			})
+		}
+		return nil
 	}
 
 	// Initialize authn service with the provided database connection
-	authService := authn.NewAuthService(db)
+	authService, err := authn.NewAuthService(ctx, db)
+	if err != nil {
+		return fmt.Errorf("authn module unavailable: %w", err)
+	}
 
 	// Register authn routes using the public API
 	v1RouterGroup, ok := router.(*gin.RouterGroup)
 	if !ok {
-		// Fallback: create placeholder routes
-		router.Group("/auth").GET("/*any", func(c *gin.Context) {
-			c.JSON(500, gin.H{"error": "Router initialization failed"})
-		})
-		return
+		return fmt.Errorf("authn routes need a *gin.RouterGroup, got %T", router)
 	}
 
 	authn.RegisterAuthRoutes(v1RouterGroup, authService)
+	return nil
 }
 
-// InitRoutes initializes all modules routes
-func InitRoutes(db *gorm.DB) *gin.Engine {
+// InitRoutes initializes all modules routes. It fails when a module cannot be set up.
+// Cancelling ctx stops the modules' background work.
+func InitRoutes(ctx context.Context, db *gorm.DB) (*gin.Engine, error) {
 	cfg := config.GetConfig()
 
 	if cfg.Server.Debug {
@@ -78,8 +84,10 @@ func InitRoutes(db *gorm.DB) *gin.Engine {
 		})
 
 		// Initialize authn module routes
-		initAuthRoutes(v1, db)
+		if err := initAuthRoutes(ctx, v1, db); err != nil {
+			return nil, err
+		}
 	}
 
-	return router
+	return router, nil
 }
@@ -0,0 +1,343 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"shield/modules/authn/internal/api/dto"
+	"shield/modules/authn/internal/auth"
+	"shield/modules/authn/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// CreateApplication handles registering an application.
+// @Summary Register an application
+// @Description Registers an application of the caller's organization and issues its first API key. Org admins only.
+// @Description Its policies must declare the package returned as opa_endpoint.
+// @Description The key is only returned in this response.
+// @Tags Applications
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param createApplicationRequest body dto.CreateApplicationRequest true "Create Application Request"
+// @Success 201 {object} dto.CreateApplicationResponse "Application registered"
+// @Failure 400 {object} dto.ErrorResponse "Invalid request payload"
+// @Failure 401 {object} dto.ErrorResponse "Unauthorized"
+// @Failure 403 {object} dto.ErrorResponse "Caller is not an org admin"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /apps [post]
+func (h *AuthHandler) CreateApplication(c *gin.Context) {
+	caller, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req dto.CreateApplicationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	app, issued, err := h.authService.CreateApplication(c.Request.Context(), caller, auth.CreateApplicationRequest{
+		Name: req.Name,
+	})
+	if err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to register application")
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.CreateApplicationResponse{
+		Application: toApplicationResponse(app),
+		APIKey:      toIssuedAPIKeyResponse(issued),
+	})
+}
+
+// ListApplications handles listing the caller's applications.
+// @Summary List applications
+// @Description Lists the applications of the caller's organization. Org admins only.
+// @Tags Applications
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} dto.ApplicationResponse "Applications"
+// @Failure 401 {object} dto.ErrorResponse "Unauthorized"
+// @Failure 403 {object} dto.ErrorResponse "Caller is not an org admin"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /apps [get]
+func (h *AuthHandler) ListApplications(c *gin.Context) {
+	caller, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	apps, err := h.authService.ListApplications(c.Request.Context(), caller)
+	if err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to list applications")
+		return
+	}
+
+	resp := make([]dto.ApplicationResponse, 0, len(apps))
+	for i := range apps {
+		resp = append(resp, toApplicationResponse(&apps[i]))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetApplication handles getting an application.
+// @Summary Get application
+// @Description Retrieves an application of the caller's organization. Org admins only.
+// @Tags Applications
+// @Security BearerAuth
+// @Produce json
+// @Param appId path string true "Application ID"
+// @Success 200 {object} dto.ApplicationResponse "Application"
+// @Failure 401 {object} dto.ErrorResponse "Unauthorized"
+// @Failure 403 {object} dto.ErrorResponse "Caller is not an org admin"
+// @Failure 404 {object} dto.ErrorResponse "Application not found"
+// @Router /apps/{appId} [get]
+func (h *AuthHandler) GetApplication(c *gin.Context) {
+	caller, appID, ok := h.appRequest(c)
+	if !ok {
+		return
+	}
+
+	app, err := h.authService.GetApplication(c.Request.Context(), caller, appID)
+	if err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to get application")
+		return
+	}
+
+	c.JSON(http.StatusOK, toApplicationResponse(app))
+}
+
+// UpdateApplication handles updating an application.
+// @Summary Update application
+// @Description Partially updates an application; disabled applications are denied all decisions. Org admins only.
+// @Tags Applications
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param appId path string true "Application ID"
+// @Param updateApplicationRequest body dto.UpdateApplicationRequest true "Update Application Request"
+// @Success 200 {object} dto.ApplicationResponse "Application updated"
+// @Failure 400 {object} dto.ErrorResponse "Invalid request payload"
+// @Failure 401 {object} dto.ErrorResponse "Unauthorized"
+// @Failure 403 {object} dto.ErrorResponse "Caller is not an org admin"
+// @Failure 404 {object} dto.ErrorResponse "Application not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /apps/{appId} [patch]
+func (h *AuthHandler) UpdateApplication(c *gin.Context) {
+	caller, appID, ok := h.appRequest(c)
+	if !ok {
+		return
+	}
+
+	var req dto.UpdateApplicationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	app, err := h.authService.UpdateApplication(c.Request.Context(), caller, appID, auth.UpdateApplicationRequest{
+		Name:   req.Name,
+		Status: req.Status,
+	})
+	if err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to update application")
+		return
+	}
+
+	c.JSON(http.StatusOK, toApplicationResponse(app))
+}
+
+// DeleteApplication handles deleting an application.
+// @Summary Delete application
+// @Description Deletes an application with its API keys, roles and policies. Org admins only.
+// @Tags Applications
+// @Security BearerAuth
+// @Produce json
+// @Param appId path string true "Application ID"
+// @Success 200 {object} dto.SuccessResponse "Application deleted"
+// @Failure 401 {object} dto.ErrorResponse "Unauthorized"
+// @Failure 403 {object} dto.ErrorResponse "Caller is not an org admin"
+// @Failure 404 {object} dto.ErrorResponse "Application not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /apps/{appId} [delete]
+func (h *AuthHandler) DeleteApplication(c *gin.Context) {
+	caller, appID, ok := h.appRequest(c)
+	if !ok {
+		return
+	}
+
+	if err := h.authService.DeleteApplication(c.Request.Context(), caller, appID); err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to delete application")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Message: "Application deleted"})
+}
+
+// ListAPIKeys handles listing the API keys of an application.
+// @Summary List API keys
+// @Description Lists the API keys of an application, including expired and revoked ones. Org admins only.
+// @Tags Applications
+// @Security BearerAuth
+// @Produce json
+// @Param appId path string true "Application ID"
+// @Success 200 {array} dto.APIKeyResponse "API keys"
+// @Failure 401 {object} dto.ErrorResponse "Unauthorized"
+// @Failure 403 {object} dto.ErrorResponse "Caller is not an org admin"
+// @Failure 404 {object} dto.ErrorResponse "Application not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /apps/{appId}/keys [get]
+func (h *AuthHandler) ListAPIKeys(c *gin.Context) {
+	caller, appID, ok := h.appRequest(c)
+	if !ok {
+		return
+	}
+
+	keys, err := h.authService.ListAPIKeys(c.Request.Context(), caller, appID)
+	if err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to list API keys")
+		return
+	}
+
+	now := time.Now()
+	resp := make([]dto.APIKeyResponse, 0, len(keys))
+	for i := range keys {
+		resp = append(resp, toAPIKeyResponse(&keys[i], now))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// RotateAPIKey handles rotating the API key of an application.
+// @Summary Rotate API key
+// @Description Issues a new API key. The current keys keep working for the overlap, then expire. Org admins only.
+// @Description The new key is only returned in this response.
+// @Tags Applications
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param appId path string true "Application ID"
+// @Param rotateAPIKeyRequest body dto.RotateAPIKeyRequest false "Rotate API Key Request"
+// @Success 201 {object} dto.IssuedAPIKeyResponse "New API key"
+// @Failure 400 {object} dto.ErrorResponse "Invalid request payload"
+// @Failure 401 {object} dto.ErrorResponse "Unauthorized"
+// @Failure 403 {object} dto.ErrorResponse "Caller is not an org admin"
+// @Failure 404 {object} dto.ErrorResponse "Application not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /apps/{appId}/keys/rotate [post]
+func (h *AuthHandler) RotateAPIKey(c *gin.Context) {
+	caller, appID, ok := h.appRequest(c)
+	if !ok {
+		return
+	}
+
+	var req dto.RotateAPIKeyRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+	overlap := auth.DefaultKeyOverlap
+	if req.OverlapSeconds != nil {
+		overlap = time.Duration(*req.OverlapSeconds) * time.Second
+	}
+
+	issued, err := h.authService.RotateAPIKey(c.Request.Context(), caller, appID, overlap)
+	if err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to rotate API key")
+		return
+	}
+
+	c.JSON(http.StatusCreated, toIssuedAPIKeyResponse(issued))
+}
+
+// RevokeAPIKey handles revoking an API key.
+// @Summary Revoke API key
+// @Description Ends an API key immediately. Org admins only.
+// @Tags Applications
+// @Security BearerAuth
+// @Produce json
+// @Param appId path string true "Application ID"
+// @Param keyId path string true "API key ID"
+// @Success 200 {object} dto.SuccessResponse "API key revoked"
+// @Failure 400 {object} dto.ErrorResponse "Invalid API key ID"
+// @Failure 401 {object} dto.ErrorResponse "Unauthorized"
+// @Failure 403 {object} dto.ErrorResponse "Caller is not an org admin"
+// @Failure 404 {object} dto.ErrorResponse "Application or API key not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /apps/{appId}/keys/{keyId} [delete]
+func (h *AuthHandler) RevokeAPIKey(c *gin.Context) {
+	caller, appID, ok := h.appRequest(c)
+	if !ok {
+		return
+	}
+	keyID, err := uuid.Parse(c.Param("keyId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Invalid API key ID"})
+		return
+	}
+
+	if err := h.authService.RevokeAPIKey(c.Request.Context(), caller, appID, keyID); err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to revoke API key")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Message: "API key revoked"})
+}
+
+// appRequest parses the application ID path parameter and returns the authenticated caller.
+func (h *AuthHandler) appRequest(c *gin.Context) (*models.User, uuid.UUID, bool) {
+	appID, err := uuid.Parse(c.Param("appId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Invalid application ID"})
+		return nil, uuid.Nil, false
+	}
+
+	caller, ok := h.currentUser(c)
+	if !ok {
+		return nil, uuid.Nil, false
+	}
+	return caller, appID, true
+}
+
+func toApplicationResponse(app *models.Application) dto.ApplicationResponse {
+	return dto.ApplicationResponse{
+		ID:          app.ID.String(),
+		OrgID:       app.OrgID.String(),
+		Name:        app.Name,
+		OPAEndpoint: app.OPAEndpoint,
+		Status:      app.Status,
+		CreatedAt:   app.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:   app.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+func toAPIKeyResponse(key *models.APIKey, now time.Time) dto.APIKeyResponse {
+	resp := dto.APIKeyResponse{
+		ID:        key.ID.String(),
+		Prefix:    key.Prefix,
+		Active:    key.Active(now),
+		CreatedAt: key.CreatedAt.Format(time.RFC3339),
+	}
+	if key.ExpiresAt != nil {
+		resp.ExpiresAt = key.ExpiresAt.Format(time.RFC3339)
+	}
+	if key.RevokedAt != nil {
+		resp.RevokedAt = key.RevokedAt.Format(time.RFC3339)
+	}
+	if key.LastUsedAt != nil {
+		resp.LastUsedAt = key.LastUsedAt.Format(time.RFC3339)
+	}
+	return resp
+}
+
+func toIssuedAPIKeyResponse(issued *auth.IssuedAPIKey) dto.IssuedAPIKeyResponse {
+	return dto.IssuedAPIKeyResponse{
+		APIKeyResponse: toAPIKeyResponse(issued.Key, time.Now()),
+		Key:            issued.Secret,
+	}
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"net/http"
+
+	"shield/modules/authn/internal/api/dto"
+	"shield/modules/authn/internal/auth"
+	"shield/modules/authn/internal/auth/policy"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Decide handles authorization decisions.
+// @Summary Decide whether a user may perform an action
+// @Description Evaluates the application's OPA policy with the roles the user holds in the application.
+// @Description Users may ask about themselves; org admins also about members of their organization.
+// @Description Applications authenticate with X-API-Key and ask about any user; application_id defaults to the caller.
+// @Description A denied decision is returned with status 200 and allow set to false.
+// @Tags Authorization
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param decideRequest body dto.DecideRequest true "Decision Request"
+// @Success 200 {object} dto.DecideResponse "Decision"
+// @Failure 400 {object} dto.ErrorResponse "Invalid request payload"
+// @Failure 401 {object} dto.ErrorResponse "Unauthorized"
+// @Failure 403 {object} dto.ErrorResponse "Caller may not ask about the user or application"
+// @Failure 404 {object} dto.ErrorResponse "Application or user not found"
+// @Failure 502 {object} dto.ErrorResponse "Policy engine unavailable"
+// @Failure 503 {object} dto.ErrorResponse "Policy decisions are not enabled"
+// @Router /authz/decide [post]
+func (h *AuthHandler) Decide(c *gin.Context) {
+	var req dto.DecideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	serviceReq := auth.DecideRequest{
+		Resource: req.Resource,
+		Action:   req.Action,
+		Context:  req.Context,
+	}
+	var err error
+	if req.ApplicationID != "" {
+		if serviceReq.ApplicationID, err = uuid.Parse(req.ApplicationID); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Invalid application ID"})
+			return
+		}
+	}
+	if req.UserID != "" {
+		if serviceReq.UserID, err = uuid.Parse(req.UserID); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Invalid user ID"})
+			return
+		}
+	}
+
+	var decision *policy.Decision
+	if app, ok := CurrentApplication(c); ok {
+		decision, err = h.authService.DecideForApplication(c.Request.Context(), app, serviceReq)
+	} else {
+		caller, ok := h.currentUser(c)
+		if !ok {
+			return
+		}
+		if serviceReq.ApplicationID == uuid.Nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Application ID is required"})
+			return
+		}
+		decision, err = h.authService.Decide(c.Request.Context(), caller, serviceReq)
+	}
+	if err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to make a decision")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.DecideResponse{Allow: decision.Allow, Reasons: decision.Reasons})
+}
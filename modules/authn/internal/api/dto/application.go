@@ -0,0 +1,52 @@
+package dto
+
+// CreateApplicationRequest represents the request body for registering an application
+type CreateApplicationRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// UpdateApplicationRequest represents the request body for updating an application.
+// Omitted fields are left unchanged.
+type UpdateApplicationRequest struct {
+	Name   *string `json:"name,omitempty"`
+	Status *string `json:"status,omitempty" binding:"omitempty,oneof=active disabled"`
+}
+
+// ApplicationResponse represents an application
+type ApplicationResponse struct {
+	ID          string `json:"id"`
+	OrgID       string `json:"org_id"`
+	Name        string `json:"name"`
+	OPAEndpoint string `json:"opa_endpoint"` // Package the application's policies must declare: "org_<org ID>.app_<app ID>", without dashes
+	Status      string `json:"status"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+}
+
+// CreateApplicationResponse represents a registered application and its first API key
+type CreateApplicationResponse struct {
+	Application ApplicationResponse  `json:"application"`
+	APIKey      IssuedAPIKeyResponse `json:"api_key"`
+}
+
+// APIKeyResponse represents an API key; the secret is never returned after the key is issued
+type APIKeyResponse struct {
+	ID         string `json:"id"`
+	Prefix     string `json:"prefix"`
+	Active     bool   `json:"active"`
+	CreatedAt  string `json:"created_at"`
+	ExpiresAt  string `json:"expires_at,omitempty"`
+	RevokedAt  string `json:"revoked_at,omitempty"`
+	LastUsedAt string `json:"last_used_at,omitempty"`
+}
+
+// IssuedAPIKeyResponse represents a new API key with its secret
+type IssuedAPIKeyResponse struct {
+	APIKeyResponse
+	Key string `json:"key"` // Send as X-API-Key; shown only once
+}
+
+// RotateAPIKeyRequest represents the request body for rotating an application's API key
+type RotateAPIKeyRequest struct {
+	OverlapSeconds *int64 `json:"overlap_seconds,omitempty" binding:"omitempty,min=0"` // How long the current keys keep working (default 86400)
+}
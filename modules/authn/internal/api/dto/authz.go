@@ -0,0 +1,16 @@
+package dto
+
+// DecideRequest represents the request body for an authorization decision
+type DecideRequest struct {
+	UserID        string                 `json:"user_id,omitempty"`        // Defaults to the calling user; required for applications
+	ApplicationID string                 `json:"application_id,omitempty"` // Defaults to the calling application; required for users
+	Resource      string                 `json:"resource" binding:"required"`
+	Action        string                 `json:"action" binding:"required"`
+	Context       map[string]interface{} `json:"context,omitempty"`
+}
+
+// DecideResponse represents an authorization decision
+type DecideResponse struct {
+	Allow   bool     `json:"allow"`
+	Reasons []string `json:"reasons,omitempty"`
+}
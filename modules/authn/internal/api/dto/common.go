@@ -3,6 +3,7 @@ package dto
 // ErrorResponse represents an error response
 type ErrorResponse struct {
 	Error string `json:"error"`
+	Code  string `json:"code,omitempty"` // Machine-readable error code, when available
 }
 
 // SuccessResponse represents a success response
@@ -18,10 +19,37 @@ type LoginRequest struct {
 
 // LoginResponse represents the response for a successful login
 type LoginResponse struct {
-	AccessToken  string `json:"access_token"`
+	AccessToken  string `json:"access_token,omitempty"` // Omitted in cookie session mode
 	RefreshToken string `json:"refresh_token,omitempty"`
 	ExpiresIn    int64  `json:"expires_in"`
-	TokenType    string `json:"token_type"`
+	TokenType    string `json:"token_type,omitempty"`
+	SessionID    string `json:"session_id,omitempty"`
+}
+
+// LogoutRequest represents the request body for logout
+type LogoutRequest struct {
+	SessionID string `json:"session_id,omitempty"` // Defaults to the cookie or bearer token session
+}
+
+// LogoutAllResponse represents the response for logging out everywhere
+type LogoutAllResponse struct {
+	Message       string `json:"message"`
+	SessionsEnded int    `json:"sessions_ended"`
+}
+
+// LoginChallengeResponse represents a login that requires an additional step (MFA, new password, etc.)
+type LoginChallengeResponse struct {
+	ChallengeName       string            `json:"challenge_name"`
+	Session             string            `json:"session"`
+	ChallengeParameters map[string]string `json:"challenge_parameters,omitempty"`
+}
+
+// LoginChallengeRequest represents the request body for answering a login challenge
+type LoginChallengeRequest struct {
+	Email         string            `json:"email" binding:"required,email"`
+	ChallengeName string            `json:"challenge_name" binding:"required"`
+	Session       string            `json:"session" binding:"required"`
+	Responses     map[string]string `json:"responses" binding:"required"` // e.g. {"SOFTWARE_TOKEN_MFA_CODE": "123456"}
 }
 
 // RefreshTokenRequest represents the request body for token refresh
@@ -31,7 +59,41 @@ type RefreshTokenRequest struct {
 
 // RefreshTokenResponse represents the response for token refresh
 type RefreshTokenResponse struct {
-	AccessToken string `json:"access_token"`
-	ExpiresIn   int64  `json:"expires_in"`
-	TokenType   string `json:"token_type"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"` // Replaces the refresh token that was sent
+	ExpiresIn    int64  `json:"expires_in"`
+	TokenType    string `json:"token_type"`
+}
+
+// SessionResponse represents the current user and session
+type SessionResponse struct {
+	User      SessionUser  `json:"user"`
+	Session   *SessionInfo `json:"session,omitempty"` // Set when authenticated by session cookie
+	ExpiresIn int64        `json:"expires_in"`        // Seconds until the session or access token expires
+}
+
+// SessionUser represents the authenticated user
+type SessionUser struct {
+	ID         string   `json:"id"`
+	Email      string   `json:"email"`
+	OrgID      string   `json:"org_id,omitempty"`
+	UserType   string   `json:"user_type,omitempty"`
+	MFAEnabled bool     `json:"mfa_enabled"`
+	MFAMethods []string `json:"mfa_methods,omitempty"`
+}
+
+// SessionInfo represents a Shield session
+type SessionInfo struct {
+	ID        string `json:"id"`
+	CreatedAt string `json:"created_at"`
+	ExpiresAt string `json:"expires_at"`
+	IPAddress string `json:"ip_address,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+}
+
+// NonceResponse represents a nonce issued for a state-changing auth request
+type NonceResponse struct {
+	Nonce     string `json:"nonce"`      // Send in the X-Nonce header
+	Purpose   string `json:"purpose"`    // Route group the nonce is valid for
+	ExpiresIn int64  `json:"expires_in"` // Seconds until the nonce expires
 }
@@ -2,19 +2,30 @@ package dto
 
 // MFASetupRequest represents the request body for MFA setup
 type MFASetupRequest struct {
-	UserID string `json:"user_id" binding:"required"`
-	Method string `json:"method" binding:"required"` // e.g., "TOTP", "SMS"
+	UserID  string `json:"user_id,omitempty"`         // Only used with a challenge session; authenticated requests use the token's user
+	Method  string `json:"method" binding:"required"` // e.g., "TOTP", "SMS"
+	Session string `json:"session,omitempty"`         // MFA_SETUP challenge session, when enrolling during login
 }
 
 // MFASetupResponse represents the response for MFA setup
 type MFASetupResponse struct {
 	QRCodeURI string `json:"qr_code_uri,omitempty"` // For TOTP
 	Secret    string `json:"secret,omitempty"`      // For TOTP
+	Session   string `json:"session,omitempty"`     // Updated challenge session, when enrolling during login
 	// For SMS, might just be a confirmation message
 }
 
 // MFAVerifyRequest represents the request body for MFA verification
 type MFAVerifyRequest struct {
-	UserID string `json:"user_id" binding:"required"`
-	Code   string `json:"code" binding:"required"`
+	UserID     string `json:"user_id,omitempty"` // Only used with a challenge session
+	Code       string `json:"code" binding:"required"`
+	DeviceName string `json:"device_name,omitempty"`
+	Session    string `json:"session,omitempty"`
+}
+
+// MFAVerifyResponse represents the response for MFA verification
+type MFAVerifyResponse struct {
+	Status        string   `json:"status"`
+	Session       string   `json:"session,omitempty"`        // Pass to /auth/login/challenge to finish an MFA_SETUP login
+	RecoveryCodes []string `json:"recovery_codes,omitempty"` // Local MFA only; shown once
 }
@@ -11,6 +11,7 @@ type OrgSignupRequest struct {
 type OrgSignupResponse struct {
 	OrgID       string `json:"org_id"`
 	AdminUserID string `json:"admin_user_id"`
+	SSOLoginURL string `json:"sso_login_url,omitempty"`
 	Message     string `json:"message"`
 }
 
@@ -21,13 +22,62 @@ type OrgDetails struct {
 	SSOProvider string `json:"sso_provider,omitempty"`
 	IDPType     string `json:"idp_type,omitempty"`
 	CallbackURL string `json:"callback_url,omitempty"`
+	MFAEngine   string `json:"mfa_engine,omitempty"`
+	SSOLoginURL string `json:"sso_login_url,omitempty"`
 	CreatedAt   string `json:"created_at"`
 }
 
-// UpdateOrgRequest represents the request body for updating organization
+// UpdateOrgRequest represents the request body for updating organization.
+// Omitted fields are left unchanged; SSO settings are managed via /org/{orgId}/sso.
 type UpdateOrgRequest struct {
-	Name        string `json:"name,omitempty"`
-	SSOProvider string `json:"sso_provider,omitempty"`
-	IDPType     string `json:"idp_type,omitempty"`
-	CallbackURL string `json:"callback_url,omitempty"`
+	Name        *string `json:"name,omitempty"`
+	CallbackURL *string `json:"callback_url,omitempty"`
+	MFAEngine   *string `json:"mfa_engine,omitempty" binding:"omitempty,oneof=provider local"`
+}
+
+// OrgSSOConfigRequest represents the request body for registering or updating an organization's IdP
+type OrgSSOConfigRequest struct {
+	ProviderName     string            `json:"provider_name,omitempty"` // Defaults to a name derived from the organization
+	IDPType          string            `json:"idp_type,omitempty"`      // SAML or OIDC; required on create
+	MetadataURL      string            `json:"metadata_url,omitempty"`  // SAML
+	MetadataXML      string            `json:"metadata_xml,omitempty"`  // SAML
+	Issuer           string            `json:"issuer,omitempty"`        // OIDC
+	ClientID         string            `json:"client_id,omitempty"`     // OIDC
+	ClientSecret     string            `json:"client_secret,omitempty"` // OIDC
+	AuthorizeScopes  string            `json:"authorize_scopes,omitempty"`
+	AttributeMapping map[string]string `json:"attribute_mapping,omitempty"`
+	IdpIdentifiers   []string          `json:"idp_identifiers,omitempty"`
+}
+
+// OrgSSOConfigResponse represents an organization's IdP configuration
+type OrgSSOConfigResponse struct {
+	ID               string            `json:"id"`
+	ProviderName     string            `json:"provider_name"`
+	IDPType          string            `json:"idp_type"`
+	MetadataURL      string            `json:"metadata_url,omitempty"`
+	HasMetadataXML   bool              `json:"has_metadata_xml,omitempty"`
+	Issuer           string            `json:"issuer,omitempty"`
+	ClientID         string            `json:"client_id,omitempty"`
+	AuthorizeScopes  string            `json:"authorize_scopes,omitempty"`
+	AttributeMapping map[string]string `json:"attribute_mapping,omitempty"`
+	IdpIdentifiers   []string          `json:"idp_identifiers,omitempty"` // Verified domains routed to the IdP
+	PendingDomains   []PendingDomain   `json:"pending_domains,omitempty"` // Requested domains awaiting verification
+	SSOLoginURL      string            `json:"sso_login_url"`
+	LastTestedAt     string            `json:"last_tested_at,omitempty"`
+	LastTestError    string            `json:"last_test_error,omitempty"`
+}
+
+// PendingDomain is a requested IdP identifier. It routes users to the IdP once the TXT record
+// is published and POST /org/{orgId}/sso/domains/verify is called.
+type PendingDomain struct {
+	Domain    string `json:"domain"`
+	TXTRecord string `json:"txt_record"` // Name of the TXT record to publish
+	TXTValue  string `json:"txt_value"`
+}
+
+// OrgSSOTestResponse represents the result of testing an organization's IdP
+type OrgSSOTestResponse struct {
+	Success  bool   `json:"success"`
+	Error    string `json:"error,omitempty"`
+	TestedAt string `json:"tested_at"`
 }
@@ -0,0 +1,25 @@
+package dto
+
+// ForgotPasswordRequest represents the request to send a password reset code
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest represents the request to set a new password with a reset code
+type ResetPasswordRequest struct {
+	Email       string `json:"email" binding:"required,email"`
+	Code        string `json:"code" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=8"`
+}
+
+// ResetPasswordResponse represents the response for a successful password reset
+type ResetPasswordResponse struct {
+	Message       string `json:"message"`
+	SessionsEnded int    `json:"sessions_ended"`
+}
+
+// ChangePasswordRequest represents the request to change the signed-in user's password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=8"`
+}
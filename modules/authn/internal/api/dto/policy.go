@@ -0,0 +1,115 @@
+package dto
+
+// PolicyUser represents the subject of a policy input
+type PolicyUser struct {
+	ID       string   `json:"id"`
+	Email    string   `json:"email,omitempty"`
+	OrgID    string   `json:"org_id,omitempty"`
+	UserType string   `json:"user_type,omitempty"`
+	Roles    []string `json:"roles"`
+}
+
+// PolicyApplication represents the application of a policy input
+type PolicyApplication struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+// PolicyInput represents the input document of a decision, as policies receive it
+type PolicyInput struct {
+	User        PolicyUser             `json:"user"`
+	Application PolicyApplication      `json:"application"` // Defaults to the policy's application
+	Resource    string                 `json:"resource"`
+	Action      string                 `json:"action"`
+	Context     map[string]interface{} `json:"context,omitempty"`
+}
+
+// PolicyFixture represents an input with the decision a policy is expected to make for it
+type PolicyFixture struct {
+	Name    string      `json:"name" binding:"required"`
+	Input   PolicyInput `json:"input"`
+	Allow   bool        `json:"allow"`
+	Reasons []string    `json:"reasons,omitempty"` // Compared only when given
+}
+
+// UploadPolicyRequest represents the request body for uploading a policy version
+type UploadPolicyRequest struct {
+	Source   string          `json:"source" binding:"required"` // Rego source
+	Fixtures []PolicyFixture `json:"fixtures,omitempty" binding:"dive"`
+}
+
+// TestPolicyRequest represents the request body for testing a policy version
+type TestPolicyRequest struct {
+	Fixtures []PolicyFixture `json:"fixtures" binding:"required,min=1,dive"`
+}
+
+// RollbackPolicyRequest represents the request body for rolling a policy back
+type RollbackPolicyRequest struct {
+	Version int `json:"version" binding:"required,min=1"`
+}
+
+// PolicyDiffQuery represents the query parameters of a policy diff
+type PolicyDiffQuery struct {
+	From int `form:"from" binding:"required,min=1"`
+	To   int `form:"to" binding:"required,min=1"`
+}
+
+// FixtureResult represents the outcome of evaluating a fixture
+type FixtureResult struct {
+	Name    string   `json:"name"`
+	Passed  bool     `json:"passed"`
+	Allow   bool     `json:"allow"`
+	Reasons []string `json:"reasons,omitempty"`
+	Error   string   `json:"error,omitempty"` // Set when the fixture could not be evaluated
+}
+
+// PolicyVersionResponse represents a version of an application policy
+type PolicyVersionResponse struct {
+	ID        string `json:"id"`
+	AppID     string `json:"app_id"`
+	Name      string `json:"name"`
+	Version   int    `json:"version"`
+	Active    bool   `json:"active"`
+	CreatedBy string `json:"created_by"`
+	CreatedAt string `json:"created_at"`
+	Source    string `json:"source,omitempty"` // Omitted from listings
+}
+
+// UploadPolicyResponse represents an uploaded policy version and its fixture results
+type UploadPolicyResponse struct {
+	Policy  PolicyVersionResponse `json:"policy"`
+	Results []FixtureResult       `json:"results"`
+}
+
+// PolicyTestResponse represents the fixture results of a policy version
+type PolicyTestResponse struct {
+	Passed  bool            `json:"passed"`
+	Results []FixtureResult `json:"results"`
+}
+
+// PolicyDiffResponse represents the unified diff between two policy versions
+type PolicyDiffResponse struct {
+	Name string `json:"name"`
+	From int    `json:"from"`
+	To   int    `json:"to"`
+	Diff string `json:"diff"` // Empty when the versions are equal
+}
+
+// PolicyChangeResponse represents an upload or activation of a policy version
+type PolicyChangeResponse struct {
+	ID              string `json:"id"`
+	PolicyName      string `json:"policy_name"`
+	Version         int    `json:"version"`
+	PreviousVersion int    `json:"previous_version,omitempty"` // Version active before the change
+	Action          string `json:"action"`                     // upload, activate or rollback
+	ActorID         string `json:"actor_id"`
+	CreatedAt       string `json:"created_at"`
+}
+
+// PolicyChangesResponse represents a page of policy changes
+type PolicyChangesResponse struct {
+	Changes  []PolicyChangeResponse `json:"changes"`
+	Page     int                    `json:"page"`
+	PageSize int                    `json:"page_size"`
+	Total    int64                  `json:"total"`
+}
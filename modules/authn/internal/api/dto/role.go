@@ -0,0 +1,49 @@
+package dto
+
+// CreateRoleRequest represents the request body for defining an application role
+type CreateRoleRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description,omitempty"`
+}
+
+// RoleResponse represents an application role
+type RoleResponse struct {
+	ID          string `json:"id"`
+	AppID       string `json:"app_id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	CreatedAt   string `json:"created_at"`
+}
+
+// AssignRoleRequest represents the request body for assigning a role to a user
+type AssignRoleRequest struct {
+	UserID string `json:"user_id" binding:"required"`
+}
+
+// PageQuery represents the query parameters of a paginated listing
+type PageQuery struct {
+	Page     int `form:"page" binding:"omitempty,min=1"`              // Starts at 1
+	PageSize int `form:"page_size" binding:"omitempty,min=1,max=100"` // Defaults to 20
+}
+
+// RoleHolder represents a user holding a role
+type RoleHolder struct {
+	ID       string `json:"id"`
+	Email    string `json:"email"`
+	UserType string `json:"user_type,omitempty"`
+}
+
+// RoleHoldersResponse represents a page of the users holding a role
+type RoleHoldersResponse struct {
+	Users    []RoleHolder `json:"users"`
+	Page     int          `json:"page"`
+	PageSize int          `json:"page_size"`
+	Total    int64        `json:"total"`
+}
+
+// UserApplicationRoles represents the roles a user holds in one application
+type UserApplicationRoles struct {
+	AppID   string   `json:"app_id"`
+	AppName string   `json:"app_name,omitempty"`
+	Roles   []string `json:"roles"`
+}
@@ -12,6 +12,7 @@ type SignupResponse struct {
 	RequiresConfirmation bool                 `json:"requires_confirmation,omitempty"`
 	Message              string               `json:"message,omitempty"`
 	CodeDeliveryDetails  *CodeDeliveryDetails `json:"code_delivery_details,omitempty"`
+	ResendAvailableAt    string               `json:"resend_available_at,omitempty"` // RFC 3339; earliest time /auth/confirm/resend accepts a request
 }
 
 // CodeDeliveryDetails represents the delivery method for verification codes
@@ -26,3 +27,14 @@ type ConfirmSignupRequest struct {
 	Email            string `json:"email" binding:"required,email"`
 	VerificationCode string `json:"verification_code" binding:"required"`
 }
+
+// ResendConfirmationRequest represents the request to send a new confirmation code
+type ResendConfirmationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResendConfirmationResponse represents the response for a resent confirmation code
+type ResendConfirmationResponse struct {
+	Message           string `json:"message"`
+	ResendAvailableAt string `json:"resend_available_at"` // RFC 3339
+}
@@ -1,7 +1,18 @@
 package api
 
 import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"shield/modules/authn/internal/api/dto"
 	"shield/modules/authn/internal/auth"
+	"shield/modules/authn/internal/models"
+	apperrors "shield/modules/common/errors"
+
+	"github.com/gin-gonic/gin"
 	// "shield/modules/authn/internal/organization" // Placeholder for OrgService
 	// "shield/pkg/errors" // Placeholder for ErrorHandler
 )
@@ -23,6 +34,41 @@ func NewAuthHandler(authService *auth.AuthService /*, orgService *organization.S
 	}
 }
 
+// bearerToken extracts the token from an "Authorization: Bearer <token>" header.
+func bearerToken(c *gin.Context) string {
+	header := c.GetHeader("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+// writeError writes an *apperrors.AppError with its own status and code,
+// and any other error as the given fallback status and message.
+func writeError(c *gin.Context, err error, status int, message string) {
+	var retryErr *apperrors.RetryAfterError
+	if errors.As(err, &retryErr) {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryErr.RetryAfter.Seconds()))))
+	}
+
+	var appErr *apperrors.AppError
+	if errors.As(err, &appErr) {
+		c.JSON(appErr.Status, dto.ErrorResponse{Error: appErr.Message, Code: appErr.Code})
+		return
+	}
+	c.JSON(status, dto.ErrorResponse{Error: message})
+}
+
+// currentUser returns the caller set by the authentication middleware, writing a 401 when there is none.
+func (h *AuthHandler) currentUser(c *gin.Context) (*models.User, bool) {
+	user, ok := CurrentUser(c)
+	if !ok {
+		writeError(c, apperrors.ErrUnauthorized, http.StatusUnauthorized, "")
+		return nil, false
+	}
+	return user, true
+}
+
 // Placeholder for ErrorResponse and SuccessResponse if they are not globally defined
 // type ErrorResponse struct {
 // 	Error string `json:"error"`
@@ -17,8 +17,11 @@ import (
 // @Accept json
 // @Produce json
 // @Param loginRequest body dto.LoginRequest true "Login Request"
+// @Param X-Nonce header string true "Nonce issued by GET /auth/nonce"
+// @Param X-Device-Fingerprint header string true "Device fingerprint the nonce was issued to"
 // @Success 200 {object} dto.LoginResponse "User authenticated successfully"
-// @Failure 400 {object} dto.ErrorResponse "Invalid request payload"
+// @Success 202 {object} dto.LoginChallengeResponse "Additional authentication challenge required"
+// @Failure 400 {object} dto.ErrorResponse "Invalid request payload or nonce"
 // @Failure 401 {object} dto.ErrorResponse "Invalid credentials"
 // @Failure 500 {object} dto.ErrorResponse "Internal server error"
 // @Router /auth/login [post]
@@ -34,17 +37,70 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		Password: req.Password,
 	}
 
-	// Extract client info from request
-	clientInfo := session.ClientInfo{
-		IPAddress: c.ClientIP(),
-		UserAgent: c.GetHeader("User-Agent"),
-		DeviceID:  c.GetHeader("X-Device-ID"), // Optional device identifier
+	resp, err := h.authService.Login(c.Request.Context(), serviceReq, clientInfoFromRequest(c))
+	if err != nil {
+		writeError(c, err, http.StatusUnauthorized, "Invalid credentials")
+		return
+	}
+
+	h.writeLoginResponse(c, resp)
+}
+
+// RespondToLoginChallenge completes a login that returned an authentication challenge.
+// @Summary Answer login challenge
+// @Description Completes a pending login by answering the provider challenge (MFA code, new password, custom challenge).
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param loginChallengeRequest body dto.LoginChallengeRequest true "Login Challenge Request"
+// @Success 200 {object} dto.LoginResponse "User authenticated successfully"
+// @Success 202 {object} dto.LoginChallengeResponse "Another authentication challenge required"
+// @Failure 400 {object} dto.ErrorResponse "Invalid request payload"
+// @Failure 401 {object} dto.ErrorResponse "Invalid challenge response"
+// @Failure 429 {object} dto.ErrorResponse "Too many failed MFA codes"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /auth/login/challenge [post]
+func (h *AuthHandler) RespondToLoginChallenge(c *gin.Context) {
+	var req dto.LoginChallengeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
 	}
 
-	resp, err := h.authService.Login(c.Request.Context(), serviceReq, clientInfo)
+	serviceReq := auth.LoginChallengeRequest{
+		Email:         req.Email,
+		ChallengeName: req.ChallengeName,
+		Session:       req.Session,
+		Responses:     req.Responses,
+	}
+
+	resp, err := h.authService.RespondToLoginChallenge(c.Request.Context(), serviceReq, clientInfoFromRequest(c))
 	if err != nil {
-		// TODO: Map service layer errors to HTTP errors
-		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: "Invalid credentials"})
+		writeError(c, err, http.StatusUnauthorized, "Invalid challenge response")
+		return
+	}
+
+	h.writeLoginResponse(c, resp)
+}
+
+// writeLoginResponse writes either the issued tokens or the pending challenge.
+// In cookie mode the session is set as an HttpOnly cookie and no tokens are returned.
+func (h *AuthHandler) writeLoginResponse(c *gin.Context, resp *auth.LoginResponse) {
+	if resp.ChallengePending() {
+		c.JSON(http.StatusAccepted, dto.LoginChallengeResponse{
+			ChallengeName:       resp.Challenge.Name,
+			Session:             resp.Challenge.Session,
+			ChallengeParameters: resp.Challenge.Parameters,
+		})
+		return
+	}
+
+	if h.authService.CookieMode() {
+		http.SetCookie(c.Writer, h.authService.SessionCookies().Cookie(resp.SessionID))
+		c.JSON(http.StatusOK, dto.LoginResponse{
+			ExpiresIn: int64(resp.ExpiresIn),
+			SessionID: resp.SessionID,
+		})
 		return
 	}
 
@@ -53,18 +109,30 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		RefreshToken: resp.RefreshToken,
 		ExpiresIn:    int64(resp.ExpiresIn),
 		TokenType:    "Bearer",
+		SessionID:    resp.SessionID,
 	})
 }
 
+// clientInfoFromRequest extracts client info used for session tracking.
+func clientInfoFromRequest(c *gin.Context) session.ClientInfo {
+	return session.ClientInfo{
+		IPAddress: c.ClientIP(),
+		UserAgent: c.GetHeader("User-Agent"),
+		DeviceID:  c.GetHeader("X-Device-ID"), // Optional device identifier
+	}
+}
+
 // RefreshToken handles token refresh.
 // @Summary Refresh access token
-// @Description Refreshes an access token using a refresh token.
+// @Description Exchanges a Shield refresh token for a new access token. The refresh token is rotated: the response carries its replacement, and presenting an old token again ends the session.
 // @Tags Authentication
 // @Accept json
 // @Produce json
 // @Param refreshTokenRequest body dto.RefreshTokenRequest true "Refresh Token Request"
+// @Param X-Nonce header string true "Nonce issued by GET /auth/nonce"
+// @Param X-Device-Fingerprint header string true "Device fingerprint the nonce was issued to"
 // @Success 200 {object} dto.RefreshTokenResponse "Token refreshed successfully"
-// @Failure 400 {object} dto.ErrorResponse "Invalid request payload"
+// @Failure 400 {object} dto.ErrorResponse "Invalid request payload or nonce"
 // @Failure 401 {object} dto.ErrorResponse "Invalid refresh token"
 // @Failure 500 {object} dto.ErrorResponse "Internal server error"
 // @Router /auth/refresh [post]
@@ -81,30 +149,91 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 
 	resp, err := h.authService.RefreshToken(c.Request.Context(), serviceReq)
 	if err != nil {
-		// TODO: Map service layer errors to HTTP errors
-		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: "Invalid refresh token"})
+		writeError(c, err, http.StatusUnauthorized, "Invalid refresh token")
 		return
 	}
 
 	c.JSON(http.StatusOK, dto.RefreshTokenResponse{
-		AccessToken: resp.AccessToken,
-		ExpiresIn:   int64(resp.ExpiresIn),
-		TokenType:   "Bearer", // Standard token type
+		AccessToken:  resp.AccessToken,
+		RefreshToken: resp.RefreshToken,
+		ExpiresIn:    int64(resp.ExpiresIn),
+		TokenType:    "Bearer", // Standard token type
 	})
 }
 
 // Logout handles user logout.
 // @Summary Logout user
-// @Description Logs out a user and invalidates their session.
+// @Description Ends the current session: the cookie session, the session of the bearer token, or the given session ID. Revokes the provider refresh token and clears the session cookie.
 // @Tags Authentication
 // @Security BearerAuth
+// @Accept json
+// @Param logoutRequest body dto.LogoutRequest false "Logout Request"
 // @Success 200 {object} dto.SuccessResponse "User logged out successfully"
 // @Failure 401 {object} dto.ErrorResponse "Unauthorized"
+// @Failure 403 {object} dto.ErrorResponse "Session belongs to another user"
+// @Failure 404 {object} dto.ErrorResponse "Session not found"
 // @Failure 500 {object} dto.ErrorResponse "Internal server error"
 // @Router /auth/logout [post]
 func (h *AuthHandler) Logout(c *gin.Context) {
-	// TODO: Extract user/session info from context (set by middleware)
-	// TODO: Implement logout in auth service
+	caller, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req dto.LogoutRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	serviceReq := auth.LogoutRequest{SessionID: req.SessionID}
+	if sessionData, ok := CurrentSession(c); ok && serviceReq.SessionID == "" {
+		serviceReq.SessionID = sessionData.ID
+	}
+	if claims, ok := CurrentClaims(c); ok {
+		serviceReq.TokenOriginJTI = claims.OriginJTI
+	}
+
+	ended, err := h.authService.Logout(c.Request.Context(), caller, serviceReq)
+	if err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to logout")
+		return
+	}
 
+	if sessionData, ok := CurrentSession(c); ok && sessionData.ID == ended.ID {
+		http.SetCookie(c.Writer, h.authService.SessionCookies().ClearCookie())
+	}
 	c.JSON(http.StatusOK, dto.SuccessResponse{Message: "User logged out successfully"})
 }
+
+// LogoutAll handles logging a user out of every device.
+// @Summary Logout everywhere
+// @Description Invalidates all of the user's sessions, revokes all provider refresh tokens and clears the session cookie.
+// @Tags Authentication
+// @Security BearerAuth
+// @Success 200 {object} dto.LogoutAllResponse "All sessions ended"
+// @Failure 401 {object} dto.ErrorResponse "Unauthorized"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /auth/logout/all [post]
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	caller, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	count, err := h.authService.LogoutEverywhere(c.Request.Context(), caller)
+	if err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to logout")
+		return
+	}
+
+	if _, ok := CurrentSession(c); ok {
+		http.SetCookie(c.Writer, h.authService.SessionCookies().ClearCookie())
+	}
+	c.JSON(http.StatusOK, dto.LogoutAllResponse{
+		Message:       "Logged out of all sessions",
+		SessionsEnded: count,
+	})
+}
@@ -14,11 +14,14 @@ import (
 // @Summary Setup MFA for a user
 // @Description Initiates the MFA setup process (e.g., TOTP QR code, SMS setup).
 // @Tags Authentication
+// @Security BearerAuth
 // @Accept json
 // @Produce json
 // @Param mfaSetupRequest body dto.MFASetupRequest true "MFA Setup Request"
 // @Success 200 {object} dto.MFASetupResponse "MFA setup initiated"
 // @Failure 400 {object} dto.ErrorResponse "Invalid request payload"
+// @Failure 401 {object} dto.ErrorResponse "Access token or challenge session required"
+// @Failure 429 {object} dto.ErrorResponse "Too many attempts"
 // @Failure 500 {object} dto.ErrorResponse "Internal server error"
 // @Router /auth/mfa/setup [post]
 func (h *AuthHandler) SetupMFA(c *gin.Context) {
@@ -39,32 +42,48 @@ func (h *AuthHandler) SetupMFA(c *gin.Context) {
 		return
 	}
 
+	userID, ok := mfaUserID(c, req.UserID, req.Session)
+	if !ok {
+		return
+	}
+	if mfaMethod == models.MFAMethodSMS && bearerToken(c) == "" {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: "Access token required"})
+		return
+	}
+
 	serviceReq := auth.SetupMFARequest{
-		UserID: req.UserID,
-		Method: mfaMethod,
+		UserID:      userID,
+		Method:      mfaMethod,
+		AccessToken: bearerToken(c),
+		Session:     req.Session,
 	}
 
 	resp, err := h.authService.SetupMFA(c.Request.Context(), serviceReq)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to setup MFA"})
+		writeError(c, err, http.StatusInternalServerError, "Failed to setup MFA")
 		return
 	}
 
 	c.JSON(http.StatusOK, dto.MFASetupResponse{
 		Secret:    resp.Secret,
 		QRCodeURI: resp.QRCodeURI,
+		Session:   resp.Session,
 	})
 }
 
 // VerifyMFA handles MFA code verification.
 // @Summary Verify MFA code
-// @Description Verifies an MFA code (e.g., TOTP, SMS code) and completes login.
+// @Description Verifies the first TOTP code after setup and enables TOTP MFA for the user.
 // @Tags Authentication
+// @Security BearerAuth
 // @Accept json
 // @Produce json
 // @Param mfaVerifyRequest body dto.MFAVerifyRequest true "MFA Verify Request"
-// @Success 200 {object} dto.SuccessResponse "MFA verified, login complete"
+// @Success 200 {object} dto.MFAVerifyResponse "MFA verified and enabled"
 // @Failure 400 {object} dto.ErrorResponse "Invalid request payload or MFA code"
+// @Failure 401 {object} dto.ErrorResponse "Access token or challenge session required"
+// @Failure 410 {object} dto.ErrorResponse "Challenge session expired"
+// @Failure 429 {object} dto.ErrorResponse "Too many attempts"
 // @Failure 500 {object} dto.ErrorResponse "Internal server error"
 // @Router /auth/mfa/verify [post]
 func (h *AuthHandler) VerifyMFA(c *gin.Context) {
@@ -74,16 +93,42 @@ func (h *AuthHandler) VerifyMFA(c *gin.Context) {
 		return
 	}
 
+	userID, ok := mfaUserID(c, req.UserID, req.Session)
+	if !ok {
+		return
+	}
+
 	serviceReq := auth.VerifyMFARequest{
-		UserID:  req.UserID,
-		MFACode: req.Code,
+		UserID:      userID,
+		MFACode:     req.Code,
+		DeviceName:  req.DeviceName,
+		AccessToken: bearerToken(c),
+		Session:     req.Session,
 	}
 
 	resp, err := h.authService.VerifyMFA(c.Request.Context(), serviceReq)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Invalid MFA code"})
+		writeError(c, err, http.StatusInternalServerError, "Failed to verify MFA")
 		return
 	}
 
-	c.JSON(http.StatusOK, dto.SuccessResponse{Message: resp.Status})
+	c.JSON(http.StatusOK, dto.MFAVerifyResponse{
+		Status:        resp.Status,
+		Session:       resp.Session,
+		RecoveryCodes: resp.RecoveryCodes,
+	})
+}
+
+// mfaUserID returns the user an MFA request applies to. Authenticated requests always act on
+// the token's user; without a token, the request must carry an MFA_SETUP challenge session
+// and identify the user signing in.
+func mfaUserID(c *gin.Context, bodyUserID, session string) (string, bool) {
+	if user, ok := CurrentUser(c); ok {
+		return user.ID.String(), true
+	}
+	if session == "" || bodyUserID == "" {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: "Access token or challenge session required"})
+		return "", false
+	}
+	return bodyUserID, true
 }
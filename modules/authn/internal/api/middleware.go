@@ -0,0 +1,178 @@
+package api
+
+import (
+	"net/http"
+
+	"shield/modules/authn/internal/auth"
+	"shield/modules/authn/internal/auth/token"
+	"shield/modules/authn/internal/models"
+	apperrors "shield/modules/common/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Gin context keys set by the authentication middleware
+const (
+	contextUserKey    = "shield.user"
+	contextClaimsKey  = "shield.claims"
+	contextSessionKey = "shield.session"
+	contextAppKey     = "shield.application"
+)
+
+// apiKeyHeader carries the API key of a calling application
+const apiKeyHeader = "X-API-Key"
+
+// RequireAuth returns middleware that rejects requests without a valid bearer access token
+// or session cookie. On success the resolved user is available via CurrentUser, and the token
+// claims or cookie session via CurrentClaims and CurrentSession.
+func RequireAuth(authService *auth.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authenticated, ok := authenticate(c, authService)
+		if !ok {
+			return
+		}
+		if !authenticated {
+			writeError(c, apperrors.ErrUnauthorized, http.StatusUnauthorized, "")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// OptionalAuth returns middleware that authenticates the request when credentials are present.
+// Requests without credentials pass through unauthenticated; invalid credentials are still rejected.
+func OptionalAuth(authService *auth.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := authenticate(c, authService); !ok {
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireAPIKey returns middleware that rejects requests without a valid X-API-Key header.
+// On success the calling application is available via CurrentApplication.
+func RequireAPIKey(authService *auth.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !authenticateApplication(c, authService) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireUserOrAPIKey returns middleware that admits calling applications by X-API-Key and
+// users by access token or session cookie. Requests with an API key are not checked for user
+// credentials.
+func RequireUserOrAPIKey(authService *auth.AuthService) gin.HandlerFunc {
+	requireAuth := RequireAuth(authService)
+	return func(c *gin.Context) {
+		if c.GetHeader(apiKeyHeader) == "" {
+			requireAuth(c)
+			return
+		}
+		if !authenticateApplication(c, authService) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// authenticateApplication verifies the API key and stores the calling application in the
+// context. It aborts with 401 when the key is missing or invalid.
+func authenticateApplication(c *gin.Context, authService *auth.AuthService) bool {
+	raw := c.GetHeader(apiKeyHeader)
+	if raw == "" {
+		writeError(c, auth.ErrInvalidAPIKey, http.StatusUnauthorized, "")
+		c.Abort()
+		return false
+	}
+
+	app, err := authService.AuthenticateAPIKey(c.Request.Context(), raw)
+	if err != nil {
+		writeError(c, err, http.StatusUnauthorized, "Unauthorized access")
+		c.Abort()
+		return false
+	}
+	c.Set(contextAppKey, app)
+	return true
+}
+
+// authenticate verifies the bearer token, or else the session cookie, and stores the caller
+// in the context. It reports whether credentials were present, and aborts with 401 when they
+// are invalid.
+func authenticate(c *gin.Context, authService *auth.AuthService) (authenticated bool, ok bool) {
+	if raw := bearerToken(c); raw != "" {
+		user, claims, err := authService.AuthenticateToken(c.Request.Context(), raw)
+		if err != nil {
+			writeError(c, err, http.StatusUnauthorized, "Unauthorized access")
+			c.Abort()
+			return false, false
+		}
+		c.Set(contextUserKey, user)
+		c.Set(contextClaimsKey, claims)
+		return true, true
+	}
+
+	codec := authService.SessionCookies()
+	if codec == nil {
+		return false, true
+	}
+	cookie, err := c.Cookie(codec.Config().Name)
+	if err != nil || cookie == "" {
+		return false, true
+	}
+
+	user, sessionData, err := authService.AuthenticateSession(c.Request.Context(), cookie)
+	if err != nil {
+		// Drop the stale cookie so the browser stops sending it
+		http.SetCookie(c.Writer, codec.ClearCookie())
+		writeError(c, err, http.StatusUnauthorized, "Unauthorized access")
+		c.Abort()
+		return false, false
+	}
+	c.Set(contextUserKey, user)
+	c.Set(contextSessionKey, sessionData)
+	return true, true
+}
+
+// CurrentUser returns the user authenticated by RequireAuth or OptionalAuth.
+func CurrentUser(c *gin.Context) (*models.User, bool) {
+	user, ok := c.Get(contextUserKey)
+	if !ok {
+		return nil, false
+	}
+	u, ok := user.(*models.User)
+	return u, ok
+}
+
+// CurrentClaims returns the verified token claims of the authenticated request.
+func CurrentClaims(c *gin.Context) (*token.Claims, bool) {
+	claims, ok := c.Get(contextClaimsKey)
+	if !ok {
+		return nil, false
+	}
+	cl, ok := claims.(*token.Claims)
+	return cl, ok
+}
+
+// CurrentSession returns the session of a request authenticated by session cookie.
+func CurrentSession(c *gin.Context) (*models.Session, bool) {
+	sessionData, ok := c.Get(contextSessionKey)
+	if !ok {
+		return nil, false
+	}
+	s, ok := sessionData.(*models.Session)
+	return s, ok
+}
+
+// CurrentApplication returns the application authenticated by RequireAPIKey or RequireUserOrAPIKey.
+func CurrentApplication(c *gin.Context) (*models.Application, bool) {
+	app, ok := c.Get(contextAppKey)
+	if !ok {
+		return nil, false
+	}
+	a, ok := app.(*models.Application)
+	return a, ok
+}
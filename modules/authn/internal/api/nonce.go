@@ -0,0 +1,95 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"shield/modules/authn/internal/api/dto"
+	"shield/modules/authn/internal/auth"
+	apperrors "shield/modules/common/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	nonceHeader       = "X-Nonce"
+	fingerprintHeader = "X-Device-Fingerprint"
+	nonceCookiePrefix = "shield_nonce_"
+)
+
+// GetNonce issues a single-use nonce for a state-changing auth request.
+// @Summary Issue nonce
+// @Description Issues a single-use nonce bound to the X-Device-Fingerprint header. Send it in the X-Nonce header of the request it was issued for, from the same device. In cookie mode it is also set as an HttpOnly cookie that the header must match.
+// @Tags Authentication
+// @Produce json
+// @Param purpose query string true "Route group the nonce is for" Enums(signup, login, confirm, mfa, password, refresh)
+// @Param X-Device-Fingerprint header string true "Client device fingerprint"
+// @Success 200 {object} dto.NonceResponse "Nonce issued"
+// @Failure 400 {object} dto.ErrorResponse "Unknown purpose or missing fingerprint"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /auth/nonce [get]
+func (h *AuthHandler) GetNonce(c *gin.Context) {
+	purpose := c.Query("purpose")
+	value, err := h.authService.IssueNonce(c.Request.Context(), purpose, c.GetHeader(fingerprintHeader))
+	if err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to issue nonce")
+		return
+	}
+
+	ttl := h.authService.NonceTTL()
+	if h.authService.NonceCookieMode() {
+		http.SetCookie(c.Writer, nonceCookie(purpose, value, int(ttl.Seconds()), h.authService.SecureCookies()))
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, dto.NonceResponse{
+		Nonce:     value,
+		Purpose:   purpose,
+		ExpiresIn: int64(ttl.Seconds()),
+	})
+}
+
+// RequireNonce returns middleware that consumes a nonce issued for purpose before the handler runs.
+// The nonce is read from the X-Nonce header and must be bound to the X-Device-Fingerprint header.
+// In cookie mode the header must also match the nonce cookie, which a cross-site request cannot
+// read. Routes listed in the nonce exemptions pass through unchecked.
+func RequireNonce(authService *auth.AuthService, purpose string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if authService.NonceExempt(c.Request.Method, c.FullPath()) {
+			c.Next()
+			return
+		}
+
+		value := c.GetHeader(nonceHeader)
+		if authService.NonceCookieMode() {
+			cookie, err := c.Cookie(nonceCookiePrefix + purpose)
+			// The cookie is as single-use as the nonce it carries
+			http.SetCookie(c.Writer, nonceCookie(purpose, "", -1, authService.SecureCookies()))
+			if err != nil || subtle.ConstantTimeCompare([]byte(cookie), []byte(value)) != 1 {
+				writeError(c, apperrors.ErrInvalidNonce, http.StatusBadRequest, "")
+				c.Abort()
+				return
+			}
+		}
+
+		if err := authService.ConsumeNonce(c.Request.Context(), value, purpose, c.GetHeader(fingerprintHeader)); err != nil {
+			writeError(c, err, http.StatusBadRequest, "Invalid nonce")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// nonceCookie returns the cookie carrying the nonce for purpose; a negative maxAge clears it.
+func nonceCookie(purpose, value string, maxAge int, secure bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     nonceCookiePrefix + purpose,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	}
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	appconfig "shield/cmd/app/config"
+	"shield/modules/authn/internal/api/dto"
+	"shield/modules/authn/internal/auth"
+	"shield/modules/authn/internal/auth/nonce"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newNonceTestRouter(config appconfig.NonceConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	cfg := &appconfig.Config{Nonce: config}
+	svc := auth.NewAuthService(nil, cfg, nil, nil, nonce.NewInMemoryNonceValidator(time.Minute))
+	handler := NewAuthHandler(svc)
+
+	ok := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+	router := gin.New()
+	api := router.Group("/api/v1/auth")
+	api.GET("/nonce", handler.GetNonce)
+	api.POST("/login", RequireNonce(svc, nonce.PurposeLogin), ok)
+	api.POST("/mfa/verify", RequireNonce(svc, nonce.PurposeMFA), ok)
+	return router
+}
+
+// issueNonce requests a nonce and returns it with any cookies that were set
+func issueNonce(t *testing.T, router *gin.Engine, purpose, fingerprint string) (string, []*http.Cookie) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/nonce?purpose="+purpose, nil)
+	req.Header.Set(fingerprintHeader, fingerprint)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /auth/nonce status = %d, body %s", w.Code, w.Body)
+	}
+
+	var resp dto.NonceResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding nonce response: %v", err)
+	}
+	return resp.Nonce, w.Result().Cookies()
+}
+
+func post(router *gin.Engine, path, value, fingerprint string, cookies []*http.Cookie) int {
+	req := httptest.NewRequest(http.MethodPost, path, nil)
+	if value != "" {
+		req.Header.Set(nonceHeader, value)
+	}
+	req.Header.Set(fingerprintHeader, fingerprint)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestRequireNonceHeaderMode(t *testing.T) {
+	router := newNonceTestRouter(appconfig.NonceConfig{Exempt: []string{"POST /auth/mfa/verify"}})
+
+	value, cookies := issueNonce(t, router, nonce.PurposeLogin, "device-1")
+	if len(cookies) != 0 {
+		t.Errorf("header mode set %d cookies, want none", len(cookies))
+	}
+	if code := post(router, "/api/v1/auth/login", value, "device-2", nil); code != http.StatusBadRequest {
+		t.Errorf("nonce from other device status = %d, want 400", code)
+	}
+
+	value, _ = issueNonce(t, router, nonce.PurposeLogin, "device-1")
+	if code := post(router, "/api/v1/auth/login", value, "device-1", nil); code != http.StatusNoContent {
+		t.Errorf("valid nonce status = %d, want 204", code)
+	}
+	if code := post(router, "/api/v1/auth/login", value, "device-1", nil); code != http.StatusBadRequest {
+		t.Errorf("replayed nonce status = %d, want 400", code)
+	}
+	if code := post(router, "/api/v1/auth/login", "", "device-1", nil); code != http.StatusBadRequest {
+		t.Errorf("missing nonce status = %d, want 400", code)
+	}
+
+	mfaNonce, _ := issueNonce(t, router, nonce.PurposeMFA, "device-1")
+	if code := post(router, "/api/v1/auth/login", mfaNonce, "device-1", nil); code != http.StatusBadRequest {
+		t.Errorf("nonce for other purpose status = %d, want 400", code)
+	}
+	if code := post(router, "/api/v1/auth/mfa/verify", "", "device-1", nil); code != http.StatusNoContent {
+		t.Errorf("exempt route status = %d, want 204", code)
+	}
+}
+
+func TestRequireNonceCookieMode(t *testing.T) {
+	router := newNonceTestRouter(appconfig.NonceConfig{Transport: auth.NonceTransportCookie})
+
+	value, cookies := issueNonce(t, router, nonce.PurposeLogin, "device-1")
+	if len(cookies) != 1 || !cookies[0].HttpOnly || cookies[0].SameSite != http.SameSiteStrictMode {
+		t.Fatalf("cookie mode cookies = %v, want one strict HttpOnly cookie", cookies)
+	}
+	if code := post(router, "/api/v1/auth/login", value, "device-1", nil); code != http.StatusBadRequest {
+		t.Errorf("nonce header without cookie status = %d, want 400", code)
+	}
+
+	_, cookies = issueNonce(t, router, nonce.PurposeLogin, "device-1")
+	other, _ := issueNonce(t, router, nonce.PurposeLogin, "device-1")
+	if code := post(router, "/api/v1/auth/login", other, "device-1", cookies); code != http.StatusBadRequest {
+		t.Errorf("nonce header not matching cookie status = %d, want 400", code)
+	}
+
+	value, cookies = issueNonce(t, router, nonce.PurposeLogin, "device-1")
+	if code := post(router, "/api/v1/auth/login", value, "device-1", cookies); code != http.StatusNoContent {
+		t.Errorf("matching nonce header and cookie status = %d, want 204", code)
+	}
+}
+
+func TestGetNonceRejectsUnknownPurpose(t *testing.T) {
+	router := newNonceTestRouter(appconfig.NonceConfig{})
+
+	for _, tc := range []struct{ purpose, fingerprint string }{
+		{"delete-account", "device-1"},
+		{nonce.PurposeLogin, ""},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/nonce?purpose="+tc.purpose, nil)
+		req.Header.Set(fingerprintHeader, tc.fingerprint)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("GET /auth/nonce?purpose=%s with fingerprint %q status = %d, want 400", tc.purpose, tc.fingerprint, w.Code)
+		}
+	}
+}
+
+func TestRegisteredRoutesRequireNonce(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	svc := auth.NewAuthService(nil, &appconfig.Config{}, nil, nil, nonce.NewInMemoryNonceValidator(time.Minute))
+	router := gin.New()
+	RegisterAuthRoutes(router.Group("/api/v1"), svc)
+
+	// Requests must be turned away by the nonce check, not by the handler
+	rejected := func(path, value string) bool {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader("{}"))
+		req.Header.Set(nonceHeader, value)
+		req.Header.Set(fingerprintHeader, "device-1")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code == http.StatusBadRequest && strings.Contains(w.Body.String(), "INVALID_NONCE")
+	}
+	for _, path := range []string{"/api/v1/auth/signup", "/api/v1/auth/login", "/api/v1/auth/refresh", "/api/v1/org/signup"} {
+		if !rejected(path, "") {
+			t.Errorf("POST %s without nonce was not rejected", path)
+		}
+	}
+
+	value, _ := issueNonce(t, router, nonce.PurposeLogin, "device-1")
+	if !rejected("/api/v1/auth/refresh", value) {
+		t.Error("POST /auth/refresh with a login nonce was not rejected")
+	}
+	value, _ = issueNonce(t, router, nonce.PurposeRefresh, "device-1")
+	if rejected("/api/v1/auth/refresh", value) {
+		t.Error("POST /auth/refresh with a refresh nonce was rejected")
+	}
+}
@@ -0,0 +1,259 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"shield/modules/authn/internal/api/dto"
+	"shield/modules/authn/internal/auth"
+	"shield/modules/authn/internal/auth/sso"
+	"shield/modules/authn/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// GetOrgSSOConfig handles getting an organization's SSO configuration.
+// @Summary Get organization SSO configuration
+// @Description Returns the identity provider registered for the organization. Org admins only.
+// @Tags Organization
+// @Security BearerAuth
+// @Produce json
+// @Param orgId path string true "Organization ID"
+// @Success 200 {object} dto.OrgSSOConfigResponse "SSO configuration"
+// @Failure 401 {object} dto.ErrorResponse "Unauthorized"
+// @Failure 403 {object} dto.ErrorResponse "Caller is not an admin of the organization"
+// @Failure 404 {object} dto.ErrorResponse "Organization or SSO configuration not found"
+// @Router /org/{orgId}/sso [get]
+func (h *AuthHandler) GetOrgSSOConfig(c *gin.Context) {
+	caller, orgID, ok := h.orgRequest(c)
+	if !ok {
+		return
+	}
+
+	config, err := h.authService.GetOrgSSOConfig(c.Request.Context(), caller, orgID)
+	if err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to get SSO configuration")
+		return
+	}
+
+	c.JSON(http.StatusOK, toOrgSSOConfigResponse(config))
+}
+
+// CreateOrgSSOConfig handles registering an organization's identity provider.
+// @Summary Register organization SSO
+// @Description Registers a SAML (metadata URL or XML) or OIDC (issuer, client ID, secret) identity provider for the organization. New IdP identifiers stay pending until their domain is verified. Org admins only.
+// @Tags Organization
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param orgId path string true "Organization ID"
+// @Param orgSSOConfigRequest body dto.OrgSSOConfigRequest true "SSO Configuration"
+// @Success 201 {object} dto.OrgSSOConfigResponse "SSO configuration created"
+// @Failure 400 {object} dto.ErrorResponse "Invalid SSO configuration"
+// @Failure 401 {object} dto.ErrorResponse "Unauthorized"
+// @Failure 403 {object} dto.ErrorResponse "Caller is not an admin of the organization"
+// @Failure 409 {object} dto.ErrorResponse "SSO already configured, or a domain is used by another organization"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /org/{orgId}/sso [post]
+func (h *AuthHandler) CreateOrgSSOConfig(c *gin.Context) {
+	caller, orgID, ok := h.orgRequest(c)
+	if !ok {
+		return
+	}
+
+	var req dto.OrgSSOConfigRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	config, err := h.authService.CreateOrgSSOConfig(c.Request.Context(), caller, orgID, toOrgSSOConfigRequest(req))
+	if err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to create SSO configuration")
+		return
+	}
+
+	c.JSON(http.StatusCreated, toOrgSSOConfigResponse(config))
+}
+
+// UpdateOrgSSOConfig handles updating an organization's identity provider.
+// @Summary Update organization SSO
+// @Description Updates the organization's identity provider. Omitted fields are unchanged; OIDC detail changes require the client secret. New IdP identifiers stay pending until their domain is verified. Org admins only.
+// @Tags Organization
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param orgId path string true "Organization ID"
+// @Param orgSSOConfigRequest body dto.OrgSSOConfigRequest true "SSO Configuration"
+// @Success 200 {object} dto.OrgSSOConfigResponse "SSO configuration updated"
+// @Failure 400 {object} dto.ErrorResponse "Invalid SSO configuration"
+// @Failure 401 {object} dto.ErrorResponse "Unauthorized"
+// @Failure 403 {object} dto.ErrorResponse "Caller is not an admin of the organization"
+// @Failure 404 {object} dto.ErrorResponse "Organization or SSO configuration not found"
+// @Failure 409 {object} dto.ErrorResponse "A domain is used by another organization"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /org/{orgId}/sso [put]
+func (h *AuthHandler) UpdateOrgSSOConfig(c *gin.Context) {
+	caller, orgID, ok := h.orgRequest(c)
+	if !ok {
+		return
+	}
+
+	var req dto.OrgSSOConfigRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	config, err := h.authService.UpdateOrgSSOConfig(c.Request.Context(), caller, orgID, toOrgSSOConfigRequest(req))
+	if err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to update SSO configuration")
+		return
+	}
+
+	c.JSON(http.StatusOK, toOrgSSOConfigResponse(config))
+}
+
+// TestOrgSSOConfig handles testing an organization's identity provider.
+// @Summary Test organization SSO
+// @Description Checks that the identity provider is registered and its metadata or discovery document can be loaded. Org admins only.
+// @Tags Organization
+// @Security BearerAuth
+// @Produce json
+// @Param orgId path string true "Organization ID"
+// @Success 200 {object} dto.OrgSSOTestResponse "Test result"
+// @Failure 401 {object} dto.ErrorResponse "Unauthorized"
+// @Failure 403 {object} dto.ErrorResponse "Caller is not an admin of the organization"
+// @Failure 404 {object} dto.ErrorResponse "Organization or SSO configuration not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /org/{orgId}/sso/test [post]
+func (h *AuthHandler) TestOrgSSOConfig(c *gin.Context) {
+	caller, orgID, ok := h.orgRequest(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.authService.TestOrgSSOConfig(c.Request.Context(), caller, orgID)
+	if err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to test SSO configuration")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.OrgSSOTestResponse{
+		Success:  result.Success,
+		Error:    result.Error,
+		TestedAt: result.TestedAt.Format(time.RFC3339),
+	})
+}
+
+// VerifyOrgSSODomains handles verifying the domains requested as IdP identifiers.
+// @Summary Verify organization SSO domains
+// @Description Activates the pending IdP identifiers whose DNS TXT record (see pending_domains) is published. Domains without the record stay pending. Org admins only.
+// @Tags Organization
+// @Security BearerAuth
+// @Produce json
+// @Param orgId path string true "Organization ID"
+// @Success 200 {object} dto.OrgSSOConfigResponse "SSO configuration with the verified domains"
+// @Failure 401 {object} dto.ErrorResponse "Unauthorized"
+// @Failure 403 {object} dto.ErrorResponse "Caller is not an admin of the organization"
+// @Failure 404 {object} dto.ErrorResponse "Organization or SSO configuration not found"
+// @Failure 409 {object} dto.ErrorResponse "Domain is used by another organization"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /org/{orgId}/sso/domains/verify [post]
+func (h *AuthHandler) VerifyOrgSSODomains(c *gin.Context) {
+	caller, orgID, ok := h.orgRequest(c)
+	if !ok {
+		return
+	}
+
+	config, err := h.authService.VerifyOrgSSODomains(c.Request.Context(), caller, orgID)
+	if err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to verify SSO domains")
+		return
+	}
+
+	c.JSON(http.StatusOK, toOrgSSOConfigResponse(config))
+}
+
+// DeleteOrgSSOConfig handles removing an organization's identity provider.
+// @Summary Delete organization SSO
+// @Description Removes the organization's identity provider from the auth provider and Shield. Org admins only.
+// @Tags Organization
+// @Security BearerAuth
+// @Produce json
+// @Param orgId path string true "Organization ID"
+// @Success 200 {object} dto.SuccessResponse "SSO configuration deleted"
+// @Failure 401 {object} dto.ErrorResponse "Unauthorized"
+// @Failure 403 {object} dto.ErrorResponse "Caller is not an admin of the organization"
+// @Failure 404 {object} dto.ErrorResponse "Organization or SSO configuration not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /org/{orgId}/sso [delete]
+func (h *AuthHandler) DeleteOrgSSOConfig(c *gin.Context) {
+	caller, orgID, ok := h.orgRequest(c)
+	if !ok {
+		return
+	}
+
+	if err := h.authService.DeleteOrgSSOConfig(c.Request.Context(), caller, orgID); err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to delete SSO configuration")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Message: "SSO configuration deleted"})
+}
+
+// orgRequest resolves the caller and the :orgId path parameter, writing an error response on failure.
+func (h *AuthHandler) orgRequest(c *gin.Context) (*models.User, uuid.UUID, bool) {
+	orgID, err := uuid.Parse(c.Param("orgId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Invalid organization ID"})
+		return nil, uuid.Nil, false
+	}
+
+	caller, ok := h.currentUser(c)
+	if !ok {
+		return nil, uuid.Nil, false
+	}
+	return caller, orgID, true
+}
+
+func toOrgSSOConfigRequest(req dto.OrgSSOConfigRequest) auth.OrgSSOConfigRequest {
+	return auth.OrgSSOConfigRequest{
+		ProviderName:     req.ProviderName,
+		IDPType:          models.IDPType(req.IDPType),
+		MetadataURL:      req.MetadataURL,
+		MetadataXML:      req.MetadataXML,
+		Issuer:           req.Issuer,
+		ClientID:         req.ClientID,
+		ClientSecret:     req.ClientSecret,
+		AuthorizeScopes:  req.AuthorizeScopes,
+		AttributeMapping: req.AttributeMapping,
+		IdpIdentifiers:   req.IdpIdentifiers,
+	}
+}
+
+func toOrgSSOConfigResponse(config *models.SSOProviderConfig) dto.OrgSSOConfigResponse {
+	resp := dto.OrgSSOConfigResponse{
+		ID:               config.ID.String(),
+		ProviderName:     config.ProviderName,
+		IDPType:          string(config.IDPType),
+		MetadataURL:      config.MetadataURL,
+		HasMetadataXML:   config.MetadataXML != "",
+		Issuer:           config.Issuer,
+		ClientID:         config.ClientID,
+		AuthorizeScopes:  config.AuthorizeScopes,
+		AttributeMapping: config.AttributeMapping,
+		IdpIdentifiers:   config.IdpIdentifiers,
+		SSOLoginURL:      auth.SSOLoginURL(config.OrgID.String()),
+		LastTestError:    config.LastTestError,
+	}
+	for _, domain := range config.PendingIdentifiers {
+		name, value := sso.VerificationRecord(domain, config.VerificationToken)
+		resp.PendingDomains = append(resp.PendingDomains, dto.PendingDomain{Domain: domain, TXTRecord: name, TXTValue: value})
+	}
+	if config.LastTestedAt != nil {
+		resp.LastTestedAt = config.LastTestedAt.Format(time.RFC3339)
+	}
+	return resp
+}
@@ -2,9 +2,11 @@ package api
 
 import (
 	"net/http"
+	"time"
 
 	"shield/modules/authn/internal/api/dto"
 	"shield/modules/authn/internal/auth"
+	"shield/modules/authn/internal/models"
 
 	"github.com/gin-gonic/gin"
 )
@@ -16,8 +18,10 @@ import (
 // @Accept json
 // @Produce json
 // @Param orgSignupRequest body dto.OrgSignupRequest true "Organization Signup Request"
+// @Param X-Nonce header string true "Nonce issued by GET /auth/nonce"
+// @Param X-Device-Fingerprint header string true "Device fingerprint the nonce was issued to"
 // @Success 201 {object} dto.OrgSignupResponse "Organization registered successfully"
-// @Failure 400 {object} dto.ErrorResponse "Invalid request payload"
+// @Failure 400 {object} dto.ErrorResponse "Invalid request payload or nonce"
 // @Failure 500 {object} dto.ErrorResponse "Internal server error"
 // @Router /auth/org/signup [post]
 func (h *AuthHandler) OrgSignup(c *gin.Context) {
@@ -43,48 +47,59 @@ func (h *AuthHandler) OrgSignup(c *gin.Context) {
 	c.JSON(http.StatusCreated, dto.OrgSignupResponse{
 		OrgID:       resp.OrgID,
 		AdminUserID: resp.AdminUserID,
+		SSOLoginURL: resp.SSOLoginURL,
 		Message:     "Organization created successfully. Admin user verification required.",
 	})
 }
 
 // GetOrgDetails handles getting organization details.
 // @Summary Get organization details
-// @Description Retrieves details of an organization.
+// @Description Retrieves details of an organization. Members of the organization only.
 // @Tags Organization
+// @Security BearerAuth
 // @Produce json
 // @Param orgId path string true "Organization ID"
 // @Success 200 {object} dto.OrgDetails "Organization details"
+// @Failure 401 {object} dto.ErrorResponse "Unauthorized"
+// @Failure 403 {object} dto.ErrorResponse "Caller is not a member of the organization"
 // @Failure 404 {object} dto.ErrorResponse "Organization not found"
 // @Failure 500 {object} dto.ErrorResponse "Internal server error"
-// @Router /auth/org/{orgId} [get]
+// @Router /org/{orgId} [get]
 func (h *AuthHandler) GetOrgDetails(c *gin.Context) {
-	orgID := c.Param("orgId")
-	if orgID == "" {
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Organization ID is required"})
+	caller, orgID, ok := h.orgRequest(c)
+	if !ok {
+		return
+	}
+
+	org, err := h.authService.GetOrganization(c.Request.Context(), caller, orgID)
+	if err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to get organization")
 		return
 	}
 
-	// TODO: Implement GetOrgDetails in auth service
-	c.JSON(http.StatusNotImplemented, dto.ErrorResponse{Error: "Not implemented yet"})
+	c.JSON(http.StatusOK, toOrgDetails(org))
 }
 
 // UpdateOrg handles updating organization settings.
 // @Summary Update organization
-// @Description Updates organization settings such as SSO configuration.
+// @Description Partially updates organization settings. Org admins only.
 // @Tags Organization
+// @Security BearerAuth
 // @Accept json
 // @Produce json
 // @Param orgId path string true "Organization ID"
 // @Param updateOrgRequest body dto.UpdateOrgRequest true "Update Organization Request"
-// @Success 200 {object} dto.SuccessResponse "Organization updated successfully"
+// @Success 200 {object} dto.OrgDetails "Organization updated successfully"
 // @Failure 400 {object} dto.ErrorResponse "Invalid request payload"
+// @Failure 401 {object} dto.ErrorResponse "Unauthorized"
+// @Failure 403 {object} dto.ErrorResponse "Caller is not an admin of the organization"
 // @Failure 404 {object} dto.ErrorResponse "Organization not found"
+// @Failure 409 {object} dto.ErrorResponse "Organization name already in use"
 // @Failure 500 {object} dto.ErrorResponse "Internal server error"
-// @Router /auth/org/{orgId} [put]
+// @Router /org/{orgId} [patch]
 func (h *AuthHandler) UpdateOrg(c *gin.Context) {
-	orgID := c.Param("orgId")
-	if orgID == "" {
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Organization ID is required"})
+	caller, orgID, ok := h.orgRequest(c)
+	if !ok {
 		return
 	}
 
@@ -94,6 +109,91 @@ func (h *AuthHandler) UpdateOrg(c *gin.Context) {
 		return
 	}
 
-	// TODO: Implement UpdateOrg in auth service
-	c.JSON(http.StatusNotImplemented, dto.ErrorResponse{Error: "Not implemented yet"})
+	serviceReq := auth.UpdateOrgRequest{
+		Name:        req.Name,
+		CallbackURL: req.CallbackURL,
+	}
+	if req.MFAEngine != nil {
+		engine := models.MFAEngine(*req.MFAEngine)
+		serviceReq.MFAEngine = &engine
+	}
+
+	org, err := h.authService.UpdateOrganization(c.Request.Context(), caller, orgID, serviceReq)
+	if err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to update organization")
+		return
+	}
+
+	c.JSON(http.StatusOK, toOrgDetails(org))
+}
+
+// DeleteOrg handles soft deleting an organization.
+// @Summary Delete organization
+// @Description Soft deletes an organization; it can be restored later. Org admins only.
+// @Tags Organization
+// @Security BearerAuth
+// @Produce json
+// @Param orgId path string true "Organization ID"
+// @Success 200 {object} dto.SuccessResponse "Organization deleted"
+// @Failure 401 {object} dto.ErrorResponse "Unauthorized"
+// @Failure 403 {object} dto.ErrorResponse "Caller is not an admin of the organization"
+// @Failure 404 {object} dto.ErrorResponse "Organization not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /org/{orgId} [delete]
+func (h *AuthHandler) DeleteOrg(c *gin.Context) {
+	caller, orgID, ok := h.orgRequest(c)
+	if !ok {
+		return
+	}
+
+	if err := h.authService.DeleteOrganization(c.Request.Context(), caller, orgID); err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to delete organization")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Message: "Organization deleted"})
+}
+
+// RestoreOrg handles restoring a soft-deleted organization.
+// @Summary Restore organization
+// @Description Restores a soft-deleted organization. Org admins only.
+// @Tags Organization
+// @Security BearerAuth
+// @Produce json
+// @Param orgId path string true "Organization ID"
+// @Success 200 {object} dto.OrgDetails "Organization restored"
+// @Failure 401 {object} dto.ErrorResponse "Unauthorized"
+// @Failure 403 {object} dto.ErrorResponse "Caller is not an admin of the organization"
+// @Failure 404 {object} dto.ErrorResponse "No deleted organization found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /org/{orgId}/restore [post]
+func (h *AuthHandler) RestoreOrg(c *gin.Context) {
+	caller, orgID, ok := h.orgRequest(c)
+	if !ok {
+		return
+	}
+
+	org, err := h.authService.RestoreOrganization(c.Request.Context(), caller, orgID)
+	if err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to restore organization")
+		return
+	}
+
+	c.JSON(http.StatusOK, toOrgDetails(org))
+}
+
+func toOrgDetails(org *models.Organization) dto.OrgDetails {
+	details := dto.OrgDetails{
+		ID:          org.ID.String(),
+		Name:        org.Name,
+		SSOProvider: org.SSOProviderName,
+		IDPType:     string(org.IDPType),
+		CallbackURL: org.CallbackURL,
+		MFAEngine:   string(org.MFAEngine),
+		CreatedAt:   org.CreatedAt.Format(time.RFC3339),
+	}
+	if org.SSOProviderName != "" {
+		details.SSOLoginURL = auth.SSOLoginURL(org.ID.String())
+	}
+	return details
 }
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"net/http"
+
+	"shield/modules/authn/internal/api/dto"
+	"shield/modules/authn/internal/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ForgotPassword sends a password reset code.
+// @Summary Request password reset
+// @Description Sends a password reset code to the email address. The response is the same whether or not an account exists.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param forgotPasswordRequest body dto.ForgotPasswordRequest true "Forgot Password Request"
+// @Param X-Nonce header string true "Nonce issued by GET /auth/nonce"
+// @Param X-Device-Fingerprint header string true "Device fingerprint the nonce was issued to"
+// @Success 200 {object} dto.SuccessResponse "Reset code sent if the account exists"
+// @Failure 400 {object} dto.ErrorResponse "Invalid request payload or nonce"
+// @Failure 429 {object} dto.ErrorResponse "Too many attempts"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /auth/password/forgot [post]
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var req dto.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.authService.ForgotPassword(c.Request.Context(), req.Email, clientInfoFromRequest(c)); err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to start password reset")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Message: "If an account exists for this email, a reset code has been sent"})
+}
+
+// ResetPassword sets a new password with a reset code.
+// @Summary Reset password
+// @Description Sets a new password using the code sent by /auth/password/forgot. All of the user's sessions are ended.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param resetPasswordRequest body dto.ResetPasswordRequest true "Reset Password Request"
+// @Param X-Nonce header string true "Nonce issued by GET /auth/nonce"
+// @Param X-Device-Fingerprint header string true "Device fingerprint the nonce was issued to"
+// @Success 200 {object} dto.ResetPasswordResponse "Password reset"
+// @Failure 400 {object} dto.ErrorResponse "Invalid request payload, nonce, code or password"
+// @Failure 410 {object} dto.ErrorResponse "Reset code expired"
+// @Failure 429 {object} dto.ErrorResponse "Too many attempts"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /auth/password/reset [post]
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req dto.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ended, err := h.authService.ResetPassword(c.Request.Context(), auth.ResetPasswordRequest{
+		Email:       req.Email,
+		Code:        req.Code,
+		NewPassword: req.NewPassword,
+	}, clientInfoFromRequest(c))
+	if err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to reset password")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.ResetPasswordResponse{
+		Message:       "Password has been reset. Please log in with your new password.",
+		SessionsEnded: ended,
+	})
+}
+
+// ChangePassword changes the signed-in user's password.
+// @Summary Change password
+// @Description Changes the password of the authenticated user after checking the current password.
+// @Tags Authentication
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param changePasswordRequest body dto.ChangePasswordRequest true "Change Password Request"
+// @Param X-Nonce header string true "Nonce issued by GET /auth/nonce"
+// @Param X-Device-Fingerprint header string true "Device fingerprint the nonce was issued to"
+// @Success 200 {object} dto.SuccessResponse "Password changed"
+// @Failure 400 {object} dto.ErrorResponse "Invalid request payload, nonce or password"
+// @Failure 401 {object} dto.ErrorResponse "Not logged in or incorrect current password"
+// @Failure 429 {object} dto.ErrorResponse "Too many attempts"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /auth/password/change [post]
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req dto.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	serviceReq := auth.ChangePasswordRequest{
+		CurrentPassword: req.CurrentPassword,
+		NewPassword:     req.NewPassword,
+		AccessToken:     bearerToken(c),
+	}
+	if sessionData, ok := CurrentSession(c); ok {
+		serviceReq.Session = sessionData
+	}
+
+	if err := h.authService.ChangePassword(c.Request.Context(), user, serviceReq, clientInfoFromRequest(c)); err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to change password")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Message: "Password changed successfully"})
+}
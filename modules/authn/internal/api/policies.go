@@ -0,0 +1,427 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"shield/modules/authn/internal/api/dto"
+	"shield/modules/authn/internal/auth"
+	"shield/modules/authn/internal/auth/policy"
+	"shield/modules/authn/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UploadPolicy handles uploading a new version of an application policy.
+// @Summary Upload policy version
+// @Description Compiles a Rego policy together with the application's other active policies, evaluates the
+// @Description fixtures with it and saves it as the next, inactive version. Org admins only.
+// @Tags Policies
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param appId path string true "Application ID"
+// @Param policyName path string true "Policy name"
+// @Param uploadPolicyRequest body dto.UploadPolicyRequest true "Upload Policy Request"
+// @Success 201 {object} dto.UploadPolicyResponse "Policy version saved"
+// @Failure 400 {object} dto.ErrorResponse "Invalid request payload"
+// @Failure 401 {object} dto.ErrorResponse "Unauthorized"
+// @Failure 403 {object} dto.ErrorResponse "Caller is not an org admin"
+// @Failure 404 {object} dto.ErrorResponse "Application not found"
+// @Failure 422 {object} dto.PolicyTestResponse "Policy fails its fixtures"
+// @Failure 503 {object} dto.ErrorResponse "Policy validation is not enabled"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /apps/{appId}/policies/{policyName}/versions [post]
+func (h *AuthHandler) UploadPolicy(c *gin.Context) {
+	caller, appID, ok := h.appRequest(c)
+	if !ok {
+		return
+	}
+
+	var req dto.UploadPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	saved, results, err := h.authService.UploadPolicy(c.Request.Context(), caller, appID, auth.UploadPolicyRequest{
+		Name:     c.Param("policyName"),
+		Source:   req.Source,
+		Fixtures: toFixtures(req.Fixtures),
+	})
+	if errors.Is(err, auth.ErrPolicyTestsFailed) {
+		c.JSON(http.StatusUnprocessableEntity, toPolicyTestResponse(results))
+		return
+	}
+	if err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to upload policy")
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.UploadPolicyResponse{
+		Policy:  toPolicyVersionResponse(saved, true),
+		Results: toPolicyTestResponse(results).Results,
+	})
+}
+
+// ListPolicyVersions handles listing the versions of an application policy.
+// @Summary List policy versions
+// @Description Lists the versions of an application policy, newest first, without their source. Org admins only.
+// @Tags Policies
+// @Security BearerAuth
+// @Produce json
+// @Param appId path string true "Application ID"
+// @Param policyName path string true "Policy name"
+// @Success 200 {array} dto.PolicyVersionResponse "Policy versions"
+// @Failure 401 {object} dto.ErrorResponse "Unauthorized"
+// @Failure 403 {object} dto.ErrorResponse "Caller is not an org admin"
+// @Failure 404 {object} dto.ErrorResponse "Application or policy not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /apps/{appId}/policies/{policyName}/versions [get]
+func (h *AuthHandler) ListPolicyVersions(c *gin.Context) {
+	caller, appID, ok := h.appRequest(c)
+	if !ok {
+		return
+	}
+
+	versions, err := h.authService.ListPolicyVersions(c.Request.Context(), caller, appID, c.Param("policyName"))
+	if err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to list policy versions")
+		return
+	}
+
+	resp := make([]dto.PolicyVersionResponse, 0, len(versions))
+	for i := range versions {
+		resp = append(resp, toPolicyVersionResponse(&versions[i], false))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetPolicyVersion handles fetching a version of an application policy.
+// @Summary Get policy version
+// @Description Returns a version of an application policy with its source. Org admins only.
+// @Tags Policies
+// @Security BearerAuth
+// @Produce json
+// @Param appId path string true "Application ID"
+// @Param policyName path string true "Policy name"
+// @Param version path int true "Policy version"
+// @Success 200 {object} dto.PolicyVersionResponse "Policy version"
+// @Failure 400 {object} dto.ErrorResponse "Invalid version"
+// @Failure 401 {object} dto.ErrorResponse "Unauthorized"
+// @Failure 403 {object} dto.ErrorResponse "Caller is not an org admin"
+// @Failure 404 {object} dto.ErrorResponse "Application or policy version not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /apps/{appId}/policies/{policyName}/versions/{version} [get]
+func (h *AuthHandler) GetPolicyVersion(c *gin.Context) {
+	caller, appID, ok := h.appRequest(c)
+	if !ok {
+		return
+	}
+	version, ok := policyVersionParam(c)
+	if !ok {
+		return
+	}
+
+	p, err := h.authService.GetPolicyVersion(c.Request.Context(), caller, appID, c.Param("policyName"), version)
+	if err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to get policy version")
+		return
+	}
+
+	c.JSON(http.StatusOK, toPolicyVersionResponse(p, true))
+}
+
+// TestPolicyVersion handles evaluating fixtures with a saved policy version.
+// @Summary Test policy version
+// @Description Evaluates fixtures with a saved version of an application policy, compiled together with the
+// @Description application's other active policies. Failing fixtures are reported, not rejected. Org admins only.
+// @Tags Policies
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param appId path string true "Application ID"
+// @Param policyName path string true "Policy name"
+// @Param version path int true "Policy version"
+// @Param testPolicyRequest body dto.TestPolicyRequest true "Test Policy Request"
+// @Success 200 {object} dto.PolicyTestResponse "Fixture results"
+// @Failure 400 {object} dto.ErrorResponse "Invalid request payload"
+// @Failure 401 {object} dto.ErrorResponse "Unauthorized"
+// @Failure 403 {object} dto.ErrorResponse "Caller is not an org admin"
+// @Failure 404 {object} dto.ErrorResponse "Application or policy version not found"
+// @Failure 422 {object} dto.ErrorResponse "Policy no longer compiles"
+// @Failure 503 {object} dto.ErrorResponse "Policy validation is not enabled"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /apps/{appId}/policies/{policyName}/versions/{version}/test [post]
+func (h *AuthHandler) TestPolicyVersion(c *gin.Context) {
+	caller, appID, ok := h.appRequest(c)
+	if !ok {
+		return
+	}
+	version, ok := policyVersionParam(c)
+	if !ok {
+		return
+	}
+
+	var req dto.TestPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	results, err := h.authService.TestPolicyVersion(c.Request.Context(), caller, appID, c.Param("policyName"), version, toFixtures(req.Fixtures))
+	if err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to test policy version")
+		return
+	}
+
+	c.JSON(http.StatusOK, toPolicyTestResponse(results))
+}
+
+// DiffPolicyVersions handles comparing two versions of an application policy.
+// @Summary Diff policy versions
+// @Description Returns the unified diff from one version of an application policy to another. Org admins only.
+// @Tags Policies
+// @Security BearerAuth
+// @Produce json
+// @Param appId path string true "Application ID"
+// @Param policyName path string true "Policy name"
+// @Param from query int true "Version to diff from"
+// @Param to query int true "Version to diff to"
+// @Success 200 {object} dto.PolicyDiffResponse "Diff"
+// @Failure 400 {object} dto.ErrorResponse "Invalid versions"
+// @Failure 401 {object} dto.ErrorResponse "Unauthorized"
+// @Failure 403 {object} dto.ErrorResponse "Caller is not an org admin"
+// @Failure 404 {object} dto.ErrorResponse "Application or policy version not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /apps/{appId}/policies/{policyName}/diff [get]
+func (h *AuthHandler) DiffPolicyVersions(c *gin.Context) {
+	caller, appID, ok := h.appRequest(c)
+	if !ok {
+		return
+	}
+
+	var query dto.PolicyDiffQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	name := c.Param("policyName")
+	diff, err := h.authService.DiffPolicyVersions(c.Request.Context(), caller, appID, name, query.From, query.To)
+	if err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to diff policy versions")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.PolicyDiffResponse{Name: name, From: diff.From, To: diff.To, Diff: diff.Diff})
+}
+
+// ActivatePolicyVersion handles activating a version of an application policy.
+// @Summary Activate policy version
+// @Description Makes a version of an application policy the one embedded decisions are evaluated with, after
+// @Description compiling it again with the application's other active policies. Org admins only.
+// @Tags Policies
+// @Security BearerAuth
+// @Produce json
+// @Param appId path string true "Application ID"
+// @Param policyName path string true "Policy name"
+// @Param version path int true "Policy version"
+// @Success 200 {object} dto.PolicyChangeResponse "Policy version activated"
+// @Failure 400 {object} dto.ErrorResponse "Invalid version"
+// @Failure 401 {object} dto.ErrorResponse "Unauthorized"
+// @Failure 403 {object} dto.ErrorResponse "Caller is not an org admin"
+// @Failure 404 {object} dto.ErrorResponse "Application or policy version not found"
+// @Failure 422 {object} dto.ErrorResponse "Policy no longer compiles"
+// @Failure 502 {object} dto.ErrorResponse "Policy engine could not load the version"
+// @Failure 503 {object} dto.ErrorResponse "Policy validation is not enabled"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /apps/{appId}/policies/{policyName}/versions/{version}/activate [post]
+func (h *AuthHandler) ActivatePolicyVersion(c *gin.Context) {
+	caller, appID, ok := h.appRequest(c)
+	if !ok {
+		return
+	}
+	version, ok := policyVersionParam(c)
+	if !ok {
+		return
+	}
+
+	change, err := h.authService.ActivatePolicyVersion(c.Request.Context(), caller, appID, c.Param("policyName"), version)
+	if err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to activate policy version")
+		return
+	}
+
+	c.JSON(http.StatusOK, toPolicyChangeResponse(change))
+}
+
+// RollbackPolicy handles rolling an application policy back to a previous version.
+// @Summary Roll back policy
+// @Description Activates a version of an application policy older than the active one. Org admins only.
+// @Tags Policies
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param appId path string true "Application ID"
+// @Param policyName path string true "Policy name"
+// @Param rollbackPolicyRequest body dto.RollbackPolicyRequest true "Rollback Policy Request"
+// @Success 200 {object} dto.PolicyChangeResponse "Policy rolled back"
+// @Failure 400 {object} dto.ErrorResponse "Invalid version"
+// @Failure 401 {object} dto.ErrorResponse "Unauthorized"
+// @Failure 403 {object} dto.ErrorResponse "Caller is not an org admin"
+// @Failure 404 {object} dto.ErrorResponse "Application or policy version not found"
+// @Failure 422 {object} dto.ErrorResponse "Policy no longer compiles"
+// @Failure 502 {object} dto.ErrorResponse "Policy engine could not load the version"
+// @Failure 503 {object} dto.ErrorResponse "Policy validation is not enabled"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /apps/{appId}/policies/{policyName}/rollback [post]
+func (h *AuthHandler) RollbackPolicy(c *gin.Context) {
+	caller, appID, ok := h.appRequest(c)
+	if !ok {
+		return
+	}
+
+	var req dto.RollbackPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	change, err := h.authService.RollbackPolicy(c.Request.Context(), caller, appID, c.Param("policyName"), req.Version)
+	if err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to roll back policy")
+		return
+	}
+
+	c.JSON(http.StatusOK, toPolicyChangeResponse(change))
+}
+
+// ListPolicyChanges handles listing the changes to an application's policies.
+// @Summary List policy changes
+// @Description Lists the uploads, activations and rollbacks of an application's policies with who made them,
+// @Description newest first. Org admins only.
+// @Tags Policies
+// @Security BearerAuth
+// @Produce json
+// @Param appId path string true "Application ID"
+// @Param page query int false "Page, starting at 1"
+// @Param page_size query int false "Page size (default 20, max 100)"
+// @Success 200 {object} dto.PolicyChangesResponse "Policy changes"
+// @Failure 400 {object} dto.ErrorResponse "Invalid page"
+// @Failure 401 {object} dto.ErrorResponse "Unauthorized"
+// @Failure 403 {object} dto.ErrorResponse "Caller is not an org admin"
+// @Failure 404 {object} dto.ErrorResponse "Application not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /apps/{appId}/policy-changes [get]
+func (h *AuthHandler) ListPolicyChanges(c *gin.Context) {
+	caller, appID, ok := h.appRequest(c)
+	if !ok {
+		return
+	}
+
+	var query dto.PageQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	changes, err := h.authService.ListPolicyChanges(c.Request.Context(), caller, appID, query.Page, query.PageSize)
+	if err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to list policy changes")
+		return
+	}
+
+	resp := dto.PolicyChangesResponse{
+		Changes:  make([]dto.PolicyChangeResponse, 0, len(changes.Changes)),
+		Page:     changes.Page,
+		PageSize: changes.PageSize,
+		Total:    changes.Total,
+	}
+	for i := range changes.Changes {
+		resp.Changes = append(resp.Changes, toPolicyChangeResponse(&changes.Changes[i]))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// policyVersionParam parses the version path parameter, writing a 400 when it is invalid
+func policyVersionParam(c *gin.Context) (int, bool) {
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version < 1 {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Invalid policy version"})
+		return 0, false
+	}
+	return version, true
+}
+
+func toFixtures(fixtures []dto.PolicyFixture) []policy.Fixture {
+	converted := make([]policy.Fixture, 0, len(fixtures))
+	for _, f := range fixtures {
+		roles := f.Input.User.Roles
+		if roles == nil {
+			roles = []string{}
+		}
+		converted = append(converted, policy.Fixture{
+			Name: f.Name,
+			Input: policy.Input{
+				User: policy.User{
+					ID:       f.Input.User.ID,
+					Email:    f.Input.User.Email,
+					OrgID:    f.Input.User.OrgID,
+					UserType: f.Input.User.UserType,
+					Roles:    roles,
+				},
+				Application: policy.Application{ID: f.Input.Application.ID, Name: f.Input.Application.Name},
+				Resource:    f.Input.Resource,
+				Action:      f.Input.Action,
+				Context:     f.Input.Context,
+			},
+			Allow:   f.Allow,
+			Reasons: f.Reasons,
+		})
+	}
+	return converted
+}
+
+func toPolicyTestResponse(results []policy.FixtureResult) dto.PolicyTestResponse {
+	resp := dto.PolicyTestResponse{Passed: true, Results: make([]dto.FixtureResult, 0, len(results))}
+	for _, result := range results {
+		converted := dto.FixtureResult{Name: result.Name, Passed: result.Passed, Error: result.Error}
+		if result.Decision != nil {
+			converted.Allow, converted.Reasons = result.Decision.Allow, result.Decision.Reasons
+		}
+		resp.Passed = resp.Passed && result.Passed
+		resp.Results = append(resp.Results, converted)
+	}
+	return resp
+}
+
+func toPolicyVersionResponse(p *models.OPAPolicy, withSource bool) dto.PolicyVersionResponse {
+	resp := dto.PolicyVersionResponse{
+		ID:        p.ID.String(),
+		AppID:     p.AppID.String(),
+		Name:      p.Name,
+		Version:   p.Version,
+		Active:    p.Active,
+		CreatedBy: p.CreatedBy.String(),
+		CreatedAt: p.CreatedAt.Format(time.RFC3339),
+	}
+	if withSource {
+		resp.Source = p.RegoPolicy
+	}
+	return resp
+}
+
+func toPolicyChangeResponse(change *models.PolicyChange) dto.PolicyChangeResponse {
+	return dto.PolicyChangeResponse{
+		ID:              change.ID.String(),
+		PolicyName:      change.PolicyName,
+		Version:         change.Version,
+		PreviousVersion: change.PreviousVersion,
+		Action:          change.Action,
+		ActorID:         change.ActorID.String(),
+		CreatedAt:       change.CreatedAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,291 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"shield/modules/authn/internal/api/dto"
+	"shield/modules/authn/internal/auth"
+	"shield/modules/authn/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ListRoles handles listing the roles of an application.
+// @Summary List application roles
+// @Description Lists the roles defined for an application. Org admins only.
+// @Tags Roles
+// @Security BearerAuth
+// @Produce json
+// @Param appId path string true "Application ID"
+// @Success 200 {array} dto.RoleResponse "Roles"
+// @Failure 401 {object} dto.ErrorResponse "Unauthorized"
+// @Failure 403 {object} dto.ErrorResponse "Caller is not an org admin"
+// @Failure 404 {object} dto.ErrorResponse "Application not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /apps/{appId}/roles [get]
+func (h *AuthHandler) ListRoles(c *gin.Context) {
+	caller, appID, ok := h.appRequest(c)
+	if !ok {
+		return
+	}
+
+	roles, err := h.authService.ListRoles(c.Request.Context(), caller, appID)
+	if err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to list roles")
+		return
+	}
+
+	resp := make([]dto.RoleResponse, 0, len(roles))
+	for i := range roles {
+		resp = append(resp, toRoleResponse(&roles[i]))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// CreateRole handles defining an application role.
+// @Summary Define application role
+// @Description Defines a role users can be assigned in an application. Org admins only.
+// @Tags Roles
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param appId path string true "Application ID"
+// @Param createRoleRequest body dto.CreateRoleRequest true "Create Role Request"
+// @Success 201 {object} dto.RoleResponse "Role defined"
+// @Failure 400 {object} dto.ErrorResponse "Invalid request payload"
+// @Failure 401 {object} dto.ErrorResponse "Unauthorized"
+// @Failure 403 {object} dto.ErrorResponse "Caller is not an org admin"
+// @Failure 404 {object} dto.ErrorResponse "Application not found"
+// @Failure 409 {object} dto.ErrorResponse "Role already exists"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /apps/{appId}/roles [post]
+func (h *AuthHandler) CreateRole(c *gin.Context) {
+	caller, appID, ok := h.appRequest(c)
+	if !ok {
+		return
+	}
+
+	var req dto.CreateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	role, err := h.authService.CreateRole(c.Request.Context(), caller, appID, auth.CreateRoleRequest{
+		Name:        req.Name,
+		Description: req.Description,
+	})
+	if err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to create role")
+		return
+	}
+
+	c.JSON(http.StatusCreated, toRoleResponse(role))
+}
+
+// DeleteRole handles deleting an application role.
+// @Summary Delete application role
+// @Description Deletes a role and removes it from every user holding it. Org admins only.
+// @Tags Roles
+// @Security BearerAuth
+// @Produce json
+// @Param appId path string true "Application ID"
+// @Param roleName path string true "Role name"
+// @Success 200 {object} dto.SuccessResponse "Role deleted"
+// @Failure 401 {object} dto.ErrorResponse "Unauthorized"
+// @Failure 403 {object} dto.ErrorResponse "Caller is not an org admin"
+// @Failure 404 {object} dto.ErrorResponse "Application or role not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /apps/{appId}/roles/{roleName} [delete]
+func (h *AuthHandler) DeleteRole(c *gin.Context) {
+	caller, appID, ok := h.appRequest(c)
+	if !ok {
+		return
+	}
+
+	if err := h.authService.DeleteRole(c.Request.Context(), caller, appID, c.Param("roleName")); err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to delete role")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Message: "Role deleted"})
+}
+
+// ListRoleHolders handles listing the users holding a role.
+// @Summary List role holders
+// @Description Lists the users holding an application role, ordered by email. Org admins only.
+// @Tags Roles
+// @Security BearerAuth
+// @Produce json
+// @Param appId path string true "Application ID"
+// @Param roleName path string true "Role name"
+// @Param page query int false "Page, starting at 1"
+// @Param page_size query int false "Page size (default 20, max 100)"
+// @Success 200 {object} dto.RoleHoldersResponse "Role holders"
+// @Failure 400 {object} dto.ErrorResponse "Invalid page"
+// @Failure 401 {object} dto.ErrorResponse "Unauthorized"
+// @Failure 403 {object} dto.ErrorResponse "Caller is not an org admin"
+// @Failure 404 {object} dto.ErrorResponse "Application or role not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /apps/{appId}/roles/{roleName}/users [get]
+func (h *AuthHandler) ListRoleHolders(c *gin.Context) {
+	caller, appID, ok := h.appRequest(c)
+	if !ok {
+		return
+	}
+
+	var query dto.PageQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	holders, err := h.authService.ListRoleHolders(c.Request.Context(), caller, appID, c.Param("roleName"), query.Page, query.PageSize)
+	if err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to list role holders")
+		return
+	}
+
+	resp := dto.RoleHoldersResponse{
+		Users:    make([]dto.RoleHolder, 0, len(holders.Users)),
+		Page:     holders.Page,
+		PageSize: holders.PageSize,
+		Total:    holders.Total,
+	}
+	for _, user := range holders.Users {
+		resp.Users = append(resp.Users, dto.RoleHolder{ID: user.ID.String(), Email: user.Email, UserType: string(user.UserType)})
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// AssignRole handles assigning a role to a user.
+// @Summary Assign role
+// @Description Assigns an application role to a member of the caller's organization. Assigning a held role succeeds. Org admins only.
+// @Tags Roles
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param appId path string true "Application ID"
+// @Param roleName path string true "Role name"
+// @Param assignRoleRequest body dto.AssignRoleRequest true "Assign Role Request"
+// @Success 200 {object} dto.SuccessResponse "Role assigned"
+// @Failure 400 {object} dto.ErrorResponse "Invalid request payload"
+// @Failure 401 {object} dto.ErrorResponse "Unauthorized"
+// @Failure 403 {object} dto.ErrorResponse "Caller is not an org admin"
+// @Failure 404 {object} dto.ErrorResponse "Application, role or user not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /apps/{appId}/roles/{roleName}/users [post]
+func (h *AuthHandler) AssignRole(c *gin.Context) {
+	caller, appID, ok := h.appRequest(c)
+	if !ok {
+		return
+	}
+
+	var req dto.AssignRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+	userID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Invalid user ID"})
+		return
+	}
+
+	if err := h.authService.AssignRole(c.Request.Context(), caller, appID, userID, c.Param("roleName")); err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to assign role")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Message: "Role assigned"})
+}
+
+// UnassignRole handles removing a role from a user.
+// @Summary Unassign role
+// @Description Removes an application role from a member of the caller's organization. Org admins only.
+// @Tags Roles
+// @Security BearerAuth
+// @Produce json
+// @Param appId path string true "Application ID"
+// @Param roleName path string true "Role name"
+// @Param userId path string true "User ID"
+// @Success 200 {object} dto.SuccessResponse "Role unassigned"
+// @Failure 400 {object} dto.ErrorResponse "Invalid user ID"
+// @Failure 401 {object} dto.ErrorResponse "Unauthorized"
+// @Failure 403 {object} dto.ErrorResponse "Caller is not an org admin"
+// @Failure 404 {object} dto.ErrorResponse "Application, user or assignment not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /apps/{appId}/roles/{roleName}/users/{userId} [delete]
+func (h *AuthHandler) UnassignRole(c *gin.Context) {
+	caller, appID, ok := h.appRequest(c)
+	if !ok {
+		return
+	}
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Invalid user ID"})
+		return
+	}
+
+	if err := h.authService.UnassignRole(c.Request.Context(), caller, appID, userID, c.Param("roleName")); err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to unassign role")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Message: "Role unassigned"})
+}
+
+// ListUserRoles handles listing a user's roles across applications.
+// @Summary List a user's effective roles
+// @Description Lists the roles a user holds, grouped by application. Users may list their own roles;
+// @Description org admins also those of members of their organization.
+// @Tags Roles
+// @Security BearerAuth
+// @Produce json
+// @Param userId path string true "User ID"
+// @Success 200 {array} dto.UserApplicationRoles "Roles by application"
+// @Failure 400 {object} dto.ErrorResponse "Invalid user ID"
+// @Failure 401 {object} dto.ErrorResponse "Unauthorized"
+// @Failure 403 {object} dto.ErrorResponse "Caller is not an org admin"
+// @Failure 404 {object} dto.ErrorResponse "User not found"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /users/{userId}/roles [get]
+func (h *AuthHandler) ListUserRoles(c *gin.Context) {
+	caller, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Invalid user ID"})
+		return
+	}
+
+	roles, err := h.authService.ListUserRoles(c.Request.Context(), caller, userID)
+	if err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to list user roles")
+		return
+	}
+
+	resp := make([]dto.UserApplicationRoles, 0, len(roles))
+	for _, appRoles := range roles {
+		resp = append(resp, dto.UserApplicationRoles{
+			AppID:   appRoles.Application.ID.String(),
+			AppName: appRoles.Application.Name,
+			Roles:   appRoles.Roles,
+		})
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func toRoleResponse(role *models.ApplicationRole) dto.RoleResponse {
+	return dto.RoleResponse{
+		ID:          role.ID.String(),
+		AppID:       role.AppID.String(),
+		Name:        role.Name,
+		Description: role.Description,
+		CreatedAt:   role.CreatedAt.Format(time.RFC3339),
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"shield/modules/authn/internal/auth"
+	"shield/modules/authn/internal/auth/nonce"
 	// _ "shield/modules/authn/docs" // docs is generated by Swag CLI; uncomment after running swag init
 	// Import other necessary packages like config, db, etc. for full initialization
 )
@@ -15,21 +16,42 @@ func RegisterAuthRoutes(router gin.IRouter /* *gin.Engine or *gin.RouterGroup */
 	// In a real setup, AuthService itself would be initialized with its dependencies (DB, Cognito client, config)
 	// For now, we assume authService is already initialized and passed in.
 	authHandler := NewAuthHandler(authService)
+	requireAuth := RequireAuth(authService)
 
 	// Group routes for /auth
 	authRoutes := router.Group("/auth")
 	{
+		// Nonces protect the state-changing routes below against CSRF and replay
+		authRoutes.GET("/nonce", authHandler.GetNonce)
+
 		// Signup routes
-		authRoutes.POST("/signup", authHandler.Signup)
-		authRoutes.POST("/confirm", authHandler.ConfirmSignup)
+		authRoutes.POST("/signup", RequireNonce(authService, nonce.PurposeSignup), authHandler.Signup)
+		authRoutes.POST("/confirm", RequireNonce(authService, nonce.PurposeConfirm), authHandler.ConfirmSignup)
+		authRoutes.POST("/confirm/resend", RequireNonce(authService, nonce.PurposeConfirm), authHandler.ResendConfirmation)
 
 		// Authentication routes
-		authRoutes.POST("/login", authHandler.Login)
-		authRoutes.POST("/logout", authHandler.Logout)
-		authRoutes.POST("/refresh", authHandler.RefreshToken)
+		authRoutes.POST("/login", RequireNonce(authService, nonce.PurposeLogin), authHandler.Login)
+		authRoutes.POST("/login/challenge", RequireNonce(authService, nonce.PurposeMFA), authHandler.RespondToLoginChallenge)
+		authRoutes.POST("/logout", requireAuth, authHandler.Logout)
+		authRoutes.POST("/logout/all", requireAuth, authHandler.LogoutAll)
+		// Clients that refresh without a browser can exempt "POST /auth/refresh" in nonce.exempt
+		authRoutes.POST("/refresh", RequireNonce(authService, nonce.PurposeRefresh), authHandler.RefreshToken)
+		authRoutes.GET("/session", requireAuth, authHandler.GetSession)
+
+		// Password routes
+		passwordNonce := RequireNonce(authService, nonce.PurposePassword)
+		authRoutes.POST("/password/forgot", passwordNonce, authHandler.ForgotPassword)
+		authRoutes.POST("/password/reset", passwordNonce, authHandler.ResetPassword)
+		authRoutes.POST("/password/change", requireAuth, passwordNonce, authHandler.ChangePassword)
+
+		// SSO routes
+		authRoutes.GET("/sso/start", authHandler.StartSSO)
+		authRoutes.GET("/callback", authHandler.SSOCallback)
 
 		// MFA routes
-		mfaRoutes := authRoutes.Group("/mfa")
+		// Authenticated users enroll with their access token; users finishing an
+		// MFA_SETUP login challenge have no token yet and pass the challenge session instead
+		mfaRoutes := authRoutes.Group("/mfa", OptionalAuth(authService), RequireNonce(authService, nonce.PurposeMFA))
 		{
 			mfaRoutes.POST("/setup", authHandler.SetupMFA)
 			mfaRoutes.POST("/verify", authHandler.VerifyMFA)
@@ -39,7 +61,67 @@ func RegisterAuthRoutes(router gin.IRouter /* *gin.Engine or *gin.RouterGroup */
 	// Organization signup routes
 	orgRoutes := router.Group("/org")
 	{
-		orgRoutes.POST("/signup", authHandler.OrgSignup)
+		orgRoutes.POST("/signup", RequireNonce(authService, nonce.PurposeSignup), authHandler.OrgSignup)
+
+		// Organization management
+		orgAuth := orgRoutes.Group("", requireAuth)
+		orgAuth.GET("/:orgId", authHandler.GetOrgDetails)
+		orgAuth.PATCH("/:orgId", authHandler.UpdateOrg)
+		orgAuth.DELETE("/:orgId", authHandler.DeleteOrg)
+		orgAuth.POST("/:orgId/restore", authHandler.RestoreOrg)
+
+		// Org admin SSO configuration
+		orgAuth.GET("/:orgId/sso", authHandler.GetOrgSSOConfig)
+		orgAuth.POST("/:orgId/sso", authHandler.CreateOrgSSOConfig)
+		orgAuth.PUT("/:orgId/sso", authHandler.UpdateOrgSSOConfig)
+		orgAuth.POST("/:orgId/sso/test", authHandler.TestOrgSSOConfig)
+		orgAuth.POST("/:orgId/sso/domains/verify", authHandler.VerifyOrgSSODomains)
+		orgAuth.DELETE("/:orgId/sso", authHandler.DeleteOrgSSOConfig)
+	}
+
+	// Application management, for org admins
+	appRoutes := router.Group("/apps", requireAuth)
+	{
+		appRoutes.POST("", authHandler.CreateApplication)
+		appRoutes.GET("", authHandler.ListApplications)
+		appRoutes.GET("/:appId", authHandler.GetApplication)
+		appRoutes.PATCH("/:appId", authHandler.UpdateApplication)
+		appRoutes.DELETE("/:appId", authHandler.DeleteApplication)
+
+		// API keys
+		appRoutes.GET("/:appId/keys", authHandler.ListAPIKeys)
+		appRoutes.POST("/:appId/keys/rotate", authHandler.RotateAPIKey)
+		appRoutes.DELETE("/:appId/keys/:keyId", authHandler.RevokeAPIKey)
+
+		// Role catalog and assignments
+		appRoutes.GET("/:appId/roles", authHandler.ListRoles)
+		appRoutes.POST("/:appId/roles", authHandler.CreateRole)
+		appRoutes.DELETE("/:appId/roles/:roleName", authHandler.DeleteRole)
+		appRoutes.GET("/:appId/roles/:roleName/users", authHandler.ListRoleHolders)
+		appRoutes.POST("/:appId/roles/:roleName/users", authHandler.AssignRole)
+		appRoutes.DELETE("/:appId/roles/:roleName/users/:userId", authHandler.UnassignRole)
+
+		// Policy versions, activation and their history
+		appRoutes.GET("/:appId/policies/:policyName/versions", authHandler.ListPolicyVersions)
+		appRoutes.POST("/:appId/policies/:policyName/versions", authHandler.UploadPolicy)
+		appRoutes.GET("/:appId/policies/:policyName/versions/:version", authHandler.GetPolicyVersion)
+		appRoutes.POST("/:appId/policies/:policyName/versions/:version/test", authHandler.TestPolicyVersion)
+		appRoutes.POST("/:appId/policies/:policyName/versions/:version/activate", authHandler.ActivatePolicyVersion)
+		appRoutes.POST("/:appId/policies/:policyName/rollback", authHandler.RollbackPolicy)
+		appRoutes.GET("/:appId/policies/:policyName/diff", authHandler.DiffPolicyVersions)
+		appRoutes.GET("/:appId/policy-changes", authHandler.ListPolicyChanges)
+	}
+
+	// Effective roles of users across applications
+	userRoutes := router.Group("/users", requireAuth)
+	{
+		userRoutes.GET("/:userId/roles", authHandler.ListUserRoles)
+	}
+
+	// Authorization decisions, for users and for applications authenticated by API key
+	authzRoutes := router.Group("/authz", RequireUserOrAPIKey(authService))
+	{
+		authzRoutes.POST("/decide", authHandler.Decide)
 	}
 
 	// Swagger route specific to this module if run standalone (now handled by main app)
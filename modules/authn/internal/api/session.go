@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"shield/modules/authn/internal/api/dto"
+	"shield/modules/authn/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// GetSession returns the authenticated user and session.
+// @Summary Get current session
+// @Description Returns the user and session of the session cookie or bearer token. Used by the SPA to check its login status.
+// @Tags Authentication
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} dto.SessionResponse "Current session"
+// @Failure 401 {object} dto.ErrorResponse "Not logged in"
+// @Router /auth/session [get]
+func (h *AuthHandler) GetSession(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	resp := dto.SessionResponse{User: toSessionUser(user)}
+	if sessionData, ok := CurrentSession(c); ok {
+		resp.Session = &dto.SessionInfo{
+			ID:        sessionData.ID,
+			CreatedAt: sessionData.CreatedAt.Format(time.RFC3339),
+			ExpiresAt: sessionData.ExpiresAt.Format(time.RFC3339),
+			IPAddress: sessionData.IPAddress,
+			UserAgent: sessionData.UserAgent,
+		}
+		resp.ExpiresIn = int64(time.Until(sessionData.ExpiresAt).Seconds())
+	} else if claims, ok := CurrentClaims(c); ok && claims.ExpiresAt != nil {
+		resp.ExpiresIn = int64(time.Until(claims.ExpiresAt.Time).Seconds())
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func toSessionUser(user *models.User) dto.SessionUser {
+	resp := dto.SessionUser{
+		ID:         user.ID.String(),
+		Email:      user.Email,
+		UserType:   string(user.UserType),
+		MFAEnabled: user.MFAEnabled,
+	}
+	if user.OrgID != uuid.Nil {
+		resp.OrgID = user.OrgID.String()
+	}
+	for _, method := range user.EnrolledMFAMethods() {
+		resp.MFAMethods = append(resp.MFAMethods, string(method))
+	}
+	return resp
+}
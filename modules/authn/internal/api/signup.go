@@ -2,9 +2,11 @@ package api
 
 import (
 	"net/http"
+	"time"
 
 	"shield/modules/authn/internal/api/dto"
 	"shield/modules/authn/internal/auth"
+	authprovider "shield/modules/authn/internal/auth/provider"
 
 	"github.com/gin-gonic/gin"
 )
@@ -16,8 +18,10 @@ import (
 // @Accept json
 // @Produce json
 // @Param signupRequest body dto.SignupRequest true "Signup Request"
+// @Param X-Nonce header string true "Nonce issued by GET /auth/nonce"
+// @Param X-Device-Fingerprint header string true "Device fingerprint the nonce was issued to"
 // @Success 201 {object} dto.SignupResponse "User registered successfully, verification pending"
-// @Failure 400 {object} dto.ErrorResponse "Invalid request payload"
+// @Failure 400 {object} dto.ErrorResponse "Invalid request payload or nonce"
 // @Failure 500 {object} dto.ErrorResponse "Internal server error"
 // @Router /auth/signup [post]
 func (h *AuthHandler) Signup(c *gin.Context) {
@@ -34,21 +38,17 @@ func (h *AuthHandler) Signup(c *gin.Context) {
 
 	resp, err := h.authService.SignupUser(c.Request.Context(), serviceReq)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to signup user"})
+		writeError(c, err, http.StatusInternalServerError, "Failed to signup user")
 		return
 	}
 
 	response := dto.SignupResponse{
 		UserID:               resp.UserID,
 		RequiresConfirmation: resp.RequiresConfirmation,
+		CodeDeliveryDetails:  codeDeliveryDetails(resp.CodeDeliveryDetails),
 	}
-
-	if resp.CodeDeliveryDetails != nil {
-		response.CodeDeliveryDetails = &dto.CodeDeliveryDetails{
-			AttributeName:  resp.CodeDeliveryDetails.AttributeName,
-			DeliveryMedium: resp.CodeDeliveryDetails.DeliveryMedium,
-			Destination:    resp.CodeDeliveryDetails.Destination,
-		}
+	if !resp.ResendAvailableAt.IsZero() {
+		response.ResendAvailableAt = resp.ResendAvailableAt.UTC().Format(time.RFC3339)
 	}
 
 	if resp.RequiresConfirmation {
@@ -67,8 +67,12 @@ func (h *AuthHandler) Signup(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param confirmSignupRequest body dto.ConfirmSignupRequest true "Confirm Signup Request"
+// @Param X-Nonce header string true "Nonce issued by GET /auth/nonce"
+// @Param X-Device-Fingerprint header string true "Device fingerprint the nonce was issued to"
 // @Success 200 {object} dto.SuccessResponse "User confirmed successfully"
-// @Failure 400 {object} dto.ErrorResponse "Invalid request payload"
+// @Failure 400 {object} dto.ErrorResponse "Invalid request payload, nonce or verification code"
+// @Failure 410 {object} dto.ErrorResponse "Verification code expired"
+// @Failure 429 {object} dto.ErrorResponse "Too many attempts"
 // @Failure 500 {object} dto.ErrorResponse "Internal server error"
 // @Router /auth/confirm [post]
 func (h *AuthHandler) ConfirmSignup(c *gin.Context) {
@@ -85,9 +89,53 @@ func (h *AuthHandler) ConfirmSignup(c *gin.Context) {
 
 	_, err := h.authService.ConfirmUserSignup(c.Request.Context(), serviceReq)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to confirm signup"})
+		writeError(c, err, http.StatusInternalServerError, "Failed to confirm signup")
 		return
 	}
 
 	c.JSON(http.StatusOK, dto.SuccessResponse{Message: "Account confirmed successfully"})
 }
+
+// ResendConfirmation sends a new signup confirmation code.
+// @Summary Resend confirmation code
+// @Description Sends a new verification code to an unconfirmed user. The response is the same whether or not an account exists. Codes can be requested once per cooldown; the Retry-After header tells when the next request is accepted.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param resendConfirmationRequest body dto.ResendConfirmationRequest true "Resend Confirmation Request"
+// @Param X-Nonce header string true "Nonce issued by GET /auth/nonce"
+// @Param X-Device-Fingerprint header string true "Device fingerprint the nonce was issued to"
+// @Success 200 {object} dto.ResendConfirmationResponse "Verification code sent if the account exists"
+// @Failure 400 {object} dto.ErrorResponse "Invalid request payload or nonce"
+// @Failure 429 {object} dto.ErrorResponse "Code requested too soon or too many attempts"
+// @Failure 500 {object} dto.ErrorResponse "Internal server error"
+// @Router /auth/confirm/resend [post]
+func (h *AuthHandler) ResendConfirmation(c *gin.Context) {
+	var req dto.ResendConfirmationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	resp, err := h.authService.ResendConfirmationCode(c.Request.Context(), req.Email)
+	if err != nil {
+		writeError(c, err, http.StatusInternalServerError, "Failed to resend confirmation code")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.ResendConfirmationResponse{
+		Message:           "If an unconfirmed account exists for this email, a verification code has been sent",
+		ResendAvailableAt: resp.ResendAvailableAt.UTC().Format(time.RFC3339),
+	})
+}
+
+func codeDeliveryDetails(details *authprovider.CodeDeliveryDetailsData) *dto.CodeDeliveryDetails {
+	if details == nil {
+		return nil
+	}
+	return &dto.CodeDeliveryDetails{
+		AttributeName:  details.AttributeName,
+		DeliveryMedium: details.DeliveryMedium,
+		Destination:    details.Destination,
+	}
+}
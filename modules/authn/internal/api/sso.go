@@ -0,0 +1,93 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"shield/modules/authn/internal/api/dto"
+	"shield/modules/authn/internal/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+const ssoStateCookie = "shield_sso_state"
+
+// StartSSO starts a backend-handled SSO login.
+// @Summary Start SSO login
+// @Description Redirects the browser to the organization's identity provider via the Cognito hosted UI.
+// @Tags Authentication
+// @Param org query string true "Organization ID or name"
+// @Param redirect query string false "Relative path to return to after login"
+// @Success 302 "Redirect to the identity provider"
+// @Failure 400 {object} dto.ErrorResponse "Missing organization or SSO not configured"
+// @Failure 404 {object} dto.ErrorResponse "Organization not found"
+// @Router /auth/sso/start [get]
+func (h *AuthHandler) StartSSO(c *gin.Context) {
+	org := c.Query("org")
+	if org == "" {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Organization is required"})
+		return
+	}
+
+	resp, err := h.authService.StartSSO(c.Request.Context(), auth.SSOStartRequest{
+		Org:      org,
+		Redirect: c.Query("redirect"),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrSSODisabled), errors.Is(err, auth.ErrSSONotConfigured):
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "Organization not found"})
+		}
+		return
+	}
+
+	// Lax so the cookie survives the top-level redirect back from the identity provider
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(ssoStateCookie, resp.State, int(resp.StateTTL.Seconds()), "/", "", h.authService.SecureCookies(), true)
+	c.Redirect(http.StatusFound, resp.AuthorizeURL)
+}
+
+// SSOCallback completes a backend-handled SSO login.
+// @Summary SSO callback
+// @Description Exchanges the authorization code, creates the session cookie and redirects back to the SPA.
+// @Tags Authentication
+// @Param code query string true "Authorization code"
+// @Param state query string true "OAuth2 state"
+// @Success 302 "Redirect to the requested SPA path"
+// @Failure 400 {object} dto.ErrorResponse "Invalid callback request"
+// @Failure 401 {object} dto.ErrorResponse "SSO login failed"
+// @Router /auth/callback [get]
+func (h *AuthHandler) SSOCallback(c *gin.Context) {
+	secure := h.authService.SecureCookies()
+	stateCookie, _ := c.Cookie(ssoStateCookie)
+	// The state is single use
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(ssoStateCookie, "", -1, "/", "", secure, true)
+
+	if errCode := c.Query("error"); errCode != "" {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: "SSO login failed: " + errCode})
+		return
+	}
+
+	code := c.Query("code")
+	state := c.Query("state")
+	if code == "" || state == "" || stateCookie == "" {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Invalid callback request"})
+		return
+	}
+
+	resp, err := h.authService.CompleteSSO(c.Request.Context(), auth.SSOCallbackRequest{
+		Code:        code,
+		State:       state,
+		StateCookie: stateCookie,
+	}, clientInfoFromRequest(c))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: "SSO login failed"})
+		return
+	}
+
+	http.SetCookie(c.Writer, h.authService.SessionCookies().Cookie(resp.Login.SessionID))
+	c.Redirect(http.StatusFound, resp.Redirect)
+}
@@ -0,0 +1,68 @@
+// Package apikey generates and verifies the API keys applications authenticate with.
+//
+// Keys have the form shk_<prefix>_<secret>. The prefix identifies the key and may be shown
+// and logged; the secret is only returned when the key is issued, and stored as a hash.
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const scheme = "shk"
+
+// ErrMalformed is returned for values that are not API keys
+var ErrMalformed = errors.New("apikey: malformed API key")
+
+// Key is a newly generated API key
+type Key struct {
+	Prefix     string
+	SecretHash string
+	Plaintext  string // The full key, returned to the caller once
+}
+
+// Generate returns a new random API key
+func Generate() (*Key, error) {
+	prefix := make([]byte, 6)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, fmt.Errorf("failed to generate API key: %w", err)
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate API key: %w", err)
+	}
+
+	key := &Key{Prefix: hex.EncodeToString(prefix)}
+	encoded := base64.RawURLEncoding.EncodeToString(secret)
+	key.SecretHash = Hash(encoded)
+	key.Plaintext = scheme + "_" + key.Prefix + "_" + encoded
+	return key, nil
+}
+
+// Parse splits an API key into its prefix and secret
+func Parse(raw string) (prefix, secret string, err error) {
+	// The secret is base64url encoded and may itself contain underscores
+	parts := strings.SplitN(strings.TrimSpace(raw), "_", 3)
+	if len(parts) != 3 || parts[0] != scheme || parts[1] == "" || parts[2] == "" {
+		return "", "", ErrMalformed
+	}
+	return parts[1], parts[2], nil
+}
+
+// Hash returns the hash under which a secret is stored.
+// Secrets are random, so an unsalted SHA-256 is sufficient.
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Verify reports whether secret matches the stored hash, in constant time
+func Verify(secret, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(Hash(secret)), []byte(hash)) == 1
+}
@@ -0,0 +1,65 @@
+package apikey
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGenerateAndVerify(t *testing.T) {
+	key, err := Generate()
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if !strings.HasPrefix(key.Plaintext, "shk_"+key.Prefix+"_") || strings.Contains(key.SecretHash, key.Prefix) {
+		t.Fatalf("Generate() = %+v, want shk_<prefix>_<secret>", key)
+	}
+
+	prefix, secret, err := Parse(key.Plaintext)
+	if err != nil || prefix != key.Prefix {
+		t.Fatalf("Parse() = %q, %v; want prefix %q", prefix, err, key.Prefix)
+	}
+	if !Verify(secret, key.SecretHash) {
+		t.Error("Verify() rejected the generated secret")
+	}
+	if Verify(secret+"x", key.SecretHash) {
+		t.Error("Verify() accepted a different secret")
+	}
+
+	other, _ := Generate()
+	if other.Prefix == key.Prefix || other.Plaintext == key.Plaintext {
+		t.Error("Generate() returned the same key twice")
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		raw        string
+		wantPrefix string
+		wantSecret string
+		wantErr    bool
+	}{
+		{raw: "shk_0a1b2c3d4e5f_c2VjcmV0", wantPrefix: "0a1b2c3d4e5f", wantSecret: "c2VjcmV0"},
+		{raw: "shk_0a1b2c3d4e5f_se_cr_et", wantPrefix: "0a1b2c3d4e5f", wantSecret: "se_cr_et"},
+		{raw: " shk_0a1b_secret\n", wantPrefix: "0a1b", wantSecret: "secret"},
+		{raw: "", wantErr: true},
+		{raw: "shk_0a1b2c3d4e5f", wantErr: true},
+		{raw: "shk__secret", wantErr: true},
+		{raw: "pk_0a1b2c3d4e5f_secret", wantErr: true},
+		{raw: "Bearer eyJhbGciOi", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			prefix, secret, err := Parse(tt.raw)
+			if tt.wantErr {
+				if !errors.Is(err, ErrMalformed) {
+					t.Errorf("Parse() error = %v, want ErrMalformed", err)
+				}
+				return
+			}
+			if err != nil || prefix != tt.wantPrefix || secret != tt.wantSecret {
+				t.Errorf("Parse() = %q, %q, %v; want %q, %q", prefix, secret, err, tt.wantPrefix, tt.wantSecret)
+			}
+		})
+	}
+}
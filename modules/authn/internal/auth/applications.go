@@ -0,0 +1,352 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"shield/modules/authn/internal/auth/apikey"
+	"shield/modules/authn/internal/auth/policy"
+	"shield/modules/authn/internal/models"
+	"shield/modules/authn/internal/repository"
+	apperrors "shield/modules/common/errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultKeyOverlap is how long rotated-out API keys keep working by default
+	DefaultKeyOverlap = 24 * time.Hour
+	// MaxKeyOverlap bounds the overlap of a key rotation
+	MaxKeyOverlap = 30 * 24 * time.Hour
+
+	// keyUseInterval limits how often the last use of an API key is written
+	keyUseInterval = time.Minute
+)
+
+var (
+	ErrInvalidAPIKey  = apperrors.NewAppError("INVALID_API_KEY", "Invalid or expired API key", http.StatusUnauthorized)
+	ErrAPIKeyNotFound = apperrors.NewAppError("API_KEY_NOT_FOUND", "API key not found", http.StatusNotFound)
+)
+
+// WithApplications enables application management and API key authentication
+func WithApplications(repo repository.ApplicationRepository) Option {
+	return func(s *AuthService) {
+		s.applications = repo
+	}
+}
+
+// CreateApplicationRequest contains the fields of a new application. Its policy package is
+// derived from its ID, see PolicyPackage.
+type CreateApplicationRequest struct {
+	Name string
+}
+
+// UpdateApplicationRequest contains the application fields to change. Nil fields are left unchanged.
+type UpdateApplicationRequest struct {
+	Name   *string
+	Status *string
+}
+
+// IssuedAPIKey is a new API key. Secret is the full key; it is not stored and cannot be shown again.
+type IssuedAPIKey struct {
+	Key    *models.APIKey
+	Secret string
+}
+
+// CreateApplication registers an application of the caller's organization and issues its first
+// API key. Only org admins may create applications.
+func (s *AuthService) CreateApplication(ctx context.Context, caller *models.User, req CreateApplicationRequest) (*models.Application, *IssuedAPIKey, error) {
+	if err := applicationAdmin(caller); err != nil {
+		return nil, nil, err
+	}
+
+	app := &models.Application{
+		ID:     uuid.New(),
+		OrgID:  caller.OrgID,
+		Name:   strings.TrimSpace(req.Name),
+		Status: models.ApplicationStatusActive,
+	}
+	app.OPAEndpoint = PolicyPackage(app.OrgID, app.ID)
+	if err := validateApplication(app); err != nil {
+		return nil, nil, err
+	}
+
+	key, issued, err := newAPIKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.applications.CreateApplication(ctx, app, key); err != nil {
+		return nil, nil, fmt.Errorf("failed to create application: %w", err)
+	}
+	return app, issued, nil
+}
+
+// ListApplications returns the applications of the caller's organization. Org admins only.
+func (s *AuthService) ListApplications(ctx context.Context, caller *models.User) ([]models.Application, error) {
+	if err := applicationAdmin(caller); err != nil {
+		return nil, err
+	}
+	return s.applications.ListApplications(ctx, caller.OrgID)
+}
+
+// GetApplication returns an application of the caller's organization. Org admins only.
+func (s *AuthService) GetApplication(ctx context.Context, caller *models.User, appID uuid.UUID) (*models.Application, error) {
+	return s.adminApplication(ctx, caller, appID)
+}
+
+// UpdateApplication applies a partial update to an application. Org admins only.
+func (s *AuthService) UpdateApplication(ctx context.Context, caller *models.User, appID uuid.UUID, req UpdateApplicationRequest) (*models.Application, error) {
+	app, err := s.adminApplication(ctx, caller, appID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		app.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Status != nil {
+		app.Status = *req.Status
+	}
+	if err := validateApplication(app); err != nil {
+		return nil, err
+	}
+
+	if err := s.applications.UpdateApplication(ctx, app); err != nil {
+		return nil, fmt.Errorf("failed to update application: %w", err)
+	}
+	return app, nil
+}
+
+// DeleteApplication deletes an application with its API keys, roles and policies. Org admins only.
+func (s *AuthService) DeleteApplication(ctx context.Context, caller *models.User, appID uuid.UUID) error {
+	if _, err := s.adminApplication(ctx, caller, appID); err != nil {
+		return err
+	}
+	if err := s.applications.DeleteApplication(ctx, appID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrApplicationNotFound
+		}
+		return fmt.Errorf("failed to delete application: %w", err)
+	}
+	if s.policyPublisher != nil {
+		if err := s.policyPublisher.Publish(ctx, appID, nil); err != nil {
+			log.Printf("Failed to remove the policies of deleted application %s: %v", appID, err)
+		}
+	}
+	return nil
+}
+
+// MigrateApplicationPackages moves the applications registered with a policy package of their
+// choosing to their own package, see PolicyPackage. Their active policies are uploaded again as
+// new versions declaring that package, and activated, by uuid.Nil. Applications registered before
+// applications belonged to organizations have no package and are disabled.
+func (s *AuthService) MigrateApplicationPackages(ctx context.Context) error {
+	if s.applications == nil {
+		return nil
+	}
+	apps, err := s.applications.ListAllApplications(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list applications: %w", err)
+	}
+
+	var errs []error
+	for i := range apps {
+		app := &apps[i]
+		if app.OrgID == uuid.Nil {
+			if app.Status == models.ApplicationStatusDisabled {
+				continue
+			}
+			app.Status = models.ApplicationStatusDisabled
+			if err := s.applications.UpdateApplication(ctx, app); err != nil {
+				errs = append(errs, fmt.Errorf("application %s: %w", app.ID, err))
+				continue
+			}
+			log.Printf("Disabled application %s: it belongs to no organization", app.ID)
+			continue
+		}
+		if pkg := PolicyPackage(app.OrgID, app.ID); app.OPAEndpoint != pkg {
+			if err := s.migrateApplicationPackage(ctx, app, pkg); err != nil {
+				errs = append(errs, fmt.Errorf("application %s: %w", app.ID, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// migrateApplicationPackage rewrites the active policies of an application for its package and
+// saves the package. Policies that do not compile once rewritten are left as they are; decisions
+// fail until new versions are uploaded.
+func (s *AuthService) migrateApplicationPackage(ctx context.Context, app *models.Application, pkg string) error {
+	active, err := s.applications.ActivePolicies(ctx, app.ID)
+	if err != nil {
+		return fmt.Errorf("failed to load active policies: %w", err)
+	}
+	rewritten := make([]models.OPAPolicy, 0, len(active))
+	for _, p := range active {
+		rewritten = append(rewritten, models.OPAPolicy{AppID: p.AppID, Name: p.Name, RegoPolicy: policy.RenamePackage(p.RegoPolicy, app.OPAEndpoint, pkg)})
+	}
+
+	if len(rewritten) > 0 && s.policyValidator != nil {
+		if _, err := s.policyValidator.Validate(ctx, pkg, rewritten, nil); err != nil {
+			log.Printf("Policies of application %s must be uploaded again for package %s: %v", app.ID, pkg, err)
+			rewritten = nil
+		}
+	}
+	for i := range rewritten {
+		p := &rewritten[i]
+		if err := s.applications.CreatePolicyVersion(ctx, p, uuid.Nil); err != nil {
+			return fmt.Errorf("failed to save policy %s: %w", p.Name, err)
+		}
+		change := &models.PolicyChange{AppID: app.ID, PolicyName: p.Name, Version: p.Version, Action: models.PolicyChangeActivate, ActorID: uuid.Nil}
+		if err := s.applications.ActivatePolicyVersion(ctx, change); err != nil {
+			return fmt.Errorf("failed to activate policy %s: %w", p.Name, err)
+		}
+	}
+
+	log.Printf("Moved the policies of application %s from package %s to %s", app.ID, app.OPAEndpoint, pkg)
+	app.OPAEndpoint = pkg
+	return s.applications.UpdateApplication(ctx, app)
+}
+
+// ListAPIKeys returns the API keys of an application, including expired and revoked ones.
+func (s *AuthService) ListAPIKeys(ctx context.Context, caller *models.User, appID uuid.UUID) ([]models.APIKey, error) {
+	if _, err := s.adminApplication(ctx, caller, appID); err != nil {
+		return nil, err
+	}
+	return s.applications.ListAPIKeys(ctx, appID)
+}
+
+// RotateAPIKey issues a new API key. The application's current keys keep working for overlap,
+// so clients can switch over; an overlap of zero ends them immediately.
+func (s *AuthService) RotateAPIKey(ctx context.Context, caller *models.User, appID uuid.UUID, overlap time.Duration) (*IssuedAPIKey, error) {
+	if overlap < 0 || overlap > MaxKeyOverlap {
+		return nil, apperrors.NewAppError("INVALID_OVERLAP", fmt.Sprintf("Overlap must be between 0 and %s", MaxKeyOverlap), http.StatusBadRequest)
+	}
+	app, err := s.adminApplication(ctx, caller, appID)
+	if err != nil {
+		return nil, err
+	}
+
+	key, issued, err := newAPIKey()
+	if err != nil {
+		return nil, err
+	}
+	key.AppID = app.ID
+	if err := s.applications.RotateAPIKey(ctx, key, time.Now().Add(overlap)); err != nil {
+		return nil, fmt.Errorf("failed to rotate API key: %w", err)
+	}
+	return issued, nil
+}
+
+// RevokeAPIKey ends an API key of an application immediately.
+func (s *AuthService) RevokeAPIKey(ctx context.Context, caller *models.User, appID, keyID uuid.UUID) error {
+	if _, err := s.adminApplication(ctx, caller, appID); err != nil {
+		return err
+	}
+	if err := s.applications.RevokeAPIKey(ctx, appID, keyID, time.Now()); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrAPIKeyNotFound
+		}
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	return nil
+}
+
+// AuthenticateAPIKey returns the application an API key belongs to. Malformed, unknown,
+// expired and revoked keys, and keys of applications of deleted organizations, are all
+// rejected with ErrInvalidAPIKey.
+func (s *AuthService) AuthenticateAPIKey(ctx context.Context, raw string) (*models.Application, error) {
+	if s.applications == nil {
+		return nil, ErrInvalidAPIKey
+	}
+	prefix, secret, err := apikey.Parse(raw)
+	if err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	key, err := s.applications.GetAPIKeyByPrefix(ctx, prefix)
+	if err != nil || key.Application == nil {
+		return nil, ErrInvalidAPIKey
+	}
+	now := time.Now()
+	if !apikey.Verify(secret, key.SecretHash) || !key.Active(now) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= keyUseInterval {
+		if err := s.applications.TouchAPIKey(ctx, key.ID, now); err != nil {
+			log.Printf("Failed to record use of API key %s: %v", key.Prefix, err)
+		}
+	}
+	return key.Application, nil
+}
+
+// adminApplication loads an application after checking that the caller administers its
+// organization. Applications of other organizations are reported as not found, like those of
+// deleted organizations, which the repository does not return.
+func (s *AuthService) adminApplication(ctx context.Context, caller *models.User, appID uuid.UUID) (*models.Application, error) {
+	if err := applicationAdmin(caller); err != nil {
+		return nil, err
+	}
+
+	app, err := s.applications.GetApplication(ctx, appID)
+	if err != nil || !caller.IsOrgAdmin(app.OrgID) {
+		return nil, ErrApplicationNotFound
+	}
+	return app, nil
+}
+
+// applicationAdmin checks that the caller administers an organization
+func applicationAdmin(caller *models.User) error {
+	if caller == nil {
+		return apperrors.ErrUnauthorized
+	}
+	if caller.OrgID == uuid.Nil || !caller.IsOrgAdmin(caller.OrgID) {
+		return apperrors.ErrForbidden
+	}
+	return nil
+}
+
+func validateApplication(app *models.Application) error {
+	if app.Name == "" {
+		return apperrors.NewAppError("INVALID_APPLICATION", "Application name cannot be empty", http.StatusBadRequest)
+	}
+	if app.OPAEndpoint != PolicyPackage(app.OrgID, app.ID) {
+		return apperrors.NewAppError("INVALID_APPLICATION", fmt.Sprintf("Application policy package must be %s", PolicyPackage(app.OrgID, app.ID)), http.StatusBadRequest)
+	}
+	switch app.Status {
+	case models.ApplicationStatusActive, models.ApplicationStatusDisabled:
+	default:
+		return apperrors.NewAppError("INVALID_APPLICATION", fmt.Sprintf("Unknown application status %q", app.Status), http.StatusBadRequest)
+	}
+	return nil
+}
+
+// PolicyNamespace returns the package the policy packages of an organization's applications are
+// nested in. Organizations share the OPA server's data, so each one may only name its own packages.
+func PolicyNamespace(orgID uuid.UUID) string {
+	return "org_" + strings.ReplaceAll(orgID.String(), "-", "")
+}
+
+// PolicyPackage returns the package of an application's policies, org_<org ID>.app_<app ID>
+// without dashes. Applications share the OPA server's data, and modules of one package are
+// merged, so every application has a package of its own and its policies may not declare another.
+func PolicyPackage(orgID, appID uuid.UUID) string {
+	return PolicyNamespace(orgID) + ".app_" + strings.ReplaceAll(appID.String(), "-", "")
+}
+
+// newAPIKey generates a key, returning the record to store and the key to show once
+func newAPIKey() (*models.APIKey, *IssuedAPIKey, error) {
+	generated, err := apikey.Generate()
+	if err != nil {
+		return nil, nil, err
+	}
+	key := &models.APIKey{Prefix: generated.Prefix, SecretHash: generated.SecretHash}
+	return key, &IssuedAPIKey{Key: key, Secret: generated.Plaintext}, nil
+}
@@ -0,0 +1,377 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	appconfig "shield/cmd/app/config"
+	"shield/modules/authn/internal/auth/policy"
+	"shield/modules/authn/internal/models"
+	"shield/modules/authn/internal/repository"
+	apperrors "shield/modules/common/errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// memoryApplications keeps applications, their API keys, role catalogs, the role names users
+// hold in them and policy versions with their changes. users resolves role holders.
+type memoryApplications struct {
+	repository.ApplicationRepository
+	apps     map[uuid.UUID]*models.Application
+	keys     map[uuid.UUID]*models.APIKey
+	catalog  []models.ApplicationRole
+	roles    map[[2]uuid.UUID][]string
+	users    map[uuid.UUID]*models.User
+	policies []*models.OPAPolicy
+	changes  []models.PolicyChange
+	synced   map[uuid.UUID]models.PolicySyncStatus
+}
+
+func newMemoryApplications() *memoryApplications {
+	return &memoryApplications{
+		apps:  map[uuid.UUID]*models.Application{},
+		keys:  map[uuid.UUID]*models.APIKey{},
+		roles: map[[2]uuid.UUID][]string{},
+	}
+}
+
+func (r *memoryApplications) CreateApplication(_ context.Context, app *models.Application, key *models.APIKey) error {
+	if app.ID == uuid.Nil {
+		app.ID = uuid.New()
+	}
+	r.apps[app.ID] = app
+	key.ID, key.AppID, key.CreatedAt = uuid.New(), app.ID, time.Now()
+	r.keys[key.ID] = key
+	return nil
+}
+
+func (r *memoryApplications) GetApplication(_ context.Context, id uuid.UUID) (*models.Application, error) {
+	if app, ok := r.apps[id]; ok {
+		copied := *app
+		return &copied, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *memoryApplications) ListApplications(_ context.Context, orgID uuid.UUID) ([]models.Application, error) {
+	var apps []models.Application
+	for _, app := range r.apps {
+		if app.OrgID == orgID {
+			apps = append(apps, *app)
+		}
+	}
+	return apps, nil
+}
+
+func (r *memoryApplications) ListAllApplications(_ context.Context) ([]models.Application, error) {
+	var apps []models.Application
+	for _, app := range r.apps {
+		apps = append(apps, *app)
+	}
+	return apps, nil
+}
+
+func (r *memoryApplications) UpdateApplication(_ context.Context, app *models.Application) error {
+	copied := *app
+	r.apps[app.ID] = &copied
+	return nil
+}
+
+func (r *memoryApplications) DeleteApplication(_ context.Context, id uuid.UUID) error {
+	for keyID, key := range r.keys {
+		if key.AppID == id {
+			delete(r.keys, keyID)
+		}
+	}
+	delete(r.apps, id)
+	return nil
+}
+
+func (r *memoryApplications) ListAPIKeys(_ context.Context, appID uuid.UUID) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	for _, key := range r.keys {
+		if key.AppID == appID {
+			keys = append(keys, *key)
+		}
+	}
+	return keys, nil
+}
+
+func (r *memoryApplications) GetAPIKeyByPrefix(_ context.Context, prefix string) (*models.APIKey, error) {
+	for _, key := range r.keys {
+		if key.Prefix == prefix {
+			copied := *key
+			copied.Application = r.apps[key.AppID]
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *memoryApplications) RotateAPIKey(_ context.Context, key *models.APIKey, expiresAt time.Time) error {
+	for _, other := range r.keys {
+		if other.AppID == key.AppID && other.RevokedAt == nil && (other.ExpiresAt == nil || other.ExpiresAt.After(expiresAt)) {
+			other.ExpiresAt = &expiresAt
+		}
+	}
+	key.ID, key.CreatedAt = uuid.New(), time.Now()
+	r.keys[key.ID] = key
+	return nil
+}
+
+func (r *memoryApplications) RevokeAPIKey(_ context.Context, appID, keyID uuid.UUID, at time.Time) error {
+	key, ok := r.keys[keyID]
+	if !ok || key.AppID != appID || key.RevokedAt != nil {
+		return gorm.ErrRecordNotFound
+	}
+	key.RevokedAt = &at
+	return nil
+}
+
+func (r *memoryApplications) TouchAPIKey(_ context.Context, keyID uuid.UUID, at time.Time) error {
+	r.keys[keyID].LastUsedAt = &at
+	return nil
+}
+
+func (r *memoryApplications) GetUserRoleNames(_ context.Context, userID, appID uuid.UUID) ([]string, error) {
+	return r.roles[[2]uuid.UUID{userID, appID}], nil
+}
+
+func TestApplicationLifecycle(t *testing.T) {
+	ctx := context.Background()
+	orgID := uuid.New()
+	admin := &models.User{ID: uuid.New(), OrgID: orgID, UserType: models.UserTypeOrgAdmin}
+	repo := newMemoryApplications()
+	svc := NewAuthService(nil, &appconfig.Config{}, nil, nil, nil, WithApplications(repo))
+
+	app, issued, err := svc.CreateApplication(ctx, admin, CreateApplicationRequest{Name: " Demo "})
+	if err != nil {
+		t.Fatalf("CreateApplication() error = %v", err)
+	}
+	if app.Name != "Demo" || app.OrgID != orgID || app.Status != models.ApplicationStatusActive {
+		t.Errorf("CreateApplication() = %+v, want an active application of the admin's organization", app)
+	}
+	if !strings.HasPrefix(issued.Secret, "shk_"+issued.Key.Prefix+"_") || strings.Contains(issued.Key.SecretHash, issued.Secret) {
+		t.Errorf("issued key %q with hash %q, want a prefixed key stored as a hash", issued.Secret, issued.Key.SecretHash)
+	}
+
+	authenticated, err := svc.AuthenticateAPIKey(ctx, issued.Secret)
+	if err != nil || authenticated.ID != app.ID {
+		t.Fatalf("AuthenticateAPIKey() = %v, %v; want the application", authenticated, err)
+	}
+	if repo.keys[issued.Key.ID].LastUsedAt == nil {
+		t.Error("AuthenticateAPIKey() did not record the key's use")
+	}
+
+	disabled := models.ApplicationStatusDisabled
+	if updated, err := svc.UpdateApplication(ctx, admin, app.ID, UpdateApplicationRequest{Status: &disabled}); err != nil || updated.Status != disabled {
+		t.Errorf("UpdateApplication() = %+v, %v; want disabled", updated, err)
+	}
+	unknown := "archived"
+	if _, err := svc.UpdateApplication(ctx, admin, app.ID, UpdateApplicationRequest{Status: &unknown}); err == nil {
+		t.Error("UpdateApplication() accepted an unknown status")
+	}
+
+	if err := svc.DeleteApplication(ctx, admin, app.ID); err != nil {
+		t.Fatalf("DeleteApplication() error = %v", err)
+	}
+	if _, err := svc.AuthenticateAPIKey(ctx, issued.Secret); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("AuthenticateAPIKey() after delete error = %v, want ErrInvalidAPIKey", err)
+	}
+}
+
+func TestApplicationPolicyPackage(t *testing.T) {
+	ctx := context.Background()
+	admin := &models.User{ID: uuid.New(), OrgID: uuid.New(), UserType: models.UserTypeOrgAdmin}
+	repo := newMemoryApplications()
+	svc := NewAuthService(nil, &appconfig.Config{}, nil, nil, nil, WithApplications(repo))
+
+	first, _, err := svc.CreateApplication(ctx, admin, CreateApplicationRequest{Name: "Demo"})
+	if err != nil {
+		t.Fatalf("CreateApplication() error = %v", err)
+	}
+	second, _, err := svc.CreateApplication(ctx, admin, CreateApplicationRequest{Name: "Demo"})
+	if err != nil {
+		t.Fatalf("CreateApplication() error = %v", err)
+	}
+	if first.OPAEndpoint != PolicyPackage(admin.OrgID, first.ID) || second.OPAEndpoint == first.OPAEndpoint {
+		t.Errorf("CreateApplication() packages = %q, %q; want a package of each application", first.OPAEndpoint, second.OPAEndpoint)
+	}
+	if !strings.HasPrefix(first.OPAEndpoint, PolicyNamespace(admin.OrgID)+".app_") {
+		t.Errorf("CreateApplication() package = %q, want it in %s", first.OPAEndpoint, PolicyNamespace(admin.OrgID))
+	}
+
+	// A package saved by other means is rejected on the next update
+	repo.apps[first.ID].OPAEndpoint = second.OPAEndpoint
+	name := "Renamed"
+	if _, err := svc.UpdateApplication(ctx, admin, first.ID, UpdateApplicationRequest{Name: &name}); err == nil {
+		t.Error("UpdateApplication() accepted the package of another application")
+	}
+}
+
+func TestMigrateApplicationPackages(t *testing.T) {
+	ctx := context.Background()
+	orgID := uuid.New()
+	repo := newMemoryApplications()
+	svc := NewAuthService(nil, &appconfig.Config{}, nil, nil, nil, WithApplications(repo), WithPolicyVersions(policy.NewRegoValidator()))
+
+	legacy := &models.Application{ID: uuid.New(), OrgID: orgID, Name: "Legacy", OPAEndpoint: "demo.authz", Status: models.ApplicationStatusActive}
+	broken := &models.Application{ID: uuid.New(), OrgID: orgID, Name: "Broken", OPAEndpoint: "demo.authz", Status: models.ApplicationStatusActive}
+	orphan := &models.Application{ID: uuid.New(), Name: "Orphan", OPAEndpoint: "demo.authz", Status: models.ApplicationStatusActive}
+	current := &models.Application{ID: uuid.New(), OrgID: orgID, Name: "Current", Status: models.ApplicationStatusActive}
+	current.OPAEndpoint = PolicyPackage(orgID, current.ID)
+	for _, app := range []*models.Application{legacy, broken, orphan, current} {
+		repo.apps[app.ID] = app
+	}
+	repo.policies = []*models.OPAPolicy{
+		{AppID: legacy.ID, Name: "main", Version: 1, Active: true, RegoPolicy: "package demo.authz\n\nimport rego.v1\n\ndefault allow := false\n\nallow if data.demo.authz.admin\n\nadmin if \"admin\" in input.user.roles\n"},
+		{AppID: broken.ID, Name: "main", Version: 1, Active: true, RegoPolicy: "package demo.authz\n\nallow := data.other.allow\n"},
+	}
+
+	if err := svc.MigrateApplicationPackages(ctx); err != nil {
+		t.Fatalf("MigrateApplicationPackages() error = %v", err)
+	}
+
+	pkg := PolicyPackage(orgID, legacy.ID)
+	if got := repo.apps[legacy.ID].OPAEndpoint; got != pkg {
+		t.Errorf("legacy application package = %q, want %q", got, pkg)
+	}
+	active, _ := repo.ActivePolicies(ctx, legacy.ID)
+	if len(active) != 1 || active[0].Version != 2 || active[0].CreatedBy != uuid.Nil ||
+		!strings.HasPrefix(active[0].RegoPolicy, "package "+pkg+"\n") || !strings.Contains(active[0].RegoPolicy, "data."+pkg+".admin") {
+		t.Errorf("legacy application active policies = %+v, want version 2 declaring %s", active, pkg)
+	}
+	if got := repo.apps[broken.ID].OPAEndpoint; got != PolicyPackage(orgID, broken.ID) {
+		t.Errorf("application with a failing policy package = %q, want its own package", got)
+	}
+	if active, _ := repo.ActivePolicies(ctx, broken.ID); len(active) != 1 || active[0].Version != 1 {
+		t.Errorf("failing policy active versions = %+v, want version 1 left active", active)
+	}
+	if got := repo.apps[orphan.ID].Status; got != models.ApplicationStatusDisabled {
+		t.Errorf("application without organization status = %q, want disabled", got)
+	}
+
+	// Migrating again changes nothing
+	versions := len(repo.policies)
+	if err := svc.MigrateApplicationPackages(ctx); err != nil || len(repo.policies) != versions {
+		t.Errorf("MigrateApplicationPackages() again = %v with %d versions, want none added to %d", err, len(repo.policies), versions)
+	}
+}
+
+func TestAPIKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	admin := &models.User{ID: uuid.New(), OrgID: uuid.New(), UserType: models.UserTypeOrgAdmin}
+	repo := newMemoryApplications()
+	svc := NewAuthService(nil, &appconfig.Config{}, nil, nil, nil, WithApplications(repo))
+	app, first, err := svc.CreateApplication(ctx, admin, CreateApplicationRequest{Name: "Demo"})
+	if err != nil {
+		t.Fatalf("CreateApplication() error = %v", err)
+	}
+
+	// Both keys work during the overlap
+	second, err := svc.RotateAPIKey(ctx, admin, app.ID, time.Hour)
+	if err != nil {
+		t.Fatalf("RotateAPIKey() error = %v", err)
+	}
+	for _, key := range []*IssuedAPIKey{first, second} {
+		if _, err := svc.AuthenticateAPIKey(ctx, key.Secret); err != nil {
+			t.Errorf("AuthenticateAPIKey(%s) during overlap error = %v", key.Key.Prefix, err)
+		}
+	}
+	if expires := repo.keys[first.Key.ID].ExpiresAt; expires == nil || time.Until(*expires) > time.Hour {
+		t.Errorf("rotated key expires at %v, want within the hour", expires)
+	}
+
+	// A rotation without overlap ends the previous keys at once
+	third, err := svc.RotateAPIKey(ctx, admin, app.ID, 0)
+	if err != nil {
+		t.Fatalf("RotateAPIKey() error = %v", err)
+	}
+	for _, key := range []*IssuedAPIKey{first, second} {
+		if _, err := svc.AuthenticateAPIKey(ctx, key.Secret); !errors.Is(err, ErrInvalidAPIKey) {
+			t.Errorf("AuthenticateAPIKey(%s) after rotation error = %v, want ErrInvalidAPIKey", key.Key.Prefix, err)
+		}
+	}
+
+	if err := svc.RevokeAPIKey(ctx, admin, app.ID, third.Key.ID); err != nil {
+		t.Fatalf("RevokeAPIKey() error = %v", err)
+	}
+	if _, err := svc.AuthenticateAPIKey(ctx, third.Secret); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("AuthenticateAPIKey() of revoked key error = %v, want ErrInvalidAPIKey", err)
+	}
+	if err := svc.RevokeAPIKey(ctx, admin, app.ID, third.Key.ID); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("RevokeAPIKey() twice error = %v, want ErrAPIKeyNotFound", err)
+	}
+
+	var appErr *apperrors.AppError
+	if _, err := svc.RotateAPIKey(ctx, admin, app.ID, MaxKeyOverlap+time.Hour); !errors.As(err, &appErr) || appErr.Status != http.StatusBadRequest {
+		t.Errorf("RotateAPIKey() with excessive overlap error = %v, want 400", err)
+	}
+}
+
+func TestAuthenticateAPIKeyRejects(t *testing.T) {
+	ctx := context.Background()
+	admin := &models.User{ID: uuid.New(), OrgID: uuid.New(), UserType: models.UserTypeOrgAdmin}
+	repo := newMemoryApplications()
+	svc := NewAuthService(nil, &appconfig.Config{}, nil, nil, nil, WithApplications(repo))
+	_, issued, err := svc.CreateApplication(ctx, admin, CreateApplicationRequest{Name: "Demo"})
+	if err != nil {
+		t.Fatalf("CreateApplication() error = %v", err)
+	}
+
+	for name, raw := range map[string]string{
+		"empty":          "",
+		"malformed":      "not-a-key",
+		"unknown prefix": "shk_000000000000_secret",
+		"wrong secret":   "shk_" + issued.Key.Prefix + "_secret",
+		"bearer token":   "Bearer " + issued.Secret,
+	} {
+		if _, err := svc.AuthenticateAPIKey(ctx, raw); !errors.Is(err, ErrInvalidAPIKey) {
+			t.Errorf("AuthenticateAPIKey(%s) error = %v, want ErrInvalidAPIKey", name, err)
+		}
+	}
+
+	// Keys come without their application once its organization is deleted
+	if _, err := svc.AuthenticateAPIKey(ctx, issued.Secret); err != nil {
+		t.Fatalf("AuthenticateAPIKey() error = %v", err)
+	}
+	delete(repo.apps, issued.Key.AppID)
+	if _, err := svc.AuthenticateAPIKey(ctx, issued.Secret); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("AuthenticateAPIKey() of an application of a deleted organization error = %v, want ErrInvalidAPIKey", err)
+	}
+}
+
+func TestApplicationAccess(t *testing.T) {
+	ctx := context.Background()
+	orgID := uuid.New()
+	admin := &models.User{ID: uuid.New(), OrgID: orgID, UserType: models.UserTypeOrgAdmin}
+	member := &models.User{ID: uuid.New(), OrgID: orgID, UserType: models.UserTypeOrganization}
+	otherAdmin := &models.User{ID: uuid.New(), OrgID: uuid.New(), UserType: models.UserTypeOrgAdmin}
+	repo := newMemoryApplications()
+	svc := NewAuthService(nil, &appconfig.Config{}, nil, nil, nil, WithApplications(repo))
+	app, _, err := svc.CreateApplication(ctx, admin, CreateApplicationRequest{Name: "Demo"})
+	if err != nil {
+		t.Fatalf("CreateApplication() error = %v", err)
+	}
+
+	if _, _, err := svc.CreateApplication(ctx, member, CreateApplicationRequest{Name: "Demo"}); !errors.Is(err, apperrors.ErrForbidden) {
+		t.Errorf("CreateApplication() by member error = %v, want ErrForbidden", err)
+	}
+	if _, err := svc.GetApplication(ctx, member, app.ID); !errors.Is(err, apperrors.ErrForbidden) {
+		t.Errorf("GetApplication() by member error = %v, want ErrForbidden", err)
+	}
+	if _, err := svc.GetApplication(ctx, otherAdmin, app.ID); !errors.Is(err, ErrApplicationNotFound) {
+		t.Errorf("GetApplication() by another organization's admin error = %v, want ErrApplicationNotFound", err)
+	}
+	if _, err := svc.RotateAPIKey(ctx, otherAdmin, app.ID, time.Hour); !errors.Is(err, ErrApplicationNotFound) {
+		t.Errorf("RotateAPIKey() by another organization's admin error = %v, want ErrApplicationNotFound", err)
+	}
+	if apps, err := svc.ListApplications(ctx, otherAdmin); err != nil || len(apps) != 0 {
+		t.Errorf("ListApplications() by another organization's admin = %v, %v; want none", apps, err)
+	}
+}
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"context"
+
+	"shield/modules/authn/internal/auth/token"
+	"shield/modules/authn/internal/models"
+	apperrors "shield/modules/common/errors"
+)
+
+// WithTokenVerifier sets the verifier used to authenticate API requests.
+func WithTokenVerifier(verifier *token.Verifier) Option {
+	return func(s *AuthService) {
+		s.tokenVerifier = verifier
+	}
+}
+
+// AuthenticateToken verifies a bearer token and resolves the Shield user it was issued for.
+// Users are only resolved by subject: an email claim is not proof of owning the account.
+// The token must belong to an active session of the user, found by its origin_jti, so tokens
+// stop working when their session is logged out.
+func (s *AuthService) AuthenticateToken(ctx context.Context, rawToken string) (*models.User, *token.Claims, error) {
+	if s.tokenVerifier == nil {
+		return nil, nil, apperrors.ErrUnauthorized
+	}
+
+	claims, err := s.tokenVerifier.Verify(ctx, rawToken)
+	if err != nil {
+		return nil, nil, apperrors.ErrInvalidToken
+	}
+
+	user, err := s.userRepository.GetUserByCognitoSub(ctx, claims.Subject)
+	if err != nil {
+		return nil, nil, apperrors.ErrInvalidToken
+	}
+
+	sessionData, err := s.sessionManager.ValidateTokenSession(ctx, claims.OriginJTI)
+	if err != nil || sessionData.UserID != user.ID {
+		return nil, nil, apperrors.ErrInvalidToken
+	}
+	return user, claims, nil
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+	"time"
+
+	appconfig "shield/cmd/app/config"
+	"shield/modules/authn/internal/auth/session"
+	"shield/modules/authn/internal/auth/token"
+	"shield/modules/authn/internal/models"
+	apperrors "shield/modules/common/errors"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// tokenSessions keeps sessions by the origin_jti of their provider tokens
+type tokenSessions struct {
+	session.SessionManager
+	sessions map[string]*models.Session
+}
+
+func (m *tokenSessions) ValidateTokenSession(_ context.Context, tokenID string) (*models.Session, error) {
+	if s, ok := m.sessions[tokenID]; ok && s.IsActive {
+		return s, nil
+	}
+	return nil, errors.New("no active session")
+}
+
+func TestAuthenticateTokenResolvesBySubject(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := token.NewVerifier(token.StaticKeys{"key-1": &key.PublicKey}, token.VerifierConfig{
+		Issuer: "https://issuer.example.com", ClientID: "client", AllowedTokenUse: []string{token.UseAccess, token.UseID},
+	})
+	userID, otherID := uuid.New(), uuid.New()
+	users := &federatedUsers{users: map[string]*models.User{
+		"user@example.com": {ID: userID, Email: "user@example.com", CognitoSub: "user-sub"},
+	}}
+	sessions := &tokenSessions{sessions: map[string]*models.Session{
+		"jti-1":     {ID: "session-1", UserID: userID, IsActive: true},
+		"jti-other": {ID: "session-2", UserID: otherID, IsActive: true},
+	}}
+	svc := NewAuthService(nil, &appconfig.Config{}, users, sessions, nil, WithTokenVerifier(verifier))
+
+	issueFor := func(sub, originJTI string) string {
+		t.Helper()
+		now := time.Now()
+		claims := jwt.MapClaims{
+			"iss": "https://issuer.example.com", "sub": sub, "aud": "client", "token_use": token.UseID,
+			"email": "user@example.com", "iat": now.Unix(), "exp": now.Add(time.Hour).Unix(),
+		}
+		if originJTI != "" {
+			claims["origin_jti"] = originJTI
+		}
+		tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		tok.Header["kid"] = "key-1"
+		raw, err := tok.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return raw
+	}
+	issue := func(sub string) string { return issueFor(sub, "jti-1") }
+
+	user, _, err := svc.AuthenticateToken(context.Background(), issue("user-sub"))
+	if err != nil || user.Email != "user@example.com" {
+		t.Fatalf("AuthenticateToken(known sub) = %v, %v", user, err)
+	}
+	// Another account claiming the same email must not be resolved to the user
+	if _, _, err := svc.AuthenticateToken(context.Background(), issue("other-sub")); !errors.Is(err, apperrors.ErrInvalidToken) {
+		t.Errorf("AuthenticateToken(unknown sub, matching email) error = %v, want INVALID_TOKEN", err)
+	}
+
+	// Tokens need an active session of the user
+	for name, originJTI := range map[string]string{"no origin_jti": "", "unknown session": "jti-2", "another user's session": "jti-other"} {
+		if _, _, err := svc.AuthenticateToken(context.Background(), issueFor("user-sub", originJTI)); !errors.Is(err, apperrors.ErrInvalidToken) {
+			t.Errorf("AuthenticateToken(%s) error = %v, want INVALID_TOKEN", name, err)
+		}
+	}
+	sessions.sessions["jti-1"].IsActive = false
+	if _, _, err := svc.AuthenticateToken(context.Background(), issue("user-sub")); !errors.Is(err, apperrors.ErrInvalidToken) {
+		t.Errorf("AuthenticateToken() after logout error = %v, want INVALID_TOKEN", err)
+	}
+}
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"shield/modules/authn/internal/auth/policy"
+	"shield/modules/authn/internal/models"
+	apperrors "shield/modules/common/errors"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrAuthzDisabled       = apperrors.NewAppError("AUTHZ_DISABLED", "Policy decisions are not enabled", http.StatusServiceUnavailable)
+	ErrApplicationNotFound = apperrors.NewAppError("APPLICATION_NOT_FOUND", "Application not found", http.StatusNotFound)
+	ErrPolicyUnavailable   = apperrors.NewAppError("POLICY_UNAVAILABLE", "Policy engine is unavailable", http.StatusBadGateway)
+)
+
+// WithPolicyDecisions enables authorization decisions, whose application policies are evaluated
+// by evaluator. Decisions also require WithApplications.
+func WithPolicyDecisions(evaluator policy.Evaluator) Option {
+	return func(s *AuthService) {
+		s.policyEvaluator = evaluator
+	}
+}
+
+// DecideRequest asks whether a user may perform an action on a resource of an application
+type DecideRequest struct {
+	UserID        uuid.UUID // Subject of the decision; the caller when nil
+	ApplicationID uuid.UUID
+	Resource      string
+	Action        string
+	Context       map[string]interface{} // Additional policy input, passed through as input.context
+}
+
+// Decide evaluates the application's policy for the request. Callers may ask about themselves;
+// org admins may also ask about the members of their organization. Only applications of the
+// subject's organization can be asked about. A denied decision is not an error; errors mean no
+// decision could be made and the request must be treated as denied.
+func (s *AuthService) Decide(ctx context.Context, caller *models.User, req DecideRequest) (*policy.Decision, error) {
+	if s.policyEvaluator == nil || s.applications == nil {
+		return nil, ErrAuthzDisabled
+	}
+	if caller == nil {
+		return nil, apperrors.ErrUnauthorized
+	}
+
+	subject := caller
+	if req.UserID != uuid.Nil && req.UserID != caller.ID {
+		user, err := s.userRepository.GetUserByID(ctx, req.UserID)
+		if err != nil || !caller.IsOrgAdmin(user.OrgID) {
+			// Users outside the caller's organization are indistinguishable from missing ones
+			return nil, apperrors.ErrForbidden
+		}
+		subject = user
+	}
+
+	// Applications of other organizations are indistinguishable from missing ones
+	app, err := s.applications.GetApplication(ctx, req.ApplicationID)
+	if err != nil || app.OrgID == uuid.Nil || app.OrgID != subject.OrgID {
+		return nil, ErrApplicationNotFound
+	}
+	return s.decide(ctx, subject, app, req)
+}
+
+// DecideForApplication evaluates the policy of the calling application, authenticated by its
+// API key, for one of its users. req.ApplicationID must be empty or name the calling application.
+func (s *AuthService) DecideForApplication(ctx context.Context, app *models.Application, req DecideRequest) (*policy.Decision, error) {
+	if s.policyEvaluator == nil || s.applications == nil {
+		return nil, ErrAuthzDisabled
+	}
+	if app == nil {
+		return nil, ErrInvalidAPIKey
+	}
+	if req.ApplicationID != uuid.Nil && req.ApplicationID != app.ID {
+		return nil, apperrors.ErrForbidden
+	}
+	if req.UserID == uuid.Nil {
+		return nil, apperrors.NewAppError("INVALID_REQUEST", "Decisions of applications require a user ID", http.StatusBadRequest)
+	}
+
+	// Users of other organizations are indistinguishable from missing ones
+	subject, err := s.userRepository.GetUserByID(ctx, req.UserID)
+	if err != nil || subject.OrgID != app.OrgID {
+		return nil, apperrors.ErrUserNotFound
+	}
+	return s.decide(ctx, subject, app, req)
+}
+
+// decide evaluates the application's policy with the roles the subject holds in it
+func (s *AuthService) decide(ctx context.Context, subject *models.User, app *models.Application, req DecideRequest) (*policy.Decision, error) {
+	if app.Status != models.ApplicationStatusActive {
+		return &policy.Decision{Reasons: []string{"application is not active"}}, nil
+	}
+
+	roles, err := s.applications.GetUserRoleNames(ctx, subject.ID, app.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load application roles: %w", err)
+	}
+	if roles == nil {
+		roles = []string{}
+	}
+
+	decision, err := s.policyEvaluator.Evaluate(ctx, policy.Query{
+		Path:  app.OPAEndpoint,
+		Input: policyInput(subject, app, roles, req),
+	})
+	if errors.Is(err, policy.ErrUndefined) {
+		return &policy.Decision{Reasons: []string{"application has no policy"}}, nil
+	}
+	if err != nil {
+		log.Printf("Policy evaluation for application %s failed: %v", app.ID, err)
+		return nil, ErrPolicyUnavailable
+	}
+
+	if !decision.Allow && len(decision.Reasons) == 0 {
+		if len(roles) == 0 {
+			decision.Reasons = []string{"user has no roles in the application"}
+		} else {
+			decision.Reasons = []string{"denied by application policy"}
+		}
+	}
+	return decision, nil
+}
+
+// policyInput builds the input document of a decision, in the shape of policies/demo_policy.rego
+func policyInput(user *models.User, app *models.Application, roles []string, req DecideRequest) policy.Input {
+	input := policy.Input{
+		User: policy.User{
+			ID:       user.ID.String(),
+			Email:    user.Email,
+			UserType: string(user.UserType),
+			Roles:    roles,
+		},
+		Application: policy.Application{
+			ID:   app.ID.String(),
+			Name: app.Name,
+		},
+		Resource: req.Resource,
+		Action:   req.Action,
+		Context:  req.Context,
+	}
+	if user.OrgID != uuid.Nil {
+		input.User.OrgID = user.OrgID.String()
+	}
+	return input
+}
@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	appconfig "shield/cmd/app/config"
+	"shield/modules/authn/internal/auth/policy"
+	"shield/modules/authn/internal/models"
+	"shield/modules/authn/internal/repository"
+	apperrors "shield/modules/common/errors"
+
+	"github.com/google/uuid"
+)
+
+// usersByID looks users up in a map
+type usersByID struct {
+	repository.UserRepository
+	users map[uuid.UUID]*models.User
+}
+
+func (r *usersByID) GetUserByID(_ context.Context, id uuid.UUID) (*models.User, error) {
+	if user, ok := r.users[id]; ok {
+		return user, nil
+	}
+	return nil, errors.New("record not found")
+}
+
+// recordingEvaluator returns a fixed decision and records the queries it evaluates
+type recordingEvaluator struct {
+	decision *policy.Decision
+	err      error
+	queries  []policy.Query
+}
+
+func (e *recordingEvaluator) Evaluate(_ context.Context, query policy.Query) (*policy.Decision, error) {
+	e.queries = append(e.queries, query)
+	if e.err != nil {
+		return nil, e.err
+	}
+	copied := *e.decision
+	return &copied, nil
+}
+
+func TestDecide(t *testing.T) {
+	ctx := context.Background()
+	orgID := uuid.New()
+	member := &models.User{ID: uuid.New(), Email: "member@acme.com", OrgID: orgID, UserType: models.UserTypeOrganization}
+	admin := &models.User{ID: uuid.New(), Email: "admin@acme.com", OrgID: orgID, UserType: models.UserTypeOrgAdmin}
+	outsider := &models.User{ID: uuid.New(), Email: "user@example.com", OrgID: uuid.New(), UserType: models.UserTypeIndividual}
+	app := &models.Application{ID: uuid.New(), OrgID: orgID, Name: "Demo", OPAEndpoint: "demo.authz", Status: models.ApplicationStatusActive}
+	disabled := &models.Application{ID: uuid.New(), OrgID: orgID, Name: "Legacy", OPAEndpoint: "legacy.authz", Status: models.ApplicationStatusDisabled}
+
+	newService := func(evaluator *recordingEvaluator) *AuthService {
+		users := &usersByID{users: map[uuid.UUID]*models.User{member.ID: member, admin.ID: admin, outsider.ID: outsider}}
+		apps := &memoryApplications{
+			apps:  map[uuid.UUID]*models.Application{app.ID: app, disabled.ID: disabled},
+			roles: map[[2]uuid.UUID][]string{{member.ID, app.ID}: {"editor", "viewer"}},
+		}
+		return NewAuthService(nil, &appconfig.Config{}, users, nil, nil, WithApplications(apps), WithPolicyDecisions(evaluator))
+	}
+
+	t.Run("input carries the user's application roles", func(t *testing.T) {
+		evaluator := &recordingEvaluator{decision: &policy.Decision{Allow: true}}
+		req := DecideRequest{ApplicationID: app.ID, Resource: "/api/data", Action: "write", Context: map[string]interface{}{"ip": "10.0.0.1"}}
+		decision, err := newService(evaluator).Decide(ctx, member, req)
+		if err != nil || !decision.Allow {
+			t.Fatalf("Decide() = %+v, %v; want allowed", decision, err)
+		}
+		want := policy.Query{Path: "demo.authz", Input: policy.Input{
+			User:        policy.User{ID: member.ID.String(), Email: member.Email, OrgID: orgID.String(), UserType: "organization", Roles: []string{"editor", "viewer"}},
+			Application: policy.Application{ID: app.ID.String(), Name: "Demo"},
+			Resource:    "/api/data",
+			Action:      "write",
+			Context:     map[string]interface{}{"ip": "10.0.0.1"},
+		}}
+		if len(evaluator.queries) != 1 || !reflect.DeepEqual(evaluator.queries[0], want) {
+			t.Errorf("evaluated %+v, want %+v", evaluator.queries, want)
+		}
+	})
+
+	tests := []struct {
+		name        string
+		caller      *models.User
+		req         DecideRequest
+		evaluator   *recordingEvaluator
+		wantErr     error
+		wantAllow   bool
+		wantReasons []string
+	}{
+		{
+			name:        "denial without reasons explains missing roles",
+			caller:      admin,
+			req:         DecideRequest{ApplicationID: app.ID, Resource: "/api/data", Action: "read"},
+			evaluator:   &recordingEvaluator{decision: &policy.Decision{}},
+			wantReasons: []string{"user has no roles in the application"},
+		},
+		{
+			name:        "policy reasons are kept",
+			caller:      member,
+			req:         DecideRequest{ApplicationID: app.ID, Resource: "/api/users", Action: "delete"},
+			evaluator:   &recordingEvaluator{decision: &policy.Decision{Reasons: []string{"admin role required"}}},
+			wantReasons: []string{"admin role required"},
+		},
+		{
+			name:      "org admin asks about a member",
+			caller:    admin,
+			req:       DecideRequest{UserID: member.ID, ApplicationID: app.ID, Resource: "/api/data", Action: "read"},
+			evaluator: &recordingEvaluator{decision: &policy.Decision{Allow: true}},
+			wantAllow: true,
+		},
+		{
+			name:      "member asks about another user",
+			caller:    member,
+			req:       DecideRequest{UserID: admin.ID, ApplicationID: app.ID},
+			evaluator: &recordingEvaluator{decision: &policy.Decision{Allow: true}},
+			wantErr:   apperrors.ErrForbidden,
+		},
+		{
+			name:      "org admin asks about an outsider",
+			caller:    admin,
+			req:       DecideRequest{UserID: outsider.ID, ApplicationID: app.ID},
+			evaluator: &recordingEvaluator{decision: &policy.Decision{Allow: true}},
+			wantErr:   apperrors.ErrForbidden,
+		},
+		{
+			name:      "application of another organization",
+			caller:    outsider,
+			req:       DecideRequest{ApplicationID: app.ID, Resource: "/api/data", Action: "read"},
+			evaluator: &recordingEvaluator{decision: &policy.Decision{Allow: true}},
+			wantErr:   ErrApplicationNotFound,
+		},
+		{
+			name:      "unknown application",
+			caller:    member,
+			req:       DecideRequest{ApplicationID: uuid.New()},
+			evaluator: &recordingEvaluator{decision: &policy.Decision{Allow: true}},
+			wantErr:   ErrApplicationNotFound,
+		},
+		{
+			name:        "disabled application",
+			caller:      member,
+			req:         DecideRequest{ApplicationID: disabled.ID, Resource: "/api/data", Action: "read"},
+			evaluator:   &recordingEvaluator{decision: &policy.Decision{Allow: true}},
+			wantReasons: []string{"application is not active"},
+		},
+		{
+			name:        "undefined policy",
+			caller:      member,
+			req:         DecideRequest{ApplicationID: app.ID, Resource: "/api/data", Action: "read"},
+			evaluator:   &recordingEvaluator{err: fmt.Errorf("%w: demo.authz", policy.ErrUndefined)},
+			wantReasons: []string{"application has no policy"},
+		},
+		{
+			name:      "policy engine down",
+			caller:    member,
+			req:       DecideRequest{ApplicationID: app.ID, Resource: "/api/data", Action: "read"},
+			evaluator: &recordingEvaluator{err: fmt.Errorf("%w: connection refused", policy.ErrUnavailable)},
+			wantErr:   ErrPolicyUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := newService(tt.evaluator).Decide(ctx, tt.caller, tt.req)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Decide() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decide() error = %v", err)
+			}
+			if decision.Allow != tt.wantAllow || !reflect.DeepEqual(decision.Reasons, tt.wantReasons) {
+				t.Errorf("Decide() = %+v, want allow %v with reasons %v", decision, tt.wantAllow, tt.wantReasons)
+			}
+		})
+	}
+
+	t.Run("applications ask about any user", func(t *testing.T) {
+		evaluator := &recordingEvaluator{decision: &policy.Decision{Allow: true}}
+		svc := newService(evaluator)
+		if decision, err := svc.DecideForApplication(ctx, app, DecideRequest{UserID: member.ID, Resource: "/api/data", Action: "read"}); err != nil || !decision.Allow {
+			t.Fatalf("DecideForApplication() = %+v, %v; want allowed", decision, err)
+		}
+		if roles := evaluator.queries[0].Input.User.Roles; len(roles) != 2 {
+			t.Errorf("DecideForApplication() evaluated roles %v, want the member's roles", roles)
+		}
+		if _, err := svc.DecideForApplication(ctx, app, DecideRequest{UserID: member.ID, ApplicationID: disabled.ID}); !errors.Is(err, apperrors.ErrForbidden) {
+			t.Errorf("DecideForApplication() for another application error = %v, want ErrForbidden", err)
+		}
+		if _, err := svc.DecideForApplication(ctx, app, DecideRequest{UserID: uuid.New()}); !errors.Is(err, apperrors.ErrUserNotFound) {
+			t.Errorf("DecideForApplication() for unknown user error = %v, want ErrUserNotFound", err)
+		}
+		if _, err := svc.DecideForApplication(ctx, app, DecideRequest{UserID: outsider.ID}); !errors.Is(err, apperrors.ErrUserNotFound) {
+			t.Errorf("DecideForApplication() for a user of another organization error = %v, want ErrUserNotFound", err)
+		}
+		if _, err := svc.DecideForApplication(ctx, app, DecideRequest{}); err == nil {
+			t.Error("DecideForApplication() without a user succeeded")
+		}
+	})
+
+	t.Run("disabled without an evaluator", func(t *testing.T) {
+		svc := NewAuthService(nil, &appconfig.Config{}, nil, nil, nil)
+		if _, err := svc.Decide(ctx, member, DecideRequest{ApplicationID: app.ID}); !errors.Is(err, ErrAuthzDisabled) {
+			t.Errorf("Decide() error = %v, want ErrAuthzDisabled", err)
+		}
+	})
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	authprovider "shield/modules/authn/internal/auth/provider"
+	apperrors "shield/modules/common/errors"
+	"shield/modules/common/ratelimit"
+)
+
+// WithConfirmationCooldown limits how often a signup confirmation code can be sent to one email.
+// The limiter should allow a single attempt per cooldown window.
+func WithConfirmationCooldown(limiter ratelimit.Limiter, cooldown time.Duration) Option {
+	return func(s *AuthService) {
+		s.resendLimit = limiter
+		s.resendCooldown = cooldown
+	}
+}
+
+// ResendConfirmationResponse tells when another confirmation code can be requested.
+// It is the same whether or not the account exists.
+type ResendConfirmationResponse struct {
+	ResendAvailableAt time.Time // Earliest time another code can be requested
+}
+
+// ResendConfirmationCode sends a new signup confirmation code to an unconfirmed user.
+// Requests within the cooldown are rejected with a RetryAfterError. Unknown emails get
+// the same response as existing accounts, like ForgotPassword.
+func (s *AuthService) ResendConfirmationCode(ctx context.Context, email string) (*ResendConfirmationResponse, error) {
+	if s.resendLimit != nil {
+		allowed, retryAfter, err := s.resendLimit.Allow(ctx, resendKey(email))
+		if err != nil {
+			log.Printf("Confirmation resend cooldown check failed: %v", err)
+		} else if !allowed {
+			return nil, &apperrors.RetryAfterError{AppError: apperrors.ErrRateLimitExceeded, RetryAfter: retryAfter}
+		}
+	}
+
+	_, err := s.provider.ResendConfirmationCode(ctx, authprovider.ResendConfirmationCodeRequestData{Username: email})
+	if err != nil && !errors.Is(err, authprovider.ErrUserNotFound) {
+		return nil, providerError(fmt.Errorf("provider ResendConfirmationCode failed: %w", err))
+	}
+
+	return &ResendConfirmationResponse{ResendAvailableAt: time.Now().Add(s.resendCooldown)}, nil
+}
+
+// startResendCooldown counts the code sent at signup against the resend cooldown and
+// returns when the next code may be requested.
+func (s *AuthService) startResendCooldown(ctx context.Context, email string) time.Time {
+	if s.resendLimit == nil {
+		return time.Time{}
+	}
+	if _, _, err := s.resendLimit.Allow(ctx, resendKey(email)); err != nil {
+		log.Printf("Confirmation resend cooldown could not be started: %v", err)
+	}
+	return time.Now().Add(s.resendCooldown)
+}
+
+func resendKey(email string) string {
+	return "resend:" + strings.ToLower(email)
+}
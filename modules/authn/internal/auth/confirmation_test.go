@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	appconfig "shield/cmd/app/config"
+	authprovider "shield/modules/authn/internal/auth/provider"
+	apperrors "shield/modules/common/errors"
+	"shield/modules/common/ratelimit"
+)
+
+// confirmationProvider stubs the signup confirmation operations of the auth provider
+type confirmationProvider struct {
+	authprovider.AuthProvider
+	confirmErr error
+	resendErr  error
+	resent     int
+}
+
+func (p *confirmationProvider) SignUp(context.Context, authprovider.SignUpRequestData) (*authprovider.SignUpOutputData, error) {
+	return &authprovider.SignUpOutputData{UserSub: "sub-1"}, nil
+}
+
+func (p *confirmationProvider) ConfirmSignUp(context.Context, authprovider.ConfirmSignUpRequestData) (*authprovider.ConfirmSignUpOutputData, error) {
+	return nil, p.confirmErr
+}
+
+func (p *confirmationProvider) ResendConfirmationCode(context.Context, authprovider.ResendConfirmationCodeRequestData) (*authprovider.ResendConfirmationCodeOutputData, error) {
+	if p.resendErr != nil {
+		return nil, p.resendErr
+	}
+	p.resent++
+	return &authprovider.ResendConfirmationCodeOutputData{
+		CodeDeliveryDetails: &authprovider.CodeDeliveryDetailsData{DeliveryMedium: "EMAIL", Destination: "u***@example.com"},
+	}, nil
+}
+
+func newConfirmationTestService(provider *confirmationProvider, opts ...Option) *AuthService {
+	return NewAuthService(provider, &appconfig.Config{}, &userByEmail{}, nil, nil, opts...)
+}
+
+func TestConfirmUserSignupErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		confirmErr error
+		want       *apperrors.AppError
+	}{
+		{"wrong code", authprovider.ErrCodeMismatch, apperrors.ErrCodeMismatch},
+		{"expired code", authprovider.ErrCodeExpired, apperrors.ErrCodeExpired},
+		{"too many attempts", authprovider.ErrLimitExceeded, apperrors.ErrAttemptLimitExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newConfirmationTestService(&confirmationProvider{confirmErr: fmt.Errorf("%w: cognito", tt.confirmErr)})
+
+			_, err := svc.ConfirmUserSignup(context.Background(), ConfirmSignupRequest{Email: "user@example.com", VerificationCode: "123456"})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("ConfirmUserSignup() error = %v, want %s", err, tt.want.Code)
+			}
+		})
+	}
+}
+
+func TestResendConfirmationCode(t *testing.T) {
+	ctx := context.Background()
+	provider := &confirmationProvider{}
+	cooldown := ratelimit.NewMemoryLimiter(ratelimit.Rule{Limit: 1, Window: time.Minute})
+	svc := newConfirmationTestService(provider, WithConfirmationCooldown(cooldown, time.Minute))
+
+	signup, err := svc.SignupUser(ctx, SignupUserRequest{Email: "user@example.com", Password: "password"})
+	if err != nil {
+		t.Fatalf("SignupUser() error = %v", err)
+	}
+	if wait := time.Until(signup.ResendAvailableAt); wait <= 0 || wait > time.Minute {
+		t.Errorf("SignupUser() ResendAvailableAt in %v, want within the 1m cooldown", wait)
+	}
+
+	// The code sent at signup starts the cooldown
+	_, err = svc.ResendConfirmationCode(ctx, "User@example.com")
+	var retry *apperrors.RetryAfterError
+	if !errors.As(err, &retry) || !errors.Is(err, apperrors.ErrRateLimitExceeded) {
+		t.Fatalf("ResendConfirmationCode() during cooldown error = %v, want RetryAfterError", err)
+	}
+	if retry.RetryAfter <= 0 || retry.RetryAfter > time.Minute {
+		t.Errorf("RetryAfter = %v, want within the 1m cooldown", retry.RetryAfter)
+	}
+	if provider.resent != 0 {
+		t.Errorf("provider sent %d codes during cooldown, want 0", provider.resent)
+	}
+
+	resp, err := svc.ResendConfirmationCode(ctx, "other@example.com")
+	if err != nil {
+		t.Fatalf("ResendConfirmationCode() error = %v", err)
+	}
+	if provider.resent != 1 {
+		t.Errorf("provider sent %d codes, want 1", provider.resent)
+	}
+	if wait := time.Until(resp.ResendAvailableAt); wait <= 0 || wait > time.Minute {
+		t.Errorf("ResendAvailableAt in %v, want within the 1m cooldown", wait)
+	}
+
+	// Unknown emails are not revealed
+	unknown := newConfirmationTestService(&confirmationProvider{resendErr: fmt.Errorf("%w: cognito", authprovider.ErrUserNotFound)})
+	if resp, err := unknown.ResendConfirmationCode(ctx, "nobody@example.com"); err != nil || resp.ResendAvailableAt.IsZero() {
+		t.Errorf("ResendConfirmationCode(unknown user) = %+v, %v; want the same success response", resp, err)
+	}
+
+	limited := newConfirmationTestService(&confirmationProvider{resendErr: fmt.Errorf("%w: cognito", authprovider.ErrLimitExceeded)})
+	if _, err := limited.ResendConfirmationCode(ctx, "user@example.com"); !errors.Is(err, apperrors.ErrAttemptLimitExceeded) {
+		t.Errorf("ResendConfirmationCode() error = %v, want ATTEMPT_LIMIT_EXCEEDED", err)
+	}
+}
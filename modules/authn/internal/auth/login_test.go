@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	appconfig "shield/cmd/app/config"
+	authprovider "shield/modules/authn/internal/auth/provider"
+	"shield/modules/authn/internal/auth/session"
+	"shield/modules/authn/internal/models"
+	"shield/modules/authn/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// challengeProvider answers every login with a challenge and completes it on the expected code
+type challengeProvider struct {
+	authprovider.AuthProvider
+	challenge string
+	answers   []authprovider.RespondToAuthChallengeRequestData
+}
+
+func (p *challengeProvider) Authenticate(context.Context, authprovider.AuthenticateRequestData) (*authprovider.AuthenticateOutputData, error) {
+	return &authprovider.AuthenticateOutputData{
+		ChallengeName:       p.challenge,
+		Session:             "provider-session",
+		ChallengeParameters: map[string]string{"USER_ID_FOR_SRP": "user-1"},
+	}, nil
+}
+
+func (p *challengeProvider) RespondToAuthChallenge(_ context.Context, req authprovider.RespondToAuthChallengeRequestData) (*authprovider.AuthenticateOutputData, error) {
+	p.answers = append(p.answers, req)
+	if req.Session != "provider-session" || req.Responses["SOFTWARE_TOKEN_MFA_CODE"] != "123456" {
+		return nil, authprovider.ErrCodeMismatch
+	}
+	return &authprovider.AuthenticateOutputData{AccessToken: "access", RefreshToken: "refresh", ExpiresIn: 3600, UserSub: "sub-1"}, nil
+}
+
+// usersBySub resolves a single known user by provider subject and records updates
+type usersBySub struct {
+	repository.UserRepository
+	user    *models.User
+	updated int
+}
+
+func (r *usersBySub) GetUserByCognitoSub(_ context.Context, sub string) (*models.User, error) {
+	if r.user.CognitoSub != sub {
+		return nil, errors.New("user not found")
+	}
+	return r.user, nil
+}
+
+func (r *usersBySub) UpdateUser(context.Context, *models.User) error {
+	r.updated++
+	return nil
+}
+
+// createdSessions issues a session per call
+type createdSessions struct {
+	session.SessionManager
+	users []uuid.UUID
+}
+
+func (m *createdSessions) CreateSession(_ context.Context, userID uuid.UUID, _ session.ClientInfo, _ session.ProviderTokens) (*models.Session, error) {
+	m.users = append(m.users, userID)
+	return &models.Session{ID: "session-1", UserID: userID, RefreshToken: "shield-refresh"}, nil
+}
+
+func TestLoginChallengeRoundTrip(t *testing.T) {
+	tests := []struct {
+		name        string
+		challenge   string
+		wantUpdates int
+	}{
+		{"software token", "SOFTWARE_TOKEN_MFA", 0},
+		{"setup records TOTP", "MFA_SETUP", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			user := &models.User{ID: uuid.New(), Email: "user@example.com", CognitoSub: "sub-1"}
+			provider := &challengeProvider{challenge: tt.challenge}
+			users := &usersBySub{user: user}
+			sessions := &createdSessions{}
+			svc := NewAuthService(provider, &appconfig.Config{}, users, sessions, nil)
+
+			resp, err := svc.Login(ctx, LoginRequest{Email: user.Email, Password: "password"}, session.ClientInfo{})
+			if err != nil {
+				t.Fatalf("Login() error = %v", err)
+			}
+			if !resp.ChallengePending() || resp.Challenge.Name != tt.challenge || resp.Challenge.Session != "provider-session" {
+				t.Fatalf("Login() challenge = %+v, want %s with the provider session", resp.Challenge, tt.challenge)
+			}
+			if resp.Challenge.Parameters["USER_ID_FOR_SRP"] != "user-1" || len(sessions.users) != 0 {
+				t.Fatalf("Login() parameters = %v, sessions = %d; want provider parameters and no session", resp.Challenge.Parameters, len(sessions.users))
+			}
+
+			if _, err := svc.RespondToLoginChallenge(ctx, LoginChallengeRequest{
+				Email: user.Email, ChallengeName: tt.challenge, Session: resp.Challenge.Session,
+				Responses: map[string]string{"SOFTWARE_TOKEN_MFA_CODE": "000000"},
+			}, session.ClientInfo{}); !errors.Is(err, authprovider.ErrCodeMismatch) {
+				t.Fatalf("RespondToLoginChallenge(wrong code) error = %v, want code mismatch", err)
+			}
+
+			done, err := svc.RespondToLoginChallenge(ctx, LoginChallengeRequest{
+				Email: user.Email, ChallengeName: tt.challenge, Session: resp.Challenge.Session,
+				Responses: map[string]string{"SOFTWARE_TOKEN_MFA_CODE": "123456"},
+			}, session.ClientInfo{})
+			if err != nil {
+				t.Fatalf("RespondToLoginChallenge() error = %v", err)
+			}
+			if done.ChallengePending() || done.AccessToken != "access" || done.RefreshToken != "shield-refresh" || done.UserID != user.ID.String() {
+				t.Errorf("RespondToLoginChallenge() = %+v, want a completed login for %s", done, user.ID)
+			}
+			if last := provider.answers[len(provider.answers)-1]; last.Username != user.Email || last.ChallengeName != tt.challenge {
+				t.Errorf("provider challenge answer = %+v, want username %s and challenge %s", last, user.Email, tt.challenge)
+			}
+			if len(sessions.users) != 1 || sessions.users[0] != user.ID {
+				t.Errorf("sessions created for %v, want [%s]", sessions.users, user.ID)
+			}
+			if users.updated != tt.wantUpdates || user.HasMFAMethod(models.MFAMethodTOTP) != (tt.wantUpdates > 0) {
+				t.Errorf("user updates = %d, TOTP enrolled = %v; want %d updates", users.updated, user.HasMFAMethod(models.MFAMethodTOTP), tt.wantUpdates)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	authprovider "shield/modules/authn/internal/auth/provider"
+	"shield/modules/authn/internal/auth/session"
+	"shield/modules/authn/internal/auth/token"
+	"shield/modules/authn/internal/models"
+	"shield/modules/common/crypto"
+	apperrors "shield/modules/common/errors"
+)
+
+// WithTokenSealer enables storing the provider refresh token with the session, so that
+// logout can revoke it at the provider.
+func WithTokenSealer(sealer *crypto.Sealer) Option {
+	return func(s *AuthService) {
+		s.tokenSealer = sealer
+	}
+}
+
+// LogoutRequest identifies the session to end. When SessionID is empty, the session is
+// found through the origin_jti of the caller's access token.
+type LogoutRequest struct {
+	SessionID      string
+	TokenOriginJTI string
+}
+
+// providerTokens links a new session to the provider tokens of authResult.
+func (s *AuthService) providerTokens(authResult *authprovider.AuthenticateOutputData) (session.ProviderTokens, error) {
+	tokens := session.ProviderTokens{Username: authResult.Username}
+	if claims, err := token.UnverifiedClaims(authResult.AccessToken); err == nil {
+		tokens.TokenID = claims.OriginJTI
+		if tokens.Username == "" {
+			// Logins completed outside the provider API (SSO, local MFA) only have the tokens
+			tokens.Username = claims.Username
+		}
+	}
+
+	if s.tokenSealer != nil && authResult.RefreshToken != "" {
+		sealed, err := s.tokenSealer.Seal([]byte(authResult.RefreshToken))
+		if err != nil {
+			return tokens, fmt.Errorf("failed to encrypt provider refresh token: %w", err)
+		}
+		tokens.RefreshToken = sealed
+	}
+	return tokens, nil
+}
+
+// Logout invalidates one of the caller's sessions and revokes its provider refresh token.
+func (s *AuthService) Logout(ctx context.Context, caller *models.User, req LogoutRequest) (*models.Session, error) {
+	sessionData, err := s.logoutSession(ctx, caller, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Invalidate session
+	if err := s.sessionManager.InvalidateSession(ctx, sessionData.ID); err != nil {
+		return nil, fmt.Errorf("failed to invalidate session: %w", err)
+	}
+
+	s.revokeProviderToken(ctx, sessionData)
+	return sessionData, nil
+}
+
+// LogoutEverywhere invalidates all of the caller's sessions and signs the user out of the
+// provider, revoking every refresh token issued to them. It returns the number of sessions ended.
+func (s *AuthService) LogoutEverywhere(ctx context.Context, caller *models.User) (int, error) {
+	sessions, err := s.sessionManager.InvalidateUserSessions(ctx, caller.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	if caller.CognitoSub != "" {
+		if err := s.provider.GlobalSignOut(ctx, caller.CognitoSub); err != nil {
+			// The Shield sessions are gone; fall back to revoking the tokens we know of
+			log.Printf("Global sign-out failed for user %s: %v", caller.ID, err)
+			for _, sessionData := range sessions {
+				s.revokeProviderToken(ctx, sessionData)
+			}
+		}
+	}
+	return len(sessions), nil
+}
+
+// logoutSession resolves the session to end and checks that it belongs to the caller.
+func (s *AuthService) logoutSession(ctx context.Context, caller *models.User, req LogoutRequest) (*models.Session, error) {
+	if req.SessionID == "" {
+		if req.TokenOriginJTI == "" {
+			return nil, apperrors.ErrSessionNotFound
+		}
+		sessions, err := s.sessionManager.GetUserSessions(ctx, caller.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, sessionData := range sessions {
+			if sessionData.ProviderTokenID == req.TokenOriginJTI {
+				return sessionData, nil
+			}
+		}
+		return nil, apperrors.ErrSessionNotFound
+	}
+
+	sessionData, err := s.sessionManager.GetSession(ctx, req.SessionID)
+	if err != nil {
+		return nil, apperrors.ErrSessionNotFound
+	}
+	if sessionData.UserID != caller.ID {
+		return nil, apperrors.ErrForbidden
+	}
+	return sessionData, nil
+}
+
+// revokeProviderToken revokes the session's provider refresh token. Failures are logged
+// rather than returned, as the Shield session has already been invalidated.
+func (s *AuthService) revokeProviderToken(ctx context.Context, sessionData *models.Session) {
+	if s.tokenSealer == nil || sessionData.ProviderRefreshToken == "" {
+		return
+	}
+
+	refreshToken, err := s.tokenSealer.Open(sessionData.ProviderRefreshToken)
+	if err != nil {
+		log.Printf("Failed to decrypt provider refresh token of session %s: %v", sessionData.ID, err)
+		return
+	}
+	if err := s.provider.RevokeToken(ctx, string(refreshToken)); err != nil {
+		log.Printf("Failed to revoke provider refresh token of session %s: %v", sessionData.ID, err)
+	}
+}
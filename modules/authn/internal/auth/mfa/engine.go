@@ -0,0 +1,280 @@
+package mfa
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"shield/modules/authn/internal/models"
+	"shield/modules/common/crypto"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNotEnrolled         = errors.New("mfa: user is not enrolled")
+	ErrInvalidCode         = errors.New("mfa: invalid code")
+	ErrReplayedCode        = errors.New("mfa: code already used")
+	ErrInvalidChallenge    = errors.New("mfa: invalid or expired challenge")
+	ErrRecoveryCodeInvalid = errors.New("mfa: invalid recovery code")
+)
+
+// SecretStore defines the persistence needed by the local MFA engine
+type SecretStore interface {
+	GetSecret(ctx context.Context, userID uuid.UUID) (*models.MFASecret, error)
+	SaveSecret(ctx context.Context, secret *models.MFASecret) error
+	DeleteSecret(ctx context.Context, userID uuid.UUID) error
+	// AdvanceLastUsedStep atomically records step as used if it is newer than the stored one.
+	// It returns false when the step (or a later one) was already used.
+	AdvanceLastUsedStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error)
+
+	ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codes []*models.MFARecoveryCode) error
+	// UseRecoveryCode atomically marks an unused code as used. It returns false if no unused code matched.
+	UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string, usedAt time.Time) (bool, error)
+}
+
+// EngineConfig contains configuration for the local MFA engine
+type EngineConfig struct {
+	Issuer            string
+	Skew              int           // Accepted clock drift in time steps
+	RecoveryCodeCount int           // Recovery codes issued on enrollment
+	ChallengeTTL      time.Duration // Lifetime of a pending login challenge
+}
+
+// Enrollment contains the data the user needs to add Shield to an authenticator app
+type Enrollment struct {
+	Secret string
+	KeyURI string
+}
+
+// LocalEngine generates and validates TOTP codes without involving the identity provider.
+// Secrets are stored encrypted; each accepted code is remembered to prevent replays.
+type LocalEngine struct {
+	store  SecretStore
+	sealer *crypto.Sealer
+	config EngineConfig
+	now    func() time.Time
+}
+
+// NewLocalEngine creates a new local MFA engine
+func NewLocalEngine(store SecretStore, sealer *crypto.Sealer, config EngineConfig) *LocalEngine {
+	if config.Skew <= 0 {
+		config.Skew = 1
+	}
+	if config.RecoveryCodeCount <= 0 {
+		config.RecoveryCodeCount = 10
+	}
+	if config.ChallengeTTL <= 0 {
+		config.ChallengeTTL = 5 * time.Minute
+	}
+
+	return &LocalEngine{
+		store:  store,
+		sealer: sealer,
+		config: config,
+		now:    time.Now,
+	}
+}
+
+// Enroll creates a new, unconfirmed TOTP secret for the user. A confirmed secret keeps
+// working until Confirm verifies a code from the new one, so an abandoned re-enrollment
+// cannot lock the user out.
+func (e *LocalEngine) Enroll(ctx context.Context, userID uuid.UUID, accountName string) (*Enrollment, error) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := e.sealer.Seal([]byte(secret))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt secret: %w", err)
+	}
+
+	record := &models.MFASecret{
+		UserID:          userID,
+		EncryptedSecret: encrypted,
+		Confirmed:       false,
+	}
+	if existing, err := e.store.GetSecret(ctx, userID); err == nil && existing.Confirmed {
+		record = existing
+		record.PendingSecret = encrypted
+	}
+	if err := e.store.SaveSecret(ctx, record); err != nil {
+		return nil, fmt.Errorf("failed to save secret: %w", err)
+	}
+
+	return &Enrollment{
+		Secret: secret,
+		KeyURI: KeyURI(e.config.Issuer, accountName, secret),
+	}, nil
+}
+
+// Confirm verifies the first code after enrollment, activates the secret and
+// returns a fresh set of recovery codes. The codes are only available in plaintext here.
+func (e *LocalEngine) Confirm(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	record, err := e.store.GetSecret(ctx, userID)
+	if err != nil {
+		return nil, ErrNotEnrolled
+	}
+
+	encrypted := record.PendingSecret
+	if encrypted == "" {
+		if record.Confirmed {
+			return nil, ErrNotEnrolled
+		}
+		encrypted = record.EncryptedSecret
+	}
+	if err := e.checkCode(ctx, record, encrypted, code); err != nil {
+		return nil, err
+	}
+
+	record.EncryptedSecret = encrypted
+	record.PendingSecret = ""
+	record.Confirmed = true
+	if err := e.store.SaveSecret(ctx, record); err != nil {
+		return nil, fmt.Errorf("failed to confirm secret: %w", err)
+	}
+
+	return e.RegenerateRecoveryCodes(ctx, userID)
+}
+
+// Verify validates a TOTP code for a user with a confirmed secret.
+func (e *LocalEngine) Verify(ctx context.Context, userID uuid.UUID, code string) error {
+	record, err := e.store.GetSecret(ctx, userID)
+	if err != nil || !record.Confirmed {
+		return ErrNotEnrolled
+	}
+	return e.checkCode(ctx, record, record.EncryptedSecret, code)
+}
+
+// VerifyRecoveryCode consumes one of the user's recovery codes.
+func (e *LocalEngine) VerifyRecoveryCode(ctx context.Context, userID uuid.UUID, code string) error {
+	ok, err := e.store.UseRecoveryCode(ctx, userID, hashRecoveryCode(code), e.now())
+	if err != nil {
+		return fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	if !ok {
+		return ErrRecoveryCodeInvalid
+	}
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes with a new set.
+func (e *LocalEngine) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	codes := make([]string, 0, e.config.RecoveryCodeCount)
+	records := make([]*models.MFARecoveryCode, 0, e.config.RecoveryCodeCount)
+	for i := 0; i < e.config.RecoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		records = append(records, &models.MFARecoveryCode{
+			UserID:   userID,
+			CodeHash: hashRecoveryCode(code),
+		})
+	}
+
+	if err := e.store.ReplaceRecoveryCodes(ctx, userID, records); err != nil {
+		return nil, fmt.Errorf("failed to save recovery codes: %w", err)
+	}
+	return codes, nil
+}
+
+// Disable removes the user's TOTP secret and recovery codes.
+func (e *LocalEngine) Disable(ctx context.Context, userID uuid.UUID) error {
+	if err := e.store.ReplaceRecoveryCodes(ctx, userID, nil); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	return e.store.DeleteSecret(ctx, userID)
+}
+
+// PendingLogin carries a completed first-factor login until the second factor is verified.
+type PendingLogin struct {
+	ID           string    `json:"jti"` // Random challenge ID, set when sealed; failed codes are counted against it
+	UserID       uuid.UUID `json:"uid"`
+	UserSub      string    `json:"sub"`
+	AccessToken  string    `json:"at"`
+	RefreshToken string    `json:"rt"`
+	ExpiresIn    int64     `json:"ein"`
+	ExpiresAt    int64     `json:"exp"`
+}
+
+// SealPendingLogin encrypts a pending login into an opaque challenge session token,
+// so the second step can be completed on any replica without server-side state.
+func (e *LocalEngine) SealPendingLogin(pending PendingLogin) (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate challenge ID: %w", err)
+	}
+	pending.ID = hex.EncodeToString(id)
+	pending.ExpiresAt = e.now().Add(e.config.ChallengeTTL).Unix()
+	payload, err := json.Marshal(pending)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode pending login: %w", err)
+	}
+	return e.sealer.Seal(payload)
+}
+
+// OpenPendingLogin decrypts and checks a challenge session token created by SealPendingLogin.
+func (e *LocalEngine) OpenPendingLogin(session string) (*PendingLogin, error) {
+	payload, err := e.sealer.Open(session)
+	if err != nil {
+		return nil, ErrInvalidChallenge
+	}
+
+	var pending PendingLogin
+	if err := json.Unmarshal(payload, &pending); err != nil {
+		return nil, ErrInvalidChallenge
+	}
+	if e.now().Unix() > pending.ExpiresAt {
+		return nil, ErrInvalidChallenge
+	}
+	return &pending, nil
+}
+
+// checkCode validates the code against the encrypted secret and atomically records its
+// time step to detect replays.
+func (e *LocalEngine) checkCode(ctx context.Context, record *models.MFASecret, encrypted, code string) error {
+	secret, err := e.sealer.Open(encrypted)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+
+	step, ok := ValidateCode(string(secret), strings.TrimSpace(code), e.now(), e.config.Skew)
+	if !ok {
+		return ErrInvalidCode
+	}
+
+	advanced, err := e.store.AdvanceLastUsedStep(ctx, record.UserID, step)
+	if err != nil {
+		return fmt.Errorf("failed to record code use: %w", err)
+	}
+	if !advanced {
+		return ErrReplayedCode
+	}
+	record.LastUsedStep = step
+	return nil
+}
+
+// generateRecoveryCode returns a code formatted as xxxxx-xxxxx.
+func generateRecoveryCode() (string, error) {
+	buf := make([]byte, 5)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate recovery code: %w", err)
+	}
+	code := hex.EncodeToString(buf)
+	return code[:5] + "-" + code[5:], nil
+}
+
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
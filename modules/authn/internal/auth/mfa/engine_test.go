@@ -0,0 +1,115 @@
+package mfa
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"shield/modules/authn/internal/models"
+	"shield/modules/common/crypto"
+
+	"github.com/google/uuid"
+)
+
+// memorySecrets is an in-memory SecretStore
+type memorySecrets struct {
+	secrets map[uuid.UUID]models.MFASecret
+}
+
+func (m *memorySecrets) GetSecret(_ context.Context, userID uuid.UUID) (*models.MFASecret, error) {
+	secret, ok := m.secrets[userID]
+	if !ok {
+		return nil, errors.New("record not found")
+	}
+	return &secret, nil
+}
+
+func (m *memorySecrets) SaveSecret(_ context.Context, secret *models.MFASecret) error {
+	m.secrets[secret.UserID] = *secret
+	return nil
+}
+
+func (m *memorySecrets) DeleteSecret(_ context.Context, userID uuid.UUID) error {
+	delete(m.secrets, userID)
+	return nil
+}
+
+func (m *memorySecrets) AdvanceLastUsedStep(_ context.Context, userID uuid.UUID, step int64) (bool, error) {
+	secret := m.secrets[userID]
+	if step <= secret.LastUsedStep {
+		return false, nil
+	}
+	secret.LastUsedStep = step
+	m.secrets[userID] = secret
+	return true, nil
+}
+
+func (m *memorySecrets) ReplaceRecoveryCodes(context.Context, uuid.UUID, []*models.MFARecoveryCode) error {
+	return nil
+}
+
+func (m *memorySecrets) UseRecoveryCode(context.Context, uuid.UUID, string, time.Time) (bool, error) {
+	return false, nil
+}
+
+func TestReenrollKeepsConfirmedSecret(t *testing.T) {
+	ctx := context.Background()
+	sealer, err := crypto.NewSealer("mfa-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	engine := NewLocalEngine(&memorySecrets{secrets: map[uuid.UUID]models.MFASecret{}}, sealer, EngineConfig{Issuer: "Shield"})
+	engine.now = func() time.Time { return now }
+	userID := uuid.New()
+
+	code := func(secret string) string {
+		t.Helper()
+		now = now.Add(time.Minute) // Every code comes from a fresh time step
+		c, err := GenerateCode(secret, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	first, err := engine.Enroll(ctx, userID, "user@example.com")
+	if err != nil {
+		t.Fatalf("Enroll() error = %v", err)
+	}
+	if err := engine.Verify(ctx, userID, code(first.Secret)); !errors.Is(err, ErrNotEnrolled) {
+		t.Fatalf("Verify() before confirmation error = %v, want ErrNotEnrolled", err)
+	}
+	if _, err := engine.Confirm(ctx, userID, code(first.Secret)); err != nil {
+		t.Fatalf("Confirm() error = %v", err)
+	}
+	if _, err := engine.Confirm(ctx, userID, code(first.Secret)); !errors.Is(err, ErrNotEnrolled) {
+		t.Errorf("Confirm() without a pending enrollment error = %v, want ErrNotEnrolled", err)
+	}
+
+	// An unfinished re-enrollment must not replace the confirmed secret
+	second, err := engine.Enroll(ctx, userID, "user@example.com")
+	if err != nil {
+		t.Fatalf("Enroll() again error = %v", err)
+	}
+	if err := engine.Verify(ctx, userID, code(first.Secret)); err != nil {
+		t.Errorf("Verify(confirmed secret) during re-enrollment error = %v", err)
+	}
+	if err := engine.Verify(ctx, userID, code(second.Secret)); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("Verify(pending secret) error = %v, want ErrInvalidCode", err)
+	}
+	if _, err := engine.Confirm(ctx, userID, code(first.Secret)); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("Confirm(confirmed secret) error = %v, want ErrInvalidCode", err)
+	}
+
+	if _, err := engine.Confirm(ctx, userID, code(second.Secret)); err != nil {
+		t.Fatalf("Confirm(pending secret) error = %v", err)
+	}
+	if err := engine.Verify(ctx, userID, code(second.Secret)); err != nil {
+		t.Errorf("Verify(new secret) error = %v", err)
+	}
+	if err := engine.Verify(ctx, userID, code(first.Secret)); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("Verify(replaced secret) error = %v, want ErrInvalidCode", err)
+	}
+}
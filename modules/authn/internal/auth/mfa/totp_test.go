@@ -0,0 +1,65 @@
+package mfa
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// RFC 6238 Appendix B test vectors (SHA1, 8 digits)
+func TestHOTPRFC6238Vectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+
+	tests := []struct {
+		unix     int64
+		expected string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, tt := range tests {
+		counter := uint64(TimeStep(time.Unix(tt.unix, 0)))
+		if got := hotp(key, counter, 8); got != tt.expected {
+			t.Errorf("hotp at %d = %s, want %s", tt.unix, got, tt.expected)
+		}
+	}
+}
+
+func TestValidateCode(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111111, 0)
+
+	current, err := GenerateCode(secret, now)
+	if err != nil {
+		t.Fatalf("GenerateCode failed: %v", err)
+	}
+	previous, _ := GenerateCode(secret, now.Add(-Period))
+	stale, _ := GenerateCode(secret, now.Add(-3*Period))
+
+	tests := []struct {
+		name     string
+		code     string
+		skew     int
+		expected bool
+	}{
+		{name: "current step", code: current, skew: 1, expected: true},
+		{name: "previous step within skew", code: previous, skew: 1, expected: true},
+		{name: "previous step without skew", code: previous, skew: 0, expected: false},
+		{name: "outside skew window", code: stale, skew: 1, expected: false},
+		{name: "wrong length", code: current[:5], skew: 1, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ok := ValidateCode(secret, tt.code, now, tt.skew)
+			if ok != tt.expected {
+				t.Errorf("ValidateCode(%q) = %v, want %v", tt.code, ok, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	appconfig "shield/cmd/app/config"
+	"shield/modules/authn/internal/auth/mfa"
+	authprovider "shield/modules/authn/internal/auth/provider"
+	"shield/modules/authn/internal/auth/session"
+	"shield/modules/authn/internal/models"
+	"shield/modules/common/crypto"
+	apperrors "shield/modules/common/errors"
+	"shield/modules/common/ratelimit"
+
+	"github.com/google/uuid"
+)
+
+// softwareTokenProvider stubs the provider TOTP enrollment operations
+type softwareTokenProvider struct {
+	authprovider.AuthProvider
+	err    error
+	status string
+}
+
+func (p *softwareTokenProvider) AssociateSoftwareToken(context.Context, authprovider.AssociateSoftwareTokenRequestData) (*authprovider.AssociateSoftwareTokenOutputData, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &authprovider.AssociateSoftwareTokenOutputData{SecretCode: "SECRET", Session: "setup-session"}, nil
+}
+
+func (p *softwareTokenProvider) VerifySoftwareToken(context.Context, authprovider.VerifySoftwareTokenRequestData) (*authprovider.VerifySoftwareTokenOutputData, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &authprovider.VerifySoftwareTokenOutputData{Status: p.status, Session: "next-session"}, nil
+}
+
+func TestProviderMFAErrors(t *testing.T) {
+	user := &models.User{ID: uuid.New(), Email: "user@example.com", CognitoSub: "sub-1"}
+	tests := []struct {
+		name   string
+		err    error
+		status string
+		want   *apperrors.AppError
+	}{
+		{"wrong code", fmt.Errorf("%w: cognito", authprovider.ErrCodeMismatch), "", apperrors.ErrCodeMismatch},
+		{"expired session", fmt.Errorf("%w: cognito", authprovider.ErrCodeExpired), "", apperrors.ErrCodeExpired},
+		{"too many attempts", fmt.Errorf("%w: cognito", authprovider.ErrLimitExceeded), "", apperrors.ErrAttemptLimitExceeded},
+		{"invalid access token", fmt.Errorf("%w: cognito", authprovider.ErrNotAuthorized), "", apperrors.ErrUnauthorized},
+		{"verification not successful", nil, "ERROR", apperrors.ErrCodeMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &softwareTokenProvider{err: tt.err, status: tt.status}
+			svc := NewAuthService(provider, &appconfig.Config{}, &usersByID{users: map[uuid.UUID]*models.User{user.ID: user}}, nil, nil)
+
+			_, err := svc.VerifyMFA(context.Background(), VerifyMFARequest{UserID: user.ID.String(), MFACode: "123456", Session: "setup-session"})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("VerifyMFA() error = %v, want %s", err, tt.want.Code)
+			}
+			if tt.err == nil {
+				return
+			}
+			_, err = svc.SetupMFA(context.Background(), SetupMFARequest{UserID: user.ID.String(), Method: models.MFAMethodTOTP, Session: "setup-session"})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("SetupMFA() error = %v, want %s", err, tt.want.Code)
+			}
+		})
+	}
+}
+
+func TestMFARequestErrors(t *testing.T) {
+	user := &models.User{ID: uuid.New(), Email: "user@example.com", CognitoSub: "sub-1"}
+	svc := NewAuthService(&softwareTokenProvider{status: "SUCCESS"}, &appconfig.Config{}, &usersByID{users: map[uuid.UUID]*models.User{user.ID: user}}, nil, nil)
+	ctx := context.Background()
+
+	_, err := svc.SetupMFA(ctx, SetupMFARequest{UserID: user.ID.String(), Method: models.MFAMethodTOTP})
+	if !errors.Is(err, apperrors.ErrUnauthorized) {
+		t.Errorf("SetupMFA() without token or session error = %v, want UNAUTHORIZED", err)
+	}
+	_, err = svc.VerifyMFA(ctx, VerifyMFARequest{UserID: user.ID.String(), MFACode: "123456"})
+	if !errors.Is(err, apperrors.ErrUnauthorized) {
+		t.Errorf("VerifyMFA() without token or session error = %v, want UNAUTHORIZED", err)
+	}
+
+	var appErr *apperrors.AppError
+	_, err = svc.SetupMFA(ctx, SetupMFARequest{UserID: user.ID.String(), Method: "EMAIL", AccessToken: "access"})
+	if !errors.As(err, &appErr) || appErr.Code != "INVALID_MFA_METHOD" {
+		t.Errorf("SetupMFA(EMAIL) error = %v, want INVALID_MFA_METHOD", err)
+	}
+}
+
+func TestLocalMFAErrors(t *testing.T) {
+	tests := []struct {
+		err  error
+		want *apperrors.AppError
+	}{
+		{mfa.ErrInvalidCode, apperrors.ErrCodeMismatch},
+		{mfa.ErrReplayedCode, apperrors.ErrCodeMismatch},
+		{mfa.ErrNotEnrolled, ErrMFANotStarted},
+	}
+	for _, tt := range tests {
+		if err := mfaError(fmt.Errorf("confirm: %w", tt.err)); !errors.Is(err, tt.want) {
+			t.Errorf("mfaError(%v) = %v, want %s", tt.err, err, tt.want.Code)
+		}
+	}
+}
+
+// confirmedSecret is a SecretStore holding one confirmed TOTP secret
+type confirmedSecret struct {
+	mfa.SecretStore
+	record models.MFASecret
+}
+
+func (s *confirmedSecret) GetSecret(context.Context, uuid.UUID) (*models.MFASecret, error) {
+	record := s.record
+	return &record, nil
+}
+
+func (s *confirmedSecret) AdvanceLastUsedStep(_ context.Context, _ uuid.UUID, step int64) (bool, error) {
+	if step <= s.record.LastUsedStep {
+		return false, nil
+	}
+	s.record.LastUsedStep = step
+	return true, nil
+}
+
+func TestLocalMFAChallengeAttemptLimits(t *testing.T) {
+	ctx := context.Background()
+	sealer, err := crypto.NewSealer("mfa-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, _ := mfa.GenerateSecret()
+	encrypted, _ := sealer.Seal([]byte(secret))
+
+	user := &models.User{
+		ID: uuid.New(), Email: "user@example.com", CognitoSub: "sub-1",
+		Organization: &models.Organization{MFAEngine: models.MFAEngineLocal},
+	}
+	store := &confirmedSecret{record: models.MFASecret{UserID: user.ID, EncryptedSecret: encrypted, Confirmed: true}}
+	engine := mfa.NewLocalEngine(store, sealer, mfa.EngineConfig{})
+	svc := NewAuthService(nil, &appconfig.Config{}, &usersByID{users: map[uuid.UUID]*models.User{user.ID: user}}, &createdSessions{}, nil,
+		WithLocalMFA(engine),
+		WithMFAAttemptLimits(
+			ratelimit.NewMemoryLimiter(ratelimit.Rule{Limit: 2, Window: time.Minute}),
+			ratelimit.NewMemoryLimiter(ratelimit.Rule{Limit: 4, Window: time.Minute}),
+		))
+
+	newChallenge := func() string {
+		t.Helper()
+		sealed, err := engine.SealPendingLogin(mfa.PendingLogin{UserID: user.ID, UserSub: user.CognitoSub, AccessToken: "access"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return localChallengePrefix + sealed
+	}
+	answer := func(challenge, code string) error {
+		_, err := svc.RespondToLoginChallenge(ctx, LoginChallengeRequest{
+			Email: user.Email, ChallengeName: "SOFTWARE_TOKEN_MFA", Session: challenge,
+			Responses: map[string]string{"SOFTWARE_TOKEN_MFA_CODE": code},
+		}, session.ClientInfo{})
+		return err
+	}
+	validCode := func() string {
+		code, _ := mfa.GenerateCode(secret, time.Now())
+		return code
+	}
+
+	first := newChallenge()
+	for i := 0; i < 2; i++ {
+		if err := answer(first, "wrong"); !errors.Is(err, mfa.ErrInvalidCode) {
+			t.Fatalf("wrong code %d error = %v, want ErrInvalidCode", i+1, err)
+		}
+	}
+	if err := answer(first, validCode()); !errors.Is(err, mfa.ErrInvalidChallenge) {
+		t.Errorf("valid code on exhausted challenge error = %v, want ErrInvalidChallenge", err)
+	}
+
+	second := newChallenge()
+	if err := answer(second, "wrong"); !errors.Is(err, mfa.ErrInvalidCode) {
+		t.Fatalf("wrong code error = %v, want ErrInvalidCode", err)
+	}
+	if err := answer(second, validCode()); err != nil {
+		t.Errorf("valid code on a new challenge error = %v", err)
+	}
+
+	third := newChallenge()
+	if err := answer(third, "wrong"); !errors.Is(err, mfa.ErrInvalidCode) {
+		t.Fatalf("wrong code error = %v, want ErrInvalidCode", err)
+	}
+	var retryErr *apperrors.RetryAfterError
+	if err := answer(third, validCode()); !errors.As(err, &retryErr) || !errors.Is(err, apperrors.ErrAttemptLimitExceeded) || retryErr.RetryAfter <= 0 {
+		t.Errorf("valid code after user limit error = %v, want ATTEMPT_LIMIT_EXCEEDED with a retry delay", err)
+	}
+}
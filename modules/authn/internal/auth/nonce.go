@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"shield/modules/authn/internal/auth/nonce"
+	apperrors "shield/modules/common/errors"
+)
+
+// NonceTransportCookie delivers issued nonces in a cookie as well; requests must echo the nonce in a header
+const NonceTransportCookie = "cookie"
+
+// noncePurposes are the purposes nonces can be issued for, one per group of protected routes
+var noncePurposes = map[string]bool{
+	nonce.PurposeSignup:   true,
+	nonce.PurposeLogin:    true,
+	nonce.PurposeConfirm:  true,
+	nonce.PurposeMFA:      true,
+	nonce.PurposePassword: true,
+	nonce.PurposeRefresh:  true,
+}
+
+// IssueNonce returns a single-use nonce for purpose, bound to the client's device fingerprint.
+func (s *AuthService) IssueNonce(ctx context.Context, purpose, fingerprint string) (string, error) {
+	if !noncePurposes[purpose] {
+		return "", apperrors.NewAppError("INVALID_NONCE_PURPOSE", fmt.Sprintf("Unknown nonce purpose %q", purpose), http.StatusBadRequest)
+	}
+	if fingerprint == "" {
+		return "", apperrors.ErrInvalidNonce
+	}
+	return s.nonceValidator.Generate(ctx, nonce.Binding{Purpose: purpose, Fingerprint: fingerprint})
+}
+
+// ConsumeNonce validates and uses up a nonce. Every validation failure is reported as ErrInvalidNonce.
+func (s *AuthService) ConsumeNonce(ctx context.Context, value, purpose, fingerprint string) error {
+	if value == "" {
+		return apperrors.ErrInvalidNonce
+	}
+	if err := s.nonceValidator.Validate(ctx, value, nonce.Binding{Purpose: purpose, Fingerprint: fingerprint}); err != nil {
+		log.Printf("Nonce rejected for %s: %v", purpose, err)
+		return apperrors.ErrInvalidNonce
+	}
+	return nil
+}
+
+// NonceTTL returns how long an issued nonce stays valid.
+func (s *AuthService) NonceTTL() time.Duration {
+	if s.config.Nonce.TTL > 0 {
+		return s.config.Nonce.TTL
+	}
+	return 5 * time.Minute
+}
+
+// NonceCookieMode reports whether issued nonces are also set as a cookie that requests must match.
+func (s *AuthService) NonceCookieMode() bool {
+	return s.config.Nonce.Transport == NonceTransportCookie
+}
+
+// NonceExempt reports whether a route is configured to skip nonce checks. Exemptions are written
+// as "METHOD /path" with the path relative to the API prefix, e.g. "POST /auth/mfa/verify".
+func (s *AuthService) NonceExempt(method, fullPath string) bool {
+	for _, exempt := range s.config.Nonce.Exempt {
+		exemptMethod, exemptPath, ok := strings.Cut(exempt, " ")
+		if ok && strings.EqualFold(exemptMethod, method) && strings.HasSuffix(fullPath, exemptPath) {
+			return true
+		}
+	}
+	return false
+}
@@ -4,31 +4,62 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 )
 
+// Validation errors; callers map all of them to an invalid nonce response
+var (
+	ErrInvalidNonce        = errors.New("nonce: invalid nonce")
+	ErrExpiredNonce        = errors.New("nonce: nonce expired")
+	ErrBindingMismatch     = errors.New("nonce: purpose or device fingerprint mismatch")
+	ErrNonceUsed           = errors.New("nonce: nonce already used")
+	ErrFingerprintRequired = errors.New("nonce: device fingerprint required")
+)
+
 // NonceValidator handles nonce generation and validation
 // Used for CSRF protection and one-time use tokens
 type NonceValidator interface {
-	Generate(ctx context.Context) (string, error)
-	Validate(ctx context.Context, nonce string) error
+	Generate(ctx context.Context, binding Binding) (string, error)
+	Validate(ctx context.Context, nonce string, binding Binding) error
 	Cleanup(ctx context.Context) error
 }
 
+// Nonce purposes; a nonce issued for one purpose is rejected for any other
+const (
+	PurposeLogin    = "login"
+	PurposeSignup   = "signup"
+	PurposeConfirm  = "confirm"
+	PurposeMFA      = "mfa"
+	PurposePassword = "password"
+	PurposeRefresh  = "refresh"
+)
+
+// Binding ties a nonce to the action it may be used for and the device it was issued to
+type Binding struct {
+	Purpose     string
+	Fingerprint string // Client device fingerprint, sent in the X-Device-Fingerprint header
+}
+
 // InMemoryNonceValidator is an in-memory implementation of NonceValidator
 // For production, consider using Redis or database storage
 type InMemoryNonceValidator struct {
-	nonces map[string]time.Time
+	nonces map[string]inMemoryNonce
 	mutex  sync.RWMutex
 	ttl    time.Duration
 }
 
+type inMemoryNonce struct {
+	binding Binding
+	expiry  time.Time
+}
+
 // NewInMemoryNonceValidator creates a new in-memory nonce validator
 func NewInMemoryNonceValidator(ttl time.Duration) *InMemoryNonceValidator {
 	validator := &InMemoryNonceValidator{
-		nonces: make(map[string]time.Time),
+		nonces: make(map[string]inMemoryNonce),
 		ttl:    ttl,
 	}
 
@@ -39,7 +70,7 @@ func NewInMemoryNonceValidator(ttl time.Duration) *InMemoryNonceValidator {
 }
 
 // Generate creates a new nonce
-func (v *InMemoryNonceValidator) Generate(ctx context.Context) (string, error) {
+func (v *InMemoryNonceValidator) Generate(ctx context.Context, binding Binding) (string, error) {
 	// Generate 32 bytes of random data
 	bytes := make([]byte, 32)
 	if _, err := rand.Read(bytes); err != nil {
@@ -51,26 +82,29 @@ func (v *InMemoryNonceValidator) Generate(ctx context.Context) (string, error) {
 	v.mutex.Lock()
 	defer v.mutex.Unlock()
 
-	v.nonces[nonce] = time.Now().Add(v.ttl)
+	v.nonces[nonce] = inMemoryNonce{binding: binding, expiry: time.Now().Add(v.ttl)}
 
 	return nonce, nil
 }
 
 // Validate checks if a nonce is valid and removes it (one-time use)
-func (v *InMemoryNonceValidator) Validate(ctx context.Context, nonce string) error {
+func (v *InMemoryNonceValidator) Validate(ctx context.Context, nonce string, binding Binding) error {
 	v.mutex.Lock()
 	defer v.mutex.Unlock()
 
-	expiry, exists := v.nonces[nonce]
+	stored, exists := v.nonces[nonce]
 	if !exists {
-		return fmt.Errorf("invalid nonce")
+		return ErrInvalidNonce
 	}
 
 	// Remove nonce (one-time use)
 	delete(v.nonces, nonce)
 
-	if time.Now().After(expiry) {
-		return fmt.Errorf("nonce expired")
+	if time.Now().After(stored.expiry) {
+		return ErrExpiredNonce
+	}
+	if stored.binding != binding {
+		return ErrBindingMismatch
 	}
 
 	return nil
@@ -82,8 +116,8 @@ func (v *InMemoryNonceValidator) Cleanup(ctx context.Context) error {
 	defer v.mutex.Unlock()
 
 	now := time.Now()
-	for nonce, expiry := range v.nonces {
-		if now.After(expiry) {
+	for nonce, stored := range v.nonces {
+		if now.After(stored.expiry) {
 			delete(v.nonces, nonce)
 		}
 	}
@@ -0,0 +1,99 @@
+package nonce
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisUsedPrefix  = "shield:nonce:used:"
+	redisNoncePrefix = "shield:nonce:"
+)
+
+// RedisReplayStore is a ReplayStore shared by all replicas. Used nonce IDs expire with the nonce itself.
+type RedisReplayStore struct {
+	client redis.UniversalClient
+}
+
+// NewRedisReplayStore creates a new Redis-backed replay store
+func NewRedisReplayStore(client redis.UniversalClient) *RedisReplayStore {
+	return &RedisReplayStore{client: client}
+}
+
+// MarkUsed records a nonce as used and reports whether this was its first use.
+// SET NX makes the check and the write a single atomic step across replicas.
+func (s *RedisReplayStore) MarkUsed(ctx context.Context, nonceID string, expiresAt time.Time) (bool, error) {
+	ttl := time.Until(expiresAt)
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+	return s.client.SetNX(ctx, redisUsedPrefix+nonceID, 1, ttl).Result()
+}
+
+// Cleanup is a no-op; Redis expires used nonce IDs on its own
+func (s *RedisReplayStore) Cleanup(ctx context.Context) error {
+	return nil
+}
+
+// RedisNonceValidator stores opaque random nonces in Redis, so they can be issued
+// by one replica and consumed by another
+type RedisNonceValidator struct {
+	client redis.UniversalClient
+	ttl    time.Duration
+}
+
+// NewRedisNonceValidator creates a new Redis-backed nonce validator
+func NewRedisNonceValidator(client redis.UniversalClient, ttl time.Duration) *RedisNonceValidator {
+	return &RedisNonceValidator{client: client, ttl: ttl}
+}
+
+// Generate creates a new nonce that expires after the validator's TTL
+func (v *RedisNonceValidator) Generate(ctx context.Context, binding Binding) (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+	nonce := hex.EncodeToString(bytes)
+
+	if err := v.client.Set(ctx, redisNoncePrefix+nonce, encodeBinding(binding), v.ttl).Err(); err != nil {
+		return "", fmt.Errorf("failed to store nonce: %w", err)
+	}
+	return nonce, nil
+}
+
+// Validate consumes a nonce with GETDEL, so only one of several concurrent requests can use it
+func (v *RedisNonceValidator) Validate(ctx context.Context, nonce string, binding Binding) error {
+	if nonce == "" {
+		return ErrInvalidNonce
+	}
+
+	stored, err := v.client.GetDel(ctx, redisNoncePrefix+nonce).Result()
+	if errors.Is(err, redis.Nil) {
+		// Unknown, already used, or expired
+		return ErrInvalidNonce
+	}
+	if err != nil {
+		return fmt.Errorf("failed to consume nonce: %w", err)
+	}
+
+	if stored != encodeBinding(binding) {
+		return ErrBindingMismatch
+	}
+	return nil
+}
+
+// Cleanup is a no-op; Redis expires nonces on its own
+func (v *RedisNonceValidator) Cleanup(ctx context.Context) error {
+	return nil
+}
+
+// encodeBinding stores the fingerprint hashed, like signed nonces do
+func encodeBinding(binding Binding) string {
+	return binding.Purpose + ":" + hashFingerprint(binding.Fingerprint)
+}
@@ -0,0 +1,111 @@
+package nonce
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, redis.UniversalClient) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return server, client
+}
+
+func TestRedisNonceValidator(t *testing.T) {
+	server, client := newTestRedis(t)
+	validator := NewRedisNonceValidator(client, 5*time.Minute)
+	ctx := context.Background()
+	binding := Binding{Purpose: PurposeLogin, Fingerprint: "device-1"}
+
+	value, err := validator.Generate(ctx, binding)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if err := validator.Validate(ctx, value, binding); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if err := validator.Validate(ctx, value, binding); !errors.Is(err, ErrInvalidNonce) {
+		t.Errorf("Validate() replay error = %v, want ErrInvalidNonce", err)
+	}
+
+	other, err := validator.Generate(ctx, binding)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if err := validator.Validate(ctx, other, Binding{Purpose: PurposeSignup, Fingerprint: "device-1"}); !errors.Is(err, ErrBindingMismatch) {
+		t.Errorf("Validate() for other purpose error = %v, want ErrBindingMismatch", err)
+	}
+
+	expiring, err := validator.Generate(ctx, binding)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	server.FastForward(6 * time.Minute)
+	if err := validator.Validate(ctx, expiring, binding); !errors.Is(err, ErrInvalidNonce) {
+		t.Errorf("Validate() after TTL error = %v, want ErrInvalidNonce", err)
+	}
+}
+
+func TestRedisReplayStoreConcurrentUse(t *testing.T) {
+	_, client := newTestRedis(t)
+	store := NewRedisReplayStore(client)
+	ctx := context.Background()
+
+	// Replicas racing on the same nonce: exactly one wins
+	var wg sync.WaitGroup
+	var fresh atomic.Int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := store.MarkUsed(ctx, "nonce-1", time.Now().Add(time.Minute))
+			if err != nil {
+				t.Errorf("MarkUsed() error = %v", err)
+			}
+			if ok {
+				fresh.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := fresh.Load(); got != 1 {
+		t.Errorf("MarkUsed() reported first use %d times, want 1", got)
+	}
+}
+
+func TestSignedNonceWithRedisReplayStore(t *testing.T) {
+	server, client := newTestRedis(t)
+	ctx := context.Background()
+	binding := Binding{Purpose: PurposeSignup, Fingerprint: "device-1"}
+
+	// Two replicas share the signing key and the replay store
+	issuer := newTestValidator(t, "secret")
+	issuer.replay = NewRedisReplayStore(client)
+	consumer := newTestValidator(t, "secret")
+	consumer.replay = NewRedisReplayStore(client)
+
+	value, err := issuer.Generate(ctx, binding)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if err := consumer.Validate(ctx, value, binding); err != nil {
+		t.Fatalf("Validate() on other replica error = %v", err)
+	}
+	if err := issuer.Validate(ctx, value, binding); !errors.Is(err, ErrNonceUsed) {
+		t.Errorf("Validate() replay on issuing replica error = %v, want ErrNonceUsed", err)
+	}
+
+	if keys := server.Keys(); len(keys) != 1 || server.TTL(keys[0]) <= 0 {
+		t.Errorf("replay store keys = %v, want one expiring key", keys)
+	}
+}
@@ -0,0 +1,64 @@
+package nonce
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ReplayStore remembers consumed nonce IDs until they expire
+type ReplayStore interface {
+	// MarkUsed records a nonce as used and reports whether this was its first use
+	MarkUsed(ctx context.Context, nonceID string, expiresAt time.Time) (bool, error)
+	Cleanup(ctx context.Context) error
+}
+
+// MemoryReplayStore is an in-process ReplayStore. It only enforces single use within one replica.
+type MemoryReplayStore struct {
+	used  map[string]time.Time
+	mutex sync.Mutex
+}
+
+// NewMemoryReplayStore creates a new in-memory replay store that prunes expired entries every cleanupInterval
+func NewMemoryReplayStore(cleanupInterval time.Duration) *MemoryReplayStore {
+	store := &MemoryReplayStore{used: make(map[string]time.Time)}
+
+	if cleanupInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(cleanupInterval)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				_ = store.Cleanup(context.Background())
+			}
+		}()
+	}
+
+	return store
+}
+
+// MarkUsed records a nonce as used and reports whether this was its first use
+func (s *MemoryReplayStore) MarkUsed(ctx context.Context, nonceID string, expiresAt time.Time) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if expiry, ok := s.used[nonceID]; ok && time.Now().Before(expiry) {
+		return false, nil
+	}
+	s.used[nonceID] = expiresAt
+	return true, nil
+}
+
+// Cleanup removes nonces past their expiry, which can no longer be replayed anyway
+func (s *MemoryReplayStore) Cleanup(ctx context.Context) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	for nonceID, expiry := range s.used {
+		if now.After(expiry) {
+			delete(s.used, nonceID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package nonce
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"shield/modules/common/crypto"
+
+	"github.com/google/uuid"
+)
+
+// signedPayload is the JSON payload of a signed nonce (see Login_Flow_Requirements.md)
+type signedPayload struct {
+	Nonce       string `json:"nonce"`
+	IssuedAt    int64  `json:"iat"`
+	ExpiresAt   int64  `json:"exp"`
+	Purpose     string `json:"purpose"`
+	Fingerprint string `json:"fp"` // SHA-256 of the device fingerprint
+}
+
+// SignedNonceConfig contains configuration for signed nonces
+type SignedNonceConfig struct {
+	TTL     time.Duration // Lifetime of an issued nonce (default 5m)
+	MaxSkew time.Duration // Tolerated clock skew for iat (default 30s)
+}
+
+// SignedNonceValidator issues stateless nonces of the form <base64(payload)>.<hmac>.
+// Validity is checked from the token alone; the replay store only remembers used nonce IDs
+// until they expire, which enforces single use.
+type SignedNonceValidator struct {
+	signer *crypto.Signer
+	replay ReplayStore
+	config SignedNonceConfig
+	now    func() time.Time
+}
+
+// NewSignedNonceValidator creates a new signed nonce validator
+func NewSignedNonceValidator(signer *crypto.Signer, replay ReplayStore, config SignedNonceConfig) *SignedNonceValidator {
+	if config.TTL <= 0 {
+		config.TTL = 5 * time.Minute
+	}
+	if config.MaxSkew <= 0 {
+		config.MaxSkew = 30 * time.Second
+	}
+
+	return &SignedNonceValidator{
+		signer: signer,
+		replay: replay,
+		config: config,
+		now:    time.Now,
+	}
+}
+
+// Generate issues a signed nonce bound to the purpose and device fingerprint
+func (v *SignedNonceValidator) Generate(ctx context.Context, binding Binding) (string, error) {
+	if binding.Fingerprint == "" {
+		return "", ErrFingerprintRequired
+	}
+
+	now := v.now()
+	payload, err := json.Marshal(signedPayload{
+		Nonce:       uuid.NewString(),
+		IssuedAt:    now.Unix(),
+		ExpiresAt:   now.Add(v.config.TTL).Unix(),
+		Purpose:     binding.Purpose,
+		Fingerprint: hashFingerprint(binding.Fingerprint),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode nonce: %w", err)
+	}
+
+	return v.signer.Sign(base64.RawURLEncoding.EncodeToString(payload)), nil
+}
+
+// Validate verifies the signature, freshness and binding of a nonce, then consumes it
+func (v *SignedNonceValidator) Validate(ctx context.Context, nonce string, binding Binding) error {
+	if binding.Fingerprint == "" {
+		return ErrFingerprintRequired
+	}
+
+	encoded, err := v.signer.Verify(nonce)
+	if err != nil {
+		return ErrInvalidNonce
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return ErrInvalidNonce
+	}
+	var payload signedPayload
+	if err := json.Unmarshal(raw, &payload); err != nil || payload.Nonce == "" {
+		return ErrInvalidNonce
+	}
+
+	now := v.now()
+	expiresAt := time.Unix(payload.ExpiresAt, 0)
+	if now.After(expiresAt) {
+		return ErrExpiredNonce
+	}
+	if time.Unix(payload.IssuedAt, 0).After(now.Add(v.config.MaxSkew)) {
+		return ErrInvalidNonce
+	}
+
+	fingerprint := hashFingerprint(binding.Fingerprint)
+	if payload.Purpose != binding.Purpose || subtle.ConstantTimeCompare([]byte(payload.Fingerprint), []byte(fingerprint)) != 1 {
+		return ErrBindingMismatch
+	}
+
+	// Consume last, so a nonce presented with the wrong binding is not burned
+	fresh, err := v.replay.MarkUsed(ctx, payload.Nonce, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to record nonce use: %w", err)
+	}
+	if !fresh {
+		return ErrNonceUsed
+	}
+	return nil
+}
+
+// Cleanup removes expired entries from the replay store
+func (v *SignedNonceValidator) Cleanup(ctx context.Context) error {
+	return v.replay.Cleanup(ctx)
+}
+
+func hashFingerprint(fingerprint string) string {
+	sum := sha256.Sum256([]byte(fingerprint))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,121 @@
+package nonce
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"shield/modules/common/crypto"
+)
+
+func newTestValidator(t *testing.T, key string) *SignedNonceValidator {
+	t.Helper()
+	signer, err := crypto.NewSigner(key, "nonce")
+	if err != nil {
+		t.Fatalf("NewSigner() error = %v", err)
+	}
+	return NewSignedNonceValidator(signer, NewMemoryReplayStore(0), SignedNonceConfig{TTL: 5 * time.Minute})
+}
+
+func TestSignedNonceValidator(t *testing.T) {
+	validator := newTestValidator(t, "secret")
+	ctx := context.Background()
+	login := Binding{Purpose: PurposeLogin, Fingerprint: "device-1"}
+
+	generate := func(binding Binding) string {
+		value, err := validator.Generate(ctx, binding)
+		if err != nil {
+			t.Fatalf("Generate() error = %v", err)
+		}
+		return value
+	}
+
+	valid := generate(login)
+	payload, signature, _ := strings.Cut(valid, ".")
+	tampered, _ := base64.RawURLEncoding.DecodeString(payload)
+	tampered = []byte(strings.Replace(string(tampered), `"login"`, `"signup"`, 1))
+
+	otherKey, err := newTestValidator(t, "other").Generate(ctx, login)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		nonce   string
+		binding Binding
+		wantErr error
+	}{
+		{"valid", valid, login, nil},
+		{"other purpose", generate(login), Binding{Purpose: PurposeSignup, Fingerprint: "device-1"}, ErrBindingMismatch},
+		{"other device", generate(login), Binding{Purpose: PurposeLogin, Fingerprint: "device-2"}, ErrBindingMismatch},
+		{"missing fingerprint", generate(login), Binding{Purpose: PurposeLogin}, ErrFingerprintRequired},
+		{"tampered payload", base64.RawURLEncoding.EncodeToString(tampered) + "." + signature, Binding{Purpose: PurposeSignup, Fingerprint: "device-1"}, ErrInvalidNonce},
+		{"signed with other key", otherKey, login, ErrInvalidNonce},
+		{"malformed", "not-a-nonce", login, ErrInvalidNonce},
+		{"empty", "", login, ErrInvalidNonce},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validator.Validate(ctx, tt.nonce, tt.binding)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSignedNonceSingleUse(t *testing.T) {
+	validator := newTestValidator(t, "secret")
+	ctx := context.Background()
+	binding := Binding{Purpose: PurposeSignup, Fingerprint: "device-1"}
+
+	value, err := validator.Generate(ctx, binding)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	// A nonce presented with the wrong binding is not consumed
+	if err := validator.Validate(ctx, value, Binding{Purpose: PurposeSignup, Fingerprint: "device-2"}); !errors.Is(err, ErrBindingMismatch) {
+		t.Fatalf("Validate() from other device error = %v, want ErrBindingMismatch", err)
+	}
+	if err := validator.Validate(ctx, value, binding); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if err := validator.Validate(ctx, value, binding); !errors.Is(err, ErrNonceUsed) {
+		t.Errorf("Validate() replay error = %v, want ErrNonceUsed", err)
+	}
+}
+
+func TestSignedNonceExpiry(t *testing.T) {
+	validator := newTestValidator(t, "secret")
+	ctx := context.Background()
+	binding := Binding{Purpose: PurposeLogin, Fingerprint: "device-1"}
+
+	issued := time.Now()
+	validator.now = func() time.Time { return issued }
+	value, err := validator.Generate(ctx, binding)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	validator.now = func() time.Time { return issued.Add(6 * time.Minute) }
+	if err := validator.Validate(ctx, value, binding); !errors.Is(err, ErrExpiredNonce) {
+		t.Errorf("Validate() after TTL error = %v, want ErrExpiredNonce", err)
+	}
+
+	// Nonces issued too far in the future are rejected, which catches skewed issuers
+	validator.now = func() time.Time { return issued.Add(time.Hour) }
+	future, err := validator.Generate(ctx, binding)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	validator.now = func() time.Time { return issued }
+	if err := validator.Validate(ctx, future, binding); !errors.Is(err, ErrInvalidNonce) {
+		t.Errorf("Validate() of future nonce error = %v, want ErrInvalidNonce", err)
+	}
+}
@@ -0,0 +1,476 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	authprovider "shield/modules/authn/internal/auth/provider"
+	"shield/modules/authn/internal/auth/sso"
+	"shield/modules/authn/internal/models"
+	apperrors "shield/modules/common/errors"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrSSOConfigNotFound = apperrors.NewAppError("SSO_CONFIG_NOT_FOUND", "Organization has no SSO configuration", http.StatusNotFound)
+	ErrSSOConfigExists   = apperrors.NewAppError("SSO_CONFIG_EXISTS", "Organization already has an SSO configuration", http.StatusConflict)
+)
+
+// identifierTaken returns the error for a domain that routes to another organization's IdP.
+func identifierTaken(domain string) error {
+	return apperrors.NewAppError("IDP_IDENTIFIER_TAKEN", fmt.Sprintf("Domain %s is used by another organization", domain), http.StatusConflict)
+}
+
+// invalidSSOConfig returns a validation error for an SSO configuration request.
+func invalidSSOConfig(format string, args ...interface{}) error {
+	return apperrors.NewAppError("INVALID_SSO_CONFIG", fmt.Sprintf(format, args...), http.StatusBadRequest)
+}
+
+// Default attribute mappings from the IdP to user pool attributes
+var defaultAttributeMappings = map[models.IDPType]map[string]string{
+	models.IDPTypeSAML: {"email": "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress"},
+	models.IDPTypeOIDC: {"email": "email"},
+}
+
+// OrgSSOConfigRequest contains an IdP registration for an organization.
+// On update, empty fields keep their current value. IdP identifiers that are not verified yet
+// only route users once VerifyOrgSSODomains found their DNS verification record.
+type OrgSSOConfigRequest struct {
+	ProviderName     string // Defaults to a name derived from the organization
+	IDPType          models.IDPType
+	MetadataURL      string // SAML
+	MetadataXML      string // SAML
+	Issuer           string // OIDC
+	ClientID         string // OIDC
+	ClientSecret     string // OIDC
+	AuthorizeScopes  string // OIDC, space-separated
+	AttributeMapping map[string]string
+	IdpIdentifiers   []string
+}
+
+// OrgSSOTestResult reports whether an organization's IdP is usable.
+type OrgSSOTestResult struct {
+	Success  bool
+	Error    string
+	TestedAt time.Time
+}
+
+// GetOrgSSOConfig returns the organization's SSO configuration.
+func (s *AuthService) GetOrgSSOConfig(ctx context.Context, caller *models.User, orgID uuid.UUID) (*models.SSOProviderConfig, error) {
+	if _, err := s.adminOrganization(ctx, caller, orgID); err != nil {
+		return nil, err
+	}
+
+	config, err := s.userRepository.GetSSOProviderConfig(ctx, orgID)
+	if err != nil {
+		return nil, ErrSSOConfigNotFound
+	}
+	return config, nil
+}
+
+// CreateOrgSSOConfig registers the organization's IdP with the auth provider and stores its configuration.
+func (s *AuthService) CreateOrgSSOConfig(ctx context.Context, caller *models.User, orgID uuid.UUID, req OrgSSOConfigRequest) (*models.SSOProviderConfig, error) {
+	org, err := s.adminOrganization(ctx, caller, orgID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.userRepository.GetSSOProviderConfig(ctx, orgID); err == nil {
+		return nil, ErrSSOConfigExists
+	}
+
+	config := &models.SSOProviderConfig{
+		OrgID:            org.ID,
+		ProviderName:     req.ProviderName,
+		AttributeMapping: req.AttributeMapping,
+	}
+	if config.ProviderName == "" {
+		config.ProviderName = defaultProviderName(org.Name, req.IDPType)
+	}
+	if !validProviderName(config.ProviderName) {
+		return nil, invalidSSOConfig("providerName must be 3-32 characters without spaces or underscores")
+	}
+	if len(config.AttributeMapping) == 0 {
+		config.AttributeMapping = defaultAttributeMappings[req.IDPType]
+	}
+	if err := s.requestIdpIdentifiers(ctx, config, req.IdpIdentifiers); err != nil {
+		return nil, err
+	}
+
+	details, err := applySSODetails(ctx, config, req, true)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.provider.CreateIdentityProvider(ctx, authprovider.CreateIdentityProviderRequestData{
+		ProviderName:     config.ProviderName,
+		ProviderType:     string(config.IDPType),
+		ProviderDetails:  details,
+		AttributeMapping: config.AttributeMapping,
+		IdpIdentifiers:   config.IdpIdentifiers,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create identity provider: %w", err)
+	}
+
+	if err := s.userRepository.SaveSSOProviderConfig(ctx, org, config); err != nil {
+		// Keep the provider and database consistent
+		if delErr := s.provider.DeleteIdentityProvider(ctx, config.ProviderName); delErr != nil {
+			log.Printf("Failed to remove identity provider %s after save error: %v", config.ProviderName, delErr)
+		}
+		return nil, fmt.Errorf("failed to save SSO configuration: %w", err)
+	}
+	return config, nil
+}
+
+// UpdateOrgSSOConfig updates the organization's IdP in the auth provider and in the database.
+func (s *AuthService) UpdateOrgSSOConfig(ctx context.Context, caller *models.User, orgID uuid.UUID, req OrgSSOConfigRequest) (*models.SSOProviderConfig, error) {
+	org, err := s.adminOrganization(ctx, caller, orgID)
+	if err != nil {
+		return nil, err
+	}
+	config, err := s.userRepository.GetSSOProviderConfig(ctx, orgID)
+	if err != nil {
+		return nil, ErrSSOConfigNotFound
+	}
+	if req.IDPType != "" && req.IDPType != config.IDPType {
+		return nil, invalidSSOConfig("idpType cannot be changed; delete and recreate the SSO configuration")
+	}
+	if req.ProviderName != "" && req.ProviderName != config.ProviderName {
+		return nil, invalidSSOConfig("providerName cannot be changed")
+	}
+
+	var details map[string]string
+	if req.MetadataURL != "" || req.MetadataXML != "" || req.Issuer != "" || req.ClientID != "" || req.ClientSecret != "" || req.AuthorizeScopes != "" {
+		req.IDPType = config.IDPType
+		if details, err = applySSODetails(ctx, config, req, false); err != nil {
+			return nil, err
+		}
+	}
+	if req.AttributeMapping != nil {
+		config.AttributeMapping = req.AttributeMapping
+	}
+	var identifiers []string // Left unchanged at the provider when nil
+	if req.IdpIdentifiers != nil {
+		if err := s.requestIdpIdentifiers(ctx, config, req.IdpIdentifiers); err != nil {
+			return nil, err
+		}
+		identifiers = config.IdpIdentifiers
+	}
+
+	_, err = s.provider.UpdateIdentityProvider(ctx, authprovider.UpdateIdentityProviderRequestData{
+		ProviderName:     config.ProviderName,
+		ProviderDetails:  details,
+		AttributeMapping: req.AttributeMapping,
+		IdpIdentifiers:   identifiers,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update identity provider: %w", err)
+	}
+
+	if err := s.userRepository.SaveSSOProviderConfig(ctx, org, config); err != nil {
+		return nil, fmt.Errorf("failed to save SSO configuration: %w", err)
+	}
+	return config, nil
+}
+
+// VerifyOrgSSODomains activates the pending IdP identifiers of the organization whose DNS
+// verification record is published, so that their users are routed to the organization's IdP.
+// Domains without the record stay pending.
+func (s *AuthService) VerifyOrgSSODomains(ctx context.Context, caller *models.User, orgID uuid.UUID) (*models.SSOProviderConfig, error) {
+	org, err := s.adminOrganization(ctx, caller, orgID)
+	if err != nil {
+		return nil, err
+	}
+	config, err := s.userRepository.GetSSOProviderConfig(ctx, orgID)
+	if err != nil {
+		return nil, ErrSSOConfigNotFound
+	}
+
+	var pending []string
+	verified := append([]string{}, config.IdpIdentifiers...)
+	for _, domain := range config.PendingIdentifiers {
+		ok, err := s.domainVerifier.Verify(ctx, domain, config.VerificationToken)
+		if err != nil {
+			log.Printf("Verification of domain %s for organization %s failed: %v", domain, orgID, err)
+		}
+		if !ok {
+			pending = append(pending, domain)
+			continue
+		}
+		// Another organization may have verified the domain since it was requested
+		if err := s.checkIdentifierAvailable(ctx, orgID, domain); err != nil {
+			return nil, err
+		}
+		verified = append(verified, domain)
+	}
+	if len(verified) == len(config.IdpIdentifiers) {
+		return config, nil
+	}
+
+	_, err = s.provider.UpdateIdentityProvider(ctx, authprovider.UpdateIdentityProviderRequestData{
+		ProviderName:   config.ProviderName,
+		IdpIdentifiers: verified,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update identity provider: %w", err)
+	}
+	config.IdpIdentifiers, config.PendingIdentifiers = verified, pending
+	if err := s.userRepository.SaveSSOProviderConfig(ctx, org, config); err != nil {
+		return nil, fmt.Errorf("failed to save SSO configuration: %w", err)
+	}
+	return config, nil
+}
+
+// TestOrgSSOConfig checks that the IdP is registered with the auth provider and that its
+// metadata (SAML) or discovery document (OIDC) can be loaded. The result is recorded on the config.
+func (s *AuthService) TestOrgSSOConfig(ctx context.Context, caller *models.User, orgID uuid.UUID) (*OrgSSOTestResult, error) {
+	org, err := s.adminOrganization(ctx, caller, orgID)
+	if err != nil {
+		return nil, err
+	}
+	config, err := s.userRepository.GetSSOProviderConfig(ctx, orgID)
+	if err != nil {
+		return nil, ErrSSOConfigNotFound
+	}
+
+	testErr := s.checkIdentityProvider(ctx, config)
+
+	result := &OrgSSOTestResult{Success: testErr == nil, TestedAt: time.Now()}
+	config.LastTestedAt = &result.TestedAt
+	config.LastTestError = ""
+	if testErr != nil {
+		// The raw error can describe internal hosts and ports, so only a generic reason is returned
+		log.Printf("SSO test of identity provider %s failed: %v", config.ProviderName, testErr)
+		result.Error = ssoTestFailure(testErr)
+		config.LastTestError = result.Error
+	}
+
+	if err := s.userRepository.SaveSSOProviderConfig(ctx, org, config); err != nil {
+		return nil, fmt.Errorf("failed to record SSO test result: %w", err)
+	}
+	return result, nil
+}
+
+// DeleteOrgSSOConfig removes the organization's IdP from the auth provider and the database.
+func (s *AuthService) DeleteOrgSSOConfig(ctx context.Context, caller *models.User, orgID uuid.UUID) error {
+	org, err := s.adminOrganization(ctx, caller, orgID)
+	if err != nil {
+		return err
+	}
+	config, err := s.userRepository.GetSSOProviderConfig(ctx, orgID)
+	if err != nil {
+		return ErrSSOConfigNotFound
+	}
+
+	if err := s.provider.DeleteIdentityProvider(ctx, config.ProviderName); err != nil {
+		if !errors.Is(err, authprovider.ErrNotFound) {
+			return fmt.Errorf("failed to delete identity provider: %w", err)
+		}
+	}
+
+	if err := s.userRepository.DeleteSSOProviderConfig(ctx, org, config); err != nil {
+		return fmt.Errorf("failed to delete SSO configuration: %w", err)
+	}
+	return nil
+}
+
+// adminOrganization loads the organization after checking that caller administers it.
+func (s *AuthService) adminOrganization(ctx context.Context, caller *models.User, orgID uuid.UUID) (*models.Organization, error) {
+	if caller == nil {
+		return nil, apperrors.ErrUnauthorized
+	}
+	if !caller.IsOrgAdmin(orgID) {
+		return nil, apperrors.ErrForbidden
+	}
+
+	org, err := s.userRepository.GetOrganizationByID(ctx, orgID)
+	if err != nil {
+		return nil, apperrors.ErrOrgNotFound
+	}
+	return org, nil
+}
+
+// errIdPNotRegistered is returned by checkIdentityProvider when the auth provider does not know the IdP
+var errIdPNotRegistered = errors.New("identity provider is not registered")
+
+// checkIdentityProvider verifies the IdP registration and the IdP's published metadata.
+func (s *AuthService) checkIdentityProvider(ctx context.Context, config *models.SSOProviderConfig) error {
+	if _, err := s.provider.DescribeIdentityProvider(ctx, config.ProviderName); err != nil {
+		return fmt.Errorf("%w: %s: %v", errIdPNotRegistered, config.ProviderName, err)
+	}
+
+	switch config.IDPType {
+	case models.IDPTypeSAML:
+		if config.MetadataXML != "" {
+			return sso.CheckSAMLMetadata([]byte(config.MetadataXML))
+		}
+		return sso.FetchSAMLMetadata(ctx, s.httpClient, config.MetadataURL)
+	case models.IDPTypeOIDC:
+		return sso.CheckOIDCIssuer(ctx, s.httpClient, config.Issuer)
+	}
+	return nil
+}
+
+// ssoTestFailure returns the reason shown for a failed SSO test.
+func ssoTestFailure(err error) string {
+	switch {
+	case errors.Is(err, errIdPNotRegistered):
+		return "Identity provider is not registered with the auth provider"
+	case errors.Is(err, sso.ErrUnsafeURL):
+		return "Identity provider URL must be https and publicly routable"
+	}
+	return "Identity provider metadata could not be loaded or is invalid"
+}
+
+// validateIdpIdentifiers checks that IdP identifiers are email domains.
+func validateIdpIdentifiers(identifiers []string) error {
+	for _, identifier := range identifiers {
+		if !sso.ValidDomain(identifier) {
+			return invalidSSOConfig("idpIdentifiers must be domain names, got %q", identifier)
+		}
+	}
+	return nil
+}
+
+// requestIdpIdentifiers replaces the IdP identifiers of config with the requested domains.
+// Domains that were verified before stay active; the others wait for VerifyOrgSSODomains.
+// Domains another organization holds are rejected.
+func (s *AuthService) requestIdpIdentifiers(ctx context.Context, config *models.SSOProviderConfig, requested []string) error {
+	if err := validateIdpIdentifiers(requested); err != nil {
+		return err
+	}
+
+	active, pending := []string{}, []string{}
+	for _, domain := range requested {
+		domain = strings.ToLower(domain)
+		if slices.Contains(active, domain) || slices.Contains(pending, domain) {
+			continue
+		}
+		if err := s.checkIdentifierAvailable(ctx, config.OrgID, domain); err != nil {
+			return err
+		}
+		if slices.Contains(config.IdpIdentifiers, domain) {
+			active = append(active, domain)
+		} else {
+			pending = append(pending, domain)
+		}
+	}
+	config.IdpIdentifiers, config.PendingIdentifiers = active, pending
+
+	if config.VerificationToken == "" {
+		token := make([]byte, 16)
+		if _, err := rand.Read(token); err != nil {
+			return fmt.Errorf("failed to generate domain verification token: %w", err)
+		}
+		config.VerificationToken = hex.EncodeToString(token)
+	}
+	return nil
+}
+
+// checkIdentifierAvailable fails when domain routes to the IdP of an organization other than orgID.
+func (s *AuthService) checkIdentifierAvailable(ctx context.Context, orgID uuid.UUID, domain string) error {
+	configs, err := s.userRepository.GetSSOProviderConfigsByIdentifier(ctx, domain)
+	if err != nil {
+		return fmt.Errorf("failed to look up IdP identifier %s: %w", domain, err)
+	}
+	for _, other := range configs {
+		if other.OrgID != orgID {
+			return identifierTaken(domain)
+		}
+	}
+	return nil
+}
+
+// applySSODetails validates the request, copies its IdP details onto config and returns
+// the provider details expected by Cognito.
+// Docs: https://docs.aws.amazon.com/cognito-user-identity-pools/latest/APIReference/API_CreateIdentityProvider.html#CognitoUserPools-CreateIdentityProvider-request-ProviderDetails
+func applySSODetails(ctx context.Context, config *models.SSOProviderConfig, req OrgSSOConfigRequest, create bool) (map[string]string, error) {
+	config.IDPType = req.IDPType
+
+	switch req.IDPType {
+	case models.IDPTypeSAML:
+		if req.MetadataURL != "" && req.MetadataXML != "" {
+			return nil, invalidSSOConfig("provide either metadataUrl or metadataXml, not both")
+		}
+		if req.MetadataURL == "" && req.MetadataXML == "" {
+			return nil, invalidSSOConfig("metadataUrl or metadataXml is required for SAML")
+		}
+		if req.MetadataXML != "" {
+			if err := sso.CheckSAMLMetadata([]byte(req.MetadataXML)); err != nil {
+				return nil, invalidSSOConfig("%v", err)
+			}
+			config.MetadataXML, config.MetadataURL = req.MetadataXML, ""
+			return map[string]string{"MetadataFile": req.MetadataXML}, nil
+		}
+		if err := sso.CheckPublicURL(ctx, req.MetadataURL); err != nil {
+			return nil, invalidSSOConfig("metadataUrl must be an https URL of a public host")
+		}
+		config.MetadataURL, config.MetadataXML = req.MetadataURL, ""
+		return map[string]string{"MetadataURL": req.MetadataURL}, nil
+
+	case models.IDPTypeOIDC:
+		if req.Issuer != "" {
+			if err := sso.CheckPublicURL(ctx, req.Issuer); err != nil {
+				return nil, invalidSSOConfig("issuer must be an https URL of a public host")
+			}
+			config.Issuer = req.Issuer
+		}
+		if req.ClientID != "" {
+			config.ClientID = req.ClientID
+		}
+		if req.AuthorizeScopes != "" {
+			config.AuthorizeScopes = req.AuthorizeScopes
+		}
+		if config.AuthorizeScopes == "" {
+			config.AuthorizeScopes = "openid email profile"
+		}
+		if config.Issuer == "" || config.ClientID == "" {
+			return nil, invalidSSOConfig("issuer and clientId are required for OIDC")
+		}
+		// Cognito replaces provider details as a whole, so the secret is needed on every change
+		if req.ClientSecret == "" {
+			if create {
+				return nil, invalidSSOConfig("clientSecret is required for OIDC")
+			}
+			return nil, invalidSSOConfig("clientSecret is required when changing OIDC details")
+		}
+		return map[string]string{
+			"client_id":                 config.ClientID,
+			"client_secret":             req.ClientSecret,
+			"authorize_scopes":          config.AuthorizeScopes,
+			"oidc_issuer":               config.Issuer,
+			"attributes_request_method": "GET",
+		}, nil
+	}
+
+	return nil, invalidSSOConfig("idpType must be %s or %s", models.IDPTypeSAML, models.IDPTypeOIDC)
+}
+
+var (
+	providerNameChars   = regexp.MustCompile(`[^A-Za-z0-9-]`)
+	providerNamePattern = regexp.MustCompile(`^[^_\s][^_\s]{1,30}[^_\s]$`)
+)
+
+// defaultProviderName derives a Cognito provider name (max 32 characters) from the organization name.
+func defaultProviderName(orgName string, idpType models.IDPType) string {
+	name := providerNameChars.ReplaceAllString(orgName, "")
+	suffix := strings.ToUpper(string(idpType))
+	if max := 32 - len(suffix); len(name) > max {
+		name = name[:max]
+	}
+	return name + suffix
+}
+
+func validProviderName(name string) bool {
+	return providerNamePattern.MatchString(name)
+}
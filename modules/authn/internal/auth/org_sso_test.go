@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	appconfig "shield/cmd/app/config"
+	authprovider "shield/modules/authn/internal/auth/provider"
+	"shield/modules/authn/internal/auth/sso"
+	"shield/modules/authn/internal/models"
+	"shield/modules/authn/internal/repository"
+	apperrors "shield/modules/common/errors"
+
+	"github.com/google/uuid"
+)
+
+// ssoConfigs holds one organization and its SSO configuration; claimed maps domains to the
+// organizations whose IdP they route to, besides the configuration's own identifiers
+type ssoConfigs struct {
+	repository.UserRepository
+	org     *models.Organization
+	config  *models.SSOProviderConfig
+	claimed map[string]uuid.UUID
+}
+
+func (r *ssoConfigs) GetSSOProviderConfigsByIdentifier(_ context.Context, identifier string) ([]*models.SSOProviderConfig, error) {
+	var configs []*models.SSOProviderConfig
+	if orgID, ok := r.claimed[identifier]; ok {
+		configs = append(configs, &models.SSOProviderConfig{OrgID: orgID, IdpIdentifiers: []string{identifier}})
+	}
+	if r.config != nil && slices.Contains(r.config.IdpIdentifiers, identifier) {
+		configs = append(configs, r.config)
+	}
+	return configs, nil
+}
+
+func (r *ssoConfigs) GetOrganizationByID(context.Context, uuid.UUID) (*models.Organization, error) {
+	return r.org, nil
+}
+
+func (r *ssoConfigs) GetSSOProviderConfig(context.Context, uuid.UUID) (*models.SSOProviderConfig, error) {
+	if r.config == nil {
+		return nil, errors.New("record not found")
+	}
+	return r.config, nil
+}
+
+func (r *ssoConfigs) SaveSSOProviderConfig(_ context.Context, _ *models.Organization, config *models.SSOProviderConfig) error {
+	r.config = config
+	return nil
+}
+
+// registeredIdPs accepts every identity provider operation and records the IdP identifiers it was given
+type registeredIdPs struct {
+	authprovider.AuthProvider
+	created     int
+	identifiers []string
+}
+
+func (p *registeredIdPs) CreateIdentityProvider(_ context.Context, req authprovider.CreateIdentityProviderRequestData) (*authprovider.CreateIdentityProviderOutputData, error) {
+	p.created++
+	p.identifiers = req.IdpIdentifiers
+	return &authprovider.CreateIdentityProviderOutputData{}, nil
+}
+
+func (p *registeredIdPs) UpdateIdentityProvider(_ context.Context, req authprovider.UpdateIdentityProviderRequestData) (*authprovider.UpdateIdentityProviderOutputData, error) {
+	if req.IdpIdentifiers != nil {
+		p.identifiers = req.IdpIdentifiers
+	}
+	return &authprovider.UpdateIdentityProviderOutputData{}, nil
+}
+
+func (p *registeredIdPs) DescribeIdentityProvider(context.Context, string) (*authprovider.DescribeIdentityProviderOutputData, error) {
+	return &authprovider.DescribeIdentityProviderOutputData{}, nil
+}
+
+func TestCreateOrgSSOConfigRejectsUnsafeInput(t *testing.T) {
+	org := &models.Organization{ID: uuid.New(), Name: "Acme"}
+	admin := &models.User{ID: uuid.New(), OrgID: org.ID, UserType: models.UserTypeOrgAdmin}
+
+	tests := []struct {
+		name string
+		req  OrgSSOConfigRequest
+	}{
+		{"http metadata URL", OrgSSOConfigRequest{IDPType: models.IDPTypeSAML, MetadataURL: "http://93.184.216.34/metadata"}},
+		{"private metadata host", OrgSSOConfigRequest{IDPType: models.IDPTypeSAML, MetadataURL: "https://10.0.0.5/metadata"}},
+		{"link-local issuer", OrgSSOConfigRequest{IDPType: models.IDPTypeOIDC, Issuer: "https://169.254.169.254", ClientID: "c", ClientSecret: "s"}},
+		{"identifier is not a domain", OrgSSOConfigRequest{IDPType: models.IDPTypeSAML, MetadataURL: "https://93.184.216.34/metadata", IdpIdentifiers: []string{"user@acme.com"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &registeredIdPs{}
+			svc := NewAuthService(provider, &appconfig.Config{}, &ssoConfigs{org: org}, nil, nil)
+
+			_, err := svc.CreateOrgSSOConfig(context.Background(), admin, org.ID, tt.req)
+			var appErr *apperrors.AppError
+			if !errors.As(err, &appErr) || appErr.Code != "INVALID_SSO_CONFIG" || provider.created != 0 {
+				t.Errorf("CreateOrgSSOConfig() error = %v, identity providers created = %d; want INVALID_SSO_CONFIG and none", err, provider.created)
+			}
+		})
+	}
+}
+
+func TestOrgSSOConfigTestHidesErrors(t *testing.T) {
+	org := &models.Organization{ID: uuid.New(), Name: "Acme"}
+	admin := &models.User{ID: uuid.New(), OrgID: org.ID, UserType: models.UserTypeOrgAdmin}
+	// Saved before URLs were checked, or resolving to a different address now
+	repo := &ssoConfigs{org: org, config: &models.SSOProviderConfig{
+		OrgID: org.ID, ProviderName: "acme-saml", IDPType: models.IDPTypeSAML, MetadataURL: "https://127.0.0.1:6379/metadata",
+	}}
+	svc := NewAuthService(&registeredIdPs{}, &appconfig.Config{}, repo, nil, nil)
+
+	result, err := svc.TestOrgSSOConfig(context.Background(), admin, org.ID)
+	if err != nil {
+		t.Fatalf("TestOrgSSOConfig() error = %v", err)
+	}
+	if result.Success || result.Error == "" {
+		t.Fatalf("TestOrgSSOConfig() = %+v, want a failure", result)
+	}
+	if strings.Contains(result.Error, "127.0.0.1") || strings.Contains(result.Error, "6379") || repo.config.LastTestError != result.Error {
+		t.Errorf("TestOrgSSOConfig() error %q, recorded %q; want the same generic reason", result.Error, repo.config.LastTestError)
+	}
+}
+
+func TestOrgSSODomainVerification(t *testing.T) {
+	ctx := context.Background()
+	org := &models.Organization{ID: uuid.New(), Name: "Acme"}
+	admin := &models.User{ID: uuid.New(), OrgID: org.ID, UserType: models.UserTypeOrgAdmin}
+	provider := &registeredIdPs{}
+	repo := &ssoConfigs{org: org, claimed: map[string]uuid.UUID{"globex.com": uuid.New()}}
+	svc := NewAuthService(provider, &appconfig.Config{}, repo, nil, nil)
+	published := map[string]string{}
+	svc.domainVerifier = sso.NewDomainVerifier(func(_ context.Context, name string) ([]string, error) {
+		return []string{published[name]}, nil
+	})
+	saml := func(identifiers ...string) OrgSSOConfigRequest {
+		return OrgSSOConfigRequest{IDPType: models.IDPTypeSAML, MetadataURL: "https://93.184.216.34/metadata", IdpIdentifiers: identifiers}
+	}
+
+	// Domains routed to another organization's IdP cannot be requested
+	_, err := svc.CreateOrgSSOConfig(ctx, admin, org.ID, saml("acme.com", "Globex.com"))
+	var appErr *apperrors.AppError
+	if !errors.As(err, &appErr) || appErr.Code != "IDP_IDENTIFIER_TAKEN" || provider.created != 0 {
+		t.Fatalf("CreateOrgSSOConfig(taken domain) error = %v, want IDP_IDENTIFIER_TAKEN", err)
+	}
+
+	// Requested domains wait for verification
+	config, err := svc.CreateOrgSSOConfig(ctx, admin, org.ID, saml("acme.com", "eu.acme.com"))
+	if err != nil {
+		t.Fatalf("CreateOrgSSOConfig() error = %v", err)
+	}
+	if len(config.IdpIdentifiers) != 0 || !slices.Equal(config.PendingIdentifiers, []string{"acme.com", "eu.acme.com"}) || len(provider.identifiers) != 0 || config.VerificationToken == "" {
+		t.Fatalf("CreateOrgSSOConfig() identifiers %v, pending %v, at the provider %v; want all pending with a token", config.IdpIdentifiers, config.PendingIdentifiers, provider.identifiers)
+	}
+
+	// Only the domain publishing the token's record is activated
+	name, value := sso.VerificationRecord("acme.com", config.VerificationToken)
+	published[name] = value
+	otherName, _ := sso.VerificationRecord("eu.acme.com", config.VerificationToken)
+	published[otherName] = "shield-domain-verification=another-token"
+	config, err = svc.VerifyOrgSSODomains(ctx, admin, org.ID)
+	if err != nil {
+		t.Fatalf("VerifyOrgSSODomains() error = %v", err)
+	}
+	if !slices.Equal(config.IdpIdentifiers, []string{"acme.com"}) || !slices.Equal(config.PendingIdentifiers, []string{"eu.acme.com"}) || !slices.Equal(provider.identifiers, []string{"acme.com"}) {
+		t.Errorf("after verification identifiers %v, pending %v, at the provider %v; want acme.com active", config.IdpIdentifiers, config.PendingIdentifiers, provider.identifiers)
+	}
+
+	// Updates keep verified domains active
+	config, err = svc.UpdateOrgSSOConfig(ctx, admin, org.ID, OrgSSOConfigRequest{IdpIdentifiers: []string{"ACME.com", "acme.org"}})
+	if err != nil {
+		t.Fatalf("UpdateOrgSSOConfig() error = %v", err)
+	}
+	if !slices.Equal(config.IdpIdentifiers, []string{"acme.com"}) || !slices.Equal(config.PendingIdentifiers, []string{"acme.org"}) || !slices.Equal(provider.identifiers, []string{"acme.com"}) {
+		t.Errorf("after update identifiers %v, pending %v, at the provider %v; want acme.com active and acme.org pending", config.IdpIdentifiers, config.PendingIdentifiers, provider.identifiers)
+	}
+
+	// A domain verified by another organization in the meantime is not activated
+	repo.claimed["acme.org"] = uuid.New()
+	name, value = sso.VerificationRecord("acme.org", config.VerificationToken)
+	published[name] = value
+	if _, err := svc.VerifyOrgSSODomains(ctx, admin, org.ID); !errors.As(err, &appErr) || appErr.Code != "IDP_IDENTIFIER_TAKEN" {
+		t.Errorf("VerifyOrgSSODomains(domain taken meanwhile) error = %v, want IDP_IDENTIFIER_TAKEN", err)
+	}
+}
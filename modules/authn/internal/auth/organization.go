@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"shield/modules/authn/internal/models"
+	apperrors "shield/modules/common/errors"
+
+	"github.com/google/uuid"
+)
+
+var ErrOrgNameTaken = apperrors.NewAppError("ORG_NAME_TAKEN", "Organization name is already in use", http.StatusConflict)
+
+// UpdateOrgRequest contains the organization fields to change. Nil fields are left unchanged.
+// SSO settings are managed through the SSO configuration API.
+type UpdateOrgRequest struct {
+	Name        *string
+	CallbackURL *string
+	MFAEngine   *models.MFAEngine
+}
+
+// GetOrganization returns the organization if the caller is one of its members.
+func (s *AuthService) GetOrganization(ctx context.Context, caller *models.User, orgID uuid.UUID) (*models.Organization, error) {
+	if caller == nil {
+		return nil, apperrors.ErrUnauthorized
+	}
+	if caller.OrgID != orgID {
+		return nil, apperrors.ErrForbidden
+	}
+
+	org, err := s.userRepository.GetOrganizationByID(ctx, orgID)
+	if err != nil {
+		// Soft-deleted organizations are excluded by the repository
+		return nil, apperrors.ErrOrgNotFound
+	}
+	return org, nil
+}
+
+// UpdateOrganization applies a partial update. Only org admins may update their organization.
+func (s *AuthService) UpdateOrganization(ctx context.Context, caller *models.User, orgID uuid.UUID, req UpdateOrgRequest) (*models.Organization, error) {
+	org, err := s.adminOrganization(ctx, caller, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			return nil, apperrors.NewAppError("INVALID_ORG", "Organization name cannot be empty", http.StatusBadRequest)
+		}
+		if name != org.Name {
+			if existing, err := s.userRepository.GetOrganizationByName(ctx, name); err == nil && existing.ID != org.ID {
+				return nil, ErrOrgNameTaken
+			}
+		}
+		org.Name = name
+	}
+	if req.CallbackURL != nil {
+		org.CallbackURL = *req.CallbackURL
+	}
+	if req.MFAEngine != nil {
+		switch *req.MFAEngine {
+		case "", models.MFAEngineProvider, models.MFAEngineLocal:
+			org.MFAEngine = *req.MFAEngine
+		default:
+			return nil, apperrors.NewAppError("INVALID_ORG", fmt.Sprintf("Unknown MFA engine %q", *req.MFAEngine), http.StatusBadRequest)
+		}
+	}
+
+	if err := s.userRepository.UpdateOrganization(ctx, org); err != nil {
+		return nil, fmt.Errorf("failed to update organization: %w", err)
+	}
+	return org, nil
+}
+
+// DeleteOrganization soft deletes the organization. Only org admins may delete their organization.
+func (s *AuthService) DeleteOrganization(ctx context.Context, caller *models.User, orgID uuid.UUID) error {
+	if _, err := s.adminOrganization(ctx, caller, orgID); err != nil {
+		return err
+	}
+
+	if err := s.userRepository.DeleteOrganization(ctx, orgID); err != nil {
+		return fmt.Errorf("failed to delete organization: %w", err)
+	}
+	return nil
+}
+
+// RestoreOrganization restores a soft-deleted organization. Only org admins may restore their organization.
+func (s *AuthService) RestoreOrganization(ctx context.Context, caller *models.User, orgID uuid.UUID) (*models.Organization, error) {
+	if caller == nil {
+		return nil, apperrors.ErrUnauthorized
+	}
+	if !caller.IsOrgAdmin(orgID) {
+		return nil, apperrors.ErrForbidden
+	}
+
+	org, err := s.userRepository.GetDeletedOrganizationByID(ctx, orgID)
+	if err != nil {
+		return nil, apperrors.ErrOrgNotFound
+	}
+
+	if err := s.userRepository.RestoreOrganization(ctx, org.ID); err != nil {
+		return nil, fmt.Errorf("failed to restore organization: %w", err)
+	}
+	org.DeletedAt.Valid = false
+	return org, nil
+}
@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	appconfig "shield/cmd/app/config"
+	"shield/modules/authn/internal/models"
+	"shield/modules/authn/internal/repository"
+	apperrors "shield/modules/common/errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// memoryOrgs keeps organizations in memory, hiding soft-deleted ones like the Gorm repository
+type memoryOrgs struct {
+	repository.UserRepository
+	orgs map[uuid.UUID]*models.Organization
+}
+
+func newMemoryOrgs(orgs ...*models.Organization) *memoryOrgs {
+	r := &memoryOrgs{orgs: make(map[uuid.UUID]*models.Organization)}
+	for _, org := range orgs {
+		r.orgs[org.ID] = org
+	}
+	return r
+}
+
+func (r *memoryOrgs) GetOrganizationByID(_ context.Context, id uuid.UUID) (*models.Organization, error) {
+	if org, ok := r.orgs[id]; ok && !org.DeletedAt.Valid {
+		copied := *org
+		return &copied, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *memoryOrgs) GetOrganizationByName(_ context.Context, name string) (*models.Organization, error) {
+	for _, org := range r.orgs {
+		if org.Name == name && !org.DeletedAt.Valid {
+			copied := *org
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *memoryOrgs) UpdateOrganization(_ context.Context, org *models.Organization) error {
+	copied := *org
+	r.orgs[org.ID] = &copied
+	return nil
+}
+
+func (r *memoryOrgs) DeleteOrganization(_ context.Context, id uuid.UUID) error {
+	r.orgs[id].DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	return nil
+}
+
+func (r *memoryOrgs) GetDeletedOrganizationByID(_ context.Context, id uuid.UUID) (*models.Organization, error) {
+	if org, ok := r.orgs[id]; ok && org.DeletedAt.Valid {
+		copied := *org
+		return &copied, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *memoryOrgs) RestoreOrganization(_ context.Context, id uuid.UUID) error {
+	r.orgs[id].DeletedAt = gorm.DeletedAt{}
+	return nil
+}
+
+func TestOrganizationAccess(t *testing.T) {
+	org := &models.Organization{ID: uuid.New(), Name: "Acme"}
+	admin := &models.User{ID: uuid.New(), OrgID: org.ID, UserType: models.UserTypeOrgAdmin}
+	member := &models.User{ID: uuid.New(), OrgID: org.ID, UserType: models.UserTypeOrganization}
+	outsider := &models.User{ID: uuid.New(), OrgID: uuid.New(), UserType: models.UserTypeOrgAdmin}
+	name := "Acme Corp"
+
+	calls := map[string]func(svc *AuthService, caller *models.User) error{
+		"get": func(svc *AuthService, caller *models.User) error {
+			_, err := svc.GetOrganization(context.Background(), caller, org.ID)
+			return err
+		},
+		"update": func(svc *AuthService, caller *models.User) error {
+			_, err := svc.UpdateOrganization(context.Background(), caller, org.ID, UpdateOrgRequest{Name: &name})
+			return err
+		},
+		"delete": func(svc *AuthService, caller *models.User) error {
+			return svc.DeleteOrganization(context.Background(), caller, org.ID)
+		},
+		"restore": func(svc *AuthService, caller *models.User) error {
+			_, err := svc.RestoreOrganization(context.Background(), caller, org.ID)
+			return err
+		},
+	}
+
+	tests := []struct {
+		call   string
+		as     string
+		caller *models.User
+		want   error
+	}{
+		{"get", "anonymous", nil, apperrors.ErrUnauthorized},
+		{"get", "non-member", outsider, apperrors.ErrForbidden},
+		{"get", "member", member, nil},
+		{"update", "anonymous", nil, apperrors.ErrUnauthorized},
+		{"update", "non-member", outsider, apperrors.ErrForbidden},
+		{"update", "member", member, apperrors.ErrForbidden},
+		{"update", "admin", admin, nil},
+		{"delete", "non-member", outsider, apperrors.ErrForbidden},
+		{"delete", "member", member, apperrors.ErrForbidden},
+		{"delete", "admin", admin, nil},
+		{"restore", "non-member", outsider, apperrors.ErrForbidden},
+		{"restore", "member", member, apperrors.ErrForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.call+" as "+tt.as, func(t *testing.T) {
+			copied := *org
+			svc := NewAuthService(nil, &appconfig.Config{}, newMemoryOrgs(&copied), nil, nil)
+			if err := calls[tt.call](svc, tt.caller); !errors.Is(err, tt.want) {
+				t.Errorf("%s error = %v, want %v", tt.call, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateOrganization(t *testing.T) {
+	ctx := context.Background()
+	org := &models.Organization{ID: uuid.New(), Name: "Acme"}
+	other := &models.Organization{ID: uuid.New(), Name: "Globex"}
+	admin := &models.User{ID: uuid.New(), OrgID: org.ID, UserType: models.UserTypeOrgAdmin}
+	repo := newMemoryOrgs(org, other)
+	svc := NewAuthService(nil, &appconfig.Config{}, repo, nil, nil)
+
+	taken := "Globex"
+	if _, err := svc.UpdateOrganization(ctx, admin, org.ID, UpdateOrgRequest{Name: &taken}); !errors.Is(err, ErrOrgNameTaken) {
+		t.Errorf("UpdateOrganization(taken name) error = %v, want ORG_NAME_TAKEN", err)
+	}
+
+	var appErr *apperrors.AppError
+	blank := "  "
+	if _, err := svc.UpdateOrganization(ctx, admin, org.ID, UpdateOrgRequest{Name: &blank}); !errors.As(err, &appErr) || appErr.Code != "INVALID_ORG" {
+		t.Errorf("UpdateOrganization(blank name) error = %v, want INVALID_ORG", err)
+	}
+	engine := models.MFAEngine("sms-gateway")
+	if _, err := svc.UpdateOrganization(ctx, admin, org.ID, UpdateOrgRequest{MFAEngine: &engine}); !errors.As(err, &appErr) || appErr.Code != "INVALID_ORG" {
+		t.Errorf("UpdateOrganization(unknown MFA engine) error = %v, want INVALID_ORG", err)
+	}
+
+	same, renamed, local := "Acme", " Acme Corp ", models.MFAEngineLocal
+	if _, err := svc.UpdateOrganization(ctx, admin, org.ID, UpdateOrgRequest{Name: &same}); err != nil {
+		t.Errorf("UpdateOrganization(unchanged name) error = %v", err)
+	}
+	updated, err := svc.UpdateOrganization(ctx, admin, org.ID, UpdateOrgRequest{Name: &renamed, MFAEngine: &local})
+	if err != nil {
+		t.Fatalf("UpdateOrganization() error = %v", err)
+	}
+	if updated.Name != "Acme Corp" || updated.MFAEngine != models.MFAEngineLocal || repo.orgs[org.ID].Name != "Acme Corp" {
+		t.Errorf("UpdateOrganization() = %+v, want the trimmed name and local MFA saved", updated)
+	}
+}
+
+func TestDeleteAndRestoreOrganization(t *testing.T) {
+	ctx := context.Background()
+	org := &models.Organization{ID: uuid.New(), Name: "Acme"}
+	admin := &models.User{ID: uuid.New(), OrgID: org.ID, UserType: models.UserTypeOrgAdmin}
+	svc := NewAuthService(nil, &appconfig.Config{}, newMemoryOrgs(org), nil, nil)
+
+	if _, err := svc.RestoreOrganization(ctx, admin, org.ID); !errors.Is(err, apperrors.ErrOrgNotFound) {
+		t.Errorf("RestoreOrganization(active org) error = %v, want ORG_NOT_FOUND", err)
+	}
+	if err := svc.DeleteOrganization(ctx, admin, org.ID); err != nil {
+		t.Fatalf("DeleteOrganization() error = %v", err)
+	}
+
+	// A deleted organization is gone for every operation except restore
+	if _, err := svc.GetOrganization(ctx, admin, org.ID); !errors.Is(err, apperrors.ErrOrgNotFound) {
+		t.Errorf("GetOrganization(deleted) error = %v, want ORG_NOT_FOUND", err)
+	}
+	name := "Acme Corp"
+	if _, err := svc.UpdateOrganization(ctx, admin, org.ID, UpdateOrgRequest{Name: &name}); !errors.Is(err, apperrors.ErrOrgNotFound) {
+		t.Errorf("UpdateOrganization(deleted) error = %v, want ORG_NOT_FOUND", err)
+	}
+	if err := svc.DeleteOrganization(ctx, admin, org.ID); !errors.Is(err, apperrors.ErrOrgNotFound) {
+		t.Errorf("DeleteOrganization(deleted) error = %v, want ORG_NOT_FOUND", err)
+	}
+
+	restored, err := svc.RestoreOrganization(ctx, admin, org.ID)
+	if err != nil {
+		t.Fatalf("RestoreOrganization() error = %v", err)
+	}
+	if restored.DeletedAt.Valid {
+		t.Error("RestoreOrganization() returned an organization still marked deleted")
+	}
+	if _, err := svc.GetOrganization(ctx, admin, org.ID); err != nil {
+		t.Errorf("GetOrganization(restored) error = %v", err)
+	}
+}
@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	authprovider "shield/modules/authn/internal/auth/provider"
+	"shield/modules/authn/internal/auth/session"
+	"shield/modules/authn/internal/models"
+	apperrors "shield/modules/common/errors"
+	"shield/modules/common/ratelimit"
+)
+
+// WithPasswordRateLimits limits forgot, reset and change password attempts per email and per client IP.
+func WithPasswordRateLimits(perEmail, perIP ratelimit.Limiter) Option {
+	return func(s *AuthService) {
+		s.passwordEmailLimit = perEmail
+		s.passwordIPLimit = perIP
+	}
+}
+
+// ResetPasswordRequest contains the reset code sent by ForgotPassword and the new password.
+type ResetPasswordRequest struct {
+	Email       string
+	Code        string
+	NewPassword string
+}
+
+// ChangePasswordRequest contains the current and new password of a signed-in user.
+type ChangePasswordRequest struct {
+	CurrentPassword string
+	NewPassword     string
+	AccessToken     string          // Provider access token of the caller, when authenticated by bearer token
+	Session         *models.Session // Session of the caller, when authenticated by session cookie
+}
+
+// ForgotPassword sends a password reset code to the user. Unknown emails are reported as
+// success, so the endpoint cannot be used to find out which emails have accounts.
+func (s *AuthService) ForgotPassword(ctx context.Context, email string, clientInfo session.ClientInfo) error {
+	if err := s.checkPasswordRateLimit(ctx, email, clientInfo.IPAddress); err != nil {
+		return err
+	}
+
+	_, err := s.provider.ForgotPassword(ctx, authprovider.ForgotPasswordRequestData{Username: email})
+	if err != nil && !errors.Is(err, authprovider.ErrUserNotFound) {
+		return providerError(err)
+	}
+	return nil
+}
+
+// ResetPassword sets a new password with a reset code and ends all of the user's sessions.
+// It returns the number of sessions that were ended.
+func (s *AuthService) ResetPassword(ctx context.Context, req ResetPasswordRequest, clientInfo session.ClientInfo) (int, error) {
+	if err := s.checkPasswordRateLimit(ctx, req.Email, clientInfo.IPAddress); err != nil {
+		return 0, err
+	}
+
+	err := s.provider.ConfirmForgotPassword(ctx, authprovider.ConfirmForgotPasswordRequestData{
+		Username:         req.Email,
+		ConfirmationCode: req.Code,
+		NewPassword:      req.NewPassword,
+	})
+	if errors.Is(err, authprovider.ErrUserNotFound) {
+		// Same answer as a wrong code, like ForgotPassword
+		return 0, apperrors.ErrCodeMismatch
+	}
+	if err != nil {
+		return 0, providerError(err)
+	}
+
+	// Whoever knew the old password may hold sessions; end them all
+	user, err := s.userRepository.GetUserByEmail(ctx, req.Email)
+	if err != nil {
+		log.Printf("Password reset for %s: user not found locally, no sessions ended: %v", req.Email, err)
+		return 0, nil
+	}
+	ended, err := s.LogoutEverywhere(ctx, user)
+	if err != nil {
+		return 0, fmt.Errorf("password was reset but sessions could not be ended: %w", err)
+	}
+	return ended, nil
+}
+
+// ChangePassword changes the caller's password after checking the current one.
+func (s *AuthService) ChangePassword(ctx context.Context, caller *models.User, req ChangePasswordRequest, clientInfo session.ClientInfo) error {
+	if err := s.checkPasswordRateLimit(ctx, caller.Email, clientInfo.IPAddress); err != nil {
+		return err
+	}
+
+	// The provider authorizes the change with the user's access token; cookie sessions obtain one
+	// with the provider refresh token stored on the session
+	accessToken := req.AccessToken
+	if accessToken == "" {
+		if req.Session == nil {
+			return apperrors.ErrUnauthorized
+		}
+		tokens, err := s.refreshProviderTokens(ctx, req.Session)
+		if err != nil {
+			return err
+		}
+		accessToken = tokens.AccessToken
+	}
+
+	err := s.provider.ChangePassword(ctx, authprovider.ChangePasswordRequestData{
+		AccessToken:      accessToken,
+		PreviousPassword: req.CurrentPassword,
+		ProposedPassword: req.NewPassword,
+	})
+	if errors.Is(err, authprovider.ErrNotAuthorized) {
+		return apperrors.ErrIncorrectPassword
+	}
+	if err != nil {
+		return providerError(err)
+	}
+	return nil
+}
+
+// checkPasswordRateLimit counts a password operation against the email and IP limits.
+// Limiter failures are logged and let the request through.
+func (s *AuthService) checkPasswordRateLimit(ctx context.Context, email, ip string) error {
+	checks := []struct {
+		limiter ratelimit.Limiter
+		key     string
+	}{
+		{s.passwordEmailLimit, "email:" + strings.ToLower(email)},
+		{s.passwordIPLimit, "ip:" + ip},
+	}
+
+	for _, check := range checks {
+		if check.limiter == nil {
+			continue
+		}
+		allowed, retryAfter, err := check.limiter.Allow(ctx, check.key)
+		if err != nil {
+			log.Printf("Password rate limit check failed: %v", err)
+			continue
+		}
+		if !allowed {
+			return &apperrors.RetryAfterError{AppError: apperrors.ErrRateLimitExceeded, RetryAfter: retryAfter}
+		}
+	}
+	return nil
+}
+
+// providerError maps provider errors that users can act on to application errors.
+func providerError(err error) error {
+	switch {
+	case errors.Is(err, authprovider.ErrCodeMismatch):
+		return apperrors.ErrCodeMismatch
+	case errors.Is(err, authprovider.ErrCodeExpired):
+		return apperrors.ErrCodeExpired
+	case errors.Is(err, authprovider.ErrLimitExceeded):
+		return apperrors.ErrAttemptLimitExceeded
+	case errors.Is(err, authprovider.ErrInvalidPassword):
+		return apperrors.ErrInvalidPassword
+	}
+	return err
+}
@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	appconfig "shield/cmd/app/config"
+	authprovider "shield/modules/authn/internal/auth/provider"
+	"shield/modules/authn/internal/auth/session"
+	"shield/modules/authn/internal/models"
+	"shield/modules/authn/internal/repository"
+	apperrors "shield/modules/common/errors"
+	"shield/modules/common/ratelimit"
+
+	"github.com/google/uuid"
+)
+
+// passwordProvider stubs the password operations of the auth provider
+type passwordProvider struct {
+	authprovider.AuthProvider
+	forgotErr    error
+	confirmErr   error
+	signedOut    []string
+	changeTokens []string
+}
+
+func (p *passwordProvider) ForgotPassword(context.Context, authprovider.ForgotPasswordRequestData) (*authprovider.ForgotPasswordOutputData, error) {
+	return &authprovider.ForgotPasswordOutputData{}, p.forgotErr
+}
+
+func (p *passwordProvider) ConfirmForgotPassword(context.Context, authprovider.ConfirmForgotPasswordRequestData) error {
+	return p.confirmErr
+}
+
+func (p *passwordProvider) ChangePassword(_ context.Context, req authprovider.ChangePasswordRequestData) error {
+	p.changeTokens = append(p.changeTokens, req.AccessToken)
+	return nil
+}
+
+func (p *passwordProvider) GlobalSignOut(_ context.Context, username string) error {
+	p.signedOut = append(p.signedOut, username)
+	return nil
+}
+
+// userByEmail resolves a single known user
+type userByEmail struct {
+	repository.UserRepository
+	user *models.User
+}
+
+func (r *userByEmail) GetUserByEmail(_ context.Context, email string) (*models.User, error) {
+	if r.user == nil || r.user.Email != email {
+		return nil, fmt.Errorf("user %s not found", email)
+	}
+	return r.user, nil
+}
+
+func (r *userByEmail) CreateUser(_ context.Context, user *models.User) error {
+	r.user = user
+	return nil
+}
+
+// endedSessions records which users had their sessions invalidated
+type endedSessions struct {
+	session.SessionManager
+	users []uuid.UUID
+}
+
+func (m *endedSessions) InvalidateUserSessions(_ context.Context, userID uuid.UUID) ([]*models.Session, error) {
+	m.users = append(m.users, userID)
+	return []*models.Session{{ID: "s1"}, {ID: "s2"}}, nil
+}
+
+func newPasswordTestService(provider *passwordProvider, user *models.User, sessions *endedSessions, opts ...Option) *AuthService {
+	return NewAuthService(provider, &appconfig.Config{}, &userByEmail{user: user}, sessions, nil, opts...)
+}
+
+func TestResetPassword(t *testing.T) {
+	user := &models.User{ID: uuid.New(), Email: "user@example.com", CognitoSub: "sub-1"}
+	ctx := context.Background()
+	req := ResetPasswordRequest{Email: user.Email, Code: "123456", NewPassword: "new-password"}
+
+	provider := &passwordProvider{}
+	sessions := &endedSessions{}
+	svc := newPasswordTestService(provider, user, sessions)
+
+	ended, err := svc.ResetPassword(ctx, req, session.ClientInfo{})
+	if err != nil {
+		t.Fatalf("ResetPassword() error = %v", err)
+	}
+	if ended != 2 || len(sessions.users) != 1 || sessions.users[0] != user.ID {
+		t.Errorf("ResetPassword() ended %d sessions of %v, want 2 of %s", ended, sessions.users, user.ID)
+	}
+	if len(provider.signedOut) != 1 || provider.signedOut[0] != "sub-1" {
+		t.Errorf("ResetPassword() signed out %v, want the user's provider tokens revoked", provider.signedOut)
+	}
+
+	tests := []struct {
+		name       string
+		confirmErr error
+		want       *apperrors.AppError
+	}{
+		{"wrong code", authprovider.ErrCodeMismatch, apperrors.ErrCodeMismatch},
+		{"expired code", authprovider.ErrCodeExpired, apperrors.ErrCodeExpired},
+		{"too many attempts", authprovider.ErrLimitExceeded, apperrors.ErrAttemptLimitExceeded},
+		{"weak password", authprovider.ErrInvalidPassword, apperrors.ErrInvalidPassword},
+		{"unknown user", authprovider.ErrUserNotFound, apperrors.ErrCodeMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessions := &endedSessions{}
+			svc := newPasswordTestService(&passwordProvider{confirmErr: fmt.Errorf("%w: cognito", tt.confirmErr)}, user, sessions)
+
+			_, err := svc.ResetPassword(ctx, req, session.ClientInfo{})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("ResetPassword() error = %v, want %s", err, tt.want.Code)
+			}
+			if len(sessions.users) != 0 {
+				t.Error("failed reset ended sessions")
+			}
+		})
+	}
+}
+
+func TestForgotPassword(t *testing.T) {
+	ctx := context.Background()
+
+	svc := newPasswordTestService(&passwordProvider{forgotErr: authprovider.ErrUserNotFound}, nil, &endedSessions{})
+	if err := svc.ForgotPassword(ctx, "nobody@example.com", session.ClientInfo{}); err != nil {
+		t.Errorf("ForgotPassword() for unknown email error = %v, want success", err)
+	}
+
+	perEmail := ratelimit.NewMemoryLimiter(ratelimit.Rule{Limit: 2, Window: time.Minute})
+	perIP := ratelimit.NewMemoryLimiter(ratelimit.Rule{Limit: 3, Window: time.Minute})
+	svc = newPasswordTestService(&passwordProvider{}, nil, &endedSessions{}, WithPasswordRateLimits(perEmail, perIP))
+
+	attempts := []struct {
+		email, ip string
+		wantErr   error
+	}{
+		{"a@example.com", "10.0.0.1", nil},
+		{"A@example.com", "10.0.0.2", nil},
+		{"a@example.com", "10.0.0.3", apperrors.ErrRateLimitExceeded}, // Third attempt for the email
+		{"b@example.com", "10.0.0.9", nil},
+		{"c@example.com", "10.0.0.9", nil},
+		{"d@example.com", "10.0.0.9", nil},
+		{"e@example.com", "10.0.0.9", apperrors.ErrRateLimitExceeded}, // Fourth attempt from the IP
+	}
+	for i, a := range attempts {
+		err := svc.ForgotPassword(ctx, a.email, session.ClientInfo{IPAddress: a.ip})
+		if !errors.Is(err, a.wantErr) {
+			t.Errorf("attempt %d (%s from %s) error = %v, want %v", i+1, a.email, a.ip, err, a.wantErr)
+		}
+	}
+}
+
+func TestChangePasswordNeedsProviderToken(t *testing.T) {
+	ctx := context.Background()
+	user := &models.User{ID: uuid.New(), Email: "user@example.com"}
+	provider := &passwordProvider{}
+	svc := newPasswordTestService(provider, user, &endedSessions{})
+
+	if err := svc.ChangePassword(ctx, user, ChangePasswordRequest{CurrentPassword: "old", NewPassword: "new-password"}, session.ClientInfo{}); !errors.Is(err, apperrors.ErrUnauthorized) {
+		t.Errorf("ChangePassword() without token or session error = %v, want ErrUnauthorized", err)
+	}
+
+	err := svc.ChangePassword(ctx, user, ChangePasswordRequest{CurrentPassword: "old", NewPassword: "new-password", AccessToken: "access"}, session.ClientInfo{})
+	if err != nil {
+		t.Fatalf("ChangePassword() error = %v", err)
+	}
+	if len(provider.changeTokens) != 1 || provider.changeTokens[0] != "access" {
+		t.Errorf("provider ChangePassword tokens = %v, want [access]", provider.changeTokens)
+	}
+}
@@ -0,0 +1,371 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"time"
+
+	"shield/modules/authn/internal/auth/policy"
+	"shield/modules/authn/internal/models"
+	apperrors "shield/modules/common/errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// MaxPolicySize bounds the size of an uploaded policy version
+const MaxPolicySize = 256 << 10
+
+var (
+	ErrPolicyNotFound       = apperrors.NewAppError("POLICY_NOT_FOUND", "Policy version not found", http.StatusNotFound)
+	ErrPolicyTestsFailed    = apperrors.NewAppError("POLICY_TESTS_FAILED", "Policy does not pass its fixtures", http.StatusUnprocessableEntity)
+	ErrPolicyChecksDisabled = apperrors.NewAppError("POLICY_CHECKS_DISABLED", "Policy validation is not enabled", http.StatusServiceUnavailable)
+	ErrInvalidRollback      = apperrors.NewAppError("INVALID_ROLLBACK", "Rollbacks must go back to a version older than the active one", http.StatusBadRequest)
+)
+
+// policyNamePattern restricts policy names to what can be used as module file names
+var policyNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// WithPolicyVersions enables uploading and activating policy versions, which are checked by
+// validator first. Policy versions also require WithApplications.
+func WithPolicyVersions(validator policy.Validator) Option {
+	return func(s *AuthService) {
+		s.policyValidator = validator
+	}
+}
+
+// WithPolicySync loads the active policies of applications into a policy engine that does not
+// read them from the database, e.g. a remote OPA server. Versions are published before they are
+// activated, so activations fail while the engine cannot be reached.
+func WithPolicySync(publisher policy.Publisher) Option {
+	return func(s *AuthService) {
+		s.policyPublisher = publisher
+	}
+}
+
+// UploadPolicyRequest contains a new version of an application policy and the fixtures it must pass
+type UploadPolicyRequest struct {
+	Name     string
+	Source   string
+	Fixtures []policy.Fixture
+}
+
+// PolicyDiff is the unified diff between two versions of a policy
+type PolicyDiff struct {
+	From int
+	To   int
+	Diff string // Empty when the versions are equal
+}
+
+// PolicyChanges is a page of the changes to an application's policies
+type PolicyChanges struct {
+	Changes  []models.PolicyChange
+	Page     int
+	PageSize int
+	Total    int64
+}
+
+// UploadPolicy saves a new, inactive version of an application policy. The version is compiled
+// together with the application's other active policies and must pass the fixtures; when it
+// does not, ErrPolicyTestsFailed is returned along with the results. Org admins only.
+func (s *AuthService) UploadPolicy(ctx context.Context, caller *models.User, appID uuid.UUID, req UploadPolicyRequest) (*models.OPAPolicy, []policy.FixtureResult, error) {
+	app, err := s.adminApplication(ctx, caller, appID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if s.policyValidator == nil {
+		return nil, nil, ErrPolicyChecksDisabled
+	}
+	if !policyNamePattern.MatchString(req.Name) {
+		return nil, nil, apperrors.NewAppError("INVALID_POLICY", "Policy names are 1 to 64 lowercase letters, digits, '_' or '-'", http.StatusBadRequest)
+	}
+	if req.Source == "" || len(req.Source) > MaxPolicySize {
+		return nil, nil, apperrors.NewAppError("INVALID_POLICY", fmt.Sprintf("Policies must have 1 to %d bytes", MaxPolicySize), http.StatusBadRequest)
+	}
+
+	candidate := &models.OPAPolicy{AppID: app.ID, Name: req.Name, RegoPolicy: req.Source}
+	results, err := s.validatePolicy(ctx, app, candidate, req.Fixtures)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !allPassed(results) {
+		return nil, results, ErrPolicyTestsFailed
+	}
+
+	if err := s.applications.CreatePolicyVersion(ctx, candidate, caller.ID); err != nil {
+		return nil, nil, fmt.Errorf("failed to save policy: %w", err)
+	}
+	return candidate, results, nil
+}
+
+// ListPolicyVersions returns the versions of an application policy, newest first. Org admins only.
+func (s *AuthService) ListPolicyVersions(ctx context.Context, caller *models.User, appID uuid.UUID, name string) ([]models.OPAPolicy, error) {
+	if _, err := s.adminApplication(ctx, caller, appID); err != nil {
+		return nil, err
+	}
+	versions, err := s.applications.ListPolicyVersions(ctx, appID, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list policy versions: %w", err)
+	}
+	if len(versions) == 0 {
+		return nil, ErrPolicyNotFound
+	}
+	return versions, nil
+}
+
+// GetPolicyVersion returns a version of an application policy. Org admins only.
+func (s *AuthService) GetPolicyVersion(ctx context.Context, caller *models.User, appID uuid.UUID, name string, version int) (*models.OPAPolicy, error) {
+	if _, err := s.adminApplication(ctx, caller, appID); err != nil {
+		return nil, err
+	}
+	return s.policyVersion(ctx, appID, name, version)
+}
+
+// TestPolicyVersion evaluates fixtures with a saved version of an application policy, compiled
+// together with the application's other active policies. Org admins only.
+func (s *AuthService) TestPolicyVersion(ctx context.Context, caller *models.User, appID uuid.UUID, name string, version int, fixtures []policy.Fixture) ([]policy.FixtureResult, error) {
+	app, err := s.adminApplication(ctx, caller, appID)
+	if err != nil {
+		return nil, err
+	}
+	if s.policyValidator == nil {
+		return nil, ErrPolicyChecksDisabled
+	}
+	candidate, err := s.policyVersion(ctx, appID, name, version)
+	if err != nil {
+		return nil, err
+	}
+	return s.validatePolicy(ctx, app, candidate, fixtures)
+}
+
+// DiffPolicyVersions returns the unified diff from one version of an application policy to
+// another. Org admins only.
+func (s *AuthService) DiffPolicyVersions(ctx context.Context, caller *models.User, appID uuid.UUID, name string, from, to int) (*PolicyDiff, error) {
+	if _, err := s.adminApplication(ctx, caller, appID); err != nil {
+		return nil, err
+	}
+	fromPolicy, err := s.policyVersion(ctx, appID, name, from)
+	if err != nil {
+		return nil, err
+	}
+	toPolicy, err := s.policyVersion(ctx, appID, name, to)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := policy.Diff(
+		fmt.Sprintf("%s@%d", name, from), fmt.Sprintf("%s@%d", name, to),
+		fromPolicy.RegoPolicy, toPolicy.RegoPolicy,
+	)
+	return &PolicyDiff{From: from, To: to, Diff: diff}, nil
+}
+
+// ActivatePolicyVersion makes a version of an application policy the one decisions are evaluated
+// with. The version is compiled again with the application's other active policies first.
+// Org admins only.
+func (s *AuthService) ActivatePolicyVersion(ctx context.Context, caller *models.User, appID uuid.UUID, name string, version int) (*models.PolicyChange, error) {
+	return s.activatePolicy(ctx, caller, appID, name, version, models.PolicyChangeActivate)
+}
+
+// RollbackPolicy activates a version of an application policy older than the active one.
+// Org admins only.
+func (s *AuthService) RollbackPolicy(ctx context.Context, caller *models.User, appID uuid.UUID, name string, version int) (*models.PolicyChange, error) {
+	return s.activatePolicy(ctx, caller, appID, name, version, models.PolicyChangeRollback)
+}
+
+// ListPolicyChanges returns a page of the uploads and activations of an application's policies,
+// newest first. Pages are numbered and sized like role holder listings. Org admins only.
+func (s *AuthService) ListPolicyChanges(ctx context.Context, caller *models.User, appID uuid.UUID, page, pageSize int) (*PolicyChanges, error) {
+	if _, err := s.adminApplication(ctx, caller, appID); err != nil {
+		return nil, err
+	}
+	page, pageSize = pageBounds(page, pageSize)
+
+	changes, total, err := s.applications.ListPolicyChanges(ctx, appID, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list policy changes: %w", err)
+	}
+	return &PolicyChanges{Changes: changes, Page: page, PageSize: pageSize, Total: total}, nil
+}
+
+func (s *AuthService) activatePolicy(ctx context.Context, caller *models.User, appID uuid.UUID, name string, version int, action string) (*models.PolicyChange, error) {
+	app, err := s.adminApplication(ctx, caller, appID)
+	if err != nil {
+		return nil, err
+	}
+	if s.policyValidator == nil {
+		return nil, ErrPolicyChecksDisabled
+	}
+	candidate, err := s.policyVersion(ctx, appID, name, version)
+	if err != nil {
+		return nil, err
+	}
+
+	if action == models.PolicyChangeRollback {
+		active, err := s.activePolicy(ctx, appID, name)
+		if err != nil {
+			return nil, err
+		}
+		if active == nil || active.Version <= version {
+			return nil, ErrInvalidRollback
+		}
+	}
+
+	// Policies compiled when uploaded may no longer compile with the other active policies
+	if _, err := s.validatePolicy(ctx, app, candidate, nil); err != nil {
+		return nil, err
+	}
+
+	if s.policyPublisher != nil {
+		policies, err := s.candidatePolicies(ctx, appID, candidate)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.publishPolicies(ctx, appID, policies); err != nil {
+			return nil, err
+		}
+	}
+
+	change := &models.PolicyChange{AppID: appID, PolicyName: name, Version: version, Action: action, ActorID: caller.ID}
+	if err := s.applications.ActivatePolicyVersion(ctx, change); err != nil {
+		// Publish the versions that stay active again
+		if s.policyPublisher != nil {
+			if active, activeErr := s.applications.ActivePolicies(ctx, appID); activeErr == nil {
+				_ = s.publishPolicies(ctx, appID, active)
+			}
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPolicyNotFound
+		}
+		return nil, fmt.Errorf("failed to activate policy: %w", err)
+	}
+	return change, nil
+}
+
+// SyncPolicies publishes the active policies of every application, e.g. to a policy engine that
+// started without them. It does nothing without WithPolicySync.
+func (s *AuthService) SyncPolicies(ctx context.Context) error {
+	if s.policyPublisher == nil || s.applications == nil {
+		return nil
+	}
+	active, err := s.applications.ListActivePolicies(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load active policies: %w", err)
+	}
+
+	var appIDs []uuid.UUID
+	byApp := make(map[uuid.UUID][]models.OPAPolicy)
+	for _, p := range active {
+		if _, ok := byApp[p.AppID]; !ok {
+			appIDs = append(appIDs, p.AppID)
+		}
+		byApp[p.AppID] = append(byApp[p.AppID], p)
+	}
+
+	var errs []error
+	for _, appID := range appIDs {
+		if err := s.publishPolicies(ctx, appID, byApp[appID]); err != nil {
+			errs = append(errs, fmt.Errorf("application %s: %w", appID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// publishPolicies loads the policies of an application into the policy engine and records the
+// highest of their versions as synced
+func (s *AuthService) publishPolicies(ctx context.Context, appID uuid.UUID, policies []models.OPAPolicy) error {
+	if err := s.policyPublisher.Publish(ctx, appID, policies); err != nil {
+		log.Printf("Publishing the policies of application %s failed: %v", appID, err)
+		return ErrPolicyUnavailable
+	}
+
+	status := &models.PolicySyncStatus{AppID: appID, SyncedAt: time.Now()}
+	for _, p := range policies {
+		status.Version = max(status.Version, p.Version)
+	}
+	if err := s.applications.SavePolicySyncStatus(ctx, status); err != nil {
+		log.Printf("Failed to record the policy sync of application %s: %v", appID, err)
+	}
+	return nil
+}
+
+// candidatePolicies returns the application's active policies with the candidate in place of
+// the active version of its name
+func (s *AuthService) candidatePolicies(ctx context.Context, appID uuid.UUID, candidate *models.OPAPolicy) ([]models.OPAPolicy, error) {
+	active, err := s.applications.ActivePolicies(ctx, appID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load active policies: %w", err)
+	}
+	policies := []models.OPAPolicy{*candidate}
+	for _, p := range active {
+		if p.Name != candidate.Name {
+			policies = append(policies, p)
+		}
+	}
+	return policies, nil
+}
+
+// validatePolicy compiles the candidate with the application's other active policies and
+// evaluates the fixtures with them
+func (s *AuthService) validatePolicy(ctx context.Context, app *models.Application, candidate *models.OPAPolicy, fixtures []policy.Fixture) ([]policy.FixtureResult, error) {
+	policies, err := s.candidatePolicies(ctx, app.ID, candidate)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fixtures without an application are evaluated for the policy's own
+	fixtures = slices.Clone(fixtures)
+	for i := range fixtures {
+		if fixtures[i].Input.Application.ID == "" {
+			fixtures[i].Input.Application = policy.Application{ID: app.ID.String(), Name: app.Name}
+		}
+	}
+
+	results, err := s.policyValidator.Validate(ctx, app.OPAEndpoint, policies, fixtures)
+	if errors.Is(err, policy.ErrInvalidPolicy) {
+		return nil, apperrors.NewAppError("INVALID_POLICY", err.Error(), http.StatusUnprocessableEntity)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate policy: %w", err)
+	}
+	return results, nil
+}
+
+func (s *AuthService) policyVersion(ctx context.Context, appID uuid.UUID, name string, version int) (*models.OPAPolicy, error) {
+	p, err := s.applications.GetPolicyVersion(ctx, appID, name, version)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrPolicyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load policy: %w", err)
+	}
+	return p, nil
+}
+
+// activePolicy returns the active version of an application policy, or nil when there is none
+func (s *AuthService) activePolicy(ctx context.Context, appID uuid.UUID, name string) (*models.OPAPolicy, error) {
+	active, err := s.applications.ActivePolicies(ctx, appID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load active policies: %w", err)
+	}
+	for i := range active {
+		if active[i].Name == name {
+			return &active[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func allPassed(results []policy.FixtureResult) bool {
+	for _, result := range results {
+		if !result.Passed {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,367 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	appconfig "shield/cmd/app/config"
+	"shield/modules/authn/internal/auth/policy"
+	"shield/modules/authn/internal/models"
+	apperrors "shield/modules/common/errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func (r *memoryApplications) ActivePolicies(_ context.Context, appID uuid.UUID) ([]models.OPAPolicy, error) {
+	var active []models.OPAPolicy
+	for _, p := range r.policies {
+		if p.AppID == appID && p.Active {
+			active = append(active, *p)
+		}
+	}
+	return active, nil
+}
+
+func (r *memoryApplications) ListPolicyVersions(_ context.Context, appID uuid.UUID, name string) ([]models.OPAPolicy, error) {
+	var versions []models.OPAPolicy
+	for _, p := range slices.Backward(r.policies) {
+		if p.AppID == appID && p.Name == name {
+			versions = append(versions, *p)
+		}
+	}
+	return versions, nil
+}
+
+func (r *memoryApplications) GetPolicyVersion(_ context.Context, appID uuid.UUID, name string, version int) (*models.OPAPolicy, error) {
+	for _, p := range r.policies {
+		if p.AppID == appID && p.Name == name && p.Version == version {
+			copied := *p
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *memoryApplications) CreatePolicyVersion(_ context.Context, p *models.OPAPolicy, actorID uuid.UUID) error {
+	latest, active := 0, 0
+	for _, other := range r.policies {
+		if other.AppID == p.AppID && other.Name == p.Name {
+			latest = max(latest, other.Version)
+			if other.Active {
+				active = other.Version
+			}
+		}
+	}
+	p.ID, p.Version, p.Active, p.CreatedBy = uuid.New(), latest+1, false, actorID
+	copied := *p
+	r.policies = append(r.policies, &copied)
+	r.changes = append(r.changes, models.PolicyChange{
+		ID: uuid.New(), AppID: p.AppID, PolicyName: p.Name, Version: p.Version,
+		PreviousVersion: active, Action: models.PolicyChangeUpload, ActorID: actorID,
+	})
+	return nil
+}
+
+func (r *memoryApplications) ActivatePolicyVersion(_ context.Context, change *models.PolicyChange) error {
+	var target *models.OPAPolicy
+	for _, p := range r.policies {
+		if p.AppID == change.AppID && p.Name == change.PolicyName {
+			if p.Active {
+				change.PreviousVersion = p.Version
+			}
+			if p.Version == change.Version {
+				target = p
+			}
+		}
+	}
+	if target == nil {
+		return gorm.ErrRecordNotFound
+	}
+	if target.Active {
+		return nil
+	}
+	for _, p := range r.policies {
+		if p.AppID == change.AppID && p.Name == change.PolicyName {
+			p.Active = p == target
+		}
+	}
+	change.ID = uuid.New()
+	r.changes = append(r.changes, *change)
+	return nil
+}
+
+func (r *memoryApplications) ListPolicyChanges(_ context.Context, appID uuid.UUID, offset, limit int) ([]models.PolicyChange, int64, error) {
+	var changes []models.PolicyChange
+	for _, change := range slices.Backward(r.changes) {
+		if change.AppID == appID {
+			changes = append(changes, change)
+		}
+	}
+	total := int64(len(changes))
+	changes = changes[min(offset, len(changes)):]
+	return changes[:min(limit, len(changes))], total, nil
+}
+
+func (r *memoryApplications) ListActivePolicies(_ context.Context) ([]models.OPAPolicy, error) {
+	var active []models.OPAPolicy
+	for _, p := range r.policies {
+		if p.Active {
+			active = append(active, *p)
+		}
+	}
+	return active, nil
+}
+
+func (r *memoryApplications) SavePolicySyncStatus(_ context.Context, status *models.PolicySyncStatus) error {
+	if r.synced == nil {
+		r.synced = map[uuid.UUID]models.PolicySyncStatus{}
+	}
+	r.synced[status.AppID] = *status
+	return nil
+}
+
+// recordingPublisher keeps the policies published per application, or fails with err
+type recordingPublisher struct {
+	published map[uuid.UUID][]models.OPAPolicy
+	err       error
+}
+
+func (p *recordingPublisher) Publish(_ context.Context, appID uuid.UUID, policies []models.OPAPolicy) error {
+	if p.err != nil {
+		return p.err
+	}
+	if p.published == nil {
+		p.published = map[uuid.UUID][]models.OPAPolicy{}
+	}
+	p.published[appID] = policies
+	return nil
+}
+
+// sourceValidator fails to compile sources containing "syntax error"; its decisions allow when
+// the first policy, the one validated, contains "allow". It records the policies it compiled.
+type sourceValidator struct {
+	compiled [][]models.OPAPolicy
+	fixtures []policy.Fixture
+}
+
+func (v *sourceValidator) Validate(_ context.Context, _ string, policies []models.OPAPolicy, fixtures []policy.Fixture) ([]policy.FixtureResult, error) {
+	v.compiled = append(v.compiled, policies)
+	v.fixtures = fixtures
+	for _, p := range policies {
+		if strings.Contains(p.RegoPolicy, "syntax error") {
+			return nil, policy.ErrInvalidPolicy
+		}
+	}
+	allow := strings.Contains(policies[0].RegoPolicy, "allow")
+	var results []policy.FixtureResult
+	for _, f := range fixtures {
+		results = append(results, policy.FixtureResult{Name: f.Name, Passed: f.Allow == allow, Decision: &policy.Decision{Allow: allow}})
+	}
+	return results, nil
+}
+
+func TestPolicyLifecycle(t *testing.T) {
+	ctx := context.Background()
+	orgID := uuid.New()
+	admin := &models.User{ID: uuid.New(), OrgID: orgID, UserType: models.UserTypeOrgAdmin}
+	otherAdmin := &models.User{ID: uuid.New(), OrgID: orgID, UserType: models.UserTypeOrgAdmin}
+	repo := newMemoryApplications()
+	app := &models.Application{ID: uuid.New(), OrgID: orgID, Name: "Demo", OPAEndpoint: "demo.authz", Status: models.ApplicationStatusActive}
+	repo.apps[app.ID] = app
+	validator := &sourceValidator{}
+	svc := NewAuthService(nil, &appconfig.Config{}, nil, nil, nil, WithApplications(repo), WithPolicyVersions(validator))
+
+	allowed := []policy.Fixture{{Name: "viewer reads reports", Input: policy.Input{Resource: "/api/reports", Action: "read"}, Allow: true}}
+	v1, results, err := svc.UploadPolicy(ctx, admin, app.ID, UploadPolicyRequest{Name: "main", Source: "package demo.authz\n\nallow := true\n", Fixtures: allowed})
+	if err != nil {
+		t.Fatalf("UploadPolicy() error = %v", err)
+	}
+	if v1.Version != 1 || v1.Active || v1.CreatedBy != admin.ID || len(results) != 1 || !results[0].Passed {
+		t.Errorf("UploadPolicy() = %+v with %+v, want inactive version 1 by the admin passing its fixture", v1, results)
+	}
+	if got := validator.fixtures[0].Input.Application; got.ID != app.ID.String() || got.Name != "Demo" {
+		t.Errorf("fixture evaluated for application %+v, want the policy's application", got)
+	}
+
+	t.Run("failing fixtures are not saved", func(t *testing.T) {
+		denied := []policy.Fixture{{Name: "viewer reads reports", Allow: true}}
+		_, results, err := svc.UploadPolicy(ctx, admin, app.ID, UploadPolicyRequest{Name: "main", Source: "package demo.authz\n\ndefault deny := true\n", Fixtures: denied})
+		if !errors.Is(err, ErrPolicyTestsFailed) || len(results) != 1 || results[0].Passed {
+			t.Errorf("UploadPolicy() = %+v, %v; want ErrPolicyTestsFailed with the failing result", results, err)
+		}
+	})
+	t.Run("invalid policies are not saved", func(t *testing.T) {
+		_, _, err := svc.UploadPolicy(ctx, admin, app.ID, UploadPolicyRequest{Name: "main", Source: "package demo.authz\n\nsyntax error"})
+		var appErr *apperrors.AppError
+		if !errors.As(err, &appErr) || appErr.Status != http.StatusUnprocessableEntity {
+			t.Errorf("UploadPolicy() error = %v, want a 422", err)
+		}
+	})
+	t.Run("invalid names", func(t *testing.T) {
+		if _, _, err := svc.UploadPolicy(ctx, admin, app.ID, UploadPolicyRequest{Name: "../main", Source: "package demo.authz"}); err == nil {
+			t.Error("UploadPolicy() with an invalid name succeeded")
+		}
+	})
+	if versions, _ := svc.ListPolicyVersions(ctx, admin, app.ID, "main"); len(versions) != 1 {
+		t.Fatalf("ListPolicyVersions() = %d versions after rejected uploads, want 1", len(versions))
+	}
+
+	activate := func(caller *models.User, version, wantPrevious int) {
+		t.Helper()
+		change, err := svc.ActivatePolicyVersion(ctx, caller, app.ID, "main", version)
+		if err != nil {
+			t.Fatalf("ActivatePolicyVersion(%d) error = %v", version, err)
+		}
+		if change.PreviousVersion != wantPrevious || change.ActorID != caller.ID {
+			t.Errorf("ActivatePolicyVersion(%d) = %+v, want previous version %d by %s", version, change, wantPrevious, caller.ID)
+		}
+		if active, _ := repo.ActivePolicies(ctx, app.ID); len(active) != 1 || active[0].Version != version {
+			t.Errorf("active policies = %+v, want version %d", active, version)
+		}
+	}
+	activate(admin, 1, 0)
+
+	if _, _, err := svc.UploadPolicy(ctx, otherAdmin, app.ID, UploadPolicyRequest{Name: "main", Source: "package demo.authz\n\nallow := input.action == \"read\"\n"}); err != nil {
+		t.Fatalf("UploadPolicy() of version 2 error = %v", err)
+	}
+	activate(otherAdmin, 2, 1)
+
+	diff, err := svc.DiffPolicyVersions(ctx, admin, app.ID, "main", 1, 2)
+	if err != nil {
+		t.Fatalf("DiffPolicyVersions() error = %v", err)
+	}
+	if !strings.Contains(diff.Diff, "-allow := true\n+allow := input.action == \"read\"\n") {
+		t.Errorf("DiffPolicyVersions() =\n%s\nwant the changed rule", diff.Diff)
+	}
+	if _, err := svc.DiffPolicyVersions(ctx, admin, app.ID, "main", 1, 3); !errors.Is(err, ErrPolicyNotFound) {
+		t.Errorf("DiffPolicyVersions() to a missing version error = %v, want ErrPolicyNotFound", err)
+	}
+
+	change, err := svc.RollbackPolicy(ctx, admin, app.ID, "main", 1)
+	if err != nil {
+		t.Fatalf("RollbackPolicy() error = %v", err)
+	}
+	if change.Action != models.PolicyChangeRollback || change.PreviousVersion != 2 {
+		t.Errorf("RollbackPolicy() = %+v, want a rollback from version 2", change)
+	}
+	if _, err := svc.RollbackPolicy(ctx, admin, app.ID, "main", 2); !errors.Is(err, ErrInvalidRollback) {
+		t.Errorf("RollbackPolicy() to a newer version error = %v, want ErrInvalidRollback", err)
+	}
+
+	history, err := svc.ListPolicyChanges(ctx, admin, app.ID, 1, 0)
+	if err != nil {
+		t.Fatalf("ListPolicyChanges() error = %v", err)
+	}
+	var actions []string
+	for _, change := range history.Changes {
+		actions = append(actions, change.Action)
+	}
+	wantActions := []string{"rollback", "activate", "upload", "activate", "upload"}
+	if !slices.Equal(actions, wantActions) || history.Total != 5 || history.Changes[1].ActorID != otherAdmin.ID {
+		t.Errorf("ListPolicyChanges() = %v, want %v with the activation of version 2 by the other admin", actions, wantActions)
+	}
+}
+
+func TestPolicyValidationContext(t *testing.T) {
+	ctx := context.Background()
+	orgID := uuid.New()
+	admin := &models.User{ID: uuid.New(), OrgID: orgID, UserType: models.UserTypeOrgAdmin}
+	outsider := &models.User{ID: uuid.New(), OrgID: uuid.New(), UserType: models.UserTypeOrgAdmin}
+	repo := newMemoryApplications()
+	app := &models.Application{ID: uuid.New(), OrgID: orgID, Name: "Demo", OPAEndpoint: "demo.authz", Status: models.ApplicationStatusActive}
+	repo.apps[app.ID] = app
+	repo.policies = []*models.OPAPolicy{
+		{ID: uuid.New(), AppID: app.ID, Name: "main", RegoPolicy: "package demo.authz\n\nallow := true\n", Version: 1, Active: true},
+		{ID: uuid.New(), AppID: app.ID, Name: "helpers", RegoPolicy: "package demo.helpers\n", Version: 1, Active: true},
+	}
+	validator := &sourceValidator{}
+	svc := NewAuthService(nil, &appconfig.Config{}, nil, nil, nil, WithApplications(repo), WithPolicyVersions(validator))
+
+	// A new version replaces its active version and is compiled with the other active policies
+	if _, _, err := svc.UploadPolicy(ctx, admin, app.ID, UploadPolicyRequest{Name: "helpers", Source: "package demo.helpers\n\nx := 1\n"}); err != nil {
+		t.Fatalf("UploadPolicy() error = %v", err)
+	}
+	compiled := validator.compiled[0]
+	if len(compiled) != 2 || compiled[0].Name != "helpers" || compiled[0].Version != 0 || compiled[1].Name != "main" {
+		t.Errorf("compiled %+v, want the new helpers version with the active main policy", compiled)
+	}
+
+	// Activation compiles the version again with what is active now
+	repo.policies[0].RegoPolicy = "syntax error"
+	if _, err := svc.ActivatePolicyVersion(ctx, admin, app.ID, "helpers", 2); err == nil {
+		t.Error("ActivatePolicyVersion() next to a broken policy succeeded")
+	}
+
+	if _, _, err := svc.UploadPolicy(ctx, outsider, app.ID, UploadPolicyRequest{Name: "main", Source: "package demo.authz"}); !errors.Is(err, ErrApplicationNotFound) {
+		t.Errorf("UploadPolicy() by another organization's admin error = %v, want ErrApplicationNotFound", err)
+	}
+	if _, err := svc.TestPolicyVersion(ctx, admin, app.ID, "main", 9, nil); !errors.Is(err, ErrPolicyNotFound) {
+		t.Errorf("TestPolicyVersion() of a missing version error = %v, want ErrPolicyNotFound", err)
+	}
+
+	unchecked := NewAuthService(nil, &appconfig.Config{}, nil, nil, nil, WithApplications(repo))
+	if _, _, err := unchecked.UploadPolicy(ctx, admin, app.ID, UploadPolicyRequest{Name: "main", Source: "package demo.authz"}); !errors.Is(err, ErrPolicyChecksDisabled) {
+		t.Errorf("UploadPolicy() without a validator error = %v, want ErrPolicyChecksDisabled", err)
+	}
+	if versions, err := unchecked.ListPolicyVersions(ctx, admin, app.ID, "main"); err != nil || len(versions) != 1 {
+		t.Errorf("ListPolicyVersions() without a validator = %d versions, %v; want 1", len(versions), err)
+	}
+}
+
+func TestPolicySync(t *testing.T) {
+	ctx := context.Background()
+	orgID := uuid.New()
+	admin := &models.User{ID: uuid.New(), OrgID: orgID, UserType: models.UserTypeOrgAdmin}
+	repo := newMemoryApplications()
+	app := &models.Application{ID: uuid.New(), OrgID: orgID, Name: "Demo", OPAEndpoint: "demo.authz", Status: models.ApplicationStatusActive}
+	other := &models.Application{ID: uuid.New(), OrgID: orgID, Name: "Other", OPAEndpoint: "other.authz", Status: models.ApplicationStatusActive}
+	repo.apps[app.ID], repo.apps[other.ID] = app, other
+	repo.policies = []*models.OPAPolicy{
+		{ID: uuid.New(), AppID: app.ID, Name: "main", RegoPolicy: "package demo.authz\n\nallow := true\n", Version: 1, Active: true},
+		{ID: uuid.New(), AppID: app.ID, Name: "main", RegoPolicy: "package demo.authz\n\nallow := false\n", Version: 2},
+		{ID: uuid.New(), AppID: app.ID, Name: "helpers", RegoPolicy: "package demo.helpers\n", Version: 3, Active: true},
+		{ID: uuid.New(), AppID: other.ID, Name: "main", RegoPolicy: "package other.authz\n", Version: 1, Active: true},
+	}
+	publisher := &recordingPublisher{}
+	svc := NewAuthService(nil, &appconfig.Config{}, nil, nil, nil, WithApplications(repo), WithPolicyVersions(&sourceValidator{}), WithPolicySync(publisher))
+
+	if err := svc.SyncPolicies(ctx); err != nil {
+		t.Fatalf("SyncPolicies() error = %v", err)
+	}
+	if len(publisher.published[app.ID]) != 2 || len(publisher.published[other.ID]) != 1 {
+		t.Errorf("SyncPolicies() published %+v, want the active policies of both applications", publisher.published)
+	}
+	if status := repo.synced[app.ID]; status.Version != 3 || status.SyncedAt.IsZero() {
+		t.Errorf("sync status = %+v, want version 3", status)
+	}
+
+	// Activations are published before they take effect, and not at all when publishing fails
+	publisher.err = errors.New("connection refused")
+	if _, err := svc.ActivatePolicyVersion(ctx, admin, app.ID, "main", 2); !errors.Is(err, ErrPolicyUnavailable) {
+		t.Errorf("ActivatePolicyVersion() with the engine down error = %v, want ErrPolicyUnavailable", err)
+	}
+	if active, _ := repo.ActivePolicies(ctx, app.ID); len(active) != 2 || active[0].Name != "main" || active[0].Version != 1 {
+		t.Errorf("active policies after a failed publish = %+v, want version 1 of main", active)
+	}
+
+	publisher.err = nil
+	if _, err := svc.ActivatePolicyVersion(ctx, admin, app.ID, "main", 2); err != nil {
+		t.Fatalf("ActivatePolicyVersion() error = %v", err)
+	}
+	published := publisher.published[app.ID]
+	if len(published) != 2 || published[0].Name != "main" || published[0].Version != 2 || published[1].Name != "helpers" {
+		t.Errorf("ActivatePolicyVersion() published %+v, want version 2 of main with helpers", published)
+	}
+
+	if err := svc.DeleteApplication(ctx, admin, app.ID); err != nil {
+		t.Fatalf("DeleteApplication() error = %v", err)
+	}
+	if published, ok := publisher.published[app.ID]; !ok || len(published) != 0 {
+		t.Errorf("DeleteApplication() left %+v published, want none", published)
+	}
+}
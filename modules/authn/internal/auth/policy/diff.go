@@ -0,0 +1,178 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// diffContext is the number of unchanged lines shown around changes
+	diffContext = 3
+	// maxDiffCells bounds the work of a diff; larger changes are shown as a full replacement
+	maxDiffCells = 4 << 20
+)
+
+type lineOp byte
+
+const (
+	lineEqual  lineOp = ' '
+	lineDelete lineOp = '-'
+	lineInsert lineOp = '+'
+)
+
+type lineEdit struct {
+	op   lineOp
+	line string
+}
+
+// Diff returns the unified diff turning policy source from into to, or "" when they are equal
+func Diff(fromName, toName, from, to string) string {
+	edits := diffLines(splitLines(from), splitLines(to))
+
+	var hunks strings.Builder
+	for start := 0; start < len(edits); {
+		// Find the next change and extend its hunk while changes are close enough to merge
+		first := start
+		for first < len(edits) && edits[first].op == lineEqual {
+			first++
+		}
+		if first == len(edits) {
+			break
+		}
+		last := first
+		for i := first; i < len(edits); i++ {
+			if edits[i].op != lineEqual {
+				last = i
+			} else if i-last > 2*diffContext {
+				break
+			}
+		}
+		begin, end := max(first-diffContext, start), min(last+diffContext+1, len(edits))
+		writeHunk(&hunks, edits, begin, end)
+		start = end
+	}
+	if hunks.Len() == 0 {
+		return ""
+	}
+	return fmt.Sprintf("--- %s\n+++ %s\n%s", fromName, toName, hunks.String())
+}
+
+// writeHunk writes the edits[begin:end] with a header giving their 1-based line ranges
+func writeHunk(w *strings.Builder, edits []lineEdit, begin, end int) {
+	fromLine, toLine := 0, 0
+	for _, e := range edits[:begin] {
+		if e.op != lineInsert {
+			fromLine++
+		}
+		if e.op != lineDelete {
+			toLine++
+		}
+	}
+	fromCount, toCount := 0, 0
+	for _, e := range edits[begin:end] {
+		if e.op != lineInsert {
+			fromCount++
+		}
+		if e.op != lineDelete {
+			toCount++
+		}
+	}
+
+	fmt.Fprintf(w, "@@ -%s +%s @@\n", hunkRange(fromLine, fromCount), hunkRange(toLine, toCount))
+	for _, e := range edits[begin:end] {
+		w.WriteByte(byte(e.op))
+		w.WriteString(e.line)
+		w.WriteByte('\n')
+	}
+}
+
+// hunkRange formats a range of lines following the lines before it. Empty ranges name the line
+// they follow, as diff(1) does.
+func hunkRange(before, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", before+1)
+	}
+	return fmt.Sprintf("%d,%d", before+1, count)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines returns a shortest edit script turning a into b, from the longest common
+// subsequence of the lines that differ
+func diffLines(a, b []string) []lineEdit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	edits := make([]lineEdit, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		edits = append(edits, lineEdit{lineEqual, line})
+	}
+	edits = append(edits, diffMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		edits = append(edits, lineEdit{lineEqual, line})
+	}
+	return edits
+}
+
+func diffMiddle(a, b []string) []lineEdit {
+	var edits []lineEdit
+	if len(a)*len(b) > maxDiffCells {
+		for _, line := range a {
+			edits = append(edits, lineEdit{lineDelete, line})
+		}
+		for _, line := range b {
+			edits = append(edits, lineEdit{lineInsert, line})
+		}
+		return edits
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	width := len(b) + 1
+	lcs := make([]int32, (len(a)+1)*width)
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i*width+j] = lcs[(i+1)*width+j+1] + 1
+			} else {
+				lcs[i*width+j] = max(lcs[(i+1)*width+j], lcs[i*width+j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			edits = append(edits, lineEdit{lineEqual, a[i]})
+			i++
+			j++
+		case lcs[(i+1)*width+j] >= lcs[i*width+j+1]:
+			edits = append(edits, lineEdit{lineDelete, a[i]})
+			i++
+		default:
+			edits = append(edits, lineEdit{lineInsert, b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		edits = append(edits, lineEdit{lineDelete, a[i]})
+	}
+	for ; j < len(b); j++ {
+		edits = append(edits, lineEdit{lineInsert, b[j]})
+	}
+	return edits
+}
@@ -0,0 +1,53 @@
+package policy
+
+import "testing"
+
+func TestDiff(t *testing.T) {
+	base := "package demo.authz\n\ndefault allow := false\n\nallow if {\n\tinput.user.roles[_] == \"admin\"\n}\n"
+
+	tests := []struct {
+		name string
+		from string
+		to   string
+		want string
+	}{
+		{name: "equal", from: base, to: base, want: ""},
+		{
+			name: "changed line",
+			from: base,
+			to:   "package demo.authz\n\ndefault allow := false\n\nallow if {\n\tinput.user.roles[_] == \"owner\"\n}\n",
+			want: "--- v1\n+++ v2\n@@ -3,5 +3,5 @@\n default allow := false\n \n allow if {\n-\tinput.user.roles[_] == \"admin\"\n+\tinput.user.roles[_] == \"owner\"\n }\n",
+		},
+		{
+			name: "appended lines",
+			from: "a\nb\n",
+			to:   "a\nb\nc\nd\n",
+			want: "--- v1\n+++ v2\n@@ -1,2 +1,4 @@\n a\n b\n+c\n+d\n",
+		},
+		{
+			name: "from empty",
+			from: "",
+			to:   "a\n",
+			want: "--- v1\n+++ v2\n@@ -0,0 +1 @@\n+a\n",
+		},
+		{
+			name: "distant changes get separate hunks",
+			from: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			to:   "one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve\n",
+			want: "--- v1\n+++ v2\n@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+twelve\n",
+		},
+		{
+			name: "close changes share a hunk",
+			from: "1\n2\n3\n4\n5\n6\n7\n8\n",
+			to:   "one\n2\n3\n4\n5\n6\n7\neight\n",
+			want: "--- v1\n+++ v2\n@@ -1,8 +1,8 @@\n-1\n+one\n 2\n 3\n 4\n 5\n 6\n 7\n-8\n+eight\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Diff("v1", "v2", tt.from, tt.to); got != tt.want {
+				t.Errorf("Diff() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"shield/modules/authn/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// PolicyStore provides the policies an application's decisions are evaluated with
+type PolicyStore interface {
+	// ActivePolicies returns the current version of each of the application's policies
+	ActivePolicies(ctx context.Context, appID uuid.UUID) ([]models.OPAPolicy, error)
+}
+
+// preparedQuery is a policy query compiled with its modules
+type preparedQuery interface {
+	Eval(ctx context.Context, input Input) (*Decision, error)
+}
+
+// preparer compiles the Rego modules (file name to source) and the query of a package path
+type preparer func(ctx context.Context, path string, modules map[string]string) (preparedQuery, error)
+
+// EmbeddedEvaluator evaluates policies in-process with the rego package. Policies are read from the
+// store on every decision, and compiled queries are cached per application and policy version.
+type EmbeddedEvaluator struct {
+	store   PolicyStore
+	prepare preparer
+
+	mu    sync.Mutex
+	cache map[uuid.UUID]cachedQuery
+}
+
+type cachedQuery struct {
+	key   string // Query path and policy versions the query was compiled from
+	query preparedQuery
+}
+
+// NewEmbeddedEvaluator creates an in-process evaluator
+func NewEmbeddedEvaluator(store PolicyStore) *EmbeddedEvaluator {
+	return newEmbeddedEvaluator(store, prepareRego)
+}
+
+func newEmbeddedEvaluator(store PolicyStore, prepare preparer) *EmbeddedEvaluator {
+	return &EmbeddedEvaluator{
+		store:   store,
+		prepare: prepare,
+		cache:   make(map[uuid.UUID]cachedQuery),
+	}
+}
+
+// Evaluate evaluates the policy package at query.Path with the policies of the application
+// in query.Input
+func (e *EmbeddedEvaluator) Evaluate(ctx context.Context, query Query) (*Decision, error) {
+	appID, err := uuid.Parse(query.Input.Application.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid application ID %q: %w", query.Input.Application.ID, err)
+	}
+
+	policies, err := e.store.ActivePolicies(ctx, appID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to load policies: %v", ErrUnavailable, err)
+	}
+	if len(policies) == 0 {
+		return nil, fmt.Errorf("%w: application %s has no policies", ErrUndefined, appID)
+	}
+
+	prepared, err := e.preparedQuery(ctx, appID, query.Path, policies)
+	if err != nil {
+		return nil, err
+	}
+	return prepared.Eval(ctx, query.Input)
+}
+
+// preparedQuery returns the cached query of the application, compiling it again when the
+// path or any policy version changed
+func (e *EmbeddedEvaluator) preparedQuery(ctx context.Context, appID uuid.UUID, path string, policies []models.OPAPolicy) (preparedQuery, error) {
+	versions := make([]string, 0, len(policies))
+	modules := make(map[string]string, len(policies))
+	for _, p := range policies {
+		versions = append(versions, fmt.Sprintf("%s@%d", p.Name, p.Version))
+		modules[moduleName(p)] = p.RegoPolicy
+	}
+	sort.Strings(versions)
+	key := path + "|" + strings.Join(versions, ",")
+
+	e.mu.Lock()
+	cached, ok := e.cache[appID]
+	e.mu.Unlock()
+	if ok && cached.key == key {
+		return cached.query, nil
+	}
+
+	// Concurrent decisions may compile the same version twice; the last one is kept
+	prepared, err := e.prepare(ctx, path, modules)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to compile policies of application %s: %v", ErrUnavailable, appID, err)
+	}
+
+	e.mu.Lock()
+	e.cache[appID] = cachedQuery{key: key, query: prepared}
+	e.mu.Unlock()
+	return prepared, nil
+}
+
+// packagePath splits a package path into its segments, e.g. "demo/authz" or "demo.authz" into
+// demo and authz
+func packagePath(path string) []string {
+	return strings.FieldsFunc(path, func(r rune) bool { return r == '.' || r == '/' })
+}
+
+var _ Evaluator = (*EmbeddedEvaluator)(nil)
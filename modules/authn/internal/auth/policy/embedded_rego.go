@@ -0,0 +1,62 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"shield/modules/authn/internal/auth/policy/rego"
+)
+
+// prepareRego compiles the modules with the rego package. Modules must declare the package at
+// path, which is the application's own, and may only read documents under it, as they do when
+// published to a shared OPA server.
+func prepareRego(_ context.Context, path string, modules map[string]string) (preparedQuery, error) {
+	segments := packagePath(path)
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("invalid policy path %q", path)
+	}
+	prog, err := rego.Compile(modules, rego.WithPackage(segments...))
+	if err != nil {
+		return nil, err
+	}
+	return regoQuery{prog: prog, path: segments}, nil
+}
+
+type regoQuery struct {
+	prog *rego.Program
+	path []string
+}
+
+// Eval evaluates the package. The input is passed in its JSON form, as the data API receives it.
+func (q regoQuery) Eval(ctx context.Context, input Input) (*Decision, error) {
+	encoded, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode policy input: %w", err)
+	}
+	decoder := json.NewDecoder(strings.NewReader(string(encoded)))
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil, fmt.Errorf("failed to encode policy input: %w", err)
+	}
+	value, err := rego.FromJSON(document)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode policy input: %w", err)
+	}
+
+	v, defined, err := q.prog.Eval(ctx, q.path, value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	if !defined {
+		return nil, fmt.Errorf("%w: %s", ErrUndefined, strings.Join(q.path, "."))
+	}
+
+	result, err := json.Marshal(rego.ToJSON(v))
+	if err != nil {
+		return nil, fmt.Errorf("%w: unexpected policy result: %v", ErrUnavailable, err)
+	}
+	return decisionFromResult(result)
+}
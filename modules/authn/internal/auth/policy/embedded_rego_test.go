@@ -0,0 +1,42 @@
+package policy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"shield/modules/authn/internal/models"
+)
+
+// TestEmbeddedDemoPolicy evaluates the policies/ fixtures in-process; the remote mode is held
+// to the same fixtures by TestOPAClientDemoPolicy
+func TestEmbeddedDemoPolicy(t *testing.T) {
+	files, err := filepath.Glob("../../../../../policies/*.rego")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no policies found: %v", err)
+	}
+	var policies []models.OPAPolicy
+	for _, file := range files {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := strings.TrimSuffix(filepath.Base(file), ".rego")
+		policies = append(policies, models.OPAPolicy{AppID: demoAppID, Name: name, RegoPolicy: string(source), Version: 1})
+	}
+
+	evaluator := NewEmbeddedEvaluator(memoryPolicies{demoAppID: policies})
+	for _, tt := range demoPolicyFixtures {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := evaluator.Evaluate(context.Background(), tt.query())
+			if err != nil {
+				t.Fatalf("Evaluate() error = %v", err)
+			}
+			if decision.Allow != tt.allow {
+				t.Errorf("Evaluate() allow = %v, want %v", decision.Allow, tt.allow)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"shield/modules/authn/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// memoryPolicies stores the active policies of applications
+type memoryPolicies map[uuid.UUID][]models.OPAPolicy
+
+func (m memoryPolicies) ActivePolicies(_ context.Context, appID uuid.UUID) ([]models.OPAPolicy, error) {
+	return m[appID], nil
+}
+
+// countingPreparer records compilations; its queries allow when the modules contain "allow"
+type countingPreparer struct {
+	compiled int
+}
+
+type fixedQuery struct {
+	allow bool
+}
+
+func (q fixedQuery) Eval(context.Context, Input) (*Decision, error) {
+	return &Decision{Allow: q.allow}, nil
+}
+
+func (p *countingPreparer) prepare(_ context.Context, path string, modules map[string]string) (preparedQuery, error) {
+	p.compiled++
+	allow := false
+	for _, source := range modules {
+		if source == "syntax error" {
+			return nil, errors.New("rego_parse_error")
+		}
+		allow = allow || source == "allow"
+	}
+	return fixedQuery{allow: allow}, nil
+}
+
+func TestEmbeddedEvaluatorCache(t *testing.T) {
+	ctx := context.Background()
+	store := memoryPolicies{demoAppID: {{AppID: demoAppID, Name: "main", RegoPolicy: "deny", Version: 1}}}
+	preparer := &countingPreparer{}
+	evaluator := newEmbeddedEvaluator(store, preparer.prepare)
+	query := demoPolicyFixtures[0].query()
+
+	evaluate := func(wantAllow bool, wantCompiled int) {
+		t.Helper()
+		decision, err := evaluator.Evaluate(ctx, query)
+		if err != nil {
+			t.Fatalf("Evaluate() error = %v", err)
+		}
+		if decision.Allow != wantAllow || preparer.compiled != wantCompiled {
+			t.Errorf("Evaluate() allow = %v after %d compilations, want %v after %d", decision.Allow, preparer.compiled, wantAllow, wantCompiled)
+		}
+	}
+
+	evaluate(false, 1)
+	evaluate(false, 1)
+
+	// A new version is compiled on its first decision
+	store[demoAppID] = []models.OPAPolicy{{AppID: demoAppID, Name: "main", RegoPolicy: "allow", Version: 2}}
+	evaluate(true, 2)
+	evaluate(true, 2)
+
+	// A policy that does not compile fails the decision and keeps the cached version
+	store[demoAppID] = []models.OPAPolicy{{AppID: demoAppID, Name: "main", RegoPolicy: "syntax error", Version: 3}}
+	if _, err := evaluator.Evaluate(ctx, query); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Evaluate() error = %v, want ErrUnavailable", err)
+	}
+	store[demoAppID] = []models.OPAPolicy{{AppID: demoAppID, Name: "main", RegoPolicy: "allow", Version: 2}}
+	evaluate(true, 3)
+}
+
+func TestEmbeddedEvaluatorErrors(t *testing.T) {
+	ctx := context.Background()
+	evaluator := newEmbeddedEvaluator(memoryPolicies{}, (&countingPreparer{}).prepare)
+
+	if _, err := evaluator.Evaluate(ctx, demoPolicyFixtures[0].query()); !errors.Is(err, ErrUndefined) {
+		t.Errorf("Evaluate() without policies error = %v, want ErrUndefined", err)
+	}
+	if _, err := evaluator.Evaluate(ctx, Query{Path: demoPackage}); err == nil {
+		t.Error("Evaluate() without an application succeeded")
+	}
+}
+
+func TestPackagePath(t *testing.T) {
+	for _, path := range []string{"demo.authz", "demo/authz", "/demo/authz/"} {
+		if got := packagePath(path); !slices.Equal(got, []string{"demo", "authz"}) {
+			t.Errorf("packagePath(%q) = %q, want [demo authz]", path, got)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package policy
+
+import "github.com/google/uuid"
+
+var demoAppID = uuid.MustParse("6f1d3c2a-9b7e-4d5f-8a1c-2e3b4c5d6e7f")
+
+// demoPackage is the package of the demo application, of organization
+// d3b07384-d9a0-4c9f-8b1e-5a1c2f3e4d5c
+const demoPackage = "org_d3b07384d9a04c9f8b1e5a1c2f3e4d5c.app_6f1d3c2a9b7e4d5f8a1c2e3b4c5d6e7f"
+
+// demoPath is demoPackage as a data API path
+const demoPath = "org_d3b07384d9a04c9f8b1e5a1c2f3e4d5c/app_6f1d3c2a9b7e4d5f8a1c2e3b4c5d6e7f"
+
+// demoFixture is a decision of policies/demo_policy.rego
+type demoFixture struct {
+	name     string
+	roles    []string
+	resource string
+	action   string
+	allow    bool
+}
+
+// demoPolicyFixtures are the decisions every evaluation mode must reproduce
+var demoPolicyFixtures = []demoFixture{
+	{"viewer reads reports", []string{"viewer"}, "/api/reports", "read", true},
+	{"viewer cannot write reports", []string{"viewer"}, "/api/reports", "write", false},
+	{"editor writes data", []string{"editor"}, "/api/data", "write", true},
+	{"editor cannot delete data", []string{"editor"}, "/api/data", "delete", false},
+	{"admin deletes users", []string{"admin"}, "/api/users", "delete", true},
+	{"admin writes settings", []string{"admin", "viewer"}, "/api/settings", "write", true},
+	{"viewer cannot read settings", []string{"viewer"}, "/api/settings", "read", false},
+	{"unknown action", []string{"admin"}, "/api/users", "approve", false},
+	{"no roles", []string{}, "/api/reports", "read", false},
+	{"unknown resource", []string{"admin"}, "/api/unknown", "read", false},
+}
+
+// query returns the decision's query of the demo package
+func (f demoFixture) query() Query {
+	return Query{
+		Path: demoPackage,
+		Input: Input{
+			User:        User{ID: "user-1", Roles: f.roles},
+			Application: Application{ID: demoAppID.String(), Name: "Demo"},
+			Resource:    f.resource,
+			Action:      f.action,
+		},
+	}
+}
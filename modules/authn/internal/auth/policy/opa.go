@@ -0,0 +1,124 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// OPAClient evaluates policies with the data API of a remote OPA server, and loads the active
+// policies of applications with its policy API
+type OPAClient struct {
+	dataURL     string
+	policiesURL string
+	httpClient  *http.Client
+}
+
+// NewOPAClient creates a client for the OPA server at serverURL. dataPath is the path of its
+// data API (default /v1/data). A default HTTP client is used when httpClient is nil.
+func NewOPAClient(serverURL, dataPath string, httpClient *http.Client) *OPAClient {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 5 * time.Second}
+	}
+	if dataPath == "" {
+		dataPath = "/v1/data"
+	}
+
+	serverURL = strings.TrimRight(serverURL, "/")
+	return &OPAClient{
+		dataURL:     serverURL + "/" + strings.Trim(dataPath, "/"),
+		policiesURL: serverURL + "/v1/policies",
+		httpClient:  httpClient,
+	}
+}
+
+// queryURL returns the data API URL of a policy path such as demo.authz or demo/authz/allow.
+// Every segment is escaped, so queries never leave the configured server's data API.
+func (c *OPAClient) queryURL(path string) string {
+	segments := packagePath(path)
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return c.dataURL + "/" + strings.Join(segments, "/")
+}
+
+// Evaluate queries the policy document at query.Path with query.Input
+func (c *OPAClient) Evaluate(ctx context.Context, query Query) (*Decision, error) {
+	body, err := json.Marshal(map[string]interface{}{"input": query.Input})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode policy input: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.queryURL(query.Path), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OPA request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read OPA response: %v", ErrUnavailable, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, opaError(resp.StatusCode, respBody)
+	}
+
+	// The result is omitted when the queried document is undefined
+	var result struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("%w: invalid OPA response: %v", ErrUnavailable, err)
+	}
+	if len(result.Result) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUndefined, query.Path)
+	}
+	return decisionFromResult(result.Result)
+}
+
+// opaError describes an error response of the OPA server
+func opaError(status int, body []byte) error {
+	respErr := &opaResponseError{status: status}
+	_ = json.Unmarshal(body, respErr)
+	return respErr
+}
+
+// opaResponseError is an error response of the OPA server. It wraps ErrUnavailable; a 400
+// response to loading a module means the module does not compile.
+type opaResponseError struct {
+	status  int
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Errors  []struct {
+		Message string `json:"message"`
+	} `json:"errors"` // Compile errors
+}
+
+func (e *opaResponseError) Error() string {
+	if e.Message != "" {
+		message := e.Message
+		for _, detail := range e.Errors {
+			message += "; " + detail.Message
+		}
+		return fmt.Sprintf("%v: OPA returned %d %s: %s", ErrUnavailable, e.status, e.Code, message)
+	}
+	return fmt.Sprintf("%v: OPA returned %d", ErrUnavailable, e.status)
+}
+
+func (e *opaResponseError) Unwrap() error {
+	return ErrUnavailable
+}
+
+var _ Evaluator = (*OPAClient)(nil)
@@ -0,0 +1,160 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// demoPolicy mirrors policies/demo_policy.rego
+func demoPolicy(input Input) bool {
+	required := map[string]string{
+		"/api/users":    "admin",
+		"/api/reports":  "viewer",
+		"/api/settings": "admin",
+		"/api/data":     "editor",
+	}
+	has := func(roles ...string) bool {
+		for _, held := range input.User.Roles {
+			for _, role := range roles {
+				if held == role {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	role, ok := required[input.Resource]
+	if !ok || !has(role) {
+		return false
+	}
+	switch input.Action {
+	case "read":
+		return true
+	case "write":
+		return has("admin", "editor")
+	case "delete":
+		return has("admin")
+	}
+	return false
+}
+
+// newOPAServer stands in for an OPA server with the demo policy loaded as demoPackage
+func newOPAServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/data/"+demoPath, func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Input *Input `json:"input"`
+		}
+		if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&body) != nil || body.Input == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"code":"invalid_parameter","message":"invalid input document"}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"result": map[string]interface{}{"allow": demoPolicy(*body.Input)},
+		})
+	})
+	mux.HandleFunc("/v1/data/"+demoPath+"/allow", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"result":true}`))
+	})
+	mux.HandleFunc("/v1/data/vetoed", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"result":{"allow":true,"deny":["account is locked"],"reasons":["user is an admin"]}}`))
+	})
+	mux.HandleFunc("/v1/data/missing", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	})
+	mux.HandleFunc("/v1/data/conflict", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"code":"internal_error","message":"eval_conflict_error: complete rules must not produce multiple outputs"}`))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOPAClientDemoPolicy(t *testing.T) {
+	server := newOPAServer(t)
+	client := NewOPAClient(server.URL, "/v1/data", nil)
+
+	for _, tt := range demoPolicyFixtures {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := client.Evaluate(context.Background(), tt.query())
+			if err != nil {
+				t.Fatalf("Evaluate() error = %v", err)
+			}
+			if decision.Allow != tt.allow {
+				t.Errorf("Evaluate() allow = %v, want %v", decision.Allow, tt.allow)
+			}
+		})
+	}
+}
+
+func TestOPAClientResults(t *testing.T) {
+	server := newOPAServer(t)
+	client := NewOPAClient(server.URL+"/", "", nil)
+
+	tests := []struct {
+		name    string
+		path    string
+		want    *Decision
+		wantErr error
+	}{
+		{"boolean rule", demoPath + "/allow", &Decision{Allow: true}, nil},
+		{"deny overrides allow", "vetoed", &Decision{Allow: false, Reasons: []string{"user is an admin", "account is locked"}}, nil},
+		{"undefined document", "missing", nil, ErrUndefined},
+		{"evaluation error", "conflict", nil, ErrUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := client.Evaluate(context.Background(), Query{Path: tt.path})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Evaluate() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Evaluate() error = %v", err)
+			}
+			if !reflect.DeepEqual(decision, tt.want) {
+				t.Errorf("Evaluate() = %+v, want %+v", decision, tt.want)
+			}
+		})
+	}
+}
+
+func TestOPAClientStaysOnServer(t *testing.T) {
+	server := newOPAServer(t)
+	var requests int
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write([]byte(`{"result":true}`))
+	}))
+	t.Cleanup(other.Close)
+	client := NewOPAClient(server.URL, "/v1/data", nil)
+
+	for _, path := range []string{other.URL + "/v1/data/" + demoPath + "/allow", "../../../v1/data/" + demoPath + "/allow?x=1"} {
+		if _, err := client.Evaluate(context.Background(), Query{Path: path}); !errors.Is(err, ErrUnavailable) {
+			t.Errorf("Evaluate(%q) error = %v, want ErrUnavailable from the configured server", path, err)
+		}
+	}
+	if requests != 0 {
+		t.Errorf("other server received %d requests, want 0", requests)
+	}
+}
+
+func TestOPAClientUnreachable(t *testing.T) {
+	server := newOPAServer(t)
+	server.Close()
+
+	_, err := NewOPAClient(server.URL, "/v1/data", nil).Evaluate(context.Background(), Query{Path: demoPackage})
+	if !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Evaluate() error = %v, want ErrUnavailable", err)
+	}
+}
@@ -0,0 +1,81 @@
+// Package policy evaluates authorization decisions against the Rego policies of applications.
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrUndefined is returned when the queried policy document does not exist
+	ErrUndefined = errors.New("policy decision is undefined")
+	// ErrUnavailable is returned when the policy engine cannot be reached or fails to evaluate
+	ErrUnavailable = errors.New("policy engine unavailable")
+)
+
+// Input is the input document policies are evaluated with, e.g. input.user.roles
+type Input struct {
+	User        User                   `json:"user"`
+	Application Application            `json:"application"`
+	Resource    string                 `json:"resource"`
+	Action      string                 `json:"action"`
+	Context     map[string]interface{} `json:"context,omitempty"` // Caller-supplied attributes, passed through unchanged
+}
+
+// User describes the subject of a decision
+type User struct {
+	ID       string   `json:"id"`
+	Email    string   `json:"email"`
+	OrgID    string   `json:"org_id,omitempty"`
+	UserType string   `json:"user_type,omitempty"`
+	Roles    []string `json:"roles"` // Roles the user holds in the application
+}
+
+// Application describes the application a decision is made for
+type Application struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Query selects the policy to evaluate and the input to evaluate it with
+type Query struct {
+	Path  string // Policy package (e.g., "demo.authz" or "demo/authz")
+	Input Input
+}
+
+// Decision is the outcome of a policy evaluation
+type Decision struct {
+	Allow   bool
+	Reasons []string
+}
+
+// Evaluator evaluates policy queries
+type Evaluator interface {
+	Evaluate(ctx context.Context, query Query) (*Decision, error)
+}
+
+// decisionFromResult reads a decision from a policy document. The document is either the
+// boolean allow rule or the package, whose allow rule is read together with its optional
+// reasons and deny messages.
+func decisionFromResult(result json.RawMessage) (*Decision, error) {
+	var allow bool
+	if err := json.Unmarshal(result, &allow); err == nil {
+		return &Decision{Allow: allow}, nil
+	}
+
+	var document struct {
+		Allow   *bool    `json:"allow"`
+		Reasons []string `json:"reasons"`
+		Deny    []string `json:"deny"`
+	}
+	if err := json.Unmarshal(result, &document); err != nil {
+		return nil, fmt.Errorf("%w: unexpected policy result: %v", ErrUnavailable, err)
+	}
+
+	decision := &Decision{Reasons: append(document.Reasons, document.Deny...)}
+	// A deny message overrides allow, so policies can veto decisions of the allow rule
+	decision.Allow = document.Allow != nil && *document.Allow && len(document.Deny) == 0
+	return decision, nil
+}
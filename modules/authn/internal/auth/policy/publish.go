@@ -0,0 +1,108 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"shield/modules/authn/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Publisher loads the active policies of applications into a policy engine that does not read
+// them from the database
+type Publisher interface {
+	// Publish makes policies the only modules of the application, removing the ones of policies
+	// that are no longer active. Publishing no policies removes all of them.
+	Publish(ctx context.Context, appID uuid.UUID, policies []models.OPAPolicy) error
+}
+
+// Publish loads the policies with the policy API. Modules are named like the ones compiled in
+// embedded mode, so the application's modules are the ones under its ID.
+func (c *OPAClient) Publish(ctx context.Context, appID uuid.UUID, policies []models.OPAPolicy) error {
+	loaded, err := c.listModules(ctx)
+	if err != nil {
+		return err
+	}
+
+	active := make(map[string]bool, len(policies))
+	for _, p := range policies {
+		id := moduleName(p)
+		active[id] = true
+		if err := c.policyRequest(ctx, http.MethodPut, id, p.RegoPolicy); err != nil {
+			return fmt.Errorf("failed to load policy %s: %w", id, err)
+		}
+	}
+	for _, id := range loaded {
+		if strings.HasPrefix(id, appID.String()+"/") && !active[id] {
+			if err := c.policyRequest(ctx, http.MethodDelete, id, ""); err != nil {
+				return fmt.Errorf("failed to remove policy %s: %w", id, err)
+			}
+		}
+	}
+	return nil
+}
+
+// listModules returns the IDs of the modules loaded into the OPA server
+func (c *OPAClient) listModules(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.policiesURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OPA request: %w", err)
+	}
+	body, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var listed struct {
+		Result []struct {
+			ID string `json:"id"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(body, &listed); err != nil {
+		return nil, fmt.Errorf("%w: invalid OPA response: %v", ErrUnavailable, err)
+	}
+	ids := make([]string, 0, len(listed.Result))
+	for _, module := range listed.Result {
+		ids = append(ids, module.ID)
+	}
+	return ids, nil
+}
+
+// policyRequest creates (PUT) or deletes a module. Module IDs are application IDs and policy
+// names, which need no escaping.
+func (c *OPAClient) policyRequest(ctx context.Context, method, id, source string) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.policiesURL+"/"+id, strings.NewReader(source))
+	if err != nil {
+		return fmt.Errorf("failed to create OPA request: %w", err)
+	}
+	if method == http.MethodPut {
+		req.Header.Set("Content-Type", "text/plain")
+	}
+	_, err = c.do(req)
+	return err
+}
+
+// do sends a request to the policy API and returns the body of its successful response
+func (c *OPAClient) do(req *http.Request) ([]byte, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read OPA response: %v", ErrUnavailable, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, opaError(resp.StatusCode, body)
+	}
+	return body, nil
+}
+
+var _ Publisher = (*OPAClient)(nil)
@@ -0,0 +1,112 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"shield/modules/authn/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// policyServer stands in for the policy API of an OPA server
+type policyServer struct {
+	mu      sync.Mutex
+	modules map[string]string
+}
+
+func (s *policyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := strings.TrimPrefix(r.URL.Path, "/v1/policies/")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/policies":
+		var ids []string
+		for id := range s.modules {
+			ids = append(ids, `{"id":"`+id+`"}`)
+		}
+		_, _ = w.Write([]byte(`{"result":[` + strings.Join(ids, ",") + `]}`))
+	case r.Method == http.MethodPut && strings.Contains(r.URL.Path, "/v1/policies/"):
+		source, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(source), "syntax error") {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"code":"invalid_parameter","message":"error(s) occurred while compiling module(s)"}`))
+			return
+		}
+		s.modules[id] = string(source)
+		_, _ = w.Write([]byte(`{}`))
+	case r.Method == http.MethodDelete && s.modules[id] != "":
+		delete(s.modules, id)
+		_, _ = w.Write([]byte(`{}`))
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/v1/data/"):
+		// Packages allow when one of their modules says allow := true
+		pkg := "package " + strings.ReplaceAll(strings.TrimPrefix(r.URL.Path, "/v1/data/"), "/", ".")
+		result := ""
+		for _, source := range s.modules {
+			if strings.HasPrefix(source, pkg+"\n") || strings.HasPrefix(source, pkg+" ") {
+				result = `,"result":{"allow":` + strconv.FormatBool(strings.Contains(source, "allow := true")) + `}`
+			}
+		}
+		_, _ = w.Write([]byte(`{"decision_id":"1"` + result + `}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *policyServer) ids() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(s.modules))
+	for id := range s.modules {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestOPAClientPublish(t *testing.T) {
+	ctx := context.Background()
+	appID, otherID := uuid.New(), uuid.New()
+	opa := &policyServer{modules: map[string]string{
+		appID.String() + "/retired.rego": "package old",
+		otherID.String() + "/main.rego":  "package other",
+	}}
+	server := httptest.NewServer(opa)
+	t.Cleanup(server.Close)
+	client := NewOPAClient(server.URL, "", nil)
+
+	policies := []models.OPAPolicy{
+		{AppID: appID, Name: "main", RegoPolicy: "package demo.authz", Version: 2},
+		{AppID: appID, Name: "roles", RegoPolicy: "package demo.roles", Version: 1},
+	}
+	if err := client.Publish(ctx, appID, policies); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	want := []string{appID.String() + "/main.rego", appID.String() + "/roles.rego", otherID.String() + "/main.rego"}
+	sort.Strings(want)
+	if got := opa.ids(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Publish() left modules %v, want %v", got, want)
+	}
+
+	if err := client.Publish(ctx, appID, nil); err != nil {
+		t.Fatalf("Publish() of no policies error = %v", err)
+	}
+	if got := opa.ids(); !reflect.DeepEqual(got, []string{otherID.String() + "/main.rego"}) {
+		t.Errorf("Publish() of no policies left modules %v, want only the other application's", got)
+	}
+
+	broken := []models.OPAPolicy{{AppID: appID, Name: "main", RegoPolicy: "syntax error", Version: 3}}
+	if err := client.Publish(ctx, appID, broken); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Publish() of a rejected policy error = %v, want ErrUnavailable", err)
+	}
+}
@@ -0,0 +1,116 @@
+package rego
+
+// Term is an expression that evaluates to values
+type Term interface{}
+
+// Scalar is a literal null, boolean, number or string
+type Scalar struct{ Value Value }
+
+// Var is a variable, a rule of the enclosing package, an import or the input and data roots.
+// Each wildcard _ is given a unique name by the parser.
+type Var struct{ Name string }
+
+// Ref looks up Path in the value of Head, e.g. input.user.roles[_]. Path elements are terms;
+// unbound variables in them enumerate the collection.
+type Ref struct {
+	Head Term
+	Path []Term
+}
+
+// Call calls a built-in function or a function rule. Operators are calls too.
+type Call struct {
+	Name string
+	Args []Term
+	Line int
+}
+
+// ArrayTerm is an array literal
+type ArrayTerm struct{ Elems []Term }
+
+// ObjectTerm is an object literal
+type ObjectTerm struct{ Items [][2]Term }
+
+// SetTerm is a set literal
+type SetTerm struct{ Elems []Term }
+
+// Comprehension builds an array, set or object from the solutions of Body
+type Comprehension struct {
+	Kind  string // array, set or object
+	Key   Term   // Object comprehensions only
+	Value Term
+	Body  []*Expr
+}
+
+// Expr is an expression of a rule body
+type Expr struct {
+	Line    int
+	Negated bool // not expr
+
+	Term   Term  // Succeeds when defined and not false; nil for the kinds below
+	Assign *Bind // x := y
+	Unify  *Bind // x = y
+	Some   *Some
+	Every  *Every
+	Not    *Expr
+
+	With []*With // Modifiers applying to the expression
+}
+
+// With replaces, while an expression is evaluated, the input or data document at Target, or
+// the function Target names, with Value: input.user as {...}, time.now_ns as 0
+type With struct {
+	Target Term
+	Value  Term
+}
+
+// Bind is an assignment or unification
+type Bind struct {
+	Left, Right Term
+}
+
+// Some declares local variables, or iterates a collection: some k, v in coll
+type Some struct {
+	Vars       []string // Declarations without in
+	Key, Value Term     // Key is nil without k,
+	Collection Term
+}
+
+// Every succeeds when Body holds for every element of Collection
+type Every struct {
+	Key, Value Term
+	Collection Term
+	Body       []*Expr
+}
+
+// ruleKind tells how the definitions of a rule combine
+type ruleKind int
+
+const (
+	ruleComplete ruleKind = iota
+	rulePartialSet
+	rulePartialObject
+	ruleFunction
+)
+
+// Rule is one definition of a rule
+type Rule struct {
+	Name    string
+	Path    []string // Name split at dots; rules like a.b.c define documents under the package
+	Kind    ruleKind
+	Default bool
+	Key     Term   // Element of partial sets, key of partial objects
+	Value   Term   // Value of complete rules, functions and partial objects
+	Args    []Term // Function arguments
+	Body    []*Expr
+	Else    *Rule // Evaluated when Body fails, for complete rules and functions
+	Module  string
+	Line    int
+}
+
+// Module is a parsed policy module
+type Module struct {
+	Name    string
+	Package []string
+	Imports map[string][]string // Alias to the imported input or data path
+	Rules   []*Rule
+}
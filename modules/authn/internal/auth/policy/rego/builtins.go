@@ -0,0 +1,1412 @@
+package rego
+
+import (
+	"cmp"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/big"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// errUndefined is returned by built-ins whose result is undefined, e.g. max of an empty array
+var errUndefined = errors.New("undefined")
+
+// printFunction writes its arguments and takes any number of them
+const printFunction = "print"
+
+type builtin struct {
+	arity int
+	eval  func(ev *evaluator, args []Value) (Value, error)
+}
+
+// generator is a built-in producing any number of values, which yield receives in turn
+type generator struct {
+	arity int
+	iter  func(args []Value, yield func(Value) error) error
+}
+
+// generators are the built-ins that enumerate, like walk(x, [path, value])
+var generators = map[string]generator{
+	"walk": {1, walk},
+}
+
+// builtins are the functions policies may call. Only deterministic functions without access
+// to the network, files or the runtime are provided; time.now_ns is fixed per evaluation.
+var builtins = map[string]builtin{
+	// Operators
+	"equal":        {2, func(_ *evaluator, a []Value) (Value, error) { return Equal(a[0], a[1]), nil }},
+	"neq":          {2, func(_ *evaluator, a []Value) (Value, error) { return !Equal(a[0], a[1]), nil }},
+	"lt":           {2, func(_ *evaluator, a []Value) (Value, error) { return Compare(a[0], a[1]) < 0, nil }},
+	"lte":          {2, func(_ *evaluator, a []Value) (Value, error) { return Compare(a[0], a[1]) <= 0, nil }},
+	"gt":           {2, func(_ *evaluator, a []Value) (Value, error) { return Compare(a[0], a[1]) > 0, nil }},
+	"gte":          {2, func(_ *evaluator, a []Value) (Value, error) { return Compare(a[0], a[1]) >= 0, nil }},
+	"plus":         {2, arithmetic(func(z, x, y *big.Rat) error { z.Add(x, y); return nil })},
+	"mul":          {2, arithmetic(func(z, x, y *big.Rat) error { z.Mul(x, y); return nil })},
+	"div":          {2, arithmetic(divide)},
+	"rem":          {2, arithmetic(remainder)},
+	"minus":        {2, minus},
+	memberFunction: {2, member},
+	"and":          {2, setOp(false)},
+	"or":           {2, setOp(true)},
+
+	// Aggregates
+	"count":   {1, count},
+	"sum":     {1, fold(0, func(z, x *big.Rat) { z.Add(z, x) })},
+	"product": {1, fold(1, func(z, x *big.Rat) { z.Mul(z, x) })},
+	"max":     {1, extreme(1)},
+	"min":     {1, extreme(-1)},
+	"sort":    {1, sortValues},
+
+	// Collections
+	"array.concat":   {2, arrayConcat},
+	"array.slice":    {3, arraySlice},
+	"array.reverse":  {1, arrayReverse},
+	"set":            {0, func(*evaluator, []Value) (Value, error) { return Set{}, nil }},
+	"intersection":   {1, setFold(false)},
+	"union":          {1, setFold(true)},
+	"object.get":     {3, objectGet},
+	"object.keys":    {1, objectKeys},
+	"object.union":   {2, func(_ *evaluator, a []Value) (Value, error) { return objectUnion(a[0], a[1]) }},
+	"object.union_n": {1, objectUnionN},
+	"object.remove":  {2, objectFilter(false)},
+	"object.filter":  {2, objectFilter(true)},
+	"object.subset":  {2, objectSubset},
+	"numbers.range":  {2, numbersRange},
+
+	// Strings
+	"concat":      {2, concat},
+	"contains":    {2, stringFunc2(func(s, t string) Value { return strings.Contains(s, t) })},
+	"startswith":  {2, stringFunc2(func(s, t string) Value { return strings.HasPrefix(s, t) })},
+	"endswith":    {2, stringFunc2(func(s, t string) Value { return strings.HasSuffix(s, t) })},
+	"indexof":     {2, stringFunc2(indexOf)},
+	"split":       {2, stringFunc2(split)},
+	"trim":        {2, stringFunc2(func(s, t string) Value { return strings.Trim(s, t) })},
+	"trim_left":   {2, stringFunc2(func(s, t string) Value { return strings.TrimLeft(s, t) })},
+	"trim_right":  {2, stringFunc2(func(s, t string) Value { return strings.TrimRight(s, t) })},
+	"trim_prefix": {2, stringFunc2(func(s, t string) Value { return strings.TrimPrefix(s, t) })},
+	"trim_suffix": {2, stringFunc2(func(s, t string) Value { return strings.TrimSuffix(s, t) })},
+	"lower":       {1, stringFunc1(strings.ToLower)},
+	"upper":       {1, stringFunc1(strings.ToUpper)},
+	"trim_space":  {1, stringFunc1(strings.TrimSpace)},
+	"replace":     {3, replace},
+	"substring":   {3, substring},
+	"sprintf":     {2, sprintf},
+	"format_int":  {2, formatInt},
+	"regex.match": {2, regexMatch},
+	"regex.is_valid": {1, func(_ *evaluator, a []Value) (Value, error) {
+		s, ok := a[0].(string)
+		_, err := regexp.Compile(s)
+		return ok && err == nil, nil
+	}},
+	"regex.find_n":             {3, regexFindN},
+	"regex.split":              {2, regexSplit},
+	"regex.replace":            {3, regexReplace},
+	"glob.match":               {3, globMatch},
+	"glob.quote_meta":          {1, stringFunc1(globQuoteMeta)},
+	"strings.any_prefix_match": {2, anyMatch(strings.HasPrefix)},
+	"strings.any_suffix_match": {2, anyMatch(strings.HasSuffix)},
+	"strings.replace_n":        {2, replaceN},
+	"strings.reverse":          {1, stringFunc1(reverse)},
+	"base64.encode":            {1, stringFunc1(func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) })},
+	"base64.decode":            {1, base64Decode},
+	"base64url.encode":         {1, stringFunc1(func(s string) string { return base64.URLEncoding.EncodeToString([]byte(s)) })},
+	"base64url.encode_no_pad":  {1, stringFunc1(func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) })},
+	"base64url.decode":         {1, base64URLDecode},
+	"hex.encode":               {1, stringFunc1(func(s string) string { return hex.EncodeToString([]byte(s)) })},
+	"hex.decode":               {1, hexDecode},
+	"urlquery.encode":          {1, stringFunc1(url.QueryEscape)},
+	"urlquery.decode":          {1, urlqueryDecode},
+	"crypto.md5":               {1, stringFunc1(func(s string) string { return digest(md5.New(), s) })},
+	"crypto.sha1":              {1, stringFunc1(func(s string) string { return digest(sha1.New(), s) })},
+	"crypto.sha256":            {1, stringFunc1(func(s string) string { return digest(sha256.New(), s) })},
+	"crypto.hmac.sha256":       {2, stringFunc2(func(s, key string) Value { return digest(hmac.New(sha256.New, []byte(key)), s) })},
+	"json.marshal":             {1, jsonMarshal},
+	"json.unmarshal":           {1, jsonUnmarshal},
+	"json.is_valid": {1, func(_ *evaluator, a []Value) (Value, error) {
+		s, ok := a[0].(string)
+		return ok && json.Valid([]byte(s)), nil
+	}},
+	"io.jwt.decode":       {1, jwtDecode},
+	"units.parse_bytes":   {1, unitsParseBytes},
+	"net.cidr_contains":   {2, cidrContains},
+	"net.cidr_intersects": {2, cidrIntersects},
+	"net.cidr_is_valid": {1, func(_ *evaluator, a []Value) (Value, error) {
+		s, ok := a[0].(string)
+		_, err := netip.ParsePrefix(s)
+		return ok && err == nil, nil
+	}},
+	"semver.is_valid": {1, func(_ *evaluator, a []Value) (Value, error) {
+		s, ok := a[0].(string)
+		_, err := parseSemver(s)
+		return ok && err == nil, nil
+	}},
+	"semver.compare": {2, semverCompare},
+	"to_number":      {1, toNumber},
+	"type_name":      {1, func(_ *evaluator, a []Value) (Value, error) { return typeName(a[0]), nil }},
+	"is_null":        {1, isType("null")},
+	"is_boolean":     {1, isType("boolean")},
+	"is_number":      {1, isType("number")},
+	"is_string":      {1, isType("string")},
+	"is_array":       {1, isType("array")},
+	"is_object":      {1, isType("object")},
+	"is_set":         {1, isType("set")},
+	"abs":            {1, numberFunc(func(z, x *big.Rat) { z.Abs(x) })},
+	"round":          {1, numberFunc(func(z, x *big.Rat) { roundRat(z, x, 0) })},
+	"ceil":           {1, numberFunc(func(z, x *big.Rat) { roundRat(z, x, 1) })},
+	"floor":          {1, numberFunc(func(z, x *big.Rat) { roundRat(z, x, -1) })},
+	"time.now_ns":    {0, func(ev *evaluator, _ []Value) (Value, error) { return number(ev.now.UnixNano()), nil }},
+	"time.clock": {1, timeFunc(func(t time.Time) Value {
+		return Array{number(int64(t.Hour())), number(int64(t.Minute())), number(int64(t.Second()))}
+	})},
+	"time.date": {1, timeFunc(func(t time.Time) Value {
+		return Array{number(int64(t.Year())), number(int64(t.Month())), number(int64(t.Day()))}
+	})},
+	"time.weekday":          {1, timeFunc(func(t time.Time) Value { return t.Weekday().String() })},
+	"time.parse_rfc3339_ns": {1, parseRFC3339},
+	"time.add_date":         {4, timeAddDate},
+}
+
+func numberArg(v Value, pos int) (*big.Rat, error) {
+	n, ok := v.(*big.Rat)
+	if !ok {
+		return nil, fmt.Errorf("operand %d must be number but got %s", pos, typeName(v))
+	}
+	return n, nil
+}
+
+func intArg(v Value, pos int) (int64, error) {
+	n, err := numberArg(v, pos)
+	if err != nil {
+		return 0, err
+	}
+	if !n.IsInt() || !n.Num().IsInt64() {
+		return 0, fmt.Errorf("operand %d must be an integer but got %s", pos, formatNumber(n))
+	}
+	return n.Num().Int64(), nil
+}
+
+func stringArg(v Value, pos int) (string, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("operand %d must be string but got %s", pos, typeName(v))
+	}
+	return s, nil
+}
+
+// elements returns the elements of an array or set
+func elements(v Value, pos int) ([]Value, error) {
+	switch v := v.(type) {
+	case Array:
+		return v, nil
+	case Set:
+		return v.Elements(), nil
+	}
+	return nil, fmt.Errorf("operand %d must be one of {array, set} but got %s", pos, typeName(v))
+}
+
+func arithmetic(op func(z, x, y *big.Rat) error) func(*evaluator, []Value) (Value, error) {
+	return func(_ *evaluator, a []Value) (Value, error) {
+		x, err := numberArg(a[0], 1)
+		if err != nil {
+			return nil, err
+		}
+		y, err := numberArg(a[1], 2)
+		if err != nil {
+			return nil, err
+		}
+		z := new(big.Rat)
+		if err := op(z, x, y); err != nil {
+			return nil, err
+		}
+		return z, nil
+	}
+}
+
+func divide(z, x, y *big.Rat) error {
+	if y.Sign() == 0 {
+		return errors.New("divide by zero")
+	}
+	z.Quo(x, y)
+	return nil
+}
+
+func remainder(z, x, y *big.Rat) error {
+	if !x.IsInt() || !y.IsInt() {
+		return errors.New("modulo on floating-point number")
+	}
+	if y.Sign() == 0 {
+		return errors.New("modulo by zero")
+	}
+	z.SetInt(new(big.Int).Rem(x.Num(), y.Num()))
+	return nil
+}
+
+// minus subtracts numbers or computes the difference of sets
+func minus(ev *evaluator, a []Value) (Value, error) {
+	if x, ok := a[0].(Set); ok {
+		y, ok := a[1].(Set)
+		if !ok {
+			return nil, fmt.Errorf("operand 2 must be set but got %s", typeName(a[1]))
+		}
+		diff := Set{}
+		for key, v := range x {
+			if _, ok := y[key]; !ok {
+				diff[key] = v
+			}
+		}
+		return diff, nil
+	}
+	return arithmetic(func(z, x, y *big.Rat) error { z.Sub(x, y); return nil })(ev, a)
+}
+
+// member implements x in coll: elements of arrays and sets, values of objects
+func member(_ *evaluator, a []Value) (Value, error) {
+	switch coll := a[1].(type) {
+	case Array:
+		for _, v := range coll {
+			if Equal(v, a[0]) {
+				return true, nil
+			}
+		}
+	case Set:
+		return coll.Contains(a[0]), nil
+	case Object:
+		for _, item := range coll {
+			if Equal(item.Value, a[0]) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func count(_ *evaluator, a []Value) (Value, error) {
+	switch v := a[0].(type) {
+	case Array:
+		return number(int64(len(v))), nil
+	case Object:
+		return number(int64(len(v))), nil
+	case Set:
+		return number(int64(len(v))), nil
+	case string:
+		return number(int64(utf8.RuneCountInString(v))), nil
+	}
+	return nil, fmt.Errorf("operand 1 must be one of {array, object, set, string} but got %s", typeName(a[0]))
+}
+
+func fold(initial int64, op func(z, x *big.Rat)) func(*evaluator, []Value) (Value, error) {
+	return func(_ *evaluator, a []Value) (Value, error) {
+		elems, err := elements(a[0], 1)
+		if err != nil {
+			return nil, err
+		}
+		z := number(initial)
+		for _, e := range elems {
+			n, ok := e.(*big.Rat)
+			if !ok {
+				return nil, fmt.Errorf("operand 1 must contain numbers but got %s", typeName(e))
+			}
+			op(z, n)
+		}
+		return z, nil
+	}
+}
+
+// extreme returns the largest (sign 1) or smallest (sign -1) element
+func extreme(sign int) func(*evaluator, []Value) (Value, error) {
+	return func(_ *evaluator, a []Value) (Value, error) {
+		elems, err := elements(a[0], 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(elems) == 0 {
+			return nil, errUndefined
+		}
+		best := elems[0]
+		for _, e := range elems[1:] {
+			if Compare(e, best)*sign > 0 {
+				best = e
+			}
+		}
+		return best, nil
+	}
+}
+
+func sortValues(_ *evaluator, a []Value) (Value, error) {
+	elems, err := elements(a[0], 1)
+	if err != nil {
+		return nil, err
+	}
+	sorted := append(Array{}, elems...)
+	sort.SliceStable(sorted, func(i, j int) bool { return Compare(sorted[i], sorted[j]) < 0 })
+	return sorted, nil
+}
+
+func arrayConcat(_ *evaluator, a []Value) (Value, error) {
+	x, ok := a[0].(Array)
+	if !ok {
+		return nil, fmt.Errorf("operand 1 must be array but got %s", typeName(a[0]))
+	}
+	y, ok := a[1].(Array)
+	if !ok {
+		return nil, fmt.Errorf("operand 2 must be array but got %s", typeName(a[1]))
+	}
+	return append(append(Array{}, x...), y...), nil
+}
+
+func arraySlice(_ *evaluator, a []Value) (Value, error) {
+	arr, ok := a[0].(Array)
+	if !ok {
+		return nil, fmt.Errorf("operand 1 must be array but got %s", typeName(a[0]))
+	}
+	start, err := intArg(a[1], 2)
+	if err != nil {
+		return nil, err
+	}
+	stop, err := intArg(a[2], 3)
+	if err != nil {
+		return nil, err
+	}
+	start = max(0, min(start, int64(len(arr))))
+	stop = max(start, min(stop, int64(len(arr))))
+	return append(Array{}, arr[start:stop]...), nil
+}
+
+func arrayReverse(_ *evaluator, a []Value) (Value, error) {
+	arr, ok := a[0].(Array)
+	if !ok {
+		return nil, fmt.Errorf("operand 1 must be array but got %s", typeName(a[0]))
+	}
+	reversed := make(Array, len(arr))
+	for i, v := range arr {
+		reversed[len(arr)-1-i] = v
+	}
+	return reversed, nil
+}
+
+// setFold computes the union or intersection of a set of sets
+func setFold(union bool) func(*evaluator, []Value) (Value, error) {
+	return func(_ *evaluator, a []Value) (Value, error) {
+		sets, ok := a[0].(Set)
+		if !ok {
+			return nil, fmt.Errorf("operand 1 must be set but got %s", typeName(a[0]))
+		}
+		var result Set
+		for _, s := range sets.Elements() {
+			set, ok := s.(Set)
+			if !ok {
+				return nil, fmt.Errorf("operand 1 must contain sets but got %s", typeName(s))
+			}
+			switch {
+			case result == nil:
+				result = Set{}
+				for key, v := range set {
+					result[key] = v
+				}
+			case union:
+				for key, v := range set {
+					result[key] = v
+				}
+			default:
+				for key := range result {
+					if _, ok := set[key]; !ok {
+						delete(result, key)
+					}
+				}
+			}
+		}
+		if result == nil {
+			result = Set{}
+		}
+		return result, nil
+	}
+}
+
+// objectGet returns the value at key, or at the path of an array key, or the default
+func objectGet(_ *evaluator, a []Value) (Value, error) {
+	if _, ok := a[0].(Object); !ok {
+		return nil, fmt.Errorf("operand 1 must be object but got %s", typeName(a[0]))
+	}
+	path, ok := a[1].(Array)
+	if !ok {
+		path = Array{a[1]}
+	}
+	v := a[0]
+	for _, key := range path {
+		child, ok := index(v, key)
+		if !ok {
+			return a[2], nil
+		}
+		v = child
+	}
+	return v, nil
+}
+
+func objectKeys(_ *evaluator, a []Value) (Value, error) {
+	obj, ok := a[0].(Object)
+	if !ok {
+		return nil, fmt.Errorf("operand 1 must be object but got %s", typeName(a[0]))
+	}
+	keys := Set{}
+	for _, item := range obj {
+		keys.Add(item.Key)
+	}
+	return keys, nil
+}
+
+// objectUnion merges b into a recursively; values of b win
+func objectUnion(a, b Value) (Value, error) {
+	x, ok := a.(Object)
+	if !ok {
+		return nil, fmt.Errorf("operand 1 must be object but got %s", typeName(a))
+	}
+	y, ok := b.(Object)
+	if !ok {
+		return nil, fmt.Errorf("operand 2 must be object but got %s", typeName(b))
+	}
+	merged := Object{}
+	for key, item := range x {
+		merged[key] = item
+	}
+	for key, item := range y {
+		existing, ok := merged[key]
+		_, bothObjects := existing.Value.(Object)
+		if _, ok2 := item.Value.(Object); ok && bothObjects && ok2 {
+			v, err := objectUnion(existing.Value, item.Value)
+			if err != nil {
+				return nil, err
+			}
+			item.Value = v
+		}
+		merged[key] = item
+	}
+	return merged, nil
+}
+
+func concat(_ *evaluator, a []Value) (Value, error) {
+	sep, err := stringArg(a[0], 1)
+	if err != nil {
+		return nil, err
+	}
+	elems, err := elements(a[1], 2)
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]string, len(elems))
+	for i, e := range elems {
+		s, ok := e.(string)
+		if !ok {
+			return nil, fmt.Errorf("operand 2 must contain strings but got %s", typeName(e))
+		}
+		parts[i] = s
+	}
+	return strings.Join(parts, sep), nil
+}
+
+func stringFunc1(fn func(string) string) func(*evaluator, []Value) (Value, error) {
+	return func(_ *evaluator, a []Value) (Value, error) {
+		s, err := stringArg(a[0], 1)
+		if err != nil {
+			return nil, err
+		}
+		return fn(s), nil
+	}
+}
+
+func stringFunc2(fn func(string, string) Value) func(*evaluator, []Value) (Value, error) {
+	return func(_ *evaluator, a []Value) (Value, error) {
+		s, err := stringArg(a[0], 1)
+		if err != nil {
+			return nil, err
+		}
+		t, err := stringArg(a[1], 2)
+		if err != nil {
+			return nil, err
+		}
+		return fn(s, t), nil
+	}
+}
+
+// indexOf returns the rune index of t in s, or -1
+func indexOf(s, t string) Value {
+	i := strings.Index(s, t)
+	if i < 0 {
+		return number(-1)
+	}
+	return number(int64(utf8.RuneCountInString(s[:i])))
+}
+
+func split(s, sep string) Value {
+	parts := strings.Split(s, sep)
+	arr := make(Array, len(parts))
+	for i, p := range parts {
+		arr[i] = p
+	}
+	return arr
+}
+
+func replace(_ *evaluator, a []Value) (Value, error) {
+	var s [3]string
+	for i := range s {
+		var err error
+		if s[i], err = stringArg(a[i], i+1); err != nil {
+			return nil, err
+		}
+	}
+	return strings.ReplaceAll(s[0], s[1], s[2]), nil
+}
+
+// substring returns length runes of s from offset; a negative length takes the rest
+func substring(_ *evaluator, a []Value) (Value, error) {
+	s, err := stringArg(a[0], 1)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := intArg(a[1], 2)
+	if err != nil {
+		return nil, err
+	}
+	length, err := intArg(a[2], 3)
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 {
+		return nil, errors.New("negative offset")
+	}
+	runes := []rune(s)
+	if offset >= int64(len(runes)) {
+		return "", nil
+	}
+	end := int64(len(runes))
+	if length >= 0 && offset+length < end {
+		end = offset + length
+	}
+	return string(runes[offset:end]), nil
+}
+
+// sprintf formats with Go verbs; numbers are passed as integers or floats
+func sprintf(_ *evaluator, a []Value) (Value, error) {
+	format, err := stringArg(a[0], 1)
+	if err != nil {
+		return nil, err
+	}
+	args, ok := a[1].(Array)
+	if !ok {
+		return nil, fmt.Errorf("operand 2 must be array but got %s", typeName(a[1]))
+	}
+	native := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case *big.Rat:
+			if v.IsInt() && v.Num().IsInt64() {
+				native[i] = v.Num().Int64()
+			} else {
+				native[i], _ = v.Float64()
+			}
+		case string, bool:
+			native[i] = v
+		default:
+			native[i] = String(v)
+		}
+	}
+	return fmt.Sprintf(format, native...), nil
+}
+
+func formatInt(_ *evaluator, a []Value) (Value, error) {
+	n, err := numberArg(a[0], 1)
+	if err != nil {
+		return nil, err
+	}
+	base, err := intArg(a[1], 2)
+	if err != nil {
+		return nil, err
+	}
+	if base != 2 && base != 8 && base != 10 && base != 16 {
+		return nil, fmt.Errorf("operand 2 must be one of {2, 8, 10, 16}")
+	}
+	truncated := new(big.Int).Quo(n.Num(), n.Denom())
+	return truncated.Text(int(base)), nil
+}
+
+func regexMatch(_ *evaluator, a []Value) (Value, error) {
+	pattern, err := stringArg(a[0], 1)
+	if err != nil {
+		return nil, err
+	}
+	s, err := stringArg(a[1], 2)
+	if err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return re.MatchString(s), nil
+}
+
+func base64Decode(_ *evaluator, a []Value) (Value, error) {
+	s, err := stringArg(a[0], 1)
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return string(decoded), nil
+}
+
+func jsonMarshal(_ *evaluator, a []Value) (Value, error) {
+	encoded, err := json.Marshal(ToJSON(a[0]))
+	if err != nil {
+		return nil, err
+	}
+	return string(encoded), nil
+}
+
+func toNumber(_ *evaluator, a []Value) (Value, error) {
+	switch v := a[0].(type) {
+	case nil:
+		return number(0), nil
+	case bool:
+		if v {
+			return number(1), nil
+		}
+		return number(0), nil
+	case *big.Rat:
+		return v, nil
+	case string:
+		n, ok := new(big.Rat).SetString(v)
+		if !ok {
+			return nil, fmt.Errorf("invalid number %q", v)
+		}
+		return n, nil
+	}
+	return nil, fmt.Errorf("operand 1 must be one of {boolean, null, number, string} but got %s", typeName(a[0]))
+}
+
+func isType(name string) func(*evaluator, []Value) (Value, error) {
+	return func(_ *evaluator, a []Value) (Value, error) {
+		return typeName(a[0]) == name, nil
+	}
+}
+
+func numberFunc(fn func(z, x *big.Rat)) func(*evaluator, []Value) (Value, error) {
+	return func(_ *evaluator, a []Value) (Value, error) {
+		x, err := numberArg(a[0], 1)
+		if err != nil {
+			return nil, err
+		}
+		z := new(big.Rat)
+		fn(z, x)
+		return z, nil
+	}
+}
+
+// roundRat rounds x half away from zero (mode 0), up (1) or down (-1)
+func roundRat(z, x *big.Rat, mode int) {
+	if x.IsInt() {
+		z.Set(x)
+		return
+	}
+	q, r := new(big.Int).QuoRem(x.Num(), x.Denom(), new(big.Int))
+	// q is truncated towards zero; r has the sign of x
+	switch mode {
+	case 1:
+		if r.Sign() > 0 {
+			q.Add(q, big.NewInt(1))
+		}
+	case -1:
+		if r.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		}
+	default:
+		twice := new(big.Int).Mul(new(big.Int).Abs(r), big.NewInt(2))
+		if twice.Cmp(x.Denom()) >= 0 {
+			q.Add(q, big.NewInt(int64(r.Sign())))
+		}
+	}
+	z.SetInt(q)
+}
+
+// timeFunc reads a time from nanoseconds since the epoch, or [ns, timezone]; UTC by default
+func timeFunc(fn func(time.Time) Value) func(*evaluator, []Value) (Value, error) {
+	return func(_ *evaluator, a []Value) (Value, error) {
+		arg, zone := a[0], "UTC"
+		if arr, ok := arg.(Array); ok {
+			if len(arr) == 0 || len(arr) > 2 {
+				return nil, errors.New("operand 1 must be a number or [number, timezone]")
+			}
+			arg = arr[0]
+			if len(arr) == 2 {
+				var err error
+				if zone, err = stringArg(arr[1], 1); err != nil {
+					return nil, err
+				}
+			}
+		}
+		ns, err := intArg(arg, 1)
+		if err != nil {
+			return nil, err
+		}
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return nil, err
+		}
+		return fn(time.Unix(0, ns).In(loc)), nil
+	}
+}
+
+func parseRFC3339(_ *evaluator, a []Value) (Value, error) {
+	s, err := stringArg(a[0], 1)
+	if err != nil {
+		return nil, err
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return nil, err
+	}
+	return number(t.UnixNano()), nil
+}
+
+// setOp computes the union (a | b) or intersection (a & b) of two sets
+func setOp(union bool) func(*evaluator, []Value) (Value, error) {
+	return func(_ *evaluator, a []Value) (Value, error) {
+		x, ok := a[0].(Set)
+		if !ok {
+			return nil, fmt.Errorf("operand 1 must be set but got %s", typeName(a[0]))
+		}
+		y, ok := a[1].(Set)
+		if !ok {
+			return nil, fmt.Errorf("operand 2 must be set but got %s", typeName(a[1]))
+		}
+		result := Set{}
+		for key, v := range x {
+			if _, ok := y[key]; union || ok {
+				result[key] = v
+			}
+		}
+		if union {
+			for key, v := range y {
+				result[key] = v
+			}
+		}
+		return result, nil
+	}
+}
+
+func objectUnionN(_ *evaluator, a []Value) (Value, error) {
+	objects, ok := a[0].(Array)
+	if !ok {
+		return nil, fmt.Errorf("operand 1 must be array but got %s", typeName(a[0]))
+	}
+	var merged Value = Object{}
+	for _, obj := range objects {
+		var err error
+		if merged, err = objectUnion(merged, obj); err != nil {
+			return nil, err
+		}
+	}
+	return merged, nil
+}
+
+// objectFilter keeps (object.filter) or removes (object.remove) the keys given as an array,
+// a set or the keys of an object
+func objectFilter(keep bool) func(*evaluator, []Value) (Value, error) {
+	return func(_ *evaluator, a []Value) (Value, error) {
+		obj, ok := a[0].(Object)
+		if !ok {
+			return nil, fmt.Errorf("operand 1 must be object but got %s", typeName(a[0]))
+		}
+		keys := Set{}
+		switch k := a[1].(type) {
+		case Array:
+			for _, key := range k {
+				keys.Add(key)
+			}
+		case Set:
+			keys = k
+		case Object:
+			for _, item := range k {
+				keys.Add(item.Key)
+			}
+		default:
+			return nil, fmt.Errorf("operand 2 must be one of {array, object, set} but got %s", typeName(a[1]))
+		}
+		result := Object{}
+		for key, item := range obj {
+			if keys.Contains(item.Key) == keep {
+				result[key] = item
+			}
+		}
+		return result, nil
+	}
+}
+
+func objectSubset(_ *evaluator, a []Value) (Value, error) {
+	for i, v := range a {
+		switch v.(type) {
+		case Array, Object, Set:
+		default:
+			return nil, fmt.Errorf("operand %d must be one of {array, object, set} but got %s", i+1, typeName(v))
+		}
+	}
+	return isSubset(a[0], a[1]), nil
+}
+
+// isSubset reports whether sub is part of super: objects whose keys super has with values
+// that are subsets in turn, sets and arrays of elements of super, or arrays appearing in a
+// super array as a contiguous sequence
+func isSubset(super, sub Value) bool {
+	switch sub := sub.(type) {
+	case Object:
+		sup, ok := super.(Object)
+		if !ok {
+			return false
+		}
+		for _, item := range sub {
+			v, ok := sup.Get(item.Key)
+			if !ok || !isSubset(v, item.Value) {
+				return false
+			}
+		}
+		return true
+	case Set:
+		switch sup := super.(type) {
+		case Set:
+			for key := range sub {
+				if _, ok := sup[key]; !ok {
+					return false
+				}
+			}
+			return true
+		case Array:
+			for _, v := range sub {
+				if found, _ := member(nil, []Value{v, sup}); !found.(bool) {
+					return false
+				}
+			}
+			return true
+		}
+		return false
+	case Array:
+		sup, ok := super.(Array)
+		if !ok {
+			return false
+		}
+		for start := 0; start+len(sub) <= len(sup); start++ {
+			if compareSlices(sup[start:start+len(sub)], sub) == 0 {
+				return true
+			}
+		}
+		return false
+	}
+	return Equal(super, sub)
+}
+
+// numbersRange returns the integers from a to b, both included, counting down if b < a
+func numbersRange(_ *evaluator, a []Value) (Value, error) {
+	from, err := numberArg(a[0], 1)
+	if err != nil {
+		return nil, err
+	}
+	to, err := numberArg(a[1], 2)
+	if err != nil {
+		return nil, err
+	}
+	if !from.IsInt() || !to.IsInt() {
+		return nil, errors.New("operands must be integers")
+	}
+	step := big.NewInt(1)
+	if to.Cmp(from) < 0 {
+		step.Neg(step)
+	}
+	var result Array
+	for i, end := new(big.Int).Set(from.Num()), to.Num(); ; i.Add(i, step) {
+		result = append(result, new(big.Rat).SetInt(i))
+		if i.Cmp(end) == 0 {
+			return result, nil
+		}
+	}
+}
+
+func walk(a []Value, yield func(Value) error) error {
+	return walkValue(Array{}, a[0], yield)
+}
+
+// walkValue yields [path, value] for v and then for its descendants, depth first
+func walkValue(path Array, v Value, yield func(Value) error) error {
+	if err := yield(Array{path, v}); err != nil {
+		return err
+	}
+	var children []ObjectItem
+	switch v := v.(type) {
+	case Array:
+		for i, e := range v {
+			children = append(children, ObjectItem{Key: number(int64(i)), Value: e})
+		}
+	case Object:
+		children = v.Items()
+	case Set:
+		for _, e := range v.Elements() {
+			children = append(children, ObjectItem{Key: e, Value: e})
+		}
+	}
+	for _, child := range children {
+		if err := walkValue(append(path[:len(path):len(path)], child.Key), child.Value, yield); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compileRegex compiles the pattern operand at pos
+func compileRegex(v Value, pos int) (*regexp.Regexp, error) {
+	pattern, err := stringArg(v, pos)
+	if err != nil {
+		return nil, err
+	}
+	return regexp.Compile(pattern)
+}
+
+func regexFindN(_ *evaluator, a []Value) (Value, error) {
+	re, err := compileRegex(a[0], 1)
+	if err != nil {
+		return nil, err
+	}
+	s, err := stringArg(a[1], 2)
+	if err != nil {
+		return nil, err
+	}
+	n, err := intArg(a[2], 3)
+	if err != nil {
+		return nil, err
+	}
+	result := Array{}
+	for _, match := range re.FindAllString(s, int(n)) {
+		result = append(result, match)
+	}
+	return result, nil
+}
+
+func regexSplit(_ *evaluator, a []Value) (Value, error) {
+	re, err := compileRegex(a[0], 1)
+	if err != nil {
+		return nil, err
+	}
+	s, err := stringArg(a[1], 2)
+	if err != nil {
+		return nil, err
+	}
+	result := Array{}
+	for _, part := range re.Split(s, -1) {
+		result = append(result, part)
+	}
+	return result, nil
+}
+
+// regexReplace replaces the matches of the pattern in s; $1 in the replacement expands to a
+// submatch
+func regexReplace(_ *evaluator, a []Value) (Value, error) {
+	s, err := stringArg(a[0], 1)
+	if err != nil {
+		return nil, err
+	}
+	re, err := compileRegex(a[1], 2)
+	if err != nil {
+		return nil, err
+	}
+	replacement, err := stringArg(a[2], 3)
+	if err != nil {
+		return nil, err
+	}
+	return re.ReplaceAllString(s, replacement), nil
+}
+
+// stringsArg returns a string operand, or the strings of an array or set operand
+func stringsArg(v Value, pos int) ([]string, error) {
+	if s, ok := v.(string); ok {
+		return []string{s}, nil
+	}
+	elems, err := elements(v, pos)
+	if err != nil {
+		return nil, fmt.Errorf("operand %d must be one of {array, set, string} but got %s", pos, typeName(v))
+	}
+	result := make([]string, len(elems))
+	for i, e := range elems {
+		s, ok := e.(string)
+		if !ok {
+			return nil, fmt.Errorf("operand %d must contain strings but got %s", pos, typeName(e))
+		}
+		result[i] = s
+	}
+	return result, nil
+}
+
+// anyMatch reports whether any of the search strings has any of the base strings as prefix or
+// suffix
+func anyMatch(match func(s, affix string) bool) func(*evaluator, []Value) (Value, error) {
+	return func(_ *evaluator, a []Value) (Value, error) {
+		search, err := stringsArg(a[0], 1)
+		if err != nil {
+			return nil, err
+		}
+		base, err := stringsArg(a[1], 2)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range search {
+			for _, affix := range base {
+				if match(s, affix) {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	}
+}
+
+// replaceN replaces the keys of an object with their values in s, in a single pass
+func replaceN(_ *evaluator, a []Value) (Value, error) {
+	patterns, ok := a[0].(Object)
+	if !ok {
+		return nil, fmt.Errorf("operand 1 must be object but got %s", typeName(a[0]))
+	}
+	s, err := stringArg(a[1], 2)
+	if err != nil {
+		return nil, err
+	}
+	var pairs []string
+	for _, item := range patterns.Items() {
+		old, ok := item.Key.(string)
+		if !ok {
+			return nil, fmt.Errorf("operand 1 keys must be strings but got %s", typeName(item.Key))
+		}
+		replacement, ok := item.Value.(string)
+		if !ok {
+			return nil, fmt.Errorf("operand 1 values must be strings but got %s", typeName(item.Value))
+		}
+		pairs = append(pairs, old, replacement)
+	}
+	return strings.NewReplacer(pairs...).Replace(s), nil
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	slices.Reverse(runes)
+	return string(runes)
+}
+
+func base64URLDecode(_ *evaluator, a []Value) (Value, error) {
+	s, err := stringArg(a[0], 1)
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+	return string(decoded), nil
+}
+
+func hexDecode(_ *evaluator, a []Value) (Value, error) {
+	s, err := stringArg(a[0], 1)
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return string(decoded), nil
+}
+
+func urlqueryDecode(_ *evaluator, a []Value) (Value, error) {
+	s, err := stringArg(a[0], 1)
+	if err != nil {
+		return nil, err
+	}
+	return url.QueryUnescape(s)
+}
+
+// digest returns the hex encoded hash of s
+func digest(h hash.Hash, s string) string {
+	h.Write([]byte(s))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// decodeJSON decodes a JSON document into a value, keeping numbers exact
+func decodeJSON(s string) (Value, error) {
+	decoder := json.NewDecoder(strings.NewReader(s))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after the JSON document")
+	}
+	return FromJSON(doc)
+}
+
+func jsonUnmarshal(_ *evaluator, a []Value) (Value, error) {
+	s, err := stringArg(a[0], 1)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON(s)
+}
+
+// jwtDecode returns the header and payload of a compact JWS and its hex encoded signature,
+// without verifying it
+func jwtDecode(_ *evaluator, a []Value) (Value, error) {
+	token, err := stringArg(a[0], 1)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("encoded JWT must have 3 sections")
+	}
+	decoded := make([]string, 3)
+	for i, part := range parts {
+		b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(part, "="))
+		if err != nil {
+			return nil, fmt.Errorf("JWT section %d: %w", i+1, err)
+		}
+		decoded[i] = string(b)
+	}
+	header, err := decodeJSON(decoded[0])
+	if err != nil {
+		return nil, fmt.Errorf("JWT header: %w", err)
+	}
+	payload, err := decodeJSON(decoded[1])
+	if err != nil {
+		return nil, fmt.Errorf("JWT payload: %w", err)
+	}
+	if _, ok := header.(Object); !ok {
+		return nil, errors.New("JWT header must be an object")
+	}
+	if _, ok := payload.(Object); !ok {
+		return nil, errors.New("JWT payload must be an object")
+	}
+	return Array{header, payload, hex.EncodeToString([]byte(decoded[2]))}, nil
+}
+
+// byteUnits are the multiples units.parse_bytes accepts, in lower case
+var byteUnits = map[string]int64{
+	"":  1,
+	"k": 1e3, "kb": 1e3, "ki": 1 << 10, "kib": 1 << 10,
+	"m": 1e6, "mb": 1e6, "mi": 1 << 20, "mib": 1 << 20,
+	"g": 1e9, "gb": 1e9, "gi": 1 << 30, "gib": 1 << 30,
+	"t": 1e12, "tb": 1e12, "ti": 1 << 40, "tib": 1 << 40,
+	"p": 1e15, "pb": 1e15, "pi": 1 << 50, "pib": 1 << 50,
+	"e": 1e18, "eb": 1e18, "ei": 1 << 60, "eib": 1 << 60,
+}
+
+// unitsParseBytes converts an amount like 10KB or 1.5GiB into a number of bytes
+func unitsParseBytes(_ *evaluator, a []Value) (Value, error) {
+	s, err := stringArg(a[0], 1)
+	if err != nil {
+		return nil, err
+	}
+	s = strings.ToLower(strings.ReplaceAll(s, `"`, ""))
+	if strings.Contains(s, " ") {
+		return nil, errors.New("spaces not allowed in resource strings")
+	}
+	end := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if end < 0 {
+		end = len(s)
+	}
+	if end == 0 {
+		return nil, errors.New("no byte amount provided")
+	}
+	amount, ok := new(big.Rat).SetString(s[:end])
+	if !ok {
+		return nil, fmt.Errorf("could not parse byte amount %q", s[:end])
+	}
+	unit, ok := byteUnits[s[end:]]
+	if !ok {
+		return nil, fmt.Errorf("byte unit %s not recognized", s[end:])
+	}
+	amount.Mul(amount, new(big.Rat).SetInt64(unit))
+	return new(big.Rat).SetInt(new(big.Int).Quo(amount.Num(), amount.Denom())), nil
+}
+
+func cidrContains(_ *evaluator, a []Value) (Value, error) {
+	network, err := prefixArg(a[0], 1)
+	if err != nil {
+		return nil, err
+	}
+	s, err := stringArg(a[1], 2)
+	if err != nil {
+		return nil, err
+	}
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return network.Contains(addr), nil
+	}
+	other, err := prefixArg(s, 2)
+	if err != nil {
+		return nil, err
+	}
+	return network.Bits() <= other.Bits() && network.Contains(other.Masked().Addr()), nil
+}
+
+func cidrIntersects(_ *evaluator, a []Value) (Value, error) {
+	x, err := prefixArg(a[0], 1)
+	if err != nil {
+		return nil, err
+	}
+	y, err := prefixArg(a[1], 2)
+	if err != nil {
+		return nil, err
+	}
+	return x.Overlaps(y), nil
+}
+
+func prefixArg(v Value, pos int) (netip.Prefix, error) {
+	s, err := stringArg(v, pos)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.ParsePrefix(s)
+}
+
+// semver is a parsed semantic version; build metadata does not take part in comparisons
+type semver struct {
+	core       [3]*big.Int
+	prerelease []string
+}
+
+func parseSemver(s string) (semver, error) {
+	var v semver
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		if !validIdentifiers(s[i+1:], false) {
+			return v, fmt.Errorf("invalid build metadata in %q", s)
+		}
+		s = s[:i]
+	}
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		if !validIdentifiers(s[i+1:], true) {
+			return v, fmt.Errorf("invalid pre-release in %q", s)
+		}
+		v.prerelease = strings.Split(s[i+1:], ".")
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return v, fmt.Errorf("%q is not a semantic version", s)
+	}
+	for i, part := range parts {
+		if !numericIdentifier(part) {
+			return v, fmt.Errorf("%q is not a semantic version", s)
+		}
+		v.core[i], _ = new(big.Int).SetString(part, 10)
+	}
+	return v, nil
+}
+
+// validIdentifiers reports whether s is a dot separated list of alphanumeric identifiers;
+// numeric pre-release identifiers must not have leading zeros
+func validIdentifiers(s string, prerelease bool) bool {
+	for _, id := range strings.Split(s, ".") {
+		if id == "" || strings.TrimLeft(id, "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ-") != "" {
+			return false
+		}
+		if prerelease && isDigits(id) && !numericIdentifier(id) {
+			return false
+		}
+	}
+	return true
+}
+
+func isDigits(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789") == ""
+}
+
+func numericIdentifier(s string) bool {
+	return isDigits(s) && (s == "0" || s[0] != '0')
+}
+
+func (v semver) compare(w semver) int {
+	for i := range v.core {
+		if c := v.core[i].Cmp(w.core[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(v.prerelease) == 0 && len(w.prerelease) == 0:
+		return 0
+	case len(v.prerelease) == 0:
+		return 1
+	case len(w.prerelease) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.prerelease) && i < len(w.prerelease); i++ {
+		a, b := v.prerelease[i], w.prerelease[i]
+		aNum, bNum := isDigits(a), isDigits(b)
+		switch {
+		case aNum && bNum:
+			x, _ := new(big.Int).SetString(a, 10)
+			y, _ := new(big.Int).SetString(b, 10)
+			if c := x.Cmp(y); c != 0 {
+				return c
+			}
+		case aNum:
+			return -1
+		case bNum:
+			return 1
+		default:
+			if c := strings.Compare(a, b); c != 0 {
+				return c
+			}
+		}
+	}
+	return cmp.Compare(len(v.prerelease), len(w.prerelease))
+}
+
+func semverCompare(_ *evaluator, a []Value) (Value, error) {
+	var versions [2]semver
+	for i := range versions {
+		s, err := stringArg(a[i], i+1)
+		if err != nil {
+			return nil, err
+		}
+		if versions[i], err = parseSemver(s); err != nil {
+			return nil, err
+		}
+	}
+	return number(int64(versions[0].compare(versions[1]))), nil
+}
+
+// timeAddDate adds years, months and days to a time in nanoseconds since the epoch, in UTC
+func timeAddDate(_ *evaluator, a []Value) (Value, error) {
+	ns, err := intArg(a[0], 1)
+	if err != nil {
+		return nil, err
+	}
+	var delta [3]int64
+	for i := range delta {
+		if delta[i], err = intArg(a[i+1], i+2); err != nil {
+			return nil, err
+		}
+	}
+	t := time.Unix(0, ns).UTC().AddDate(int(delta[0]), int(delta[1]), int(delta[2]))
+	return number(t.UnixNano()), nil
+}
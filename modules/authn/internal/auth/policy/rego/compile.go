@@ -0,0 +1,601 @@
+// Package rego compiles and evaluates Rego policies in-process. It covers packages, imports
+// of input and data, default, complete, partial set, partial object and function rules, rules
+// with dotted names, else, some, every, not, with, comprehensions, print and the deterministic
+// built-ins OPA provides for policies. Nothing a policy calls can reach the network or the
+// runtime. The modules in testdata hold test rules that pass both here and with opa test.
+package rego
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Error codes, named like OPA's
+const (
+	parseErrorCode    = "rego_parse_error"
+	compileErrorCode  = "rego_compile_error"
+	typeErrorCode     = "rego_type_error"
+	unsafeVarCode     = "rego_unsafe_var_error"
+	recursionCode     = "rego_recursion_error"
+	conflictErrorCode = "eval_conflict_error"
+	builtinErrorCode  = "eval_builtin_error"
+	cancelErrorCode   = "eval_cancel_error"
+)
+
+// Error is a parse, compile or evaluation error
+type Error struct {
+	Code    string
+	Module  string
+	Line    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Module == "" {
+		return fmt.Sprintf("%s: %s", e.Code, e.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s: %s", e.Module, e.Line, e.Code, e.Message)
+}
+
+// ruleGroup holds the definitions of one rule of a package
+type ruleGroup struct {
+	name string
+	kind ruleKind
+	defs []*Rule
+	def  *Rule // Default definition
+}
+
+// pkg holds the rules of a package, including those that rules with dotted names such as
+// a.b.c define under packages they do not declare
+type pkg struct {
+	path  []string
+	rules map[string]*ruleGroup
+	node  *node
+}
+
+// node is a package path segment of the data tree
+type node struct {
+	path     []string
+	children map[string]*node
+	pkg      *pkg
+}
+
+// Program is a set of compiled modules
+type Program struct {
+	root     *node
+	imports  map[string]map[string][]string // Module name to its imports
+	packages map[string]*pkg                // Module name to its package
+	confined []string                       // Package the modules are confined to, if any
+	print    io.Writer
+	strict   bool
+	external bool // Functions unknown to the checker are left to the engine that evaluates the modules
+}
+
+// Option configures the compilation of a Program
+type Option func(*Program)
+
+// WithPackage requires every module to declare the package path, and confines their references
+// to data to the document data.<path>, so that modules loaded into an OPA server shared with
+// other tenants can neither add rules to the packages of the others nor read their documents
+func WithPackage(path ...string) Option {
+	return func(prog *Program) {
+		prog.confined = path
+	}
+}
+
+// WithPrintHook writes the output of print calls to w; without it, print output is dropped
+func WithPrintHook(w io.Writer) Option {
+	return func(prog *Program) {
+		prog.print = w
+	}
+}
+
+// WithStrictBuiltinErrors fails evaluations on built-in errors, such as a division by zero.
+// By default, like OPA, the expression calling the built-in is undefined instead.
+func WithStrictBuiltinErrors() Option {
+	return func(prog *Program) {
+		prog.strict = true
+	}
+}
+
+// WithExternalFunctions accepts calls of functions the checker does not know, for modules that
+// are checked here but evaluated by an OPA server, whose version may provide more built-ins.
+// Restricted functions are still rejected, and such programs are not meant to be evaluated.
+func WithExternalFunctions() Option {
+	return func(prog *Program) {
+		prog.external = true
+	}
+}
+
+// restrictedFunctions are OPA built-ins that reach the network or expose the runtime, such as
+// its environment variables
+var restrictedFunctions = map[string]bool{"http.send": true, "net.lookup_ip_addr": true, "opa.runtime": true}
+
+// Compile parses and checks modules, given as module name to source
+func Compile(modules map[string]string, opts ...Option) (*Program, error) {
+	prog := &Program{
+		root:     &node{children: map[string]*node{}},
+		imports:  map[string]map[string][]string{},
+		packages: map[string]*pkg{},
+	}
+	for _, opt := range opts {
+		opt(prog)
+	}
+
+	names := make([]string, 0, len(modules))
+	for name := range modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var parsed []*Module
+	for _, name := range names {
+		module, err := parseModule(name, modules[name])
+		if err != nil {
+			return nil, err
+		}
+		if err := prog.checkModule(module); err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, module)
+		prog.imports[name] = module.Imports
+		prog.packages[name] = prog.packageNode(module.Package).pkg
+		for _, rule := range module.Rules {
+			path := append(append([]string{}, module.Package...), rule.Path[:len(rule.Path)-1]...)
+			if err := prog.packageNode(path).pkg.add(rule.Path[len(rule.Path)-1], rule); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := checkConflicts(prog.root); err != nil {
+		return nil, err
+	}
+
+	for _, module := range parsed {
+		p := prog.packages[module.Name]
+		for _, rule := range module.Rules {
+			c := &checker{prog: prog, pkg: p, rule: rule}
+			if err := c.check(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return prog, nil
+}
+
+// checkModule verifies that a module declares the package it is confined to, and that its data
+// imports are in that package
+func (prog *Program) checkModule(module *Module) error {
+	if prog.confined == nil {
+		return nil
+	}
+	pkg := strings.Join(prog.confined, ".")
+	if !slices.Equal(module.Package, prog.confined) {
+		return &Error{Code: compileErrorCode, Module: module.Name, Line: 1, Message: fmt.Sprintf("package %s must be %s", strings.Join(module.Package, "."), pkg)}
+	}
+	for _, path := range module.Imports {
+		if path[0] == "data" && (len(path) <= len(prog.confined) || !slices.Equal(path[1:len(prog.confined)+1], prog.confined)) {
+			return &Error{Code: compileErrorCode, Module: module.Name, Line: 1, Message: fmt.Sprintf("import %s must be in data.%s", strings.Join(path, "."), pkg)}
+		}
+	}
+	return nil
+}
+
+func (prog *Program) packageNode(path []string) *node {
+	n := prog.root
+	for i, segment := range path {
+		child, ok := n.children[segment]
+		if !ok {
+			child = &node{path: path[: i+1 : i+1], children: map[string]*node{}}
+			n.children[segment] = child
+		}
+		n = child
+	}
+	if n.pkg == nil {
+		n.pkg = &pkg{path: n.path, rules: map[string]*ruleGroup{}, node: n}
+	}
+	return n
+}
+
+// checkConflicts fails when a rule and a package, or the prefix of a dotted rule name, define
+// the same document
+func checkConflicts(n *node) error {
+	for name, child := range n.children {
+		if n.pkg != nil {
+			if group, ok := n.pkg.rules[name]; ok {
+				rule := group.def
+				if len(group.defs) > 0 {
+					rule = group.defs[0]
+				}
+				return compileError(rule, "rule %s conflicts with package %s", rule.Name, strings.Join(child.path, "."))
+			}
+		}
+		if err := checkConflicts(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (prog *Program) lookupPackage(path []string) *pkg {
+	n := prog.root
+	for _, segment := range path {
+		if n = n.children[segment]; n == nil {
+			return nil
+		}
+	}
+	return n.pkg
+}
+
+// add adds a definition of the rule called name in the package
+func (p *pkg) add(name string, rule *Rule) error {
+	group, ok := p.rules[name]
+	if !ok {
+		group = &ruleGroup{name: rule.Name, kind: rule.Kind}
+		p.rules[name] = group
+	}
+	if group.kind != rule.Kind {
+		return compileError(rule, "conflicting definitions of rule %s", rule.Name)
+	}
+	if group.kind == ruleFunction && len(group.defs) > 0 && len(group.defs[0].Args) != len(rule.Args) {
+		return compileError(rule, "function %s has definitions with different numbers of arguments", rule.Name)
+	}
+	if rule.Default {
+		if group.def != nil {
+			return compileError(rule, "multiple default rules %s", rule.Name)
+		}
+		group.def = rule
+		return nil
+	}
+	group.defs = append(group.defs, rule)
+	return nil
+}
+
+func compileError(rule *Rule, format string, args ...interface{}) *Error {
+	return &Error{Code: compileErrorCode, Module: rule.Module, Line: rule.Line, Message: fmt.Sprintf(format, args...)}
+}
+
+// Eval evaluates the document at path under data, e.g. ["demo", "authz"] for data.demo.authz,
+// with input. Packages evaluate to an object of their defined rules. Evaluation stops when
+// ctx is done.
+func (prog *Program) Eval(ctx context.Context, path []string, input Value) (Value, bool, error) {
+	ev := &evaluator{
+		ctx:   ctx,
+		prog:  prog,
+		input: input,
+		now:   time.Now(),
+		rules: map[*ruleGroup]*ruleResult{},
+	}
+	f := &frame{ev: ev}
+	var result Value
+	defined := false
+	err := f.walkData(prog.root, scalarPath(path), nil, func(v Value, _ *env) error {
+		result, defined = v, true
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return result, defined, nil
+}
+
+func scalarPath(path []string) []Term {
+	terms := make([]Term, len(path))
+	for i, segment := range path {
+		terms[i] = Scalar{Value: segment}
+	}
+	return terms
+}
+
+// checker verifies that a rule only calls known functions with the right number of
+// arguments, assigns each variable of a body once, has a constant default value and only
+// replaces input, data and functions with with
+type checker struct {
+	prog *Program
+	pkg  *pkg
+	rule *Rule
+}
+
+func (c *checker) check() error {
+	if c.rule.Default && !constant(c.rule.Value) {
+		return compileError(c.rule, "default rule %s must have a constant value", c.rule.Name)
+	}
+	for rule := c.rule; rule != nil; rule = rule.Else {
+		for _, t := range append([]Term{rule.Key, rule.Value}, rule.Args...) {
+			if err := c.term(t); err != nil {
+				return err
+			}
+		}
+		if err := c.body(rule.Body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *checker) body(body []*Expr) error {
+	assigned := map[string]bool{}
+	for _, e := range body {
+		if e.Assign != nil {
+			for _, name := range patternVars(e.Assign.Left) {
+				if assigned[name] {
+					return &Error{Code: compileErrorCode, Module: c.rule.Module, Line: e.Line, Message: fmt.Sprintf("var %s assigned above", name)}
+				}
+				assigned[name] = true
+			}
+		}
+		if err := c.expr(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *checker) expr(e *Expr) error {
+	for _, w := range e.With {
+		if err := c.with(w); err != nil {
+			return err
+		}
+	}
+	switch {
+	case e.Not != nil:
+		return c.expr(e.Not)
+	case e.Some != nil:
+		return c.terms(e.Some.Key, e.Some.Value, e.Some.Collection)
+	case e.Every != nil:
+		if err := c.terms(e.Every.Key, e.Every.Value, e.Every.Collection); err != nil {
+			return err
+		}
+		return c.body(e.Every.Body)
+	case e.Assign != nil:
+		return c.terms(e.Assign.Left, e.Assign.Right)
+	case e.Unify != nil:
+		return c.terms(e.Unify.Left, e.Unify.Right)
+	}
+	return c.term(e.Term)
+}
+
+func (c *checker) terms(terms ...Term) error {
+	for _, t := range terms {
+		if err := c.term(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *checker) term(t Term) error {
+	switch t := t.(type) {
+	case Var:
+		if t.Name == "data" && c.prog.confined != nil {
+			return c.outsideRoot("data")
+		}
+	case Ref:
+		if head, ok := t.Head.(Var); ok && head.Name == "data" && c.prog.confined != nil {
+			if len(t.Path) < len(c.prog.confined) {
+				return c.outsideRoot("data")
+			}
+			for i, segment := range c.prog.confined {
+				key, ok := t.Path[i].(Scalar)
+				if !ok {
+					return c.outsideRoot("data[...]")
+				}
+				if key.Value != segment {
+					return c.outsideRoot(strings.Join(append(append([]string{"data"}, c.prog.confined[:i]...), fmt.Sprint(key.Value)), "."))
+				}
+			}
+		} else if err := c.term(t.Head); err != nil {
+			return err
+		}
+		return c.terms(t.Path...)
+	case Call:
+		if err := c.call(t, true); err != nil {
+			return err
+		}
+		return c.terms(t.Args...)
+	case ArrayTerm:
+		return c.terms(t.Elems...)
+	case SetTerm:
+		return c.terms(t.Elems...)
+	case ObjectTerm:
+		for _, item := range t.Items {
+			if err := c.terms(item[0], item[1]); err != nil {
+				return err
+			}
+		}
+	case Comprehension:
+		if err := c.terms(t.Key, t.Value); err != nil {
+			return err
+		}
+		return c.body(t.Body)
+	}
+	return nil
+}
+
+// with verifies that a modifier replaces the input document, a document under data or a
+// function, and that a function is only replaced with a value or another function
+func (c *checker) with(w *With) error {
+	if err := c.term(w.Value); err != nil {
+		return err
+	}
+	path, ok := refPath(w.Target)
+	if ok {
+		if alias, ok := c.prog.imports[c.rule.Module][path[0]]; ok {
+			path = append(append([]string{}, alias...), path[1:]...)
+		}
+	}
+	switch {
+	case !ok:
+		return &Error{Code: typeErrorCode, Module: c.rule.Module, Line: c.rule.Line, Message: "with target must be a reference"}
+	case path[0] == "input":
+		return nil
+	case path[0] == "data":
+		return c.term(w.Target)
+	}
+	name := strings.Join(path, ".")
+	if !c.function(name) && !restrictedFunctions[name] {
+		return &Error{Code: typeErrorCode, Module: c.rule.Module, Line: c.rule.Line, Message: fmt.Sprintf("with target %s must be input, data or a function", name)}
+	}
+	if err := c.call(Call{Name: name, Line: c.rule.Line}, false); err != nil {
+		return err
+	}
+	if path, ok := refPath(w.Value); ok {
+		if replacement := strings.Join(path, "."); c.function(replacement) || restrictedFunctions[replacement] {
+			return c.call(Call{Name: replacement, Line: c.rule.Line}, false)
+		}
+	}
+	return nil
+}
+
+// function reports whether name is a function rule or a built-in
+func (c *checker) function(name string) bool {
+	return c.prog.arity(c.pkg, name) != unknownArity
+}
+
+// refPath returns the names of a variable or of a reference with constant string keys
+func refPath(t Term) ([]string, bool) {
+	switch t := t.(type) {
+	case Var:
+		return []string{t.Name}, true
+	case Ref:
+		head, ok := t.Head.(Var)
+		if !ok {
+			return nil, false
+		}
+		path := []string{head.Name}
+		for _, segment := range t.Path {
+			s, ok := segment.(Scalar)
+			if !ok {
+				return nil, false
+			}
+			name, ok := s.Value.(string)
+			if !ok {
+				return nil, false
+			}
+			path = append(path, name)
+		}
+		return path, true
+	}
+	return nil, false
+}
+
+// outsideRoot fails a reference to data outside the package the modules are confined to
+func (c *checker) outsideRoot(ref string) error {
+	return &Error{Code: compileErrorCode, Module: c.rule.Module, Line: c.rule.Line, Message: fmt.Sprintf("reference %s must be in data.%s", ref, strings.Join(c.prog.confined, "."))}
+}
+
+// call verifies that a function exists and, if checkArgs, that it is called with its arguments
+// and optionally an output argument the result is unified with: count(x, n) is n = count(x)
+func (c *checker) call(call Call, checkArgs bool) error {
+	if restrictedFunctions[call.Name] {
+		return &Error{Code: typeErrorCode, Module: c.rule.Module, Line: call.Line, Message: fmt.Sprintf("unsafe built-in function calls in expression: %s", call.Name)}
+	}
+	if strings.HasPrefix(call.Name, "data.") && c.prog.confined != nil && !strings.HasPrefix(call.Name, "data."+strings.Join(c.prog.confined, ".")+".") {
+		return c.outsideRoot(call.Name)
+	}
+	arity := c.prog.arity(c.pkg, call.Name)
+	switch {
+	case arity == unknownArity && c.prog.external && !strings.HasPrefix(call.Name, "data."):
+	case arity == unknownArity:
+		return &Error{Code: typeErrorCode, Module: c.rule.Module, Line: call.Line, Message: fmt.Sprintf("undefined function %s", call.Name)}
+	case !checkArgs || arity == variadic:
+	case arity != len(call.Args) && arity+1 != len(call.Args):
+		return &Error{Code: typeErrorCode, Module: c.rule.Module, Line: call.Line, Message: fmt.Sprintf("%s: expected %d arguments, got %d", call.Name, arity, len(call.Args))}
+	}
+	return nil
+}
+
+// Arities of functions that do not exist and of print, which takes any number of arguments
+const (
+	unknownArity = -1
+	variadic     = -2
+)
+
+// arity returns the number of arguments of a function rule or built-in
+func (prog *Program) arity(from *pkg, name string) int {
+	if group := prog.function(from, name); group != nil {
+		return len(group.defs[0].Args)
+	}
+	if name == printFunction {
+		return variadic
+	}
+	if b, ok := builtins[name]; ok {
+		return b.arity
+	}
+	if g, ok := generators[name]; ok {
+		return g.arity
+	}
+	return unknownArity
+}
+
+// function returns the function rule a call names: a function of the calling package, or
+// data.<package>.<function>
+func (prog *Program) function(from *pkg, name string) *ruleGroup {
+	p, fn := from, name
+	if strings.HasPrefix(name, "data.") {
+		parts := strings.Split(strings.TrimPrefix(name, "data."), ".")
+		p, fn = prog.lookupPackage(parts[:len(parts)-1]), parts[len(parts)-1]
+	}
+	if p == nil {
+		return nil
+	}
+	if group, ok := p.rules[fn]; ok && group.kind == ruleFunction {
+		return group
+	}
+	return nil
+}
+
+// constant reports whether t contains no variables, references, calls or comprehensions
+func constant(t Term) bool {
+	switch t := t.(type) {
+	case Scalar:
+		return true
+	case ArrayTerm:
+		return allConstant(t.Elems)
+	case SetTerm:
+		return allConstant(t.Elems)
+	case ObjectTerm:
+		for _, item := range t.Items {
+			if !constant(item[0]) || !constant(item[1]) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func allConstant(terms []Term) bool {
+	for _, t := range terms {
+		if !constant(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// patternVars returns the variables a pattern such as x or [x, _] binds
+func patternVars(t Term) []string {
+	switch t := t.(type) {
+	case Var:
+		return []string{t.Name}
+	case ArrayTerm:
+		var names []string
+		for _, e := range t.Elems {
+			names = append(names, patternVars(e)...)
+		}
+		return names
+	case ObjectTerm:
+		var names []string
+		for _, item := range t.Items {
+			names = append(names, patternVars(item[1])...)
+		}
+		return names
+	}
+	return nil
+}
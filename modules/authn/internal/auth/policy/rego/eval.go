@@ -0,0 +1,1037 @@
+package rego
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+// maxCallDepth bounds the nesting of function calls, which may recurse
+const maxCallDepth = 100
+
+// errStop ends an enumeration once a solution was found
+var errStop = errors.New("stop")
+
+type evaluator struct {
+	ctx       context.Context
+	prog      *Program
+	input     Value
+	now       time.Time // time.now_ns is the same throughout an evaluation
+	rules     map[*ruleGroup]*ruleResult
+	depth     int
+	overrides []override
+	mocks     map[interface{}]mock // Keyed by function rule group or built-in name
+}
+
+// override replaces the document at path under data, as set by with
+type override struct {
+	path  []string
+	value Value
+}
+
+// mock replaces a function, as set by with: calls return value, or call the function fn of
+// package pkg instead
+type mock struct {
+	value Value
+	fn    string
+	pkg   *pkg
+}
+
+// child returns an evaluator for an expression with modifiers. Rules are evaluated again, as
+// their values may depend on the replaced documents and functions.
+func (ev *evaluator) child() *evaluator {
+	c := *ev
+	c.rules = map[*ruleGroup]*ruleResult{}
+	c.overrides = append([]override(nil), ev.overrides...)
+	c.mocks = make(map[interface{}]mock, len(ev.mocks))
+	for key, m := range ev.mocks {
+		c.mocks[key] = m
+	}
+	c.depth++
+	return &c
+}
+
+// override returns the value replacing the document at path
+func (ev *evaluator) override(path []string) (Value, bool) {
+	for i := len(ev.overrides) - 1; i >= 0; i-- {
+		if slices.Equal(ev.overrides[i].path, path) {
+			return ev.overrides[i].value, true
+		}
+	}
+	return nil, false
+}
+
+// overlay applies the values replacing documents under path to doc, the document at path
+func (ev *evaluator) overlay(doc Value, defined bool, path []string) (Value, bool) {
+	for _, o := range ev.overrides {
+		if len(o.path) > len(path) && slices.Equal(o.path[:len(path)], path) {
+			if !defined {
+				doc = nil
+			}
+			doc, defined = upsert(doc, o.path[len(path):], o.value), true
+		}
+	}
+	return doc, defined
+}
+
+// upsert returns doc with the value at path replaced, creating objects along the path
+func upsert(doc Value, path []string, v Value) Value {
+	if len(path) == 0 {
+		return v
+	}
+	obj := Object{}
+	if existing, ok := doc.(Object); ok {
+		for key, item := range existing {
+			obj[key] = item
+		}
+	}
+	child, _ := obj.Get(path[0])
+	obj.Put(path[0], upsert(child, path[1:], v))
+	return obj
+}
+
+type ruleResult struct {
+	value    Value
+	defined  bool
+	evaluate bool // Being evaluated; seeing it again is recursion
+}
+
+// env binds the variables of a body. Entries without a value declare a local variable, which
+// hides rules and imports of the same name.
+type env struct {
+	name  string
+	value Value
+	bound bool
+	next  *env
+}
+
+func (e *env) lookup(name string) (*env, bool) {
+	for ; e != nil; e = e.next {
+		if e.name == name {
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+func (e *env) bind(name string, v Value) *env {
+	return &env{name: name, value: v, bound: true, next: e}
+}
+
+func (e *env) declare(name string) *env {
+	return &env{name: name, next: e}
+}
+
+// frame evaluates the terms of a rule, resolving names in the rule's package and module
+type frame struct {
+	ev      *evaluator
+	pkg     *pkg
+	imports map[string][]string
+	line    int
+}
+
+// ruleFrame returns the frame of a rule, which resolves names in the package of its module
+func (f *frame) ruleFrame(rule *Rule) *frame {
+	return &frame{ev: f.ev, pkg: f.ev.prog.packages[rule.Module], imports: f.ev.prog.imports[rule.Module], line: rule.Line}
+}
+
+func (f *frame) errorf(code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func (f *frame) evalBody(body []*Expr, b *env, k func(*env) error) error {
+	if len(body) == 0 {
+		return k(b)
+	}
+	if err := f.ev.ctx.Err(); err != nil {
+		return f.errorf(cancelErrorCode, "evaluation cancelled: %v", err)
+	}
+	return f.evalExpr(body[0], b, func(b *env) error {
+		return f.evalBody(body[1:], b, k)
+	})
+}
+
+func (f *frame) evalExpr(e *Expr, b *env, k func(*env) error) error {
+	if len(e.With) > 0 {
+		return f.evalWith(e, b, k)
+	}
+	switch {
+	case e.Not != nil:
+		found, err := f.succeeds(func(k func(*env) error) error { return f.evalExpr(e.Not, b, k) })
+		if err != nil || found {
+			return err
+		}
+		return k(b)
+
+	case e.Some != nil && e.Some.Collection == nil:
+		for _, name := range e.Some.Vars {
+			b = b.declare(name)
+		}
+		return k(b)
+
+	case e.Some != nil:
+		return f.evalTerm(e.Some.Collection, b, func(coll Value, b *env) error {
+			b = declarePattern(declarePattern(b, e.Some.Key), e.Some.Value)
+			return f.each(coll, b, func(key, value Value, b *env) error {
+				return f.unifyElement(e.Some.Key, e.Some.Value, key, value, b, k)
+			})
+		})
+
+	case e.Every != nil:
+		return f.evalTerm(e.Every.Collection, b, func(coll Value, outer *env) error {
+			inner := declarePattern(declarePattern(outer, e.Every.Key), e.Every.Value)
+			holds := true
+			err := f.each(coll, inner, func(key, value Value, b *env) error {
+				found, err := f.succeeds(func(k func(*env) error) error {
+					return f.unifyElement(e.Every.Key, e.Every.Value, key, value, b, func(b *env) error {
+						return f.evalBody(e.Every.Body, b, k)
+					})
+				})
+				if err != nil {
+					return err
+				}
+				if !found {
+					holds = false
+					return errStop
+				}
+				return nil
+			})
+			if err != nil && err != errStop {
+				return err
+			}
+			if !holds {
+				return nil
+			}
+			return k(outer)
+		})
+
+	case e.Assign != nil:
+		return f.unifyTerms(e.Assign.Left, e.Assign.Right, declarePattern(b, e.Assign.Left), k)
+
+	case e.Unify != nil:
+		return f.unifyTerms(e.Unify.Left, e.Unify.Right, b, k)
+	}
+
+	return f.evalTerm(e.Term, b, func(v Value, b *env) error {
+		if !truthy(v) {
+			return nil
+		}
+		return k(b)
+	})
+}
+
+// evalWith evaluates an expression with the input, data documents and functions its modifiers
+// replace. The rest of the body is evaluated without them.
+func (f *frame) evalWith(e *Expr, b *env, k func(*env) error) error {
+	if f.ev.depth >= maxCallDepth {
+		return f.errorf(recursionCode, "with modifiers nested too deeply")
+	}
+	expr := *e
+	expr.With = nil
+	return f.withValues(e.With, nil, b, func(values []Value, b *env) error {
+		ev := f.ev.child()
+		for i, w := range e.With {
+			f.applyWith(ev, w, values[i], b)
+		}
+		inner := &frame{ev: ev, pkg: f.pkg, imports: f.imports, line: f.line}
+		return inner.evalExpr(&expr, b, k)
+	})
+}
+
+// withValues evaluates the values of modifiers; functions replacing functions have none
+func (f *frame) withValues(ws []*With, values []Value, b *env, k func([]Value, *env) error) error {
+	if len(ws) == 0 {
+		return k(values, b)
+	}
+	if _, ok := f.replacement(ws[0], b); ok {
+		return f.withValues(ws[1:], append(values[:len(values):len(values)], nil), b, k)
+	}
+	return f.evalTerm(ws[0].Value, b, func(v Value, b *env) error {
+		return f.withValues(ws[1:], append(values[:len(values):len(values)], v), b, k)
+	})
+}
+
+// withTarget returns the names of a modifier's target, with imports resolved
+func (f *frame) withTarget(w *With) []string {
+	path, _ := refPath(w.Target)
+	if alias, ok := f.imports[path[0]]; ok {
+		path = append(append([]string{}, alias...), path[1:]...)
+	}
+	return path
+}
+
+// replacement returns the function replacing the function a modifier targets, if its value
+// names one
+func (f *frame) replacement(w *With, b *env) (string, bool) {
+	target := f.withTarget(w)
+	if target[0] == "input" || target[0] == "data" && f.ev.prog.function(nil, strings.Join(target, ".")) == nil {
+		return "", false
+	}
+	path, ok := refPath(w.Value)
+	if !ok {
+		return "", false
+	}
+	if _, local := b.lookup(path[0]); local {
+		return "", false
+	}
+	name := strings.Join(path, ".")
+	return name, f.ev.prog.arity(f.pkg, name) != unknownArity
+}
+
+// applyWith makes ev replace the target of w with value
+func (f *frame) applyWith(ev *evaluator, w *With, value Value, b *env) {
+	target := f.withTarget(w)
+	name := strings.Join(target, ".")
+	switch group := ev.prog.function(f.pkg, name); {
+	case target[0] == "input":
+		ev.input = upsert(ev.input, target[1:], value)
+	case target[0] == "data" && group == nil:
+		ev.overrides = append(ev.overrides, override{path: target[1:], value: value})
+	default:
+		m := mock{value: value, pkg: f.pkg}
+		if fn, ok := f.replacement(w, b); ok {
+			m.fn = fn
+		}
+		var key interface{} = name
+		if group != nil {
+			key = group
+		}
+		ev.mocks[key] = m
+	}
+}
+
+// succeeds reports whether eval finds a solution, stopping at the first
+func (f *frame) succeeds(eval func(k func(*env) error) error) (bool, error) {
+	found := false
+	err := eval(func(*env) error {
+		found = true
+		return errStop
+	})
+	if err != nil && err != errStop {
+		return false, err
+	}
+	return found, nil
+}
+
+// each calls k with the keys and values of a collection: the indexes of arrays, the keys of
+// objects and the elements of sets, which are their own keys
+func (f *frame) each(coll Value, b *env, k func(key, value Value, b *env) error) error {
+	switch coll := coll.(type) {
+	case Array:
+		for i, v := range coll {
+			if err := k(number(int64(i)), v, b); err != nil {
+				return err
+			}
+		}
+	case Object:
+		for _, item := range coll.Items() {
+			if err := k(item.Key, item.Value, b); err != nil {
+				return err
+			}
+		}
+	case Set:
+		for _, v := range coll.Elements() {
+			if err := k(v, v, b); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (f *frame) unifyElement(keyTerm, valueTerm Term, key, value Value, b *env, k func(*env) error) error {
+	return f.unify(valueTerm, value, b, func(b *env) error {
+		if keyTerm == nil {
+			return k(b)
+		}
+		return f.unify(keyTerm, key, b, k)
+	})
+}
+
+// declarePattern declares the variables of a pattern as new locals
+func declarePattern(b *env, t Term) *env {
+	for _, name := range patternVars(t) {
+		b = b.declare(name)
+	}
+	return b
+}
+
+// unifyTerms evaluates the side of a unification that is not a pattern of unbound variables
+// and matches the other side against it
+func (f *frame) unifyTerms(left, right Term, b *env, k func(*env) error) error {
+	leftPattern, rightPattern := f.isPattern(left, b), f.isPattern(right, b)
+	if leftPattern && rightPattern {
+		return f.unifyComposites(left, right, b, k)
+	}
+	if leftPattern {
+		left, right = right, left
+	}
+	return f.evalTerm(left, b, func(v Value, b *env) error {
+		return f.unify(right, v, b, k)
+	})
+}
+
+// unifyComposites unifies two arrays or objects that both have unbound variables, element by
+// element, as in [x, 1] = [2, y]
+func (f *frame) unifyComposites(left, right Term, b *env, k func(*env) error) error {
+	switch l := left.(type) {
+	case ArrayTerm:
+		r, ok := right.(ArrayTerm)
+		if !ok || len(l.Elems) != len(r.Elems) {
+			return nil
+		}
+		return f.unifyPairs(l.Elems, r.Elems, b, k)
+	case ObjectTerm:
+		r, ok := right.(ObjectTerm)
+		if !ok || len(l.Items) != len(r.Items) {
+			return nil
+		}
+		var lefts, rights []Term
+		for _, item := range l.Items {
+			key, ok := item[0].(Scalar)
+			if !ok {
+				return f.errorf(compileErrorCode, "object keys of unified patterns must be constants")
+			}
+			match := false
+			for _, other := range r.Items {
+				if otherKey, ok := other[0].(Scalar); ok && Equal(otherKey.Value, key.Value) {
+					lefts, rights = append(lefts, item[1]), append(rights, other[1])
+					match = true
+				}
+			}
+			if !match {
+				return nil
+			}
+		}
+		return f.unifyPairs(lefts, rights, b, k)
+	}
+	// A variable on either side takes the value of the other
+	if _, ok := right.(Var); ok {
+		left, right = right, left
+	}
+	return f.evalTerm(right, b, func(v Value, b *env) error {
+		return f.unify(left, v, b, k)
+	})
+}
+
+func (f *frame) unifyPairs(lefts, rights []Term, b *env, k func(*env) error) error {
+	if len(lefts) == 0 {
+		return k(b)
+	}
+	return f.unifyTerms(lefts[0], rights[0], b, func(b *env) error {
+		return f.unifyPairs(lefts[1:], rights[1:], b, k)
+	})
+}
+
+// isPattern reports whether t is, or is an array or object containing, an unbound variable
+func (f *frame) isPattern(t Term, b *env) bool {
+	switch t := t.(type) {
+	case Var:
+		return !f.resolvable(t.Name, b)
+	case ArrayTerm:
+		for _, e := range t.Elems {
+			if f.isPattern(e, b) {
+				return true
+			}
+		}
+	case ObjectTerm:
+		for _, item := range t.Items {
+			if f.isPattern(item[1], b) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resolvable reports whether name has a value: a bound local, a root document, an import or
+// a rule of the package
+func (f *frame) resolvable(name string, b *env) bool {
+	if e, ok := b.lookup(name); ok {
+		return e.bound
+	}
+	if name == "input" || name == "data" {
+		return true
+	}
+	if _, ok := f.imports[name]; ok {
+		return true
+	}
+	return f.pkg != nil && f.pkg.defines(name)
+}
+
+// defines reports whether the package has a rule called name, or rules under name
+func (p *pkg) defines(name string) bool {
+	_, rule := p.rules[name]
+	_, child := p.node.children[name]
+	return rule || child
+}
+
+// unify matches the pattern t against v, binding its unbound variables
+func (f *frame) unify(t Term, v Value, b *env, k func(*env) error) error {
+	switch t := t.(type) {
+	case Var:
+		if !f.resolvable(t.Name, b) {
+			return k(b.bind(t.Name, v))
+		}
+	case ArrayTerm:
+		arr, ok := v.(Array)
+		if !ok || len(arr) != len(t.Elems) {
+			return nil
+		}
+		return f.unifyAll(t.Elems, arr, b, k)
+	case ObjectTerm:
+		obj, ok := v.(Object)
+		if !ok || len(obj) != len(t.Items) {
+			return nil
+		}
+		return f.unifyItems(t.Items, obj, b, k)
+	}
+	return f.evalTerm(t, b, func(x Value, b *env) error {
+		if !Equal(x, v) {
+			return nil
+		}
+		return k(b)
+	})
+}
+
+func (f *frame) unifyAll(terms []Term, values Array, b *env, k func(*env) error) error {
+	if len(terms) == 0 {
+		return k(b)
+	}
+	return f.unify(terms[0], values[0], b, func(b *env) error {
+		return f.unifyAll(terms[1:], values[1:], b, k)
+	})
+}
+
+func (f *frame) unifyItems(items [][2]Term, obj Object, b *env, k func(*env) error) error {
+	if len(items) == 0 {
+		return k(b)
+	}
+	return f.evalTerm(items[0][0], b, func(key Value, b *env) error {
+		value, ok := obj.Get(key)
+		if !ok {
+			return nil
+		}
+		return f.unify(items[0][1], value, b, func(b *env) error {
+			return f.unifyItems(items[1:], obj, b, k)
+		})
+	})
+}
+
+// evalTerm calls k with every value of t. References with unbound variables in their path
+// enumerate the collection, binding the variables.
+func (f *frame) evalTerm(t Term, b *env, k func(Value, *env) error) error {
+	switch t := t.(type) {
+	case Scalar:
+		return k(t.Value, b)
+	case Var:
+		return f.evalRef(Ref{Head: t}, b, k)
+	case Ref:
+		return f.evalRef(t, b, k)
+	case Call:
+		if t.Name == printFunction && f.ev.prog.function(f.pkg, t.Name) == nil {
+			return f.print(t, b, k)
+		}
+		args, output := t.Args, Term(nil)
+		if arity := f.ev.prog.arity(f.pkg, t.Name); arity >= 0 && len(args) == arity+1 {
+			args, output = args[:arity], args[arity]
+		}
+		return f.evalArgs(args, nil, b, func(values []Value, b *env) error {
+			if output == nil {
+				return f.call(t, values, b, k)
+			}
+			return f.call(t, values, b, func(v Value, b *env) error {
+				return f.unify(output, v, b, func(b *env) error {
+					return k(true, b)
+				})
+			})
+		})
+	case ArrayTerm:
+		return f.evalArgs(t.Elems, nil, b, func(elems []Value, b *env) error {
+			return k(Array(elems), b)
+		})
+	case SetTerm:
+		return f.evalArgs(t.Elems, nil, b, func(elems []Value, b *env) error {
+			set := Set{}
+			for _, e := range elems {
+				set.Add(e)
+			}
+			return k(set, b)
+		})
+	case ObjectTerm:
+		terms := make([]Term, 0, 2*len(t.Items))
+		for _, item := range t.Items {
+			terms = append(terms, item[0], item[1])
+		}
+		return f.evalArgs(terms, nil, b, func(values []Value, b *env) error {
+			obj := Object{}
+			for i := 0; i < len(values); i += 2 {
+				obj.Put(values[i], values[i+1])
+			}
+			return k(obj, b)
+		})
+	case Comprehension:
+		v, err := f.comprehension(t, b)
+		if err != nil {
+			return err
+		}
+		return k(v, b)
+	}
+	return f.errorf(compileErrorCode, "unsupported term %T", t)
+}
+
+func (f *frame) evalArgs(terms []Term, values []Value, b *env, k func([]Value, *env) error) error {
+	if len(terms) == 0 {
+		return k(values, b)
+	}
+	return f.evalTerm(terms[0], b, func(v Value, b *env) error {
+		next := append(values[:len(values):len(values)], v)
+		return f.evalArgs(terms[1:], next, b, k)
+	})
+}
+
+func (f *frame) comprehension(c Comprehension, b *env) (Value, error) {
+	var (
+		arr Array
+		set = Set{}
+		obj = Object{}
+	)
+	err := f.evalBody(c.Body, b, func(b *env) error {
+		return f.evalTerm(c.Value, b, func(v Value, b *env) error {
+			switch c.Kind {
+			case "array":
+				arr = append(arr, v)
+			case "set":
+				set.Add(v)
+			case "object":
+				return f.evalTerm(c.Key, b, func(key Value, _ *env) error {
+					if existing, ok := obj.Get(key); ok && !Equal(existing, v) {
+						return f.errorf(conflictErrorCode, "object keys must be unique")
+					}
+					obj.Put(key, v)
+					return nil
+				})
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	switch c.Kind {
+	case "array":
+		if arr == nil {
+			arr = Array{}
+		}
+		return arr, nil
+	case "set":
+		return set, nil
+	}
+	return obj, nil
+}
+
+// evalRef resolves the head of a reference and walks its path
+func (f *frame) evalRef(r Ref, b *env, k func(Value, *env) error) error {
+	v, ok := r.Head.(Var)
+	if !ok {
+		return f.evalTerm(r.Head, b, func(head Value, b *env) error {
+			return f.walk(head, r.Path, b, k)
+		})
+	}
+
+	if e, ok := b.lookup(v.Name); ok {
+		if !e.bound {
+			return f.unsafe(v.Name)
+		}
+		return f.walk(e.value, r.Path, b, k)
+	}
+	switch {
+	case v.Name == "input":
+		if f.ev.input == nil {
+			return nil
+		}
+		return f.walk(f.ev.input, r.Path, b, k)
+	case v.Name == "data":
+		return f.walkData(f.ev.prog.root, r.Path, b, k)
+	}
+	if path, ok := f.imports[v.Name]; ok {
+		return f.evalRef(Ref{Head: Var{Name: path[0]}, Path: append(scalarPath(path[1:]), r.Path...)}, b, k)
+	}
+	if f.pkg != nil && f.pkg.defines(v.Name) {
+		return f.walkData(f.ev.prog.root, append(scalarPath(append(f.pkg.path, v.Name)), r.Path...), b, k)
+	}
+	return f.unsafe(v.Name)
+}
+
+func (f *frame) unsafe(name string) error {
+	if strings.HasPrefix(name, "$") {
+		name = "_"
+	}
+	return &Error{Code: unsafeVarCode, Line: f.line, Message: fmt.Sprintf("var %s is unsafe", name)}
+}
+
+// walk looks up path in v, enumerating collections at unbound variables
+func (f *frame) walk(v Value, path []Term, b *env, k func(Value, *env) error) error {
+	if len(path) == 0 {
+		return k(v, b)
+	}
+	if f.isPattern(path[0], b) {
+		return f.each(v, b, func(key, value Value, b *env) error {
+			return f.unify(path[0], key, b, func(b *env) error {
+				return f.walk(value, path[1:], b, k)
+			})
+		})
+	}
+	return f.evalTerm(path[0], b, func(key Value, b *env) error {
+		child, ok := index(v, key)
+		if !ok {
+			return nil
+		}
+		return f.walk(child, path[1:], b, k)
+	})
+}
+
+// index returns the element of a collection at key
+func index(v, key Value) (Value, bool) {
+	switch v := v.(type) {
+	case Array:
+		n, ok := key.(*big.Rat)
+		if !ok || !n.IsInt() || !n.Num().IsInt64() {
+			return nil, false
+		}
+		i := n.Num().Int64()
+		if i < 0 || i >= int64(len(v)) {
+			return nil, false
+		}
+		return v[i], true
+	case Object:
+		return v.Get(key)
+	case Set:
+		if v.Contains(key) {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// walkData looks up path in the data tree of packages and rules, and of the documents with
+// modifiers replace
+func (f *frame) walkData(n *node, path []Term, b *env, k func(Value, *env) error) error {
+	if len(path) == 0 || f.isPattern(path[0], b) {
+		doc, err := f.nodeValue(n)
+		if err != nil {
+			return err
+		}
+		return f.walk(doc, path, b, k)
+	}
+	return f.evalTerm(path[0], b, func(key Value, b *env) error {
+		name, ok := key.(string)
+		if !ok {
+			return nil
+		}
+		docPath := append(n.path[:len(n.path):len(n.path)], name)
+		if v, ok := f.ev.override(docPath); ok {
+			return f.walk(v, path[1:], b, k)
+		}
+		if child, ok := n.children[name]; ok {
+			return f.walkData(child, path[1:], b, k)
+		}
+		var (
+			doc     Value
+			defined bool
+		)
+		if n.pkg != nil {
+			if group, ok := n.pkg.rules[name]; ok && group.kind != ruleFunction {
+				var err error
+				if doc, defined, err = f.ruleValue(group); err != nil {
+					return err
+				}
+			}
+		}
+		if doc, defined = f.ev.overlay(doc, defined, docPath); !defined {
+			return nil
+		}
+		return f.walk(doc, path[1:], b, k)
+	})
+}
+
+// nodeValue returns the document of a package node: its defined rules and sub-packages
+func (f *frame) nodeValue(n *node) (Value, error) {
+	doc, err := f.packageValue(n)
+	if err != nil {
+		return nil, err
+	}
+	doc, _ = f.ev.overlay(doc, true, n.path)
+	return doc, nil
+}
+
+func (f *frame) packageValue(n *node) (Value, error) {
+	doc := Object{}
+	for name, child := range n.children {
+		v, err := f.nodeValue(child)
+		if err != nil {
+			return nil, err
+		}
+		doc.Put(name, v)
+	}
+	if n.pkg != nil {
+		for name, group := range n.pkg.rules {
+			if group.kind == ruleFunction {
+				continue
+			}
+			v, defined, err := f.ruleValue(group)
+			if err != nil {
+				return nil, err
+			}
+			if defined {
+				doc.Put(name, v)
+			}
+		}
+	}
+	return doc, nil
+}
+
+// ruleValue evaluates a rule once per evaluation
+func (f *frame) ruleValue(group *ruleGroup) (Value, bool, error) {
+	if result, ok := f.ev.rules[group]; ok {
+		if result.evaluate {
+			return nil, false, f.errorf(recursionCode, "rule %s is recursive", group.name)
+		}
+		return result.value, result.defined, nil
+	}
+	result := &ruleResult{evaluate: true}
+	f.ev.rules[group] = result
+
+	v, defined, err := f.evalRule(group)
+	if err != nil {
+		return nil, false, err
+	}
+	*result = ruleResult{value: v, defined: defined}
+	return v, defined, nil
+}
+
+func (f *frame) evalRule(group *ruleGroup) (Value, bool, error) {
+	var (
+		values []Value
+		set    = Set{}
+		obj    = Object{}
+	)
+	for _, rule := range group.defs {
+		rf := f.ruleFrame(rule)
+		var err error
+		switch group.kind {
+		case rulePartialSet:
+			err = rf.evalBody(rule.Body, nil, func(b *env) error {
+				return rf.evalTerm(rule.Key, b, func(v Value, _ *env) error {
+					set.Add(v)
+					return nil
+				})
+			})
+		case rulePartialObject:
+			err = rf.evalBody(rule.Body, nil, func(b *env) error {
+				return rf.evalTerm(rule.Key, b, func(key Value, b *env) error {
+					return rf.evalTerm(rule.Value, b, func(v Value, _ *env) error {
+						if existing, ok := obj.Get(key); ok && !Equal(existing, v) {
+							return &Error{Code: conflictErrorCode, Module: rule.Module, Line: rule.Line, Message: "object keys must be unique"}
+						}
+						obj.Put(key, v)
+						return nil
+					})
+				})
+			})
+		default:
+			err = rf.evalElse(rule, nil, func(r *Rule, v Value) error {
+				values = appendDistinct(values, v)
+				if len(values) > 1 {
+					return &Error{Code: conflictErrorCode, Module: r.Module, Line: r.Line, Message: "complete rules must not produce multiple outputs"}
+				}
+				return nil
+			})
+		}
+		if err != nil {
+			return nil, false, withLocation(err, rule)
+		}
+	}
+
+	switch group.kind {
+	case rulePartialSet:
+		return set, true, nil
+	case rulePartialObject:
+		return obj, true, nil
+	}
+	if len(values) == 1 {
+		return values[0], true, nil
+	}
+	if group.def != nil {
+		var v Value
+		err := f.ruleFrame(group.def).evalTerm(group.def.Value, nil, func(x Value, _ *env) error {
+			v = x
+			return nil
+		})
+		return v, err == nil, err
+	}
+	return nil, false, nil
+}
+
+// evalElse yields the values of the first definition in the else chain of rule whose body holds
+func (f *frame) evalElse(rule *Rule, b *env, yield func(*Rule, Value) error) error {
+	for r := rule; r != nil; r = r.Else {
+		found := false
+		err := f.evalBody(r.Body, b, func(b *env) error {
+			found = true
+			return f.evalTerm(ruleValueTerm(r), b, func(v Value, _ *env) error {
+				return yield(r, v)
+			})
+		})
+		if err != nil || found {
+			return withLocation(err, r)
+		}
+	}
+	return nil
+}
+
+// ruleValueTerm returns the value a definition produces, true when it has none
+func ruleValueTerm(rule *Rule) Term {
+	if rule.Value == nil {
+		return Scalar{Value: true}
+	}
+	return rule.Value
+}
+
+func appendDistinct(values []Value, v Value) []Value {
+	for _, existing := range values {
+		if Equal(existing, v) {
+			return values
+		}
+	}
+	return append(values, v)
+}
+
+// withLocation adds the rule's module and line to errors raised without them
+func withLocation(err error, rule *Rule) error {
+	var e *Error
+	if errors.As(err, &e) && e.Module == "" {
+		located := *e
+		located.Module = rule.Module
+		if located.Line == 0 {
+			located.Line = rule.Line
+		}
+		return &located
+	}
+	return err
+}
+
+// call calls a function rule or built-in, or what a modifier replaced it with
+func (f *frame) call(c Call, args []Value, b *env, k func(Value, *env) error) error {
+	group := f.ev.prog.function(f.pkg, c.Name)
+	var key interface{} = c.Name
+	if group != nil {
+		key = group
+	}
+	m, ok := f.ev.mocks[key]
+	switch {
+	case !ok:
+		return f.callFunc(c, group, args, b, k)
+	case m.fn == "":
+		return k(m.value, b)
+	}
+	mf := &frame{ev: f.ev, pkg: m.pkg, imports: f.imports, line: f.line}
+	replacement := Call{Name: m.fn, Args: c.Args, Line: c.Line}
+	return mf.callFunc(replacement, f.ev.prog.function(m.pkg, m.fn), args, b, k)
+}
+
+// callFunc calls the function rule group, or the built-in c names when group is nil
+func (f *frame) callFunc(c Call, group *ruleGroup, args []Value, b *env, k func(Value, *env) error) error {
+	if group != nil {
+		v, defined, err := f.callFunction(group, args)
+		if err != nil || !defined {
+			return err
+		}
+		return k(v, b)
+	}
+
+	if gen, ok := generators[c.Name]; ok {
+		return gen.iter(args, func(v Value) error {
+			return k(v, b)
+		})
+	}
+	fn, ok := builtins[c.Name]
+	if !ok {
+		return f.errorf(typeErrorCode, "undefined function %s", c.Name)
+	}
+	v, err := fn.eval(f.ev, args)
+	switch {
+	case err == errUndefined:
+		return nil
+	case err != nil && !f.ev.prog.strict:
+		return nil
+	case err != nil:
+		return &Error{Code: builtinErrorCode, Line: c.Line, Message: fmt.Sprintf("%s: %v", c.Name, err)}
+	}
+	return k(v, b)
+}
+
+// print writes the values of its arguments, <undefined> for those without one, and succeeds
+func (f *frame) print(c Call, b *env, k func(Value, *env) error) error {
+	parts := make([]string, len(c.Args))
+	for i, arg := range c.Args {
+		parts[i] = "<undefined>"
+		err := f.evalTerm(arg, b, func(v Value, _ *env) error {
+			if s, ok := v.(string); ok {
+				parts[i] = s
+			} else {
+				parts[i] = String(v)
+			}
+			return errStop
+		})
+		if err != nil && err != errStop {
+			return err
+		}
+	}
+	if w := f.ev.prog.print; w != nil {
+		fmt.Fprintln(w, strings.Join(parts, " "))
+	}
+	return k(true, b)
+}
+
+func (f *frame) callFunction(group *ruleGroup, args []Value) (Value, bool, error) {
+	if f.ev.depth >= maxCallDepth {
+		return nil, false, f.errorf(recursionCode, "function %s nested too deeply", group.name)
+	}
+	f.ev.depth++
+	defer func() { f.ev.depth-- }()
+
+	var values []Value
+	for _, rule := range group.defs {
+		rf := f.ruleFrame(rule)
+		err := rf.unifyAll(rule.Args, args, declareArgs(rule.Args), func(b *env) error {
+			return rf.evalElse(rule, b, func(r *Rule, v Value) error {
+				values = appendDistinct(values, v)
+				if len(values) > 1 {
+					return &Error{Code: conflictErrorCode, Module: r.Module, Line: r.Line, Message: "functions must not produce multiple outputs for same inputs"}
+				}
+				return nil
+			})
+		})
+		if err != nil {
+			return nil, false, withLocation(err, rule)
+		}
+	}
+	if len(values) == 0 {
+		return nil, false, nil
+	}
+	return values[0], true, nil
+}
+
+// declareArgs declares the variables of function arguments, which hide rules of the same name
+func declareArgs(args []Term) *env {
+	var b *env
+	for _, arg := range args {
+		b = declarePattern(b, arg)
+	}
+	return b
+}
@@ -0,0 +1,184 @@
+package rego
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// globMatch matches a string against a glob pattern. Delimiters are given as an array of
+// single characters, "." if empty, or null for none.
+func globMatch(_ *evaluator, a []Value) (Value, error) {
+	pattern, err := stringArg(a[0], 1)
+	if err != nil {
+		return nil, err
+	}
+	var delimiters []rune
+	switch d := a[1].(type) {
+	case nil:
+	case Array:
+		for _, e := range d {
+			s, ok := e.(string)
+			if !ok {
+				return nil, fmt.Errorf("operand 2 must contain strings but got %s", typeName(e))
+			}
+			r, _ := utf8.DecodeRuneInString(s)
+			delimiters = append(delimiters, r)
+		}
+		if len(delimiters) == 0 {
+			delimiters = []rune{'.'}
+		}
+	default:
+		return nil, fmt.Errorf("operand 2 must be one of {array, null} but got %s", typeName(a[1]))
+	}
+	match, err := stringArg(a[2], 3)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &glob{pattern: pattern, single: "(?s:.)"}
+	if len(delimiters) > 0 {
+		g.single = "[^" + classChars(string(delimiters)) + "]"
+	}
+	expr, err := g.parse(false)
+	if err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return nil, err
+	}
+	return re.MatchString(match), nil
+}
+
+// glob translates a glob pattern into a regular expression. * matches any characters but the
+// delimiters, ** any characters and ? one character but a delimiter. [abc], [a-z] and [!abc]
+// match a character of a class, {a,b} one of several patterns, and \ escapes a character.
+type glob struct {
+	pattern string
+	pos     int
+	single  string // Expression matching one character but a delimiter
+}
+
+// parse translates the pattern up to its end or, within braces, up to the next , or }
+func (g *glob) parse(inBraces bool) (string, error) {
+	var sb strings.Builder
+	for g.pos < len(g.pattern) {
+		r, size := utf8.DecodeRuneInString(g.pattern[g.pos:])
+		switch {
+		case inBraces && (r == ',' || r == '}'):
+			return sb.String(), nil
+		case r == '*' && strings.HasPrefix(g.pattern[g.pos:], "**"):
+			sb.WriteString("(?s:.*)")
+			g.pos += 2
+			continue
+		case r == '*':
+			sb.WriteString(g.single + "*")
+		case r == '?':
+			sb.WriteString(g.single)
+		case r == '\\':
+			g.pos += size
+			if g.pos >= len(g.pattern) {
+				return "", fmt.Errorf("unexpected end of glob pattern %q", g.pattern)
+			}
+			r, size = utf8.DecodeRuneInString(g.pattern[g.pos:])
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		case r == '[':
+			class, err := g.class()
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(class)
+			continue
+		case r == '{':
+			alternatives, err := g.alternatives()
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(alternatives)
+			continue
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+		g.pos += size
+	}
+	if inBraces {
+		return "", fmt.Errorf("unclosed { in glob pattern %q", g.pattern)
+	}
+	return sb.String(), nil
+}
+
+// class translates a character class starting at [
+func (g *glob) class() (string, error) {
+	end := strings.IndexByte(g.pattern[g.pos+1:], ']')
+	if end < 0 {
+		return "", fmt.Errorf("unclosed [ in glob pattern %q", g.pattern)
+	}
+	body := g.pattern[g.pos+1 : g.pos+1+end]
+	g.pos += end + 2
+	negate := strings.HasPrefix(body, "!")
+	body = strings.TrimPrefix(body, "!")
+	if body == "" {
+		return "", fmt.Errorf("empty character class in glob pattern %q", g.pattern)
+	}
+
+	var sb strings.Builder
+	sb.WriteByte('[')
+	if negate {
+		sb.WriteByte('^')
+	}
+	runes := []rune(body)
+	for i := 0; i < len(runes); i++ {
+		sb.WriteString(classChars(string(runes[i])))
+		if i+2 < len(runes) && runes[i+1] == '-' {
+			sb.WriteByte('-')
+			sb.WriteString(classChars(string(runes[i+2])))
+			i += 2
+		}
+	}
+	sb.WriteByte(']')
+	return sb.String(), nil
+}
+
+// alternatives translates a list of patterns starting at {
+func (g *glob) alternatives() (string, error) {
+	var parts []string
+	for g.pos < len(g.pattern) && g.pattern[g.pos] != '}' {
+		g.pos++ // { or ,
+		part, err := g.parse(true)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, part)
+	}
+	if g.pos >= len(g.pattern) {
+		return "", fmt.Errorf("unclosed { in glob pattern %q", g.pattern)
+	}
+	g.pos++
+	return "(?:" + strings.Join(parts, "|") + ")", nil
+}
+
+// classChars escapes characters for a regular expression character class
+func classChars(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if r < utf8.RuneSelf && !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9') {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// globQuoteMeta escapes the characters of s that have a meaning in glob patterns
+func globQuoteMeta(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?\[]{}`, r) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
@@ -0,0 +1,136 @@
+package rego
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNewline
+	tokIdent
+	tokString
+	tokNumber
+	tokOp // Operators and punctuation
+)
+
+type token struct {
+	kind tokenKind
+	text string // Identifier, operator, number literal or unquoted string
+	line int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of file"
+	case tokNewline:
+		return "end of line"
+	case tokString:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// operators are matched longest first
+var operators = []string{":=", "==", "!=", "<=", ">=", "<", ">", "=", "+", "-", "*", "/", "%", "(", ")", "[", "]", "{", "}", ",", ".", ";", ":", "|", "&"}
+
+// lex splits a module into tokens
+func lex(src string) ([]token, error) {
+	var tokens []token
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			tokens = append(tokens, token{kind: tokNewline, line: line})
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '"':
+			end := i + 1
+			for end < len(src) && src[end] != '"' {
+				if src[end] == '\\' {
+					end++
+				}
+				if end < len(src) && src[end] == '\n' {
+					break
+				}
+				end++
+			}
+			if end >= len(src) || src[end] != '"' {
+				return nil, &Error{Line: line, Message: "unterminated string"}
+			}
+			s, err := strconv.Unquote(src[i : end+1])
+			if err != nil {
+				return nil, &Error{Line: line, Message: "invalid string " + src[i:end+1]}
+			}
+			tokens = append(tokens, token{kind: tokString, text: s, line: line})
+			i = end + 1
+		case c == '`':
+			end := strings.IndexByte(src[i+1:], '`')
+			if end < 0 {
+				return nil, &Error{Line: line, Message: "unterminated raw string"}
+			}
+			s := src[i+1 : i+1+end]
+			tokens = append(tokens, token{kind: tokString, text: s, line: line})
+			line += strings.Count(s, "\n")
+			i += end + 2
+		case c >= '0' && c <= '9':
+			end := i
+			for end < len(src) && src[end] >= '0' && src[end] <= '9' {
+				end++
+			}
+			if end+1 < len(src) && src[end] == '.' && src[end+1] >= '0' && src[end+1] <= '9' {
+				end++
+				for end < len(src) && src[end] >= '0' && src[end] <= '9' {
+					end++
+				}
+			}
+			if end < len(src) && (src[end] == 'e' || src[end] == 'E') {
+				exp := end + 1
+				if exp < len(src) && (src[exp] == '+' || src[exp] == '-') {
+					exp++
+				}
+				if exp < len(src) && src[exp] >= '0' && src[exp] <= '9' {
+					end = exp
+					for end < len(src) && src[end] >= '0' && src[end] <= '9' {
+						end++
+					}
+				}
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: src[i:end], line: line})
+			i = end
+		case c == '_' || unicode.IsLetter(rune(c)):
+			end := i
+			for end < len(src) && (src[end] == '_' || unicode.IsLetter(rune(src[end])) || unicode.IsDigit(rune(src[end]))) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: src[i:end], line: line})
+			i = end
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(src[i:], op) {
+					tokens = append(tokens, token{kind: tokOp, text: op, line: line})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, &Error{Line: line, Message: fmt.Sprintf("unexpected character %q", c)}
+			}
+		}
+	}
+	return append(tokens, token{kind: tokEOF, line: line}), nil
+}
@@ -0,0 +1,592 @@
+package rego
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// keywords cannot be used as variable or rule names. contains is a keyword only after a rule
+// name, so the contains built-in can still be called.
+var keywords = map[string]bool{
+	"package": true, "import": true, "default": true, "if": true, "some": true, "in": true,
+	"not": true, "every": true, "else": true, "with": true, "as": true,
+}
+
+// futureImports are imports that only enable keywords, which are always on
+var futureImports = map[string]bool{"future.keywords": true, "rego.v1": true}
+
+type parser struct {
+	module    string
+	tokens    []token
+	pos       int
+	skipLines int // Newlines are insignificant inside parentheses, brackets and literals
+	wildcards int
+	noUnion   bool // | starts the body of a comprehension rather than a union
+}
+
+// parseModule parses the source of the module called name
+func parseModule(name, src string) (module *Module, err error) {
+	tokens, err := lex(src)
+	if err != nil {
+		e := err.(*Error)
+		e.Code, e.Module = parseErrorCode, name
+		return nil, e
+	}
+
+	p := &parser{module: name, tokens: tokens}
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*Error)
+			if !ok {
+				panic(r)
+			}
+			module, err = nil, e
+		}
+	}()
+	return p.parseModule(), nil
+}
+
+func (p *parser) fail(line int, format string, args ...interface{}) {
+	panic(&Error{Code: parseErrorCode, Module: p.module, Line: line, Message: fmt.Sprintf(format, args...)})
+}
+
+func (p *parser) peek() token {
+	if p.skipLines > 0 {
+		for p.tokens[p.pos].kind == tokNewline {
+			p.pos++
+		}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) skipNewlines() {
+	for p.tokens[p.pos].kind == tokNewline || (p.tokens[p.pos].kind == tokOp && p.tokens[p.pos].text == ";") {
+		p.pos++
+	}
+}
+
+// is reports whether the next token is the operator or identifier text
+func (p *parser) is(text string) bool {
+	t := p.peek()
+	return (t.kind == tokOp || t.kind == tokIdent) && t.text == text
+}
+
+func (p *parser) accept(text string) bool {
+	if p.is(text) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) token {
+	t := p.next()
+	if (t.kind != tokOp && t.kind != tokIdent) || t.text != text {
+		p.fail(t.line, "expected %q but got %s", text, t)
+	}
+	return t
+}
+
+func (p *parser) ident() token {
+	t := p.next()
+	if t.kind != tokIdent || keywords[t.text] {
+		p.fail(t.line, "expected a name but got %s", t)
+	}
+	return t
+}
+
+// endStatement consumes the end of a package, import or rule
+func (p *parser) endStatement() {
+	t := p.peek()
+	switch {
+	case t.kind == tokNewline || t.kind == tokEOF:
+	case t.kind == tokOp && t.text == ";":
+	default:
+		p.fail(t.line, "unexpected %s", t)
+	}
+	p.skipNewlines()
+}
+
+func (p *parser) dottedName() ([]string, int) {
+	first := p.ident()
+	parts := []string{first.text}
+	for p.accept(".") {
+		// Keywords are names after a dot, as in future.keywords.if
+		t := p.next()
+		if t.kind != tokIdent {
+			p.fail(t.line, "expected a name but got %s", t)
+		}
+		parts = append(parts, t.text)
+	}
+	return parts, first.line
+}
+
+func (p *parser) parseModule() *Module {
+	p.skipNewlines()
+	p.expect("package")
+	pkg, _ := p.dottedName()
+	p.endStatement()
+
+	module := &Module{Name: p.module, Package: pkg, Imports: map[string][]string{}}
+	for p.peek().kind != tokEOF {
+		if p.accept("import") {
+			p.parseImport(module)
+			continue
+		}
+		module.Rules = append(module.Rules, p.parseRule())
+	}
+	return module
+}
+
+func (p *parser) parseImport(module *Module) {
+	path, line := p.dottedName()
+	joined := strings.Join(path, ".")
+	if futureImports[joined] || strings.HasPrefix(joined, "future.keywords.") {
+		p.endStatement()
+		return
+	}
+	if path[0] != "input" && path[0] != "data" {
+		p.fail(line, "unsupported import %s", joined)
+	}
+	alias := path[len(path)-1]
+	if p.accept("as") {
+		alias = p.ident().text
+	}
+	if len(path) == 1 && alias == path[0] {
+		p.fail(line, "import %s is implied", joined)
+	}
+	module.Imports[alias] = path
+	p.endStatement()
+}
+
+func (p *parser) parseRule() *Rule {
+	isDefault := p.accept("default")
+	name := p.ident()
+	rule := &Rule{Name: name.text, Path: []string{name.text}, Default: isDefault, Module: p.module, Line: name.line}
+	for p.is(".") {
+		p.next()
+		rule.Path = append(rule.Path, p.ident().text)
+	}
+	rule.Name = strings.Join(rule.Path, ".")
+
+	switch {
+	case p.is("("):
+		if len(rule.Path) > 1 {
+			p.fail(rule.Line, "function %s must not have a dotted name", rule.Name)
+		}
+		rule.Kind = ruleFunction
+		rule.Args = p.parseArgs()
+	case p.is("["):
+		p.next()
+		p.skipLines++
+		rule.Key = p.parseTermIn()
+		p.expect("]")
+		p.skipLines--
+		rule.Kind = rulePartialSet
+		if p.accept(":=") || p.accept("=") {
+			rule.Kind = rulePartialObject
+			rule.Value = p.parseTermIn()
+		}
+	case p.accept("contains"):
+		rule.Kind = rulePartialSet
+		rule.Key = p.parseTermIn()
+	}
+
+	if rule.Kind == ruleComplete || rule.Kind == ruleFunction {
+		if p.accept(":=") || p.accept("=") {
+			rule.Value = p.parseTermIn()
+		}
+	}
+	if isDefault {
+		if rule.Kind != ruleComplete || rule.Value == nil {
+			p.fail(rule.Line, "default rule %s must have a value", rule.Name)
+		}
+		p.endStatement()
+		return rule
+	}
+
+	rule.Body = p.parseRuleBody(rule.Value == nil && rule.Kind != rulePartialSet, rule)
+	for last := rule; p.acceptElse(); last = last.Else {
+		if rule.Kind != ruleComplete && rule.Kind != ruleFunction {
+			p.fail(rule.Line, "else is only allowed for complete rules and functions")
+		}
+		next := &Rule{Name: rule.Name, Path: rule.Path, Kind: rule.Kind, Args: rule.Args, Module: p.module, Line: p.tokens[p.pos-1].line}
+		if p.accept(":=") || p.accept("=") {
+			next.Value = p.parseTermIn()
+		}
+		next.Body = p.parseRuleBody(false, next)
+		last.Else = next
+	}
+	p.endStatement()
+	return rule
+}
+
+// parseRuleBody parses the body following a rule head: if and an expression or a body in
+// braces, or a body in braces. A rule without a body always holds unless required.
+func (p *parser) parseRuleBody(required bool, rule *Rule) []*Expr {
+	switch {
+	case p.accept("if"):
+		if p.is("{") {
+			return p.parseBraceBody()
+		}
+		return []*Expr{p.parseExpr()}
+	case p.is("{"):
+		return p.parseBraceBody()
+	case required:
+		p.fail(rule.Line, "rule %s has neither a value nor a body", rule.Name)
+	}
+	return nil
+}
+
+// acceptElse consumes an else keyword, which may follow the previous body on the next line
+func (p *parser) acceptElse() bool {
+	pos := p.pos
+	for p.tokens[pos].kind == tokNewline {
+		pos++
+	}
+	if t := p.tokens[pos]; t.kind != tokIdent || t.text != "else" {
+		return false
+	}
+	p.pos = pos + 1
+	return true
+}
+
+func (p *parser) parseBraceBody() []*Expr {
+	p.expect("{")
+	saved, savedUnion := p.skipLines, p.noUnion
+	p.skipLines, p.noUnion = 0, false
+	body := p.parseBody("}")
+	p.skipLines, p.noUnion = saved, savedUnion
+	return body
+}
+
+// parseBody parses expressions separated by newlines or semicolons up to and including close
+func (p *parser) parseBody(close string) []*Expr {
+	var body []*Expr
+	for {
+		p.skipNewlines()
+		if p.accept(close) {
+			if len(body) == 0 {
+				p.fail(p.tokens[p.pos-1].line, "empty body")
+			}
+			return body
+		}
+		body = append(body, p.parseExpr())
+		t := p.peek()
+		if t.kind != tokNewline && !p.is(";") && !p.is(close) {
+			p.fail(t.line, "unexpected %s", t)
+		}
+	}
+}
+
+func (p *parser) parseExpr() *Expr {
+	line := p.peek().line
+	switch {
+	case p.accept("not"):
+		return &Expr{Line: line, Not: p.parseExpr()}
+	case p.accept("some"):
+		return &Expr{Line: line, Some: p.parseSome(line)}
+	case p.accept("every"):
+		return &Expr{Line: line, Every: p.parseEvery(line)}
+	}
+
+	expr := &Expr{Line: line}
+	left := p.parseTermIn()
+	switch {
+	case p.accept(":="):
+		expr.Assign = &Bind{Left: left, Right: p.parseTermIn()}
+	case p.accept("="):
+		expr.Unify = &Bind{Left: left, Right: p.parseTermIn()}
+	default:
+		expr.Term = left
+	}
+	for p.accept("with") {
+		target := p.parsePostfix(p.parsePrimary())
+		p.expect("as")
+		expr.With = append(expr.With, &With{Target: target, Value: p.parseTermIn()})
+	}
+	return expr
+}
+
+func (p *parser) parseSome(line int) *Some {
+	terms := []Term{p.parseTermRelation()}
+	for p.accept(",") {
+		terms = append(terms, p.parseTermRelation())
+	}
+	if p.accept("in") {
+		if len(terms) > 2 {
+			p.fail(line, "some takes a value or a key and value")
+		}
+		some := &Some{Value: terms[len(terms)-1], Collection: p.parseTermRelation()}
+		if len(terms) == 2 {
+			some.Key = terms[0]
+		}
+		return some
+	}
+
+	some := &Some{}
+	for _, t := range terms {
+		v, ok := t.(Var)
+		if !ok {
+			p.fail(line, "some declares variables")
+		}
+		some.Vars = append(some.Vars, v.Name)
+	}
+	return some
+}
+
+func (p *parser) parseEvery(line int) *Every {
+	every := &Every{Value: p.parseTermRelation()}
+	if p.accept(",") {
+		every.Key, every.Value = every.Value, p.parseTermRelation()
+	}
+	p.expect("in")
+	every.Collection = p.parseTermRelation()
+	every.Body = p.parseBraceBody()
+	return every
+}
+
+// Operators by precedence, from membership down to products
+var (
+	relationOps = map[string]string{"==": "equal", "!=": "neq", "<": "lt", "<=": "lte", ">": "gt", ">=": "gte"}
+	unionOps    = map[string]string{"|": "or"}
+	intersectOp = map[string]string{"&": "and"}
+	sumOps      = map[string]string{"+": "plus", "-": "minus"}
+	productOps  = map[string]string{"*": "mul", "/": "div", "%": "rem"}
+)
+
+const memberFunction = "internal.member_2"
+
+func (p *parser) parseTermIn() Term {
+	left := p.parseTermRelation()
+	for p.is("in") {
+		line := p.next().line
+		left = Call{Name: memberFunction, Args: []Term{left, p.parseTermRelation()}, Line: line}
+	}
+	return left
+}
+
+// parseTermUnion parses a term in which | is a union if allowed, or else ends the term, as in
+// the first term of a comprehension
+func (p *parser) parseTermUnion(allowed bool) Term {
+	saved := p.noUnion
+	p.noUnion = !allowed
+	defer func() { p.noUnion = saved }()
+	return p.parseTermIn()
+}
+
+func (p *parser) parseTermRelation() Term {
+	return p.parseBinary(relationOps, func() Term {
+		return p.parseBinary(unionOps, func() Term {
+			return p.parseBinary(intersectOp, func() Term {
+				return p.parseBinary(sumOps, func() Term {
+					return p.parseBinary(productOps, p.parseUnary)
+				})
+			})
+		})
+	})
+}
+
+func (p *parser) parseBinary(ops map[string]string, operand func() Term) Term {
+	left := operand()
+	for {
+		t := p.peek()
+		name, ok := ops[t.text]
+		if t.kind != tokOp || !ok || (t.text == "|" && p.noUnion) {
+			return left
+		}
+		p.next()
+		left = Call{Name: name, Args: []Term{left, operand()}, Line: t.line}
+	}
+}
+
+func (p *parser) parseUnary() Term {
+	if p.is("-") {
+		line := p.next().line
+		if t := p.peek(); t.kind == tokNumber {
+			n := p.parseNumber(p.next())
+			return Scalar{Value: n.Neg(n)}
+		}
+		return Call{Name: "minus", Args: []Term{Scalar{Value: number(0)}, p.parseUnary()}, Line: line}
+	}
+	return p.parsePostfix(p.parsePrimary())
+}
+
+func (p *parser) parseNumber(t token) *big.Rat {
+	n, ok := new(big.Rat).SetString(t.text)
+	if !ok {
+		p.fail(t.line, "invalid number %s", t.text)
+	}
+	return n
+}
+
+func (p *parser) parsePrimary() Term {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		return Scalar{Value: p.parseNumber(t)}
+	case tokString:
+		return Scalar{Value: t.text}
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return Scalar{Value: true}
+		case "false":
+			return Scalar{Value: false}
+		case "null":
+			return Scalar{Value: nil}
+		case "_":
+			p.wildcards++
+			return Var{Name: fmt.Sprintf("$%d", p.wildcards)}
+		}
+		if keywords[t.text] {
+			p.fail(t.line, "unexpected keyword %s", t.text)
+		}
+		if p.is("(") {
+			return Call{Name: t.text, Args: p.parseArgs(), Line: t.line}
+		}
+		return Var{Name: t.text}
+	case tokOp:
+		switch t.text {
+		case "(":
+			p.skipLines++
+			term := p.parseTermUnion(true)
+			p.expect(")")
+			p.skipLines--
+			return term
+		case "[":
+			return p.parseArray()
+		case "{":
+			return p.parseObjectOrSet()
+		}
+	}
+	p.fail(t.line, "unexpected %s", t)
+	return nil
+}
+
+func (p *parser) parseArgs() []Term {
+	p.expect("(")
+	p.skipLines++
+	defer func() { p.skipLines-- }()
+	var args []Term
+	if p.accept(")") {
+		return args
+	}
+	for {
+		args = append(args, p.parseTermUnion(true))
+		if p.accept(")") {
+			return args
+		}
+		p.expect(",")
+	}
+}
+
+// parsePostfix parses the references following a term, e.g. .user and [_]. A dotted name
+// followed by arguments is a call, e.g. time.clock(ns).
+func (p *parser) parsePostfix(head Term) Term {
+	var path []Term
+	name, dotted := "", false
+	if v, ok := head.(Var); ok {
+		name, dotted = v.Name, true
+	}
+	for {
+		switch {
+		case p.is("."):
+			p.next()
+			field := p.ident().text
+			path = append(path, Scalar{Value: field})
+			name += "." + field
+		case p.is("["):
+			p.next()
+			p.skipLines++
+			path = append(path, p.parseTermIn())
+			p.expect("]")
+			p.skipLines--
+			dotted = false
+		case p.is("(") && dotted && len(path) > 0:
+			line := p.peek().line
+			head = Call{Name: name, Args: p.parseArgs(), Line: line}
+			path, dotted = nil, false
+		default:
+			if len(path) == 0 {
+				return head
+			}
+			return Ref{Head: head, Path: path}
+		}
+	}
+}
+
+func (p *parser) parseArray() Term {
+	p.skipLines++
+	defer func() { p.skipLines-- }()
+	if p.accept("]") {
+		return ArrayTerm{}
+	}
+	first := p.parseTermUnion(false)
+	if p.accept("|") {
+		return Comprehension{Kind: "array", Value: first, Body: p.parseComprehensionBody("]")}
+	}
+	elems := []Term{first}
+	for p.accept(",") {
+		if p.is("]") {
+			break
+		}
+		elems = append(elems, p.parseTermUnion(true))
+	}
+	p.expect("]")
+	return ArrayTerm{Elems: elems}
+}
+
+func (p *parser) parseObjectOrSet() Term {
+	p.skipLines++
+	defer func() { p.skipLines-- }()
+	if p.accept("}") {
+		return ObjectTerm{}
+	}
+	first := p.parseTermUnion(false)
+	if p.accept(":") {
+		value := p.parseTermUnion(false)
+		if p.accept("|") {
+			return Comprehension{Kind: "object", Key: first, Value: value, Body: p.parseComprehensionBody("}")}
+		}
+		items := [][2]Term{{first, value}}
+		for p.accept(",") {
+			if p.is("}") {
+				break
+			}
+			key := p.parseTermUnion(true)
+			p.expect(":")
+			items = append(items, [2]Term{key, p.parseTermUnion(true)})
+		}
+		p.expect("}")
+		return ObjectTerm{Items: items}
+	}
+	if p.accept("|") {
+		return Comprehension{Kind: "set", Value: first, Body: p.parseComprehensionBody("}")}
+	}
+	elems := []Term{first}
+	for p.accept(",") {
+		if p.is("}") {
+			break
+		}
+		elems = append(elems, p.parseTermUnion(true))
+	}
+	p.expect("}")
+	return SetTerm{Elems: elems}
+}
+
+func (p *parser) parseComprehensionBody(close string) []*Expr {
+	saved, savedUnion := p.skipLines, p.noUnion
+	p.skipLines, p.noUnion = 0, false
+	defer func() { p.skipLines, p.noUnion = saved, savedUnion }()
+	return p.parseBody(close)
+}
@@ -0,0 +1,329 @@
+package rego
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func input(t *testing.T, document string) Value {
+	t.Helper()
+	var raw interface{}
+	decoder := json.NewDecoder(strings.NewReader(document))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		t.Fatal(err)
+	}
+	v, err := FromJSON(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		input  string
+		rule   string
+		want   string // JSON; empty when undefined
+	}{
+		{
+			name:   "default",
+			source: "package p\ndefault allow := false\nallow if input.admin",
+			input:  `{"admin": false}`,
+			rule:   "allow",
+			want:   `false`,
+		},
+		{
+			name:   "membership",
+			source: "package p\nallow if {\n\tsome role in input.roles\n\trole == \"admin\"\n}",
+			input:  `{"roles": ["viewer", "admin"]}`,
+			rule:   "allow",
+			want:   `true`,
+		},
+		{
+			name:   "v0 body",
+			source: "package p\nallow { input.roles[_] = \"admin\" }",
+			input:  `{"roles": ["viewer"]}`,
+			rule:   "allow",
+		},
+		{
+			name:   "partial set",
+			source: "package p\nreasons contains msg if {\n\tsome r in input.roles\n\tnot r in {\"admin\"}\n\tmsg := sprintf(\"role %s\", [r])\n}",
+			input:  `{"roles": ["a", "admin", "b"]}`,
+			rule:   "reasons",
+			want:   `["role a","role b"]`,
+		},
+		{
+			name:   "partial object",
+			source: "package p\nlimits[name] := n * 2 if {\n\tsome name, n in input.limits\n}",
+			input:  `{"limits": {"x": 1, "y": 2.5}}`,
+			rule:   "limits",
+			want:   `{"x":2,"y":5}`,
+		},
+		{
+			name:   "function",
+			source: "package p\nallowed(action) if action in [\"read\", \"list\"]\nallow if allowed(input.action)",
+			input:  `{"action": "list"}`,
+			rule:   "allow",
+			want:   `true`,
+		},
+		{
+			name:   "every",
+			source: "package p\nallow if {\n\tcount(input.roles) > 0\n\tevery r in input.roles { startswith(r, \"app:\") }\n}",
+			input:  `{"roles": ["app:a", "org:b"]}`,
+			rule:   "allow",
+		},
+		{
+			name:   "comprehension",
+			source: "package p\nnames := {n | some u in input.users; u.active; n := lower(u.name)}",
+			input:  `{"users": [{"name": "A", "active": true}, {"name": "B", "active": false}, {"name": "a", "active": true}]}`,
+			rule:   "names",
+			want:   `["a"]`,
+		},
+		{
+			name:   "arithmetic",
+			source: "package p\nx := (input.a + 1) * 3 % 4 - -2",
+			input:  `{"a": 2}`,
+			rule:   "x",
+			want:   `3`,
+		},
+		{
+			name:   "imported input",
+			source: "package p\nimport input.user as u\nallow if u.id == \"1\"",
+			input:  `{"user": {"id": "1"}}`,
+			rule:   "allow",
+			want:   `true`,
+		},
+		{
+			name:   "undefined path",
+			source: "package p\nallow if input.missing.field",
+			input:  `{}`,
+			rule:   "allow",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prog, err := Compile(map[string]string{"test.rego": tt.source})
+			if err != nil {
+				t.Fatalf("Compile() error = %v", err)
+			}
+			got, defined, err := prog.Eval(context.Background(), []string{"p", tt.rule}, input(t, tt.input))
+			if err != nil {
+				t.Fatalf("Eval() error = %v", err)
+			}
+			if !defined {
+				if tt.want != "" {
+					t.Fatalf("Eval() undefined, want %s", tt.want)
+				}
+				return
+			}
+			encoded, _ := json.Marshal(ToJSON(got))
+			if string(encoded) != tt.want {
+				t.Errorf("Eval() = %s, want %q", encoded, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		code   string
+	}{
+		{"missing package", "allow := true", parseErrorCode},
+		{"unterminated body", "package p\nallow if {\n\ttrue\n", parseErrorCode},
+		{"unknown function", "package p\nallow if crypto.sha384(input.x)", typeErrorCode},
+		{"http.send", "package p\nallow if http.send({\"method\": \"get\", \"url\": input.url})", typeErrorCode},
+		{"net", "package p\nallow if net.lookup_ip_addr(input.host)", typeErrorCode},
+		{"opa.runtime", "package p\nenv := opa.runtime().env", typeErrorCode},
+		{"wrong arity", "package p\nallow if startswith(input.x)", typeErrorCode},
+		{"conflicting kinds", "package p\nx := 1\nx contains 2", compileErrorCode},
+		{"multiple defaults", "package p\ndefault x := 1\ndefault x := 2", compileErrorCode},
+		{"reassigned", "package p\nallow if {\n\tx := 1\n\tx := 2\n}", compileErrorCode},
+		{"rule and dotted rule", "package p\na := 1\na.b := 2", compileErrorCode},
+		{"dotted function", "package p\na.f(x) := x", parseErrorCode},
+		{"else of partial set", "package p\nr contains 1 if input.x else := 2", parseErrorCode},
+		{"with local variable", "package p\nallow if {\n\tx := 1\n\ttrue with x as 2\n}", typeErrorCode},
+		{"with http.send", "package p\nallow if input.x with http.send as {}", typeErrorCode},
+		{"with replacement http.send", "package p\nallow if time.now_ns() with time.now_ns as http.send", typeErrorCode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile(map[string]string{"test.rego": tt.source})
+			var regoErr *Error
+			if !errors.As(err, &regoErr) || regoErr.Code != tt.code {
+				t.Fatalf("Compile() error = %v, want %s", err, tt.code)
+			}
+		})
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		code   string
+	}{
+		{"conflict", "package p\nx := input.a\nx := input.b", conflictErrorCode},
+		{"builtin error", "package p\nx := input.a / 0", builtinErrorCode},
+		{"type error", "package p\nx := input.a + \"1\"", builtinErrorCode},
+		{"unsafe", "package p\nallow if y == 1", unsafeVarCode},
+		{"recursion", "package p\na if b\nb if a", recursionCode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prog, err := Compile(map[string]string{"test.rego": tt.source}, WithStrictBuiltinErrors())
+			if err != nil {
+				var regoErr *Error
+				if errors.As(err, &regoErr) && regoErr.Code == tt.code {
+					return
+				}
+				t.Fatalf("Compile() error = %v", err)
+			}
+			_, _, err = prog.Eval(context.Background(), []string{"p"}, input(t, `{"a": 1, "b": 2}`))
+			var regoErr *Error
+			if !errors.As(err, &regoErr) || regoErr.Code != tt.code {
+				t.Fatalf("Eval() error = %v, want %s", err, tt.code)
+			}
+		})
+	}
+}
+
+func TestBuiltinErrorsUndefined(t *testing.T) {
+	prog, err := Compile(map[string]string{"test.rego": "package p\nx := input.a / 0\ny if not to_number(input.b)"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _, err := prog.Eval(context.Background(), []string{"p"}, input(t, `{"a": 1, "b": "one"}`))
+	if err != nil {
+		t.Fatalf("Eval() error = %v", err)
+	}
+	if encoded, _ := json.Marshal(ToJSON(got)); string(encoded) != `{"y":true}` {
+		t.Errorf("Eval() = %s, want {\"y\":true}", encoded)
+	}
+}
+
+func TestPrint(t *testing.T) {
+	var out strings.Builder
+	prog, err := Compile(map[string]string{"test.rego": "package p\nallow if {\n\tprint(\"user\", input.user, input.missing, {\"a\": [1]})\n}"}, WithPrintHook(&out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := prog.Eval(context.Background(), []string{"p", "allow"}, input(t, `{"user": "alice"}`)); err != nil {
+		t.Fatalf("Eval() error = %v", err)
+	}
+	if want := "user alice <undefined> {\"a\": [1]}\n"; out.String() != want {
+		t.Errorf("print output = %q, want %q", out.String(), want)
+	}
+}
+
+func TestEvalCancelled(t *testing.T) {
+	prog, err := Compile(map[string]string{"test.rego": "package p\nallow if input.x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = prog.Eval(ctx, []string{"p", "allow"}, input(t, `{"x": true}`))
+	var regoErr *Error
+	if !errors.As(err, &regoErr) || regoErr.Code != cancelErrorCode {
+		t.Fatalf("Eval() error = %v, want %s", err, cancelErrorCode)
+	}
+}
+
+func TestPackage(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		valid  bool
+	}{
+		{"own package", "package tenant.app\nallow if data.tenant.app.admins[input.user]", true},
+		{"own function", "package tenant.app\nf(x) := x\nallow if data.tenant.app.f(true)", true},
+		{"own import", "package tenant.app\nimport data.tenant.app.roles\nallow if roles.admin", true},
+		{"other package", "package other.app\nallow := true", false},
+		{"sibling package", "package tenant.other\nallow := true", false},
+		{"subpackage", "package tenant.app.helpers\nallow := true", false},
+		{"other document", "package tenant.app\nsecret := data.other.keys", false},
+		{"sibling document", "package tenant.app\nsecret := data.tenant.other.keys", false},
+		{"tenant document", "package tenant.app\nall := data.tenant", false},
+		{"dynamic document", "package tenant.app\nsecret := data.tenant[input.app]", false},
+		{"whole data", "package tenant.app\nall := data", false},
+		{"sibling import", "package tenant.app\nimport data.tenant.other\nallow if other.allow", false},
+		{"other function", "package tenant.app\nallow if data.tenant.other.f(1)", false},
+		{"own with", "package tenant.app\nallow if data.tenant.app.x with data.tenant.app.x as true", true},
+		{"other with", "package tenant.app\nallow if input.x with data.tenant.other.keys as []", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile(map[string]string{"test.rego": tt.source}, WithPackage("tenant", "app"))
+			if (err == nil) != tt.valid {
+				t.Errorf("Compile() error = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestExternalFunctions(t *testing.T) {
+	for source, valid := range map[string]bool{
+		"package p\nallow if crypto.sha384(input.x) == \"\"":      true,
+		"package p\nallow if http.send({\"url\": input.url})":     false,
+		"package p\nallow if opa.runtime().env.SECRET == input.x": false,
+		"package p\nallow if data.p.missing(input.x)":             false,
+	} {
+		_, err := Compile(map[string]string{"test.rego": source}, WithExternalFunctions())
+		if (err == nil) != valid {
+			t.Errorf("Compile(%q) error = %v, want valid %v", source, err, valid)
+		}
+	}
+}
+
+// TestCorpus runs the test rules of the modules in testdata, which also pass with opa test
+func TestCorpus(t *testing.T) {
+	paths, err := filepath.Glob("testdata/*.rego")
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no corpus modules: %v", err)
+	}
+	modules := map[string]string{}
+	for _, path := range paths {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		modules[path] = string(src)
+	}
+	prog, err := Compile(modules)
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	for _, path := range paths {
+		module, err := parseModule(path, modules[path])
+		if err != nil {
+			t.Fatal(err)
+		}
+		tests := map[string]bool{}
+		for _, rule := range module.Rules {
+			if !strings.HasPrefix(rule.Name, "test_") || tests[rule.Name] {
+				continue
+			}
+			tests[rule.Name] = true
+			t.Run(strings.Join(module.Package, ".")+"."+rule.Name, func(t *testing.T) {
+				got, defined, err := prog.Eval(context.Background(), append(module.Package, rule.Name), nil)
+				if err != nil {
+					t.Fatalf("Eval() error = %v", err)
+				}
+				if !defined || got != true {
+					t.Errorf("Eval() = %v, defined %v, want true", got, defined)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,117 @@
+# Numbers, aggregates, arrays, sets and objects
+package parity.collections
+
+import rego.v1
+
+test_arithmetic if {
+	1 + 2 * 3 == 7
+	(1 + 2) * 3 == 9
+	7 % 3 == 1
+	10 / 4 == 2.5
+	-3 + 1 == -2
+}
+
+test_number_functions if {
+	abs(-2) == 2
+	round(2.5) == 3
+	round(-2.5) == -3
+	ceil(1.2) == 2
+	floor(-1.5) == -2
+	to_number("10") == 10
+	to_number(true) == 1
+	numbers.range(1, 3) == [1, 2, 3]
+	numbers.range(3, 1) == [3, 2, 1]
+}
+
+test_comparison if {
+	1 < 2
+	"a" < "b"
+	null < false
+	false < 0
+	0 < ""
+	[1, 2] < [1, 3]
+	1 != "1"
+}
+
+test_aggregates if {
+	count([1, 2, 3]) == 3
+	count({"a": 1}) == 1
+	count(set()) == 0
+	sum([1, 2, 3]) == 6
+	product([2, 3]) == 6
+	max([1, 3, 2]) == 3
+	min({4, 2}) == 2
+	not max([])
+	sort([3, 1, 2]) == [1, 2, 3]
+	sort({"b", "a"}) == ["a", "b"]
+}
+
+test_arrays if {
+	array.concat([1], [2, 3]) == [1, 2, 3]
+	array.slice([1, 2, 3, 4], 1, 3) == [2, 3]
+	array.slice([1, 2], 1, 10) == [2]
+	array.reverse([1, 2, 3]) == [3, 2, 1]
+}
+
+test_set_operators if {
+	{1, 2} | {3} == {1, 2, 3}
+	{1, 2} & {2, 3} == {2}
+	{1, 2} - {2} == {1}
+	union({{1}, {2, 3}}) == {1, 2, 3}
+	intersection({{1, 2}, {2, 3}}) == {2}
+}
+
+test_object_get if {
+	object.get({"a": {"b": 1}}, ["a", "b"], 0) == 1
+	object.get({"a": 1}, "a", 0) == 1
+	object.get({}, "x", "default") == "default"
+	object.get({"a": {}}, ["a", "b"], null) == null
+}
+
+test_object_keys_union if {
+	object.keys({"a": 1, "b": 2}) == {"a", "b"}
+	object.union({"a": 1, "n": {"x": 1}}, {"b": 2, "n": {"y": 2}}) == {"a": 1, "b": 2, "n": {"x": 1, "y": 2}}
+	object.union_n([{"a": 1}, {"a": 2, "b": 3}]) == {"a": 2, "b": 3}
+}
+
+test_object_remove if {
+	object.remove({"a": 1, "b": 2}, ["a"]) == {"b": 2}
+	object.remove({"a": 1, "b": 2}, {"b"}) == {"a": 1}
+	object.remove({"a": 1, "b": 2}, {"a": "x", "b": "y"}) == {}
+}
+
+test_object_filter if {
+	object.filter({"a": 1, "b": 2, "c": 3}, ["a", "c"]) == {"a": 1, "c": 3}
+	object.filter({"a": 1}, set()) == {}
+}
+
+test_object_subset if {
+	object.subset({"a": 1, "b": {"c": 2, "d": 3}}, {"b": {"c": 2}})
+	not object.subset({"a": 1}, {"a": 2})
+	object.subset([1, 2, 3, 4], [2, 3])
+	not object.subset([1, 2, 3], [1, 3])
+	object.subset({1, 2, 3}, {1, 3})
+}
+
+test_types if {
+	type_name(null) == "null"
+	type_name(true) == "boolean"
+	type_name(1) == "number"
+	type_name("") == "string"
+	type_name([]) == "array"
+	type_name({}) == "object"
+	type_name(set()) == "set"
+	is_string("a")
+	is_number(1.5)
+	is_boolean(false)
+	is_array([])
+	is_object({})
+	is_set(set())
+	is_null(null)
+}
+
+test_collections_equal if {
+	{"a": [1, {2}]} == {"a": [1, {2}]}
+	{1, 2} == {2, 1}
+	[1, 2] != [2, 1]
+}
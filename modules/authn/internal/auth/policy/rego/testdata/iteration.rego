@@ -0,0 +1,113 @@
+# Iteration and unification: some, every, not, comprehensions, walk
+package parity.iteration
+
+import rego.v1
+
+users := [
+	{"name": "alice", "roles": ["admin", "viewer"], "active": true},
+	{"name": "bob", "roles": ["viewer"], "active": false},
+	{"name": "carol", "roles": ["editor"], "active": true},
+]
+
+test_some_in if {
+	some user in users
+	user.name == "carol"
+}
+
+test_some_key_value if {
+	some i, user in users
+	user.name == "bob"
+	i == 1
+}
+
+test_some_declared if {
+	some i
+	users[i].name == "alice"
+	i == 0
+}
+
+test_wildcard if users[_].roles[_] == "editor"
+
+test_every if {
+	every user in users {
+		count(user.roles) > 0
+	}
+}
+
+test_every_fails if {
+	not every_active
+}
+
+every_active if {
+	every user in users {
+		user.active
+	}
+}
+
+test_every_key_value if {
+	every i, n in [0, 1, 2] {
+		i == n
+	}
+}
+
+test_not if {
+	not "root" in {u.name | some u in users}
+}
+
+test_array_comprehension if {
+	names := [u.name | some u in users; u.active]
+	names == ["alice", "carol"]
+}
+
+test_set_comprehension if {
+	roles := {r | some u in users; some r in u.roles}
+	roles == {"admin", "viewer", "editor"}
+}
+
+test_object_comprehension if {
+	by_name := {u.name: count(u.roles) | some u in users}
+	by_name == {"alice": 2, "bob": 1, "carol": 1}
+}
+
+test_nested_comprehension if {
+	pairs := [[u.name, r] | some u in users; r := [x | some x in u.roles; x != "viewer"]]
+	pairs == [["alice", ["admin"]], ["bob", []], ["carol", ["editor"]]]
+}
+
+test_unify_array if {
+	[a, b] := [1, 2]
+	a + b == 3
+}
+
+test_unify_object if {
+	{"x": x, "y": [_, y]} = {"x": 5, "y": [1, 6]}
+	x + y == 11
+}
+
+test_unify_both_sides if {
+	[1, z] = [w, 2]
+	w == 1
+	z == 2
+}
+
+test_membership if {
+	"admin" in users[0].roles
+	not "admin" in users[1].roles
+	2 in {"a": 1, "b": 2}
+	some k, "viewer" in users[0].roles
+	k == 1
+}
+
+test_walk if {
+	paths := {p | walk({"a": {"b": 1}, "c": [true]}, [p, _])}
+	paths == {[], ["a"], ["a", "b"], ["c"], ["c", 0]}
+}
+
+test_walk_values if {
+	leaves := [v | walk({"a": {"b": 1}, "c": 2}, [_, v]); is_number(v)]
+	leaves == [1, 2]
+}
+
+test_print if {
+	print("users:", count(users), users[0].name)
+}
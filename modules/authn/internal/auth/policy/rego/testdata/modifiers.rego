@@ -0,0 +1,47 @@
+# with: replacing input, documents under data and functions while an expression is evaluated
+package parity.modifiers
+
+import rego.v1
+
+allow if input.user.role == "admin"
+
+is_admin(user) if user in data.parity.modifiers.directory.admins
+
+recent if time.now_ns() - input.issued_ns < 1000
+
+five(_) := 5
+
+outer if {
+	input.x == 1
+	inner with input.y as 2
+}
+
+inner if {
+	input.x == 1
+	input.y == 2
+}
+
+test_input if allow with input as {"user": {"role": "admin"}}
+
+test_input_path if allow with input.user.role as "admin"
+
+test_input_denied if not allow with input as {"user": {"role": "viewer"}}
+
+test_input_scope if {
+	allow with input.user.role as "admin"
+	not allow
+}
+
+test_base_document if is_admin("alice") with data.parity.modifiers.directory.admins as ["alice"]
+
+test_base_document_missing if not is_admin("alice")
+
+test_rule_replaced if allow with data.parity.modifiers.allow as true
+
+test_nested if outer with input.x as 1
+
+test_builtin_value if recent with time.now_ns as 1500 with input.issued_ns as 1000
+
+test_builtin_function if count([1, 2]) == 5 with count as five
+
+test_function_value if is_admin("mallory") with data.parity.modifiers.is_admin as true
@@ -0,0 +1,45 @@
+# References: rules with dotted names, references to data and input, undefined paths
+package parity.refs
+
+import rego.v1
+
+fruits.apple.color := "red"
+
+fruits.banana.color := "yellow"
+
+limits.requests[name] := n if {
+	some name, n in {"read": 10, "write": 5}
+}
+
+groups.admins contains user if {
+	some user in ["alice", "bob"]
+}
+
+roles := {"alice": ["admin"], "bob": ["viewer", "editor"]}
+
+user_roles := roles[input.user]
+
+test_constant_ref_head if fruits.apple.color == "red"
+
+test_ref_head_prefix if {
+	fruits == {"apple": {"color": "red"}, "banana": {"color": "yellow"}}
+}
+
+test_ref_head_variable_key if limits.requests == {"read": 10, "write": 5}
+
+test_ref_head_contains if groups.admins == {"alice", "bob"}
+
+test_ref_head_data_path if data.parity.refs.fruits.banana.color == "yellow"
+
+test_data_document if data.parity.refs.roles.bob[1] == "editor"
+
+test_input_lookup if user_roles == ["admin"] with input as {"user": "alice"}
+
+test_undefined_lookup if not user_roles with input as {"user": "carol"}
+
+test_iterate_data if {
+	admins := {name | some name, rs in roles; "admin" in rs}
+	admins == {"alice"}
+}
+
+test_literal_ref if [1, [2, 3]][1][0] == 2
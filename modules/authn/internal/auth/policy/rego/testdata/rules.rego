@@ -0,0 +1,101 @@
+# Rule kinds: defaults, complete rules, partial sets and objects, functions and else
+package parity.rules
+
+import rego.v1
+
+default allow := false
+
+allow if {
+	input.user.role == "admin"
+}
+
+allow if {
+	input.user.role == "editor"
+	input.action in {"read", "write"}
+}
+
+reasons contains "not an admin" if input.user.role != "admin"
+
+reasons contains msg if {
+	some action in input.denied
+	msg := sprintf("%s denied", [action])
+}
+
+quota[name] := limit * 2 if {
+	some name, limit in input.limits
+}
+
+describe(1) := "one"
+
+describe(n) := "many" if n > 1
+
+double(x) := x * 2
+
+bounded(x) := min([max([x, 0]), 10])
+
+grade(score) := "A" if {
+	score >= 90
+} else := "B" if {
+	score >= 80
+} else := "C"
+
+decision := "allow" if {
+	input.admin
+} else := "review" if {
+	input.reviewer
+} else := "deny"
+
+fallback if {
+	input.never
+} else := false
+
+test_default_allow if {
+	not allow with input as {"user": {"role": "viewer"}}
+	allow == false with input as {"user": {"role": "viewer"}}
+}
+
+test_allow_admin if allow with input as {"user": {"role": "admin"}}
+
+test_allow_editor if allow with input as {"user": {"role": "editor"}, "action": "write"}
+
+test_deny_editor_delete if not allow with input as {"user": {"role": "editor"}, "action": "delete"}
+
+test_partial_set if {
+	r := reasons with input as {"user": {"role": "viewer"}, "denied": ["delete", "write"]}
+	r == {"not an admin", "delete denied", "write denied"}
+}
+
+test_partial_set_empty if {
+	r := reasons with input as {"user": {"role": "admin"}}
+	r == set()
+}
+
+test_partial_object if {
+	q := quota with input as {"limits": {"read": 5, "write": 1}}
+	q == {"read": 10, "write": 2}
+	q.read == 10
+}
+
+test_functions if {
+	describe(1) == "one"
+	describe(3) == "many"
+	not describe(0)
+	double(4) == 8
+	bounded(-5) == 0
+	bounded(50) == 10
+	bounded(7) == 7
+}
+
+test_else_function if {
+	grade(95) == "A"
+	grade(85) == "B"
+	grade(10) == "C"
+}
+
+test_else_first if decision == "allow" with input as {"admin": true}
+
+test_else_middle if decision == "review" with input as {"reviewer": true}
+
+test_else_last if decision == "deny" with input as {}
+
+test_else_without_body if fallback == false
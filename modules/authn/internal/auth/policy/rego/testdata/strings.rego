@@ -0,0 +1,107 @@
+# String, regular expression and glob built-ins
+package parity.strings
+
+import rego.v1
+
+test_concat_split if {
+	concat("-", ["a", "b", "c"]) == "a-b-c"
+	concat(",", set()) == ""
+	split("a,b,,c", ",") == ["a", "b", "", "c"]
+}
+
+test_case if {
+	lower("AbC") == "abc"
+	upper("AbC") == "ABC"
+}
+
+test_trim if {
+	trim("  x  ", " ") == "x"
+	trim_left("xxa", "x") == "a"
+	trim_right("axx", "x") == "a"
+	trim_prefix("prefix-a", "prefix-") == "a"
+	trim_suffix("a.rego", ".rego") == "a"
+	trim_space("\t a \n") == "a"
+}
+
+test_search if {
+	contains("hello", "ell")
+	startswith("hello", "he")
+	endswith("hello", "lo")
+	indexof("hello", "l") == 2
+	indexof("hello", "z") == -1
+	not startswith("hello", "lo")
+}
+
+test_substring if {
+	substring("hello", 1, 3) == "ell"
+	substring("hello", 2, -1) == "llo"
+	substring("héllo", 1, 1) == "é"
+}
+
+test_count_runes if count("héllo") == 5
+
+test_replace if {
+	replace("a.b.c", ".", "/") == "a/b/c"
+	strings.replace_n({"a": "b", "c": "d"}, "acac") == "bdbd"
+	strings.reverse("abc") == "cba"
+}
+
+test_sprintf if {
+	sprintf("%s-%d", ["a", 1]) == "a-1"
+	sprintf("%v", [true]) == "true"
+	sprintf("%.2f", [1.5]) == "1.50"
+}
+
+test_format_int if {
+	format_int(255, 16) == "ff"
+	format_int(5, 2) == "101"
+}
+
+test_any_prefix_match if {
+	strings.any_prefix_match("foo bar", "foo")
+	strings.any_prefix_match(["a/b", "c"], ["x/", "a/"])
+	strings.any_prefix_match({"svc.read"}, {"svc."})
+	not strings.any_prefix_match("x", ["y", "z"])
+}
+
+test_any_suffix_match if {
+	strings.any_suffix_match("policy.rego", [".json", ".rego"])
+	not strings.any_suffix_match(["a.txt"], ".rego")
+}
+
+test_regex if {
+	regex.match(`^[a-z]+-\d+$`, "abc-12")
+	not regex.match("^a+$", "ab")
+	regex.is_valid("^a+$")
+	not regex.is_valid("[")
+}
+
+test_regex_find_n if {
+	regex.find_n("[a-z]+", "ab 12 cd ef", 2) == ["ab", "cd"]
+	regex.find_n("[a-z]+", "ab 12 cd ef", -1) == ["ab", "cd", "ef"]
+	regex.find_n("[a-z]+", "12", -1) == []
+}
+
+test_regex_split_replace if {
+	regex.split(`,\s*`, "a, b,c") == ["a", "b", "c"]
+	regex.replace("a1b22", "[0-9]+", "#") == "a#b#"
+}
+
+test_glob_delimiters if {
+	glob.match("*.github.com", [], "api.github.com")
+	not glob.match("*.github.com", [], "api.cdn.github.com")
+	glob.match("*.github.com", null, "api.cdn.github.com")
+	glob.match("**.github.com", [], "api.cdn.github.com")
+	glob.match("*:*", [":"], "a:b")
+	not glob.match("*", [":"], "a:b")
+}
+
+test_glob_patterns if {
+	glob.match("{cat,bat}", [], "bat")
+	not glob.match("{cat,bat}", [], "rat")
+	glob.match("[a-c]at", [], "bat")
+	glob.match("[!a-c]at", [], "rat")
+	not glob.match("[!a-c]at", [], "cat")
+	glob.match("?at", [], "cat")
+	not glob.match("?at", [], "at")
+}
@@ -0,0 +1,43 @@
+# Time, network and version built-ins
+package parity.time_net
+
+import rego.v1
+
+new_year := 1577836800000000000 # 2020-01-01T00:00:00Z
+
+test_parse_rfc3339 if time.parse_rfc3339_ns("2020-01-01T00:00:00Z") == new_year
+
+test_date_clock if {
+	time.date(new_year) == [2020, 1, 1]
+	time.clock(new_year + 3723000000000) == [1, 2, 3]
+	time.weekday(new_year) == "Wednesday"
+}
+
+test_add_date if time.add_date(new_year, 0, 1, 0) == 1580515200000000000
+
+test_now_mocked if time.now_ns() == new_year with time.now_ns as new_year
+
+test_cidr_contains if {
+	net.cidr_contains("10.0.0.0/8", "10.1.2.3")
+	not net.cidr_contains("10.0.0.0/8", "11.0.0.1")
+	net.cidr_contains("10.0.0.0/8", "10.1.0.0/16")
+	not net.cidr_contains("10.1.0.0/16", "10.0.0.0/8")
+	net.cidr_contains("2001:db8::/32", "2001:db8::1")
+}
+
+test_cidr_intersects if {
+	net.cidr_intersects("10.0.0.0/8", "10.1.0.0/16")
+	not net.cidr_intersects("10.0.0.0/16", "10.1.0.0/16")
+}
+
+test_semver if {
+	semver.is_valid("1.0.0")
+	semver.is_valid("1.0.0-alpha.1+build.5")
+	not semver.is_valid("v1.0.0")
+	not semver.is_valid("1.0")
+	semver.compare("1.2.3", "1.10.0") == -1
+	semver.compare("1.0.0", "1.0.0+build") == 0
+	semver.compare("1.0.0-alpha", "1.0.0") == -1
+	semver.compare("1.0.0-alpha.1", "1.0.0-alpha.beta") == -1
+	semver.compare("2.0.0", "1.9.9") == 1
+}
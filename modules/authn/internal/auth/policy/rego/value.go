@@ -0,0 +1,338 @@
+package rego
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Value is a Rego value: nil (null), bool, *big.Rat (number), string, Array, Object or Set
+type Value interface{}
+
+// Array is a Rego array
+type Array []Value
+
+// Object is a Rego object; keys may be any value
+type Object map[string]ObjectItem
+
+// ObjectItem is a key and value of an Object, stored under the key's canonical form
+type ObjectItem struct {
+	Key   Value
+	Value Value
+}
+
+// Set is a Rego set, storing elements under their canonical form
+type Set map[string]Value
+
+// Put stores key and value in the object
+func (o Object) Put(key, value Value) {
+	o[canonical(key)] = ObjectItem{Key: key, Value: value}
+}
+
+// Get returns the value stored under key
+func (o Object) Get(key Value) (Value, bool) {
+	item, ok := o[canonical(key)]
+	return item.Value, ok
+}
+
+// Items returns the items of the object ordered by key
+func (o Object) Items() []ObjectItem {
+	items := make([]ObjectItem, 0, len(o))
+	for _, item := range o {
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return Compare(items[i].Key, items[j].Key) < 0 })
+	return items
+}
+
+// Add adds v to the set
+func (s Set) Add(v Value) {
+	s[canonical(v)] = v
+}
+
+// Contains reports whether v is an element of the set
+func (s Set) Contains(v Value) bool {
+	_, ok := s[canonical(v)]
+	return ok
+}
+
+// Elements returns the elements of the set in order
+func (s Set) Elements() []Value {
+	elems := make([]Value, 0, len(s))
+	for _, v := range s {
+		elems = append(elems, v)
+	}
+	sort.Slice(elems, func(i, j int) bool { return Compare(elems[i], elems[j]) < 0 })
+	return elems
+}
+
+// typeName returns the Rego name of the type of v
+func typeName(v Value) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case *big.Rat:
+		return "number"
+	case string:
+		return "string"
+	case Array:
+		return "array"
+	case Object:
+		return "object"
+	case Set:
+		return "set"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// typeOrder ranks types like OPA: null < boolean < number < string < array < object < set
+func typeOrder(v Value) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case *big.Rat:
+		return 2
+	case string:
+		return 3
+	case Array:
+		return 4
+	case Object:
+		return 5
+	case Set:
+		return 6
+	}
+	return 7
+}
+
+// Compare orders any two values, first by type and then by value
+func Compare(a, b Value) int {
+	if ta, tb := typeOrder(a), typeOrder(b); ta != tb {
+		return ta - tb
+	}
+	switch a := a.(type) {
+	case nil:
+		return 0
+	case bool:
+		bb := b.(bool)
+		switch {
+		case a == bb:
+			return 0
+		case !a:
+			return -1
+		}
+		return 1
+	case *big.Rat:
+		return a.Cmp(b.(*big.Rat))
+	case string:
+		return strings.Compare(a, b.(string))
+	case Array:
+		return compareSlices(a, b.(Array))
+	case Object:
+		ai, bi := a.Items(), b.(Object).Items()
+		for i := 0; i < len(ai) && i < len(bi); i++ {
+			if c := Compare(ai[i].Key, bi[i].Key); c != 0 {
+				return c
+			}
+			if c := Compare(ai[i].Value, bi[i].Value); c != 0 {
+				return c
+			}
+		}
+		return len(ai) - len(bi)
+	case Set:
+		return compareSlices(a.Elements(), b.(Set).Elements())
+	}
+	return 0
+}
+
+func compareSlices(a, b []Value) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := Compare(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return len(a) - len(b)
+}
+
+// Equal reports whether a and b are the same value
+func Equal(a, b Value) bool {
+	return Compare(a, b) == 0
+}
+
+// canonical returns a string identifying v, used as the key of sets and objects
+func canonical(v Value) string {
+	var sb strings.Builder
+	writeCanonical(&sb, v)
+	return sb.String()
+}
+
+func writeCanonical(sb *strings.Builder, v Value) {
+	switch v := v.(type) {
+	case nil:
+		sb.WriteString("null")
+	case bool:
+		sb.WriteString(strconv.FormatBool(v))
+	case *big.Rat:
+		sb.WriteString(v.RatString())
+	case string:
+		sb.WriteString(strconv.Quote(v))
+	case Array:
+		sb.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			writeCanonical(sb, e)
+		}
+		sb.WriteByte(']')
+	case Object:
+		sb.WriteByte('{')
+		for i, item := range v.Items() {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			writeCanonical(sb, item.Key)
+			sb.WriteByte(':')
+			writeCanonical(sb, item.Value)
+		}
+		sb.WriteByte('}')
+	case Set:
+		sb.WriteString("set(")
+		for i, e := range v.Elements() {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			writeCanonical(sb, e)
+		}
+		sb.WriteByte(')')
+	}
+}
+
+// String formats v in Rego syntax like OPA, e.g. for sprintf and print
+func String(v Value) string {
+	switch v := v.(type) {
+	case *big.Rat:
+		return formatNumber(v)
+	case Array:
+		return "[" + joinValues(v) + "]"
+	case Object:
+		parts := make([]string, 0, len(v))
+		for _, item := range v.Items() {
+			parts = append(parts, String(item.Key)+": "+String(item.Value))
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	case Set:
+		if len(v) == 0 {
+			return "set()"
+		}
+		return "{" + joinValues(v.Elements()) + "}"
+	}
+	return canonical(v)
+}
+
+func joinValues(values []Value) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = String(v)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func formatNumber(n *big.Rat) string {
+	if n.IsInt() {
+		return n.Num().String()
+	}
+	f, _ := n.Float64()
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// FromJSON converts a document decoded from JSON into a value. Numbers may be float64 or
+// json.Number.
+func FromJSON(doc interface{}) (Value, error) {
+	switch doc := doc.(type) {
+	case nil, bool, string:
+		return doc, nil
+	case json.Number:
+		n, ok := new(big.Rat).SetString(doc.String())
+		if !ok {
+			return nil, fmt.Errorf("invalid number %s", doc)
+		}
+		return n, nil
+	case float64:
+		n := new(big.Rat)
+		if n.SetFloat64(doc) == nil {
+			return nil, fmt.Errorf("invalid number %v", doc)
+		}
+		return n, nil
+	case []interface{}:
+		arr := make(Array, len(doc))
+		for i, e := range doc {
+			v, err := FromJSON(e)
+			if err != nil {
+				return nil, err
+			}
+			arr[i] = v
+		}
+		return arr, nil
+	case map[string]interface{}:
+		obj := make(Object, len(doc))
+		for k, e := range doc {
+			v, err := FromJSON(e)
+			if err != nil {
+				return nil, err
+			}
+			obj.Put(k, v)
+		}
+		return obj, nil
+	}
+	return nil, fmt.Errorf("unsupported input type %T", doc)
+}
+
+// ToJSON converts v into a document that encodes to JSON like OPA: sets become sorted arrays
+// and object keys that are not strings are written in Rego syntax.
+func ToJSON(v Value) interface{} {
+	switch v := v.(type) {
+	case *big.Rat:
+		return json.Number(formatNumber(v))
+	case Array:
+		doc := make([]interface{}, len(v))
+		for i, e := range v {
+			doc[i] = ToJSON(e)
+		}
+		return doc
+	case Object:
+		doc := make(map[string]interface{}, len(v))
+		for _, item := range v {
+			key, ok := item.Key.(string)
+			if !ok {
+				key = String(item.Key)
+			}
+			doc[key] = ToJSON(item.Value)
+		}
+		return doc
+	case Set:
+		elems := v.Elements()
+		doc := make([]interface{}, len(elems))
+		for i, e := range elems {
+			doc[i] = ToJSON(e)
+		}
+		return doc
+	}
+	return v
+}
+
+// truthy reports whether an expression with value v succeeds: any value but false does
+func truthy(v Value) bool {
+	b, ok := v.(bool)
+	return !ok || b
+}
+
+func number(i int64) *big.Rat {
+	return new(big.Rat).SetInt64(i)
+}
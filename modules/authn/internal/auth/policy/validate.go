@@ -0,0 +1,171 @@
+package policy
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"shield/modules/authn/internal/auth/policy/rego"
+	"shield/modules/authn/internal/models"
+)
+
+// ErrInvalidPolicy is returned for policies that do not parse or compile
+var ErrInvalidPolicy = errors.New("invalid policy")
+
+// Fixture is a policy input with the decision the policy is expected to make for it
+type Fixture struct {
+	Name    string
+	Input   Input
+	Allow   bool
+	Reasons []string // Compared only when not nil
+}
+
+// FixtureResult is the outcome of evaluating a fixture. Policies cannot call built-ins that
+// reach the network or the runtime, nor read documents of other organizations, so the decision
+// only derives from the fixture's input and the application's policies.
+type FixtureResult struct {
+	Name     string
+	Passed   bool
+	Decision *Decision // Nil when the evaluation failed
+	Error    string
+}
+
+// Validator checks policies before they are saved or activated
+type Validator interface {
+	// Validate compiles the policies together with the query of the package at path, failing
+	// with ErrInvalidPolicy, and evaluates the fixtures with them
+	Validate(ctx context.Context, path string, policies []models.OPAPolicy, fixtures []Fixture) ([]FixtureResult, error)
+}
+
+// RegoValidator validates policies by compiling them with the rego package
+type RegoValidator struct {
+	prepare preparer
+}
+
+// NewRegoValidator creates a validator
+func NewRegoValidator() *RegoValidator {
+	return &RegoValidator{prepare: prepareRego}
+}
+
+// Validate compiles the policies and evaluates the fixtures with them
+func (v *RegoValidator) Validate(ctx context.Context, path string, policies []models.OPAPolicy, fixtures []Fixture) ([]FixtureResult, error) {
+	modules := make(map[string]string, len(policies))
+	for _, p := range policies {
+		modules[moduleName(p)] = p.RegoPolicy
+	}
+	prepared, err := v.prepare(ctx, path, modules)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPolicy, err)
+	}
+	return evaluateFixtures(ctx, prepared.Eval, fixtures), nil
+}
+
+// Validate checks the policies in-process for restricted built-ins and documents of other
+// applications, then loads them into the OPA server under a package of their own and
+// evaluates the fixtures with the server. The modules are removed again afterwards.
+func (c *OPAClient) Validate(ctx context.Context, path string, policies []models.OPAPolicy, fixtures []Fixture) ([]FixtureResult, error) {
+	segments := packagePath(path)
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("invalid policy path %q", path)
+	}
+	modules := make(map[string]string, len(policies))
+	for _, p := range policies {
+		modules[moduleName(p)] = p.RegoPolicy
+	}
+	// Built-ins are the server's to check, as its version may provide more than the rego package
+	if _, err := rego.Compile(modules, rego.WithPackage(segments...), rego.WithExternalFunctions()); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPolicy, err)
+	}
+
+	run := make([]byte, 8)
+	if _, err := rand.Read(run); err != nil {
+		return nil, fmt.Errorf("failed to name policy validation: %w", err)
+	}
+	scratch := validationPackage + ".run_" + hex.EncodeToString(run)
+	renamed := make(map[string]string, len(policies))
+	for _, p := range policies {
+		renamed[moduleName(p)] = RenamePackage(p.RegoPolicy, path, scratch)
+	}
+	// Modules that still declare or read the application's package would change its decisions
+	if _, err := rego.Compile(renamed, rego.WithPackage(packagePath(scratch)...), rego.WithExternalFunctions()); err != nil {
+		return nil, fmt.Errorf("%w: the package of the policies must be declared as %s: %v", ErrInvalidPolicy, path, err)
+	}
+
+	var loaded []string
+	defer func() {
+		// Removed even when ctx is done, so no validation is left loaded
+		cleanup := context.WithoutCancel(ctx)
+		for _, id := range loaded {
+			if err := c.policyRequest(cleanup, http.MethodDelete, id, ""); err != nil {
+				log.Printf("Failed to remove validated policy %s: %v", id, err)
+			}
+		}
+	}()
+	for _, p := range policies {
+		id := strings.ReplaceAll(scratch, ".", "/") + "/" + moduleName(p)
+		if err := c.policyRequest(ctx, http.MethodPut, id, renamed[moduleName(p)]); err != nil {
+			var respErr *opaResponseError
+			if errors.As(err, &respErr) && respErr.status == http.StatusBadRequest {
+				return nil, fmt.Errorf("%w: %s: %v", ErrInvalidPolicy, p.Name, err)
+			}
+			return nil, fmt.Errorf("failed to load policy %s: %w", p.Name, err)
+		}
+		loaded = append(loaded, id)
+	}
+
+	evaluate := func(ctx context.Context, input Input) (*Decision, error) {
+		return c.Evaluate(ctx, Query{Path: scratch, Input: input})
+	}
+	return evaluateFixtures(ctx, evaluate, fixtures), nil
+}
+
+// validationPackage holds the packages policies are validated in on an OPA server; applications'
+// packages are in org_ namespaces, see auth.PolicyPackage
+const validationPackage = "shield_validation"
+
+// evaluateFixtures evaluates the fixtures with evaluate and compares the decisions
+func evaluateFixtures(ctx context.Context, evaluate func(context.Context, Input) (*Decision, error), fixtures []Fixture) []FixtureResult {
+	results := make([]FixtureResult, 0, len(fixtures))
+	for _, fixture := range fixtures {
+		result := FixtureResult{Name: fixture.Name}
+		decision, err := evaluate(ctx, fixture.Input)
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Decision = decision
+			result.Passed = decision.Allow == fixture.Allow &&
+				(fixture.Reasons == nil || slices.Equal(decision.Reasons, fixture.Reasons))
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// moduleName names a policy's module after its application and name
+func moduleName(p models.OPAPolicy) string {
+	return fmt.Sprintf("%s/%s.rego", p.AppID, p.Name)
+}
+
+// RenamePackage replaces the package declaration of a policy, and its references to the
+// documents of the package
+func RenamePackage(source, from, to string) string {
+	if from == "" {
+		return source
+	}
+	declaration := regexp.MustCompile(`(?m)^(\s*package\s+)` + regexp.QuoteMeta(from) + `(\s*(?:#.*)?)$`)
+	source = declaration.ReplaceAllString(source, "${1}"+to+"${2}")
+	reference := regexp.MustCompile(`\bdata\.` + regexp.QuoteMeta(from) + `\b`)
+	return reference.ReplaceAllLiteralString(source, "data."+to)
+}
+
+var (
+	_ Validator = (*RegoValidator)(nil)
+	_ Validator = (*OPAClient)(nil)
+)
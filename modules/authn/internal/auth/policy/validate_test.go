@@ -0,0 +1,101 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"shield/modules/authn/internal/models"
+)
+
+func TestRegoValidator(t *testing.T) {
+	ctx := context.Background()
+	validator := &RegoValidator{prepare: (&countingPreparer{}).prepare}
+	allowing := []models.OPAPolicy{{AppID: demoAppID, Name: "main", RegoPolicy: "allow", Version: 1}}
+	input := demoPolicyFixtures[0].query().Input
+
+	results, err := validator.Validate(ctx, "demo.authz", allowing, []Fixture{
+		{Name: "allowed", Input: input, Allow: true},
+		{Name: "expected denial", Input: input, Allow: false},
+		{Name: "unexpected reasons", Input: input, Allow: true, Reasons: []string{"admin role required"}},
+	})
+	if err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	want := []bool{true, false, false}
+	for i, result := range results {
+		if result.Passed != want[i] || result.Decision == nil {
+			t.Errorf("Validate() fixture %q = %+v, want passed %v", result.Name, result, want[i])
+		}
+	}
+
+	broken := []models.OPAPolicy{{AppID: demoAppID, Name: "main", RegoPolicy: "syntax error", Version: 2}}
+	if _, err := validator.Validate(ctx, "demo.authz", broken, nil); !errors.Is(err, ErrInvalidPolicy) {
+		t.Errorf("Validate() of a broken policy error = %v, want ErrInvalidPolicy", err)
+	}
+}
+
+func TestRegoValidatorRestrictsPolicies(t *testing.T) {
+	ctx := context.Background()
+	for name, source := range map[string]string{
+		"http.send":       "package org_a.authz\nallow if http.send({\"method\": \"get\", \"url\": \"http://169.254.169.254/\"}).status_code == 200",
+		"opa.runtime":     "package org_a.authz\nreasons contains opa.runtime().env.DB_PASSWORD",
+		"other package":   "package org_b.authz\nallow := true",
+		"sibling package": "package org_a.other\nallow := true",
+		"subpackage":      "package org_a.authz.helpers\nallow := true",
+		"other data":      "package org_a.authz\nreasons contains x if x := data.org_b.authz.secrets[_]",
+	} {
+		policies := []models.OPAPolicy{{AppID: demoAppID, Name: "main", RegoPolicy: source, Version: 1}}
+		if _, err := NewRegoValidator().Validate(ctx, "org_a.authz", policies, nil); !errors.Is(err, ErrInvalidPolicy) {
+			t.Errorf("Validate() of a policy using %s error = %v, want ErrInvalidPolicy", name, err)
+		}
+	}
+}
+
+func TestOPAClientValidate(t *testing.T) {
+	ctx := context.Background()
+	opa := &policyServer{modules: map[string]string{
+		demoAppID.String() + "/main.rego": "package " + demoPackage + "\nallow := false\n",
+	}}
+	server := httptest.NewServer(opa)
+	t.Cleanup(server.Close)
+	client := NewOPAClient(server.URL, "", nil)
+	input := demoPolicyFixtures[0].query().Input
+
+	allowing := []models.OPAPolicy{{AppID: demoAppID, Name: "main", RegoPolicy: "package " + demoPackage + " # demo\nallow := true\nok if data." + demoPackage + ".allow\n", Version: 2}}
+	results, err := client.Validate(ctx, demoPackage, allowing, []Fixture{
+		{Name: "allowed", Input: input, Allow: true},
+		{Name: "expected denial", Input: input, Allow: false},
+	})
+	if err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if len(results) != 2 || !results[0].Passed || results[1].Passed {
+		t.Errorf("Validate() = %+v, want the first fixture passed", results)
+	}
+	// The active policy is left alone and the validated one is removed
+	if got := opa.ids(); !reflect.DeepEqual(got, []string{demoAppID.String() + "/main.rego"}) {
+		t.Errorf("Validate() left modules %v, want only the active policy", got)
+	}
+
+	for name, source := range map[string]string{
+		"rejected by OPA": "package " + demoPackage + "\nsyntax error",
+		"http.send":       "package " + demoPackage + "\nallow if http.send({\"url\": input.url})",
+		"other package":   "package demo.authz\nallow := true",
+	} {
+		policies := []models.OPAPolicy{{AppID: demoAppID, Name: "main", RegoPolicy: source, Version: 3}}
+		if _, err := client.Validate(ctx, demoPackage, policies, nil); !errors.Is(err, ErrInvalidPolicy) {
+			t.Errorf("Validate() of a policy %s error = %v, want ErrInvalidPolicy", name, err)
+		}
+	}
+	if got := opa.ids(); len(got) != 1 {
+		t.Errorf("Validate() of invalid policies left modules %v", got)
+	}
+
+	server.Close()
+	if _, err := client.Validate(ctx, demoPackage, allowing, nil); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Validate() without a server error = %v, want ErrUnavailable", err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
 
@@ -20,7 +21,7 @@ import (
 
 // Provider implements authentication logic using AWS Cognito.
 type Provider struct {
-	client *cognitoidentityprovider.Client
+	client Client
 	config appConfig.CognitoConfig
 }
 
@@ -32,12 +33,15 @@ func NewProvider(cfg appConfig.CognitoConfig) (*Provider, error) {
 		return nil, err
 	}
 
-	client := cognitoidentityprovider.NewFromConfig(sdkConfig)
+	return NewProviderWithClient(cognitoidentityprovider.NewFromConfig(sdkConfig), cfg), nil
+}
 
+// NewProviderWithClient creates a Cognito authentication provider that uses the given client.
+func NewProviderWithClient(client Client, cfg appConfig.CognitoConfig) *Provider {
 	return &Provider{
 		client: client,
 		config: cfg,
-	}, nil
+	}
 }
 
 // --- AWS Cognito API Reference: https://docs.aws.amazon.com/cognito-user-identity-pools/latest/APIReference/API_Operations.html ---
@@ -49,12 +53,8 @@ func (p *Provider) SignUp(ctx context.Context, req authprovider.SignUpRequestDat
 		ClientId:       aws.String(p.config.AppClientID),
 		Username:       aws.String(req.Username),
 		Password:       aws.String(req.Password),
-		UserAttributes: req.UserAttributes,
-	}
-
-	if p.config.AppClientSecret != "" {
-		// TODO: Calculate SecretHash if client secret is used
-		log.Println("Warning: AppClientSecret is configured but SecretHash computation is not yet implemented for SignUp.")
+		UserAttributes: attributeTypes(req.UserAttributes),
+		SecretHash:     p.secretHash(req.Username),
 	}
 
 	result, err := p.client.SignUp(ctx, input)
@@ -63,18 +63,11 @@ func (p *Provider) SignUp(ctx context.Context, req authprovider.SignUpRequestDat
 		return nil, err
 	}
 
-	output := &authprovider.SignUpOutputData{
-		UserSub:       aws.ToString(result.UserSub),
-		UserConfirmed: result.UserConfirmed,
-	}
-	if result.CodeDeliveryDetails != nil {
-		output.CodeDeliveryDetails = &authprovider.CodeDeliveryDetailsData{
-			AttributeName:  aws.ToString(result.CodeDeliveryDetails.AttributeName),
-			DeliveryMedium: string(result.CodeDeliveryDetails.DeliveryMedium),
-			Destination:    aws.ToString(result.CodeDeliveryDetails.Destination),
-		}
-	}
-	return output, nil
+	return &authprovider.SignUpOutputData{
+		UserSub:             aws.ToString(result.UserSub),
+		UserConfirmed:       result.UserConfirmed,
+		CodeDeliveryDetails: codeDeliveryDetails(result.CodeDeliveryDetails),
+	}, nil
 }
 
 // ConfirmSignUp confirms a user's registration using a confirmation code.
@@ -84,28 +77,44 @@ func (p *Provider) ConfirmSignUp(ctx context.Context, req authprovider.ConfirmSi
 		ClientId:         aws.String(p.config.AppClientID),
 		Username:         aws.String(req.Username),
 		ConfirmationCode: aws.String(req.ConfirmationCode),
-	}
-
-	if p.config.AppClientSecret != "" {
-		// TODO: Calculate SecretHash
-		log.Println("Warning: AppClientSecret is configured but SecretHash computation is not yet implemented for ConfirmSignUp.")
+		SecretHash:       p.secretHash(req.Username),
 	}
 
 	_, err := p.client.ConfirmSignUp(ctx, input)
 	if err != nil {
 		log.Printf("Cognito ConfirmSignUp error: %v", err)
-		return nil, err
+		return nil, mapError(err)
 	}
 	return &authprovider.ConfirmSignUpOutputData{}, nil
 }
 
+// ResendConfirmationCode sends a new signup confirmation code to the user.
+// Docs: https://docs.aws.amazon.com/cognito-user-identity-pools/latest/APIReference/API_ResendConfirmationCode.html
+func (p *Provider) ResendConfirmationCode(ctx context.Context, req authprovider.ResendConfirmationCodeRequestData) (*authprovider.ResendConfirmationCodeOutputData, error) {
+	input := &cognitoidentityprovider.ResendConfirmationCodeInput{
+		ClientId:   aws.String(p.config.AppClientID),
+		Username:   aws.String(req.Username),
+		SecretHash: p.secretHash(req.Username),
+	}
+
+	result, err := p.client.ResendConfirmationCode(ctx, input)
+	if err != nil {
+		log.Printf("Cognito ResendConfirmationCode error: %v", err)
+		return nil, mapError(err)
+	}
+
+	return &authprovider.ResendConfirmationCodeOutputData{
+		CodeDeliveryDetails: codeDeliveryDetails(result.CodeDeliveryDetails),
+	}, nil
+}
+
 // AdminCreateUser creates a user as an administrator.
 // Docs: https://docs.aws.amazon.com/cognito-user-identity-pools/latest/APIReference/API_AdminCreateUser.html
 func (p *Provider) AdminCreateUser(ctx context.Context, req authprovider.AdminCreateUserRequestData) (*authprovider.AdminCreateUserOutputData, error) {
 	input := &cognitoidentityprovider.AdminCreateUserInput{
 		UserPoolId:        aws.String(p.config.UserPoolID),
 		Username:          aws.String(req.Username),
-		UserAttributes:    req.UserAttributes,
+		UserAttributes:    attributeTypes(req.UserAttributes),
 		TemporaryPassword: aws.String(req.TemporaryPassword),
 		MessageAction:     types.MessageActionTypeSuppress,
 	}
@@ -124,8 +133,11 @@ func (p *Provider) AdminCreateUser(ctx context.Context, req authprovider.AdminCr
 			CognitoSub: aws.ToString(result.User.Username),
 		}
 		for _, attr := range result.User.Attributes {
-			if aws.ToString(attr.Name) == "email" {
+			switch aws.ToString(attr.Name) {
+			case "email":
 				userModel.Email = aws.ToString(attr.Value)
+			case "sub":
+				userModel.CognitoSub = aws.ToString(attr.Value) // Tokens carry the sub, not the username
 			}
 		}
 	}
@@ -135,6 +147,21 @@ func (p *Provider) AdminCreateUser(ctx context.Context, req authprovider.AdminCr
 	}, nil
 }
 
+// AdminDeleteUser deletes a user as an administrator.
+// Docs: https://docs.aws.amazon.com/cognito-user-identity-pools/latest/APIReference/API_AdminDeleteUser.html
+func (p *Provider) AdminDeleteUser(ctx context.Context, username string) error {
+	input := &cognitoidentityprovider.AdminDeleteUserInput{
+		UserPoolId: aws.String(p.config.UserPoolID),
+		Username:   aws.String(username),
+	}
+
+	if _, err := p.client.AdminDeleteUser(ctx, input); err != nil {
+		log.Printf("Cognito AdminDeleteUser error: %v", err)
+		return mapError(err)
+	}
+	return nil
+}
+
 // CreateIdentityProvider creates an identity provider in Cognito.
 // Docs: https://docs.aws.amazon.com/cognito-user-identity-pools/latest/APIReference/API_CreateIdentityProvider.html
 func (p *Provider) CreateIdentityProvider(ctx context.Context, req authprovider.CreateIdentityProviderRequestData) (*authprovider.CreateIdentityProviderOutputData, error) {
@@ -150,14 +177,70 @@ func (p *Provider) CreateIdentityProvider(ctx context.Context, req authprovider.
 	result, err := p.client.CreateIdentityProvider(ctx, input)
 	if err != nil {
 		log.Printf("Cognito CreateIdentityProvider error: %v", err)
-		return nil, err
+		return nil, mapError(err)
 	}
 
 	return &authprovider.CreateIdentityProviderOutputData{
-		IdentityProvider: result.IdentityProvider,
+		IdentityProvider: identityProvider(result.IdentityProvider),
 	}, nil
 }
 
+// UpdateIdentityProvider updates an identity provider in Cognito.
+// Docs: https://docs.aws.amazon.com/cognito-user-identity-pools/latest/APIReference/API_UpdateIdentityProvider.html
+func (p *Provider) UpdateIdentityProvider(ctx context.Context, req authprovider.UpdateIdentityProviderRequestData) (*authprovider.UpdateIdentityProviderOutputData, error) {
+	input := &cognitoidentityprovider.UpdateIdentityProviderInput{
+		ProviderName:     aws.String(req.ProviderName),
+		UserPoolId:       aws.String(p.config.UserPoolID),
+		ProviderDetails:  req.ProviderDetails,
+		AttributeMapping: req.AttributeMapping,
+		IdpIdentifiers:   req.IdpIdentifiers,
+	}
+
+	result, err := p.client.UpdateIdentityProvider(ctx, input)
+	if err != nil {
+		log.Printf("Cognito UpdateIdentityProvider error: %v", err)
+		return nil, mapError(err)
+	}
+
+	return &authprovider.UpdateIdentityProviderOutputData{
+		IdentityProvider: identityProvider(result.IdentityProvider),
+	}, nil
+}
+
+// DescribeIdentityProvider retrieves an identity provider from Cognito.
+// Docs: https://docs.aws.amazon.com/cognito-user-identity-pools/latest/APIReference/API_DescribeIdentityProvider.html
+func (p *Provider) DescribeIdentityProvider(ctx context.Context, providerName string) (*authprovider.DescribeIdentityProviderOutputData, error) {
+	input := &cognitoidentityprovider.DescribeIdentityProviderInput{
+		ProviderName: aws.String(providerName),
+		UserPoolId:   aws.String(p.config.UserPoolID),
+	}
+
+	result, err := p.client.DescribeIdentityProvider(ctx, input)
+	if err != nil {
+		log.Printf("Cognito DescribeIdentityProvider error: %v", err)
+		return nil, mapError(err)
+	}
+
+	return &authprovider.DescribeIdentityProviderOutputData{
+		IdentityProvider: identityProvider(result.IdentityProvider),
+	}, nil
+}
+
+// DeleteIdentityProvider deletes an identity provider from Cognito.
+// Docs: https://docs.aws.amazon.com/cognito-user-identity-pools/latest/APIReference/API_DeleteIdentityProvider.html
+func (p *Provider) DeleteIdentityProvider(ctx context.Context, providerName string) error {
+	input := &cognitoidentityprovider.DeleteIdentityProviderInput{
+		ProviderName: aws.String(providerName),
+		UserPoolId:   aws.String(p.config.UserPoolID),
+	}
+
+	if _, err := p.client.DeleteIdentityProvider(ctx, input); err != nil {
+		log.Printf("Cognito DeleteIdentityProvider error: %v", err)
+		return mapError(err)
+	}
+	return nil
+}
+
 // GetUser retrieves user information based on an access token.
 // Docs: https://docs.aws.amazon.com/cognito-user-identity-pools/latest/APIReference/API_GetUser.html
 func (p *Provider) GetUser(ctx context.Context, accessToken string) (*authprovider.GetUserOutputData, error) {
@@ -172,13 +255,16 @@ func (p *Provider) GetUser(ctx context.Context, accessToken string) (*authprovid
 		CognitoSub: aws.ToString(result.Username),
 	}
 	for _, attr := range result.UserAttributes {
-		if aws.ToString(attr.Name) == "email" {
+		switch aws.ToString(attr.Name) {
+		case "email":
 			userModel.Email = aws.ToString(attr.Value)
+		case "sub":
+			userModel.CognitoSub = aws.ToString(attr.Value) // Username may be an alias such as the email
 		}
 	}
 
 	log.Println("GetUser partially implemented for Cognito provider. Mapping to models.User needs review.")
-	return &authprovider.GetUserOutputData{User: userModel}, nil
+	return &authprovider.GetUserOutputData{User: userModel, Username: aws.ToString(result.Username)}, nil
 }
 
 // Authenticate authenticates a user with username and password
@@ -193,10 +279,8 @@ func (p *Provider) Authenticate(ctx context.Context, req authprovider.Authentica
 		},
 	}
 
-	// Add client secret if configured
-	if p.config.AppClientSecret != "" {
-		secretHash := computeSecretHash(req.Username, p.config.AppClientID, p.config.AppClientSecret)
-		input.AuthParameters["SECRET_HASH"] = secretHash
+	if secretHash := p.secretHash(req.Username); secretHash != nil {
+		input.AuthParameters["SECRET_HASH"] = *secretHash
 	}
 
 	result, err := p.client.InitiateAuth(ctx, input)
@@ -204,28 +288,66 @@ func (p *Provider) Authenticate(ctx context.Context, req authprovider.Authentica
 		return nil, err
 	}
 
-	// Handle potential challenges (MFA, etc.)
-	if result.ChallengeName != "" {
-		// For now, return an error if there are challenges
-		// In a full implementation, you'd handle these challenges
-		return nil, fmt.Errorf("authentication challenge required: %s", result.ChallengeName)
+	return p.authenticationOutput(ctx, result.ChallengeName, result.Session, result.ChallengeParameters, result.AuthenticationResult)
+}
+
+// RespondToAuthChallenge answers a challenge returned by InitiateAuth (MFA, NEW_PASSWORD_REQUIRED, custom auth).
+// Cognito may answer with a further challenge, in which case the output carries it instead of tokens.
+// Docs: https://docs.aws.amazon.com/cognito-user-identity-pools/latest/APIReference/API_RespondToAuthChallenge.html
+func (p *Provider) RespondToAuthChallenge(ctx context.Context, req authprovider.RespondToAuthChallengeRequestData) (*authprovider.AuthenticateOutputData, error) {
+	responses := make(map[string]string, len(req.Responses)+2)
+	for k, v := range req.Responses {
+		responses[k] = v
 	}
+	responses["USERNAME"] = req.Username
 
-	if result.AuthenticationResult == nil {
+	if secretHash := p.secretHash(req.Username); secretHash != nil {
+		responses["SECRET_HASH"] = *secretHash
+	}
+
+	input := &cognitoidentityprovider.RespondToAuthChallengeInput{
+		ClientId:           aws.String(p.config.AppClientID),
+		ChallengeName:      types.ChallengeNameType(req.ChallengeName),
+		Session:            aws.String(req.Session),
+		ChallengeResponses: responses,
+	}
+
+	result, err := p.client.RespondToAuthChallenge(ctx, input)
+	if err != nil {
+		log.Printf("Cognito RespondToAuthChallenge error: %v", err)
+		return nil, err
+	}
+
+	return p.authenticationOutput(ctx, result.ChallengeName, result.Session, result.ChallengeParameters, result.AuthenticationResult)
+}
+
+// authenticationOutput maps the common part of InitiateAuth and RespondToAuthChallenge results.
+func (p *Provider) authenticationOutput(ctx context.Context, challengeName types.ChallengeNameType, session *string, challengeParams map[string]string, authResult *types.AuthenticationResultType) (*authprovider.AuthenticateOutputData, error) {
+	// Authentication requires a further step; hand the challenge back to the caller
+	if challengeName != "" {
+		return &authprovider.AuthenticateOutputData{
+			ChallengeName:       string(challengeName),
+			Session:             aws.ToString(session),
+			ChallengeParameters: challengeParams,
+		}, nil
+	}
+
+	if authResult == nil {
 		return nil, fmt.Errorf("authentication failed: no result")
 	}
 
 	// Get user info to extract user sub
-	userResult, err := p.GetUser(ctx, *result.AuthenticationResult.AccessToken)
+	userResult, err := p.GetUser(ctx, aws.ToString(authResult.AccessToken))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user info: %w", err)
 	}
 
 	return &authprovider.AuthenticateOutputData{
-		AccessToken:  *result.AuthenticationResult.AccessToken,
-		RefreshToken: *result.AuthenticationResult.RefreshToken,
-		ExpiresIn:    int64(result.AuthenticationResult.ExpiresIn),
+		AccessToken:  aws.ToString(authResult.AccessToken),
+		RefreshToken: aws.ToString(authResult.RefreshToken),
+		ExpiresIn:    int64(authResult.ExpiresIn),
 		UserSub:      userResult.User.CognitoSub,
+		Username:     userResult.Username,
 	}, nil
 }
 
@@ -240,16 +362,18 @@ func (p *Provider) RefreshToken(ctx context.Context, req authprovider.RefreshTok
 		},
 	}
 
-	// Add client secret if configured
+	// The secret hash is keyed by the user's Cognito username, which is not part of the refresh token
 	if p.config.AppClientSecret != "" {
-		// For refresh token flow, we don't have the username, so we can't compute SECRET_HASH
-		// This is a limitation when using client secret with refresh tokens
-		// Consider using a different approach or storing username with refresh token
+		if req.Username == "" {
+			return nil, errors.New("token refresh failed: the app client has a secret, so the username is required")
+		}
+		input.AuthParameters["SECRET_HASH"] = *p.secretHash(req.Username)
 	}
 
 	result, err := p.client.InitiateAuth(ctx, input)
 	if err != nil {
-		return nil, err
+		log.Printf("Cognito InitiateAuth (refresh) error: %v", err)
+		return nil, mapError(err)
 	}
 
 	if result.AuthenticationResult == nil {
@@ -257,11 +381,258 @@ func (p *Provider) RefreshToken(ctx context.Context, req authprovider.RefreshTok
 	}
 
 	return &authprovider.RefreshTokenOutputData{
-		AccessToken: *result.AuthenticationResult.AccessToken,
+		AccessToken: aws.ToString(result.AuthenticationResult.AccessToken),
 		ExpiresIn:   int64(result.AuthenticationResult.ExpiresIn),
 	}, nil
 }
 
+// RevokeToken revokes a refresh token and the access tokens issued from it.
+// Docs: https://docs.aws.amazon.com/cognito-user-identity-pools/latest/APIReference/API_RevokeToken.html
+func (p *Provider) RevokeToken(ctx context.Context, refreshToken string) error {
+	input := &cognitoidentityprovider.RevokeTokenInput{
+		ClientId: aws.String(p.config.AppClientID),
+		Token:    aws.String(refreshToken),
+	}
+	if p.config.AppClientSecret != "" {
+		input.ClientSecret = aws.String(p.config.AppClientSecret)
+	}
+
+	if _, err := p.client.RevokeToken(ctx, input); err != nil {
+		log.Printf("Cognito RevokeToken error: %v", err)
+		return err
+	}
+	return nil
+}
+
+// GlobalSignOut invalidates all refresh tokens issued to a user.
+// Docs: https://docs.aws.amazon.com/cognito-user-identity-pools/latest/APIReference/API_AdminUserGlobalSignOut.html
+func (p *Provider) GlobalSignOut(ctx context.Context, username string) error {
+	input := &cognitoidentityprovider.AdminUserGlobalSignOutInput{
+		UserPoolId: aws.String(p.config.UserPoolID),
+		Username:   aws.String(username),
+	}
+
+	if _, err := p.client.AdminUserGlobalSignOut(ctx, input); err != nil {
+		log.Printf("Cognito AdminUserGlobalSignOut error: %v", err)
+		return err
+	}
+	return nil
+}
+
+// ForgotPassword sends a password reset code to the user.
+// Docs: https://docs.aws.amazon.com/cognito-user-identity-pools/latest/APIReference/API_ForgotPassword.html
+func (p *Provider) ForgotPassword(ctx context.Context, req authprovider.ForgotPasswordRequestData) (*authprovider.ForgotPasswordOutputData, error) {
+	input := &cognitoidentityprovider.ForgotPasswordInput{
+		ClientId:   aws.String(p.config.AppClientID),
+		Username:   aws.String(req.Username),
+		SecretHash: p.secretHash(req.Username),
+	}
+
+	result, err := p.client.ForgotPassword(ctx, input)
+	if err != nil {
+		log.Printf("Cognito ForgotPassword error: %v", err)
+		return nil, mapError(err)
+	}
+
+	return &authprovider.ForgotPasswordOutputData{
+		CodeDeliveryDetails: codeDeliveryDetails(result.CodeDeliveryDetails),
+	}, nil
+}
+
+// ConfirmForgotPassword sets a new password using the reset code sent by ForgotPassword.
+// Docs: https://docs.aws.amazon.com/cognito-user-identity-pools/latest/APIReference/API_ConfirmForgotPassword.html
+func (p *Provider) ConfirmForgotPassword(ctx context.Context, req authprovider.ConfirmForgotPasswordRequestData) error {
+	input := &cognitoidentityprovider.ConfirmForgotPasswordInput{
+		ClientId:         aws.String(p.config.AppClientID),
+		Username:         aws.String(req.Username),
+		ConfirmationCode: aws.String(req.ConfirmationCode),
+		Password:         aws.String(req.NewPassword),
+		SecretHash:       p.secretHash(req.Username),
+	}
+
+	if _, err := p.client.ConfirmForgotPassword(ctx, input); err != nil {
+		log.Printf("Cognito ConfirmForgotPassword error: %v", err)
+		return mapError(err)
+	}
+	return nil
+}
+
+// ChangePassword changes the password of the user the access token was issued to.
+// Docs: https://docs.aws.amazon.com/cognito-user-identity-pools/latest/APIReference/API_ChangePassword.html
+func (p *Provider) ChangePassword(ctx context.Context, req authprovider.ChangePasswordRequestData) error {
+	input := &cognitoidentityprovider.ChangePasswordInput{
+		AccessToken:      aws.String(req.AccessToken),
+		PreviousPassword: aws.String(req.PreviousPassword),
+		ProposedPassword: aws.String(req.ProposedPassword),
+	}
+
+	if _, err := p.client.ChangePassword(ctx, input); err != nil {
+		log.Printf("Cognito ChangePassword error: %v", err)
+		return mapError(err)
+	}
+	return nil
+}
+
+// AssociateSoftwareToken starts TOTP enrollment and returns the shared secret.
+// Docs: https://docs.aws.amazon.com/cognito-user-identity-pools/latest/APIReference/API_AssociateSoftwareToken.html
+func (p *Provider) AssociateSoftwareToken(ctx context.Context, req authprovider.AssociateSoftwareTokenRequestData) (*authprovider.AssociateSoftwareTokenOutputData, error) {
+	input := &cognitoidentityprovider.AssociateSoftwareTokenInput{}
+	if req.AccessToken != "" {
+		input.AccessToken = aws.String(req.AccessToken)
+	}
+	if req.Session != "" {
+		input.Session = aws.String(req.Session)
+	}
+
+	result, err := p.client.AssociateSoftwareToken(ctx, input)
+	if err != nil {
+		log.Printf("Cognito AssociateSoftwareToken error: %v", err)
+		return nil, mapError(err)
+	}
+
+	return &authprovider.AssociateSoftwareTokenOutputData{
+		SecretCode: aws.ToString(result.SecretCode),
+		Session:    aws.ToString(result.Session),
+	}, nil
+}
+
+// VerifySoftwareToken verifies a TOTP code generated from the associated secret.
+// Docs: https://docs.aws.amazon.com/cognito-user-identity-pools/latest/APIReference/API_VerifySoftwareToken.html
+func (p *Provider) VerifySoftwareToken(ctx context.Context, req authprovider.VerifySoftwareTokenRequestData) (*authprovider.VerifySoftwareTokenOutputData, error) {
+	input := &cognitoidentityprovider.VerifySoftwareTokenInput{
+		UserCode: aws.String(req.UserCode),
+	}
+	if req.AccessToken != "" {
+		input.AccessToken = aws.String(req.AccessToken)
+	}
+	if req.Session != "" {
+		input.Session = aws.String(req.Session)
+	}
+	if req.FriendlyDeviceName != "" {
+		input.FriendlyDeviceName = aws.String(req.FriendlyDeviceName)
+	}
+
+	result, err := p.client.VerifySoftwareToken(ctx, input)
+	if err != nil {
+		log.Printf("Cognito VerifySoftwareToken error: %v", err)
+		return nil, mapError(err)
+	}
+
+	return &authprovider.VerifySoftwareTokenOutputData{
+		Status:  string(result.Status),
+		Session: aws.ToString(result.Session),
+	}, nil
+}
+
+// SetMFAPreference enables or disables MFA methods for a user as an administrator.
+// Docs: https://docs.aws.amazon.com/cognito-user-identity-pools/latest/APIReference/API_AdminSetUserMFAPreference.html
+func (p *Provider) SetMFAPreference(ctx context.Context, req authprovider.SetMFAPreferenceRequestData) error {
+	input := &cognitoidentityprovider.AdminSetUserMFAPreferenceInput{
+		UserPoolId: aws.String(p.config.UserPoolID),
+		Username:   aws.String(req.Username),
+	}
+	if req.TOTP != nil {
+		input.SoftwareTokenMfaSettings = &types.SoftwareTokenMfaSettingsType{
+			Enabled:      req.TOTP.Enabled,
+			PreferredMfa: req.TOTP.Preferred,
+		}
+	}
+	if req.SMS != nil {
+		input.SMSMfaSettings = &types.SMSMfaSettingsType{
+			Enabled:      req.SMS.Enabled,
+			PreferredMfa: req.SMS.Preferred,
+		}
+	}
+
+	if _, err := p.client.AdminSetUserMFAPreference(ctx, input); err != nil {
+		log.Printf("Cognito AdminSetUserMFAPreference error: %v", err)
+		return err
+	}
+	return nil
+}
+
+// attributeTypes converts user attributes to Cognito's attribute type
+func attributeTypes(attrs []authprovider.UserAttribute) []types.AttributeType {
+	if attrs == nil {
+		return nil
+	}
+	converted := make([]types.AttributeType, len(attrs))
+	for i, attr := range attrs {
+		converted[i] = types.AttributeType{Name: aws.String(attr.Name), Value: aws.String(attr.Value)}
+	}
+	return converted
+}
+
+// identityProvider converts Cognito's description of a federated identity provider
+func identityProvider(idp *types.IdentityProviderType) *authprovider.IdentityProvider {
+	if idp == nil {
+		return nil
+	}
+	return &authprovider.IdentityProvider{
+		ProviderName:     aws.ToString(idp.ProviderName),
+		ProviderType:     string(idp.ProviderType),
+		ProviderDetails:  idp.ProviderDetails,
+		AttributeMapping: idp.AttributeMapping,
+		IdpIdentifiers:   idp.IdpIdentifiers,
+		CreatedAt:        aws.ToTime(idp.CreationDate),
+		UpdatedAt:        aws.ToTime(idp.LastModifiedDate),
+	}
+}
+
+// codeDeliveryDetails converts where Cognito sent a verification code
+func codeDeliveryDetails(details *types.CodeDeliveryDetailsType) *authprovider.CodeDeliveryDetailsData {
+	if details == nil {
+		return nil
+	}
+	return &authprovider.CodeDeliveryDetailsData{
+		AttributeName:  aws.ToString(details.AttributeName),
+		DeliveryMedium: string(details.DeliveryMedium),
+		Destination:    aws.ToString(details.Destination),
+	}
+}
+
+// mapError wraps Cognito exceptions that callers handle with the provider's error values
+func mapError(err error) error {
+	var (
+		codeMismatch    *types.CodeMismatchException
+		tokenMismatch   *types.EnableSoftwareTokenMFAException
+		expiredCode     *types.ExpiredCodeException
+		limitExceeded   *types.LimitExceededException
+		tooManyRequests *types.TooManyRequestsException
+		tooManyFailed   *types.TooManyFailedAttemptsException
+		userNotFound    *types.UserNotFoundException
+		invalidPassword *types.InvalidPasswordException
+		notAuthorized   *types.NotAuthorizedException
+		notFound        *types.ResourceNotFoundException
+	)
+	switch {
+	case errors.As(err, &codeMismatch), errors.As(err, &tokenMismatch):
+		return fmt.Errorf("%w: %v", authprovider.ErrCodeMismatch, err)
+	case errors.As(err, &expiredCode):
+		return fmt.Errorf("%w: %v", authprovider.ErrCodeExpired, err)
+	case errors.As(err, &limitExceeded), errors.As(err, &tooManyRequests), errors.As(err, &tooManyFailed):
+		return fmt.Errorf("%w: %v", authprovider.ErrLimitExceeded, err)
+	case errors.As(err, &userNotFound):
+		return fmt.Errorf("%w: %v", authprovider.ErrUserNotFound, err)
+	case errors.As(err, &invalidPassword):
+		return fmt.Errorf("%w: %v", authprovider.ErrInvalidPassword, err)
+	case errors.As(err, &notAuthorized):
+		return fmt.Errorf("%w: %v", authprovider.ErrNotAuthorized, err)
+	case errors.As(err, &notFound):
+		return fmt.Errorf("%w: %v", authprovider.ErrNotFound, err)
+	}
+	return err
+}
+
+// secretHash returns the SECRET_HASH for requests about username, or nil when the app client has no secret.
+// Docs: https://docs.aws.amazon.com/cognito/latest/developerguide/signing-up-users-in-your-app.html#cognito-user-pools-computing-secret-hash
+func (p *Provider) secretHash(username string) *string {
+	if p.config.AppClientSecret == "" {
+		return nil
+	}
+	return aws.String(computeSecretHash(username, p.config.AppClientID, p.config.AppClientSecret))
+}
+
 // computeSecretHash computes the secret hash for Cognito client authentication
 func computeSecretHash(username, clientID, clientSecret string) string {
 	message := username + clientID
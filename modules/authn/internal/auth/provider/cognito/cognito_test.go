@@ -0,0 +1,248 @@
+package cognito
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
+
+	appConfig "shield/cmd/app/config"
+	authprovider "shield/modules/authn/internal/auth/provider"
+)
+
+// stubClient records the secret hash sent with each Cognito request
+type stubClient struct {
+	Client      // Operations that are not stubbed panic
+	secretHash  map[string]*string
+	initiations int
+	challenge   types.ChallengeNameType // Returned by InitiateAuth when set
+	answer      *cognitoidentityprovider.RespondToAuthChallengeInput
+}
+
+func newStubClient() *stubClient {
+	return &stubClient{secretHash: make(map[string]*string)}
+}
+
+func (c *stubClient) SignUp(_ context.Context, in *cognitoidentityprovider.SignUpInput, _ ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.SignUpOutput, error) {
+	c.secretHash["SignUp"] = in.SecretHash
+	return &cognitoidentityprovider.SignUpOutput{UserSub: aws.String("sub-1")}, nil
+}
+
+func (c *stubClient) ConfirmSignUp(_ context.Context, in *cognitoidentityprovider.ConfirmSignUpInput, _ ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.ConfirmSignUpOutput, error) {
+	c.secretHash["ConfirmSignUp"] = in.SecretHash
+	return &cognitoidentityprovider.ConfirmSignUpOutput{}, nil
+}
+
+func (c *stubClient) ResendConfirmationCode(_ context.Context, in *cognitoidentityprovider.ResendConfirmationCodeInput, _ ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.ResendConfirmationCodeOutput, error) {
+	c.secretHash["ResendConfirmationCode"] = in.SecretHash
+	return &cognitoidentityprovider.ResendConfirmationCodeOutput{}, nil
+}
+
+func (c *stubClient) ForgotPassword(_ context.Context, in *cognitoidentityprovider.ForgotPasswordInput, _ ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.ForgotPasswordOutput, error) {
+	c.secretHash["ForgotPassword"] = in.SecretHash
+	return &cognitoidentityprovider.ForgotPasswordOutput{}, nil
+}
+
+func (c *stubClient) ConfirmForgotPassword(_ context.Context, in *cognitoidentityprovider.ConfirmForgotPasswordInput, _ ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.ConfirmForgotPasswordOutput, error) {
+	c.secretHash["ConfirmForgotPassword"] = in.SecretHash
+	return &cognitoidentityprovider.ConfirmForgotPasswordOutput{}, nil
+}
+
+func (c *stubClient) InitiateAuth(_ context.Context, in *cognitoidentityprovider.InitiateAuthInput, _ ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.InitiateAuthOutput, error) {
+	c.initiations++
+	c.secretHash["InitiateAuth:"+string(in.AuthFlow)] = mapValue(in.AuthParameters, "SECRET_HASH")
+	if c.challenge != "" {
+		return &cognitoidentityprovider.InitiateAuthOutput{
+			ChallengeName:       c.challenge,
+			Session:             aws.String("cognito-session"),
+			ChallengeParameters: map[string]string{"USER_ID_FOR_SRP": "4a1c6f0e-user"},
+		}, nil
+	}
+	return &cognitoidentityprovider.InitiateAuthOutput{
+		AuthenticationResult: &types.AuthenticationResultType{AccessToken: aws.String("access"), ExpiresIn: 3600},
+	}, nil
+}
+
+func (c *stubClient) RespondToAuthChallenge(_ context.Context, in *cognitoidentityprovider.RespondToAuthChallengeInput, _ ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.RespondToAuthChallengeOutput, error) {
+	c.secretHash["RespondToAuthChallenge"] = mapValue(in.ChallengeResponses, "SECRET_HASH")
+	c.answer = in
+	return &cognitoidentityprovider.RespondToAuthChallengeOutput{
+		AuthenticationResult: &types.AuthenticationResultType{AccessToken: aws.String("access"), ExpiresIn: 3600},
+	}, nil
+}
+
+func (c *stubClient) GetUser(context.Context, *cognitoidentityprovider.GetUserInput, ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.GetUserOutput, error) {
+	return &cognitoidentityprovider.GetUserOutput{
+		Username: aws.String("4a1c6f0e-user"),
+		UserAttributes: []types.AttributeType{
+			{Name: aws.String("sub"), Value: aws.String("sub-1")},
+			{Name: aws.String("email"), Value: aws.String("user@example.com")},
+		},
+	}, nil
+}
+
+func mapValue(m map[string]string, key string) *string {
+	if v, ok := m[key]; ok {
+		return aws.String(v)
+	}
+	return nil
+}
+
+// expectedSecretHash is Base64(HMAC-SHA256(secret, username + clientID))
+func expectedSecretHash(username, clientID, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(username + clientID))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// callAll makes every provider call that must carry a secret hash for username
+func callAll(t *testing.T, p *Provider, username string) {
+	t.Helper()
+	ctx := context.Background()
+	calls := map[string]error{}
+	_, calls["SignUp"] = p.SignUp(ctx, authprovider.SignUpRequestData{Username: username, Password: "password"})
+	_, calls["ConfirmSignUp"] = p.ConfirmSignUp(ctx, authprovider.ConfirmSignUpRequestData{Username: username, ConfirmationCode: "123456"})
+	_, calls["ResendConfirmationCode"] = p.ResendConfirmationCode(ctx, authprovider.ResendConfirmationCodeRequestData{Username: username})
+	_, calls["ForgotPassword"] = p.ForgotPassword(ctx, authprovider.ForgotPasswordRequestData{Username: username})
+	calls["ConfirmForgotPassword"] = p.ConfirmForgotPassword(ctx, authprovider.ConfirmForgotPasswordRequestData{Username: username, ConfirmationCode: "123456", NewPassword: "new-password"})
+	_, calls["Authenticate"] = p.Authenticate(ctx, authprovider.AuthenticateRequestData{Username: username, Password: "password"})
+	_, calls["RespondToAuthChallenge"] = p.RespondToAuthChallenge(ctx, authprovider.RespondToAuthChallengeRequestData{Username: username, ChallengeName: "SOFTWARE_TOKEN_MFA"})
+	_, calls["RefreshToken"] = p.RefreshToken(ctx, authprovider.RefreshTokenRequestData{RefreshToken: "refresh", Username: username})
+	for name, err := range calls {
+		if err != nil {
+			t.Fatalf("%s() error = %v", name, err)
+		}
+	}
+}
+
+var secretHashOperations = []string{
+	"SignUp",
+	"ConfirmSignUp",
+	"ResendConfirmationCode",
+	"ForgotPassword",
+	"ConfirmForgotPassword",
+	"InitiateAuth:" + string(types.AuthFlowTypeUserPasswordAuth),
+	"RespondToAuthChallenge",
+	"InitiateAuth:" + string(types.AuthFlowTypeRefreshTokenAuth),
+}
+
+func TestSecretHash(t *testing.T) {
+	cfg := appConfig.CognitoConfig{AppClientID: "client-id", AppClientSecret: "client-secret"}
+	client := newStubClient()
+	callAll(t, NewProviderWithClient(client, cfg), "user@example.com")
+
+	want := expectedSecretHash("user@example.com", "client-id", "client-secret")
+	for _, op := range secretHashOperations {
+		if got := client.secretHash[op]; got == nil || *got != want {
+			t.Errorf("%s SECRET_HASH = %v, want %s", op, aws.ToString(got), want)
+		}
+	}
+}
+
+func TestSecretHashWithoutClientSecret(t *testing.T) {
+	client := newStubClient()
+	callAll(t, NewProviderWithClient(client, appConfig.CognitoConfig{AppClientID: "client-id"}), "user@example.com")
+
+	for _, op := range secretHashOperations {
+		if got, called := client.secretHash[op]; !called || got != nil {
+			t.Errorf("%s SECRET_HASH = %v (called %v), want none sent", op, aws.ToString(got), called)
+		}
+	}
+}
+
+func TestRefreshTokenRequiresUsernameWithClientSecret(t *testing.T) {
+	client := newStubClient()
+	p := NewProviderWithClient(client, appConfig.CognitoConfig{AppClientID: "client-id", AppClientSecret: "client-secret"})
+
+	if _, err := p.RefreshToken(context.Background(), authprovider.RefreshTokenRequestData{RefreshToken: "refresh"}); err == nil {
+		t.Error("RefreshToken() without username succeeded, want error")
+	}
+	if client.initiations != 0 {
+		t.Errorf("RefreshToken() without username called Cognito %d times, want 0", client.initiations)
+	}
+}
+
+func TestAuthenticateReturnsUsername(t *testing.T) {
+	p := NewProviderWithClient(newStubClient(), appConfig.CognitoConfig{AppClientID: "client-id"})
+
+	out, err := p.Authenticate(context.Background(), authprovider.AuthenticateRequestData{Username: "user@example.com", Password: "password"})
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	// Refresh must be signed with the pool username, not the email used to log in
+	if out.Username != "4a1c6f0e-user" || out.UserSub != "sub-1" {
+		t.Errorf("Authenticate() username, sub = %q, %q; want 4a1c6f0e-user, sub-1", out.Username, out.UserSub)
+	}
+}
+
+func TestAuthenticateChallengeRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	client := newStubClient()
+	client.challenge = types.ChallengeNameTypeSoftwareTokenMfa
+	p := NewProviderWithClient(client, appConfig.CognitoConfig{AppClientID: "client-id", AppClientSecret: "client-secret"})
+
+	out, err := p.Authenticate(ctx, authprovider.AuthenticateRequestData{Username: "user@example.com", Password: "password"})
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if out.ChallengeName != "SOFTWARE_TOKEN_MFA" || out.Session != "cognito-session" || out.ChallengeParameters["USER_ID_FOR_SRP"] != "4a1c6f0e-user" || out.AccessToken != "" {
+		t.Fatalf("Authenticate() = %+v, want the pending SOFTWARE_TOKEN_MFA challenge without tokens", out)
+	}
+
+	done, err := p.RespondToAuthChallenge(ctx, authprovider.RespondToAuthChallengeRequestData{
+		Username:      "user@example.com",
+		ChallengeName: out.ChallengeName,
+		Session:       out.Session,
+		Responses:     map[string]string{"SOFTWARE_TOKEN_MFA_CODE": "123456"},
+	})
+	if err != nil {
+		t.Fatalf("RespondToAuthChallenge() error = %v", err)
+	}
+	if done.ChallengeName != "" || done.AccessToken != "access" || done.UserSub != "sub-1" {
+		t.Errorf("RespondToAuthChallenge() = %+v, want a completed login for sub-1", done)
+	}
+
+	answer := client.answer
+	if answer.ChallengeName != types.ChallengeNameTypeSoftwareTokenMfa || aws.ToString(answer.Session) != "cognito-session" {
+		t.Errorf("RespondToAuthChallenge input challenge, session = %s, %q; want SOFTWARE_TOKEN_MFA, cognito-session", answer.ChallengeName, aws.ToString(answer.Session))
+	}
+	if answer.ChallengeResponses["SOFTWARE_TOKEN_MFA_CODE"] != "123456" || answer.ChallengeResponses["USERNAME"] != "user@example.com" {
+		t.Errorf("RespondToAuthChallenge responses = %v, want the code and username", answer.ChallengeResponses)
+	}
+}
+
+func TestProviderNeutralTypes(t *testing.T) {
+	attrs := attributeTypes([]authprovider.UserAttribute{{Name: "email", Value: "user@example.com"}, {Name: "custom:org_id", Value: "org-1"}})
+	if len(attrs) != 2 || aws.ToString(attrs[1].Name) != "custom:org_id" || aws.ToString(attrs[1].Value) != "org-1" {
+		t.Errorf("attributeTypes() = %+v, want both attributes in order", attrs)
+	}
+
+	idp := identityProvider(&types.IdentityProviderType{
+		ProviderName:    aws.String("org-1-saml"),
+		ProviderType:    types.IdentityProviderTypeTypeSaml,
+		ProviderDetails: map[string]string{"MetadataURL": "https://idp.example.com/metadata"},
+		IdpIdentifiers:  []string{"example.com"},
+	})
+	if idp.ProviderName != "org-1-saml" || idp.ProviderType != "SAML" || idp.ProviderDetails["MetadataURL"] == "" || len(idp.IdpIdentifiers) != 1 {
+		t.Errorf("identityProvider() = %+v, want the Cognito fields", idp)
+	}
+	if identityProvider(nil) != nil {
+		t.Error("identityProvider(nil) != nil")
+	}
+
+	err := mapError(&types.ResourceNotFoundException{Message: aws.String("not found")})
+	if !errors.Is(err, authprovider.ErrNotFound) {
+		t.Errorf("mapError(ResourceNotFoundException) = %v, want ErrNotFound", err)
+	}
+	// VerifySoftwareToken reports a wrong TOTP code as EnableSoftwareTokenMFAException
+	err = mapError(&types.EnableSoftwareTokenMFAException{Message: aws.String("Code mismatch")})
+	if !errors.Is(err, authprovider.ErrCodeMismatch) {
+		t.Errorf("mapError(EnableSoftwareTokenMFAException) = %v, want ErrCodeMismatch", err)
+	}
+}
@@ -0,0 +1,683 @@
+package local
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	appConfig "shield/cmd/app/config"
+	authprovider "shield/modules/authn/internal/auth/provider"
+	"shield/modules/authn/internal/models"
+)
+
+// Errors for local provider failures that have no provider-neutral equivalent
+var (
+	ErrUserExists       = errors.New("local provider: user already exists")
+	ErrUserNotConfirmed = errors.New("local provider: user is not confirmed")
+	ErrUnsupported      = errors.New("local provider: operation not supported")
+)
+
+const (
+	minPasswordLength = 8
+	signingKeyID      = "local-1"
+
+	challengeNewPassword = "NEW_PASSWORD_REQUIRED"
+)
+
+// Provider is an in-process AuthProvider for development and CI. Users, codes and refresh
+// tokens are held in memory and are lost on restart. Passwords are hashed with bcrypt and
+// access tokens are RS256 JWTs with the claims Cognito issues, so they pass token.Verifier
+// with the keys from PublicKeys. Codes are written to the log instead of being sent.
+type Provider struct {
+	config     appConfig.LocalProviderConfig
+	signingKey *rsa.PrivateKey
+
+	mutex         sync.Mutex
+	users         map[string]*user // By lower-cased username
+	refreshTokens map[string]refreshToken
+	challenges    map[string]string // NEW_PASSWORD_REQUIRED session -> username
+	idps          map[string]*authprovider.IdentityProvider
+
+	now      func() time.Time
+	sendCode func(username, purpose, code string)
+}
+
+type user struct {
+	sub                 string
+	username            string
+	email               string
+	passwordHash        []byte
+	attributes          map[string]string
+	confirmed           bool
+	forceChangePassword bool
+	confirmation        *code // Signup confirmation code
+	reset               *code // Password reset code
+}
+
+// code is a one-time verification code
+type code struct {
+	value     string
+	expiresAt time.Time
+	attempts  int
+}
+
+type refreshToken struct {
+	username  string
+	originJTI string
+	expiresAt time.Time
+}
+
+// accessClaims are the claims of a Cognito access token that Shield reads
+type accessClaims struct {
+	jwt.RegisteredClaims
+	TokenUse  string `json:"token_use"`
+	ClientID  string `json:"client_id"`
+	Username  string `json:"username"`
+	OriginJTI string `json:"origin_jti"`
+}
+
+// NewProvider creates a new local authentication provider with a freshly generated signing key.
+func NewProvider(cfg appConfig.LocalProviderConfig) (*Provider, error) {
+	if cfg.Issuer == "" {
+		cfg.Issuer = "shield-local"
+	}
+	if cfg.ClientID == "" {
+		cfg.ClientID = "shield-local"
+	}
+	if cfg.AccessTokenTTL <= 0 {
+		cfg.AccessTokenTTL = time.Hour
+	}
+	if cfg.RefreshTokenTTL <= 0 {
+		cfg.RefreshTokenTTL = 30 * 24 * time.Hour
+	}
+	if cfg.CodeTTL <= 0 {
+		cfg.CodeTTL = 24 * time.Hour
+	}
+	if cfg.MaxCodeAttempts <= 0 {
+		cfg.MaxCodeAttempts = 5
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+
+	return &Provider{
+		config:        cfg,
+		signingKey:    key,
+		users:         make(map[string]*user),
+		refreshTokens: make(map[string]refreshToken),
+		challenges:    make(map[string]string),
+		idps:          make(map[string]*authprovider.IdentityProvider),
+		now:           time.Now,
+		sendCode: func(username, purpose, code string) {
+			log.Printf("Local provider: %s code for %s is %s", purpose, username, code)
+		},
+	}, nil
+}
+
+// PublicKeys returns the keys that verify access tokens issued by the provider, by key ID.
+func (p *Provider) PublicKeys() map[string]*rsa.PublicKey {
+	return map[string]*rsa.PublicKey{signingKeyID: &p.signingKey.PublicKey}
+}
+
+// Issuer returns the iss claim of issued access tokens.
+func (p *Provider) Issuer() string {
+	return p.config.Issuer
+}
+
+// ClientID returns the client_id claim of issued access tokens.
+func (p *Provider) ClientID() string {
+	return p.config.ClientID
+}
+
+// SignUp registers an unconfirmed user and sends a confirmation code.
+func (p *Provider) SignUp(_ context.Context, req authprovider.SignUpRequestData) (*authprovider.SignUpOutputData, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	u, err := p.createUser(req.Username, req.Email, req.Password, req.UserAttributes)
+	if err != nil {
+		return nil, err
+	}
+	details, err := p.issueCode(u, &u.confirmation, "confirmation")
+	if err != nil {
+		return nil, err
+	}
+
+	return &authprovider.SignUpOutputData{
+		UserSub:             u.sub,
+		CodeDeliveryDetails: details,
+		UserConfirmed:       false,
+	}, nil
+}
+
+// ConfirmSignUp confirms a user's registration using a confirmation code.
+func (p *Provider) ConfirmSignUp(_ context.Context, req authprovider.ConfirmSignUpRequestData) (*authprovider.ConfirmSignUpOutputData, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	u, err := p.user(req.Username)
+	if err != nil {
+		return nil, err
+	}
+	if u.confirmed {
+		return &authprovider.ConfirmSignUpOutputData{}, nil
+	}
+	if err := p.checkCode(&u.confirmation, req.ConfirmationCode); err != nil {
+		return nil, err
+	}
+	u.confirmed = true
+	return &authprovider.ConfirmSignUpOutputData{}, nil
+}
+
+// ResendConfirmationCode sends a new signup confirmation code to an unconfirmed user.
+func (p *Provider) ResendConfirmationCode(_ context.Context, req authprovider.ResendConfirmationCodeRequestData) (*authprovider.ResendConfirmationCodeOutputData, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	u, err := p.user(req.Username)
+	if err != nil {
+		return nil, err
+	}
+	if u.confirmed {
+		return nil, fmt.Errorf("local provider: user %s is already confirmed", req.Username)
+	}
+	details, err := p.issueCode(u, &u.confirmation, "confirmation")
+	if err != nil {
+		return nil, err
+	}
+	return &authprovider.ResendConfirmationCodeOutputData{CodeDeliveryDetails: details}, nil
+}
+
+// AdminCreateUser creates a confirmed user who must choose a new password at first login.
+func (p *Provider) AdminCreateUser(_ context.Context, req authprovider.AdminCreateUserRequestData) (*authprovider.AdminCreateUserOutputData, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	u, err := p.createUser(req.Username, req.Email, req.TemporaryPassword, req.UserAttributes)
+	if err != nil {
+		return nil, err
+	}
+	u.confirmed = true
+	u.forceChangePassword = true
+
+	return &authprovider.AdminCreateUserOutputData{
+		User: &models.User{Email: u.email, CognitoSub: u.sub},
+	}, nil
+}
+
+// AdminDeleteUser deletes a user and revokes their refresh tokens.
+func (p *Provider) AdminDeleteUser(_ context.Context, username string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	u, err := p.user(username)
+	if err != nil {
+		return err
+	}
+	for value, rt := range p.refreshTokens {
+		if rt.username == u.username {
+			delete(p.refreshTokens, value)
+		}
+	}
+	delete(p.users, strings.ToLower(u.username))
+	return nil
+}
+
+// GetUser returns the user an access token was issued to.
+func (p *Provider) GetUser(_ context.Context, accessToken string) (*authprovider.GetUserOutputData, error) {
+	claims, err := p.parseAccessToken(accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	u, err := p.user(claims.Username)
+	if err != nil {
+		return nil, err
+	}
+	return &authprovider.GetUserOutputData{
+		User:     &models.User{Email: u.email, CognitoSub: u.sub},
+		Username: u.username,
+	}, nil
+}
+
+// Authenticate checks a username and password and issues tokens. Users created by
+// AdminCreateUser receive a NEW_PASSWORD_REQUIRED challenge instead.
+func (p *Provider) Authenticate(_ context.Context, req authprovider.AuthenticateRequestData) (*authprovider.AuthenticateOutputData, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	u, ok := p.users[strings.ToLower(req.Username)]
+	if !ok || bcrypt.CompareHashAndPassword(u.passwordHash, []byte(req.Password)) != nil {
+		return nil, fmt.Errorf("%w: incorrect username or password", authprovider.ErrNotAuthorized)
+	}
+	if !u.confirmed {
+		return nil, ErrUserNotConfirmed
+	}
+
+	if u.forceChangePassword {
+		session, err := randomToken()
+		if err != nil {
+			return nil, err
+		}
+		p.challenges[session] = u.username
+		return &authprovider.AuthenticateOutputData{
+			ChallengeName:       challengeNewPassword,
+			Session:             session,
+			ChallengeParameters: map[string]string{"USER_ID_FOR_SRP": u.username},
+		}, nil
+	}
+
+	return p.issueTokens(u)
+}
+
+// RespondToAuthChallenge answers a NEW_PASSWORD_REQUIRED challenge with the NEW_PASSWORD response.
+func (p *Provider) RespondToAuthChallenge(_ context.Context, req authprovider.RespondToAuthChallengeRequestData) (*authprovider.AuthenticateOutputData, error) {
+	if req.ChallengeName != challengeNewPassword {
+		return nil, fmt.Errorf("%w: challenge %s", ErrUnsupported, req.ChallengeName)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	username, ok := p.challenges[req.Session]
+	if !ok || !strings.EqualFold(username, req.Username) {
+		return nil, fmt.Errorf("%w: invalid challenge session", authprovider.ErrNotAuthorized)
+	}
+	u, err := p.user(username)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.setPassword(req.Responses["NEW_PASSWORD"]); err != nil {
+		return nil, err
+	}
+	delete(p.challenges, req.Session)
+	u.forceChangePassword = false
+
+	return p.issueTokens(u)
+}
+
+// RefreshToken issues a new access token for the authentication event of a refresh token.
+func (p *Provider) RefreshToken(_ context.Context, req authprovider.RefreshTokenRequestData) (*authprovider.RefreshTokenOutputData, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	rt, ok := p.refreshTokens[req.RefreshToken]
+	if !ok || !p.now().Before(rt.expiresAt) {
+		return nil, fmt.Errorf("%w: invalid refresh token", authprovider.ErrNotAuthorized)
+	}
+	u, err := p.user(rt.username)
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := p.signAccessToken(u, rt.originJTI)
+	if err != nil {
+		return nil, err
+	}
+	return &authprovider.RefreshTokenOutputData{
+		AccessToken: accessToken,
+		ExpiresIn:   int64(p.config.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// RevokeToken revokes a refresh token. Access tokens already issued stay valid until they expire.
+func (p *Provider) RevokeToken(_ context.Context, refreshToken string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	delete(p.refreshTokens, refreshToken)
+	return nil
+}
+
+// GlobalSignOut revokes all refresh tokens issued to a user.
+func (p *Provider) GlobalSignOut(_ context.Context, username string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	u, err := p.user(username)
+	if err != nil {
+		return err
+	}
+	for value, rt := range p.refreshTokens {
+		if rt.username == u.username {
+			delete(p.refreshTokens, value)
+		}
+	}
+	return nil
+}
+
+// ForgotPassword sends a password reset code to the user.
+func (p *Provider) ForgotPassword(_ context.Context, req authprovider.ForgotPasswordRequestData) (*authprovider.ForgotPasswordOutputData, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	u, err := p.user(req.Username)
+	if err != nil {
+		return nil, err
+	}
+	details, err := p.issueCode(u, &u.reset, "password reset")
+	if err != nil {
+		return nil, err
+	}
+	return &authprovider.ForgotPasswordOutputData{CodeDeliveryDetails: details}, nil
+}
+
+// ConfirmForgotPassword sets a new password using the reset code sent by ForgotPassword.
+func (p *Provider) ConfirmForgotPassword(_ context.Context, req authprovider.ConfirmForgotPasswordRequestData) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	u, err := p.user(req.Username)
+	if err != nil {
+		return err
+	}
+	if err := validatePassword(req.NewPassword); err != nil {
+		return err
+	}
+	if err := p.checkCode(&u.reset, req.ConfirmationCode); err != nil {
+		return err
+	}
+	return u.setPassword(req.NewPassword)
+}
+
+// ChangePassword changes the password of the user an access token was issued to.
+func (p *Provider) ChangePassword(_ context.Context, req authprovider.ChangePasswordRequestData) error {
+	claims, err := p.parseAccessToken(req.AccessToken)
+	if err != nil {
+		return err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	u, err := p.user(claims.Username)
+	if err != nil {
+		return err
+	}
+	if bcrypt.CompareHashAndPassword(u.passwordHash, []byte(req.PreviousPassword)) != nil {
+		return fmt.Errorf("%w: incorrect password", authprovider.ErrNotAuthorized)
+	}
+	return u.setPassword(req.ProposedPassword)
+}
+
+// AssociateSoftwareToken is not supported; use Shield's local MFA engine instead.
+func (p *Provider) AssociateSoftwareToken(context.Context, authprovider.AssociateSoftwareTokenRequestData) (*authprovider.AssociateSoftwareTokenOutputData, error) {
+	return nil, fmt.Errorf("%w: software token MFA", ErrUnsupported)
+}
+
+// VerifySoftwareToken is not supported; use Shield's local MFA engine instead.
+func (p *Provider) VerifySoftwareToken(context.Context, authprovider.VerifySoftwareTokenRequestData) (*authprovider.VerifySoftwareTokenOutputData, error) {
+	return nil, fmt.Errorf("%w: software token MFA", ErrUnsupported)
+}
+
+// SetMFAPreference is not supported; the local provider never asks for a second factor.
+func (p *Provider) SetMFAPreference(context.Context, authprovider.SetMFAPreferenceRequestData) error {
+	return fmt.Errorf("%w: MFA preferences", ErrUnsupported)
+}
+
+// CreateIdentityProvider registers an identity provider. Federated login is not available
+// locally; the registration only lets organization SSO setup be exercised.
+func (p *Provider) CreateIdentityProvider(_ context.Context, req authprovider.CreateIdentityProviderRequestData) (*authprovider.CreateIdentityProviderOutputData, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if _, ok := p.idps[req.ProviderName]; ok {
+		return nil, fmt.Errorf("local provider: identity provider %s already exists", req.ProviderName)
+	}
+	now := p.now()
+	idp := &authprovider.IdentityProvider{
+		ProviderName:     req.ProviderName,
+		ProviderType:     req.ProviderType,
+		ProviderDetails:  req.ProviderDetails,
+		AttributeMapping: req.AttributeMapping,
+		IdpIdentifiers:   req.IdpIdentifiers,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+	p.idps[req.ProviderName] = idp
+	copied := *idp
+	return &authprovider.CreateIdentityProviderOutputData{IdentityProvider: &copied}, nil
+}
+
+// UpdateIdentityProvider updates a registered identity provider. Nil or empty fields are left unchanged.
+func (p *Provider) UpdateIdentityProvider(_ context.Context, req authprovider.UpdateIdentityProviderRequestData) (*authprovider.UpdateIdentityProviderOutputData, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	idp, ok := p.idps[req.ProviderName]
+	if !ok {
+		return nil, fmt.Errorf("%w: identity provider %s", authprovider.ErrNotFound, req.ProviderName)
+	}
+	if len(req.ProviderDetails) > 0 {
+		idp.ProviderDetails = req.ProviderDetails
+	}
+	if len(req.AttributeMapping) > 0 {
+		idp.AttributeMapping = req.AttributeMapping
+	}
+	if req.IdpIdentifiers != nil {
+		idp.IdpIdentifiers = req.IdpIdentifiers
+	}
+	idp.UpdatedAt = p.now()
+	copied := *idp
+	return &authprovider.UpdateIdentityProviderOutputData{IdentityProvider: &copied}, nil
+}
+
+// DescribeIdentityProvider returns a registered identity provider.
+func (p *Provider) DescribeIdentityProvider(_ context.Context, providerName string) (*authprovider.DescribeIdentityProviderOutputData, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	idp, ok := p.idps[providerName]
+	if !ok {
+		return nil, fmt.Errorf("%w: identity provider %s", authprovider.ErrNotFound, providerName)
+	}
+	copied := *idp
+	return &authprovider.DescribeIdentityProviderOutputData{IdentityProvider: &copied}, nil
+}
+
+// DeleteIdentityProvider removes a registered identity provider.
+func (p *Provider) DeleteIdentityProvider(_ context.Context, providerName string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if _, ok := p.idps[providerName]; !ok {
+		return fmt.Errorf("%w: identity provider %s", authprovider.ErrNotFound, providerName)
+	}
+	delete(p.idps, providerName)
+	return nil
+}
+
+// createUser adds a user; the caller holds the mutex
+func (p *Provider) createUser(username, email, password string, attrs []authprovider.UserAttribute) (*user, error) {
+	key := strings.ToLower(username)
+	if _, ok := p.users[key]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrUserExists, username)
+	}
+
+	u := &user{
+		sub:        uuid.New().String(),
+		username:   username,
+		email:      email,
+		attributes: make(map[string]string, len(attrs)),
+	}
+	for _, attr := range attrs {
+		u.attributes[attr.Name] = attr.Value
+	}
+	if u.email == "" {
+		u.email = u.attributes["email"]
+	}
+	if err := u.setPassword(password); err != nil {
+		return nil, err
+	}
+
+	p.users[key] = u
+	return u, nil
+}
+
+// user looks up a user by username; the caller holds the mutex
+func (p *Provider) user(username string) (*user, error) {
+	u, ok := p.users[strings.ToLower(username)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", authprovider.ErrUserNotFound, username)
+	}
+	return u, nil
+}
+
+// issueCode replaces the code in slot with a new one and delivers it
+func (p *Provider) issueCode(u *user, slot **code, purpose string) (*authprovider.CodeDeliveryDetailsData, error) {
+	value, err := randomDigits(6)
+	if err != nil {
+		return nil, err
+	}
+	*slot = &code{value: value, expiresAt: p.now().Add(p.config.CodeTTL)}
+	p.sendCode(u.username, purpose, value)
+
+	return &authprovider.CodeDeliveryDetailsData{
+		AttributeName:  "email",
+		DeliveryMedium: "EMAIL",
+		Destination:    u.email,
+	}, nil
+}
+
+// checkCode consumes the code in slot if value matches it
+func (p *Provider) checkCode(slot **code, value string) error {
+	c := *slot
+	switch {
+	case c == nil:
+		return fmt.Errorf("%w: no code was sent", authprovider.ErrCodeMismatch)
+	case !p.now().Before(c.expiresAt):
+		return fmt.Errorf("%w: code expired", authprovider.ErrCodeExpired)
+	case c.attempts >= p.config.MaxCodeAttempts:
+		return fmt.Errorf("%w: too many failed attempts", authprovider.ErrLimitExceeded)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(c.value), []byte(value)) != 1 {
+		c.attempts++
+		return fmt.Errorf("%w: wrong code", authprovider.ErrCodeMismatch)
+	}
+	*slot = nil
+	return nil
+}
+
+// issueTokens starts an authentication event for u; the caller holds the mutex
+func (p *Provider) issueTokens(u *user) (*authprovider.AuthenticateOutputData, error) {
+	originJTI := uuid.New().String()
+	accessToken, err := p.signAccessToken(u, originJTI)
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	p.refreshTokens[refresh] = refreshToken{
+		username:  u.username,
+		originJTI: originJTI,
+		expiresAt: p.now().Add(p.config.RefreshTokenTTL),
+	}
+
+	return &authprovider.AuthenticateOutputData{
+		AccessToken:  accessToken,
+		RefreshToken: refresh,
+		ExpiresIn:    int64(p.config.AccessTokenTTL.Seconds()),
+		UserSub:      u.sub,
+		Username:     u.username,
+	}, nil
+}
+
+func (p *Provider) signAccessToken(u *user, originJTI string) (string, error) {
+	now := p.now()
+	claims := accessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    p.config.Issuer,
+			Subject:   u.sub,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(p.config.AccessTokenTTL)),
+			ID:        uuid.New().String(),
+		},
+		TokenUse:  "access",
+		ClientID:  p.config.ClientID,
+		Username:  u.username,
+		OriginJTI: originJTI,
+	}
+
+	t := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	t.Header["kid"] = signingKeyID
+	return t.SignedString(p.signingKey)
+}
+
+func (p *Provider) parseAccessToken(rawToken string) (*accessClaims, error) {
+	var claims accessClaims
+	_, err := jwt.ParseWithClaims(rawToken, &claims, func(*jwt.Token) (interface{}, error) {
+		return &p.signingKey.PublicKey, nil
+	},
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithIssuer(p.config.Issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(p.now),
+	)
+	if err != nil || claims.TokenUse != "access" {
+		return nil, fmt.Errorf("%w: invalid access token", authprovider.ErrNotAuthorized)
+	}
+	return &claims, nil
+}
+
+func (u *user) setPassword(password string) error {
+	if err := validatePassword(password); err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	u.passwordHash = hash
+	return nil
+}
+
+func validatePassword(password string) error {
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("%w: at least %d characters are required", authprovider.ErrInvalidPassword, minPasswordLength)
+	}
+	return nil
+}
+
+func randomDigits(n int) (string, error) {
+	max := big.NewInt(10)
+	digits := make([]byte, n)
+	for i := range digits {
+		d, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		digits[i] = byte('0' + d.Int64())
+	}
+	return string(digits), nil
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Ensure Provider implements the AuthProvider interface.
+var _ authprovider.AuthProvider = (*Provider)(nil)
@@ -0,0 +1,174 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	appConfig "shield/cmd/app/config"
+	authprovider "shield/modules/authn/internal/auth/provider"
+	"shield/modules/authn/internal/auth/token"
+)
+
+// newTestProvider returns a provider whose codes are captured per username and purpose
+func newTestProvider(t *testing.T) (*Provider, map[string]string) {
+	t.Helper()
+	p, err := NewProvider(appConfig.LocalProviderConfig{MaxCodeAttempts: 2})
+	if err != nil {
+		t.Fatalf("NewProvider() error = %v", err)
+	}
+	codes := map[string]string{}
+	p.sendCode = func(username, purpose, code string) { codes[purpose+":"+username] = code }
+	return p, codes
+}
+
+func TestSignupLoginRefresh(t *testing.T) {
+	p, codes := newTestProvider(t)
+	ctx := context.Background()
+
+	signup, err := p.SignUp(ctx, authprovider.SignUpRequestData{Username: "user@example.com", Email: "user@example.com", Password: "password"})
+	if err != nil {
+		t.Fatalf("SignUp() error = %v", err)
+	}
+	if signup.UserConfirmed || signup.CodeDeliveryDetails == nil {
+		t.Errorf("SignUp() = %+v, want an unconfirmed user with code delivery details", signup)
+	}
+	if _, err := p.SignUp(ctx, authprovider.SignUpRequestData{Username: "USER@example.com", Password: "password"}); !errors.Is(err, ErrUserExists) {
+		t.Errorf("duplicate SignUp() error = %v, want ErrUserExists", err)
+	}
+
+	if _, err := p.Authenticate(ctx, authprovider.AuthenticateRequestData{Username: "user@example.com", Password: "password"}); !errors.Is(err, ErrUserNotConfirmed) {
+		t.Errorf("Authenticate() before confirmation error = %v, want ErrUserNotConfirmed", err)
+	}
+	if _, err := p.ConfirmSignUp(ctx, authprovider.ConfirmSignUpRequestData{Username: "user@example.com", ConfirmationCode: codes["confirmation:user@example.com"]}); err != nil {
+		t.Fatalf("ConfirmSignUp() error = %v", err)
+	}
+
+	if _, err := p.Authenticate(ctx, authprovider.AuthenticateRequestData{Username: "user@example.com", Password: "wrong-password"}); !errors.Is(err, authprovider.ErrNotAuthorized) {
+		t.Errorf("Authenticate() with wrong password error = %v, want ErrNotAuthorized", err)
+	}
+	login, err := p.Authenticate(ctx, authprovider.AuthenticateRequestData{Username: "user@example.com", Password: "password"})
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if login.UserSub != signup.UserSub || login.Username != "user@example.com" || login.RefreshToken == "" {
+		t.Errorf("Authenticate() = %+v, want tokens for %s", login, signup.UserSub)
+	}
+
+	// Access tokens pass the same verification as Cognito tokens
+	verifier := token.NewVerifier(token.StaticKeys(p.PublicKeys()), token.VerifierConfig{Issuer: p.Issuer(), ClientID: p.ClientID()})
+	claims, err := verifier.Verify(ctx, login.AccessToken)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if claims.Subject != signup.UserSub || claims.OriginJTI == "" {
+		t.Errorf("access token claims = %+v, want sub %s and an origin_jti", claims, signup.UserSub)
+	}
+
+	refreshed, err := p.RefreshToken(ctx, authprovider.RefreshTokenRequestData{RefreshToken: login.RefreshToken})
+	if err != nil {
+		t.Fatalf("RefreshToken() error = %v", err)
+	}
+	refreshedClaims, err := verifier.Verify(ctx, refreshed.AccessToken)
+	if err != nil || refreshedClaims.OriginJTI != claims.OriginJTI {
+		t.Errorf("refreshed access token = %+v, %v; want the same origin_jti", refreshedClaims, err)
+	}
+
+	user, err := p.GetUser(ctx, refreshed.AccessToken)
+	if err != nil || user.User.CognitoSub != signup.UserSub || user.User.Email != "user@example.com" {
+		t.Errorf("GetUser() = %+v, %v; want the signed-up user", user, err)
+	}
+
+	if err := p.GlobalSignOut(ctx, "user@example.com"); err != nil {
+		t.Fatalf("GlobalSignOut() error = %v", err)
+	}
+	if _, err := p.RefreshToken(ctx, authprovider.RefreshTokenRequestData{RefreshToken: login.RefreshToken}); !errors.Is(err, authprovider.ErrNotAuthorized) {
+		t.Errorf("RefreshToken() after GlobalSignOut error = %v, want ErrNotAuthorized", err)
+	}
+}
+
+func TestConfirmationCodes(t *testing.T) {
+	p, codes := newTestProvider(t)
+	ctx := context.Background()
+	if _, err := p.SignUp(ctx, authprovider.SignUpRequestData{Username: "user@example.com", Password: "password"}); err != nil {
+		t.Fatalf("SignUp() error = %v", err)
+	}
+	confirm := func(code string) error {
+		_, err := p.ConfirmSignUp(ctx, authprovider.ConfirmSignUpRequestData{Username: "user@example.com", ConfirmationCode: code})
+		return err
+	}
+
+	for i, want := range []error{authprovider.ErrCodeMismatch, authprovider.ErrCodeMismatch, authprovider.ErrLimitExceeded} {
+		if err := confirm("000000x"); !errors.Is(err, want) {
+			t.Errorf("wrong code attempt %d error = %v, want %v", i+1, err, want)
+		}
+	}
+
+	// A new code resets the attempts but expires
+	if _, err := p.ResendConfirmationCode(ctx, authprovider.ResendConfirmationCodeRequestData{Username: "user@example.com"}); err != nil {
+		t.Fatalf("ResendConfirmationCode() error = %v", err)
+	}
+	p.now = func() time.Time { return time.Now().Add(25 * time.Hour) }
+	if err := confirm(codes["confirmation:user@example.com"]); !errors.Is(err, authprovider.ErrCodeExpired) {
+		t.Errorf("expired code error = %v, want ErrCodeExpired", err)
+	}
+	p.now = time.Now
+
+	if _, err := p.ResendConfirmationCode(ctx, authprovider.ResendConfirmationCodeRequestData{Username: "user@example.com"}); err != nil {
+		t.Fatalf("ResendConfirmationCode() error = %v", err)
+	}
+	if err := confirm(codes["confirmation:user@example.com"]); err != nil {
+		t.Errorf("ConfirmSignUp() with new code error = %v", err)
+	}
+}
+
+func TestPasswords(t *testing.T) {
+	p, codes := newTestProvider(t)
+	ctx := context.Background()
+
+	if _, err := p.AdminCreateUser(ctx, authprovider.AdminCreateUserRequestData{Username: "admin@example.com", Email: "admin@example.com", TemporaryPassword: "temporary"}); err != nil {
+		t.Fatalf("AdminCreateUser() error = %v", err)
+	}
+	challenge, err := p.Authenticate(ctx, authprovider.AuthenticateRequestData{Username: "admin@example.com", Password: "temporary"})
+	if err != nil || challenge.ChallengeName != challengeNewPassword {
+		t.Fatalf("Authenticate() with temporary password = %+v, %v; want NEW_PASSWORD_REQUIRED", challenge, err)
+	}
+	login, err := p.RespondToAuthChallenge(ctx, authprovider.RespondToAuthChallengeRequestData{
+		Username:      "admin@example.com",
+		ChallengeName: challengeNewPassword,
+		Session:       challenge.Session,
+		Responses:     map[string]string{"NEW_PASSWORD": "chosen-password"},
+	})
+	if err != nil || login.AccessToken == "" {
+		t.Fatalf("RespondToAuthChallenge() = %+v, %v; want tokens", login, err)
+	}
+
+	change := authprovider.ChangePasswordRequestData{AccessToken: login.AccessToken, PreviousPassword: "temporary", ProposedPassword: "changed-password"}
+	if err := p.ChangePassword(ctx, change); !errors.Is(err, authprovider.ErrNotAuthorized) {
+		t.Errorf("ChangePassword() with wrong current password error = %v, want ErrNotAuthorized", err)
+	}
+	change.PreviousPassword = "chosen-password"
+	change.ProposedPassword = "short"
+	if err := p.ChangePassword(ctx, change); !errors.Is(err, authprovider.ErrInvalidPassword) {
+		t.Errorf("ChangePassword() to short password error = %v, want ErrInvalidPassword", err)
+	}
+
+	if _, err := p.ForgotPassword(ctx, authprovider.ForgotPasswordRequestData{Username: "nobody@example.com"}); !errors.Is(err, authprovider.ErrUserNotFound) {
+		t.Errorf("ForgotPassword() for unknown user error = %v, want ErrUserNotFound", err)
+	}
+	if _, err := p.ForgotPassword(ctx, authprovider.ForgotPasswordRequestData{Username: "admin@example.com"}); err != nil {
+		t.Fatalf("ForgotPassword() error = %v", err)
+	}
+	err = p.ConfirmForgotPassword(ctx, authprovider.ConfirmForgotPasswordRequestData{
+		Username:         "admin@example.com",
+		ConfirmationCode: codes["password reset:admin@example.com"],
+		NewPassword:      "reset-password",
+	})
+	if err != nil {
+		t.Fatalf("ConfirmForgotPassword() error = %v", err)
+	}
+	if _, err := p.Authenticate(ctx, authprovider.AuthenticateRequestData{Username: "admin@example.com", Password: "reset-password"}); err != nil {
+		t.Errorf("Authenticate() with reset password error = %v", err)
+	}
+}
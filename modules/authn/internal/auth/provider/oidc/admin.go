@@ -0,0 +1,601 @@
+package oidc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	authprovider "shield/modules/authn/internal/auth/provider"
+	"shield/modules/authn/internal/models"
+)
+
+// Keycloak required actions
+const (
+	actionVerifyEmail    = "VERIFY_EMAIL"
+	actionUpdatePassword = "UPDATE_PASSWORD"
+)
+
+// mapperPrefix marks the identity provider mappers managed by Shield; others are left alone
+const mapperPrefix = "shield-"
+
+// userRepresentation is a Keycloak user.
+// Docs: https://www.keycloak.org/docs-api/latest/rest-api/index.html#UserRepresentation
+type userRepresentation struct {
+	ID              string                     `json:"id,omitempty"`
+	Username        string                     `json:"username"`
+	Email           string                     `json:"email,omitempty"`
+	EmailVerified   bool                       `json:"emailVerified"`
+	Enabled         bool                       `json:"enabled"`
+	FirstName       string                     `json:"firstName,omitempty"`
+	LastName        string                     `json:"lastName,omitempty"`
+	Attributes      map[string][]string        `json:"attributes,omitempty"`
+	Credentials     []credentialRepresentation `json:"credentials,omitempty"`
+	RequiredActions []string                   `json:"requiredActions,omitempty"`
+}
+
+type credentialRepresentation struct {
+	Type      string `json:"type"`
+	Value     string `json:"value"`
+	Temporary bool   `json:"temporary"`
+}
+
+// identityProviderRepresentation is a Keycloak identity provider instance
+type identityProviderRepresentation struct {
+	Alias      string            `json:"alias"`
+	ProviderID string            `json:"providerId"` // saml or oidc
+	Enabled    bool              `json:"enabled"`
+	Config     map[string]string `json:"config"`
+}
+
+// mapperRepresentation is a Keycloak identity provider mapper
+type mapperRepresentation struct {
+	ID                     string            `json:"id,omitempty"`
+	Name                   string            `json:"name"`
+	IdentityProviderAlias  string            `json:"identityProviderAlias"`
+	IdentityProviderMapper string            `json:"identityProviderMapper"`
+	Config                 map[string]string `json:"config"`
+}
+
+// adminAccessToken returns a cached client_credentials token for the admin API.
+func (p *Provider) adminAccessToken(ctx context.Context) (string, error) {
+	p.adminMutex.Lock()
+	defer p.adminMutex.Unlock()
+
+	if p.adminToken != "" && p.now().Before(p.adminTokenExpiry) {
+		return p.adminToken, nil
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	tokens, err := p.tokenRequest(ctx, form)
+	if err != nil {
+		return "", fmt.Errorf("failed to get admin token: %w", err)
+	}
+	// Renew a little early so a token does not expire in flight
+	p.adminToken = tokens.AccessToken
+	p.adminTokenExpiry = p.now().Add(time.Duration(tokens.ExpiresIn)*time.Second - 30*time.Second)
+	return p.adminToken, nil
+}
+
+// adminRequest calls the admin API. JSON bodies are encoded from body unless it is an io.Reader,
+// which is sent as is with contentType.
+func (p *Provider) adminRequest(ctx context.Context, method, resource string, body interface{}, contentType string) (http.Header, []byte, error) {
+	if p.config.AdminURL == "" {
+		return nil, nil, fmt.Errorf("%w: adminUrl is not configured", ErrUnsupported)
+	}
+	accessToken, err := p.adminAccessToken(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case io.Reader:
+		reader = b
+	default:
+		encoded, err := json.Marshal(b)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(encoded)
+		contentType = "application/json"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.config.AdminURL+resource, reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to build admin request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+	if reader != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	status, header, respBody, err := p.do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("admin request failed: %w", err)
+	}
+	if status < 200 || status > 299 {
+		log.Printf("OIDC provider admin API %s %s error: status %d", method, resource, status)
+		return nil, nil, mapError("admin API", status, respBody)
+	}
+	return header, respBody, nil
+}
+
+// adminJSON calls the admin API and decodes the JSON response into out.
+func (p *Provider) adminJSON(ctx context.Context, method, resource string, body, out interface{}) error {
+	_, respBody, err := p.adminRequest(ctx, method, resource, body, "")
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to decode admin response: %w", err)
+	}
+	return nil
+}
+
+// newUser builds the representation of a new user. Standard attributes map to the Keycloak
+// user fields and custom:-prefixed ones to user attributes without the prefix.
+func newUser(username, email string, attrs []authprovider.UserAttribute) userRepresentation {
+	u := userRepresentation{Username: username, Email: email, Enabled: true}
+	for _, attr := range attrs {
+		switch attr.Name {
+		case "email":
+			if u.Email == "" {
+				u.Email = attr.Value
+			}
+		case "given_name":
+			u.FirstName = attr.Value
+		case "family_name":
+			u.LastName = attr.Value
+		case "email_verified":
+			u.EmailVerified = attr.Value == "true"
+		default:
+			if u.Attributes == nil {
+				u.Attributes = map[string][]string{}
+			}
+			name := strings.TrimPrefix(attr.Name, "custom:")
+			u.Attributes[name] = append(u.Attributes[name], attr.Value)
+		}
+	}
+	return u
+}
+
+// createUser creates a user and returns its ID, which is also the sub of its tokens.
+// Docs: https://www.keycloak.org/docs-api/latest/rest-api/index.html#_post_adminrealmsrealmusers
+func (p *Provider) createUser(ctx context.Context, u userRepresentation) (string, error) {
+	header, _, err := p.adminRequest(ctx, http.MethodPost, "/users", u, "")
+	if err != nil {
+		return "", err
+	}
+	location := header.Get("Location")
+	if location == "" {
+		return "", fmt.Errorf("admin API did not return the location of the new user")
+	}
+	return path.Base(location), nil
+}
+
+// findUser looks a user up by exact username.
+func (p *Provider) findUser(ctx context.Context, username string) (*userRepresentation, error) {
+	query := url.Values{}
+	query.Set("username", username)
+	query.Set("exact", "true")
+
+	var users []userRepresentation
+	if err := p.adminJSON(ctx, http.MethodGet, "/users?"+query.Encode(), nil, &users); err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, fmt.Errorf("%w: %s", authprovider.ErrUserNotFound, username)
+	}
+	return &users[0], nil
+}
+
+// userResource returns the admin API path of a user, with optional sub-resources.
+func userResource(id string, elems ...string) string {
+	resource := "/users/" + url.PathEscape(id)
+	for _, elem := range elems {
+		resource += "/" + elem
+	}
+	return resource
+}
+
+func (p *Provider) setPassword(ctx context.Context, userID, password string, temporary bool) error {
+	credential := credentialRepresentation{Type: "password", Value: password, Temporary: temporary}
+	return p.adminJSON(ctx, http.MethodPut, userResource(userID, "reset-password"), credential, nil)
+}
+
+// executeActionsEmail emails the user a link to complete the given required actions.
+func (p *Provider) executeActionsEmail(ctx context.Context, userID string, actions ...string) error {
+	query := url.Values{}
+	query.Set("client_id", p.config.ClientID)
+	return p.adminJSON(ctx, http.MethodPut, userResource(userID, "execute-actions-email")+"?"+query.Encode(), actions, nil)
+}
+
+// emailDelivery describes a link sent by email, in place of Cognito's code delivery details
+func emailDelivery(email string) *authprovider.CodeDeliveryDetailsData {
+	return &authprovider.CodeDeliveryDetailsData{
+		AttributeName:  "email",
+		DeliveryMedium: "EMAIL",
+		Destination:    email,
+	}
+}
+
+// SignUp creates a user. With verifyEmail the user must follow the emailed verification link
+// before they can log in; otherwise the user is confirmed immediately.
+func (p *Provider) SignUp(ctx context.Context, req authprovider.SignUpRequestData) (*authprovider.SignUpOutputData, error) {
+	u := newUser(req.Username, req.Email, req.UserAttributes)
+	u.Credentials = []credentialRepresentation{{Type: "password", Value: req.Password}}
+	if p.config.VerifyEmail {
+		u.RequiredActions = []string{actionVerifyEmail}
+	}
+
+	id, err := p.createUser(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &authprovider.SignUpOutputData{UserSub: id, UserConfirmed: !p.config.VerifyEmail}
+	if p.config.VerifyEmail {
+		if err := p.executeActionsEmail(ctx, id, actionVerifyEmail); err != nil {
+			return nil, fmt.Errorf("failed to send verification email: %w", err)
+		}
+		out.CodeDeliveryDetails = emailDelivery(u.Email)
+	}
+	return out, nil
+}
+
+// ConfirmSignUp is not supported; users confirm through the emailed verification link.
+func (p *Provider) ConfirmSignUp(context.Context, authprovider.ConfirmSignUpRequestData) (*authprovider.ConfirmSignUpOutputData, error) {
+	return nil, fmt.Errorf("%w: email is verified through the link sent by the provider", ErrUnsupported)
+}
+
+// ResendConfirmationCode emails a new verification link.
+func (p *Provider) ResendConfirmationCode(ctx context.Context, req authprovider.ResendConfirmationCodeRequestData) (*authprovider.ResendConfirmationCodeOutputData, error) {
+	u, err := p.findUser(ctx, req.Username)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.executeActionsEmail(ctx, u.ID, actionVerifyEmail); err != nil {
+		return nil, err
+	}
+	return &authprovider.ResendConfirmationCodeOutputData{CodeDeliveryDetails: emailDelivery(u.Email)}, nil
+}
+
+// AdminCreateUser creates a verified user with a temporary password and emails them a link to
+// choose their own; the password grant is refused until they have.
+func (p *Provider) AdminCreateUser(ctx context.Context, req authprovider.AdminCreateUserRequestData) (*authprovider.AdminCreateUserOutputData, error) {
+	u := newUser(req.Username, req.Email, req.UserAttributes)
+	u.EmailVerified = true
+	if req.TemporaryPassword != "" {
+		u.Credentials = []credentialRepresentation{{Type: "password", Value: req.TemporaryPassword, Temporary: true}}
+	}
+	u.RequiredActions = []string{actionUpdatePassword}
+
+	id, err := p.createUser(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.executeActionsEmail(ctx, id, actionUpdatePassword); err != nil {
+		log.Printf("OIDC provider: failed to email password setup link to %s: %v", req.Username, err)
+	}
+
+	return &authprovider.AdminCreateUserOutputData{
+		User: &models.User{Email: u.Email, CognitoSub: id, IsVerified: true},
+	}, nil
+}
+
+// AdminDeleteUser deletes a user, ending their sessions.
+func (p *Provider) AdminDeleteUser(ctx context.Context, username string) error {
+	u, err := p.findUser(ctx, username)
+	if err != nil {
+		return err
+	}
+	return p.adminJSON(ctx, http.MethodDelete, userResource(u.ID), nil, nil)
+}
+
+// GlobalSignOut ends all provider sessions of a user, revoking their refresh tokens.
+// The user is identified by their ID, which is the sub of their tokens.
+func (p *Provider) GlobalSignOut(ctx context.Context, username string) error {
+	return p.adminJSON(ctx, http.MethodPost, userResource(username, "logout"), nil, nil)
+}
+
+// ForgotPassword emails the user a link to choose a new password.
+func (p *Provider) ForgotPassword(ctx context.Context, req authprovider.ForgotPasswordRequestData) (*authprovider.ForgotPasswordOutputData, error) {
+	u, err := p.findUser(ctx, req.Username)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.executeActionsEmail(ctx, u.ID, actionUpdatePassword); err != nil {
+		return nil, err
+	}
+	return &authprovider.ForgotPasswordOutputData{CodeDeliveryDetails: emailDelivery(u.Email)}, nil
+}
+
+// ConfirmForgotPassword is not supported; the new password is set through the emailed link.
+func (p *Provider) ConfirmForgotPassword(context.Context, authprovider.ConfirmForgotPasswordRequestData) error {
+	return fmt.Errorf("%w: passwords are reset through the link sent by the provider", ErrUnsupported)
+}
+
+// identityProviderResource returns the admin API path of an identity provider instance.
+func identityProviderResource(alias string, elems ...string) string {
+	resource := "/identity-provider/instances/" + url.PathEscape(alias)
+	for _, elem := range elems {
+		resource += "/" + elem
+	}
+	return resource
+}
+
+// keycloakProviderID returns the Keycloak provider type for a SAML or OIDC identity provider.
+func keycloakProviderID(providerType string) (string, error) {
+	switch strings.ToUpper(providerType) {
+	case "SAML":
+		return "saml", nil
+	case "OIDC":
+		return "oidc", nil
+	}
+	return "", fmt.Errorf("%w: identity provider type %s", ErrUnsupported, providerType)
+}
+
+// identityProviderConfig translates Cognito style provider details to a Keycloak identity
+// provider config. SAML metadata is imported by Keycloak; OIDC endpoints are discovered from
+// the issuer. Details that are not Cognito keys are passed through as Keycloak settings.
+func (p *Provider) identityProviderConfig(ctx context.Context, providerID string, details map[string]string) (map[string]string, error) {
+	config := map[string]string{}
+	for k, v := range details {
+		config[k] = v
+	}
+
+	switch providerID {
+	case "saml":
+		var imported map[string]string
+		var err error
+		if metadataURL := details["MetadataURL"]; metadataURL != "" {
+			imported, err = p.importConfig(ctx, map[string]string{"providerId": "saml", "fromUrl": metadataURL})
+		} else if metadata := details["MetadataFile"]; metadata != "" {
+			imported, err = p.importMetadataFile(ctx, metadata)
+		}
+		if err != nil {
+			return nil, err
+		}
+		delete(config, "MetadataURL")
+		delete(config, "MetadataFile")
+		for k, v := range imported {
+			config[k] = v
+		}
+
+	case "oidc":
+		if issuer := details["oidc_issuer"]; issuer != "" {
+			discovery, err := discover(ctx, p.httpClient, issuer)
+			if err != nil {
+				return nil, err
+			}
+			config["issuer"] = discovery.Issuer
+			config["authorizationUrl"] = discovery.AuthorizationEndpoint
+			config["tokenUrl"] = discovery.TokenEndpoint
+			config["userInfoUrl"] = discovery.UserinfoEndpoint
+			config["jwksUrl"] = discovery.JWKSURI
+			config["useJwksUrl"] = "true"
+			config["validateSignature"] = "true"
+		}
+		renames := map[string]string{
+			"client_id":        "clientId",
+			"client_secret":    "clientSecret",
+			"authorize_scopes": "defaultScope",
+		}
+		for from, to := range renames {
+			if v, ok := config[from]; ok {
+				config[to] = v
+				delete(config, from)
+			}
+		}
+		if config["clientSecret"] != "" {
+			config["clientAuthMethod"] = "client_secret_post"
+		}
+		delete(config, "oidc_issuer")
+		delete(config, "attributes_request_method")
+	}
+	return config, nil
+}
+
+// importConfig has Keycloak read an identity provider's metadata.
+// Docs: https://www.keycloak.org/docs-api/latest/rest-api/index.html#_post_adminrealmsrealmidentity_providerimport_config
+func (p *Provider) importConfig(ctx context.Context, req map[string]string) (map[string]string, error) {
+	var config map[string]string
+	if err := p.adminJSON(ctx, http.MethodPost, "/identity-provider/import-config", req, &config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// importMetadataFile uploads SAML metadata XML to the import endpoint.
+func (p *Provider) importMetadataFile(ctx context.Context, metadata string) (map[string]string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	_ = form.WriteField("providerId", "saml")
+	file, err := form.CreateFormFile("file", "metadata.xml")
+	if err != nil {
+		return nil, fmt.Errorf("failed to build metadata upload: %w", err)
+	}
+	if _, err := io.WriteString(file, metadata); err != nil {
+		return nil, fmt.Errorf("failed to build metadata upload: %w", err)
+	}
+	if err := form.Close(); err != nil {
+		return nil, fmt.Errorf("failed to build metadata upload: %w", err)
+	}
+
+	_, respBody, err := p.adminRequest(ctx, http.MethodPost, "/identity-provider/import-config", &body, form.FormDataContentType())
+	if err != nil {
+		return nil, err
+	}
+	var config map[string]string
+	if err := json.Unmarshal(respBody, &config); err != nil {
+		return nil, fmt.Errorf("failed to decode imported metadata: %w", err)
+	}
+	return config, nil
+}
+
+// setAttributeMapping replaces the attribute mappers Shield manages for an identity provider.
+func (p *Provider) setAttributeMapping(ctx context.Context, alias, providerID string, mapping map[string]string) error {
+	var mappers []mapperRepresentation
+	if err := p.adminJSON(ctx, http.MethodGet, identityProviderResource(alias, "mappers"), nil, &mappers); err != nil {
+		return err
+	}
+
+	existing := map[string]mapperRepresentation{}
+	for _, m := range mappers {
+		if !strings.HasPrefix(m.Name, mapperPrefix) {
+			continue
+		}
+		if _, ok := mapping[m.Config["user.attribute"]]; !ok {
+			if err := p.adminJSON(ctx, http.MethodDelete, identityProviderResource(alias, "mappers", url.PathEscape(m.ID)), nil, nil); err != nil {
+				return err
+			}
+			continue
+		}
+		existing[m.Config["user.attribute"]] = m
+	}
+
+	for attribute, claim := range mapping {
+		m := mapperRepresentation{
+			Name:                  mapperPrefix + attribute,
+			IdentityProviderAlias: alias,
+			Config:                map[string]string{"user.attribute": attribute, "syncMode": "INHERIT"},
+		}
+		if providerID == "saml" {
+			m.IdentityProviderMapper = "saml-user-attribute-idp-mapper"
+			m.Config["attribute.name"] = claim
+		} else {
+			m.IdentityProviderMapper = "oidc-user-attribute-idp-mapper"
+			m.Config["claim"] = claim
+		}
+
+		var err error
+		if current, ok := existing[attribute]; ok {
+			m.ID = current.ID
+			err = p.adminJSON(ctx, http.MethodPut, identityProviderResource(alias, "mappers", url.PathEscape(m.ID)), m, nil)
+		} else {
+			err = p.adminJSON(ctx, http.MethodPost, identityProviderResource(alias, "mappers"), m, nil)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateIdentityProvider registers a SAML or OIDC identity provider with the realm.
+// IdpIdentifiers only apply to Cognito's hosted UI and are ignored.
+func (p *Provider) CreateIdentityProvider(ctx context.Context, req authprovider.CreateIdentityProviderRequestData) (*authprovider.CreateIdentityProviderOutputData, error) {
+	providerID, err := keycloakProviderID(req.ProviderType)
+	if err != nil {
+		return nil, err
+	}
+	config, err := p.identityProviderConfig(ctx, providerID, req.ProviderDetails)
+	if err != nil {
+		return nil, err
+	}
+
+	idp := identityProviderRepresentation{Alias: req.ProviderName, ProviderID: providerID, Enabled: true, Config: config}
+	if err := p.adminJSON(ctx, http.MethodPost, "/identity-provider/instances", idp, nil); err != nil {
+		if errors.Is(err, ErrUserExists) {
+			return nil, fmt.Errorf("oidc provider: identity provider %s already exists", req.ProviderName)
+		}
+		return nil, err
+	}
+	if len(req.AttributeMapping) > 0 {
+		if err := p.setAttributeMapping(ctx, req.ProviderName, providerID, req.AttributeMapping); err != nil {
+			return nil, err
+		}
+	}
+
+	described, err := p.DescribeIdentityProvider(ctx, req.ProviderName)
+	if err != nil {
+		return nil, err
+	}
+	return &authprovider.CreateIdentityProviderOutputData{IdentityProvider: described.IdentityProvider}, nil
+}
+
+// UpdateIdentityProvider updates a registered identity provider. Nil or empty fields are left unchanged.
+func (p *Provider) UpdateIdentityProvider(ctx context.Context, req authprovider.UpdateIdentityProviderRequestData) (*authprovider.UpdateIdentityProviderOutputData, error) {
+	var idp identityProviderRepresentation
+	if err := p.adminJSON(ctx, http.MethodGet, identityProviderResource(req.ProviderName), nil, &idp); err != nil {
+		return nil, err
+	}
+
+	if len(req.ProviderDetails) > 0 {
+		config, err := p.identityProviderConfig(ctx, idp.ProviderID, req.ProviderDetails)
+		if err != nil {
+			return nil, err
+		}
+		if idp.Config == nil {
+			idp.Config = map[string]string{}
+		}
+		for k, v := range config {
+			idp.Config[k] = v
+		}
+		if err := p.adminJSON(ctx, http.MethodPut, identityProviderResource(req.ProviderName), idp, nil); err != nil {
+			return nil, err
+		}
+	}
+	if req.AttributeMapping != nil {
+		if err := p.setAttributeMapping(ctx, req.ProviderName, idp.ProviderID, req.AttributeMapping); err != nil {
+			return nil, err
+		}
+	}
+
+	described, err := p.DescribeIdentityProvider(ctx, req.ProviderName)
+	if err != nil {
+		return nil, err
+	}
+	return &authprovider.UpdateIdentityProviderOutputData{IdentityProvider: described.IdentityProvider}, nil
+}
+
+// DescribeIdentityProvider returns a registered identity provider with its Keycloak config as
+// the provider details and the mappers' attributes as the attribute mapping.
+func (p *Provider) DescribeIdentityProvider(ctx context.Context, providerName string) (*authprovider.DescribeIdentityProviderOutputData, error) {
+	var idp identityProviderRepresentation
+	if err := p.adminJSON(ctx, http.MethodGet, identityProviderResource(providerName), nil, &idp); err != nil {
+		return nil, err
+	}
+	var mappers []mapperRepresentation
+	if err := p.adminJSON(ctx, http.MethodGet, identityProviderResource(providerName, "mappers"), nil, &mappers); err != nil {
+		return nil, err
+	}
+
+	mapping := map[string]string{}
+	for _, m := range mappers {
+		attribute := m.Config["user.attribute"]
+		if claim := m.Config["claim"] + m.Config["attribute.name"]; attribute != "" && claim != "" {
+			mapping[attribute] = claim
+		}
+	}
+
+	return &authprovider.DescribeIdentityProviderOutputData{
+		IdentityProvider: &authprovider.IdentityProvider{
+			ProviderName:     idp.Alias,
+			ProviderType:     strings.ToUpper(idp.ProviderID),
+			ProviderDetails:  idp.Config,
+			AttributeMapping: mapping,
+		},
+	}, nil
+}
+
+// DeleteIdentityProvider removes an identity provider and its mappers.
+func (p *Provider) DeleteIdentityProvider(ctx context.Context, providerName string) error {
+	return p.adminJSON(ctx, http.MethodDelete, identityProviderResource(providerName), nil, nil)
+}
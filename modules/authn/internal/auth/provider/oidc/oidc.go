@@ -0,0 +1,395 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	appConfig "shield/cmd/app/config"
+	authprovider "shield/modules/authn/internal/auth/provider"
+	"shield/modules/authn/internal/auth/token"
+	"shield/modules/authn/internal/models"
+)
+
+// Errors for OIDC provider failures that have no provider-neutral equivalent
+var (
+	ErrUserExists  = errors.New("oidc provider: user already exists")
+	ErrUnsupported = errors.New("oidc provider: operation not supported")
+)
+
+// Discovery is the part of the OpenID Provider Metadata the provider uses.
+// Docs: https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderMetadata
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	RevocationEndpoint    string `json:"revocation_endpoint"`
+}
+
+// Provider is an AuthProvider for Keycloak and other OpenID Connect providers. Logins use the
+// resource owner password grant and refreshes the refresh_token grant, so the client needs direct
+// access grants. Shield keeps the refresh token issued at login: Keycloak's "Revoke Refresh Token"
+// realm setting must stay off. User and identity provider management use the Keycloak admin API
+// with a client_credentials token of the same client; they fail with ErrUnsupported when no
+// admin URL is configured. Email verification and password resets go through the links Keycloak
+// emails, so the code-based confirmation methods and MFA challenges are not supported.
+type Provider struct {
+	config     appConfig.OIDCProviderConfig
+	discovery  Discovery
+	httpClient *http.Client
+
+	adminMutex       sync.Mutex
+	adminToken       string
+	adminTokenExpiry time.Time
+	now              func() time.Time
+}
+
+// NewProvider creates a new OIDC provider. Endpoints are read from the issuer's discovery
+// document, so the provider must be reachable. A default HTTP client is used when httpClient is nil.
+func NewProvider(ctx context.Context, cfg appConfig.OIDCProviderConfig, httpClient *http.Client) (*Provider, error) {
+	if cfg.IssuerURL == "" || cfg.ClientID == "" {
+		return nil, fmt.Errorf("oidc provider requires issuerUrl and clientId")
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	cfg.AdminURL = strings.TrimRight(cfg.AdminURL, "/")
+
+	discovery, err := discover(ctx, httpClient, cfg.IssuerURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Provider{
+		config:     cfg,
+		discovery:  *discovery,
+		httpClient: httpClient,
+		now:        time.Now,
+	}, nil
+}
+
+// discover fetches the discovery document of issuer and checks that it describes that issuer.
+func discover(ctx context.Context, httpClient *http.Client, issuer string) (*Discovery, error) {
+	issuer = strings.TrimRight(issuer, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build discovery request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("discovery request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discovery of %s returned status %d", issuer, resp.StatusCode)
+	}
+
+	var discovery Discovery
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&discovery); err != nil {
+		return nil, fmt.Errorf("failed to decode discovery document: %w", err)
+	}
+	if strings.TrimRight(discovery.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("discovery document of %s is for issuer %q", issuer, discovery.Issuer)
+	}
+	if discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery document of %s has no token endpoint or jwks_uri", issuer)
+	}
+	return &discovery, nil
+}
+
+// Issuer returns the iss claim of tokens issued by the provider.
+func (p *Provider) Issuer() string {
+	return p.discovery.Issuer
+}
+
+// ClientID returns the client tokens are issued to.
+func (p *Provider) ClientID() string {
+	return p.config.ClientID
+}
+
+// JWKSURL returns the location of the provider's signing keys.
+func (p *Provider) JWKSURL() string {
+	return p.discovery.JWKSURI
+}
+
+// tokenResponse is the token endpoint response
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	IDToken      string `json:"id_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	TokenType    string `json:"token_type"`
+}
+
+// errorResponse is the OAuth2 error response body (RFC 6749 section 5.2). The Keycloak admin
+// API uses the same shape for validation errors and errorMessage for others.
+type errorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+	ErrorMessage     string `json:"errorMessage"`
+}
+
+// mapError converts an error response to the provider-neutral errors where one applies.
+func mapError(operation string, status int, body []byte) error {
+	var resp errorResponse
+	_ = json.Unmarshal(body, &resp)
+	detail := resp.ErrorDescription
+	if detail == "" {
+		detail = resp.ErrorMessage
+	}
+	if detail == "" {
+		detail = resp.Error
+	}
+
+	switch {
+	case resp.Error == "invalid_grant" || resp.Error == "invalid_token":
+		return fmt.Errorf("%w: %s", authprovider.ErrNotAuthorized, detail)
+	case strings.HasPrefix(resp.Error, "invalidPassword"):
+		return fmt.Errorf("%w: %s", authprovider.ErrInvalidPassword, detail)
+	case status == http.StatusConflict:
+		return fmt.Errorf("%w: %s", ErrUserExists, detail)
+	case status == http.StatusNotFound:
+		return fmt.Errorf("%w: %s", authprovider.ErrNotFound, detail)
+	case status == http.StatusUnauthorized:
+		return fmt.Errorf("%w: %s", authprovider.ErrNotAuthorized, detail)
+	}
+	if detail != "" {
+		return fmt.Errorf("%s returned status %d: %s", operation, status, detail)
+	}
+	return fmt.Errorf("%s returned status %d", operation, status)
+}
+
+// do sends req and returns the response status, headers and body.
+func (p *Provider) do(req *http.Request) (int, http.Header, []byte, error) {
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return resp.StatusCode, resp.Header, body, nil
+}
+
+// postForm sends a client-authenticated form to one of the OAuth2 endpoints.
+func (p *Provider) postForm(ctx context.Context, endpoint string, form url.Values) (int, []byte, error) {
+	if p.config.ClientSecret == "" {
+		form.Set("client_id", p.config.ClientID) // Public client
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	status, _, body, err := p.do(req)
+	return status, body, err
+}
+
+// tokenRequest runs a grant against the token endpoint.
+// Docs: https://www.rfc-editor.org/rfc/rfc6749#section-5
+func (p *Provider) tokenRequest(ctx context.Context, form url.Values) (*tokenResponse, error) {
+	status, body, err := p.postForm(ctx, p.discovery.TokenEndpoint, form)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	if status != http.StatusOK {
+		return nil, mapError("token endpoint", status, body)
+	}
+
+	var tokens tokenResponse
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if tokens.AccessToken == "" {
+		return nil, fmt.Errorf("token response did not include an access_token")
+	}
+	return &tokens, nil
+}
+
+// passwordGrant exchanges a username and password for tokens.
+func (p *Provider) passwordGrant(ctx context.Context, username, password string) (*tokenResponse, error) {
+	form := url.Values{}
+	form.Set("grant_type", "password")
+	form.Set("username", username)
+	form.Set("password", password)
+	form.Set("scope", strings.Join(p.config.Scopes, " "))
+	return p.tokenRequest(ctx, form)
+}
+
+// Authenticate authenticates a user with the resource owner password grant.
+// Users with pending required actions (e.g. a temporary password) are rejected by the provider.
+func (p *Provider) Authenticate(ctx context.Context, req authprovider.AuthenticateRequestData) (*authprovider.AuthenticateOutputData, error) {
+	tokens, err := p.passwordGrant(ctx, req.Username, req.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := token.UnverifiedClaims(tokens.AccessToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read access token: %w", err)
+	}
+	return &authprovider.AuthenticateOutputData{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    tokens.ExpiresIn,
+		UserSub:      claims.Subject,
+		Username:     claims.Username,
+	}, nil
+}
+
+// RespondToAuthChallenge is not supported; the password grant does not return challenges.
+func (p *Provider) RespondToAuthChallenge(context.Context, authprovider.RespondToAuthChallengeRequestData) (*authprovider.AuthenticateOutputData, error) {
+	return nil, fmt.Errorf("%w: authentication challenges", ErrUnsupported)
+}
+
+// RefreshToken issues a new access token with the refresh_token grant.
+func (p *Provider) RefreshToken(ctx context.Context, req authprovider.RefreshTokenRequestData) (*authprovider.RefreshTokenOutputData, error) {
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", req.RefreshToken)
+
+	tokens, err := p.tokenRequest(ctx, form)
+	if err != nil {
+		return nil, err
+	}
+	return &authprovider.RefreshTokenOutputData{
+		AccessToken: tokens.AccessToken,
+		ExpiresIn:   tokens.ExpiresIn,
+	}, nil
+}
+
+// RevokeToken revokes a refresh token, which ends its provider session.
+// Docs: https://www.rfc-editor.org/rfc/rfc7009#section-2.1
+func (p *Provider) RevokeToken(ctx context.Context, refreshToken string) error {
+	if p.discovery.RevocationEndpoint == "" {
+		return fmt.Errorf("%w: the provider has no revocation endpoint", ErrUnsupported)
+	}
+	form := url.Values{}
+	form.Set("token", refreshToken)
+	form.Set("token_type_hint", "refresh_token")
+
+	status, body, err := p.postForm(ctx, p.discovery.RevocationEndpoint, form)
+	if err != nil {
+		return fmt.Errorf("revocation request failed: %w", err)
+	}
+	if status != http.StatusOK {
+		return mapError("revocation endpoint", status, body)
+	}
+	return nil
+}
+
+// userInfo is the UserInfo response
+type userInfo struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+// GetUser returns the user an access token was issued to.
+// Docs: https://openid.net/specs/openid-connect-core-1_0.html#UserInfo
+func (p *Provider) GetUser(ctx context.Context, accessToken string) (*authprovider.GetUserOutputData, error) {
+	info, err := p.userInfo(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	return &authprovider.GetUserOutputData{
+		User: &models.User{
+			Email:      info.Email,
+			CognitoSub: info.Subject,
+			IsVerified: info.EmailVerified,
+		},
+		Username: info.PreferredUsername,
+	}, nil
+}
+
+func (p *Provider) userInfo(ctx context.Context, accessToken string) (*userInfo, error) {
+	if p.discovery.UserinfoEndpoint == "" {
+		return nil, fmt.Errorf("%w: the provider has no userinfo endpoint", ErrUnsupported)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.discovery.UserinfoEndpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build userinfo request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	status, _, body, err := p.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("userinfo request failed: %w", err)
+	}
+	if status != http.StatusOK {
+		return nil, mapError("userinfo endpoint", status, body)
+	}
+
+	var info userInfo
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, fmt.Errorf("failed to decode userinfo response: %w", err)
+	}
+	if info.Subject == "" {
+		return nil, fmt.Errorf("userinfo response did not include sub")
+	}
+	return &info, nil
+}
+
+// ChangePassword checks the user's current password with a password grant and sets the new one
+// through the admin API. The session opened by the check is revoked again.
+func (p *Provider) ChangePassword(ctx context.Context, req authprovider.ChangePasswordRequestData) error {
+	info, err := p.userInfo(ctx, req.AccessToken)
+	if err != nil {
+		return err
+	}
+
+	check, err := p.passwordGrant(ctx, info.PreferredUsername, req.PreviousPassword)
+	if err != nil {
+		return err
+	}
+	if check.RefreshToken != "" {
+		if err := p.RevokeToken(ctx, check.RefreshToken); err != nil {
+			log.Printf("OIDC provider: failed to revoke password check session: %v", err)
+		}
+	}
+
+	return p.setPassword(ctx, info.Subject, req.ProposedPassword, false)
+}
+
+// AssociateSoftwareToken is not supported; use Shield's local MFA with this provider.
+func (p *Provider) AssociateSoftwareToken(context.Context, authprovider.AssociateSoftwareTokenRequestData) (*authprovider.AssociateSoftwareTokenOutputData, error) {
+	return nil, fmt.Errorf("%w: provider MFA", ErrUnsupported)
+}
+
+// VerifySoftwareToken is not supported; use Shield's local MFA with this provider.
+func (p *Provider) VerifySoftwareToken(context.Context, authprovider.VerifySoftwareTokenRequestData) (*authprovider.VerifySoftwareTokenOutputData, error) {
+	return nil, fmt.Errorf("%w: provider MFA", ErrUnsupported)
+}
+
+// SetMFAPreference is not supported; use Shield's local MFA with this provider.
+func (p *Provider) SetMFAPreference(context.Context, authprovider.SetMFAPreferenceRequestData) error {
+	return fmt.Errorf("%w: provider MFA", ErrUnsupported)
+}
+
+var _ authprovider.AuthProvider = (*Provider)(nil)
@@ -0,0 +1,541 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	appConfig "shield/cmd/app/config"
+	authprovider "shield/modules/authn/internal/auth/provider"
+)
+
+const (
+	testClientID     = "shield"
+	testClientSecret = "secret"
+)
+
+// stubUser is a user held by the stub server
+type stubUser struct {
+	userRepresentation
+	password string
+	sessions map[string]bool // Refresh tokens
+}
+
+// stubServer is a minimal Keycloak realm: discovery, token, revocation and userinfo endpoints and
+// the admin API routes used by the provider
+type stubServer struct {
+	*httptest.Server
+	t *testing.T
+
+	mu           sync.Mutex
+	users        map[string]*stubUser // By ID
+	idps         map[string]identityProviderRepresentation
+	mappers      map[string][]mapperRepresentation
+	emailActions map[string][]string // User ID -> actions of the last email
+	adminTokens  int
+}
+
+func newStubServer(t *testing.T) *stubServer {
+	t.Helper()
+	s := &stubServer{
+		t:            t,
+		users:        map[string]*stubUser{},
+		idps:         map[string]identityProviderRepresentation{},
+		mappers:      map[string][]mapperRepresentation{},
+		emailActions: map[string][]string{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /realms/shield/.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("POST /realms/shield/protocol/openid-connect/token", s.token)
+	mux.HandleFunc("POST /realms/shield/protocol/openid-connect/revoke", s.revoke)
+	mux.HandleFunc("GET /realms/shield/protocol/openid-connect/userinfo", s.userinfo)
+	mux.HandleFunc("/admin/realms/shield/", s.admin)
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *stubServer) issuer() string {
+	return s.URL + "/realms/shield"
+}
+
+func (s *stubServer) discovery(w http.ResponseWriter, _ *http.Request) {
+	base := s.issuer() + "/protocol/openid-connect"
+	writeJSON(w, http.StatusOK, Discovery{
+		Issuer:                s.issuer(),
+		AuthorizationEndpoint: base + "/auth",
+		TokenEndpoint:         base + "/token",
+		UserinfoEndpoint:      base + "/userinfo",
+		JWKSURI:               base + "/certs",
+		RevocationEndpoint:    base + "/revoke",
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (s *stubServer) accessToken(u *stubUser, sid string) string {
+	raw, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss": s.issuer(), "sub": u.ID, "azp": testClientID, "typ": "Bearer", "sid": sid,
+		"preferred_username": u.Username, "exp": time.Now().Add(5 * time.Minute).Unix(),
+	}).SignedString([]byte("stub"))
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return raw
+}
+
+func (s *stubServer) token(w http.ResponseWriter, r *http.Request) {
+	if id, secret, ok := r.BasicAuth(); !ok || id != testClientID || secret != testClientSecret {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized_client"})
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.PostFormValue("grant_type") {
+	case "client_credentials":
+		s.adminTokens++
+		writeJSON(w, http.StatusOK, tokenResponse{AccessToken: "admin-token", ExpiresIn: 300})
+	case "password":
+		for _, u := range s.users {
+			if u.Username != r.PostFormValue("username") || u.password != r.PostFormValue("password") {
+				continue
+			}
+			if len(u.RequiredActions) > 0 {
+				break
+			}
+			refresh := "refresh-" + u.ID + "-" + time.Now().Format(time.RFC3339Nano)
+			u.sessions[refresh] = true
+			writeJSON(w, http.StatusOK, tokenResponse{AccessToken: s.accessToken(u, refresh), RefreshToken: refresh, ExpiresIn: 300})
+			return
+		}
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "invalid_grant", ErrorDescription: "Invalid user credentials"})
+	case "refresh_token":
+		for _, u := range s.users {
+			if u.sessions[r.PostFormValue("refresh_token")] {
+				writeJSON(w, http.StatusOK, tokenResponse{AccessToken: s.accessToken(u, r.PostFormValue("refresh_token")), ExpiresIn: 300})
+				return
+			}
+		}
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_grant", ErrorDescription: "Session not active"})
+	default:
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "unsupported_grant_type"})
+	}
+}
+
+func (s *stubServer) revoke(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		delete(u.sessions, r.PostFormValue("token"))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *stubServer) userinfo(w http.ResponseWriter, r *http.Request) {
+	claims := jwt.MapClaims{}
+	_, _, err := jwt.NewParser().ParseUnverified(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), claims)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[claims["sub"].(string)]
+	if err != nil || !ok {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "invalid_token"})
+		return
+	}
+	writeJSON(w, http.StatusOK, userInfo{Subject: u.ID, Email: u.Email, EmailVerified: u.EmailVerified, PreferredUsername: u.Username})
+}
+
+func (s *stubServer) admin(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer admin-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/admin/realms/shield/"), "/")
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/admin/realms/shield/users":
+		var u stubUser
+		_ = json.NewDecoder(r.Body).Decode(&u.userRepresentation)
+		for _, existing := range s.users {
+			if existing.Username == u.Username {
+				writeJSON(w, http.StatusConflict, errorResponse{ErrorMessage: "User exists with same username"})
+				return
+			}
+		}
+		if len(u.Credentials) > 0 && len(u.Credentials[0].Value) < 8 {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalidPasswordMinLengthMessage", ErrorDescription: "Invalid password: minimum length 8."})
+			return
+		}
+		u.ID = "user-" + u.Username
+		u.password = u.Credentials[0].Value
+		u.Credentials = nil
+		u.sessions = map[string]bool{}
+		s.users[u.ID] = &u
+		w.Header().Set("Location", s.URL+"/admin/realms/shield/users/"+u.ID)
+		w.WriteHeader(http.StatusCreated)
+
+	case r.Method == http.MethodGet && r.URL.Path == "/admin/realms/shield/users":
+		found := []userRepresentation{}
+		for _, u := range s.users {
+			if u.Username == r.URL.Query().Get("username") {
+				found = append(found, u.userRepresentation)
+			}
+		}
+		writeJSON(w, http.StatusOK, found)
+
+	case r.Method == http.MethodDelete && parts[0] == "users" && len(parts) == 2:
+		if _, ok := s.users[parts[1]]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(s.users, parts[1])
+		w.WriteHeader(http.StatusNoContent)
+
+	case parts[0] == "users" && len(parts) == 3:
+		u, ok := s.users[parts[1]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch parts[2] {
+		case "reset-password":
+			var credential credentialRepresentation
+			_ = json.NewDecoder(r.Body).Decode(&credential)
+			u.password = credential.Value
+		case "execute-actions-email":
+			var actions []string
+			_ = json.NewDecoder(r.Body).Decode(&actions)
+			s.emailActions[u.ID] = actions
+		case "logout":
+			u.sessions = map[string]bool{}
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.URL.Path == "/admin/realms/shield/identity-provider/import-config":
+		var req map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		writeJSON(w, http.StatusOK, map[string]string{"singleSignOnServiceUrl": req["fromUrl"] + "/sso", "validateSignature": "true"})
+
+	case r.Method == http.MethodPost && r.URL.Path == "/admin/realms/shield/identity-provider/instances":
+		var idp identityProviderRepresentation
+		_ = json.NewDecoder(r.Body).Decode(&idp)
+		if _, ok := s.idps[idp.Alias]; ok {
+			writeJSON(w, http.StatusConflict, errorResponse{ErrorMessage: "Identity Provider already exists"})
+			return
+		}
+		s.idps[idp.Alias] = idp
+		w.WriteHeader(http.StatusCreated)
+
+	case parts[0] == "identity-provider" && len(parts) >= 3:
+		alias := parts[2]
+		idp, ok := s.idps[alias]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch {
+		case len(parts) == 3 && r.Method == http.MethodGet:
+			writeJSON(w, http.StatusOK, idp)
+		case len(parts) == 3 && r.Method == http.MethodPut:
+			_ = json.NewDecoder(r.Body).Decode(&idp)
+			s.idps[alias] = idp
+			w.WriteHeader(http.StatusNoContent)
+		case len(parts) == 3 && r.Method == http.MethodDelete:
+			delete(s.idps, alias)
+			delete(s.mappers, alias)
+			w.WriteHeader(http.StatusNoContent)
+		case len(parts) == 4 && r.Method == http.MethodGet:
+			writeJSON(w, http.StatusOK, append([]mapperRepresentation{}, s.mappers[alias]...))
+		case len(parts) == 4 && r.Method == http.MethodPost:
+			var m mapperRepresentation
+			_ = json.NewDecoder(r.Body).Decode(&m)
+			m.ID = m.Name
+			s.mappers[alias] = append(s.mappers[alias], m)
+			w.WriteHeader(http.StatusCreated)
+		case len(parts) == 5:
+			var kept []mapperRepresentation
+			for _, m := range s.mappers[alias] {
+				if m.ID == parts[4] {
+					if r.Method == http.MethodDelete {
+						continue
+					}
+					_ = json.NewDecoder(r.Body).Decode(&m)
+				}
+				kept = append(kept, m)
+			}
+			s.mappers[alias] = kept
+			w.WriteHeader(http.StatusNoContent)
+		}
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestProvider(t *testing.T, verifyEmail bool) (*Provider, *stubServer) {
+	t.Helper()
+	server := newStubServer(t)
+	p, err := NewProvider(context.Background(), appConfig.OIDCProviderConfig{
+		IssuerURL:    server.issuer() + "/",
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		AdminURL:     server.URL + "/admin/realms/shield",
+		VerifyEmail:  verifyEmail,
+	}, server.Client())
+	if err != nil {
+		t.Fatalf("NewProvider() error = %v", err)
+	}
+	return p, server
+}
+
+func TestDiscovery(t *testing.T) {
+	p, server := newTestProvider(t, false)
+	if p.Issuer() != server.issuer() || p.JWKSURL() != server.issuer()+"/protocol/openid-connect/certs" {
+		t.Errorf("discovered issuer, jwks = %s, %s; want the stub realm", p.Issuer(), p.JWKSURL())
+	}
+
+	// The discovery document must be for the configured issuer
+	_, err := NewProvider(context.Background(), appConfig.OIDCProviderConfig{IssuerURL: server.URL + "/realms/other", ClientID: testClientID}, server.Client())
+	if err == nil {
+		t.Error("NewProvider() with unknown realm succeeded, want error")
+	}
+}
+
+func TestSignupLoginRefreshRevoke(t *testing.T) {
+	p, server := newTestProvider(t, false)
+	ctx := context.Background()
+
+	signup, err := p.SignUp(ctx, authprovider.SignUpRequestData{
+		Username: "user@example.com", Email: "user@example.com", Password: "password",
+		UserAttributes: []authprovider.UserAttribute{{Name: "given_name", Value: "Ada"}, {Name: "custom:org_id", Value: "org-1"}},
+	})
+	if err != nil {
+		t.Fatalf("SignUp() error = %v", err)
+	}
+	if signup.UserSub != "user-user@example.com" || !signup.UserConfirmed {
+		t.Errorf("SignUp() = %+v, want a confirmed user with the ID from Location", signup)
+	}
+	if u := server.users[signup.UserSub]; u.FirstName != "Ada" || u.Attributes["org_id"][0] != "org-1" {
+		t.Errorf("created user = %+v, want first name and org_id attribute", u.userRepresentation)
+	}
+	if _, err := p.SignUp(ctx, authprovider.SignUpRequestData{Username: "user@example.com", Password: "password"}); !errors.Is(err, ErrUserExists) {
+		t.Errorf("duplicate SignUp() error = %v, want ErrUserExists", err)
+	}
+	if _, err := p.SignUp(ctx, authprovider.SignUpRequestData{Username: "short@example.com", Password: "short"}); !errors.Is(err, authprovider.ErrInvalidPassword) {
+		t.Errorf("SignUp() with short password error = %v, want ErrInvalidPassword", err)
+	}
+
+	if _, err := p.Authenticate(ctx, authprovider.AuthenticateRequestData{Username: "user@example.com", Password: "wrong-password"}); !errors.Is(err, authprovider.ErrNotAuthorized) {
+		t.Errorf("Authenticate() with wrong password error = %v, want ErrNotAuthorized", err)
+	}
+	login, err := p.Authenticate(ctx, authprovider.AuthenticateRequestData{Username: "user@example.com", Password: "password"})
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if login.UserSub != signup.UserSub || login.Username != "user@example.com" || login.RefreshToken == "" {
+		t.Errorf("Authenticate() = %+v, want tokens for %s", login, signup.UserSub)
+	}
+
+	user, err := p.GetUser(ctx, login.AccessToken)
+	if err != nil || user.User.CognitoSub != signup.UserSub || user.User.Email != "user@example.com" {
+		t.Errorf("GetUser() = %+v, %v; want the signed-up user", user, err)
+	}
+
+	if _, err := p.RefreshToken(ctx, authprovider.RefreshTokenRequestData{RefreshToken: login.RefreshToken}); err != nil {
+		t.Fatalf("RefreshToken() error = %v", err)
+	}
+	if err := p.RevokeToken(ctx, login.RefreshToken); err != nil {
+		t.Fatalf("RevokeToken() error = %v", err)
+	}
+	if _, err := p.RefreshToken(ctx, authprovider.RefreshTokenRequestData{RefreshToken: login.RefreshToken}); !errors.Is(err, authprovider.ErrNotAuthorized) {
+		t.Errorf("RefreshToken() after RevokeToken error = %v, want ErrNotAuthorized", err)
+	}
+
+	login, _ = p.Authenticate(ctx, authprovider.AuthenticateRequestData{Username: "user@example.com", Password: "password"})
+	if err := p.GlobalSignOut(ctx, signup.UserSub); err != nil {
+		t.Fatalf("GlobalSignOut() error = %v", err)
+	}
+	if _, err := p.RefreshToken(ctx, authprovider.RefreshTokenRequestData{RefreshToken: login.RefreshToken}); !errors.Is(err, authprovider.ErrNotAuthorized) {
+		t.Errorf("RefreshToken() after GlobalSignOut error = %v, want ErrNotAuthorized", err)
+	}
+
+	if err := p.AdminDeleteUser(ctx, "user@example.com"); err != nil {
+		t.Fatalf("AdminDeleteUser() error = %v", err)
+	}
+	if err := p.AdminDeleteUser(ctx, "user@example.com"); !errors.Is(err, authprovider.ErrUserNotFound) {
+		t.Errorf("second AdminDeleteUser() error = %v, want ErrUserNotFound", err)
+	}
+
+	if server.adminTokens != 1 {
+		t.Errorf("admin tokens requested %d times, want 1 cached token", server.adminTokens)
+	}
+}
+
+func TestVerifyEmailSignup(t *testing.T) {
+	p, server := newTestProvider(t, true)
+	ctx := context.Background()
+
+	signup, err := p.SignUp(ctx, authprovider.SignUpRequestData{Username: "user@example.com", Email: "user@example.com", Password: "password"})
+	if err != nil {
+		t.Fatalf("SignUp() error = %v", err)
+	}
+	if signup.UserConfirmed || signup.CodeDeliveryDetails == nil || signup.CodeDeliveryDetails.Destination != "user@example.com" {
+		t.Errorf("SignUp() = %+v, want an unconfirmed user with email delivery details", signup)
+	}
+	if actions := server.emailActions[signup.UserSub]; len(actions) != 1 || actions[0] != actionVerifyEmail {
+		t.Errorf("emailed actions = %v, want [%s]", actions, actionVerifyEmail)
+	}
+	if _, err := p.Authenticate(ctx, authprovider.AuthenticateRequestData{Username: "user@example.com", Password: "password"}); !errors.Is(err, authprovider.ErrNotAuthorized) {
+		t.Errorf("Authenticate() before verification error = %v, want ErrNotAuthorized", err)
+	}
+	if _, err := p.ConfirmSignUp(ctx, authprovider.ConfirmSignUpRequestData{Username: "user@example.com", ConfirmationCode: "123456"}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("ConfirmSignUp() error = %v, want ErrUnsupported", err)
+	}
+	if _, err := p.ResendConfirmationCode(ctx, authprovider.ResendConfirmationCodeRequestData{Username: "nobody@example.com"}); !errors.Is(err, authprovider.ErrUserNotFound) {
+		t.Errorf("ResendConfirmationCode() for unknown user error = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestPasswords(t *testing.T) {
+	p, server := newTestProvider(t, false)
+	ctx := context.Background()
+
+	admin, err := p.AdminCreateUser(ctx, authprovider.AdminCreateUserRequestData{Username: "admin@example.com", Email: "admin@example.com", TemporaryPassword: "temporary"})
+	if err != nil {
+		t.Fatalf("AdminCreateUser() error = %v", err)
+	}
+	if actions := server.emailActions[admin.User.CognitoSub]; len(actions) != 1 || actions[0] != actionUpdatePassword {
+		t.Errorf("emailed actions = %v, want [%s]", actions, actionUpdatePassword)
+	}
+
+	if _, err := p.SignUp(ctx, authprovider.SignUpRequestData{Username: "user@example.com", Password: "password"}); err != nil {
+		t.Fatalf("SignUp() error = %v", err)
+	}
+	login, err := p.Authenticate(ctx, authprovider.AuthenticateRequestData{Username: "user@example.com", Password: "password"})
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+
+	change := authprovider.ChangePasswordRequestData{AccessToken: login.AccessToken, PreviousPassword: "wrong-password", ProposedPassword: "changed-password"}
+	if err := p.ChangePassword(ctx, change); !errors.Is(err, authprovider.ErrNotAuthorized) {
+		t.Errorf("ChangePassword() with wrong current password error = %v, want ErrNotAuthorized", err)
+	}
+	change.PreviousPassword = "password"
+	if err := p.ChangePassword(ctx, change); err != nil {
+		t.Fatalf("ChangePassword() error = %v", err)
+	}
+	u := server.users["user-user@example.com"]
+	if u.password != "changed-password" || len(u.sessions) != 1 {
+		t.Errorf("after ChangePassword() password = %q with %d sessions, want changed-password and only the login session", u.password, len(u.sessions))
+	}
+
+	if _, err := p.ForgotPassword(ctx, authprovider.ForgotPasswordRequestData{Username: "nobody@example.com"}); !errors.Is(err, authprovider.ErrUserNotFound) {
+		t.Errorf("ForgotPassword() for unknown user error = %v, want ErrUserNotFound", err)
+	}
+	if _, err := p.ForgotPassword(ctx, authprovider.ForgotPasswordRequestData{Username: "user@example.com"}); err != nil {
+		t.Fatalf("ForgotPassword() error = %v", err)
+	}
+	if actions := server.emailActions[u.ID]; len(actions) != 1 || actions[0] != actionUpdatePassword {
+		t.Errorf("emailed actions = %v, want [%s]", actions, actionUpdatePassword)
+	}
+}
+
+func TestIdentityProviders(t *testing.T) {
+	p, server := newTestProvider(t, false)
+	ctx := context.Background()
+
+	created, err := p.CreateIdentityProvider(ctx, authprovider.CreateIdentityProviderRequestData{
+		ProviderName:     "org-1-saml",
+		ProviderType:     "SAML",
+		ProviderDetails:  map[string]string{"MetadataURL": "https://idp.example.com/metadata"},
+		AttributeMapping: map[string]string{"email": "emailaddress", "firstName": "givenname"},
+	})
+	if err != nil {
+		t.Fatalf("CreateIdentityProvider() error = %v", err)
+	}
+	idp := created.IdentityProvider
+	if idp.ProviderType != "SAML" || idp.ProviderDetails["singleSignOnServiceUrl"] != "https://idp.example.com/metadata/sso" || idp.AttributeMapping["email"] != "emailaddress" {
+		t.Errorf("CreateIdentityProvider() = %+v, want imported SAML config and attribute mapping", idp)
+	}
+	if _, ok := idp.ProviderDetails["MetadataURL"]; ok {
+		t.Error("Cognito MetadataURL detail passed through to Keycloak")
+	}
+
+	// Mappers not created by Shield survive a mapping update
+	server.mappers["org-1-saml"] = append(server.mappers["org-1-saml"], mapperRepresentation{
+		ID: "custom", Name: "custom", Config: map[string]string{"user.attribute": "department", "attribute.name": "dept"},
+	})
+	updated, err := p.UpdateIdentityProvider(ctx, authprovider.UpdateIdentityProviderRequestData{
+		ProviderName:     "org-1-saml",
+		AttributeMapping: map[string]string{"email": "mail"},
+	})
+	if err != nil {
+		t.Fatalf("UpdateIdentityProvider() error = %v", err)
+	}
+	want := map[string]string{"email": "mail", "department": "dept"}
+	if got := updated.IdentityProvider.AttributeMapping; len(got) != len(want) || got["email"] != "mail" || got["department"] != "dept" {
+		t.Errorf("UpdateIdentityProvider() mapping = %v, want %v", got, want)
+	}
+
+	if err := p.DeleteIdentityProvider(ctx, "org-1-saml"); err != nil {
+		t.Fatalf("DeleteIdentityProvider() error = %v", err)
+	}
+	if _, err := p.DescribeIdentityProvider(ctx, "org-1-saml"); !errors.Is(err, authprovider.ErrNotFound) {
+		t.Errorf("DescribeIdentityProvider() after delete error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestOIDCIdentityProviderConfig(t *testing.T) {
+	p, server := newTestProvider(t, false)
+
+	// The stub realm stands in for the organization's OIDC provider
+	config, err := p.identityProviderConfig(context.Background(), "oidc", map[string]string{
+		"client_id":        "org-client",
+		"client_secret":    "org-secret",
+		"authorize_scopes": "openid email",
+		"oidc_issuer":      server.issuer(),
+	})
+	if err != nil {
+		t.Fatalf("identityProviderConfig() error = %v", err)
+	}
+	want := map[string]string{
+		"clientId":     "org-client",
+		"clientSecret": "org-secret",
+		"defaultScope": "openid email",
+		"issuer":       server.issuer(),
+		"tokenUrl":     server.issuer() + "/protocol/openid-connect/token",
+	}
+	for k, v := range want {
+		if config[k] != v {
+			t.Errorf("config[%s] = %q, want %q", k, config[k], v)
+		}
+	}
+	if _, ok := config["oidc_issuer"]; ok {
+		t.Error("Cognito oidc_issuer detail passed through to Keycloak")
+	}
+}
+
+func TestAdminAPIRequiresAdminURL(t *testing.T) {
+	server := newStubServer(t)
+	p, err := NewProvider(context.Background(), appConfig.OIDCProviderConfig{IssuerURL: server.issuer(), ClientID: testClientID, ClientSecret: testClientSecret}, server.Client())
+	if err != nil {
+		t.Fatalf("NewProvider() error = %v", err)
+	}
+	if _, err := p.SignUp(context.Background(), authprovider.SignUpRequestData{Username: "user@example.com", Password: "password"}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("SignUp() without admin URL error = %v, want ErrUnsupported", err)
+	}
+}
@@ -2,21 +2,50 @@ package provider
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"shield/modules/authn/internal/models"
+)
 
-	cognitoTypes "github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
+// Errors for provider failures that callers handle specifically. Implementations wrap
+// their native errors with these, so they can be matched with errors.Is.
+var (
+	ErrCodeMismatch    = errors.New("provider: verification code mismatch")
+	ErrCodeExpired     = errors.New("provider: verification code expired")
+	ErrLimitExceeded   = errors.New("provider: attempt limit exceeded")
+	ErrUserNotFound    = errors.New("provider: user not found")
+	ErrInvalidPassword = errors.New("provider: password does not meet the password policy")
+	ErrNotAuthorized   = errors.New("provider: incorrect username or password")
+	ErrNotFound        = errors.New("provider: resource not found")
 )
 
 // --- Request & Response Structs for AuthProvider interface ---
-// These structs are based on Cognito's needs but can be adapted if other providers are added.
+// These structs are provider-neutral; implementations map them to their own API types.
+
+// UserAttribute is a named user attribute, e.g. email or custom:org_id.
+type UserAttribute struct {
+	Name  string
+	Value string
+}
+
+// IdentityProvider is a federated identity provider registered with the auth provider.
+type IdentityProvider struct {
+	ProviderName     string
+	ProviderType     string            // e.g., "SAML", "OIDC"
+	ProviderDetails  map[string]string // Metadata URL, client ID, issuer and similar settings
+	AttributeMapping map[string]string // User attribute -> IdP claim
+	IdpIdentifiers   []string
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
 
 // SignUpRequestData holds data for signing up a user.
 type SignUpRequestData struct {
 	Username       string
 	Password       string
 	Email          string
-	UserAttributes []cognitoTypes.AttributeType // Using Cognito's type for now
+	UserAttributes []UserAttribute
 }
 
 // SignUpOutputData holds data returned after a successful signup.
@@ -50,7 +79,7 @@ type AdminCreateUserRequestData struct {
 	Username          string
 	Email             string
 	TemporaryPassword string
-	UserAttributes    []cognitoTypes.AttributeType
+	UserAttributes    []UserAttribute
 }
 
 // AdminCreateUserOutputData holds data after an admin creates a user.
@@ -60,7 +89,8 @@ type AdminCreateUserOutputData struct {
 
 // GetUserOutputData holds data for a retrieved user.
 type GetUserOutputData struct {
-	User *models.User
+	User     *models.User
+	Username string // Username at the provider, which may differ from the email and the sub
 }
 
 // CreateIdentityProviderRequestData holds data for creating an IdP.
@@ -74,7 +104,26 @@ type CreateIdentityProviderRequestData struct {
 
 // CreateIdentityProviderOutputData holds data after creating an IdP.
 type CreateIdentityProviderOutputData struct {
-	IdentityProvider *cognitoTypes.IdentityProviderType // Using Cognito's type for now
+	IdentityProvider *IdentityProvider
+}
+
+// UpdateIdentityProviderRequestData holds data for updating an IdP.
+// Nil or empty fields are left unchanged by the provider.
+type UpdateIdentityProviderRequestData struct {
+	ProviderName     string
+	ProviderDetails  map[string]string
+	AttributeMapping map[string]string
+	IdpIdentifiers   []string
+}
+
+// UpdateIdentityProviderOutputData holds data after updating an IdP.
+type UpdateIdentityProviderOutputData struct {
+	IdentityProvider *IdentityProvider
+}
+
+// DescribeIdentityProviderOutputData holds the IdP as registered with the provider.
+type DescribeIdentityProviderOutputData struct {
+	IdentityProvider *IdentityProvider
 }
 
 // AuthenticateRequestData holds data for user authentication
@@ -83,17 +132,34 @@ type AuthenticateRequestData struct {
 	Password string
 }
 
-// AuthenticateOutputData holds data returned after successful authentication
+// AuthenticateOutputData holds data returned after an authentication attempt.
+// When the provider requires an additional step (MFA, new password, custom auth),
+// ChallengeName and Session are set and no tokens are returned.
 type AuthenticateOutputData struct {
 	AccessToken  string
 	RefreshToken string
 	ExpiresIn    int64
 	UserSub      string
+	Username     string // Username at the provider; Cognito needs it to compute SECRET_HASH on refresh
+
+	// Challenge details, set only when authentication is not yet complete
+	ChallengeName       string
+	Session             string
+	ChallengeParameters map[string]string
+}
+
+// RespondToAuthChallengeRequestData holds data for answering an authentication challenge
+type RespondToAuthChallengeRequestData struct {
+	Username      string
+	ChallengeName string
+	Session       string            // Session returned with the challenge
+	Responses     map[string]string // Challenge answers, e.g. SOFTWARE_TOKEN_MFA_CODE, NEW_PASSWORD
 }
 
 // RefreshTokenRequestData holds data for token refresh
 type RefreshTokenRequestData struct {
 	RefreshToken string
+	Username     string // Username the refresh token was issued to
 }
 
 // RefreshTokenOutputData holds data returned after token refresh
@@ -102,25 +168,114 @@ type RefreshTokenOutputData struct {
 	ExpiresIn   int64
 }
 
+// AssociateSoftwareTokenRequestData holds data for starting TOTP enrollment.
+// Either AccessToken (signed-in user) or Session (MFA_SETUP challenge during login) must be set.
+type AssociateSoftwareTokenRequestData struct {
+	AccessToken string
+	Session     string
+}
+
+// AssociateSoftwareTokenOutputData holds the shared TOTP secret generated by the provider
+type AssociateSoftwareTokenOutputData struct {
+	SecretCode string // Base32 encoded TOTP secret
+	Session    string // Updated session, set when enrolling during a login challenge
+}
+
+// VerifySoftwareTokenRequestData holds data for verifying the first TOTP code after enrollment
+type VerifySoftwareTokenRequestData struct {
+	AccessToken        string
+	Session            string
+	UserCode           string
+	FriendlyDeviceName string
+}
+
+// VerifySoftwareTokenOutputData holds the result of verifying a TOTP code
+type VerifySoftwareTokenOutputData struct {
+	Status  string // SUCCESS or ERROR
+	Session string
+}
+
+// MFAPreference describes whether an MFA method is enabled and preferred for a user
+type MFAPreference struct {
+	Enabled   bool
+	Preferred bool
+}
+
+// SetMFAPreferenceRequestData holds the MFA settings for a user.
+// A nil preference leaves that method's settings unchanged.
+type SetMFAPreferenceRequestData struct {
+	Username string
+	TOTP     *MFAPreference
+	SMS      *MFAPreference
+}
+
+// ResendConfirmationCodeRequestData holds data for sending a new signup confirmation code
+type ResendConfirmationCodeRequestData struct {
+	Username string
+}
+
+// ResendConfirmationCodeOutputData holds where the new confirmation code was sent
+type ResendConfirmationCodeOutputData struct {
+	CodeDeliveryDetails *CodeDeliveryDetailsData
+}
+
+// ForgotPasswordRequestData holds data for starting a password reset
+type ForgotPasswordRequestData struct {
+	Username string
+}
+
+// ForgotPasswordOutputData holds where the reset code was sent
+type ForgotPasswordOutputData struct {
+	CodeDeliveryDetails *CodeDeliveryDetailsData
+}
+
+// ConfirmForgotPasswordRequestData holds data for setting a new password with a reset code
+type ConfirmForgotPasswordRequestData struct {
+	Username         string
+	ConfirmationCode string
+	NewPassword      string
+}
+
+// ChangePasswordRequestData holds data for a signed-in user changing their password
+type ChangePasswordRequestData struct {
+	AccessToken      string
+	PreviousPassword string
+	ProposedPassword string
+}
+
 // AuthProvider defines the interface for authentication operations.
 type AuthProvider interface {
 	SignUp(ctx context.Context, req SignUpRequestData) (*SignUpOutputData, error)
 	ConfirmSignUp(ctx context.Context, req ConfirmSignUpRequestData) (*ConfirmSignUpOutputData, error)
+	ResendConfirmationCode(ctx context.Context, req ResendConfirmationCodeRequestData) (*ResendConfirmationCodeOutputData, error)
 	AdminCreateUser(ctx context.Context, req AdminCreateUserRequestData) (*AdminCreateUserOutputData, error)
+	AdminDeleteUser(ctx context.Context, username string) error                  // Removes a user, e.g. to roll back a failed signup
 	GetUser(ctx context.Context, accessToken string) (*GetUserOutputData, error) // Or by other means like user ID/sub
 
 	// Authentication methods
 	Authenticate(ctx context.Context, req AuthenticateRequestData) (*AuthenticateOutputData, error)
 	RefreshToken(ctx context.Context, req RefreshTokenRequestData) (*RefreshTokenOutputData, error)
+	RespondToAuthChallenge(ctx context.Context, req RespondToAuthChallengeRequestData) (*AuthenticateOutputData, error)
+	RevokeToken(ctx context.Context, refreshToken string) error // Revokes a refresh token and its access tokens
+	GlobalSignOut(ctx context.Context, username string) error   // Revokes all of a user's refresh tokens
+
+	// Password methods
+	ForgotPassword(ctx context.Context, req ForgotPasswordRequestData) (*ForgotPasswordOutputData, error)
+	ConfirmForgotPassword(ctx context.Context, req ConfirmForgotPasswordRequestData) error
+	ChangePassword(ctx context.Context, req ChangePasswordRequestData) error
+
+	// MFA methods
+	AssociateSoftwareToken(ctx context.Context, req AssociateSoftwareTokenRequestData) (*AssociateSoftwareTokenOutputData, error)
+	VerifySoftwareToken(ctx context.Context, req VerifySoftwareTokenRequestData) (*VerifySoftwareTokenOutputData, error)
+	SetMFAPreference(ctx context.Context, req SetMFAPreferenceRequestData) error
 
 	// Methods for Organization Signup Flow (SSO)
 	CreateIdentityProvider(ctx context.Context, req CreateIdentityProviderRequestData) (*CreateIdentityProviderOutputData, error)
+	UpdateIdentityProvider(ctx context.Context, req UpdateIdentityProviderRequestData) (*UpdateIdentityProviderOutputData, error)
+	DescribeIdentityProvider(ctx context.Context, providerName string) (*DescribeIdentityProviderOutputData, error)
+	DeleteIdentityProvider(ctx context.Context, providerName string) error
 	// TODO: Add other methods as needed:
 	// UpdateUserPool(...)
 	// CreateUserPoolDomain(...)
 	// UpdateUserPoolClient(...)
-
-	// Methods for Login Flow
-	// InitiateAuth(ctx context.Context, req InitiateAuthRequestData) (*InitiateAuthOutputData, error)
-	// RespondToAuthChallenge(ctx context.Context, req RespondToAuthChallengeRequestData) (*RespondToAuthChallengeOutputData, error)
 }
@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	authprovider "shield/modules/authn/internal/auth/provider"
+	"shield/modules/authn/internal/models"
+	"shield/modules/authn/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+// WithReconciliation stores a reconciliation job with every signup, so a signup that fails or
+// crashes between the provider and the database is rolled back by the Reconciler. Jobs are
+// left alone for gracePeriod, which must exceed the duration of a signup request.
+func WithReconciliation(repo repository.ReconciliationRepository, gracePeriod time.Duration) Option {
+	return func(s *AuthService) {
+		s.reconciliation = repo
+		s.reconcileGrace = gracePeriod
+	}
+}
+
+// startSignup stores the job guarding a signup, with the organization for organization signups.
+// Without a reconciliation repository the organization is created on its own.
+func (s *AuthService) startSignup(ctx context.Context, username string, org *models.Organization) (*models.ReconciliationJob, error) {
+	job := &models.ReconciliationJob{
+		Action:        models.ReconcileRollbackSignup,
+		Username:      username,
+		NextAttemptAt: time.Now().Add(s.reconcileGrace),
+	}
+	if s.reconciliation == nil {
+		if org != nil {
+			if err := s.userRepository.CreateOrganization(ctx, org); err != nil {
+				return nil, err
+			}
+			job.OrgID = &org.ID
+		}
+		return job, nil
+	}
+	if err := s.reconciliation.StartSignup(ctx, job, org); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// recordProviderUser notes the provider user created by a signup, which makes it subject to
+// rollback. It fails when the database cannot be written, so the caller rolls back right away.
+func (s *AuthService) recordProviderUser(ctx context.Context, job *models.ReconciliationJob, sub string) error {
+	job.ProviderSub = sub
+	if s.reconciliation == nil {
+		return nil
+	}
+	return s.reconciliation.RecordProviderUser(ctx, job)
+}
+
+// completeSignup creates the local user and, in the same transaction, deletes the signup's job.
+func (s *AuthService) completeSignup(ctx context.Context, user *models.User, job *models.ReconciliationJob) error {
+	if s.reconciliation == nil {
+		return s.userRepository.CreateUser(ctx, user)
+	}
+	return s.reconciliation.CompleteSignup(ctx, user, job.ID)
+}
+
+// rollbackSignup undoes a signup that could not be completed: the provider user it created is
+// deleted, then its organization and job. Whatever fails is left to the Reconciler.
+func (s *AuthService) rollbackSignup(ctx context.Context, job *models.ReconciliationJob) {
+	if err := rollbackSignup(ctx, s.provider, s.reconciliation, job); err != nil {
+		log.Printf("Signup rollback for %s incomplete, left for reconciliation: %v", job.Username, err)
+		return
+	}
+	if s.reconciliation == nil && job.OrgID != nil {
+		if err := s.userRepository.DeleteOrganization(ctx, *job.OrgID); err != nil {
+			log.Printf("Failed to delete organization %s of failed signup: %v", job.OrgID, err)
+		}
+	}
+}
+
+func rollbackSignup(ctx context.Context, provider authprovider.AuthProvider, repo repository.ReconciliationRepository, job *models.ReconciliationJob) error {
+	if job.ProviderSub != "" {
+		err := provider.AdminDeleteUser(ctx, job.Username)
+		if err != nil && !errors.Is(err, authprovider.ErrUserNotFound) {
+			return fmt.Errorf("failed to delete provider user: %w", err)
+		}
+	}
+	if repo == nil {
+		return nil
+	}
+	if err := repo.RollbackSignup(ctx, job); err != nil {
+		return fmt.Errorf("failed to delete signup records: %w", err)
+	}
+	return nil
+}
+
+// ReconcilerConfig controls how pending reconciliation jobs are retried
+type ReconcilerConfig struct {
+	Interval    time.Duration // Time between runs and the first retry delay (default 1m)
+	MaxDelay    time.Duration // Upper bound of the exponential retry delay (default 1h)
+	MaxAttempts int           // Attempts before a job is marked failed (default 10)
+	BatchSize   int           // Jobs processed per run (default 50)
+	Lease       time.Duration // Time a run has to process the jobs it claimed before others may retry them (default 5m)
+}
+
+// Reconciler retries the reconciliation jobs left behind by failed signups. Each run claims the
+// jobs it processes for a lease, so replicas running reconcilers concurrently do not work on the
+// same job; jobs of a reconciler that stopped are retried once their lease ends.
+type Reconciler struct {
+	provider authprovider.AuthProvider
+	repo     repository.ReconciliationRepository
+	users    repository.UserRepository
+	config   ReconcilerConfig
+	now      func() time.Time
+}
+
+// NewReconciler creates a new reconciler
+func NewReconciler(provider authprovider.AuthProvider, repo repository.ReconciliationRepository, users repository.UserRepository, config ReconcilerConfig) *Reconciler {
+	if config.Interval <= 0 {
+		config.Interval = time.Minute
+	}
+	if config.MaxDelay <= 0 {
+		config.MaxDelay = time.Hour
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 10
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 50
+	}
+	if config.Lease <= 0 {
+		config.Lease = 5 * time.Minute
+	}
+
+	return &Reconciler{
+		provider: provider,
+		repo:     repo,
+		users:    users,
+		config:   config,
+		now:      time.Now,
+	}
+}
+
+// Run processes due jobs every interval until ctx is cancelled
+func (r *Reconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.RunOnce(ctx); err != nil {
+				log.Printf("Reconciliation run failed: %v", err)
+			}
+		}
+	}
+}
+
+// RunOnce processes the jobs that are due and returns how many completed.
+func (r *Reconciler) RunOnce(ctx context.Context) (int, error) {
+	jobs, err := r.repo.ClaimDueJobs(ctx, r.now(), r.config.Lease, r.config.BatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load reconciliation jobs: %w", err)
+	}
+
+	completed := 0
+	for _, job := range jobs {
+		if err := r.process(ctx, job); err != nil {
+			r.retryLater(ctx, job, err)
+			continue
+		}
+		completed++
+	}
+	return completed, nil
+}
+
+func (r *Reconciler) process(ctx context.Context, job *models.ReconciliationJob) error {
+	switch job.Action {
+	case models.ReconcileRollbackSignup:
+		if job.ProviderSub == "" {
+			if err := r.deleteUnrecordedUser(ctx, job); err != nil {
+				return err
+			}
+		}
+		return rollbackSignup(ctx, r.provider, r.repo, job)
+	}
+	return fmt.Errorf("unknown reconciliation action %q", job.Action)
+}
+
+// deleteUnrecordedUser deletes the provider user of a signup that stopped before its sub was
+// recorded. A local user with the username means the provider user predates the signup, which
+// failed because the username was taken; it is kept.
+func (r *Reconciler) deleteUnrecordedUser(ctx context.Context, job *models.ReconciliationJob) error {
+	_, err := r.users.GetUserByEmail(ctx, job.Username)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("failed to look up local user: %w", err)
+	}
+	if err := r.provider.AdminDeleteUser(ctx, job.Username); err != nil && !errors.Is(err, authprovider.ErrUserNotFound) {
+		return fmt.Errorf("failed to delete unrecorded provider user: %w", err)
+	}
+	return nil
+}
+
+// retryLater records a failed attempt and schedules the next one with exponential backoff,
+// or marks the job failed once its attempts are exhausted.
+func (r *Reconciler) retryLater(ctx context.Context, job *models.ReconciliationJob, cause error) {
+	now := r.now()
+	job.Attempts++
+	job.LastError = cause.Error()
+
+	if job.Attempts >= r.config.MaxAttempts {
+		job.FailedAt = &now
+		log.Printf("Reconciliation job %s for %s failed after %d attempts: %v", job.ID, job.Username, job.Attempts, cause)
+	} else {
+		delay := r.config.Interval << (job.Attempts - 1)
+		if delay <= 0 || delay > r.config.MaxDelay {
+			delay = r.config.MaxDelay
+		}
+		job.NextAttemptAt = now.Add(delay)
+	}
+
+	if err := r.repo.RecordFailure(ctx, job); err != nil {
+		log.Printf("Failed to record reconciliation attempt for job %s: %v", job.ID, err)
+	}
+}
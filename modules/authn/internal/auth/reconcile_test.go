@@ -0,0 +1,312 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	appconfig "shield/cmd/app/config"
+	authprovider "shield/modules/authn/internal/auth/provider"
+	"shield/modules/authn/internal/models"
+	"shield/modules/authn/internal/repository"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// signupProvider creates users and records the ones it is asked to delete
+type signupProvider struct {
+	authprovider.AuthProvider
+	signUpErr error
+	deleteErr error
+	deleted   []string
+}
+
+func (p *signupProvider) SignUp(_ context.Context, req authprovider.SignUpRequestData) (*authprovider.SignUpOutputData, error) {
+	if p.signUpErr != nil {
+		return nil, p.signUpErr
+	}
+	return &authprovider.SignUpOutputData{UserSub: "sub-" + req.Username, UserConfirmed: true}, nil
+}
+
+func (p *signupProvider) AdminCreateUser(_ context.Context, req authprovider.AdminCreateUserRequestData) (*authprovider.AdminCreateUserOutputData, error) {
+	if p.signUpErr != nil {
+		return nil, p.signUpErr
+	}
+	return &authprovider.AdminCreateUserOutputData{User: &models.User{Email: req.Email, CognitoSub: "sub-" + req.Username}}, nil
+}
+
+func (p *signupProvider) AdminDeleteUser(_ context.Context, username string) error {
+	if p.deleteErr != nil {
+		return p.deleteErr
+	}
+	p.deleted = append(p.deleted, username)
+	return nil
+}
+
+// memoryReconciliation keeps jobs, organizations and users in maps; completeErr fails CompleteSignup
+type memoryReconciliation struct {
+	repository.ReconciliationRepository
+	jobs        map[uuid.UUID]*models.ReconciliationJob
+	orgs        map[uuid.UUID]*models.Organization
+	users       []*models.User
+	completeErr error
+}
+
+func newMemoryReconciliation() *memoryReconciliation {
+	return &memoryReconciliation{jobs: map[uuid.UUID]*models.ReconciliationJob{}, orgs: map[uuid.UUID]*models.Organization{}}
+}
+
+func (r *memoryReconciliation) StartSignup(_ context.Context, job *models.ReconciliationJob, org *models.Organization) error {
+	if org != nil {
+		org.ID = uuid.New()
+		r.orgs[org.ID] = org
+		job.OrgID = &org.ID
+	}
+	job.ID = uuid.New()
+	copied := *job
+	r.jobs[job.ID] = &copied
+	return nil
+}
+
+func (r *memoryReconciliation) RecordProviderUser(_ context.Context, job *models.ReconciliationJob) error {
+	r.jobs[job.ID].ProviderSub = job.ProviderSub
+	return nil
+}
+
+func (r *memoryReconciliation) CompleteSignup(_ context.Context, user *models.User, jobID uuid.UUID) error {
+	if r.completeErr != nil {
+		return r.completeErr
+	}
+	r.users = append(r.users, user)
+	delete(r.jobs, jobID)
+	return nil
+}
+
+func (r *memoryReconciliation) RollbackSignup(_ context.Context, job *models.ReconciliationJob) error {
+	if job.OrgID != nil {
+		delete(r.orgs, *job.OrgID)
+	}
+	delete(r.jobs, job.ID)
+	return nil
+}
+
+func (r *memoryReconciliation) ClaimDueJobs(_ context.Context, now time.Time, lease time.Duration, limit int) ([]*models.ReconciliationJob, error) {
+	var due []*models.ReconciliationJob
+	for _, job := range r.jobs {
+		if !job.NextAttemptAt.After(now) && job.FailedAt == nil && len(due) < limit {
+			job.NextAttemptAt = now.Add(lease)
+			copied := *job
+			due = append(due, &copied)
+		}
+	}
+	return due, nil
+}
+
+func (r *memoryReconciliation) RecordFailure(_ context.Context, job *models.ReconciliationJob) error {
+	copied := *job
+	r.jobs[job.ID] = &copied
+	return nil
+}
+
+// completedUsers looks up the users of a memoryReconciliation by email
+type completedUsers struct {
+	repository.UserRepository
+	repo *memoryReconciliation
+}
+
+func (r completedUsers) GetUserByEmail(_ context.Context, email string) (*models.User, error) {
+	for _, user := range r.repo.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *memoryReconciliation) onlyJob(t *testing.T) *models.ReconciliationJob {
+	t.Helper()
+	if len(r.jobs) != 1 {
+		t.Fatalf("%d reconciliation jobs, want 1", len(r.jobs))
+	}
+	for _, job := range r.jobs {
+		return job
+	}
+	return nil
+}
+
+func newSignupTestService(provider *signupProvider, repo *memoryReconciliation) *AuthService {
+	return NewAuthService(provider, &appconfig.Config{}, nil, nil, nil, WithReconciliation(repo, 5*time.Minute))
+}
+
+func TestSignupRollback(t *testing.T) {
+	ctx := context.Background()
+	req := SignupUserRequest{Email: "user@example.com", Password: "password"}
+
+	t.Run("completed", func(t *testing.T) {
+		repo := newMemoryReconciliation()
+		if _, err := newSignupTestService(&signupProvider{}, repo).SignupUser(ctx, req); err != nil {
+			t.Fatalf("SignupUser() error = %v", err)
+		}
+		if len(repo.users) != 1 || len(repo.jobs) != 0 {
+			t.Errorf("SignupUser() left %d users and %d jobs, want 1 and 0", len(repo.users), len(repo.jobs))
+		}
+	})
+
+	t.Run("database failure deletes provider user", func(t *testing.T) {
+		provider := &signupProvider{}
+		repo := newMemoryReconciliation()
+		repo.completeErr = errors.New("connection refused")
+		if _, err := newSignupTestService(provider, repo).SignupUser(ctx, req); err == nil {
+			t.Fatal("SignupUser() succeeded without a user record")
+		}
+		if len(provider.deleted) != 1 || provider.deleted[0] != req.Email || len(repo.jobs) != 0 {
+			t.Errorf("deleted %v with %d jobs left, want [%s] and none", provider.deleted, len(repo.jobs), req.Email)
+		}
+	})
+
+	t.Run("provider failure keeps existing user", func(t *testing.T) {
+		provider := &signupProvider{signUpErr: fmt.Errorf("username exists")}
+		repo := newMemoryReconciliation()
+		if _, err := newSignupTestService(provider, repo).SignupUser(ctx, req); err == nil {
+			t.Fatal("SignupUser() succeeded despite provider error")
+		}
+		if len(provider.deleted) != 0 || len(repo.jobs) != 0 {
+			t.Errorf("deleted %v with %d jobs left, want no deletes and no jobs", provider.deleted, len(repo.jobs))
+		}
+	})
+
+	t.Run("organization removed when admin creation fails", func(t *testing.T) {
+		provider := &signupProvider{signUpErr: errors.New("throttled")}
+		repo := newMemoryReconciliation()
+		_, err := newSignupTestService(provider, repo).OrgSignup(ctx, OrgSignupRequest{OrgName: "Acme", AdminEmail: "admin@acme.com"})
+		if err == nil {
+			t.Fatal("OrgSignup() succeeded despite provider error")
+		}
+		if len(repo.orgs) != 0 || len(repo.jobs) != 0 {
+			t.Errorf("OrgSignup() left %d organizations and %d jobs, want none", len(repo.orgs), len(repo.jobs))
+		}
+	})
+}
+
+func TestReconcilerRetriesRollback(t *testing.T) {
+	ctx := context.Background()
+	provider := &signupProvider{deleteErr: errors.New("provider unavailable")}
+	repo := newMemoryReconciliation()
+	repo.completeErr = errors.New("connection refused")
+
+	_, err := newSignupTestService(provider, repo).OrgSignup(ctx, OrgSignupRequest{OrgName: "Acme", AdminEmail: "admin@acme.com"})
+	if err == nil {
+		t.Fatal("OrgSignup() succeeded without a user record")
+	}
+	job := repo.onlyJob(t)
+	if job.ProviderSub != "sub-admin@acme.com" || len(repo.orgs) != 1 {
+		t.Fatalf("pending job = %+v with %d organizations, want the admin's sub and the organization kept", job, len(repo.orgs))
+	}
+
+	now := time.Now()
+	reconciler := NewReconciler(provider, repo, completedUsers{repo: repo}, ReconcilerConfig{Interval: time.Minute, MaxAttempts: 3})
+	reconciler.now = func() time.Time { return now }
+
+	// Jobs wait out the grace period of the signup
+	if n, _ := reconciler.RunOnce(ctx); n != 0 || repo.onlyJob(t).Attempts != 0 {
+		t.Errorf("RunOnce() within grace period completed %d jobs, want none attempted", n)
+	}
+
+	now = now.Add(6 * time.Minute)
+	if n, err := reconciler.RunOnce(ctx); err != nil || n != 0 {
+		t.Fatalf("RunOnce() = %d, %v; want the failing rollback retried later", n, err)
+	}
+	job = repo.onlyJob(t)
+	if job.Attempts != 1 || job.LastError == "" || !job.NextAttemptAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("job after failure = %+v, want 1 attempt retried in 1m", job)
+	}
+
+	now = now.Add(time.Minute)
+	provider.deleteErr = nil
+	if n, err := reconciler.RunOnce(ctx); err != nil || n != 1 {
+		t.Fatalf("RunOnce() = %d, %v; want the rollback completed", n, err)
+	}
+	if len(provider.deleted) != 1 || len(repo.orgs) != 0 || len(repo.jobs) != 0 {
+		t.Errorf("after reconciliation deleted %v with %d organizations and %d jobs, want the admin and nothing left", provider.deleted, len(repo.orgs), len(repo.jobs))
+	}
+}
+
+func TestReconcilerGivesUp(t *testing.T) {
+	ctx := context.Background()
+	provider := &signupProvider{deleteErr: errors.New("provider unavailable")}
+	repo := newMemoryReconciliation()
+	job := &models.ReconciliationJob{Action: models.ReconcileRollbackSignup, Username: "user@example.com", ProviderSub: "sub-1"}
+	_ = repo.StartSignup(ctx, job, nil)
+
+	now := time.Now()
+	reconciler := NewReconciler(provider, repo, completedUsers{repo: repo}, ReconcilerConfig{Interval: time.Minute, MaxAttempts: 2})
+	reconciler.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		_, _ = reconciler.RunOnce(ctx)
+		now = now.Add(time.Hour)
+	}
+	if job := repo.onlyJob(t); job.Attempts != 2 || job.FailedAt == nil {
+		t.Errorf("job = %+v, want failed after 2 attempts", job)
+	}
+}
+
+func TestReconcilerDeletesUnrecordedProviderUser(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	// The process stopped after the provider created the user and before its sub was recorded
+	provider := &signupProvider{}
+	repo := newMemoryReconciliation()
+	crashed := &models.ReconciliationJob{Action: models.ReconcileRollbackSignup, Username: "user@example.com"}
+	_ = repo.StartSignup(ctx, crashed, nil)
+	// A signup that failed because the username belongs to an existing user
+	repo.users = append(repo.users, &models.User{Email: "taken@example.com"})
+	taken := &models.ReconciliationJob{Action: models.ReconcileRollbackSignup, Username: "taken@example.com"}
+	_ = repo.StartSignup(ctx, taken, nil)
+
+	reconciler := NewReconciler(provider, repo, completedUsers{repo: repo}, ReconcilerConfig{})
+	reconciler.now = func() time.Time { return now }
+	if n, err := reconciler.RunOnce(ctx); err != nil || n != 2 {
+		t.Fatalf("RunOnce() = %d, %v; want both jobs completed", n, err)
+	}
+	if len(provider.deleted) != 1 || provider.deleted[0] != "user@example.com" || len(repo.jobs) != 0 {
+		t.Errorf("deleted %v with %d jobs left, want [user@example.com] and none", provider.deleted, len(repo.jobs))
+	}
+
+	// The provider user may never have been created
+	provider = &signupProvider{deleteErr: fmt.Errorf("%w: cognito", authprovider.ErrUserNotFound)}
+	_ = repo.StartSignup(ctx, &models.ReconciliationJob{Action: models.ReconcileRollbackSignup, Username: "user@example.com"}, nil)
+	reconciler = NewReconciler(provider, repo, completedUsers{repo: repo}, ReconcilerConfig{})
+	reconciler.now = func() time.Time { return now }
+	if n, err := reconciler.RunOnce(ctx); err != nil || n != 1 || len(repo.jobs) != 0 {
+		t.Errorf("RunOnce() = %d, %v with %d jobs left; want the job completed", n, err, len(repo.jobs))
+	}
+}
+
+func TestReconcilerSkipsClaimedJobs(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	provider := &signupProvider{}
+	repo := newMemoryReconciliation()
+	_ = repo.StartSignup(ctx, &models.ReconciliationJob{Action: models.ReconcileRollbackSignup, Username: "user@example.com", ProviderSub: "sub-1", NextAttemptAt: now}, nil)
+
+	// Another replica claimed the job and has not finished it
+	if claimed, _ := repo.ClaimDueJobs(ctx, now, 5*time.Minute, 10); len(claimed) != 1 {
+		t.Fatalf("ClaimDueJobs() = %d jobs, want 1", len(claimed))
+	}
+	reconciler := NewReconciler(provider, repo, completedUsers{repo: repo}, ReconcilerConfig{Lease: 5 * time.Minute})
+	reconciler.now = func() time.Time { return now.Add(time.Minute) }
+	if n, err := reconciler.RunOnce(ctx); err != nil || n != 0 || len(provider.deleted) != 0 {
+		t.Fatalf("RunOnce() during the lease = %d, %v with %v deleted; want the job left alone", n, err, provider.deleted)
+	}
+
+	// The replica stopped; the job is retried once its lease ends
+	reconciler.now = func() time.Time { return now.Add(6 * time.Minute) }
+	if n, err := reconciler.RunOnce(ctx); err != nil || n != 1 || len(repo.jobs) != 0 {
+		t.Errorf("RunOnce() after the lease = %d, %v with %d jobs left; want the job completed", n, err, len(repo.jobs))
+	}
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	appconfig "shield/cmd/app/config"
+	authprovider "shield/modules/authn/internal/auth/provider"
+	"shield/modules/authn/internal/auth/session"
+	"shield/modules/authn/internal/models"
+	"shield/modules/common/crypto"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// refreshProvider records the provider refresh requests
+type refreshProvider struct {
+	authprovider.AuthProvider
+	requests []authprovider.RefreshTokenRequestData
+	err      error
+}
+
+func (p *refreshProvider) RefreshToken(_ context.Context, req authprovider.RefreshTokenRequestData) (*authprovider.RefreshTokenOutputData, error) {
+	p.requests = append(p.requests, req)
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &authprovider.RefreshTokenOutputData{AccessToken: "new-access", ExpiresIn: 3600}, nil
+}
+
+// rotatingSessions returns a fixed session for any refresh token and counts the rotations
+type rotatingSessions struct {
+	session.SessionManager
+	session   *models.Session
+	rotations int
+}
+
+func (m *rotatingSessions) RefreshSession(_ context.Context, _ string, renew func(*models.Session) error) (*models.Session, error) {
+	if err := renew(m.session); err != nil {
+		return nil, err
+	}
+	m.rotations++
+	return m.session, nil
+}
+
+func TestRefreshTokenSendsProviderUsername(t *testing.T) {
+	sealer, err := crypto.NewSealer("session-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, _ := sealer.Seal([]byte("provider-refresh"))
+
+	provider := &refreshProvider{}
+	sessions := &rotatingSessions{session: &models.Session{ID: "s1", ProviderRefreshToken: sealed, ProviderUsername: "pool-user"}}
+	svc := NewAuthService(provider, &appconfig.Config{}, nil, sessions, nil, WithTokenSealer(sealer))
+
+	if _, err := svc.RefreshToken(context.Background(), RefreshTokenRequest{RefreshToken: "shield-refresh"}); err != nil {
+		t.Fatalf("RefreshToken() error = %v", err)
+	}
+	want := authprovider.RefreshTokenRequestData{RefreshToken: "provider-refresh", Username: "pool-user"}
+	if len(provider.requests) != 1 || provider.requests[0] != want {
+		t.Errorf("provider refresh requests = %+v, want [%+v]", provider.requests, want)
+	}
+
+	// The Shield refresh token survives a failed provider refresh
+	provider.err = errors.New("provider unavailable")
+	if _, err := svc.RefreshToken(context.Background(), RefreshTokenRequest{RefreshToken: "shield-refresh"}); err == nil {
+		t.Fatal("RefreshToken() succeeded although the provider failed")
+	}
+	if sessions.rotations != 1 {
+		t.Errorf("refresh token rotated %d times, want once", sessions.rotations)
+	}
+}
+
+func TestProviderTokensUsername(t *testing.T) {
+	accessToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"username":   "token-user",
+		"origin_jti": "origin-1",
+	}).SignedString([]byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := NewAuthService(nil, &appconfig.Config{}, nil, nil, nil)
+
+	tests := []struct {
+		name       string
+		authResult authprovider.AuthenticateOutputData
+		want       string
+	}{
+		{"from provider", authprovider.AuthenticateOutputData{AccessToken: accessToken, Username: "provider-user"}, "provider-user"},
+		{"from access token", authprovider.AuthenticateOutputData{AccessToken: accessToken}, "token-user"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := svc.providerTokens(&tt.authResult)
+			if err != nil {
+				t.Fatalf("providerTokens() error = %v", err)
+			}
+			if tokens.Username != tt.want || tokens.TokenID != "origin-1" {
+				t.Errorf("providerTokens() = %+v, want username %s and token ID origin-1", tokens, tt.want)
+			}
+		})
+	}
+}
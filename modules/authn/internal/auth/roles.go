@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"shield/modules/authn/internal/models"
+	apperrors "shield/modules/common/errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultPageSize is the number of role holders returned when no page size is requested
+	DefaultPageSize = 20
+	// MaxPageSize bounds the page size of role holder listings
+	MaxPageSize = 100
+)
+
+var (
+	ErrRoleNotFound           = apperrors.NewAppError("ROLE_NOT_FOUND", "Role not found", http.StatusNotFound)
+	ErrRoleExists             = apperrors.NewAppError("ROLE_EXISTS", "Role already exists", http.StatusConflict)
+	ErrRoleAssignmentNotFound = apperrors.NewAppError("ROLE_ASSIGNMENT_NOT_FOUND", "User does not hold the role", http.StatusNotFound)
+)
+
+// roleNamePattern restricts role names to what policies can compare without escaping
+var roleNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.:-]{0,63}$`)
+
+// CreateRoleRequest contains the fields of a new application role
+type CreateRoleRequest struct {
+	Name        string
+	Description string
+}
+
+// RoleHolders is a page of the users holding a role
+type RoleHolders struct {
+	Users    []models.User
+	Page     int
+	PageSize int
+	Total    int64
+}
+
+// UserApplicationRoles are the roles a user holds in one application
+type UserApplicationRoles struct {
+	Application *models.Application
+	Roles       []string
+}
+
+// ListRoles returns the roles defined for an application. Org admins only.
+func (s *AuthService) ListRoles(ctx context.Context, caller *models.User, appID uuid.UUID) ([]models.ApplicationRole, error) {
+	if _, err := s.adminApplication(ctx, caller, appID); err != nil {
+		return nil, err
+	}
+	return s.applications.ListRoles(ctx, appID)
+}
+
+// CreateRole defines a role for an application. Org admins only.
+func (s *AuthService) CreateRole(ctx context.Context, caller *models.User, appID uuid.UUID, req CreateRoleRequest) (*models.ApplicationRole, error) {
+	if _, err := s.adminApplication(ctx, caller, appID); err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if !roleNamePattern.MatchString(name) {
+		return nil, apperrors.NewAppError("INVALID_ROLE", "Role names are 1 to 64 letters, digits, '_', '.', ':' or '-'", http.StatusBadRequest)
+	}
+	if _, err := s.applications.GetRole(ctx, appID, name); err == nil {
+		return nil, ErrRoleExists
+	}
+
+	role := &models.ApplicationRole{AppID: appID, Name: name, Description: strings.TrimSpace(req.Description)}
+	if err := s.applications.CreateRole(ctx, role); err != nil {
+		return nil, fmt.Errorf("failed to create role: %w", err)
+	}
+	return role, nil
+}
+
+// DeleteRole deletes an application role and removes it from every user holding it. Org admins only.
+func (s *AuthService) DeleteRole(ctx context.Context, caller *models.User, appID uuid.UUID, name string) error {
+	if _, err := s.adminApplication(ctx, caller, appID); err != nil {
+		return err
+	}
+	if err := s.applications.DeleteRole(ctx, appID, name); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrRoleNotFound
+		}
+		return fmt.Errorf("failed to delete role: %w", err)
+	}
+	return nil
+}
+
+// AssignRole gives a user a role the application defines. Org admins may only assign roles of
+// their organization's applications to members of their organization.
+func (s *AuthService) AssignRole(ctx context.Context, caller *models.User, appID, userID uuid.UUID, name string) error {
+	if _, err := s.adminApplication(ctx, caller, appID); err != nil {
+		return err
+	}
+	if _, err := s.orgMember(ctx, caller, userID); err != nil {
+		return err
+	}
+
+	err := s.applications.AssignRole(ctx, &models.UserAppRole{UserID: userID, AppID: appID, RoleName: name})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrRoleNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to assign role: %w", err)
+	}
+	return nil
+}
+
+// UnassignRole takes a role from a user. Org admins may only manage members of their organization.
+func (s *AuthService) UnassignRole(ctx context.Context, caller *models.User, appID, userID uuid.UUID, name string) error {
+	if _, err := s.adminApplication(ctx, caller, appID); err != nil {
+		return err
+	}
+	if _, err := s.orgMember(ctx, caller, userID); err != nil {
+		return err
+	}
+
+	err := s.applications.UnassignRole(ctx, userID, appID, name)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrRoleAssignmentNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to unassign role: %w", err)
+	}
+	return nil
+}
+
+// ListRoleHolders returns a page of the users holding an application role. Pages start at 1;
+// page sizes default to DefaultPageSize and are capped at MaxPageSize. Org admins only.
+func (s *AuthService) ListRoleHolders(ctx context.Context, caller *models.User, appID uuid.UUID, name string, page, pageSize int) (*RoleHolders, error) {
+	if _, err := s.adminApplication(ctx, caller, appID); err != nil {
+		return nil, err
+	}
+	if _, err := s.applications.GetRole(ctx, appID, name); err != nil {
+		return nil, ErrRoleNotFound
+	}
+
+	page, pageSize = pageBounds(page, pageSize)
+
+	users, total, err := s.applications.ListRoleHolders(ctx, appID, name, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list role holders: %w", err)
+	}
+	return &RoleHolders{Users: users, Page: page, PageSize: pageSize, Total: total}, nil
+}
+
+// ListUserRoles returns the roles a user holds, grouped by application. Users may list their
+// own roles; org admins also those of the members of their organization.
+func (s *AuthService) ListUserRoles(ctx context.Context, caller *models.User, userID uuid.UUID) ([]UserApplicationRoles, error) {
+	if caller == nil {
+		return nil, apperrors.ErrUnauthorized
+	}
+	if userID != caller.ID {
+		if _, err := s.orgMember(ctx, caller, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	assignments, err := s.applications.ListUserAppRoles(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user roles: %w", err)
+	}
+
+	// Assignments are ordered by application, so each application's roles are adjacent
+	var roles []UserApplicationRoles
+	for i := range assignments {
+		assignment := &assignments[i]
+		if len(roles) == 0 || roles[len(roles)-1].Application.ID != assignment.AppID {
+			app := assignment.Application
+			if app == nil {
+				app = &models.Application{ID: assignment.AppID}
+			}
+			roles = append(roles, UserApplicationRoles{Application: app})
+		}
+		current := &roles[len(roles)-1]
+		current.Roles = append(current.Roles, assignment.RoleName)
+	}
+	return roles, nil
+}
+
+// orgMember loads a user after checking that the caller administers the user's organization.
+// Users of other organizations are reported as not found.
+func (s *AuthService) orgMember(ctx context.Context, caller *models.User, userID uuid.UUID) (*models.User, error) {
+	if err := applicationAdmin(caller); err != nil {
+		return nil, err
+	}
+	user, err := s.userRepository.GetUserByID(ctx, userID)
+	if err != nil || !caller.IsOrgAdmin(user.OrgID) {
+		return nil, apperrors.ErrUserNotFound
+	}
+	return user, nil
+}
+
+// pageBounds defaults and clamps the page and page size of a listing
+func pageBounds(page, pageSize int) (int, int) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = DefaultPageSize
+	}
+	if pageSize > MaxPageSize {
+		pageSize = MaxPageSize
+	}
+	return page, pageSize
+}
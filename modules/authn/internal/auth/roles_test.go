@@ -0,0 +1,277 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"sort"
+	"testing"
+
+	appconfig "shield/cmd/app/config"
+	"shield/modules/authn/internal/models"
+	apperrors "shield/modules/common/errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func (r *memoryApplications) ListRoles(_ context.Context, appID uuid.UUID) ([]models.ApplicationRole, error) {
+	var roles []models.ApplicationRole
+	for _, role := range r.catalog {
+		if role.AppID == appID {
+			roles = append(roles, role)
+		}
+	}
+	return roles, nil
+}
+
+func (r *memoryApplications) GetRole(_ context.Context, appID uuid.UUID, name string) (*models.ApplicationRole, error) {
+	for _, role := range r.catalog {
+		if role.AppID == appID && role.Name == name {
+			return &role, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *memoryApplications) CreateRole(_ context.Context, role *models.ApplicationRole) error {
+	role.ID = uuid.New()
+	r.catalog = append(r.catalog, *role)
+	return nil
+}
+
+func (r *memoryApplications) DeleteRole(ctx context.Context, appID uuid.UUID, name string) error {
+	if _, err := r.GetRole(ctx, appID, name); err != nil {
+		return err
+	}
+	r.catalog = slices.DeleteFunc(r.catalog, func(role models.ApplicationRole) bool {
+		return role.AppID == appID && role.Name == name
+	})
+	for key, names := range r.roles {
+		if key[1] == appID {
+			r.roles[key] = slices.DeleteFunc(names, func(n string) bool { return n == name })
+		}
+	}
+	return nil
+}
+
+func (r *memoryApplications) AssignRole(ctx context.Context, assignment *models.UserAppRole) error {
+	if _, err := r.GetRole(ctx, assignment.AppID, assignment.RoleName); err != nil {
+		return err
+	}
+	key := [2]uuid.UUID{assignment.UserID, assignment.AppID}
+	if !slices.Contains(r.roles[key], assignment.RoleName) {
+		r.roles[key] = append(r.roles[key], assignment.RoleName)
+	}
+	return nil
+}
+
+func (r *memoryApplications) UnassignRole(_ context.Context, userID, appID uuid.UUID, name string) error {
+	key := [2]uuid.UUID{userID, appID}
+	if !slices.Contains(r.roles[key], name) {
+		return gorm.ErrRecordNotFound
+	}
+	r.roles[key] = slices.DeleteFunc(r.roles[key], func(n string) bool { return n == name })
+	return nil
+}
+
+func (r *memoryApplications) ListRoleHolders(_ context.Context, appID uuid.UUID, name string, offset, limit int) ([]models.User, int64, error) {
+	var holders []models.User
+	for key, names := range r.roles {
+		if key[1] == appID && slices.Contains(names, name) {
+			holders = append(holders, *r.users[key[0]])
+		}
+	}
+	sort.Slice(holders, func(i, j int) bool { return holders[i].Email < holders[j].Email })
+
+	total := int64(len(holders))
+	if offset > len(holders) {
+		offset = len(holders)
+	}
+	holders = holders[offset:]
+	if limit < len(holders) {
+		holders = holders[:limit]
+	}
+	return holders, total, nil
+}
+
+func (r *memoryApplications) ListUserAppRoles(_ context.Context, userID uuid.UUID) ([]models.UserAppRole, error) {
+	var assignments []models.UserAppRole
+	for key, names := range r.roles {
+		if key[0] != userID {
+			continue
+		}
+		for _, name := range names {
+			assignments = append(assignments, models.UserAppRole{UserID: userID, AppID: key[1], RoleName: name, Application: r.apps[key[1]]})
+		}
+	}
+	sort.Slice(assignments, func(i, j int) bool {
+		if assignments[i].AppID != assignments[j].AppID {
+			return assignments[i].AppID.String() < assignments[j].AppID.String()
+		}
+		return assignments[i].RoleName < assignments[j].RoleName
+	})
+	return assignments, nil
+}
+
+func TestRoleAssignment(t *testing.T) {
+	ctx := context.Background()
+	orgID := uuid.New()
+	admin := &models.User{ID: uuid.New(), Email: "admin@acme.com", OrgID: orgID, UserType: models.UserTypeOrgAdmin}
+	member := &models.User{ID: uuid.New(), Email: "member@acme.com", OrgID: orgID, UserType: models.UserTypeOrganization}
+	outsider := &models.User{ID: uuid.New(), Email: "user@example.com", OrgID: uuid.New(), UserType: models.UserTypeIndividual}
+	users := map[uuid.UUID]*models.User{admin.ID: admin, member.ID: member, outsider.ID: outsider}
+
+	repo := newMemoryApplications()
+	repo.users = users
+	app := &models.Application{ID: uuid.New(), OrgID: orgID, Name: "Demo", OPAEndpoint: "demo.authz", Status: models.ApplicationStatusActive}
+	other := &models.Application{ID: uuid.New(), OrgID: uuid.New(), Name: "Other", OPAEndpoint: "other.authz", Status: models.ApplicationStatusActive}
+	repo.apps[app.ID], repo.apps[other.ID] = app, other
+	repo.catalog = []models.ApplicationRole{{ID: uuid.New(), AppID: other.ID, Name: "editor"}}
+	svc := NewAuthService(nil, &appconfig.Config{}, &usersByID{users: users}, nil, nil, WithApplications(repo))
+
+	if _, err := svc.CreateRole(ctx, admin, app.ID, CreateRoleRequest{Name: " editor ", Description: "Edits data"}); err != nil {
+		t.Fatalf("CreateRole() error = %v", err)
+	}
+	if _, err := svc.CreateRole(ctx, admin, app.ID, CreateRoleRequest{Name: "editor"}); !errors.Is(err, ErrRoleExists) {
+		t.Errorf("CreateRole() duplicate error = %v, want ErrRoleExists", err)
+	}
+	if _, err := svc.CreateRole(ctx, admin, app.ID, CreateRoleRequest{Name: "two words"}); err == nil {
+		t.Error("CreateRole() with an invalid name succeeded")
+	}
+
+	tests := []struct {
+		name    string
+		caller  *models.User
+		appID   uuid.UUID
+		userID  uuid.UUID
+		role    string
+		wantErr error
+	}{
+		{name: "member of the admin's organization", caller: admin, appID: app.ID, userID: member.ID, role: "editor"},
+		{name: "assigning a held role", caller: admin, appID: app.ID, userID: member.ID, role: "editor"},
+		{name: "role the application does not define", caller: admin, appID: app.ID, userID: member.ID, role: "owner", wantErr: ErrRoleNotFound},
+		{name: "user of another organization", caller: admin, appID: app.ID, userID: outsider.ID, role: "editor", wantErr: apperrors.ErrUserNotFound},
+		{name: "application of another organization", caller: admin, appID: other.ID, userID: member.ID, role: "editor", wantErr: ErrApplicationNotFound},
+		{name: "caller is not an org admin", caller: member, appID: app.ID, userID: member.ID, role: "editor", wantErr: apperrors.ErrForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := svc.AssignRole(ctx, tt.caller, tt.appID, tt.userID, tt.role)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("AssignRole() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+	if roles := repo.roles[[2]uuid.UUID{member.ID, app.ID}]; !reflect.DeepEqual(roles, []string{"editor"}) {
+		t.Errorf("member holds %v, want [editor]", roles)
+	}
+
+	if err := svc.UnassignRole(ctx, admin, app.ID, member.ID, "editor"); err != nil {
+		t.Fatalf("UnassignRole() error = %v", err)
+	}
+	if err := svc.UnassignRole(ctx, admin, app.ID, member.ID, "editor"); !errors.Is(err, ErrRoleAssignmentNotFound) {
+		t.Errorf("UnassignRole() of a role not held error = %v, want ErrRoleAssignmentNotFound", err)
+	}
+	if err := svc.DeleteRole(ctx, admin, app.ID, "owner"); !errors.Is(err, ErrRoleNotFound) {
+		t.Errorf("DeleteRole() of an unknown role error = %v, want ErrRoleNotFound", err)
+	}
+}
+
+func TestListRoleHolders(t *testing.T) {
+	ctx := context.Background()
+	orgID := uuid.New()
+	admin := &models.User{ID: uuid.New(), Email: "admin@acme.com", OrgID: orgID, UserType: models.UserTypeOrgAdmin}
+	users := map[uuid.UUID]*models.User{admin.ID: admin}
+
+	repo := newMemoryApplications()
+	repo.users = users
+	app := &models.Application{ID: uuid.New(), OrgID: orgID, Name: "Demo", OPAEndpoint: "demo.authz", Status: models.ApplicationStatusActive}
+	repo.apps[app.ID] = app
+	repo.catalog = []models.ApplicationRole{{ID: uuid.New(), AppID: app.ID, Name: "viewer"}}
+	for _, email := range []string{"e@acme.com", "a@acme.com", "d@acme.com", "b@acme.com", "c@acme.com"} {
+		user := &models.User{ID: uuid.New(), Email: email, OrgID: orgID, UserType: models.UserTypeOrganization}
+		users[user.ID] = user
+		repo.roles[[2]uuid.UUID{user.ID, app.ID}] = []string{"viewer"}
+	}
+	svc := NewAuthService(nil, &appconfig.Config{}, &usersByID{users: users}, nil, nil, WithApplications(repo))
+
+	tests := []struct {
+		name         string
+		page         int
+		pageSize     int
+		wantEmails   []string
+		wantPage     int
+		wantPageSize int
+	}{
+		{name: "first page", page: 1, pageSize: 2, wantEmails: []string{"a@acme.com", "b@acme.com"}, wantPage: 1, wantPageSize: 2},
+		{name: "last page", page: 3, pageSize: 2, wantEmails: []string{"e@acme.com"}, wantPage: 3, wantPageSize: 2},
+		{name: "past the end", page: 4, pageSize: 2, wantPage: 4, wantPageSize: 2},
+		{name: "defaults", wantEmails: []string{"a@acme.com", "b@acme.com", "c@acme.com", "d@acme.com", "e@acme.com"}, wantPage: 1, wantPageSize: DefaultPageSize},
+		{name: "page size is capped", page: 1, pageSize: 1000, wantEmails: []string{"a@acme.com", "b@acme.com", "c@acme.com", "d@acme.com", "e@acme.com"}, wantPage: 1, wantPageSize: MaxPageSize},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			holders, err := svc.ListRoleHolders(ctx, admin, app.ID, "viewer", tt.page, tt.pageSize)
+			if err != nil {
+				t.Fatalf("ListRoleHolders() error = %v", err)
+			}
+			var emails []string
+			for _, user := range holders.Users {
+				emails = append(emails, user.Email)
+			}
+			if !reflect.DeepEqual(emails, tt.wantEmails) || holders.Total != 5 || holders.Page != tt.wantPage || holders.PageSize != tt.wantPageSize {
+				t.Errorf("ListRoleHolders() = %v (page %d of size %d, total %d), want %v (page %d of size %d, total 5)",
+					emails, holders.Page, holders.PageSize, holders.Total, tt.wantEmails, tt.wantPage, tt.wantPageSize)
+			}
+		})
+	}
+
+	if _, err := svc.ListRoleHolders(ctx, admin, app.ID, "owner", 1, 10); !errors.Is(err, ErrRoleNotFound) {
+		t.Errorf("ListRoleHolders() of an unknown role error = %v, want ErrRoleNotFound", err)
+	}
+}
+
+func TestListUserRoles(t *testing.T) {
+	ctx := context.Background()
+	orgID := uuid.New()
+	admin := &models.User{ID: uuid.New(), OrgID: orgID, UserType: models.UserTypeOrgAdmin}
+	member := &models.User{ID: uuid.New(), OrgID: orgID, UserType: models.UserTypeOrganization}
+	peer := &models.User{ID: uuid.New(), OrgID: orgID, UserType: models.UserTypeOrganization}
+	outsider := &models.User{ID: uuid.New(), OrgID: uuid.New(), UserType: models.UserTypeIndividual}
+	users := map[uuid.UUID]*models.User{admin.ID: admin, member.ID: member, peer.ID: peer, outsider.ID: outsider}
+
+	repo := newMemoryApplications()
+	crm := &models.Application{ID: uuid.New(), OrgID: orgID, Name: "CRM"}
+	wiki := &models.Application{ID: uuid.New(), OrgID: orgID, Name: "Wiki"}
+	repo.apps[crm.ID], repo.apps[wiki.ID] = crm, wiki
+	repo.roles[[2]uuid.UUID{member.ID, crm.ID}] = []string{"viewer", "editor"}
+	repo.roles[[2]uuid.UUID{member.ID, wiki.ID}] = []string{"reader"}
+	svc := NewAuthService(nil, &appconfig.Config{}, &usersByID{users: users}, nil, nil, WithApplications(repo))
+
+	want := map[string][]string{"CRM": {"editor", "viewer"}, "Wiki": {"reader"}}
+	for _, caller := range []*models.User{member, admin} {
+		roles, err := svc.ListUserRoles(ctx, caller, member.ID)
+		if err != nil {
+			t.Fatalf("ListUserRoles() by %s error = %v", caller.UserType, err)
+		}
+		got := map[string][]string{}
+		for _, appRoles := range roles {
+			got[appRoles.Application.Name] = appRoles.Roles
+		}
+		if len(roles) != 2 || !reflect.DeepEqual(got, want) {
+			t.Errorf("ListUserRoles() by %s = %v, want %v", caller.UserType, got, want)
+		}
+	}
+
+	if roles, err := svc.ListUserRoles(ctx, peer, peer.ID); err != nil || len(roles) != 0 {
+		t.Errorf("ListUserRoles() of a user without roles = %v, %v; want none", roles, err)
+	}
+	if _, err := svc.ListUserRoles(ctx, peer, member.ID); !errors.Is(err, apperrors.ErrForbidden) {
+		t.Errorf("ListUserRoles() of a peer error = %v, want ErrForbidden", err)
+	}
+	if _, err := svc.ListUserRoles(ctx, admin, outsider.ID); !errors.Is(err, apperrors.ErrUserNotFound) {
+		t.Errorf("ListUserRoles() of an outsider error = %v, want ErrUserNotFound", err)
+	}
+}
@@ -2,17 +2,28 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"fmt" // For error wrapping
+	"log"
+	"net/http"
+	"strings"
+	"time"
 
 	appconfig "shield/cmd/app/config" // Updated import path
+	"shield/modules/authn/internal/auth/mfa"
 	"shield/modules/authn/internal/auth/nonce"
+	"shield/modules/authn/internal/auth/policy"
 	authprovider "shield/modules/authn/internal/auth/provider" // Updated import path
 	"shield/modules/authn/internal/auth/session"
+	"shield/modules/authn/internal/auth/sso"
+	"shield/modules/authn/internal/auth/token"
 	"shield/modules/authn/internal/models"
 	"shield/modules/authn/internal/repository" // Add repository import
+	"shield/modules/common/crypto"
+	apperrors "shield/modules/common/errors"
+	"shield/modules/common/ratelimit"
 
-	"github.com/aws/aws-sdk-go-v2/aws" // Added for aws.String
-	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
+	"github.com/google/uuid"
 )
 
 // AuthService provides methods for authentication.
@@ -22,17 +33,65 @@ type AuthService struct {
 	userRepository repository.UserRepository
 	sessionManager session.SessionManager
 	nonceValidator nonce.NonceValidator
+	localMFA       *mfa.LocalEngine // Optional built-in TOTP engine
+	ssoClient      *sso.Client      // Optional hosted-UI client for SSO login
+	ssoStates      *sso.StateCodec
+	httpClient     *http.Client // Used to reach identity provider metadata
+	domainVerifier *sso.DomainVerifier
+	tokenVerifier  *token.Verifier
+	sessionCookies *session.CookieCodec // Optional signed session cookies
+	tokenSealer    *crypto.Sealer       // Encrypts provider tokens stored with sessions
+
+	passwordEmailLimit ratelimit.Limiter // Optional limits on password operations
+	passwordIPLimit    ratelimit.Limiter
+	resendLimit        ratelimit.Limiter // Optional cooldown between confirmation codes
+	resendCooldown     time.Duration
+	mfaChallengeLimit  ratelimit.Limiter // Optional limits on failed local MFA codes
+	mfaUserLimit       ratelimit.Limiter
+
+	reconciliation repository.ReconciliationRepository // Optional jobs that roll back failed signups
+	reconcileGrace time.Duration
+
+	applications    repository.ApplicationRepository // Optional applications and their API keys
+	policyEvaluator policy.Evaluator                 // Optional policy decisions
+	policyValidator policy.Validator                 // Optional checks of uploaded policy versions
+	policyPublisher policy.Publisher                 // Optional loading of active policies into the policy engine
+}
+
+// Option configures optional AuthService components.
+type Option func(*AuthService)
+
+// WithLocalMFA enables Shield's built-in TOTP engine for users whose MFA is not handled by the provider.
+func WithLocalMFA(engine *mfa.LocalEngine) Option {
+	return func(s *AuthService) {
+		s.localMFA = engine
+	}
+}
+
+// WithMFAAttemptLimits limits failed local MFA codes per login challenge and per user. A challenge
+// that used up its limit is invalidated; a user who did is locked out until the window resets.
+func WithMFAAttemptLimits(perChallenge, perUser ratelimit.Limiter) Option {
+	return func(s *AuthService) {
+		s.mfaChallengeLimit = perChallenge
+		s.mfaUserLimit = perUser
+	}
 }
 
 // NewAuthService creates a new AuthService.
-func NewAuthService(provider authprovider.AuthProvider, cfg *appconfig.Config, userRepo repository.UserRepository, sessionMgr session.SessionManager, nonceVal nonce.NonceValidator) *AuthService {
-	return &AuthService{
+func NewAuthService(provider authprovider.AuthProvider, cfg *appconfig.Config, userRepo repository.UserRepository, sessionMgr session.SessionManager, nonceVal nonce.NonceValidator, opts ...Option) *AuthService {
+	s := &AuthService{
 		provider:       provider,
 		config:         cfg,
 		userRepository: userRepo,
 		sessionManager: sessionMgr,
 		nonceValidator: nonceVal,
+		httpClient:     sso.NewHTTPClient(10 * time.Second),
+		domainVerifier: sso.NewDomainVerifier(nil),
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
 // SignupUserRequest contains parameters for signing up a new user.
@@ -49,14 +108,15 @@ type SignupUserResponse struct {
 	UserID               string                                `json:"userID"` // Cognito User Sub
 	RequiresConfirmation bool                                  `json:"requiresConfirmation"`
 	CodeDeliveryDetails  *authprovider.CodeDeliveryDetailsData `json:"codeDeliveryDetails,omitempty"`
+	ResendAvailableAt    time.Time                             `json:"resendAvailableAt,omitempty"` // Earliest time a new code can be requested
 }
 
 // SignupUser handles the registration of a new individual user.
 func (s *AuthService) SignupUser(ctx context.Context, req SignupUserRequest) (*SignupUserResponse, error) {
 	// Prepare user attributes for Cognito
-	userAttributes := []types.AttributeType{
-		{Name: aws.String("email"), Value: aws.String(req.Email)},
-		{Name: aws.String("custom:user_type"), Value: aws.String(string(models.UserTypeIndividual))},
+	userAttributes := []authprovider.UserAttribute{
+		{Name: "email", Value: req.Email},
+		{Name: "custom:user_type", Value: string(models.UserTypeIndividual)},
 		// Add other attributes from req if necessary
 	}
 
@@ -67,8 +127,15 @@ func (s *AuthService) SignupUser(ctx context.Context, req SignupUserRequest) (*S
 		UserAttributes: userAttributes,
 	}
 
+	// The job rolls the provider user back unless the local user record is committed
+	job, err := s.startSignup(ctx, req.Email, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start signup: %w", err)
+	}
+
 	result, err := s.provider.SignUp(ctx, providerReq)
 	if err != nil {
+		s.rollbackSignup(ctx, job)
 		return nil, fmt.Errorf("provider SignUp failed: %w", err)
 	}
 
@@ -81,18 +148,25 @@ func (s *AuthService) SignupUser(ctx context.Context, req SignupUserRequest) (*S
 		// OrgID will be uuid.Nil for individual users
 	}
 
-	if err := s.userRepository.CreateUser(ctx, user); err != nil {
-		// Log the error but don't fail the signup - user is already created in Cognito
-		// In production, you might want to implement compensation logic or queue for retry
-		// For now, we'll log and continue
-		fmt.Printf("Warning: Failed to create user in local database: %v\n", err)
+	err = s.recordProviderUser(ctx, job, result.UserSub)
+	if err == nil {
+		err = s.completeSignup(ctx, user, job)
+	}
+	if err != nil {
+		s.rollbackSignup(ctx, job)
+		return nil, fmt.Errorf("failed to create user in database: %w", err)
 	}
 
-	return &SignupUserResponse{
+	resp := &SignupUserResponse{
 		UserID:               result.UserSub,
 		RequiresConfirmation: !result.UserConfirmed, // UserConfirmed is true if already confirmed (e.g. by admin)
 		CodeDeliveryDetails:  result.CodeDeliveryDetails,
-	}, nil
+	}
+	if resp.RequiresConfirmation {
+		// The provider just sent a code; a resend has to wait out the cooldown
+		resp.ResendAvailableAt = s.startResendCooldown(ctx, req.Email)
+	}
+	return resp, nil
 }
 
 // ConfirmSignupRequest contains parameters for confirming a user's signup.
@@ -117,7 +191,7 @@ func (s *AuthService) ConfirmUserSignup(ctx context.Context, req ConfirmSignupRe
 
 	_, err := s.provider.ConfirmSignUp(ctx, providerReq)
 	if err != nil {
-		return nil, fmt.Errorf("provider ConfirmSignUp failed: %w", err)
+		return nil, providerError(fmt.Errorf("provider ConfirmSignUp failed: %w", err))
 	}
 
 	// Update user status in local database
@@ -136,40 +210,103 @@ func (s *AuthService) ConfirmUserSignup(ctx context.Context, req ConfirmSignupRe
 	return &ConfirmSignupResponse{Message: "User confirmed successfully."}, nil
 }
 
+// ErrMFANotStarted is returned when an MFA code is verified before setup was started.
+var ErrMFANotStarted = apperrors.NewAppError("MFA_NOT_STARTED", "MFA setup has not been started", http.StatusBadRequest)
+
 // SetupMFARequest contains parameters for initiating MFA setup.
 type SetupMFARequest struct {
 	UserID string           `json:"userID" binding:"required"` // Internal or Cognito User ID (usually Cognito Sub)
 	Method models.MFAMethod `json:"method" binding:"required"` // e.g., "TOTP", "SMS"
+	// TOTP enrollment needs either the user's access token or the session of an MFA_SETUP login challenge
+	AccessToken string `json:"-"`
+	Session     string `json:"session,omitempty"`
 }
 
 // SetupMFAResponse contains data needed for the user to complete MFA setup.
 type SetupMFAResponse struct {
 	QRCodeURI string `json:"qrCodeUri,omitempty"` // For TOTP
 	Secret    string `json:"secret,omitempty"`    // For TOTP, to display to the user as an alternative
+	Session   string `json:"session,omitempty"`   // Updated challenge session when enrolling during login
 	// For SMS, might include delivery details or just a success message
 }
 
 // SetupMFA initiates the MFA setup process for a user.
+// TOTP enrollment asks the provider for a shared secret and returns it as an otpauth:// URI;
+// SMS MFA is enabled directly, relying on the user's verified phone number at the provider.
 func (s *AuthService) SetupMFA(ctx context.Context, req SetupMFARequest) (*SetupMFAResponse, error) {
-	// TODO:
-	// 1. Call the identity provider (e.g., Cognito `AssociateSoftwareToken` or `SetUserMFAPreference` for SMS).
-	//    - For TOTP (AssociateSoftwareToken), Cognito returns a SecretCode.
-	//    - Construct QRCodeURI: fmt.Sprintf("otpauth://totp/%s:%s?secret=%s&issuer=%s", issuer, username, secret, issuer)
-	// 2. Return the necessary information.
-
-	// Placeholder implementation:
-	if req.Method == models.MFAMethodTOTP {
-		// This is a dummy response. Real values come from Cognito.
+	user, err := s.resolveUser(ctx, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.usesLocalMFA(user) {
+		if req.AccessToken == "" {
+			return nil, apperrors.ErrUnauthorized
+		}
+		if req.Method != models.MFAMethodTOTP {
+			return nil, unsupportedMFAMethod(req.Method)
+		}
+		enrollment, err := s.localMFA.Enroll(ctx, user.ID, user.Email)
+		if err != nil {
+			return nil, fmt.Errorf("local MFA enrollment failed: %w", mfaError(err))
+		}
+		return &SetupMFAResponse{QRCodeURI: enrollment.KeyURI, Secret: enrollment.Secret}, nil
+	}
+
+	switch req.Method {
+	case models.MFAMethodTOTP:
+		if req.AccessToken == "" && req.Session == "" {
+			return nil, apperrors.ErrUnauthorized
+		}
+
+		result, err := s.provider.AssociateSoftwareToken(ctx, authprovider.AssociateSoftwareTokenRequestData{
+			AccessToken: req.AccessToken,
+			Session:     req.Session,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("provider AssociateSoftwareToken failed: %w", mfaError(err))
+		}
+
 		return &SetupMFAResponse{
-			QRCodeURI: "otpauth://totp/YourApp:user@example.com?secret=JBSWY3DPEHPK3PXP&issuer=YourApp",
-			Secret:    "JBSWY3DPEHPK3PXP",
+			QRCodeURI: mfa.KeyURI(s.mfaIssuer(), user.Email, result.SecretCode),
+			Secret:    result.SecretCode,
+			Session:   result.Session,
 		}, nil
-	} else if req.Method == models.MFAMethodSMS {
-		// SMS MFA setup might involve verifying phone number first if not already done.
-		// Cognito's SetUserMFAPreference handles enabling SMS MFA if phone_number_verified is true.
-		return &SetupMFAResponse{}, nil // Or a message indicating SMS MFA setup initiated
+	case models.MFAMethodSMS:
+		// Cognito's SetUserMFAPreference enables SMS MFA if phone_number_verified is true.
+		err := s.provider.SetMFAPreference(ctx, authprovider.SetMFAPreferenceRequestData{
+			Username: user.CognitoSub,
+			SMS:      &authprovider.MFAPreference{Enabled: true, Preferred: !user.MFAEnabled},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("provider SetMFAPreference failed: %w", mfaError(err))
+		}
+
+		user.AddMFAMethod(models.MFAMethodSMS)
+		if err := s.userRepository.UpdateUser(ctx, user); err != nil {
+			return nil, fmt.Errorf("failed to save MFA methods: %w", err)
+		}
+		return &SetupMFAResponse{}, nil
 	}
-	return nil, fmt.Errorf("unsupported MFA method: %s", req.Method)
+	return nil, unsupportedMFAMethod(req.Method)
+}
+
+// unsupportedMFAMethod rejects an MFA method the user's engine cannot enroll.
+func unsupportedMFAMethod(method models.MFAMethod) error {
+	return apperrors.NewAppError("INVALID_MFA_METHOD", fmt.Sprintf("Unsupported MFA method %q", method), http.StatusBadRequest)
+}
+
+// mfaError maps local MFA engine and provider enrollment errors to API errors.
+func mfaError(err error) error {
+	switch {
+	case errors.Is(err, mfa.ErrInvalidCode), errors.Is(err, mfa.ErrReplayedCode):
+		return apperrors.ErrCodeMismatch
+	case errors.Is(err, mfa.ErrNotEnrolled):
+		return ErrMFANotStarted
+	case errors.Is(err, authprovider.ErrNotAuthorized):
+		return apperrors.ErrUnauthorized
+	}
+	return providerError(err)
 }
 
 // VerifyMFARequest contains parameters for verifying an MFA code.
@@ -177,25 +314,125 @@ type VerifyMFARequest struct {
 	UserID     string `json:"userID" binding:"required"` // Cognito User Sub
 	MFACode    string `json:"mfaCode" binding:"required"`
 	DeviceName string `json:"deviceName,omitempty"` // Optional, friendly name for the MFA device (especially for TOTP)
+	// Same credentials as used for SetupMFA
+	AccessToken string `json:"-"`
+	Session     string `json:"session,omitempty"`
 }
 
 // VerifyMFAResponse indicates if MFA verification was successful.
 type VerifyMFAResponse struct {
-	Status string `json:"status"`
-	// Could include session tokens if login is completed upon MFA verification.
+	Status        string   `json:"status"`
+	Session       string   `json:"session,omitempty"`       // Pass back to /auth/login/challenge to finish an MFA_SETUP login
+	RecoveryCodes []string `json:"recoveryCodes,omitempty"` // Issued once by the local MFA engine
 }
 
-// VerifyMFA verifies an MFA code provided by the user.
+// VerifyMFA verifies the first TOTP code after SetupMFA, then enables TOTP as the
+// user's preferred MFA method at the provider and records the enrollment locally.
 func (s *AuthService) VerifyMFA(ctx context.Context, req VerifyMFARequest) (*VerifyMFAResponse, error) {
-	// TODO:
-	// 1. Call the identity provider (e.g., Cognito `VerifySoftwareToken` for TOTP or handle SMS challenge response).
-	// 2. If successful, Cognito usually marks the device/method as verified.
-	// 3. If this is part of login, proceed to create a session.
+	user, err := s.resolveUser(ctx, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.usesLocalMFA(user) {
+		if req.AccessToken == "" {
+			return nil, apperrors.ErrUnauthorized
+		}
+		recoveryCodes, err := s.localMFA.Confirm(ctx, user.ID, req.MFACode)
+		if err != nil {
+			return nil, fmt.Errorf("local MFA verification failed: %w", mfaError(err))
+		}
+
+		user.AddMFAMethod(models.MFAMethodTOTP)
+		user.PreferredMFAMethod = models.MFAMethodTOTP
+		if err := s.userRepository.UpdateUser(ctx, user); err != nil {
+			return nil, fmt.Errorf("failed to save MFA methods: %w", err)
+		}
+		return &VerifyMFAResponse{Status: "verified", RecoveryCodes: recoveryCodes}, nil
+	}
 
-	// Placeholder implementation:
-	// For VerifySoftwareToken, if successful, status is SUCCESS.
-	// If it's a new device, it might prompt to remember it.
-	return &VerifyMFAResponse{Status: "verified"}, nil
+	if req.AccessToken == "" && req.Session == "" {
+		return nil, apperrors.ErrUnauthorized
+	}
+
+	result, err := s.provider.VerifySoftwareToken(ctx, authprovider.VerifySoftwareTokenRequestData{
+		AccessToken:        req.AccessToken,
+		Session:            req.Session,
+		UserCode:           req.MFACode,
+		FriendlyDeviceName: req.DeviceName,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("provider VerifySoftwareToken failed: %w", mfaError(err))
+	}
+	if result.Status != "SUCCESS" {
+		return nil, fmt.Errorf("MFA code verification failed with status %s: %w", result.Status, apperrors.ErrCodeMismatch)
+	}
+
+	// During an MFA_SETUP login challenge the caller is not authenticated yet, so the
+	// enrollment is recorded once the challenge completes (see RespondToLoginChallenge)
+	if req.AccessToken == "" {
+		return &VerifyMFAResponse{Status: "verified", Session: result.Session}, nil
+	}
+
+	err = s.provider.SetMFAPreference(ctx, authprovider.SetMFAPreferenceRequestData{
+		Username: user.CognitoSub,
+		TOTP:     &authprovider.MFAPreference{Enabled: true, Preferred: true},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("provider SetMFAPreference failed: %w", err)
+	}
+
+	user.AddMFAMethod(models.MFAMethodTOTP)
+	user.PreferredMFAMethod = models.MFAMethodTOTP
+	if err := s.userRepository.UpdateUser(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to save MFA methods: %w", err)
+	}
+
+	return &VerifyMFAResponse{Status: "verified", Session: result.Session}, nil
+}
+
+// resolveUser looks up a user by internal ID, falling back to the Cognito sub.
+func (s *AuthService) resolveUser(ctx context.Context, userID string) (*models.User, error) {
+	if id, err := uuid.Parse(userID); err == nil {
+		if user, err := s.userRepository.GetUserByID(ctx, id); err == nil {
+			return user, nil
+		}
+	}
+
+	user, err := s.userRepository.GetUserByCognitoSub(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return user, nil
+}
+
+// mfaIssuer returns the issuer name shown in authenticator apps.
+func (s *AuthService) mfaIssuer() string {
+	if s.config.MFA.Issuer != "" {
+		return s.config.MFA.Issuer
+	}
+	return "Shield"
+}
+
+// SecureCookies reports whether cookies must carry the Secure attribute.
+func (s *AuthService) SecureCookies() bool {
+	if s.sessionCookies != nil {
+		return s.sessionCookies.Config().Secure
+	}
+	return s.config.Server.Environment == "production"
+}
+
+// usesLocalMFA decides whether the user's second factor is handled by the local engine.
+// An explicit organization setting wins; otherwise provider MFA is used when it is enabled
+// for the deployment (FeaturesConfig.MultiFactorAuth) and the local engine covers the rest.
+func (s *AuthService) usesLocalMFA(user *models.User) bool {
+	if s.localMFA == nil {
+		return false
+	}
+	if user.Organization != nil && user.Organization.MFAEngine != "" {
+		return user.Organization.MFAEngine == models.MFAEngineLocal
+	}
+	return !s.config.Features.MultiFactorAuth
 }
 
 // --- Organization Signup Flow ---
@@ -225,16 +462,17 @@ func (s *AuthService) OrgSignup(ctx context.Context, req OrgSignupRequest) (*Org
 		// Set other fields as needed
 	}
 
-	if err := s.userRepository.CreateOrganization(ctx, org); err != nil {
+	job, err := s.startSignup(ctx, req.AdminEmail, org)
+	if err != nil {
 		return nil, fmt.Errorf("failed to create organization in database: %w", err)
 	}
 
 	// 2. Create admin user in Cognito with organization reference
-	adminUserAttrs := []types.AttributeType{
-		{Name: awsString("email"), Value: awsString(req.AdminEmail)},
-		{Name: awsString("email_verified"), Value: awsString("true")}, // Or handle verification separately
-		{Name: awsString("custom:org_id"), Value: awsString(org.ID.String())},
-		{Name: awsString("custom:user_type"), Value: awsString("organization_admin")},
+	adminUserAttrs := []authprovider.UserAttribute{
+		{Name: "email", Value: req.AdminEmail},
+		{Name: "email_verified", Value: "true"}, // Or handle verification separately
+		{Name: "custom:org_id", Value: org.ID.String()},
+		{Name: "custom:user_type", Value: "organization_admin"},
 	}
 	adminReq := authprovider.AdminCreateUserRequestData{
 		Username:          req.AdminEmail,
@@ -248,61 +486,80 @@ func (s *AuthService) OrgSignup(ctx context.Context, req OrgSignupRequest) (*Org
 	}
 
 	adminCognitoUser, err := s.provider.AdminCreateUser(ctx, adminReq)
+	if err == nil && (adminCognitoUser == nil || adminCognitoUser.User == nil) {
+		err = errors.New("provider returned no user")
+	}
 	if err != nil {
+		s.rollbackSignup(ctx, job) // Removes the organization again
 		return nil, fmt.Errorf("failed to create admin user in Cognito: %w", err)
 	}
+	adminUserID := adminCognitoUser.User.CognitoSub // Use actual Cognito Sub
+
+	// 3. Create admin user record in local database
+	adminUser := &models.User{
+		Email:      req.AdminEmail,
+		CognitoSub: adminCognitoUser.User.CognitoSub,
+		OrgID:      org.ID,
+		UserType:   models.UserTypeOrgAdmin,
+		IsVerified: true, // Admin users are typically verified immediately
+	}
 
-	adminUserID := ""
-	if adminCognitoUser != nil && adminCognitoUser.User != nil {
-		adminUserID = adminCognitoUser.User.CognitoSub // Use actual Cognito Sub
-
-		// 3. Create admin user record in local database
-		adminUser := &models.User{
-			Email:      req.AdminEmail,
-			CognitoSub: adminCognitoUser.User.CognitoSub,
-			OrgID:      org.ID,
-			UserType:   models.UserTypeOrganization, // or create a specific admin type if needed
-			IsVerified: true,                        // Admin users are typically verified immediately
-		}
-
-		if err := s.userRepository.CreateUser(ctx, adminUser); err != nil {
-			// Log the error but don't fail the signup - user is already created in Cognito
-			fmt.Printf("Warning: Failed to create admin user in local database: %v\n", err)
-		}
+	err = s.recordProviderUser(ctx, job, adminUserID)
+	if err == nil {
+		err = s.completeSignup(ctx, adminUser, job)
+	}
+	if err != nil {
+		s.rollbackSignup(ctx, job)
+		return nil, fmt.Errorf("failed to create admin user in database: %w", err)
 	}
 
 	return &OrgSignupResponse{
 		OrgID:       org.ID.String(),
 		AdminUserID: adminUserID,
+		SSOLoginURL: SSOLoginURL(org.ID.String()), // Usable once an identity provider is registered for the org
 		Message:     "Organization and admin user created successfully. SSO setup may be required.",
-		// SSOLoginURL can be constructed later when SSO is configured
 	}, nil
 }
 
 // Ensure models.UserTypeIndividual is accessible
 var _ = models.UserTypeIndividual
 
-// Helper to get aws.String without importing aws package directly in all service files
-func awsString(s string) *string {
-	if s == "" {
-		return nil // Or handle as per AWS SDK's expectation for empty strings
-	}
-	return &s
-}
-
 // LoginRequest contains parameters for user login
 type LoginRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required"`
 }
 
-// LoginResponse contains the result of a user login
+// LoginResponse contains the result of a user login.
+// When Challenge is set the login is still pending and no tokens or session are issued.
 type LoginResponse struct {
-	AccessToken  string `json:"accessToken"`
-	RefreshToken string `json:"refreshToken"`
-	ExpiresIn    int    `json:"expiresIn"`
-	SessionID    string `json:"sessionId"`
-	UserID       string `json:"userId"`
+	AccessToken  string          `json:"accessToken"`
+	RefreshToken string          `json:"refreshToken"`
+	ExpiresIn    int             `json:"expiresIn"`
+	SessionID    string          `json:"sessionId"`
+	UserID       string          `json:"userId"`
+	Challenge    *LoginChallenge `json:"challenge,omitempty"`
+}
+
+// LoginChallenge describes an authentication step the user still has to complete
+// (e.g. SOFTWARE_TOKEN_MFA, SMS_MFA, NEW_PASSWORD_REQUIRED, CUSTOM_CHALLENGE).
+type LoginChallenge struct {
+	Name       string            `json:"name"`
+	Session    string            `json:"session"` // Provider session token, passed back with the challenge answer
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+// ChallengePending reports whether the login requires a challenge response.
+func (r *LoginResponse) ChallengePending() bool {
+	return r.Challenge != nil
+}
+
+// LoginChallengeRequest contains the answer to a pending login challenge
+type LoginChallengeRequest struct {
+	Email         string            `json:"email" binding:"required,email"`
+	ChallengeName string            `json:"challengeName" binding:"required"`
+	Session       string            `json:"session" binding:"required"`
+	Responses     map[string]string `json:"responses" binding:"required"`
 }
 
 // RefreshTokenRequest contains parameters for token refresh
@@ -312,8 +569,10 @@ type RefreshTokenRequest struct {
 
 // RefreshTokenResponse contains the result of token refresh
 type RefreshTokenResponse struct {
-	AccessToken string `json:"accessToken"`
-	ExpiresIn   int    `json:"expiresIn"`
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"` // Rotated Shield refresh token; the previous one is no longer valid
+	ExpiresIn    int    `json:"expiresIn"`
+	SessionID    string `json:"sessionId"`
 }
 
 // Login authenticates a user and creates a session
@@ -329,14 +588,189 @@ func (s *AuthService) Login(ctx context.Context, req LoginRequest, clientInfo se
 		return nil, fmt.Errorf("authentication failed: %w", err)
 	}
 
+	return s.completeLogin(ctx, authResult, clientInfo)
+}
+
+// RespondToLoginChallenge answers a challenge returned by Login and creates the session
+// once the provider reports the authentication as complete.
+func (s *AuthService) RespondToLoginChallenge(ctx context.Context, req LoginChallengeRequest, clientInfo session.ClientInfo) (*LoginResponse, error) {
+	challengeReq := authprovider.RespondToAuthChallengeRequestData{
+		Username:      req.Email,
+		ChallengeName: req.ChallengeName,
+		Session:       req.Session,
+		Responses:     req.Responses,
+	}
+
+	if s.localMFA != nil && strings.HasPrefix(req.Session, localChallengePrefix) {
+		return s.respondToLocalMFAChallenge(ctx, req, clientInfo)
+	}
+
+	authResult, err := s.provider.RespondToAuthChallenge(ctx, challengeReq)
+	if err != nil {
+		return nil, fmt.Errorf("challenge response failed: %w", err)
+	}
+
+	if req.ChallengeName == "MFA_SETUP" && authResult.ChallengeName == "" {
+		if err := s.recordTOTPEnrollment(ctx, authResult.UserSub); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.completeLogin(ctx, authResult, clientInfo)
+}
+
+// recordTOTPEnrollment records TOTP as the preferred MFA method of a user who enrolled
+// while answering an MFA_SETUP challenge.
+func (s *AuthService) recordTOTPEnrollment(ctx context.Context, userSub string) error {
+	user, err := s.userRepository.GetUserByCognitoSub(ctx, userSub)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	user.AddMFAMethod(models.MFAMethodTOTP)
+	user.PreferredMFAMethod = models.MFAMethodTOTP
+	if err := s.userRepository.UpdateUser(ctx, user); err != nil {
+		return fmt.Errorf("failed to save MFA methods: %w", err)
+	}
+	return nil
+}
+
+// localChallengePrefix marks challenge sessions issued by the local MFA engine.
+const localChallengePrefix = "local."
+
+// localMFAChallenge returns a SOFTWARE_TOKEN_MFA challenge backed by the local engine.
+func (s *AuthService) localMFAChallenge(user *models.User, authResult *authprovider.AuthenticateOutputData) (*LoginResponse, error) {
+	sealed, err := s.localMFA.SealPendingLogin(mfa.PendingLogin{
+		UserID:       user.ID,
+		UserSub:      authResult.UserSub,
+		AccessToken:  authResult.AccessToken,
+		RefreshToken: authResult.RefreshToken,
+		ExpiresIn:    authResult.ExpiresIn,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create MFA challenge: %w", err)
+	}
+
+	return &LoginResponse{
+		Challenge: &LoginChallenge{
+			Name:       "SOFTWARE_TOKEN_MFA",
+			Session:    localChallengePrefix + sealed,
+			Parameters: map[string]string{"MFA_ENGINE": string(models.MFAEngineLocal)},
+		},
+	}, nil
+}
+
+// respondToLocalMFAChallenge verifies a TOTP or recovery code against the local engine
+// and creates the session from the provider tokens held in the challenge.
+func (s *AuthService) respondToLocalMFAChallenge(ctx context.Context, req LoginChallengeRequest, clientInfo session.ClientInfo) (*LoginResponse, error) {
+	pending, err := s.localMFA.OpenPendingLogin(strings.TrimPrefix(req.Session, localChallengePrefix))
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepository.GetUserByID(ctx, pending.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if !strings.EqualFold(user.Email, req.Email) {
+		return nil, mfa.ErrInvalidChallenge
+	}
+	if err := s.checkMFAAttempts(ctx, pending); err != nil {
+		return nil, err
+	}
+
+	if code := req.Responses["RECOVERY_CODE"]; code != "" {
+		err = s.localMFA.VerifyRecoveryCode(ctx, user.ID, code)
+	} else {
+		err = s.localMFA.Verify(ctx, user.ID, req.Responses["SOFTWARE_TOKEN_MFA_CODE"])
+	}
+	if err != nil {
+		if errors.Is(err, mfa.ErrInvalidCode) || errors.Is(err, mfa.ErrReplayedCode) || errors.Is(err, mfa.ErrRecoveryCodeInvalid) {
+			s.recordMFAFailure(ctx, pending)
+		}
+		return nil, fmt.Errorf("local MFA verification failed: %w", err)
+	}
+
+	return s.startSession(ctx, user, &authprovider.AuthenticateOutputData{
+		AccessToken:  pending.AccessToken,
+		RefreshToken: pending.RefreshToken,
+		ExpiresIn:    pending.ExpiresIn,
+		UserSub:      pending.UserSub,
+	}, clientInfo)
+}
+
+// checkMFAAttempts rejects a local MFA challenge whose failed codes used up the challenge
+// or user limit. Limiter failures are logged and let the request through.
+func (s *AuthService) checkMFAAttempts(ctx context.Context, pending *mfa.PendingLogin) error {
+	if s.mfaChallengeLimit != nil {
+		blocked, _, err := s.mfaChallengeLimit.Blocked(ctx, "challenge:"+pending.ID)
+		if err != nil {
+			log.Printf("MFA attempt limit check failed: %v", err)
+		} else if blocked {
+			return mfa.ErrInvalidChallenge
+		}
+	}
+	if s.mfaUserLimit != nil {
+		blocked, retryAfter, err := s.mfaUserLimit.Blocked(ctx, "user:"+pending.UserID.String())
+		if err != nil {
+			log.Printf("MFA attempt limit check failed: %v", err)
+		} else if blocked {
+			return &apperrors.RetryAfterError{AppError: apperrors.ErrAttemptLimitExceeded, RetryAfter: retryAfter}
+		}
+	}
+	return nil
+}
+
+// recordMFAFailure counts a wrong local MFA code against the challenge and the user.
+func (s *AuthService) recordMFAFailure(ctx context.Context, pending *mfa.PendingLogin) {
+	if s.mfaChallengeLimit != nil {
+		if _, _, err := s.mfaChallengeLimit.Allow(ctx, "challenge:"+pending.ID); err != nil {
+			log.Printf("Failed to record MFA attempt: %v", err)
+		}
+	}
+	if s.mfaUserLimit != nil {
+		if _, _, err := s.mfaUserLimit.Allow(ctx, "user:"+pending.UserID.String()); err != nil {
+			log.Printf("Failed to record MFA attempt: %v", err)
+		}
+	}
+}
+
+// completeLogin turns a provider authentication result into a LoginResponse.
+// A pending challenge is returned as-is; the session is only created after the provider issues tokens.
+func (s *AuthService) completeLogin(ctx context.Context, authResult *authprovider.AuthenticateOutputData, clientInfo session.ClientInfo) (*LoginResponse, error) {
+	if authResult.ChallengeName != "" {
+		return &LoginResponse{
+			Challenge: &LoginChallenge{
+				Name:       authResult.ChallengeName,
+				Session:    authResult.Session,
+				Parameters: authResult.ChallengeParameters,
+			},
+		}, nil
+	}
+
 	// Get user from database
 	user, err := s.userRepository.GetUserByCognitoSub(ctx, authResult.UserSub)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 
+	// Hold the provider tokens back until the local second factor is verified
+	if s.usesLocalMFA(user) && user.HasMFAMethod(models.MFAMethodTOTP) {
+		return s.localMFAChallenge(user, authResult)
+	}
+
+	return s.startSession(ctx, user, authResult, clientInfo)
+}
+
+// startSession creates the Shield session for an authenticated user.
+func (s *AuthService) startSession(ctx context.Context, user *models.User, authResult *authprovider.AuthenticateOutputData, clientInfo session.ClientInfo) (*LoginResponse, error) {
+	tokens, err := s.providerTokens(authResult)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create session
-	sessionData, err := s.sessionManager.CreateSession(ctx, user.ID, clientInfo)
+	sessionData, err := s.sessionManager.CreateSession(ctx, user.ID, clientInfo, tokens)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create session: %w", err)
 	}
@@ -350,39 +784,52 @@ func (s *AuthService) Login(ctx context.Context, req LoginRequest, clientInfo se
 	}, nil
 }
 
-// RefreshToken refreshes an access token using refresh token
+// RefreshToken mints a new access token with the provider refresh token stored (encrypted) on
+// the session and rotates the Shield refresh token. The Shield token is only rotated once the
+// provider has issued new tokens, so a failed provider refresh can be retried with it.
 func (s *AuthService) RefreshToken(ctx context.Context, req RefreshTokenRequest) (*RefreshTokenResponse, error) {
-	// Find session by refresh token
-	// Note: This is a simplified approach. In production, you might want to hash refresh tokens
-	// or use a more secure method to link refresh tokens to sessions
-
-	// For now, we'll need to add a method to find session by refresh token
-	// This would require updating the session repository interface
-
-	refreshReq := authprovider.RefreshTokenRequestData{
-		RefreshToken: req.RefreshToken,
+	var refreshResult *authprovider.RefreshTokenOutputData
+	var providerErr error
+	sessionData, err := s.sessionManager.RefreshSession(ctx, req.RefreshToken, func(sessionData *models.Session) error {
+		refreshResult, providerErr = s.refreshProviderTokens(ctx, sessionData)
+		return providerErr
+	})
+	if providerErr != nil {
+		return nil, providerErr
 	}
-
-	refreshResult, err := s.provider.RefreshToken(ctx, refreshReq)
 	if err != nil {
-		return nil, fmt.Errorf("token refresh failed: %w", err)
+		var reuseErr *session.ReuseError
+		if errors.As(err, &reuseErr) {
+			log.Printf("Refresh token reuse detected for session %s; session ended", reuseErr.Session.ID)
+			s.revokeProviderToken(ctx, reuseErr.Session)
+		}
+		return nil, apperrors.ErrInvalidToken
 	}
 
 	return &RefreshTokenResponse{
-		AccessToken: refreshResult.AccessToken,
-		ExpiresIn:   int(refreshResult.ExpiresIn),
+		AccessToken:  refreshResult.AccessToken,
+		RefreshToken: sessionData.RefreshToken,
+		ExpiresIn:    int(refreshResult.ExpiresIn),
+		SessionID:    sessionData.ID,
 	}, nil
 }
 
-// Logout invalidates a user session
-func (s *AuthService) Logout(ctx context.Context, sessionID string) error {
-	// Invalidate session
-	if err := s.sessionManager.InvalidateSession(ctx, sessionID); err != nil {
-		return fmt.Errorf("failed to invalidate session: %w", err)
+// refreshProviderTokens obtains fresh provider tokens with the refresh token stored on a session.
+func (s *AuthService) refreshProviderTokens(ctx context.Context, sessionData *models.Session) (*authprovider.RefreshTokenOutputData, error) {
+	if s.tokenSealer == nil || sessionData.ProviderRefreshToken == "" {
+		return nil, fmt.Errorf("session %s has no provider refresh token", sessionData.ID)
+	}
+	providerToken, err := s.tokenSealer.Open(sessionData.ProviderRefreshToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt provider refresh token: %w", err)
 	}
 
-	// Optionally, you could also revoke the token from the provider
-	// This would require implementing a revoke method in the provider interface
-
-	return nil
+	refreshResult, err := s.provider.RefreshToken(ctx, authprovider.RefreshTokenRequestData{
+		RefreshToken: string(providerToken),
+		Username:     sessionData.ProviderUsername,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("token refresh failed: %w", err)
+	}
+	return refreshResult, nil
 }
@@ -0,0 +1,115 @@
+package session
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"shield/modules/common/crypto"
+)
+
+// ErrInvalidCookie is returned for a session cookie with a missing or bad signature
+var ErrInvalidCookie = errors.New("session: invalid session cookie")
+
+// Session delivery modes
+const (
+	ModeToken  = "token"  // Tokens are returned in the JSON body and sent as bearer tokens
+	ModeCookie = "cookie" // An HttpOnly cookie referencing the session is set instead
+)
+
+// CookieConfig describes the session cookie.
+type CookieConfig struct {
+	Name     string
+	Domain   string
+	Path     string
+	SameSite http.SameSite
+	Secure   bool
+	MaxAge   time.Duration // Zero makes it a browser-session cookie
+}
+
+// DefaultCookieName is used when no cookie name is configured
+const DefaultCookieName = "shield_session"
+
+// ParseSameSite converts a configured SameSite value ("lax", "strict", "none") to http.SameSite.
+// Unknown or empty values default to Lax, which still allows the SSO callback redirect.
+func ParseSameSite(value string) http.SameSite {
+	switch strings.ToLower(value) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
+
+// CookieCodec signs session IDs for use as cookie values, so a cookie can only
+// reference sessions that Shield issued.
+type CookieCodec struct {
+	config CookieConfig
+	signer *crypto.Signer
+}
+
+// NewCookieCodec creates a CookieCodec, filling in defaults for the cookie name and path.
+func NewCookieCodec(config CookieConfig, signer *crypto.Signer) *CookieCodec {
+	if config.Name == "" {
+		config.Name = DefaultCookieName
+	}
+	if config.Path == "" {
+		config.Path = "/"
+	}
+	if config.SameSite == 0 {
+		config.SameSite = http.SameSiteLaxMode
+	}
+	// Browsers reject SameSite=None cookies without Secure
+	if config.SameSite == http.SameSiteNoneMode {
+		config.Secure = true
+	}
+	return &CookieCodec{config: config, signer: signer}
+}
+
+// Config returns the cookie attributes.
+func (c *CookieCodec) Config() CookieConfig {
+	return c.config
+}
+
+// Encode returns the signed cookie value for a session ID.
+func (c *CookieCodec) Encode(sessionID string) string {
+	return c.signer.Sign(sessionID)
+}
+
+// Decode verifies a cookie value and returns the session ID it references.
+func (c *CookieCodec) Decode(value string) (string, error) {
+	sessionID, err := c.signer.Verify(value)
+	if err != nil || sessionID == "" {
+		return "", ErrInvalidCookie
+	}
+	return sessionID, nil
+}
+
+// Cookie returns the session cookie for a session ID.
+func (c *CookieCodec) Cookie(sessionID string) *http.Cookie {
+	cookie := c.baseCookie()
+	cookie.Value = c.Encode(sessionID)
+	cookie.MaxAge = int(c.config.MaxAge.Seconds())
+	return cookie
+}
+
+// ClearCookie returns a cookie that removes the session cookie from the browser.
+func (c *CookieCodec) ClearCookie() *http.Cookie {
+	cookie := c.baseCookie()
+	cookie.MaxAge = -1
+	return cookie
+}
+
+func (c *CookieCodec) baseCookie() *http.Cookie {
+	return &http.Cookie{
+		Name:     c.config.Name,
+		Domain:   c.config.Domain,
+		Path:     c.config.Path,
+		SameSite: c.config.SameSite,
+		Secure:   c.config.Secure,
+		HttpOnly: true,
+	}
+}
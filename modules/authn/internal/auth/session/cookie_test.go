@@ -0,0 +1,91 @@
+package session
+
+import (
+	"net/http"
+	"testing"
+
+	"shield/modules/common/crypto"
+)
+
+func newTestCodec(t *testing.T, key, purpose string, config CookieConfig) *CookieCodec {
+	t.Helper()
+	signer, err := crypto.NewSigner(key, purpose)
+	if err != nil {
+		t.Fatalf("NewSigner() error = %v", err)
+	}
+	return NewCookieCodec(config, signer)
+}
+
+func TestCookieCodecDecode(t *testing.T) {
+	codec := newTestCodec(t, "secret", "session-cookie", CookieConfig{})
+	valid := codec.Encode("session-1")
+
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"valid", valid, "session-1", false},
+		{"unsigned", "session-1", "", true},
+		{"other session id", "session-2" + valid[len("session-1"):], "", true},
+		{"bad signature", valid[:len(valid)-2] + "xx", "", true},
+		{"other key", newTestCodec(t, "other", "session-cookie", CookieConfig{}).Encode("session-1"), "", true},
+		{"other purpose", newTestCodec(t, "secret", "nonce", CookieConfig{}).Encode("session-1"), "", true},
+		{"empty session id", codec.Encode(""), "", true},
+		{"empty", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := codec.Decode(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Decode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCookieCodecCookie(t *testing.T) {
+	codec := newTestCodec(t, "secret", "session-cookie", CookieConfig{
+		Domain:   "example.com",
+		SameSite: ParseSameSite("none"),
+	})
+
+	cookie := codec.Cookie("session-1")
+	if cookie.Name != DefaultCookieName || cookie.Path != "/" || cookie.Domain != "example.com" {
+		t.Errorf("Cookie() = %s, want default name and path with configured domain", cookie)
+	}
+	if !cookie.HttpOnly {
+		t.Error("Cookie() is not HttpOnly")
+	}
+	if cookie.SameSite != http.SameSiteNoneMode || !cookie.Secure {
+		t.Error("Cookie() with SameSite=None must be Secure")
+	}
+	if id, err := codec.Decode(cookie.Value); err != nil || id != "session-1" {
+		t.Errorf("Decode(Cookie().Value) = %q, %v", id, err)
+	}
+
+	if clear := codec.ClearCookie(); clear.MaxAge >= 0 || clear.Value != "" {
+		t.Errorf("ClearCookie() = %s, want an expired empty cookie", clear)
+	}
+}
+
+func TestParseSameSite(t *testing.T) {
+	tests := map[string]http.SameSite{
+		"strict": http.SameSiteStrictMode,
+		"Strict": http.SameSiteStrictMode,
+		"none":   http.SameSiteNoneMode,
+		"lax":    http.SameSiteLaxMode,
+		"":       http.SameSiteLaxMode,
+		"bogus":  http.SameSiteLaxMode,
+	}
+	for value, want := range tests {
+		if got := ParseSameSite(value); got != want {
+			t.Errorf("ParseSameSite(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package session
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"shield/modules/authn/internal/models"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned for unknown refresh tokens and tokens of ended sessions
+	ErrInvalidRefreshToken = errors.New("session: invalid refresh token")
+	// ErrRefreshTokenExpired is returned when the session can no longer be refreshed
+	ErrRefreshTokenExpired = errors.New("session: refresh token expired")
+	// ErrRefreshTokenReused matches a *ReuseError with errors.Is
+	ErrRefreshTokenReused = errors.New("session: refresh token reused")
+)
+
+// ReuseError reports that an already rotated refresh token was presented again.
+// The session it belonged to has been invalidated.
+type ReuseError struct {
+	Session *models.Session
+}
+
+func (e *ReuseError) Error() string {
+	return fmt.Sprintf("%v: session %s invalidated", ErrRefreshTokenReused, e.Session.ID)
+}
+
+// Is makes errors.Is(err, ErrRefreshTokenReused) true for a *ReuseError.
+func (e *ReuseError) Is(target error) bool {
+	return target == ErrRefreshTokenReused
+}
+
+// newRefreshToken returns a random opaque refresh token.
+func newRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashRefreshToken returns the hash under which a refresh token is stored.
+// Tokens are random, so an unsalted SHA-256 is sufficient.
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -12,11 +12,14 @@ import (
 
 // SessionManager handles session creation, validation, and cleanup
 type SessionManager interface {
-	CreateSession(ctx context.Context, userID uuid.UUID, clientInfo ClientInfo) (*models.Session, error)
+	CreateSession(ctx context.Context, userID uuid.UUID, clientInfo ClientInfo, tokens ProviderTokens) (*models.Session, error)
 	GetSession(ctx context.Context, sessionID string) (*models.Session, error)
+	GetUserSessions(ctx context.Context, userID uuid.UUID) ([]*models.Session, error)
 	ValidateSession(ctx context.Context, sessionID string) (*models.Session, error)
+	ValidateTokenSession(ctx context.Context, tokenID string) (*models.Session, error)
 	InvalidateSession(ctx context.Context, sessionID string) error
-	RefreshSession(ctx context.Context, sessionID string) (*models.Session, error)
+	InvalidateUserSessions(ctx context.Context, userID uuid.UUID) ([]*models.Session, error)
+	RefreshSession(ctx context.Context, refreshToken string, renew func(*models.Session) error) (*models.Session, error)
 	CleanupExpiredSessions(ctx context.Context) error
 }
 
@@ -27,6 +30,13 @@ type ClientInfo struct {
 	DeviceID  string
 }
 
+// ProviderTokens links a session to the tokens issued by the auth provider
+type ProviderTokens struct {
+	TokenID      string // origin_jti shared by the provider's access and ID tokens
+	RefreshToken string // Encrypted provider refresh token
+	Username     string // Username the tokens were issued to; needed to refresh them
+}
+
 // SessionRepository defines the interface for session persistence
 type SessionRepository interface {
 	CreateSession(ctx context.Context, session *models.Session) error
@@ -35,6 +45,10 @@ type SessionRepository interface {
 	DeleteSession(ctx context.Context, sessionID string) error
 	DeleteExpiredSessions(ctx context.Context) error
 	GetSessionsByUserID(ctx context.Context, userID uuid.UUID) ([]*models.Session, error)
+	GetSessionByRefreshTokenHash(ctx context.Context, tokenHash string) (*models.Session, error)
+	GetSessionByProviderTokenID(ctx context.Context, tokenID string) (*models.Session, error)
+	GetRotatedRefreshToken(ctx context.Context, tokenHash string) (*models.RotatedRefreshToken, error)
+	RotateRefreshToken(ctx context.Context, session *models.Session, previousHash string) error
 }
 
 // DefaultSessionManager is the default implementation of SessionManager
@@ -47,7 +61,8 @@ type DefaultSessionManager struct {
 type SessionConfig struct {
 	SessionTTL    time.Duration
 	RefreshTTL    time.Duration
-	MaxSessions   int // Maximum sessions per user
+	MaxLifetime   time.Duration // Absolute lifetime of a session from login; refreshes never extend it past that
+	MaxSessions   int           // Maximum sessions per user
 	SecureCookies bool
 }
 
@@ -60,22 +75,30 @@ func NewDefaultSessionManager(repo SessionRepository, config SessionConfig) *Def
 }
 
 // CreateSession creates a new session for a user
-func (sm *DefaultSessionManager) CreateSession(ctx context.Context, userID uuid.UUID, clientInfo ClientInfo) (*models.Session, error) {
+func (sm *DefaultSessionManager) CreateSession(ctx context.Context, userID uuid.UUID, clientInfo ClientInfo, tokens ProviderTokens) (*models.Session, error) {
 	sessionID := uuid.New().String()
-	refreshToken := uuid.New().String()
+	refreshToken, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
 
 	now := time.Now()
+	refreshExpiresAt := sm.refreshExpiry(now, now)
 	session := &models.Session{
-		ID:               sessionID,
-		UserID:           userID,
-		RefreshToken:     refreshToken,
-		IPAddress:        clientInfo.IPAddress,
-		UserAgent:        clientInfo.UserAgent,
-		DeviceID:         clientInfo.DeviceID,
-		CreatedAt:        now,
-		ExpiresAt:        now.Add(sm.config.SessionTTL),
-		RefreshExpiresAt: now.Add(sm.config.RefreshTTL),
-		IsActive:         true,
+		ID:                   sessionID,
+		UserID:               userID,
+		RefreshTokenHash:     hashRefreshToken(refreshToken),
+		RefreshToken:         refreshToken,
+		ProviderTokenID:      tokens.TokenID,
+		ProviderRefreshToken: tokens.RefreshToken,
+		ProviderUsername:     tokens.Username,
+		IPAddress:            clientInfo.IPAddress,
+		UserAgent:            clientInfo.UserAgent,
+		DeviceID:             clientInfo.DeviceID,
+		CreatedAt:            now,
+		ExpiresAt:            earliest(now.Add(sm.config.SessionTTL), refreshExpiresAt),
+		RefreshExpiresAt:     refreshExpiresAt,
+		IsActive:             true,
 	}
 
 	// Check if we need to enforce max sessions per user
@@ -114,6 +137,16 @@ func (sm *DefaultSessionManager) GetSession(ctx context.Context, sessionID strin
 	return session, nil
 }
 
+// GetUserSessions returns a user's active sessions
+func (sm *DefaultSessionManager) GetUserSessions(ctx context.Context, userID uuid.UUID) ([]*models.Session, error) {
+	sessions, err := sm.repository.GetSessionsByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
 // ValidateSession validates a session and returns it if valid
 func (sm *DefaultSessionManager) ValidateSession(ctx context.Context, sessionID string) (*models.Session, error) {
 	session, err := sm.GetSession(ctx, sessionID)
@@ -125,10 +158,30 @@ func (sm *DefaultSessionManager) ValidateSession(ctx context.Context, sessionID
 		return nil, fmt.Errorf("session is inactive")
 	}
 
+	// An expired session stays active so that it can still be refreshed until RefreshExpiresAt
 	if time.Now().After(session.ExpiresAt) {
-		// Session expired, mark as inactive
-		session.IsActive = false
-		_ = sm.repository.UpdateSession(ctx, session)
+		return nil, fmt.Errorf("session expired")
+	}
+
+	return session, nil
+}
+
+// ValidateTokenSession returns the session the provider tokens with the origin_jti tokenID were
+// issued for, if it is still active. Access tokens outlive neither logout nor the session: they
+// are only refreshed while the session can be.
+func (sm *DefaultSessionManager) ValidateTokenSession(ctx context.Context, tokenID string) (*models.Session, error) {
+	if tokenID == "" {
+		return nil, fmt.Errorf("token is not linked to a session")
+	}
+	session, err := sm.repository.GetSessionByProviderTokenID(ctx, tokenID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	if !session.IsActive {
+		return nil, fmt.Errorf("session is inactive")
+	}
+	if time.Now().After(session.RefreshExpiresAt) {
 		return nil, fmt.Errorf("session expired")
 	}
 
@@ -152,34 +205,113 @@ func (sm *DefaultSessionManager) InvalidateSession(ctx context.Context, sessionI
 	return nil
 }
 
-// RefreshSession extends the session lifetime using refresh token
-func (sm *DefaultSessionManager) RefreshSession(ctx context.Context, sessionID string) (*models.Session, error) {
-	session, err := sm.GetSession(ctx, sessionID)
+// InvalidateUserSessions marks all of a user's active sessions as inactive and returns them
+func (sm *DefaultSessionManager) InvalidateUserSessions(ctx context.Context, userID uuid.UUID) ([]*models.Session, error) {
+	sessions, err := sm.GetUserSessions(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	if !session.IsActive {
-		return nil, fmt.Errorf("session is inactive")
+	now := time.Now()
+	for _, session := range sessions {
+		session.IsActive = false
+		session.ExpiresAt = now
+		if err := sm.repository.UpdateSession(ctx, session); err != nil {
+			return nil, fmt.Errorf("failed to invalidate session %s: %w", session.ID, err)
+		}
 	}
 
-	if time.Now().After(session.RefreshExpiresAt) {
-		return nil, fmt.Errorf("refresh token expired")
+	return sessions, nil
+}
+
+// RefreshSession looks up the session of a refresh token, extends its lifetime and rotates the
+// refresh token. The new token is returned in the session's RefreshToken field. Presenting a token
+// that was already rotated invalidates the session and returns a *ReuseError.
+//
+// renew, when not nil, is called with the session before anything changes; if it fails, the
+// session and its refresh token are left as they were and its error is returned.
+func (sm *DefaultSessionManager) RefreshSession(ctx context.Context, refreshToken string, renew func(*models.Session) error) (*models.Session, error) {
+	tokenHash := hashRefreshToken(refreshToken)
+
+	session, err := sm.repository.GetSessionByRefreshTokenHash(ctx, tokenHash)
+	if err != nil {
+		return nil, sm.checkReuse(ctx, tokenHash)
+	}
+
+	if !session.IsActive {
+		return nil, ErrInvalidRefreshToken
 	}
 
-	// Update session expiry
 	now := time.Now()
-	session.ExpiresAt = now.Add(sm.config.SessionTTL)
-	session.RefreshExpiresAt = now.Add(sm.config.RefreshTTL)
-	session.RefreshToken = uuid.New().String() // Rotate refresh token
+	if now.After(session.RefreshExpiresAt) {
+		return nil, ErrRefreshTokenExpired
+	}
 
-	if err := sm.repository.UpdateSession(ctx, session); err != nil {
+	if renew != nil {
+		if err := renew(session); err != nil {
+			return nil, err
+		}
+	}
+
+	newToken, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	// Update session expiry and rotate the refresh token
+	session.RefreshExpiresAt = sm.refreshExpiry(session.CreatedAt, now)
+	session.ExpiresAt = earliest(now.Add(sm.config.SessionTTL), session.RefreshExpiresAt)
+	session.RefreshTokenHash = hashRefreshToken(newToken)
+	session.RefreshToken = newToken
+
+	if err := sm.repository.RotateRefreshToken(ctx, session, tokenHash); err != nil {
+		// A concurrent refresh with the same token won the race; treat this request as reuse
+		if reuseErr := sm.checkReuse(ctx, tokenHash); reuseErr != ErrInvalidRefreshToken {
+			return nil, reuseErr
+		}
 		return nil, fmt.Errorf("failed to refresh session: %w", err)
 	}
 
 	return session, nil
 }
 
+// refreshExpiry returns when a session created at createdAt and refreshed at now stops being
+// refreshable: RefreshTTL after now, but no later than MaxLifetime after createdAt.
+func (sm *DefaultSessionManager) refreshExpiry(createdAt, now time.Time) time.Time {
+	expiresAt := now.Add(sm.config.RefreshTTL)
+	if sm.config.MaxLifetime > 0 {
+		expiresAt = earliest(expiresAt, createdAt.Add(sm.config.MaxLifetime))
+	}
+	return expiresAt
+}
+
+func earliest(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
+
+// checkReuse handles a refresh token that matches no current session. If it was rotated
+// earlier, the token has leaked and the whole session is invalidated.
+func (sm *DefaultSessionManager) checkReuse(ctx context.Context, tokenHash string) error {
+	rotated, err := sm.repository.GetRotatedRefreshToken(ctx, tokenHash)
+	if err != nil {
+		return ErrInvalidRefreshToken
+	}
+
+	session, err := sm.GetSession(ctx, rotated.SessionID)
+	if err != nil {
+		return ErrInvalidRefreshToken
+	}
+	if session.IsActive {
+		if err := sm.InvalidateSession(ctx, session.ID); err != nil {
+			return fmt.Errorf("failed to invalidate session after refresh token reuse: %w", err)
+		}
+	}
+	return &ReuseError{Session: session}
+}
+
 // CleanupExpiredSessions removes expired sessions from storage
 func (sm *DefaultSessionManager) CleanupExpiredSessions(ctx context.Context) error {
 	if err := sm.repository.DeleteExpiredSessions(ctx); err != nil {
@@ -0,0 +1,336 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"shield/modules/authn/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// memoryRepository is an in-memory SessionRepository
+type memoryRepository struct {
+	sessions map[string]*models.Session
+	rotated  map[string]*models.RotatedRefreshToken
+}
+
+func newMemoryRepository() *memoryRepository {
+	return &memoryRepository{
+		sessions: map[string]*models.Session{},
+		rotated:  map[string]*models.RotatedRefreshToken{},
+	}
+}
+
+func (r *memoryRepository) CreateSession(_ context.Context, s *models.Session) error {
+	copied := *s
+	r.sessions[s.ID] = &copied
+	return nil
+}
+
+func (r *memoryRepository) GetSessionByID(_ context.Context, id string) (*models.Session, error) {
+	s, ok := r.sessions[id]
+	if !ok {
+		return nil, fmt.Errorf("session %s not found", id)
+	}
+	copied := *s
+	return &copied, nil
+}
+
+func (r *memoryRepository) UpdateSession(_ context.Context, s *models.Session) error {
+	copied := *s
+	r.sessions[s.ID] = &copied
+	return nil
+}
+
+func (r *memoryRepository) DeleteSession(_ context.Context, id string) error {
+	delete(r.sessions, id)
+	return nil
+}
+
+func (r *memoryRepository) DeleteExpiredSessions(context.Context) error { return nil }
+
+func (r *memoryRepository) GetSessionsByUserID(_ context.Context, userID uuid.UUID) ([]*models.Session, error) {
+	var sessions []*models.Session
+	for _, s := range r.sessions {
+		if s.UserID == userID && s.IsActive {
+			copied := *s
+			sessions = append(sessions, &copied)
+		}
+	}
+	return sessions, nil
+}
+
+func (r *memoryRepository) GetSessionByRefreshTokenHash(_ context.Context, tokenHash string) (*models.Session, error) {
+	for _, s := range r.sessions {
+		if s.RefreshTokenHash == tokenHash {
+			copied := *s
+			copied.RefreshToken = ""
+			return &copied, nil
+		}
+	}
+	return nil, fmt.Errorf("session not found")
+}
+
+func (r *memoryRepository) GetSessionByProviderTokenID(_ context.Context, tokenID string) (*models.Session, error) {
+	for _, s := range r.sessions {
+		if s.ProviderTokenID == tokenID {
+			copied := *s
+			return &copied, nil
+		}
+	}
+	return nil, fmt.Errorf("session not found")
+}
+
+func (r *memoryRepository) GetRotatedRefreshToken(_ context.Context, tokenHash string) (*models.RotatedRefreshToken, error) {
+	rotated, ok := r.rotated[tokenHash]
+	if !ok {
+		return nil, fmt.Errorf("rotated token not found")
+	}
+	return rotated, nil
+}
+
+func (r *memoryRepository) RotateRefreshToken(_ context.Context, s *models.Session, previousHash string) error {
+	current, ok := r.sessions[s.ID]
+	if !ok || current.RefreshTokenHash != previousHash {
+		return fmt.Errorf("concurrent rotation")
+	}
+	copied := *s
+	r.sessions[s.ID] = &copied
+	r.rotated[previousHash] = &models.RotatedRefreshToken{TokenHash: previousHash, SessionID: s.ID, RotatedAt: time.Now()}
+	return nil
+}
+
+func newTestManager() (*DefaultSessionManager, *memoryRepository) {
+	repo := newMemoryRepository()
+	return NewDefaultSessionManager(repo, SessionConfig{
+		SessionTTL: time.Hour,
+		RefreshTTL: 24 * time.Hour,
+	}), repo
+}
+
+func TestCreateSessionStoresProviderTokens(t *testing.T) {
+	manager, _ := newTestManager()
+	ctx := context.Background()
+
+	created, err := manager.CreateSession(ctx, uuid.New(), ClientInfo{}, ProviderTokens{TokenID: "jti-1", RefreshToken: "sealed"})
+	if err != nil {
+		t.Fatalf("CreateSession() error = %v", err)
+	}
+
+	got, err := manager.GetSession(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("GetSession() error = %v", err)
+	}
+	if got.ProviderTokenID != "jti-1" || got.ProviderRefreshToken != "sealed" {
+		t.Errorf("provider tokens = %q, %q, want jti-1, sealed", got.ProviderTokenID, got.ProviderRefreshToken)
+	}
+}
+
+func TestValidateTokenSession(t *testing.T) {
+	manager, repo := newTestManager()
+	ctx := context.Background()
+
+	created, err := manager.CreateSession(ctx, uuid.New(), ClientInfo{}, ProviderTokens{TokenID: "jti-1"})
+	if err != nil {
+		t.Fatalf("CreateSession() error = %v", err)
+	}
+	if got, err := manager.ValidateTokenSession(ctx, "jti-1"); err != nil || got.ID != created.ID {
+		t.Fatalf("ValidateTokenSession() = %v, %v; want the session", got, err)
+	}
+	for _, tokenID := range []string{"", "jti-2"} {
+		if _, err := manager.ValidateTokenSession(ctx, tokenID); err == nil {
+			t.Errorf("ValidateTokenSession(%q) succeeded without a session", tokenID)
+		}
+	}
+
+	repo.sessions[created.ID].RefreshExpiresAt = time.Now().Add(-time.Minute)
+	if _, err := manager.ValidateTokenSession(ctx, "jti-1"); err == nil {
+		t.Error("ValidateTokenSession() succeeded for a session that can no longer be refreshed")
+	}
+	repo.sessions[created.ID].RefreshExpiresAt = time.Now().Add(time.Hour)
+	if err := manager.InvalidateSession(ctx, created.ID); err != nil {
+		t.Fatalf("InvalidateSession() error = %v", err)
+	}
+	if _, err := manager.ValidateTokenSession(ctx, "jti-1"); err == nil {
+		t.Error("ValidateTokenSession() succeeded after logout")
+	}
+}
+
+func TestInvalidateUserSessions(t *testing.T) {
+	manager, _ := newTestManager()
+	ctx := context.Background()
+	userID, otherID := uuid.New(), uuid.New()
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		s, err := manager.CreateSession(ctx, userID, ClientInfo{}, ProviderTokens{})
+		if err != nil {
+			t.Fatalf("CreateSession() error = %v", err)
+		}
+		ids = append(ids, s.ID)
+	}
+	other, err := manager.CreateSession(ctx, otherID, ClientInfo{}, ProviderTokens{})
+	if err != nil {
+		t.Fatalf("CreateSession() error = %v", err)
+	}
+
+	ended, err := manager.InvalidateUserSessions(ctx, userID)
+	if err != nil {
+		t.Fatalf("InvalidateUserSessions() error = %v", err)
+	}
+	if len(ended) != len(ids) {
+		t.Errorf("InvalidateUserSessions() ended %d sessions, want %d", len(ended), len(ids))
+	}
+
+	for _, id := range ids {
+		if _, err := manager.ValidateSession(ctx, id); err == nil {
+			t.Errorf("ValidateSession(%s) succeeded after logout everywhere", id)
+		}
+	}
+	if _, err := manager.ValidateSession(ctx, other.ID); err != nil {
+		t.Errorf("ValidateSession() of another user's session error = %v", err)
+	}
+
+	remaining, err := manager.GetUserSessions(ctx, userID)
+	if err != nil {
+		t.Fatalf("GetUserSessions() error = %v", err)
+	}
+	if len(remaining) != 0 {
+		t.Errorf("GetUserSessions() = %d active sessions, want 0", len(remaining))
+	}
+}
+
+func TestRefreshSession(t *testing.T) {
+	manager, repo := newTestManager()
+	ctx := context.Background()
+
+	created, err := manager.CreateSession(ctx, uuid.New(), ClientInfo{}, ProviderTokens{})
+	if err != nil {
+		t.Fatalf("CreateSession() error = %v", err)
+	}
+	if created.RefreshToken == "" || created.RefreshTokenHash == created.RefreshToken {
+		t.Fatal("CreateSession() must return the plaintext token and store only its hash")
+	}
+	if stored := repo.sessions[created.ID]; stored.RefreshTokenHash != hashRefreshToken(created.RefreshToken) {
+		t.Fatal("stored refresh token hash does not match the issued token")
+	}
+
+	if _, err := manager.RefreshSession(ctx, "unknown", nil); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("RefreshSession(unknown) error = %v, want ErrInvalidRefreshToken", err)
+	}
+
+	refreshed, err := manager.RefreshSession(ctx, created.RefreshToken, nil)
+	if err != nil {
+		t.Fatalf("RefreshSession() error = %v", err)
+	}
+	if refreshed.ID != created.ID || refreshed.RefreshToken == created.RefreshToken {
+		t.Fatal("RefreshSession() must rotate the refresh token of the same session")
+	}
+
+	again, err := manager.RefreshSession(ctx, refreshed.RefreshToken, nil)
+	if err != nil {
+		t.Fatalf("RefreshSession() with rotated token error = %v", err)
+	}
+
+	// Replaying the first token ends the session, including its newest token
+	_, err = manager.RefreshSession(ctx, created.RefreshToken, nil)
+	var reuseErr *ReuseError
+	if !errors.As(err, &reuseErr) || !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("RefreshSession(reused) error = %v, want *ReuseError", err)
+	}
+	if reuseErr.Session.ID != created.ID {
+		t.Errorf("ReuseError session = %s, want %s", reuseErr.Session.ID, created.ID)
+	}
+	if _, err := manager.RefreshSession(ctx, again.RefreshToken, nil); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("RefreshSession() after reuse error = %v, want ErrInvalidRefreshToken", err)
+	}
+	if _, err := manager.ValidateSession(ctx, created.ID); err == nil {
+		t.Error("ValidateSession() succeeded after refresh token reuse")
+	}
+}
+
+func TestRefreshSessionExpired(t *testing.T) {
+	manager, repo := newTestManager()
+	ctx := context.Background()
+
+	created, err := manager.CreateSession(ctx, uuid.New(), ClientInfo{}, ProviderTokens{})
+	if err != nil {
+		t.Fatalf("CreateSession() error = %v", err)
+	}
+
+	// Past the session TTL the session can still be refreshed
+	repo.sessions[created.ID].ExpiresAt = time.Now().Add(-time.Minute)
+	if _, err := manager.ValidateSession(ctx, created.ID); err == nil {
+		t.Fatal("ValidateSession() succeeded for an expired session")
+	}
+	refreshed, err := manager.RefreshSession(ctx, created.RefreshToken, nil)
+	if err != nil {
+		t.Fatalf("RefreshSession() of an expired session error = %v", err)
+	}
+
+	repo.sessions[created.ID].RefreshExpiresAt = time.Now().Add(-time.Minute)
+	if _, err := manager.RefreshSession(ctx, refreshed.RefreshToken, nil); !errors.Is(err, ErrRefreshTokenExpired) {
+		t.Errorf("RefreshSession() past RefreshExpiresAt error = %v, want ErrRefreshTokenExpired", err)
+	}
+}
+
+func TestRefreshSessionRenewFails(t *testing.T) {
+	manager, _ := newTestManager()
+	ctx := context.Background()
+
+	created, err := manager.CreateSession(ctx, uuid.New(), ClientInfo{}, ProviderTokens{})
+	if err != nil {
+		t.Fatalf("CreateSession() error = %v", err)
+	}
+
+	// A failed provider refresh must not consume the refresh token
+	errProvider := errors.New("provider unavailable")
+	if _, err := manager.RefreshSession(ctx, created.RefreshToken, func(*models.Session) error { return errProvider }); !errors.Is(err, errProvider) {
+		t.Fatalf("RefreshSession() with failing renew error = %v, want %v", err, errProvider)
+	}
+
+	var renewed string
+	refreshed, err := manager.RefreshSession(ctx, created.RefreshToken, func(s *models.Session) error {
+		renewed = s.ID
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RefreshSession() after a failed renewal error = %v", err)
+	}
+	if renewed != created.ID || refreshed.RefreshToken == created.RefreshToken {
+		t.Errorf("RefreshSession() renewed %q and returned token %q, want session %s with a rotated token", renewed, refreshed.RefreshToken, created.ID)
+	}
+}
+
+func TestRefreshSessionMaxLifetime(t *testing.T) {
+	repo := newMemoryRepository()
+	manager := NewDefaultSessionManager(repo, SessionConfig{
+		SessionTTL:  time.Hour,
+		RefreshTTL:  24 * time.Hour,
+		MaxLifetime: 2 * time.Hour,
+	})
+	ctx := context.Background()
+
+	created, err := manager.CreateSession(ctx, uuid.New(), ClientInfo{}, ProviderTokens{})
+	if err != nil {
+		t.Fatalf("CreateSession() error = %v", err)
+	}
+	if want := created.CreatedAt.Add(2 * time.Hour); !created.RefreshExpiresAt.Equal(want) {
+		t.Errorf("CreateSession() RefreshExpiresAt = %v, want %v", created.RefreshExpiresAt, want)
+	}
+
+	// Refreshing late in the session's life does not extend it past the maximum lifetime
+	loginAt := time.Now().Add(-90 * time.Minute)
+	repo.sessions[created.ID].CreatedAt = loginAt
+	refreshed, err := manager.RefreshSession(ctx, created.RefreshToken, nil)
+	if err != nil {
+		t.Fatalf("RefreshSession() error = %v", err)
+	}
+	if want := loginAt.Add(2 * time.Hour); !refreshed.RefreshExpiresAt.Equal(want) || refreshed.ExpiresAt.After(want) {
+		t.Errorf("RefreshSession() expiry = %v, refresh expiry %v; want both at most %v", refreshed.ExpiresAt, refreshed.RefreshExpiresAt, want)
+	}
+}
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"context"
+
+	"shield/modules/authn/internal/auth/session"
+	"shield/modules/authn/internal/models"
+	apperrors "shield/modules/common/errors"
+)
+
+// WithSessionCookies enables signed session cookies. They are always used by the SSO
+// callback, and by password logins when the configured session mode is "cookie".
+func WithSessionCookies(codec *session.CookieCodec) Option {
+	return func(s *AuthService) {
+		s.sessionCookies = codec
+	}
+}
+
+// SessionCookies returns the session cookie codec, or nil when session cookies are disabled.
+func (s *AuthService) SessionCookies() *session.CookieCodec {
+	return s.sessionCookies
+}
+
+// CookieMode reports whether logins deliver the session as a cookie instead of bearer tokens.
+func (s *AuthService) CookieMode() bool {
+	return s.sessionCookies != nil && s.config.Session.Mode == session.ModeCookie
+}
+
+// AuthenticateSession resolves the user and active session referenced by a session cookie.
+func (s *AuthService) AuthenticateSession(ctx context.Context, cookieValue string) (*models.User, *models.Session, error) {
+	if s.sessionCookies == nil {
+		return nil, nil, apperrors.ErrUnauthorized
+	}
+
+	sessionID, err := s.sessionCookies.Decode(cookieValue)
+	if err != nil {
+		return nil, nil, apperrors.ErrInvalidToken
+	}
+
+	sessionData, err := s.sessionManager.ValidateSession(ctx, sessionID)
+	if err != nil {
+		return nil, nil, apperrors.ErrInvalidToken
+	}
+
+	user, err := s.userRepository.GetUserByID(ctx, sessionData.UserID)
+	if err != nil {
+		return nil, nil, apperrors.ErrInvalidToken
+	}
+	return user, sessionData, nil
+}
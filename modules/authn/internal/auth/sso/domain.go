@@ -0,0 +1,55 @@
+package sso
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// domainChallengeLabel prefixes the domain whose TXT record proves control of it
+const domainChallengeLabel = "_shield-challenge."
+
+// VerificationRecord returns the name and value of the DNS TXT record that proves control of
+// domain for the verification token of an SSO configuration.
+func VerificationRecord(domain, token string) (name, value string) {
+	return domainChallengeLabel + domain, "shield-domain-verification=" + token
+}
+
+// DomainVerifier checks the DNS TXT records that prove an organization controls a domain
+// before the domain routes users to the organization's IdP.
+type DomainVerifier struct {
+	lookupTXT func(ctx context.Context, name string) ([]string, error)
+}
+
+// NewDomainVerifier creates a verifier resolving records with lookupTXT, or the system resolver when nil.
+func NewDomainVerifier(lookupTXT func(ctx context.Context, name string) ([]string, error)) *DomainVerifier {
+	if lookupTXT == nil {
+		lookupTXT = net.DefaultResolver.LookupTXT
+	}
+	return &DomainVerifier{lookupTXT: lookupTXT}
+}
+
+// Verify reports whether domain publishes the verification record for token. A missing record
+// is not an error; failed lookups are.
+func (v *DomainVerifier) Verify(ctx context.Context, domain, token string) (bool, error) {
+	if token == "" {
+		return false, nil
+	}
+	name, want := VerificationRecord(domain, token)
+	records, err := v.lookupTXT(ctx, name)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to look up %s: %w", name, err)
+	}
+	for _, record := range records {
+		if strings.TrimSpace(record) == want {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,43 @@
+package sso
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestDomainVerifier(t *testing.T) {
+	verifier := NewDomainVerifier(func(_ context.Context, name string) ([]string, error) {
+		switch name {
+		case "_shield-challenge.acme.com":
+			return []string{"v=spf1 -all", "shield-domain-verification=token-1"}, nil
+		case "_shield-challenge.broken.com":
+			return nil, &net.DNSError{Err: "server misbehaving", Name: name, IsTemporary: true}
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	})
+
+	tests := []struct {
+		domain  string
+		token   string
+		want    bool
+		wantErr bool
+	}{
+		{"acme.com", "token-1", true, false},
+		{"acme.com", "token-2", false, false},
+		{"acme.com", "", false, false},
+		{"other.com", "token-1", false, false},
+		{"broken.com", "token-1", false, true},
+	}
+	for _, tt := range tests {
+		got, err := verifier.Verify(context.Background(), tt.domain, tt.token)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("Verify(%s, %q) = %v, %v; want %v, error %v", tt.domain, tt.token, got, err, tt.want, tt.wantErr)
+		}
+	}
+	var dnsErr *net.DNSError
+	if _, err := verifier.Verify(context.Background(), "broken.com", "token-1"); !errors.As(err, &dnsErr) {
+		t.Errorf("Verify() lookup error = %v, want the DNS error", err)
+	}
+}
@@ -0,0 +1,209 @@
+package sso
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrUnsafeURL is returned for identity provider URLs that are not https or that reach
+// loopback, private or link-local addresses.
+var ErrUnsafeURL = errors.New("sso: identity provider URL must be https and publicly routable")
+
+// lookupIPAddr resolves identity provider hosts; replaced in tests
+var lookupIPAddr = net.DefaultResolver.LookupIPAddr
+
+// CheckPublicURL checks that rawURL is an https URL whose host only resolves to public addresses.
+func CheckPublicURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" || u.User != nil {
+		return ErrUnsafeURL
+	}
+
+	addrs, err := lookupIPAddr(ctx, u.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("%w: cannot resolve %s", ErrUnsafeURL, u.Hostname())
+	}
+	for _, addr := range addrs {
+		if !publicIP(addr.IP) {
+			return ErrUnsafeURL
+		}
+	}
+	return nil
+}
+
+// NewHTTPClient returns a client for identity provider documents. Addresses are checked
+// when connecting, after DNS resolution, so a host that re-resolves to an internal address
+// cannot be used to reach internal services. Redirects must stay on https.
+func NewHTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+				return ErrUnsafeURL
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // A proxy would connect on our behalf, bypassing the address check
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if req.URL.Scheme != "https" {
+				return ErrUnsafeURL
+			}
+			if len(via) >= 5 {
+				return errors.New("stopped after 5 redirects")
+			}
+			return nil
+		},
+	}
+}
+
+// nonPublicPrefixes are special-purpose ranges the net.IP predicates do not cover. NAT64 and
+// 6to4 addresses embed an IPv4 address that the gateway would connect to, so they are refused.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "This network"
+	netip.MustParsePrefix("100.64.0.0/10"),   // Carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // Documentation
+	netip.MustParsePrefix("198.18.0.0/15"),   // Benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // Documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // Documentation
+	netip.MustParsePrefix("240.0.0.0/4"),     // Reserved, including broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // Local-use NAT64
+	netip.MustParsePrefix("100::/64"),        // Discard
+	netip.MustParsePrefix("2001:db8::/32"),   // Documentation
+	netip.MustParsePrefix("2002::/16"),       // 6to4
+}
+
+// publicIP reports whether ip is a globally routable unicast address. IPv4-mapped IPv6
+// addresses are judged by the IPv4 address they map.
+func publicIP(ip net.IP) bool {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
+	}
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// domainPattern matches a DNS name with at least two labels
+var domainPattern = regexp.MustCompile(`^(?i)[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?(\.[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?)+$`)
+
+// ValidDomain reports whether identifier is a domain name, as used for IdP identifiers
+// that route users to their organization's IdP by email domain.
+func ValidDomain(identifier string) bool {
+	return len(identifier) <= 253 && domainPattern.MatchString(identifier)
+}
+
+// samlEntityDescriptor is the root element of SAML 2.0 metadata
+type samlEntityDescriptor struct {
+	XMLName  xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	EntityID string   `xml:"entityID,attr"`
+	IDP      *struct {
+		SSOServices []struct {
+			Location string `xml:"Location,attr"`
+		} `xml:"SingleSignOnService"`
+	} `xml:"IDPSSODescriptor"`
+}
+
+// CheckSAMLMetadata validates a SAML metadata document describing an identity provider.
+func CheckSAMLMetadata(metadata []byte) error {
+	var descriptor samlEntityDescriptor
+	if err := xml.Unmarshal(metadata, &descriptor); err != nil {
+		return fmt.Errorf("invalid SAML metadata: %w", err)
+	}
+	if descriptor.EntityID == "" {
+		return fmt.Errorf("invalid SAML metadata: missing entityID")
+	}
+	if descriptor.IDP == nil || len(descriptor.IDP.SSOServices) == 0 {
+		return fmt.Errorf("invalid SAML metadata: no IdP SingleSignOnService")
+	}
+	return nil
+}
+
+// FetchSAMLMetadata downloads and validates SAML metadata from metadataURL.
+func FetchSAMLMetadata(ctx context.Context, client *http.Client, metadataURL string) error {
+	body, err := fetch(ctx, client, metadataURL)
+	if err != nil {
+		return err
+	}
+	return CheckSAMLMetadata(body)
+}
+
+// CheckOIDCIssuer fetches the issuer's discovery document and checks that it describes the issuer.
+func CheckOIDCIssuer(ctx context.Context, client *http.Client, issuer string) error {
+	issuer = strings.TrimRight(issuer, "/")
+	body, err := fetch(ctx, client, issuer+"/.well-known/openid-configuration")
+	if err != nil {
+		return err
+	}
+
+	var discovery struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+	}
+	if err := json.Unmarshal(body, &discovery); err != nil {
+		return fmt.Errorf("invalid OIDC discovery document: %w", err)
+	}
+	if strings.TrimRight(discovery.Issuer, "/") != issuer {
+		return fmt.Errorf("OIDC issuer mismatch: discovery document is for %q", discovery.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" {
+		return fmt.Errorf("OIDC discovery document is missing endpoints")
+	}
+	return nil
+}
+
+func fetch(ctx context.Context, client *http.Client, target string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %q: %w", target, err)
+	}
+	if req.URL.Scheme != "https" {
+		return nil, ErrUnsafeURL
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", target, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s: status %d", target, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
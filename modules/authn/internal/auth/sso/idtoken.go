@@ -0,0 +1,121 @@
+package sso
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidIDToken is returned when the id_token is malformed or was not issued for this login
+var ErrInvalidIDToken = errors.New("sso: invalid id_token")
+
+// Identity is a federated identity linked to the provider user (Cognito "identities" claim)
+type Identity struct {
+	UserID       string `json:"userId"`
+	ProviderName string `json:"providerName"`
+	ProviderType string `json:"providerType"`
+}
+
+// IDTokenClaims contains the id_token claims Shield uses to map a federated user
+type IDTokenClaims struct {
+	Subject       string     `json:"sub"`
+	Issuer        string     `json:"iss"`
+	Audience      audience   `json:"aud"`
+	ExpiresAt     int64      `json:"exp"`
+	Nonce         string     `json:"nonce"`
+	Email         string     `json:"email"`
+	EmailVerified flexBool   `json:"email_verified"`
+	Identities    []Identity `json:"identities"`
+}
+
+// ParseIDToken decodes the claims of an id_token.
+// The signature is not checked: the token was received directly from the token endpoint over TLS,
+// which OpenID Connect Core 3.1.3.7 accepts in place of signature validation.
+func ParseIDToken(idToken string) (*IDTokenClaims, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidIDToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	var claims IDTokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidIDToken
+	}
+	return &claims, nil
+}
+
+// Validate checks that the token belongs to this client and login.
+func (c *IDTokenClaims) Validate(clientID, nonce string, now time.Time) error {
+	if c.Subject == "" {
+		return fmt.Errorf("%w: missing sub", ErrInvalidIDToken)
+	}
+	if !c.Audience.contains(clientID) {
+		return fmt.Errorf("%w: audience mismatch", ErrInvalidIDToken)
+	}
+	if now.Unix() > c.ExpiresAt {
+		return fmt.Errorf("%w: token expired", ErrInvalidIDToken)
+	}
+	if nonce != "" && c.Nonce != nonce {
+		return fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	return nil
+}
+
+// FederatedBy reports whether the user signed in through the named identity provider.
+// Users of the pool itself carry no identities and never match.
+func (c *IDTokenClaims) FederatedBy(providerName string) bool {
+	for _, identity := range c.Identities {
+		if providerName != "" && identity.ProviderName == providerName {
+			return true
+		}
+	}
+	return false
+}
+
+// audience accepts the aud claim as either a string or an array of strings
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*a = multiple
+	return nil
+}
+
+func (a audience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// flexBool accepts booleans encoded as JSON booleans or strings; federated users
+// in Cognito carry email_verified as "true"/"false".
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "true":
+		*b = true
+	default:
+		*b = false
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package sso
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"shield/modules/common/crypto"
+)
+
+// fakeAuthServer is a minimal hosted UI: /oauth2/authorize issues a code bound to the
+// PKCE challenge and nonce, /oauth2/token redeems it for an unsigned id_token.
+type fakeAuthServer struct {
+	*httptest.Server
+	clientID string
+	codes    map[string]url.Values
+}
+
+func newFakeAuthServer(t *testing.T, clientID string) *fakeAuthServer {
+	f := &fakeAuthServer{clientID: clientID, codes: map[string]url.Values{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth2/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("code_challenge_method") != "S256" || q.Get("client_id") != clientID {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		code := "code-" + q.Get("state")
+		f.codes[code] = q
+		http.Redirect(w, r, q.Get("redirect_uri")+"?code="+code+"&state="+q.Get("state"), http.StatusFound)
+	})
+	mux.HandleFunc("/oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		authz, ok := f.codes[r.PostForm.Get("code")]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(sum[:]) != authz.Get("code_challenge") {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant","error_description":"PKCE verification failed"}`))
+			return
+		}
+		delete(f.codes, r.PostForm.Get("code"))
+
+		claims, _ := json.Marshal(map[string]interface{}{
+			"sub":            "federated-sub",
+			"aud":            clientID,
+			"exp":            time.Now().Add(time.Hour).Unix(),
+			"nonce":          authz.Get("nonce"),
+			"email":          "jane@acme.test",
+			"email_verified": "true",
+			"identities":     []map[string]string{{"userId": "jane", "providerName": authz.Get("identity_provider"), "providerType": "SAML"}},
+		})
+		idToken := "e30." + base64.RawURLEncoding.EncodeToString(claims) + ".sig"
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(Tokens{IDToken: idToken, AccessToken: "access", RefreshToken: "refresh", ExpiresIn: 3600, TokenType: "Bearer"})
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	server := newFakeAuthServer(t, "client-123")
+	client := NewClient(HostedUIConfig(server.URL, "client-123", "secret", "https://api.test/auth/callback", nil), server.Client())
+
+	sealer, err := crypto.NewSealer("state-key")
+	if err != nil {
+		t.Fatalf("NewSealer failed: %v", err)
+	}
+	codec := NewStateCodec(sealer)
+
+	state, err := NewState("org-1", "AcmeOkta", "/dashboard", time.Minute)
+	if err != nil {
+		t.Fatalf("NewState failed: %v", err)
+	}
+	cookie, err := codec.Encode(state)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	// Follow the authorize redirect as the browser would, stopping at our callback
+	noRedirect := server.Client()
+	noRedirect.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := noRedirect.Get(client.AuthorizeURL(AuthorizeRequest{
+		State:            state.Value,
+		Nonce:            state.Nonce,
+		CodeChallenge:    state.CodeChallenge(),
+		IdentityProvider: state.Provider,
+	}))
+	if err != nil {
+		t.Fatalf("authorize request failed: %v", err)
+	}
+	resp.Body.Close()
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || !strings.HasPrefix(callback.String(), "https://api.test/auth/callback") {
+		t.Fatalf("unexpected callback redirect %q", resp.Header.Get("Location"))
+	}
+
+	restored, err := codec.Decode(cookie, callback.Query().Get("state"))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	tokens, err := client.Exchange(context.Background(), callback.Query().Get("code"), restored.CodeVerifier)
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+
+	claims, err := ParseIDToken(tokens.IDToken)
+	if err != nil {
+		t.Fatalf("ParseIDToken failed: %v", err)
+	}
+	if err := claims.Validate("client-123", restored.Nonce, time.Now()); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if claims.Email != "jane@acme.test" || !bool(claims.EmailVerified) || !claims.FederatedBy(restored.Provider) {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+	if claims.FederatedBy("OtherIdP") || claims.FederatedBy("") {
+		t.Errorf("claims federated by another provider: %+v", claims.Identities)
+	}
+
+	// Codes are single use
+	if _, err := client.Exchange(context.Background(), callback.Query().Get("code"), restored.CodeVerifier); err == nil {
+		t.Error("expected reused code to be rejected")
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	server := newFakeAuthServer(t, "client-123")
+	client := NewClient(HostedUIConfig(server.URL, "client-123", "", "https://api.test/auth/callback", nil), server.Client())
+
+	state, _ := NewState("org-1", "org-1-saml", "/", time.Minute)
+	server.codes["code-x"] = url.Values{"code_challenge": {state.CodeChallenge()}}
+
+	if _, err := client.Exchange(context.Background(), "code-x", "not-the-verifier"); err == nil {
+		t.Error("expected PKCE mismatch to fail")
+	}
+}
+
+func TestStateDecode(t *testing.T) {
+	sealer, _ := crypto.NewSealer("state-key")
+	codec := NewStateCodec(sealer)
+
+	valid, _ := NewState("org-1", "org-1-saml", "/", time.Minute)
+	validCookie, _ := codec.Encode(valid)
+	expired, _ := NewState("org-1", "org-1-saml", "/", -time.Minute)
+	expiredCookie, _ := codec.Encode(expired)
+
+	// Flip one character in the middle of the sealed value
+	tampered := []byte(validCookie)
+	mid := len(tampered) / 2
+	if tampered[mid] == 'A' {
+		tampered[mid] = 'B'
+	} else {
+		tampered[mid] = 'A'
+	}
+
+	tests := []struct {
+		name    string
+		cookie  string
+		state   string
+		wantErr bool
+	}{
+		{name: "matching state", cookie: validCookie, state: valid.Value, wantErr: false},
+		{name: "state mismatch", cookie: validCookie, state: "forged", wantErr: true},
+		{name: "expired state", cookie: expiredCookie, state: expired.Value, wantErr: true},
+		{name: "tampered cookie", cookie: string(tampered), state: valid.Value, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := codec.Decode(tt.cookie, tt.state)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIDTokenValidate(t *testing.T) {
+	now := time.Now()
+	base := IDTokenClaims{Subject: "sub", Audience: audience{"client"}, ExpiresAt: now.Add(time.Minute).Unix(), Nonce: "n"}
+
+	tests := []struct {
+		name    string
+		mutate  func(c *IDTokenClaims)
+		wantErr bool
+	}{
+		{name: "valid", mutate: func(c *IDTokenClaims) {}, wantErr: false},
+		{name: "wrong audience", mutate: func(c *IDTokenClaims) { c.Audience = audience{"other"} }, wantErr: true},
+		{name: "expired", mutate: func(c *IDTokenClaims) { c.ExpiresAt = now.Add(-time.Minute).Unix() }, wantErr: true},
+		{name: "nonce mismatch", mutate: func(c *IDTokenClaims) { c.Nonce = "other" }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := base
+			tt.mutate(&claims)
+			if err := claims.Validate("client", "n", now); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
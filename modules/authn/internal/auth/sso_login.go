@@ -0,0 +1,237 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	authprovider "shield/modules/authn/internal/auth/provider"
+	"shield/modules/authn/internal/auth/session"
+	"shield/modules/authn/internal/auth/sso"
+	"shield/modules/authn/internal/models"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrSSODisabled      = errors.New("sso login is not configured")
+	ErrSSONotConfigured = errors.New("organization has no SSO provider configured")
+	ErrSSOUserMismatch  = errors.New("federated user belongs to a different organization")
+	ErrSSOWrongProvider = errors.New("federated user signed in through a different identity provider")
+	ErrSSOUnverified    = errors.New("federated user has no verified email")
+	ErrSSOAccountLinked = errors.New("email belongs to an account that is linked to another identity")
+)
+
+// defaultSSOStateTTL bounds how long a user may take on the IdP login page.
+const defaultSSOStateTTL = 10 * time.Minute
+
+// WithSSO enables the backend-handled SSO login flow.
+func WithSSO(client *sso.Client, states *sso.StateCodec) Option {
+	return func(s *AuthService) {
+		s.ssoClient = client
+		s.ssoStates = states
+	}
+}
+
+// SSOLoginURL returns the backend URL that starts an SSO login for the organization.
+func SSOLoginURL(orgID string) string {
+	return "/api/v1/auth/sso/start?org=" + orgID
+}
+
+// SSOStartRequest contains parameters for starting an SSO login
+type SSOStartRequest struct {
+	Org      string // Organization ID or name
+	Redirect string // Relative SPA path to return to after login
+}
+
+// SSOStartResponse contains the authorize redirect and the sealed state to store in a cookie
+type SSOStartResponse struct {
+	AuthorizeURL string
+	State        string
+	StateTTL     time.Duration
+}
+
+// SSOCallbackRequest contains the parameters of the provider redirect to /auth/callback
+type SSOCallbackRequest struct {
+	Code        string
+	State       string
+	StateCookie string
+}
+
+// SSOCallbackResponse contains the established session and where to send the browser
+type SSOCallbackResponse struct {
+	Login    *LoginResponse
+	Redirect string
+}
+
+// StartSSO builds the hosted-UI authorize URL for the organization's identity provider.
+func (s *AuthService) StartSSO(ctx context.Context, req SSOStartRequest) (*SSOStartResponse, error) {
+	// The SSO callback can only hand the session to the browser as a cookie
+	if s.ssoClient == nil || s.sessionCookies == nil {
+		return nil, ErrSSODisabled
+	}
+
+	org, err := s.lookupOrganization(ctx, req.Org)
+	if err != nil {
+		return nil, err
+	}
+	if org.SSOProviderName == "" {
+		return nil, ErrSSONotConfigured
+	}
+
+	ttl := s.config.SSO.StateTTL
+	if ttl <= 0 {
+		ttl = defaultSSOStateTTL
+	}
+
+	state, err := sso.NewState(org.ID.String(), org.SSOProviderName, s.safeRedirect(req.Redirect), ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := s.ssoStates.Encode(state)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SSOStartResponse{
+		AuthorizeURL: s.ssoClient.AuthorizeURL(sso.AuthorizeRequest{
+			State:            state.Value,
+			Nonce:            state.Nonce,
+			CodeChallenge:    state.CodeChallenge(),
+			IdentityProvider: org.SSOProviderName,
+		}),
+		State:    sealed,
+		StateTTL: ttl,
+	}, nil
+}
+
+// CompleteSSO exchanges the authorization code, maps the federated identity to a user and creates a session.
+func (s *AuthService) CompleteSSO(ctx context.Context, req SSOCallbackRequest, clientInfo session.ClientInfo) (*SSOCallbackResponse, error) {
+	// The SSO callback can only hand the session to the browser as a cookie
+	if s.ssoClient == nil || s.sessionCookies == nil {
+		return nil, ErrSSODisabled
+	}
+
+	state, err := s.ssoStates.Decode(req.StateCookie, req.State)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.ssoClient.Exchange(ctx, req.Code, state.CodeVerifier)
+	if err != nil {
+		return nil, fmt.Errorf("code exchange failed: %w", err)
+	}
+
+	claims, err := sso.ParseIDToken(tokens.IDToken)
+	if err != nil {
+		return nil, err
+	}
+	if err := claims.Validate(s.ssoClient.ClientID(), state.Nonce, time.Now()); err != nil {
+		return nil, err
+	}
+
+	orgID, err := uuid.Parse(state.OrgID)
+	if err != nil {
+		return nil, sso.ErrInvalidState
+	}
+
+	org, err := s.userRepository.GetOrganizationByID(ctx, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get organization: %w", err)
+	}
+
+	user, err := s.federatedUser(ctx, org, state.Provider, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	login, err := s.startSession(ctx, user, &authprovider.AuthenticateOutputData{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    tokens.ExpiresIn,
+		UserSub:      claims.Subject,
+	}, clientInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SSOCallbackResponse{Login: login, Redirect: state.Redirect}, nil
+}
+
+// federatedUser links the provider identity to a Shield user, binding the external sub
+// on first login and creating the user if needed. Only a verified email is trusted, and
+// only users without a provider identity (provisioned in Shield) are bound by email;
+// accounts that already have one must be linked from an authenticated session.
+func (s *AuthService) federatedUser(ctx context.Context, org *models.Organization, provider string, claims *sso.IDTokenClaims) (*models.User, error) {
+	// Only the organization's own IdP may sign users into it; the hosted UI would also accept
+	// other identity providers and pool users for the same authorize request
+	if provider == "" || org.SSOProviderName != provider || !claims.FederatedBy(provider) {
+		return nil, ErrSSOWrongProvider
+	}
+	orgID := org.ID
+
+	if user, err := s.userRepository.GetUserByCognitoSub(ctx, claims.Subject); err == nil {
+		if user.OrgID != orgID {
+			return nil, ErrSSOUserMismatch
+		}
+		return user, nil
+	}
+
+	if claims.Email == "" {
+		return nil, fmt.Errorf("%w: missing email", sso.ErrInvalidIDToken)
+	}
+	if !claims.EmailVerified {
+		return nil, ErrSSOUnverified
+	}
+
+	if user, err := s.userRepository.GetUserByEmail(ctx, claims.Email); err == nil {
+		if user.OrgID != orgID {
+			return nil, ErrSSOUserMismatch
+		}
+		if user.CognitoSub != "" {
+			return nil, ErrSSOAccountLinked
+		}
+		user.CognitoSub = claims.Subject
+		user.IsVerified = true
+		if err := s.userRepository.UpdateUser(ctx, user); err != nil {
+			return nil, fmt.Errorf("failed to link federated user: %w", err)
+		}
+		return user, nil
+	}
+
+	user := &models.User{
+		Email:      claims.Email,
+		CognitoSub: claims.Subject,
+		OrgID:      orgID,
+		UserType:   models.UserTypeOrganization,
+		IsVerified: true, // Verified by the organization's IdP
+	}
+	if err := s.userRepository.CreateUser(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to create federated user: %w", err)
+	}
+	return user, nil
+}
+
+// lookupOrganization resolves an organization by ID or, failing that, by name.
+func (s *AuthService) lookupOrganization(ctx context.Context, org string) (*models.Organization, error) {
+	if id, err := uuid.Parse(org); err == nil {
+		return s.userRepository.GetOrganizationByID(ctx, id)
+	}
+	return s.userRepository.GetOrganizationByName(ctx, org)
+}
+
+// safeRedirect only allows relative paths so the callback cannot be used as an open redirect.
+func (s *AuthService) safeRedirect(redirect string) string {
+	fallback := s.config.SSO.DefaultRedirect
+	if fallback == "" {
+		fallback = "/"
+	}
+
+	if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") || strings.ContainsAny(redirect, "\\\r\n") {
+		return fallback
+	}
+	return redirect
+}
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	appconfig "shield/cmd/app/config"
+	"shield/modules/authn/internal/auth/sso"
+	"shield/modules/authn/internal/models"
+	"shield/modules/authn/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// federatedUsers holds users by email and records links and creations
+type federatedUsers struct {
+	repository.UserRepository
+	users   map[string]*models.User
+	updated []*models.User
+}
+
+func (r *federatedUsers) GetUserByCognitoSub(_ context.Context, sub string) (*models.User, error) {
+	for _, user := range r.users {
+		if user.CognitoSub == sub {
+			return user, nil
+		}
+	}
+	return nil, errors.New("record not found")
+}
+
+func (r *federatedUsers) GetUserByEmail(_ context.Context, email string) (*models.User, error) {
+	if user, ok := r.users[email]; ok {
+		return user, nil
+	}
+	return nil, errors.New("record not found")
+}
+
+func (r *federatedUsers) UpdateUser(_ context.Context, user *models.User) error {
+	r.updated = append(r.updated, user)
+	return nil
+}
+
+func (r *federatedUsers) CreateUser(_ context.Context, user *models.User) error {
+	user.ID = uuid.New()
+	r.users[user.Email] = user
+	return nil
+}
+
+func TestFederatedUser(t *testing.T) {
+	org := &models.Organization{ID: uuid.New(), SSOProviderName: "AcmeOkta"}
+	otherOrg := uuid.New()
+	claims := func(email string, verified bool, provider string) *sso.IDTokenClaims {
+		c := &sso.IDTokenClaims{Subject: "federated-sub", Email: email, Identities: []sso.Identity{{ProviderName: provider}}}
+		if verified {
+			c.EmailVerified = true
+		}
+		return c
+	}
+	linked := claims("renamed@acme.test", false, "AcmeOkta")
+	linked.Subject = "linked-sub"
+
+	tests := []struct {
+		name     string
+		provider string // Provider sealed in the login state
+		claims   *sso.IDTokenClaims
+		wantErr  error
+		wantLink bool
+	}{
+		{"new user", "AcmeOkta", claims("new@acme.test", true, "AcmeOkta"), nil, false},
+		{"provisioned user is linked", "AcmeOkta", claims("provisioned@acme.test", true, "AcmeOkta"), nil, true},
+		{"already linked sub", "AcmeOkta", linked, nil, false},
+		{"password user is not rebound", "AcmeOkta", claims("password@acme.test", true, "AcmeOkta"), ErrSSOAccountLinked, false},
+		{"unverified email", "AcmeOkta", claims("provisioned@acme.test", false, "AcmeOkta"), ErrSSOUnverified, false},
+		{"other identity provider", "AcmeOkta", claims("new@acme.test", true, "EvilIdP"), ErrSSOWrongProvider, false},
+		{"provider changed since login started", "OldIdP", claims("new@acme.test", true, "OldIdP"), ErrSSOWrongProvider, false},
+		{"pool user", "AcmeOkta", &sso.IDTokenClaims{Subject: "pool-sub", Email: "new@acme.test"}, ErrSSOWrongProvider, false},
+		{"user of another organization", "AcmeOkta", claims("other@acme.test", true, "AcmeOkta"), ErrSSOUserMismatch, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := &federatedUsers{users: map[string]*models.User{
+				"provisioned@acme.test": {ID: uuid.New(), Email: "provisioned@acme.test", OrgID: org.ID},
+				"password@acme.test":    {ID: uuid.New(), Email: "password@acme.test", OrgID: org.ID, CognitoSub: "password-sub"},
+				"other@acme.test":       {ID: uuid.New(), Email: "other@acme.test", OrgID: otherOrg},
+				"linked@acme.test":      {ID: uuid.New(), Email: "linked@acme.test", OrgID: org.ID, CognitoSub: "linked-sub"},
+			}}
+			svc := NewAuthService(nil, &appconfig.Config{}, users, nil, nil)
+
+			user, err := svc.federatedUser(context.Background(), org, tt.provider, tt.claims)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("federatedUser() error = %v, want %v", err, tt.wantErr)
+				}
+				if users.users["password@acme.test"].CognitoSub != "password-sub" {
+					t.Error("federatedUser() rebound the password user")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("federatedUser() error = %v", err)
+			}
+			if user.CognitoSub != tt.claims.Subject || user.OrgID != org.ID {
+				t.Errorf("federatedUser() = %+v, want %s in %s", user, tt.claims.Subject, org.ID)
+			}
+			if linked := len(users.updated) == 1; linked != tt.wantLink {
+				t.Errorf("federatedUser() linked an existing user = %v, want %v", linked, tt.wantLink)
+			}
+		})
+	}
+}
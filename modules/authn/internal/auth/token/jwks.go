@@ -0,0 +1,187 @@
+package token
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrUnknownKey is returned when no signing key matches the token's kid
+var ErrUnknownKey = errors.New("token: unknown signing key")
+
+// KeySource resolves the public key for a key ID
+type KeySource interface {
+	Key(ctx context.Context, kid string) (*rsa.PublicKey, error)
+}
+
+// StaticKeys is a fixed KeySource, useful for locally issued tokens
+type StaticKeys map[string]*rsa.PublicKey
+
+// Key returns the key for kid
+func (k StaticKeys) Key(_ context.Context, kid string) (*rsa.PublicKey, error) {
+	key, ok := k[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// JWKSConfig contains configuration for a remote JWKS
+type JWKSConfig struct {
+	URL             string
+	RefreshInterval time.Duration // How long a fetched key set is trusted (default 1h)
+	MinRefreshGap   time.Duration // Minimum time between refreshes triggered by unknown kids (default 1m)
+}
+
+// JWKSCache fetches and caches a remote JSON Web Key Set. The set is refreshed periodically
+// and when a token references an unknown kid, so provider key rotation is picked up without
+// restarts while unknown kids cannot be used to hammer the JWKS endpoint.
+type JWKSCache struct {
+	config     JWKSConfig
+	httpClient *http.Client
+
+	mu          sync.RWMutex
+	keys        map[string]*rsa.PublicKey
+	fetchedAt   time.Time
+	lastAttempt time.Time
+	now         func() time.Time
+}
+
+// NewJWKSCache creates a new JWKS cache. Keys are fetched lazily on first use.
+func NewJWKSCache(config JWKSConfig, httpClient *http.Client) *JWKSCache {
+	if config.RefreshInterval <= 0 {
+		config.RefreshInterval = time.Hour
+	}
+	if config.MinRefreshGap <= 0 {
+		config.MinRefreshGap = time.Minute
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 5 * time.Second}
+	}
+
+	return &JWKSCache{
+		config:     config,
+		httpClient: httpClient,
+		keys:       map[string]*rsa.PublicKey{},
+		now:        time.Now,
+	}
+}
+
+// Key returns the public key for kid, refreshing the key set when it is stale or kid is unknown.
+func (c *JWKSCache) Key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	c.mu.RLock()
+	key, ok := c.keys[kid]
+	stale := c.now().Sub(c.fetchedAt) > c.config.RefreshInterval
+	c.mu.RUnlock()
+
+	if ok && !stale {
+		return key, nil
+	}
+
+	if err := c.refresh(ctx, !ok); err != nil {
+		// Keep serving a known key if the JWKS endpoint is temporarily unavailable
+		if ok {
+			return key, nil
+		}
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+// refresh reloads the key set. Refreshes for unknown kids are limited to one per MinRefreshGap.
+func (c *JWKSCache) refresh(ctx context.Context, unknownKid bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if unknownKid && now.Sub(c.lastAttempt) < c.config.MinRefreshGap {
+		return ErrUnknownKey
+	}
+	if !unknownKid && now.Sub(c.fetchedAt) <= c.config.RefreshInterval {
+		return nil // Another request refreshed the set meanwhile
+	}
+	c.lastAttempt = now
+
+	keys, err := c.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	c.keys = keys
+	c.fetchedAt = now
+	return nil
+}
+
+// jsonWebKey is an RSA key from a JWKS document (RFC 7517)
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+func (c *JWKSCache) fetch(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.config.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build JWKS request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: status %d", resp.StatusCode)
+	}
+
+	var doc struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(doc.Keys))
+	for _, jwk := range doc.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		key, err := rsaPublicKey(jwk)
+		if err != nil {
+			return nil, err
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+func rsaPublicKey(jwk jsonWebKey) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus for key %s: %w", jwk.Kid, err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent for key %s: %w", jwk.Kid, err)
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}, nil
+}
@@ -0,0 +1,177 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrInvalidToken is returned for any token that fails verification
+var ErrInvalidToken = errors.New("token: invalid token")
+
+// Token use values set by Cognito
+const (
+	UseAccess = "access"
+	UseID     = "id"
+)
+
+// Claims contains the verified claims of an access or ID token
+type Claims struct {
+	jwt.RegisteredClaims
+	TokenUse  string   `json:"token_use"`
+	ClientID  string   `json:"client_id,omitempty"` // Access tokens
+	Username  string   `json:"username,omitempty"`  // Access tokens
+	Email     string   `json:"email,omitempty"`     // ID tokens
+	Scope     string   `json:"scope,omitempty"`
+	Groups    []string `json:"cognito:groups,omitempty"`
+	OriginJTI string   `json:"origin_jti,omitempty"` // Identifies the authentication event; shared by refreshed tokens
+
+	// Claims of generic OIDC providers such as Keycloak
+	AuthorizedParty   string `json:"azp,omitempty"` // Client the token was issued to
+	Type              string `json:"typ,omitempty"` // Keycloak token type: Bearer (access) or ID
+	SessionID         string `json:"sid,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Nonce             string `json:"nonce,omitempty"`   // Only ID tokens
+	AccessTokenHash   string `json:"at_hash,omitempty"` // Only ID tokens
+}
+
+// accessTokenType is the JWT header typ of RFC 9068 access tokens
+const accessTokenType = "at+jwt"
+
+// normalize fills the Cognito claims Shield reads from their OIDC equivalents. The provider
+// session ID identifies the authentication event like origin_jti; it survives refreshes.
+// Keycloak names the token use in typ. Other providers mark access tokens with an at+jwt
+// header typ; without it, a token carrying nonce or at_hash is an ID token.
+func (c *Claims) normalize(oidc bool, headerType string) {
+	if c.Username == "" {
+		c.Username = c.PreferredUsername
+	}
+	if c.OriginJTI == "" {
+		c.OriginJTI = c.SessionID
+	}
+	if oidc && c.TokenUse == "" {
+		switch {
+		case c.Type == "ID":
+			c.TokenUse = UseID
+		case c.Type == "Bearer", strings.EqualFold(strings.TrimPrefix(headerType, "application/"), accessTokenType):
+			c.TokenUse = UseAccess
+		case c.Nonce != "" || c.AccessTokenHash != "":
+			c.TokenUse = UseID
+		default:
+			c.TokenUse = UseAccess
+		}
+	}
+}
+
+// VerifierConfig contains the expected token issuer and audience
+type VerifierConfig struct {
+	Issuer          string
+	ClientID        string
+	AllowedTokenUse []string      // Defaults to access tokens only
+	Leeway          time.Duration // Allowed clock skew for exp/iat/nbf
+	OIDC            bool          // Tokens of a generic OIDC provider: no token_use, the client is in azp or aud
+}
+
+// Verifier validates RS256 signed JWTs issued by the identity provider
+type Verifier struct {
+	keys   KeySource
+	config VerifierConfig
+	parser *jwt.Parser
+}
+
+// NewVerifier creates a new token verifier
+func NewVerifier(keys KeySource, config VerifierConfig) *Verifier {
+	if len(config.AllowedTokenUse) == 0 {
+		config.AllowedTokenUse = []string{UseAccess}
+	}
+
+	return &Verifier{
+		keys:   keys,
+		config: config,
+		parser: jwt.NewParser(
+			jwt.WithValidMethods([]string{"RS256"}),
+			jwt.WithIssuer(config.Issuer),
+			jwt.WithExpirationRequired(),
+			jwt.WithIssuedAt(),
+			jwt.WithLeeway(config.Leeway),
+		),
+	}
+}
+
+// Verify checks the signature, issuer, expiry, token_use and audience of rawToken.
+// Cognito access tokens carry the app client in client_id, ID tokens in aud; OIDC
+// tokens carry it in azp or aud.
+func (v *Verifier) Verify(ctx context.Context, rawToken string) (*Claims, error) {
+	var claims Claims
+	tok, err := v.parser.ParseWithClaims(rawToken, &claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.keys.Key(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	headerType, _ := tok.Header["typ"].(string)
+	claims.normalize(v.config.OIDC, headerType)
+
+	if !v.allowedUse(claims.TokenUse) {
+		return nil, fmt.Errorf("%w: token_use %q not accepted", ErrInvalidToken, claims.TokenUse)
+	}
+
+	switch {
+	case v.config.OIDC:
+		if claims.AuthorizedParty != v.config.ClientID && !containsString(claims.Audience, v.config.ClientID) {
+			return nil, fmt.Errorf("%w: azp and audience mismatch", ErrInvalidToken)
+		}
+	case claims.TokenUse == UseAccess:
+		if claims.ClientID != v.config.ClientID {
+			return nil, fmt.Errorf("%w: client_id mismatch", ErrInvalidToken)
+		}
+	case claims.TokenUse == UseID:
+		if !containsString(claims.Audience, v.config.ClientID) {
+			return nil, fmt.Errorf("%w: audience mismatch", ErrInvalidToken)
+		}
+	}
+
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing sub", ErrInvalidToken)
+	}
+	return &claims, nil
+}
+
+// UnverifiedClaims decodes the claims of a token without verifying it. It must only be
+// used on tokens received directly from the provider, e.g. to read origin_jti after login.
+func UnverifiedClaims(rawToken string) (*Claims, error) {
+	var claims Claims
+	if _, _, err := jwt.NewParser().ParseUnverified(rawToken, &claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	claims.normalize(false, "")
+	return &claims, nil
+}
+
+func (v *Verifier) allowedUse(use string) bool {
+	return containsString(v.config.AllowedTokenUse, use)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// CognitoIssuer returns the issuer of tokens from a Cognito user pool.
+func CognitoIssuer(region, userPoolID string) string {
+	return fmt.Sprintf("https://cognito-idp.%s.amazonaws.com/%s", region, userPoolID)
+}
+
+// JWKSURL returns the standard JWKS location for an issuer.
+func JWKSURL(issuer string) string {
+	return issuer + "/.well-known/jwks.json"
+}
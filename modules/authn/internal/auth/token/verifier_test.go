@@ -0,0 +1,289 @@
+package token
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testIssuer   = "https://cognito-idp.eu-north-1.amazonaws.com/eu-north-1_test"
+	testClientID = "test-client"
+)
+
+// jwksServer serves a JWKS document whose keys can be rotated by the test
+type jwksServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	keys     map[string]*rsa.PrivateKey
+	requests atomic.Int32
+}
+
+func newJWKSServer(t *testing.T) *jwksServer {
+	t.Helper()
+	s := &jwksServer{keys: map[string]*rsa.PrivateKey{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		var doc struct {
+			Keys []jsonWebKey `json:"keys"`
+		}
+		for kid, key := range s.keys {
+			doc.Keys = append(doc.Keys, jsonWebKey{
+				Kid: kid,
+				Kty: "RSA",
+				Use: "sig",
+				N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		_ = json.NewEncoder(w).Encode(doc)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// addKey generates a signing key published under kid
+func (s *jwksServer) addKey(t *testing.T, kid string) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	s.mu.Lock()
+	s.keys[kid] = key
+	s.mu.Unlock()
+	return key
+}
+
+func sign(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	tok.Header["kid"] = kid
+	raw, err := tok.SignedString(key)
+	if err != nil {
+		t.Fatalf("SignedString() error = %v", err)
+	}
+	return raw
+}
+
+func accessClaims(now time.Time) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":       testIssuer,
+		"sub":       "user-sub",
+		"client_id": testClientID,
+		"token_use": UseAccess,
+		"username":  "user-sub",
+		"iat":       now.Unix(),
+		"exp":       now.Add(time.Hour).Unix(),
+	}
+}
+
+func TestVerify(t *testing.T) {
+	server := newJWKSServer(t)
+	key := server.addKey(t, "key-1")
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+
+	verifier := NewVerifier(NewJWKSCache(JWKSConfig{URL: server.URL}, server.Client()), VerifierConfig{
+		Issuer:          testIssuer,
+		ClientID:        testClientID,
+		AllowedTokenUse: []string{UseAccess, UseID},
+	})
+	now := time.Now()
+
+	with := func(k string, v interface{}) jwt.MapClaims {
+		claims := accessClaims(now)
+		if v == nil {
+			delete(claims, k)
+		} else {
+			claims[k] = v
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"valid access token", sign(t, key, "key-1", accessClaims(now)), false},
+		{"valid id token", sign(t, key, "key-1", jwt.MapClaims{
+			"iss": testIssuer, "sub": "user-sub", "aud": testClientID, "token_use": UseID,
+			"email": "user@example.com", "iat": now.Unix(), "exp": now.Add(time.Hour).Unix(),
+		}), false},
+		{"wrong issuer", sign(t, key, "key-1", with("iss", "https://evil.example.com")), true},
+		{"wrong client_id", sign(t, key, "key-1", with("client_id", "other-client")), true},
+		{"id token for other audience", sign(t, key, "key-1", jwt.MapClaims{
+			"iss": testIssuer, "sub": "user-sub", "aud": "other-client", "token_use": UseID,
+			"iat": now.Unix(), "exp": now.Add(time.Hour).Unix(),
+		}), true},
+		{"unknown token_use", sign(t, key, "key-1", with("token_use", "refresh")), true},
+		{"expired", sign(t, key, "key-1", with("exp", now.Add(-time.Minute).Unix())), true},
+		{"missing exp", sign(t, key, "key-1", with("exp", nil)), true},
+		{"missing sub", sign(t, key, "key-1", with("sub", nil)), true},
+		{"signed by unpublished key", sign(t, otherKey, "key-1", accessClaims(now)), true},
+		{"unknown kid", sign(t, otherKey, "key-x", accessClaims(now)), true},
+		{"malformed", "not-a-jwt", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := verifier.Verify(context.Background(), tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Verify() error = %v, want ErrInvalidToken", err)
+			}
+			if err == nil && claims.Subject != "user-sub" {
+				t.Errorf("Verify() sub = %q, want user-sub", claims.Subject)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsNonRS256(t *testing.T) {
+	verifier := NewVerifier(StaticKeys{}, VerifierConfig{Issuer: testIssuer, ClientID: testClientID})
+
+	tok := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims(time.Now()))
+	raw, err := tok.SignedString([]byte("shared-secret"))
+	if err != nil {
+		t.Fatalf("SignedString() error = %v", err)
+	}
+
+	if _, err := verifier.Verify(context.Background(), raw); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verify() error = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestVerifyOIDC(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	verifier := NewVerifier(StaticKeys{"key-1": &key.PublicKey}, VerifierConfig{Issuer: testIssuer, ClientID: testClientID, OIDC: true})
+	now := time.Now()
+
+	// Keycloak access tokens carry the client in azp and the account service in aud
+	keycloakClaims := func(k string, v interface{}) jwt.MapClaims {
+		claims := jwt.MapClaims{
+			"iss": testIssuer, "sub": "user-sub", "aud": "account", "azp": testClientID, "typ": "Bearer",
+			"sid": "session-1", "preferred_username": "user@example.com", "iat": now.Unix(), "exp": now.Add(time.Hour).Unix(),
+		}
+		claims[k] = v
+		return claims
+	}
+
+	claims, err := verifier.Verify(context.Background(), sign(t, key, "key-1", keycloakClaims("typ", "Bearer")))
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if claims.TokenUse != UseAccess || claims.Username != "user@example.com" || claims.OriginJTI != "session-1" {
+		t.Errorf("Verify() claims = %+v, want access token use, preferred_username and sid as origin_jti", claims)
+	}
+
+	// Other providers name no token use in the claims
+	genericClaims := func(k string, v interface{}) jwt.MapClaims {
+		claims := jwt.MapClaims{
+			"iss": testIssuer, "sub": "user-sub", "aud": testClientID, "iat": now.Unix(), "exp": now.Add(time.Hour).Unix(),
+		}
+		claims[k] = v
+		return claims
+	}
+	atJWT := jwt.NewWithClaims(jwt.SigningMethodRS256, genericClaims("nonce", "n-1"))
+	atJWT.Header["kid"], atJWT.Header["typ"] = "key-1", "at+jwt"
+	rawAtJWT, err := atJWT.SignedString(key)
+	if err != nil {
+		t.Fatalf("SignedString() error = %v", err)
+	}
+	for name, token := range map[string]string{
+		"at+jwt access token":         rawAtJWT,
+		"access token without at+jwt": sign(t, key, "key-1", genericClaims("scope", "openid")),
+	} {
+		if claims, err := verifier.Verify(context.Background(), token); err != nil || claims.TokenUse != UseAccess {
+			t.Errorf("Verify() %s = %+v, %v; want an access token", name, claims, err)
+		}
+	}
+
+	for name, token := range map[string]string{
+		"other client":          sign(t, key, "key-1", keycloakClaims("azp", "other-client")),
+		"id token":              sign(t, key, "key-1", keycloakClaims("typ", "ID")),
+		"id token with nonce":   sign(t, key, "key-1", genericClaims("nonce", "n-1")),
+		"id token with at_hash": sign(t, key, "key-1", genericClaims("at_hash", "hash")),
+	} {
+		if _, err := verifier.Verify(context.Background(), token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Verify() %s error = %v, want ErrInvalidToken", name, err)
+		}
+	}
+}
+
+func TestJWKSCacheRotation(t *testing.T) {
+	server := newJWKSServer(t)
+	key1 := server.addKey(t, "key-1")
+
+	// The cache clock is advanced independently; tokens are checked against the real clock
+	now := time.Now()
+	claims := accessClaims(now)
+	cache := NewJWKSCache(JWKSConfig{URL: server.URL, MinRefreshGap: time.Minute}, server.Client())
+	cache.now = func() time.Time { return now }
+	verifier := NewVerifier(cache, VerifierConfig{Issuer: testIssuer, ClientID: testClientID})
+	ctx := context.Background()
+
+	if _, err := verifier.Verify(ctx, sign(t, key1, "key-1", claims)); err != nil {
+		t.Fatalf("Verify() with initial key error = %v", err)
+	}
+	if _, err := verifier.Verify(ctx, sign(t, key1, "key-1", claims)); err != nil {
+		t.Fatalf("Verify() with cached key error = %v", err)
+	}
+	if got := server.requests.Load(); got != 1 {
+		t.Fatalf("JWKS fetched %d times, want 1", got)
+	}
+
+	// The provider rotates to a new key; tokens signed with it trigger a refresh once the gap has passed
+	key2 := server.addKey(t, "key-2")
+	now = now.Add(2 * time.Minute)
+	if _, err := verifier.Verify(ctx, sign(t, key2, "key-2", claims)); err != nil {
+		t.Fatalf("Verify() with rotated key error = %v", err)
+	}
+	if got := server.requests.Load(); got != 2 {
+		t.Fatalf("JWKS fetched %d times, want 2", got)
+	}
+
+	// Unknown kids within the gap do not hit the JWKS endpoint again
+	stray, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := verifier.Verify(ctx, sign(t, stray, "key-x", claims)); err == nil {
+			t.Fatal("Verify() with unknown kid succeeded")
+		}
+	}
+	if got := server.requests.Load(); got != 2 {
+		t.Errorf("JWKS fetched %d times after unknown kids, want 2", got)
+	}
+
+	// A stale key set is served from cache when the endpoint is down
+	server.Close()
+	now = now.Add(2 * time.Hour)
+	if _, err := verifier.Verify(ctx, sign(t, key2, "key-2", claims)); err != nil {
+		t.Errorf("Verify() with JWKS endpoint down error = %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// APIKey authenticates an application. Only a hash of the key's secret is stored; the prefix
+// identifies the key and is shown in listings.
+type APIKey struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	AppID      uuid.UUID  `gorm:"type:uuid;not null;index" json:"app_id"`
+	Prefix     string     `gorm:"type:varchar(32);not null;uniqueIndex" json:"prefix"`
+	SecretHash string     `gorm:"type:varchar(64);not null" json:"-"` // SHA-256 of the secret
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`               // Set when the key is rotated out
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+
+	// Relationships
+	Application *Application `gorm:"foreignKey:AppID" json:"application,omitempty"`
+}
+
+// Active reports whether the key is neither revoked nor expired at now
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// BeforeCreate sets the ID of a new key
+func (k *APIKey) BeforeCreate(tx *gorm.DB) error {
+	if k.ID == uuid.Nil {
+		k.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// MFAEngine selects which component verifies a user's second factor.
+type MFAEngine string
+
+const (
+	MFAEngineProvider MFAEngine = "provider" // MFA handled by the identity provider (e.g., Cognito)
+	MFAEngineLocal    MFAEngine = "local"    // MFA handled by Shield's built-in TOTP engine
+)
+
+// MFASecret stores a user's TOTP secret for the local MFA engine.
+type MFASecret struct {
+	UserID          uuid.UUID `gorm:"type:uuid;primaryKey" json:"user_id"`
+	EncryptedSecret string    `gorm:"type:text;not null" json:"-"`
+	PendingSecret   string    `gorm:"type:text" json:"-"`             // Re-enrolled secret awaiting its first code; the confirmed one stays active until then
+	Confirmed       bool      `gorm:"default:false" json:"confirmed"` // Set once the first code has been verified
+	LastUsedStep    int64     `gorm:"default:0" json:"-"`             // Last accepted TOTP time step, used to reject replays
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+
+	// Relationships
+	User *User `gorm:"foreignKey:UserID" json:"user,omitempty"`
+}
+
+// MFARecoveryCode is a single-use code that can replace a TOTP code.
+type MFARecoveryCode struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	CodeHash  string     `gorm:"type:varchar(64);not null" json:"-"` // SHA-256 of the normalized code
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// BeforeCreate will set a UUID rather than relying on default database UUID generation.
+func (c *MFARecoveryCode) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
@@ -18,17 +18,18 @@ const (
 
 // Organization represents an organization entity in the system.
 type Organization struct {
-	ID                  uuid.UUID         `gorm:"type:uuid;primary_key;" json:"id"`
-	Name                string            `gorm:"type:varchar(255);not null" json:"name"`
-	SSOProviderName     string            `gorm:"type:varchar(255)" json:"ssoProviderName,omitempty"` // Name of the IdP registered in Cognito (e.g., "AcmeOktaSAML")
-	IDPType             IDPType           `gorm:"type:varchar(50)" json:"idpType,omitempty"`          // Type of IdP (e.g., "SAML", "OIDC")
-	CallbackURL         string            `gorm:"type:varchar(255)" json:"callbackUrl,omitempty"`     // Callback URL for this org's SSO, if specific
-	CreatedAt           time.Time         `json:"createdAt"`
-	UpdatedAt           time.Time         `json:"updatedAt"`
-	DeletedAt           gorm.DeletedAt    `gorm:"index" json:"-"`                                                    // For soft deletes
-	Users               []User            `gorm:"foreignKey:OrgID" json:"-"`                                         // Users belonging to this organization
-	SSOProviderConfigID uuid.UUID         `gorm:"type:uuid;" json:"ssoProviderConfigId,omitempty"`                   // Foreign key to SSOProviderConfig
-	SSOProviderConfig   SSOProviderConfig `gorm:"foreignKey:SSOProviderConfigID" json:"ssoProviderConfig,omitempty"` // Associated SSOProviderConfig
+	ID                  uuid.UUID          `gorm:"type:uuid;primary_key;" json:"id"`
+	Name                string             `gorm:"type:varchar(255);not null" json:"name"`
+	SSOProviderName     string             `gorm:"type:varchar(255)" json:"ssoProviderName,omitempty"` // Name of the IdP registered in Cognito (e.g., "AcmeOktaSAML")
+	IDPType             IDPType            `gorm:"type:varchar(50)" json:"idpType,omitempty"`          // Type of IdP (e.g., "SAML", "OIDC")
+	CallbackURL         string             `gorm:"type:varchar(255)" json:"callbackUrl,omitempty"`     // Callback URL for this org's SSO, if specific
+	MFAEngine           MFAEngine          `gorm:"type:varchar(20)" json:"mfaEngine,omitempty"`        // Which engine verifies MFA for members; empty follows the deployment default
+	CreatedAt           time.Time          `json:"createdAt"`
+	UpdatedAt           time.Time          `json:"updatedAt"`
+	DeletedAt           gorm.DeletedAt     `gorm:"index" json:"-"`                                                    // For soft deletes
+	Users               []User             `gorm:"foreignKey:OrgID" json:"-"`                                         // Users belonging to this organization
+	SSOProviderConfigID *uuid.UUID         `gorm:"type:uuid;" json:"ssoProviderConfigId,omitempty"`                   // Foreign key to SSOProviderConfig; nil until SSO is configured
+	SSOProviderConfig   *SSOProviderConfig `gorm:"foreignKey:SSOProviderConfigID" json:"ssoProviderConfig,omitempty"` // Associated SSOProviderConfig
 }
 
 // BeforeCreate will set a UUID rather than relying on default database UUID generation.
@@ -41,10 +42,30 @@ func (org *Organization) BeforeCreate(tx *gorm.DB) (err error) {
 
 // SSOProviderConfig represents the SSO configurations for an organization.
 type SSOProviderConfig struct {
-	ID           uuid.UUID `gorm:"type:uuid;primary_key;" json:"id"`
-	MetadataURL  string    `gorm:"type:varchar(255)" json:"metadataUrl,omitempty"`  // Metadata URL for SAML
-	ClientID     string    `gorm:"type:varchar(255)" json:"clientId,omitempty"`     // Client ID for OIDC
-	ClientSecret string    `gorm:"type:varchar(255)" json:"clientSecret,omitempty"` // Client Secret for OIDC
-	CreatedAt    time.Time `json:"createdAt"`
-	UpdatedAt    time.Time `json:"updatedAt"`
+	ID                 uuid.UUID         `gorm:"type:uuid;primary_key;" json:"id"`
+	OrgID              uuid.UUID         `gorm:"type:uuid;index" json:"orgId"`
+	ProviderName       string            `gorm:"type:varchar(32);uniqueIndex" json:"providerName"`     // Name of the IdP registered with the auth provider
+	IDPType            IDPType           `gorm:"type:varchar(50)" json:"idpType"`                      // SAML or OIDC
+	MetadataURL        string            `gorm:"type:varchar(255)" json:"metadataUrl,omitempty"`       // Metadata URL for SAML
+	MetadataXML        string            `gorm:"type:text" json:"metadataXml,omitempty"`               // Inline metadata document for SAML
+	Issuer             string            `gorm:"type:varchar(255)" json:"issuer,omitempty"`            // Issuer URL for OIDC
+	ClientID           string            `gorm:"type:varchar(255)" json:"clientId,omitempty"`          // Client ID for OIDC
+	ClientSecret       string            `gorm:"type:varchar(255)" json:"-"`                           // Never persisted; the secret is held by the auth provider
+	AuthorizeScopes    string            `gorm:"type:varchar(255)" json:"authorizeScopes,omitempty"`   // Space-separated OIDC scopes
+	AttributeMapping   map[string]string `gorm:"type:jsonb;serializer:json" json:"attributeMapping"`   // User pool attribute -> IdP attribute
+	IdpIdentifiers     []string          `gorm:"type:jsonb;serializer:json" json:"idpIdentifiers"`     // Verified email domains routed to this IdP
+	PendingIdentifiers []string          `gorm:"type:jsonb;serializer:json" json:"pendingIdentifiers"` // Requested domains awaiting DNS verification
+	VerificationToken  string            `gorm:"type:varchar(64)" json:"verificationToken,omitempty"`  // Published in a TXT record to verify domains
+	LastTestedAt       *time.Time        `json:"lastTestedAt,omitempty"`
+	LastTestError      string            `gorm:"type:text" json:"lastTestError,omitempty"`
+	CreatedAt          time.Time         `json:"createdAt"`
+	UpdatedAt          time.Time         `json:"updatedAt"`
+}
+
+// BeforeCreate will set a UUID rather than relying on default database UUID generation.
+func (c *SSOProviderConfig) BeforeCreate(tx *gorm.DB) (err error) {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return
 }
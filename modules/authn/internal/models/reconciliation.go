@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ReconciliationAction identifies the work a reconciliation job performs.
+type ReconciliationAction string
+
+const (
+	// ReconcileRollbackSignup deletes the provider user and organization of a signup whose
+	// local user record was never committed. The provider user is only deleted once the
+	// signup recorded it, so a pre-existing user with the same username is never touched.
+	ReconcileRollbackSignup ReconciliationAction = "rollback_signup"
+)
+
+// ReconciliationJob is an outbox entry that keeps the identity provider and the database
+// consistent. Signups store one before calling the provider and delete it in the transaction
+// that creates the user, so a job that is still present after its grace period belongs to a
+// signup that failed or crashed halfway and is rolled back by the reconciler.
+type ReconciliationJob struct {
+	ID            uuid.UUID            `gorm:"type:uuid;primary_key" json:"id"`
+	Action        ReconciliationAction `gorm:"type:varchar(50);not null" json:"action"`
+	Username      string               `gorm:"type:varchar(255)" json:"username"`    // Provider username of the signup
+	ProviderSub   string               `gorm:"type:varchar(255)" json:"providerSub"` // Set once the provider created the user
+	OrgID         *uuid.UUID           `gorm:"type:uuid" json:"orgId,omitempty"`     // Organization to delete, for organization signups
+	Attempts      int                  `gorm:"default:0" json:"attempts"`            // Failed attempts so far
+	LastError     string               `gorm:"type:text" json:"lastError,omitempty"` // Error of the last failed attempt
+	NextAttemptAt time.Time            `gorm:"index;not null" json:"nextAttemptAt"`  // Not processed before this time
+	FailedAt      *time.Time           `gorm:"index" json:"failedAt,omitempty"`      // Set when attempts are exhausted; needs manual cleanup
+	CreatedAt     time.Time            `json:"createdAt"`
+	UpdatedAt     time.Time            `json:"updatedAt"`
+}
+
+// BeforeCreate will set a UUID rather than relying on default database UUID generation.
+func (j *ReconciliationJob) BeforeCreate(tx *gorm.DB) error {
+	if j.ID == uuid.Nil {
+		j.ID = uuid.New()
+	}
+	return nil
+}
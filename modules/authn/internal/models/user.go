@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,6 +14,7 @@ type UserType string
 const (
 	UserTypeIndividual   UserType = "individual"
 	UserTypeOrganization UserType = "organization"
+	UserTypeOrgAdmin     UserType = "organization_admin" // Manages the organization's settings and SSO
 )
 
 // MFAMethod defines the type of MFA method
@@ -34,41 +36,109 @@ type User struct {
 	CreatedAt  time.Time `json:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at"`
 
+	// MFA enrollment
+	MFAEnabled         bool      `gorm:"default:false" json:"mfa_enabled"`
+	MFAMethods         string    `gorm:"type:varchar(255)" json:"mfa_methods,omitempty"` // Comma-separated list of enrolled MFAMethod values
+	PreferredMFAMethod MFAMethod `gorm:"type:varchar(20)" json:"preferred_mfa_method,omitempty"`
+
 	// Relationships
 	Organization *Organization `gorm:"foreignKey:OrgID" json:"organization,omitempty"` // This will now refer to Organization in organization.go
 	Sessions     []Session     `gorm:"foreignKey:UserID" json:"sessions,omitempty"`
 	UserAppRoles []UserAppRole `gorm:"foreignKey:UserID" json:"user_app_roles,omitempty"`
 }
 
+// IsOrgAdmin reports whether the user administers the given organization.
+func (u *User) IsOrgAdmin(orgID uuid.UUID) bool {
+	return u.UserType == UserTypeOrgAdmin && u.OrgID == orgID
+}
+
+// EnrolledMFAMethods returns the MFA methods the user has enrolled.
+func (u *User) EnrolledMFAMethods() []MFAMethod {
+	if u.MFAMethods == "" {
+		return nil
+	}
+	parts := strings.Split(u.MFAMethods, ",")
+	methods := make([]MFAMethod, 0, len(parts))
+	for _, p := range parts {
+		methods = append(methods, MFAMethod(p))
+	}
+	return methods
+}
+
+// HasMFAMethod reports whether the user has enrolled the given MFA method.
+func (u *User) HasMFAMethod(method MFAMethod) bool {
+	for _, m := range u.EnrolledMFAMethods() {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// AddMFAMethod records an enrolled MFA method and enables MFA for the user.
+// The first enrolled method becomes the preferred one.
+func (u *User) AddMFAMethod(method MFAMethod) {
+	if !u.HasMFAMethod(method) {
+		if u.MFAMethods == "" {
+			u.MFAMethods = string(method)
+		} else {
+			u.MFAMethods += "," + string(method)
+		}
+	}
+	if u.PreferredMFAMethod == "" {
+		u.PreferredMFAMethod = method
+	}
+	u.MFAEnabled = true
+}
+
 // Organization struct is now defined in organization.go
 
 type Session struct {
-	ID               string    `gorm:"type:varchar(255);primary_key" json:"id"`
-	UserID           uuid.UUID `gorm:"type:uuid;not null" json:"user_id"`
-	RefreshToken     string    `gorm:"type:varchar(255);not null" json:"refresh_token"`
-	IPAddress        string    `gorm:"type:varchar(45)" json:"ip_address"`
-	UserAgent        string    `gorm:"type:text" json:"user_agent"`
-	DeviceID         string    `gorm:"type:varchar(255)" json:"device_id"`
-	ExpiresAt        time.Time `json:"expires_at"`
-	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
-	IsActive         bool      `gorm:"default:true" json:"is_active"`
-	CreatedAt        time.Time `json:"created_at"`
-	UpdatedAt        time.Time `json:"updated_at"`
+	ID                   string    `gorm:"type:varchar(255);primary_key" json:"id"`
+	UserID               uuid.UUID `gorm:"type:uuid;not null" json:"user_id"`
+	RefreshTokenHash     string    `gorm:"column:refresh_token;type:varchar(255);not null;uniqueIndex" json:"-"` // SHA-256 of the current Shield refresh token
+	RefreshToken         string    `gorm:"-" json:"-"`                                                           // Plaintext refresh token, only set when issued
+	ProviderTokenID      string    `gorm:"type:varchar(255);index" json:"-"`                                     // origin_jti of the provider tokens; links bearer tokens to the session
+	ProviderRefreshToken string    `gorm:"type:text" json:"-"`                                                   // Provider refresh token, encrypted
+	ProviderUsername     string    `gorm:"type:varchar(255)" json:"-"`                                           // Username the provider tokens were issued to
+	IPAddress            string    `gorm:"type:varchar(45)" json:"ip_address"`
+	UserAgent            string    `gorm:"type:text" json:"user_agent"`
+	DeviceID             string    `gorm:"type:varchar(255)" json:"device_id"`
+	ExpiresAt            time.Time `json:"expires_at"`
+	RefreshExpiresAt     time.Time `json:"refresh_expires_at"`
+	IsActive             bool      `gorm:"default:true" json:"is_active"`
+	CreatedAt            time.Time `json:"created_at"`
+	UpdatedAt            time.Time `json:"updated_at"`
 
 	// Relationships
 	User *User `gorm:"foreignKey:UserID;references:ID" json:"user,omitempty"`
 }
 
+// RotatedRefreshToken records a refresh token that has been replaced by rotation.
+// Presenting it again means the token was stolen, and ends the session it belonged to.
+type RotatedRefreshToken struct {
+	TokenHash string    `gorm:"type:varchar(64);primary_key" json:"-"`
+	SessionID string    `gorm:"type:varchar(255);not null;index" json:"session_id"`
+	RotatedAt time.Time `json:"rotated_at"`
+}
+
+// Application statuses; only active applications receive authorization decisions
+const (
+	ApplicationStatusActive   = "active"
+	ApplicationStatusDisabled = "disabled"
+)
+
 type Application struct {
 	ID          uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	OrgID       uuid.UUID `gorm:"type:uuid;index" json:"org_id"` // Organization whose admins manage the application
 	Name        string    `gorm:"not null" json:"name"`
-	APIKey      string    `gorm:"uniqueIndex" json:"api_key"`
-	OPAEndpoint string    `gorm:"not null" json:"opa_endpoint"`
+	OPAEndpoint string    `gorm:"not null" json:"opa_endpoint"` // Policy package of the application: org_<org ID>.app_<app ID>, without dashes
 	Status      string    `json:"status"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 
 	// Relationships
+	APIKeys     []APIKey          `gorm:"foreignKey:AppID" json:"-"`
 	Roles       []ApplicationRole `gorm:"foreignKey:AppID" json:"roles,omitempty"`
 	UserRoles   []UserAppRole     `gorm:"foreignKey:AppID" json:"user_roles,omitempty"`
 	OPAPolicies []OPAPolicy       `gorm:"foreignKey:AppID" json:"opa_policies,omitempty"`
@@ -76,8 +146,8 @@ type Application struct {
 
 type ApplicationRole struct {
 	ID          uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	AppID       uuid.UUID `gorm:"type:uuid;not null" json:"app_id"`
-	Name        string    `gorm:"not null" json:"name"`
+	AppID       uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_application_role_name" json:"app_id"`
+	Name        string    `gorm:"not null;uniqueIndex:idx_application_role_name" json:"name"` // Referenced by UserAppRole.RoleName
 	Description string    `json:"description"`
 	CreatedAt   time.Time `json:"created_at"`
 
@@ -98,19 +168,42 @@ type UserAppRole struct {
 
 type OPAPolicy struct {
 	ID         uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	AppID      uuid.UUID `gorm:"type:uuid;not null" json:"app_id"`
-	Name       string    `gorm:"not null" json:"name"`
+	AppID      uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_opa_policy_version" json:"app_id"`
+	Name       string    `gorm:"not null;uniqueIndex:idx_opa_policy_version" json:"name"`
 	RegoPolicy string    `gorm:"type:text;not null" json:"rego_policy"`
-	Version    int       `json:"version"`
+	Version    int       `gorm:"not null;uniqueIndex:idx_opa_policy_version" json:"version"`
+	Active     bool      `gorm:"not null;default:false" json:"active"` // At most one version per name is evaluated
+	CreatedBy  uuid.UUID `gorm:"type:uuid" json:"created_by"`          // User who uploaded the version
 	CreatedAt  time.Time `json:"created_at"`
 
 	// Relationships
 	Application *Application `gorm:"foreignKey:AppID" json:"application,omitempty"`
 }
 
+// Policy change actions
+const (
+	PolicyChangeUpload   = "upload"
+	PolicyChangeActivate = "activate"
+	PolicyChangeRollback = "rollback"
+)
+
+// PolicyChange records who uploaded or activated a version of an application's policy
+type PolicyChange struct {
+	ID              uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	AppID           uuid.UUID `gorm:"type:uuid;not null;index" json:"app_id"`
+	PolicyName      string    `gorm:"not null" json:"policy_name"`
+	Version         int       `gorm:"not null" json:"version"`
+	PreviousVersion int       `json:"previous_version"` // Version active before the change; 0 when there was none
+	Action          string    `gorm:"not null" json:"action"`
+	ActorID         uuid.UUID `gorm:"type:uuid;not null" json:"actor_id"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// PolicySyncStatus records when the active policies of an application were last published to
+// the policy engine
 type PolicySyncStatus struct {
 	AppID    uuid.UUID `gorm:"type:uuid;primaryKey" json:"app_id"`
-	Version  int       `json:"version"`
+	Version  int       `json:"version"` // Highest version among the published policies
 	SyncedAt time.Time `json:"synced_at"`
 
 	// Relationships
@@ -125,4 +218,32 @@ func (u *User) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+func (a *Application) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
+
+func (r *ApplicationRole) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+func (p *OPAPolicy) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return nil
+}
+
+func (c *PolicyChange) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
+
 // BeforeCreate for Organization is now in organization.go
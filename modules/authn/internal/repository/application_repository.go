@@ -0,0 +1,454 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"shield/modules/authn/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ApplicationRepository defines the database operations on applications, their API keys and roles.
+// Applications of deleted organizations are not found, except by ListAllApplications.
+type ApplicationRepository interface {
+	// CreateApplication creates the application together with its first API key
+	CreateApplication(ctx context.Context, app *models.Application, key *models.APIKey) error
+	// GetApplication returns the application with the given ID
+	GetApplication(ctx context.Context, id uuid.UUID) (*models.Application, error)
+	// ListApplications returns the applications of an organization
+	ListApplications(ctx context.Context, orgID uuid.UUID) ([]models.Application, error)
+	// ListAllApplications returns the applications of all organizations, including the ones
+	// registered before applications belonged to organizations
+	ListAllApplications(ctx context.Context) ([]models.Application, error)
+	// UpdateApplication saves the application
+	UpdateApplication(ctx context.Context, app *models.Application) error
+	// DeleteApplication deletes the application with its API keys, roles and policies
+	DeleteApplication(ctx context.Context, id uuid.UUID) error
+
+	// ListAPIKeys returns the API keys of an application, newest first
+	ListAPIKeys(ctx context.Context, appID uuid.UUID) ([]models.APIKey, error)
+	// GetAPIKeyByPrefix returns the API key with the given prefix and its application
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error)
+	// RotateAPIKey creates the key and makes the application's other keys expire at expiresAt,
+	// unless they expire or were revoked earlier
+	RotateAPIKey(ctx context.Context, key *models.APIKey, expiresAt time.Time) error
+	// RevokeAPIKey revokes a key of the application. It returns gorm.ErrRecordNotFound when the
+	// application has no such key that is not yet revoked.
+	RevokeAPIKey(ctx context.Context, appID, keyID uuid.UUID, at time.Time) error
+	// TouchAPIKey records the use of a key
+	TouchAPIKey(ctx context.Context, keyID uuid.UUID, at time.Time) error
+
+	// ListRoles returns the roles defined for an application
+	ListRoles(ctx context.Context, appID uuid.UUID) ([]models.ApplicationRole, error)
+	// GetRole returns the application's role with the given name
+	GetRole(ctx context.Context, appID uuid.UUID, name string) (*models.ApplicationRole, error)
+	// CreateRole defines a role for an application
+	CreateRole(ctx context.Context, role *models.ApplicationRole) error
+	// DeleteRole deletes the application's role together with its assignments
+	DeleteRole(ctx context.Context, appID uuid.UUID, name string) error
+	// AssignRole assigns a role to a user. It returns gorm.ErrRecordNotFound when the application
+	// has no role with that name; assigning a role twice is not an error.
+	AssignRole(ctx context.Context, assignment *models.UserAppRole) error
+	// UnassignRole removes a role from a user. It returns gorm.ErrRecordNotFound when the user
+	// does not hold the role.
+	UnassignRole(ctx context.Context, userID, appID uuid.UUID, name string) error
+	// ListRoleHolders returns a page of the users holding the application's role, ordered by
+	// email, and the total number of holders
+	ListRoleHolders(ctx context.Context, appID uuid.UUID, name string, offset, limit int) ([]models.User, int64, error)
+	// ListUserAppRoles returns the roles a user holds in all applications, with their applications
+	ListUserAppRoles(ctx context.Context, userID uuid.UUID) ([]models.UserAppRole, error)
+	// GetUserRoleNames returns the names of the roles the user holds in the application
+	GetUserRoleNames(ctx context.Context, userID, appID uuid.UUID) ([]string, error)
+
+	// ActivePolicies returns the active version of each of the application's policies
+	ActivePolicies(ctx context.Context, appID uuid.UUID) ([]models.OPAPolicy, error)
+	// ListPolicyVersions returns the versions of the application's policy, newest first
+	ListPolicyVersions(ctx context.Context, appID uuid.UUID, name string) ([]models.OPAPolicy, error)
+	// GetPolicyVersion returns a version of the application's policy
+	GetPolicyVersion(ctx context.Context, appID uuid.UUID, name string, version int) (*models.OPAPolicy, error)
+	// CreatePolicyVersion saves the policy as the next, inactive version of its name and records
+	// the upload by actorID
+	CreatePolicyVersion(ctx context.Context, p *models.OPAPolicy, actorID uuid.UUID) error
+	// ActivatePolicyVersion makes the change's version the active one of its policy and records
+	// the change. It returns gorm.ErrRecordNotFound when the version does not exist; activating
+	// the active version changes nothing.
+	ActivatePolicyVersion(ctx context.Context, change *models.PolicyChange) error
+	// ListPolicyChanges returns a page of the changes to the application's policies, newest
+	// first, and the total number of changes
+	ListPolicyChanges(ctx context.Context, appID uuid.UUID, offset, limit int) ([]models.PolicyChange, int64, error)
+	// ListActivePolicies returns the active policies of all applications, ordered by application
+	ListActivePolicies(ctx context.Context) ([]models.OPAPolicy, error)
+	// SavePolicySyncStatus records when the application's active policies were last published
+	SavePolicySyncStatus(ctx context.Context, status *models.PolicySyncStatus) error
+}
+
+// GormApplicationRepository implements ApplicationRepository using GORM
+type GormApplicationRepository struct {
+	db *gorm.DB
+}
+
+// NewApplicationRepository creates a new application repository
+func NewApplicationRepository(db *gorm.DB) ApplicationRepository {
+	return &GormApplicationRepository{db: db}
+}
+
+// CreateApplication creates the application together with its first API key
+func (r *GormApplicationRepository) CreateApplication(ctx context.Context, app *models.Application, key *models.APIKey) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(app).Error; err != nil {
+			return err
+		}
+		key.AppID = app.ID
+		return tx.Create(key).Error
+	})
+}
+
+// GetApplication returns the application with the given ID
+func (r *GormApplicationRepository) GetApplication(ctx context.Context, id uuid.UUID) (*models.Application, error) {
+	var app models.Application
+	if err := r.db.WithContext(ctx).Where("org_id IN (?)", r.liveOrgIDs()).First(&app, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &app, nil
+}
+
+// ListApplications returns the applications of an organization
+func (r *GormApplicationRepository) ListApplications(ctx context.Context, orgID uuid.UUID) ([]models.Application, error) {
+	var apps []models.Application
+	err := r.db.WithContext(ctx).Where("org_id = ? AND org_id IN (?)", orgID, r.liveOrgIDs()).Order("created_at").Find(&apps).Error
+	return apps, err
+}
+
+// liveOrgIDs selects the IDs of the organizations that are not (soft) deleted
+func (r *GormApplicationRepository) liveOrgIDs() *gorm.DB {
+	return r.db.Model(&models.Organization{}).Select("id")
+}
+
+// liveAppIDs selects the IDs of the applications of organizations that are not deleted
+func (r *GormApplicationRepository) liveAppIDs() *gorm.DB {
+	return r.db.Model(&models.Application{}).Select("id").Where("org_id IN (?)", r.liveOrgIDs())
+}
+
+// ListAllApplications returns the applications of all organizations
+func (r *GormApplicationRepository) ListAllApplications(ctx context.Context) ([]models.Application, error) {
+	var apps []models.Application
+	err := r.db.WithContext(ctx).Order("created_at").Find(&apps).Error
+	return apps, err
+}
+
+// UpdateApplication saves the application
+func (r *GormApplicationRepository) UpdateApplication(ctx context.Context, app *models.Application) error {
+	return r.db.WithContext(ctx).Save(app).Error
+}
+
+// DeleteApplication deletes the application with its API keys, roles and policies
+func (r *GormApplicationRepository) DeleteApplication(ctx context.Context, id uuid.UUID) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, dependent := range []interface{}{
+			&models.APIKey{},
+			&models.UserAppRole{},
+			&models.ApplicationRole{},
+			&models.OPAPolicy{},
+			&models.PolicyChange{},
+			&models.PolicySyncStatus{},
+		} {
+			if err := tx.Where("app_id = ?", id).Delete(dependent).Error; err != nil {
+				return err
+			}
+		}
+		result := tx.Delete(&models.Application{}, "id = ?", id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+// ListAPIKeys returns the API keys of an application, newest first
+func (r *GormApplicationRepository) ListAPIKeys(ctx context.Context, appID uuid.UUID) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := r.db.WithContext(ctx).Where("app_id = ?", appID).Order("created_at DESC").Find(&keys).Error
+	return keys, err
+}
+
+// GetAPIKeyByPrefix returns the API key with the given prefix and its application. The
+// application is nil when its organization was deleted.
+func (r *GormApplicationRepository) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := r.db.WithContext(ctx).Preload("Application", "org_id IN (?)", r.liveOrgIDs()).First(&key, "prefix = ?", prefix).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// RotateAPIKey creates the key and makes the application's other keys expire at expiresAt,
+// unless they expire or were revoked earlier
+func (r *GormApplicationRepository) RotateAPIKey(ctx context.Context, key *models.APIKey, expiresAt time.Time) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.APIKey{}).
+			Where("app_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", key.AppID, expiresAt).
+			Update("expires_at", expiresAt).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(key).Error
+	})
+}
+
+// RevokeAPIKey revokes a key of the application
+func (r *GormApplicationRepository) RevokeAPIKey(ctx context.Context, appID, keyID uuid.UUID, at time.Time) error {
+	result := r.db.WithContext(ctx).Model(&models.APIKey{}).
+		Where("id = ? AND app_id = ? AND revoked_at IS NULL", keyID, appID).
+		Update("revoked_at", at)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// TouchAPIKey records the use of a key
+func (r *GormApplicationRepository) TouchAPIKey(ctx context.Context, keyID uuid.UUID, at time.Time) error {
+	return r.db.WithContext(ctx).Model(&models.APIKey{}).Where("id = ?", keyID).Update("last_used_at", at).Error
+}
+
+// ListRoles returns the roles defined for an application
+func (r *GormApplicationRepository) ListRoles(ctx context.Context, appID uuid.UUID) ([]models.ApplicationRole, error) {
+	var roles []models.ApplicationRole
+	err := r.db.WithContext(ctx).Where("app_id = ?", appID).Order("name").Find(&roles).Error
+	return roles, err
+}
+
+// GetRole returns the application's role with the given name
+func (r *GormApplicationRepository) GetRole(ctx context.Context, appID uuid.UUID, name string) (*models.ApplicationRole, error) {
+	var role models.ApplicationRole
+	if err := r.db.WithContext(ctx).First(&role, "app_id = ? AND name = ?", appID, name).Error; err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// CreateRole defines a role for an application
+func (r *GormApplicationRepository) CreateRole(ctx context.Context, role *models.ApplicationRole) error {
+	return r.db.WithContext(ctx).Create(role).Error
+}
+
+// DeleteRole deletes the application's role together with its assignments
+func (r *GormApplicationRepository) DeleteRole(ctx context.Context, appID uuid.UUID, name string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("app_id = ? AND role_name = ?", appID, name).Delete(&models.UserAppRole{}).Error; err != nil {
+			return err
+		}
+		result := tx.Where("app_id = ? AND name = ?", appID, name).Delete(&models.ApplicationRole{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+// AssignRole assigns a role to a user, if the application defines the role
+func (r *GormApplicationRepository) AssignRole(ctx context.Context, assignment *models.UserAppRole) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Lock the role so it cannot be deleted before the assignment is written
+		var role models.ApplicationRole
+		err := tx.Clauses(clause.Locking{Strength: "SHARE"}).
+			First(&role, "app_id = ? AND name = ?", assignment.AppID, assignment.RoleName).Error
+		if err != nil {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(assignment).Error
+	})
+}
+
+// UnassignRole removes a role from a user
+func (r *GormApplicationRepository) UnassignRole(ctx context.Context, userID, appID uuid.UUID, name string) error {
+	result := r.db.WithContext(ctx).
+		Where("user_id = ? AND app_id = ? AND role_name = ?", userID, appID, name).
+		Delete(&models.UserAppRole{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ListRoleHolders returns a page of the users holding the application's role
+func (r *GormApplicationRepository) ListRoleHolders(ctx context.Context, appID uuid.UUID, name string, offset, limit int) ([]models.User, int64, error) {
+	holders := r.db.WithContext(ctx).Model(&models.User{}).
+		Joins("JOIN user_app_roles ON user_app_roles.user_id = users.id").
+		Where("user_app_roles.app_id = ? AND user_app_roles.role_name = ?", appID, name).
+		Session(&gorm.Session{}) // Shared by the count and the page queries
+
+	var total int64
+	if err := holders.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var users []models.User
+	err := holders.Order("users.email").Offset(offset).Limit(limit).Find(&users).Error
+	return users, total, err
+}
+
+// ListUserAppRoles returns the roles a user holds in all applications, with their applications
+func (r *GormApplicationRepository) ListUserAppRoles(ctx context.Context, userID uuid.UUID) ([]models.UserAppRole, error) {
+	var assignments []models.UserAppRole
+	err := r.db.WithContext(ctx).Preload("Application").
+		Where("user_id = ? AND app_id IN (?)", userID, r.liveAppIDs()).
+		Order("app_id, role_name").
+		Find(&assignments).Error
+	return assignments, err
+}
+
+// GetUserRoleNames returns the names of the roles the user holds in the application
+func (r *GormApplicationRepository) GetUserRoleNames(ctx context.Context, userID, appID uuid.UUID) ([]string, error) {
+	var roles []string
+	err := r.db.WithContext(ctx).Model(&models.UserAppRole{}).
+		Where("user_id = ? AND app_id = ?", userID, appID).
+		Order("role_name").
+		Pluck("role_name", &roles).Error
+	return roles, err
+}
+
+// ActivePolicies returns the active version of each of the application's policies
+func (r *GormApplicationRepository) ActivePolicies(ctx context.Context, appID uuid.UUID) ([]models.OPAPolicy, error) {
+	var policies []models.OPAPolicy
+	err := r.db.WithContext(ctx).Where("app_id = ? AND active", appID).Order("name").Find(&policies).Error
+	return policies, err
+}
+
+// ListPolicyVersions returns the versions of the application's policy, newest first
+func (r *GormApplicationRepository) ListPolicyVersions(ctx context.Context, appID uuid.UUID, name string) ([]models.OPAPolicy, error) {
+	var policies []models.OPAPolicy
+	err := r.db.WithContext(ctx).Where("app_id = ? AND name = ?", appID, name).Order("version DESC").Find(&policies).Error
+	return policies, err
+}
+
+// GetPolicyVersion returns a version of the application's policy
+func (r *GormApplicationRepository) GetPolicyVersion(ctx context.Context, appID uuid.UUID, name string, version int) (*models.OPAPolicy, error) {
+	var p models.OPAPolicy
+	err := r.db.WithContext(ctx).Where("app_id = ? AND name = ? AND version = ?", appID, name, version).First(&p).Error
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// CreatePolicyVersion saves the policy as the next, inactive version of its name and records
+// the upload by actorID
+func (r *GormApplicationRepository) CreatePolicyVersion(ctx context.Context, p *models.OPAPolicy, actorID uuid.UUID) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockApplication(tx, p.AppID); err != nil {
+			return err
+		}
+		var latest, active int
+		if err := tx.Model(&models.OPAPolicy{}).
+			Where("app_id = ? AND name = ?", p.AppID, p.Name).
+			Select("COALESCE(MAX(version), 0)").Scan(&latest).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.OPAPolicy{}).
+			Where("app_id = ? AND name = ? AND active", p.AppID, p.Name).
+			Select("COALESCE(MAX(version), 0)").Scan(&active).Error; err != nil {
+			return err
+		}
+
+		p.Version, p.Active, p.CreatedBy = latest+1, false, actorID
+		if err := tx.Create(p).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.PolicyChange{
+			AppID:           p.AppID,
+			PolicyName:      p.Name,
+			Version:         p.Version,
+			PreviousVersion: active,
+			Action:          models.PolicyChangeUpload,
+			ActorID:         actorID,
+		}).Error
+	})
+}
+
+// ActivatePolicyVersion makes the change's version the active one of its policy and records
+// the change. It returns gorm.ErrRecordNotFound when the version does not exist; activating the
+// active version changes nothing.
+func (r *GormApplicationRepository) ActivatePolicyVersion(ctx context.Context, change *models.PolicyChange) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockApplication(tx, change.AppID); err != nil {
+			return err
+		}
+		var target models.OPAPolicy
+		if err := tx.Where("app_id = ? AND name = ? AND version = ?", change.AppID, change.PolicyName, change.Version).
+			First(&target).Error; err != nil {
+			return err
+		}
+		if target.Active {
+			change.PreviousVersion = target.Version
+			return nil
+		}
+
+		var active int
+		if err := tx.Model(&models.OPAPolicy{}).
+			Where("app_id = ? AND name = ? AND active", change.AppID, change.PolicyName).
+			Select("COALESCE(MAX(version), 0)").Scan(&active).Error; err != nil {
+			return err
+		}
+		change.PreviousVersion = active
+
+		if err := tx.Model(&models.OPAPolicy{}).
+			Where("app_id = ? AND name = ? AND active", change.AppID, change.PolicyName).
+			Update("active", false).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&target).Update("active", true).Error; err != nil {
+			return err
+		}
+		return tx.Create(change).Error
+	})
+}
+
+// ListPolicyChanges returns a page of the changes to the application's policies, newest first,
+// and the total number of changes
+func (r *GormApplicationRepository) ListPolicyChanges(ctx context.Context, appID uuid.UUID, offset, limit int) ([]models.PolicyChange, int64, error) {
+	query := r.db.WithContext(ctx).Model(&models.PolicyChange{}).Where("app_id = ?", appID).Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var changes []models.PolicyChange
+	err := query.Order("created_at DESC").Offset(offset).Limit(limit).Find(&changes).Error
+	return changes, total, err
+}
+
+// lockApplication serializes the policy changes of an application for the rest of tx
+func lockApplication(tx *gorm.DB, appID uuid.UUID) error {
+	var app models.Application
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&app, "id = ?", appID).Error
+}
+
+// ListActivePolicies returns the active policies of all applications, ordered by application
+func (r *GormApplicationRepository) ListActivePolicies(ctx context.Context) ([]models.OPAPolicy, error) {
+	var policies []models.OPAPolicy
+	err := r.db.WithContext(ctx).Where("active").Order("app_id, name").Find(&policies).Error
+	return policies, err
+}
+
+// SavePolicySyncStatus creates or replaces the sync status of the application
+func (r *GormApplicationRepository) SavePolicySyncStatus(ctx context.Context, status *models.PolicySyncStatus) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "app_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"version", "synced_at"}),
+	}).Create(status).Error
+}
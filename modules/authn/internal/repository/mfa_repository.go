@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"shield/modules/authn/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// MFARepository handles persistence for the local MFA engine
+type MFARepository interface {
+	GetSecret(ctx context.Context, userID uuid.UUID) (*models.MFASecret, error)
+	SaveSecret(ctx context.Context, secret *models.MFASecret) error
+	DeleteSecret(ctx context.Context, userID uuid.UUID) error
+	AdvanceLastUsedStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error)
+	ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codes []*models.MFARecoveryCode) error
+	UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string, usedAt time.Time) (bool, error)
+}
+
+// GormMFARepository implements MFARepository using GORM
+type GormMFARepository struct {
+	db *gorm.DB
+}
+
+// NewMFARepository creates a new MFA repository
+func NewMFARepository(db *gorm.DB) MFARepository {
+	return &GormMFARepository{db: db}
+}
+
+// GetSecret retrieves the TOTP secret for a user
+func (r *GormMFARepository) GetSecret(ctx context.Context, userID uuid.UUID) (*models.MFASecret, error) {
+	var secret models.MFASecret
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&secret).Error
+	if err != nil {
+		return nil, err
+	}
+	return &secret, nil
+}
+
+// SaveSecret creates or replaces the TOTP secret for a user
+func (r *GormMFARepository) SaveSecret(ctx context.Context, secret *models.MFASecret) error {
+	return r.db.WithContext(ctx).Save(secret).Error
+}
+
+// DeleteSecret removes the TOTP secret for a user
+func (r *GormMFARepository) DeleteSecret(ctx context.Context, userID uuid.UUID) error {
+	return r.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.MFASecret{}).Error
+}
+
+// AdvanceLastUsedStep records the time step only if it is newer than the stored one,
+// so two concurrent requests cannot both accept the same code.
+func (r *GormMFARepository) AdvanceLastUsedStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.MFASecret{}).
+		Where("user_id = ? AND last_used_step < ?", userID, step).
+		Updates(map[string]interface{}{"last_used_step": step, "updated_at": time.Now()})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// ReplaceRecoveryCodes deletes the user's recovery codes and stores the given set
+func (r *GormMFARepository) ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codes []*models.MFARecoveryCode) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if len(codes) == 0 {
+			return nil
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// UseRecoveryCode marks a matching unused recovery code as used
+func (r *GormMFARepository) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string, usedAt time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.MFARecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", usedAt)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
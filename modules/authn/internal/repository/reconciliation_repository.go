@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"shield/modules/authn/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ReconciliationRepository stores the reconciliation jobs that guard signups, together with
+// the records they guard, so a signup and its job are always written in one transaction.
+type ReconciliationRepository interface {
+	// StartSignup stores the signup's job and, for organization signups, the organization
+	StartSignup(ctx context.Context, job *models.ReconciliationJob, org *models.Organization) error
+	// RecordProviderUser stores the sub of the provider user the signup created
+	RecordProviderUser(ctx context.Context, job *models.ReconciliationJob) error
+	// CompleteSignup creates the user and deletes the signup's job
+	CompleteSignup(ctx context.Context, user *models.User, jobID uuid.UUID) error
+	// RollbackSignup permanently deletes the job's organization, if any, and the job
+	RollbackSignup(ctx context.Context, job *models.ReconciliationJob) error
+
+	// ClaimDueJobs returns up to limit jobs whose next attempt is due and that have not failed,
+	// and postpones their next attempt by lease so no other reconciler picks them up meanwhile
+	ClaimDueJobs(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.ReconciliationJob, error)
+	// RecordFailure stores the attempt count, error and next attempt (or failure) time of a job
+	RecordFailure(ctx context.Context, job *models.ReconciliationJob) error
+}
+
+// GormReconciliationRepository implements ReconciliationRepository using GORM
+type GormReconciliationRepository struct {
+	db *gorm.DB
+}
+
+// NewReconciliationRepository creates a new reconciliation repository
+func NewReconciliationRepository(db *gorm.DB) ReconciliationRepository {
+	return &GormReconciliationRepository{db: db}
+}
+
+// StartSignup stores the signup's job and, for organization signups, the organization
+func (r *GormReconciliationRepository) StartSignup(ctx context.Context, job *models.ReconciliationJob, org *models.Organization) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if org != nil {
+			if err := tx.Create(org).Error; err != nil {
+				return err
+			}
+			job.OrgID = &org.ID
+		}
+		return tx.Create(job).Error
+	})
+}
+
+// RecordProviderUser stores the sub of the provider user the signup created
+func (r *GormReconciliationRepository) RecordProviderUser(ctx context.Context, job *models.ReconciliationJob) error {
+	return r.db.WithContext(ctx).Model(&models.ReconciliationJob{}).
+		Where("id = ?", job.ID).
+		Updates(map[string]interface{}{"provider_sub": job.ProviderSub, "updated_at": time.Now()}).Error
+}
+
+// CompleteSignup creates the user and deletes the signup's job
+func (r *GormReconciliationRepository) CompleteSignup(ctx context.Context, user *models.User, jobID uuid.UUID) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.ReconciliationJob{}, "id = ?", jobID).Error
+	})
+}
+
+// RollbackSignup permanently deletes the job's organization, if any, and the job
+func (r *GormReconciliationRepository) RollbackSignup(ctx context.Context, job *models.ReconciliationJob) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if job.OrgID != nil {
+			if err := tx.Unscoped().Delete(&models.Organization{}, "id = ?", *job.OrgID).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&models.ReconciliationJob{}, "id = ?", job.ID).Error
+	})
+}
+
+// ClaimDueJobs returns up to limit jobs whose next attempt is due and that have not failed,
+// and postpones their next attempt by lease so no other reconciler picks them up meanwhile
+func (r *GormReconciliationRepository) ClaimDueJobs(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.ReconciliationJob, error) {
+	var jobs []*models.ReconciliationJob
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Jobs being claimed by another replica are skipped rather than waited for
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("next_attempt_at <= ? AND failed_at IS NULL", now).
+			Order("next_attempt_at").
+			Limit(limit).
+			Find(&jobs).Error; err != nil {
+			return err
+		}
+		if len(jobs) == 0 {
+			return nil
+		}
+
+		ids := make([]uuid.UUID, len(jobs))
+		for i, job := range jobs {
+			job.NextAttemptAt = now.Add(lease)
+			ids[i] = job.ID
+		}
+		return tx.Model(&models.ReconciliationJob{}).
+			Where("id IN ?", ids).
+			Updates(map[string]interface{}{"next_attempt_at": now.Add(lease), "updated_at": time.Now()}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// RecordFailure stores the attempt count, error and next attempt (or failure) time of a job
+func (r *GormReconciliationRepository) RecordFailure(ctx context.Context, job *models.ReconciliationJob) error {
+	return r.db.WithContext(ctx).Model(&models.ReconciliationJob{}).
+		Where("id = ?", job.ID).
+		Updates(map[string]interface{}{
+			"attempts":        job.Attempts,
+			"last_error":      job.LastError,
+			"next_attempt_at": job.NextAttemptAt,
+			"failed_at":       job.FailedAt,
+			"updated_at":      time.Now(),
+		}).Error
+}
@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"log"
+	"time"
+
+	"shield/modules/authn/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	sessionCachePrefix = "shield:session:"
+	// sessionTokenPrefix maps the origin_jti of provider tokens to the ID of their session
+	sessionTokenPrefix = "shield:session-token:"
+)
+
+// CachedSessionRepository is a write-through Redis cache in front of another SessionRepository.
+// Session lookups by ID and by provider token ID are served from Redis; every write goes to the underlying repository first.
+// Redis errors are logged and fall back to the underlying repository.
+type CachedSessionRepository struct {
+	next   SessionRepository
+	client redis.UniversalClient
+	ttl    time.Duration
+}
+
+// NewCachedSessionRepository creates a new Redis-cached session repository
+func NewCachedSessionRepository(next SessionRepository, client redis.UniversalClient, ttl time.Duration) SessionRepository {
+	return &CachedSessionRepository{next: next, client: client, ttl: ttl}
+}
+
+// CreateSession creates a new session record and caches it
+func (r *CachedSessionRepository) CreateSession(ctx context.Context, session *models.Session) error {
+	if err := r.next.CreateSession(ctx, session); err != nil {
+		return err
+	}
+	r.store(ctx, session)
+	return nil
+}
+
+// GetSessionByID retrieves a session by its ID, populating the cache on a miss
+func (r *CachedSessionRepository) GetSessionByID(ctx context.Context, sessionID string) (*models.Session, error) {
+	data, err := r.client.Get(ctx, sessionCachePrefix+sessionID).Bytes()
+	if err == nil {
+		var session models.Session
+		if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&session); err == nil {
+			return &session, nil
+		}
+		log.Printf("Session cache: discarding undecodable entry for %s", sessionID)
+	} else if !errors.Is(err, redis.Nil) {
+		log.Printf("Session cache read error: %v", err)
+	}
+
+	session, err := r.next.GetSessionByID(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	r.store(ctx, session)
+	return session, nil
+}
+
+// UpdateSession updates an existing session and refreshes its cache entry
+func (r *CachedSessionRepository) UpdateSession(ctx context.Context, session *models.Session) error {
+	if err := r.next.UpdateSession(ctx, session); err != nil {
+		r.evict(ctx, session.ID)
+		return err
+	}
+	r.store(ctx, session)
+	return nil
+}
+
+// DeleteSession deletes a session by ID and evicts it from the cache
+func (r *CachedSessionRepository) DeleteSession(ctx context.Context, sessionID string) error {
+	if err := r.next.DeleteSession(ctx, sessionID); err != nil {
+		return err
+	}
+	r.evict(ctx, sessionID)
+	return nil
+}
+
+// DeleteExpiredSessions removes expired sessions; their cache entries have already expired
+func (r *CachedSessionRepository) DeleteExpiredSessions(ctx context.Context) error {
+	return r.next.DeleteExpiredSessions(ctx)
+}
+
+// GetSessionsByUserID retrieves all active sessions for a user
+func (r *CachedSessionRepository) GetSessionsByUserID(ctx context.Context, userID uuid.UUID) ([]*models.Session, error) {
+	return r.next.GetSessionsByUserID(ctx, userID)
+}
+
+// GetSessionByRefreshTokenHash finds the session currently holding a refresh token
+func (r *CachedSessionRepository) GetSessionByRefreshTokenHash(ctx context.Context, tokenHash string) (*models.Session, error) {
+	return r.next.GetSessionByRefreshTokenHash(ctx, tokenHash)
+}
+
+// GetSessionByProviderTokenID finds the session of provider tokens through the cached session,
+// populating the cache on a miss. Entries only map to session IDs, so the session read is the
+// cached or stored one, updated on every write.
+func (r *CachedSessionRepository) GetSessionByProviderTokenID(ctx context.Context, tokenID string) (*models.Session, error) {
+	sessionID, err := r.client.Get(ctx, sessionTokenPrefix+tokenID).Result()
+	if err == nil {
+		session, err := r.GetSessionByID(ctx, sessionID)
+		if err == nil && session.ProviderTokenID == tokenID {
+			return session, nil
+		}
+	} else if !errors.Is(err, redis.Nil) {
+		log.Printf("Session cache read error: %v", err)
+	}
+
+	session, err := r.next.GetSessionByProviderTokenID(ctx, tokenID)
+	if err != nil {
+		return nil, err
+	}
+	r.store(ctx, session)
+	return session, nil
+}
+
+// GetRotatedRefreshToken finds a refresh token that has already been rotated
+func (r *CachedSessionRepository) GetRotatedRefreshToken(ctx context.Context, tokenHash string) (*models.RotatedRefreshToken, error) {
+	return r.next.GetRotatedRefreshToken(ctx, tokenHash)
+}
+
+// RotateRefreshToken rotates a session's refresh token and refreshes its cache entry
+func (r *CachedSessionRepository) RotateRefreshToken(ctx context.Context, session *models.Session, previousHash string) error {
+	if err := r.next.RotateRefreshToken(ctx, session, previousHash); err != nil {
+		r.evict(ctx, session.ID)
+		return err
+	}
+	r.store(ctx, session)
+	return nil
+}
+
+// store caches a session until it can no longer be refreshed, capped at the cache TTL.
+// The plaintext refresh token and loaded relationships are never cached.
+func (r *CachedSessionRepository) store(ctx context.Context, session *models.Session) {
+	ttl := time.Until(session.RefreshExpiresAt)
+	if ttl > r.ttl {
+		ttl = r.ttl
+	}
+	if ttl <= 0 {
+		r.evict(ctx, session.ID)
+		return
+	}
+
+	cached := *session
+	cached.RefreshToken = ""
+	cached.User = nil
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&cached); err != nil {
+		log.Printf("Session cache encode error: %v", err)
+		r.evict(ctx, session.ID)
+		return
+	}
+	if err := r.client.Set(ctx, sessionCachePrefix+session.ID, buf.Bytes(), ttl).Err(); err != nil {
+		log.Printf("Session cache write error: %v", err)
+		r.evict(ctx, session.ID)
+		return
+	}
+	if session.ProviderTokenID != "" {
+		if err := r.client.Set(ctx, sessionTokenPrefix+session.ProviderTokenID, session.ID, ttl).Err(); err != nil {
+			log.Printf("Session cache write error: %v", err)
+		}
+	}
+}
+
+// evict removes a cache entry so the next read goes to the underlying repository
+func (r *CachedSessionRepository) evict(ctx context.Context, sessionID string) {
+	if err := r.client.Del(ctx, sessionCachePrefix+sessionID).Err(); err != nil {
+		log.Printf("Session cache evict error for %s: %v", sessionID, err)
+	}
+}
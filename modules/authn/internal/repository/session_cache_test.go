@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"shield/modules/authn/internal/models"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// countingRepository is an in-memory SessionRepository that counts reads by ID
+type countingRepository struct {
+	SessionRepository // Methods the cache passes through are not exercised
+	sessions          map[string]models.Session
+	reads             int
+}
+
+func (r *countingRepository) CreateSession(_ context.Context, s *models.Session) error {
+	r.sessions[s.ID] = *s
+	return nil
+}
+
+func (r *countingRepository) GetSessionByID(_ context.Context, id string) (*models.Session, error) {
+	r.reads++
+	s, ok := r.sessions[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &s, nil
+}
+
+func (r *countingRepository) GetSessionByProviderTokenID(_ context.Context, tokenID string) (*models.Session, error) {
+	r.reads++
+	for _, s := range r.sessions {
+		if s.ProviderTokenID == tokenID {
+			return &s, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *countingRepository) UpdateSession(_ context.Context, s *models.Session) error {
+	r.sessions[s.ID] = *s
+	return nil
+}
+
+func (r *countingRepository) DeleteSession(_ context.Context, id string) error {
+	delete(r.sessions, id)
+	return nil
+}
+
+func newTestCache(t *testing.T) (*miniredis.Miniredis, *countingRepository, SessionRepository) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	db := &countingRepository{sessions: map[string]models.Session{}}
+	return server, db, NewCachedSessionRepository(db, client, time.Hour)
+}
+
+func TestCachedSessionRepository(t *testing.T) {
+	server, db, cache := newTestCache(t)
+	ctx := context.Background()
+
+	session := &models.Session{
+		ID:                   "session-1",
+		UserID:               uuid.New(),
+		RefreshTokenHash:     "hash-1",
+		RefreshToken:         "plaintext",
+		ProviderRefreshToken: "sealed",
+		ExpiresAt:            time.Now().Add(time.Hour),
+		RefreshExpiresAt:     time.Now().Add(24 * time.Hour),
+		IsActive:             true,
+	}
+	if err := cache.CreateSession(ctx, session); err != nil {
+		t.Fatalf("CreateSession() error = %v", err)
+	}
+
+	got, err := cache.GetSessionByID(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("GetSessionByID() error = %v", err)
+	}
+	if db.reads != 0 {
+		t.Errorf("GetSessionByID() after create read the database %d times, want 0", db.reads)
+	}
+	if got.RefreshTokenHash != "hash-1" || got.ProviderRefreshToken != "sealed" || got.UserID != session.UserID {
+		t.Errorf("GetSessionByID() = %+v, want the created session", got)
+	}
+	if got.RefreshToken != "" {
+		t.Error("cached session must not contain the plaintext refresh token")
+	}
+	if ttl := server.TTL(sessionCachePrefix + session.ID); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("cache TTL = %v, want at most the configured hour", ttl)
+	}
+
+	// Writes go through to the cache
+	session.IsActive = false
+	if err := cache.UpdateSession(ctx, session); err != nil {
+		t.Fatalf("UpdateSession() error = %v", err)
+	}
+	if got, _ := cache.GetSessionByID(ctx, session.ID); got == nil || got.IsActive {
+		t.Error("GetSessionByID() after update returned a stale session")
+	}
+
+	// Misses are read from the database and cached
+	server.FlushAll()
+	for i := 0; i < 2; i++ {
+		if _, err := cache.GetSessionByID(ctx, session.ID); err != nil {
+			t.Fatalf("GetSessionByID() error = %v", err)
+		}
+	}
+	if db.reads != 1 {
+		t.Errorf("database reads after cache miss = %d, want 1", db.reads)
+	}
+
+	if err := cache.DeleteSession(ctx, session.ID); err != nil {
+		t.Fatalf("DeleteSession() error = %v", err)
+	}
+	if _, err := cache.GetSessionByID(ctx, session.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("GetSessionByID() after delete error = %v, want ErrRecordNotFound", err)
+	}
+}
+
+func TestCachedSessionRepositoryByProviderToken(t *testing.T) {
+	server, db, cache := newTestCache(t)
+	ctx := context.Background()
+
+	session := &models.Session{ID: "session-1", ProviderTokenID: "jti-1", RefreshExpiresAt: time.Now().Add(time.Hour), IsActive: true}
+	if err := cache.CreateSession(ctx, session); err != nil {
+		t.Fatalf("CreateSession() error = %v", err)
+	}
+	if got, err := cache.GetSessionByProviderTokenID(ctx, "jti-1"); err != nil || got.ID != session.ID || db.reads != 0 {
+		t.Fatalf("GetSessionByProviderTokenID() = %v, %v with %d database reads; want the cached session", got, err, db.reads)
+	}
+
+	// Logout is seen through the token's entry
+	session.IsActive = false
+	if err := cache.UpdateSession(ctx, session); err != nil {
+		t.Fatalf("UpdateSession() error = %v", err)
+	}
+	if got, _ := cache.GetSessionByProviderTokenID(ctx, "jti-1"); got == nil || got.IsActive {
+		t.Errorf("GetSessionByProviderTokenID() after logout = %+v, want the inactive session", got)
+	}
+
+	server.FlushAll()
+	if got, err := cache.GetSessionByProviderTokenID(ctx, "jti-1"); err != nil || got.ID != session.ID || db.reads != 1 {
+		t.Errorf("GetSessionByProviderTokenID() after a miss = %v, %v with %d database reads; want the stored session read once", got, err, db.reads)
+	}
+	if err := cache.DeleteSession(ctx, session.ID); err != nil {
+		t.Fatalf("DeleteSession() error = %v", err)
+	}
+	if _, err := cache.GetSessionByProviderTokenID(ctx, "jti-1"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("GetSessionByProviderTokenID() after delete error = %v, want ErrRecordNotFound", err)
+	}
+}
+
+func TestCachedSessionRepositoryRedisDown(t *testing.T) {
+	server, db, cache := newTestCache(t)
+	ctx := context.Background()
+
+	session := &models.Session{ID: "session-1", RefreshExpiresAt: time.Now().Add(time.Hour)}
+	if err := cache.CreateSession(ctx, session); err != nil {
+		t.Fatalf("CreateSession() error = %v", err)
+	}
+
+	server.Close()
+	if _, err := cache.GetSessionByID(ctx, session.ID); err != nil {
+		t.Fatalf("GetSessionByID() with Redis down error = %v", err)
+	}
+	if db.reads != 1 {
+		t.Errorf("database reads with Redis down = %d, want 1", db.reads)
+	}
+}
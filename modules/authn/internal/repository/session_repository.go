@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"shield/modules/authn/internal/models"
@@ -18,8 +19,15 @@ type SessionRepository interface {
 	DeleteSession(ctx context.Context, sessionID string) error
 	DeleteExpiredSessions(ctx context.Context) error
 	GetSessionsByUserID(ctx context.Context, userID uuid.UUID) ([]*models.Session, error)
+	GetSessionByRefreshTokenHash(ctx context.Context, tokenHash string) (*models.Session, error)
+	GetSessionByProviderTokenID(ctx context.Context, tokenID string) (*models.Session, error)
+	GetRotatedRefreshToken(ctx context.Context, tokenHash string) (*models.RotatedRefreshToken, error)
+	RotateRefreshToken(ctx context.Context, session *models.Session, previousHash string) error
 }
 
+// ErrConcurrentRotation is returned when a session's refresh token changed during rotation
+var ErrConcurrentRotation = errors.New("refresh token was rotated concurrently")
+
 // GormSessionRepository implements SessionRepository using GORM
 type GormSessionRepository struct {
 	db *gorm.DB
@@ -58,10 +66,16 @@ func (r *GormSessionRepository) DeleteSession(ctx context.Context, sessionID str
 	return r.db.WithContext(ctx).Where("id = ?", sessionID).Delete(&models.Session{}).Error
 }
 
-// DeleteExpiredSessions removes all expired sessions
+// DeleteExpiredSessions removes sessions that can no longer be refreshed, and the rotated refresh tokens of removed sessions
 func (r *GormSessionRepository) DeleteExpiredSessions(ctx context.Context) error {
 	now := time.Now()
-	return r.db.WithContext(ctx).Where("expires_at < ? OR (is_active = false AND updated_at < ?)", now, now.Add(-24*time.Hour)).Delete(&models.Session{}).Error
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("refresh_expires_at < ? OR (is_active = false AND updated_at < ?)", now, now.Add(-24*time.Hour)).Delete(&models.Session{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("session_id NOT IN (?)", tx.Model(&models.Session{}).Select("id")).Delete(&models.RotatedRefreshToken{}).Error
+	})
 }
 
 // GetSessionsByUserID retrieves all sessions for a user
@@ -70,3 +84,61 @@ func (r *GormSessionRepository) GetSessionsByUserID(ctx context.Context, userID
 	err := r.db.WithContext(ctx).Where("user_id = ? AND is_active = true", userID).Find(&sessions).Error
 	return sessions, err
 }
+
+// GetSessionByRefreshTokenHash retrieves the session whose current refresh token has the given hash
+func (r *GormSessionRepository) GetSessionByRefreshTokenHash(ctx context.Context, tokenHash string) (*models.Session, error) {
+	var session models.Session
+	err := r.db.WithContext(ctx).Where("refresh_token = ?", tokenHash).First(&session).Error
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetSessionByProviderTokenID retrieves the latest session linked to the provider tokens with the given origin_jti
+func (r *GormSessionRepository) GetSessionByProviderTokenID(ctx context.Context, tokenID string) (*models.Session, error) {
+	var session models.Session
+	err := r.db.WithContext(ctx).Where("provider_token_id = ?", tokenID).Order("created_at DESC").First(&session).Error
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetRotatedRefreshToken retrieves a previously rotated refresh token by its hash
+func (r *GormSessionRepository) GetRotatedRefreshToken(ctx context.Context, tokenHash string) (*models.RotatedRefreshToken, error) {
+	var rotated models.RotatedRefreshToken
+	err := r.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(&rotated).Error
+	if err != nil {
+		return nil, err
+	}
+	return &rotated, nil
+}
+
+// RotateRefreshToken stores the session's new refresh token and expiry, and records previousHash
+// as rotated. It fails with ErrConcurrentRotation if previousHash is no longer current.
+func (r *GormSessionRepository) RotateRefreshToken(ctx context.Context, session *models.Session, previousHash string) error {
+	now := time.Now()
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Session{}).
+			Where("id = ? AND refresh_token = ?", session.ID, previousHash).
+			Updates(map[string]interface{}{
+				"refresh_token":      session.RefreshTokenHash,
+				"expires_at":         session.ExpiresAt,
+				"refresh_expires_at": session.RefreshExpiresAt,
+				"updated_at":         now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrConcurrentRotation
+		}
+
+		return tx.Create(&models.RotatedRefreshToken{
+			TokenHash: previousHash,
+			SessionID: session.ID,
+			RotatedAt: now,
+		}).Error
+	})
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
 
 	"shield/modules/authn/internal/models"
 
@@ -24,6 +25,15 @@ type UserRepository interface {
 	GetOrganizationByID(ctx context.Context, id uuid.UUID) (*models.Organization, error)
 	GetOrganizationByName(ctx context.Context, name string) (*models.Organization, error)
 	UpdateOrganization(ctx context.Context, org *models.Organization) error
+	DeleteOrganization(ctx context.Context, id uuid.UUID) error
+	GetDeletedOrganizationByID(ctx context.Context, id uuid.UUID) (*models.Organization, error)
+	RestoreOrganization(ctx context.Context, id uuid.UUID) error
+
+	// SSO provider operations
+	GetSSOProviderConfig(ctx context.Context, orgID uuid.UUID) (*models.SSOProviderConfig, error)
+	GetSSOProviderConfigsByIdentifier(ctx context.Context, identifier string) ([]*models.SSOProviderConfig, error)
+	SaveSSOProviderConfig(ctx context.Context, org *models.Organization, config *models.SSOProviderConfig) error
+	DeleteSSOProviderConfig(ctx context.Context, org *models.Organization, config *models.SSOProviderConfig) error
 
 	// Session operations
 	CreateSession(ctx context.Context, session *models.Session) error
@@ -113,6 +123,74 @@ func (r *userRepository) UpdateOrganization(ctx context.Context, org *models.Org
 	return r.db.WithContext(ctx).Save(org).Error
 }
 
+// DeleteOrganization soft deletes an organization
+func (r *userRepository) DeleteOrganization(ctx context.Context, id uuid.UUID) error {
+	return r.db.WithContext(ctx).Delete(&models.Organization{}, "id = ?", id).Error
+}
+
+// GetDeletedOrganizationByID retrieves a soft-deleted organization
+func (r *userRepository) GetDeletedOrganizationByID(ctx context.Context, id uuid.UUID) (*models.Organization, error) {
+	var org models.Organization
+	err := r.db.WithContext(ctx).Unscoped().First(&org, "id = ? AND deleted_at IS NOT NULL", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// RestoreOrganization clears the soft delete marker of an organization
+func (r *userRepository) RestoreOrganization(ctx context.Context, id uuid.UUID) error {
+	return r.db.WithContext(ctx).Unscoped().Model(&models.Organization{}).
+		Where("id = ?", id).Update("deleted_at", nil).Error
+}
+
+// SSO provider operations
+func (r *userRepository) GetSSOProviderConfig(ctx context.Context, orgID uuid.UUID) (*models.SSOProviderConfig, error) {
+	var config models.SSOProviderConfig
+	err := r.db.WithContext(ctx).First(&config, "org_id = ?", orgID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// GetSSOProviderConfigsByIdentifier returns the configs with identifier among their verified IdP identifiers
+func (r *userRepository) GetSSOProviderConfigsByIdentifier(ctx context.Context, identifier string) ([]*models.SSOProviderConfig, error) {
+	contains, err := json.Marshal([]string{identifier})
+	if err != nil {
+		return nil, err
+	}
+	var configs []*models.SSOProviderConfig
+	err = r.db.WithContext(ctx).Where("idp_identifiers @> ?::jsonb", string(contains)).Find(&configs).Error
+	return configs, err
+}
+
+// SaveSSOProviderConfig stores the config and points the organization at it in one transaction
+func (r *userRepository) SaveSSOProviderConfig(ctx context.Context, org *models.Organization, config *models.SSOProviderConfig) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(config).Error; err != nil {
+			return err
+		}
+		org.SSOProviderConfigID = &config.ID
+		org.SSOProviderName = config.ProviderName
+		org.IDPType = config.IDPType
+		return tx.Model(org).Select("SSOProviderConfigID", "SSOProviderName", "IDPType").Updates(org).Error
+	})
+}
+
+// DeleteSSOProviderConfig removes the config and clears the organization's SSO fields in one transaction
+func (r *userRepository) DeleteSSOProviderConfig(ctx context.Context, org *models.Organization, config *models.SSOProviderConfig) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		org.SSOProviderConfigID = nil
+		org.SSOProviderName = ""
+		org.IDPType = ""
+		if err := tx.Model(org).Select("SSOProviderConfigID", "SSOProviderName", "IDPType").Updates(org).Error; err != nil {
+			return err
+		}
+		return tx.Delete(config).Error
+	})
+}
+
 // Session operations
 func (r *userRepository) CreateSession(ctx context.Context, session *models.Session) error {
 	return r.db.WithContext(ctx).Create(session).Error
@@ -1,17 +1,30 @@
 package authn
 
 import (
+	"context"
+	"fmt"
+	"log"
 	"shield/cmd/app/config"
 	"shield/modules/authn/internal/api"
 	"shield/modules/authn/internal/auth"
+	"shield/modules/authn/internal/auth/mfa"
 	"shield/modules/authn/internal/auth/nonce"
+	"shield/modules/authn/internal/auth/policy"
+	authprovider "shield/modules/authn/internal/auth/provider"
 	"shield/modules/authn/internal/auth/provider/cognito"
+	"shield/modules/authn/internal/auth/provider/local"
+	"shield/modules/authn/internal/auth/provider/oidc"
 	"shield/modules/authn/internal/auth/session"
+	"shield/modules/authn/internal/auth/sso"
+	"shield/modules/authn/internal/auth/token"
 	"shield/modules/authn/internal/models"
 	"shield/modules/authn/internal/repository"
+	"shield/modules/common/crypto"
+	"shield/modules/common/ratelimit"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 )
 
@@ -20,11 +33,18 @@ func GetModelsForMigration() []interface{} {
 	return []interface{}{
 		&models.User{},
 		&models.Organization{},
+		&models.SSOProviderConfig{},
 		&models.Session{},
+		&models.RotatedRefreshToken{},
+		&models.MFASecret{},
+		&models.MFARecoveryCode{},
+		&models.ReconciliationJob{},
 		&models.Application{},
+		&models.APIKey{},
 		&models.ApplicationRole{},
 		&models.UserAppRole{},
 		&models.OPAPolicy{},
+		&models.PolicyChange{},
 		&models.PolicySyncStatus{},
 	}
 }
@@ -34,35 +54,343 @@ func NewUserRepository(db *gorm.DB) repository.UserRepository {
 	return repository.NewUserRepository(db)
 }
 
-// NewAuthService is a public constructor for the AuthN service
-func NewAuthService(db *gorm.DB) *auth.AuthService {
+// NewAuthService is a public constructor for the AuthN service.
+// It fails when the configured identity provider cannot be initialized. Background work, such
+// as signup reconciliation and policy sync, runs until ctx is cancelled.
+func NewAuthService(ctx context.Context, db *gorm.DB) (*auth.AuthService, error) {
 	// Load config
 	cfg := config.GetConfig()
 
-	// Initialize Cognito provider
-	provider, err := cognito.NewProvider(cfg.Cognito)
+	provider, verifier, err := newAuthProvider(cfg)
 	if err != nil {
-		// Log error and use a mock provider for development
-		// In production, this should fail gracefully or use fallback
-		provider = nil // This will need to be handled in the service
+		return nil, err
 	}
 
 	userRepo := NewUserRepository(db)
 
+	// Redis is shared by all replicas; it is only connected when a store is configured to use it
+	var redisClient redis.UniversalClient
+	if cfg.Session.Store == "redis" || cfg.Nonce.Store == "redis" || cfg.RateLimiting.Store == "redis" {
+		redisClient = newRedisClient(cfg.Redis)
+	}
+
 	// Initialize SessionManager with database backend
 	sessionRepo := repository.NewSessionRepository(db)
+	if cfg.Session.Store == "redis" {
+		cacheTTL := cfg.Session.CacheTTL
+		if cacheTTL <= 0 {
+			cacheTTL = 15 * time.Minute
+		}
+		sessionRepo = repository.NewCachedSessionRepository(sessionRepo, redisClient, cacheTTL)
+	}
+	maxLifetime := cfg.Session.MaxLifetime
+	if maxLifetime <= 0 {
+		maxLifetime = 30 * 24 * time.Hour
+	}
 	sessionConfig := session.SessionConfig{
 		SessionTTL:    24 * time.Hour,     // 24 hours
 		RefreshTTL:    7 * 24 * time.Hour, // 7 days
+		MaxLifetime:   maxLifetime,        // 30 days unless configured
 		MaxSessions:   5,                  // Max 5 sessions per user
 		SecureCookies: cfg.Server.Environment == "production",
 	}
 	sessionManager := session.NewDefaultSessionManager(sessionRepo, sessionConfig)
 
-	// Initialize NonceValidator with 5 minute TTL
-	nonceValidator := nonce.NewInMemoryNonceValidator(5 * time.Minute)
+	var opts []auth.Option
+	if cookieSigner, err := crypto.NewSigner(cfg.JWT.Secret, "session-cookie"); err != nil {
+		log.Printf("Session cookies disabled: %v", err)
+	} else {
+		opts = append(opts, auth.WithSessionCookies(session.NewCookieCodec(session.CookieConfig{
+			Name:     cfg.Session.CookieName,
+			Domain:   cfg.Session.CookieDomain,
+			Path:     cfg.Session.CookiePath,
+			SameSite: session.ParseSameSite(cfg.Session.SameSite),
+			Secure:   sessionConfig.SecureCookies,
+			MaxAge:   sessionConfig.SessionTTL,
+		}, cookieSigner)))
+	}
+
+	nonceValidator := newNonceValidator(cfg.Nonce, cfg.JWT.Secret, redisClient)
+
+	if cfg.RateLimiting.Enabled {
+		perEmail, perIP := newPasswordLimiters(cfg.RateLimiting, redisClient)
+		opts = append(opts, auth.WithPasswordRateLimits(perEmail, perIP))
+		opts = append(opts, newConfirmationCooldown(cfg.RateLimiting, redisClient))
+	}
+
+	// Sessions cannot be refreshed, nor their provider tokens revoked, without the sealed provider refresh token
+	tokenSealer, err := crypto.NewSealer(cfg.Session.EncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid session.encryptionKey: %w", err)
+	}
+	opts = append(opts, auth.WithTokenSealer(tokenSealer))
+
+	if cfg.MFA.EncryptionKey != "" {
+		sealer, err := crypto.NewSealer(cfg.MFA.EncryptionKey)
+		if err != nil {
+			log.Printf("Local MFA disabled: %v", err)
+		} else {
+			engine := mfa.NewLocalEngine(repository.NewMFARepository(db), sealer, mfa.EngineConfig{
+				Issuer:            cfg.MFA.Issuer,
+				Skew:              cfg.MFA.Skew,
+				RecoveryCodeCount: cfg.MFA.RecoveryCodes,
+			})
+			opts = append(opts, auth.WithLocalMFA(engine))
+			opts = append(opts, newMFAAttemptLimits(cfg.MFA, cfg.RateLimiting.Store, redisClient))
+		}
+	}
+
+	if cfg.SSO.HostedUIDomain != "" && (cfg.Provider == "local" || cfg.Provider == "oidc") {
+		log.Printf("SSO login disabled: the hosted UI requires the cognito provider")
+	} else if cfg.SSO.HostedUIDomain != "" {
+		stateSealer, err := crypto.NewSealer(cfg.JWT.Secret)
+		if err != nil {
+			log.Printf("SSO login disabled: %v", err)
+		} else {
+			ssoClient := sso.NewClient(sso.HostedUIConfig(
+				cfg.SSO.HostedUIDomain,
+				cfg.Cognito.AppClientID,
+				cfg.Cognito.AppClientSecret,
+				cfg.SSO.CallbackURL,
+				cfg.SSO.Scopes,
+			), nil)
+			opts = append(opts, auth.WithSSO(ssoClient, sso.NewStateCodec(stateSealer)))
+		}
+	}
+
+	// Signups are guarded by reconciliation jobs; the reconciler rolls back the ones left behind
+	reconciliationRepo := repository.NewReconciliationRepository(db)
+	gracePeriod := cfg.Reconciliation.GracePeriod
+	if gracePeriod <= 0 {
+		gracePeriod = 5 * time.Minute
+	}
+	opts = append(opts, auth.WithReconciliation(reconciliationRepo, gracePeriod))
+	reconciler := auth.NewReconciler(provider, reconciliationRepo, userRepo, auth.ReconcilerConfig{
+		Interval:    cfg.Reconciliation.Interval,
+		MaxAttempts: cfg.Reconciliation.MaxAttempts,
+	})
+	go reconciler.Run(ctx)
+
+	// Authorization decisions evaluate the policies of applications
+	applicationRepo := repository.NewApplicationRepository(db)
+	opts = append(opts, auth.WithApplications(applicationRepo))
+	// Uploaded policy versions are compiled and tested before they are saved, by the engine
+	// that evaluates decisions: in-process, or on the remote OPA server
+	var validator policy.Validator = policy.NewRegoValidator()
+	if evaluator, err := newPolicyEvaluator(cfg.OPA, applicationRepo); err != nil {
+		log.Printf("Policy decisions disabled: %v", err)
+	} else {
+		opts = append(opts, auth.WithPolicyDecisions(evaluator))
+		// A remote OPA server only evaluates the policies it was sent
+		if publisher, ok := evaluator.(policy.Publisher); ok {
+			opts = append(opts, auth.WithPolicySync(publisher))
+		}
+		if remote, ok := evaluator.(policy.Validator); ok {
+			validator = remote
+		}
+	}
+	opts = append(opts, auth.WithPolicyVersions(validator))
+
+	opts = append(opts, auth.WithTokenVerifier(verifier))
+
+	svc := auth.NewAuthService(provider, cfg, userRepo, sessionManager, nonceValidator, opts...)
+	// Applications registered before packages were derived from their IDs move to their own
+	if err := svc.MigrateApplicationPackages(ctx); err != nil {
+		log.Printf("Policy package migration failed: %v", err)
+	}
+	go func() {
+		if err := svc.SyncPolicies(ctx); err != nil {
+			log.Printf("Policy sync failed: %v", err)
+		}
+	}()
+	return svc, nil
+}
+
+// newAuthProvider initializes the identity provider selected by config, with a verifier for
+// the access tokens it issues.
+func newAuthProvider(cfg *config.Config) (authprovider.AuthProvider, *token.Verifier, error) {
+	switch cfg.Provider {
+	case "local":
+		provider, err := local.NewProvider(cfg.LocalProvider)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to initialize local provider: %w", err)
+		}
+		log.Printf("Using the local identity provider; users are kept in memory and codes are logged")
+		return provider, token.NewVerifier(token.StaticKeys(provider.PublicKeys()), token.VerifierConfig{
+			Issuer:   provider.Issuer(),
+			ClientID: provider.ClientID(),
+		}), nil
+
+	case "oidc":
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		provider, err := oidc.NewProvider(ctx, cfg.OIDCProvider, nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to initialize OIDC provider: %w", err)
+		}
+		jwks := token.NewJWKSCache(token.JWKSConfig{URL: provider.JWKSURL()}, nil)
+		return provider, token.NewVerifier(jwks, token.VerifierConfig{
+			Issuer:   provider.Issuer(),
+			ClientID: provider.ClientID(),
+			Leeway:   30 * time.Second,
+			OIDC:     true,
+		}), nil
+
+	case "", "cognito":
+		provider, err := cognito.NewProvider(cfg.Cognito)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to initialize Cognito provider: %w", err)
+		}
+		// Access tokens are verified locally against the user pool's published signing keys
+		issuer := token.CognitoIssuer(cfg.Cognito.Region, cfg.Cognito.UserPoolID)
+		jwks := token.NewJWKSCache(token.JWKSConfig{URL: token.JWKSURL(issuer)}, nil)
+		return provider, token.NewVerifier(jwks, token.VerifierConfig{
+			Issuer:   issuer,
+			ClientID: cfg.Cognito.AppClientID,
+			Leeway:   30 * time.Second,
+		}), nil
+	}
+	return nil, nil, fmt.Errorf("unknown identity provider %q", cfg.Provider)
+}
+
+// newPolicyEvaluator builds the policy evaluator selected by config
+func newPolicyEvaluator(cfg config.OPAConfig, store policy.PolicyStore) (policy.Evaluator, error) {
+	switch cfg.Mode {
+	case "embedded":
+		return policy.NewEmbeddedEvaluator(store), nil
+	case "", "remote":
+		if cfg.ServerURL == "" {
+			return nil, fmt.Errorf("no OPA server configured")
+		}
+		return policy.NewOPAClient(cfg.ServerURL, cfg.PolicyPath, nil), nil
+	}
+	return nil, fmt.Errorf("unknown OPA mode %q", cfg.Mode)
+}
+
+// newRedisClient connects to the configured Redis server
+func newRedisClient(cfg config.RedisConfig) redis.UniversalClient {
+	client := redis.NewClient(&redis.Options{
+		Addr:     fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		log.Printf("Redis at %s:%d is not reachable: %v", cfg.Host, cfg.Port, err)
+	}
+	return client
+}
+
+// newNonceValidator builds the nonce validator selected by config. Nonces are signed and bound
+// to the device fingerprint unless stored mode is configured; the store keeps used or issued nonces.
+func newNonceValidator(cfg config.NonceConfig, secret string, redisClient redis.UniversalClient) nonce.NonceValidator {
+	ttl := cfg.TTL
+	if ttl <= 0 {
+		ttl = 5 * time.Minute
+	}
+	useRedis := cfg.Store == "redis"
+
+	if cfg.Mode != "stored" {
+		signer, err := crypto.NewSigner(secret, "nonce")
+		if err == nil {
+			var replay nonce.ReplayStore = nonce.NewMemoryReplayStore(time.Minute)
+			if useRedis {
+				replay = nonce.NewRedisReplayStore(redisClient)
+			}
+			return nonce.NewSignedNonceValidator(signer, replay, nonce.SignedNonceConfig{
+				TTL:     ttl,
+				MaxSkew: cfg.MaxSkew,
+			})
+		}
+		log.Printf("Signed nonces disabled, falling back to stored nonces: %v", err)
+	}
+
+	if useRedis {
+		return nonce.NewRedisNonceValidator(redisClient, ttl)
+	}
+	return nonce.NewInMemoryNonceValidator(ttl)
+}
+
+// newPasswordLimiters builds the per-email and per-IP limiters for password operations
+func newPasswordLimiters(cfg config.RateLimitingConfig, redisClient redis.UniversalClient) (perEmail, perIP ratelimit.Limiter) {
+	window := cfg.Password.Window
+	if window <= 0 {
+		window = 15 * time.Minute
+	}
+	emailRule := ratelimit.Rule{Limit: cfg.Password.PerEmail, Window: window}
+	if emailRule.Limit <= 0 {
+		emailRule.Limit = 5
+	}
+	ipRule := ratelimit.Rule{Limit: cfg.Password.PerIP, Window: window}
+	if ipRule.Limit <= 0 {
+		ipRule.Limit = 20
+	}
+
+	if cfg.Store == "redis" {
+		return ratelimit.NewRedisLimiter(redisClient, "shield:ratelimit:password:", emailRule),
+			ratelimit.NewRedisLimiter(redisClient, "shield:ratelimit:password:", ipRule)
+	}
+	return ratelimit.NewMemoryLimiter(emailRule), ratelimit.NewMemoryLimiter(ipRule)
+}
+
+// newConfirmationCooldown allows one confirmation code per email and cooldown
+func newConfirmationCooldown(cfg config.RateLimitingConfig, redisClient redis.UniversalClient) auth.Option {
+	cooldown := cfg.ResendCooldown
+	if cooldown <= 0 {
+		cooldown = 60 * time.Second
+	}
+	rule := ratelimit.Rule{Limit: 1, Window: cooldown}
+
+	if cfg.Store == "redis" {
+		return auth.WithConfirmationCooldown(ratelimit.NewRedisLimiter(redisClient, "shield:ratelimit:confirmation:", rule), cooldown)
+	}
+	return auth.WithConfirmationCooldown(ratelimit.NewMemoryLimiter(rule), cooldown)
+}
+
+// newMFAAttemptLimits counts failed local MFA codes per login challenge and per user
+func newMFAAttemptLimits(cfg config.MFAConfig, store string, redisClient redis.UniversalClient) auth.Option {
+	window := cfg.LockoutWindow
+	if window <= 0 {
+		window = 15 * time.Minute
+	}
+	challengeRule := ratelimit.Rule{Limit: cfg.ChallengeAttempts, Window: window}
+	if challengeRule.Limit <= 0 {
+		challengeRule.Limit = 5
+	}
+	userRule := ratelimit.Rule{Limit: cfg.UserAttempts, Window: window}
+	if userRule.Limit <= 0 {
+		userRule.Limit = 10
+	}
+
+	if store == "redis" {
+		return auth.WithMFAAttemptLimits(ratelimit.NewRedisLimiter(redisClient, "shield:ratelimit:mfa:", challengeRule),
+			ratelimit.NewRedisLimiter(redisClient, "shield:ratelimit:mfa:", userRule))
+	}
+	return auth.WithMFAAttemptLimits(ratelimit.NewMemoryLimiter(challengeRule), ratelimit.NewMemoryLimiter(userRule))
+}
+
+// RequireAuth returns middleware that only admits requests with a valid access token.
+// Handlers of other modules can read the caller with CurrentUser.
+func RequireAuth(svc *auth.AuthService) gin.HandlerFunc {
+	return api.RequireAuth(svc)
+}
+
+// CurrentUser returns the user authenticated by RequireAuth.
+func CurrentUser(c *gin.Context) (*models.User, bool) {
+	return api.CurrentUser(c)
+}
+
+// RequireAPIKey returns middleware that only admits applications with a valid X-API-Key.
+// Handlers of other modules can read the calling application with CurrentApplication.
+func RequireAPIKey(svc *auth.AuthService) gin.HandlerFunc {
+	return api.RequireAPIKey(svc)
+}
 
-	return auth.NewAuthService(provider, cfg, userRepo, sessionManager, nonceValidator)
+// CurrentApplication returns the application authenticated by RequireAPIKey.
+func CurrentApplication(c *gin.Context) (*models.Application, bool) {
+	return api.CurrentApplication(c)
 }
 
 // RegisterAuthRoutes exposes the route registration for AuthN
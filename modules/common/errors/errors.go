@@ -2,6 +2,7 @@ package errors
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -17,15 +18,33 @@ func (e *AppError) Error() string {
 }
 
 var (
-	ErrUnauthorized     = &AppError{"UNAUTHORIZED", "Unauthorized access", http.StatusUnauthorized}
-	ErrForbidden        = &AppError{"FORBIDDEN", "Access forbidden", http.StatusForbidden}
-	ErrInvalidToken     = &AppError{"INVALID_TOKEN", "Invalid or expired token", http.StatusUnauthorized}
-	ErrInvalidNonce     = &AppError{"INVALID_NONCE", "Invalid nonce", http.StatusBadRequest}
-	ErrUserNotFound     = &AppError{"USER_NOT_FOUND", "User not found", http.StatusNotFound}
-	ErrInternalServer   = &AppError{"INTERNAL_ERROR", "Internal server error", http.StatusInternalServerError}
+	ErrUnauthorized      = &AppError{"UNAUTHORIZED", "Unauthorized access", http.StatusUnauthorized}
+	ErrForbidden         = &AppError{"FORBIDDEN", "Access forbidden", http.StatusForbidden}
+	ErrInvalidToken      = &AppError{"INVALID_TOKEN", "Invalid or expired token", http.StatusUnauthorized}
+	ErrInvalidNonce      = &AppError{"INVALID_NONCE", "Invalid nonce", http.StatusBadRequest}
+	ErrUserNotFound      = &AppError{"USER_NOT_FOUND", "User not found", http.StatusNotFound}
+	ErrInternalServer    = &AppError{"INTERNAL_ERROR", "Internal server error", http.StatusInternalServerError}
 	ErrRateLimitExceeded = &AppError{"RATE_LIMIT_EXCEEDED", "Rate limit exceeded", http.StatusTooManyRequests}
+	ErrOrgNotFound       = &AppError{"ORG_NOT_FOUND", "Organization not found", http.StatusNotFound}
+	ErrSessionNotFound   = &AppError{"SESSION_NOT_FOUND", "Session not found", http.StatusNotFound}
+
+	ErrCodeMismatch         = &AppError{"CODE_MISMATCH", "Invalid verification code", http.StatusBadRequest}
+	ErrCodeExpired          = &AppError{"CODE_EXPIRED", "Verification code has expired", http.StatusGone}
+	ErrAttemptLimitExceeded = &AppError{"ATTEMPT_LIMIT_EXCEEDED", "Too many attempts, try again later", http.StatusTooManyRequests}
+	ErrInvalidPassword      = &AppError{"INVALID_PASSWORD", "Password does not meet the password policy", http.StatusBadRequest}
+	ErrIncorrectPassword    = &AppError{"INCORRECT_PASSWORD", "Incorrect password", http.StatusUnauthorized}
 )
 
+// RetryAfterError is an AppError for a request the client may repeat after a delay.
+type RetryAfterError struct {
+	*AppError
+	RetryAfter time.Duration
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return e.AppError
+}
+
 func NewAppError(code, message string, status int) *AppError {
 	return &AppError{
 		Code:    code,
@@ -69,4 +88,4 @@ func (h *ErrorHandler) Middleware() gin.HandlerFunc {
 			h.HandleError(c, err)
 		}
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,152 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Limiter counts attempts per key in fixed windows.
+type Limiter interface {
+	// Allow records an attempt for key and reports whether it is within the limit.
+	// When it is not, the returned duration is the time until the window resets.
+	Allow(ctx context.Context, key string) (bool, time.Duration, error)
+	// Blocked reports, without recording an attempt, whether key has used up its limit.
+	// When it has, the returned duration is the time until the window resets.
+	Blocked(ctx context.Context, key string) (bool, time.Duration, error)
+}
+
+// Rule is the number of attempts allowed per key within a window.
+type Rule struct {
+	Limit  int
+	Window time.Duration
+}
+
+// MemoryLimiter is an in-process Limiter. Limits apply per replica.
+type MemoryLimiter struct {
+	rule    Rule
+	windows map[string]*window
+	mutex   sync.Mutex
+	now     func() time.Time
+}
+
+type window struct {
+	count int
+	reset time.Time
+}
+
+// NewMemoryLimiter creates a new in-memory limiter
+func NewMemoryLimiter(rule Rule) *MemoryLimiter {
+	return &MemoryLimiter{
+		rule:    rule,
+		windows: make(map[string]*window),
+		now:     time.Now,
+	}
+}
+
+// Allow records an attempt for key and reports whether it is within the limit
+func (l *MemoryLimiter) Allow(ctx context.Context, key string) (bool, time.Duration, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	w, ok := l.windows[key]
+	if !ok || !now.Before(w.reset) {
+		l.prune(now)
+		w = &window{reset: now.Add(l.rule.Window)}
+		l.windows[key] = w
+	}
+
+	w.count++
+	if w.count > l.rule.Limit {
+		return false, w.reset.Sub(now), nil
+	}
+	return true, 0, nil
+}
+
+// Blocked reports whether key has used up its limit in the current window
+func (l *MemoryLimiter) Blocked(ctx context.Context, key string) (bool, time.Duration, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	w, ok := l.windows[key]
+	if !ok || !now.Before(w.reset) || w.count < l.rule.Limit {
+		return false, 0, nil
+	}
+	return true, w.reset.Sub(now), nil
+}
+
+// prune drops expired windows so idle keys do not accumulate
+func (l *MemoryLimiter) prune(now time.Time) {
+	for key, w := range l.windows {
+		if !now.Before(w.reset) {
+			delete(l.windows, key)
+		}
+	}
+}
+
+// RedisLimiter is a Limiter shared by all replicas
+type RedisLimiter struct {
+	client redis.UniversalClient
+	prefix string
+	rule   Rule
+}
+
+// NewRedisLimiter creates a new Redis-backed limiter. Keys are stored under prefix.
+func NewRedisLimiter(client redis.UniversalClient, prefix string, rule Rule) *RedisLimiter {
+	return &RedisLimiter{client: client, prefix: prefix, rule: rule}
+}
+
+// Allow records an attempt for key and reports whether it is within the limit.
+// INCR and the window expiry are applied in one transaction.
+func (l *RedisLimiter) Allow(ctx context.Context, key string) (bool, time.Duration, error) {
+	redisKey := l.prefix + key
+
+	var count *redis.IntCmd
+	var ttl *redis.DurationCmd
+	_, err := l.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		count = pipe.Incr(ctx, redisKey)
+		pipe.ExpireNX(ctx, redisKey, l.rule.Window)
+		ttl = pipe.PTTL(ctx, redisKey)
+		return nil
+	})
+	if err != nil {
+		return false, 0, err
+	}
+
+	if count.Val() > int64(l.rule.Limit) {
+		return false, ttl.Val(), nil
+	}
+	return true, 0, nil
+}
+
+// Blocked reports whether key has used up its limit in the current window
+func (l *RedisLimiter) Blocked(ctx context.Context, key string) (bool, time.Duration, error) {
+	redisKey := l.prefix + key
+
+	var count *redis.StringCmd
+	var ttl *redis.DurationCmd
+	_, err := l.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		count = pipe.Get(ctx, redisKey)
+		ttl = pipe.PTTL(ctx, redisKey)
+		return nil
+	})
+	if errors.Is(err, redis.Nil) {
+		return false, 0, nil
+	}
+	if err != nil {
+		return false, 0, err
+	}
+	n, err := count.Int64()
+	if err != nil {
+		return false, 0, err
+	}
+	if n < int64(l.rule.Limit) {
+		return false, 0, nil
+	}
+	return true, ttl.Val(), nil
+}
@@ -0,0 +1,91 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestMemoryLimiter(t *testing.T) {
+	limiter := NewMemoryLimiter(Rule{Limit: 2, Window: time.Minute})
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if ok, _, _ := limiter.Allow(ctx, "a"); !ok {
+			t.Fatalf("attempt %d rejected, want allowed", i+1)
+		}
+	}
+	ok, retryAfter, _ := limiter.Allow(ctx, "a")
+	if ok || retryAfter != time.Minute {
+		t.Errorf("attempt over limit = %v, %v; want rejected with 1m retry", ok, retryAfter)
+	}
+	if ok, _, _ := limiter.Allow(ctx, "b"); !ok {
+		t.Error("other key rejected, want allowed")
+	}
+
+	now = now.Add(time.Minute)
+	if ok, _, _ := limiter.Allow(ctx, "a"); !ok {
+		t.Error("attempt in new window rejected, want allowed")
+	}
+}
+
+func TestRedisLimiter(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	limiter := NewRedisLimiter(client, "test:", Rule{Limit: 2, Window: time.Minute})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if ok, _, err := limiter.Allow(ctx, "a"); err != nil || !ok {
+			t.Fatalf("attempt %d = %v, %v; want allowed", i+1, ok, err)
+		}
+	}
+	ok, retryAfter, err := limiter.Allow(ctx, "a")
+	if err != nil || ok || retryAfter <= 0 || retryAfter > time.Minute {
+		t.Errorf("attempt over limit = %v, %v, %v; want rejected with retry within 1m", ok, retryAfter, err)
+	}
+
+	server.FastForward(time.Minute)
+	if ok, _, err := limiter.Allow(ctx, "a"); err != nil || !ok {
+		t.Errorf("attempt in new window = %v, %v; want allowed", ok, err)
+	}
+}
+
+func TestLimiterBlocked(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	rule := Rule{Limit: 2, Window: time.Minute}
+
+	limiters := map[string]Limiter{
+		"memory": NewMemoryLimiter(rule),
+		"redis":  NewRedisLimiter(client, "test:", rule),
+	}
+	for name, limiter := range limiters {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			for i := 0; i < 2; i++ {
+				if blocked, _, err := limiter.Blocked(ctx, "a"); err != nil || blocked {
+					t.Fatalf("Blocked() after %d attempts = %v, %v; want false", i, blocked, err)
+				}
+				if _, _, err := limiter.Allow(ctx, "a"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			blocked, retryAfter, err := limiter.Blocked(ctx, "a")
+			if err != nil || !blocked || retryAfter <= 0 || retryAfter > time.Minute {
+				t.Errorf("Blocked() at limit = %v, %v, %v; want blocked with retry within 1m", blocked, retryAfter, err)
+			}
+			if blocked, _, _ := limiter.Blocked(ctx, "b"); blocked {
+				t.Error("Blocked() for other key = true, want false")
+			}
+		})
+	}
+}
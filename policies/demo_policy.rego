@@ -1,5 +1,7 @@
 # Sample OPA Policy for Demo Application
-package demo.authz
+# Policies declare the package of their application: org_<org ID>.app_<app ID>, without dashes.
+# This one is for the Demo App of the Development Org in scripts/init-dev.sql.
+package org_d3b07384d9a04c9f8b1e5a1c2f3e4d5c.app_6f1d3c2a9b7e4d5f8a1c2e3b4c5d6e7f
 
 import future.keywords.if
 import future.keywords.in
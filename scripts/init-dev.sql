@@ -40,6 +40,7 @@ CREATE TABLE IF NOT EXISTS sessions (
 -- Applications and Roles
 CREATE TABLE IF NOT EXISTS applications (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    org_id UUID REFERENCES organizations(id),
     name VARCHAR NOT NULL,
     api_key VARCHAR UNIQUE,
     opa_endpoint VARCHAR NOT NULL,
@@ -94,14 +95,14 @@ CREATE INDEX IF NOT EXISTS idx_user_app_roles_app_id ON user_app_roles(app_id);
 -- Insert sample data for development
 INSERT INTO organizations (id, name, sso_provider, idp_type, callback_url) 
 VALUES 
-    (uuid_generate_v4(), 'Development Org', 'cognito', 'SAML', 'http://localhost:8081/auth/callback'),
+    ('d3b07384-d9a0-4c9f-8b1e-5a1c2f3e4d5c', 'Development Org', 'cognito', 'SAML', 'http://localhost:8081/auth/callback'),
     (uuid_generate_v4(), 'Test Company', 'cognito', 'OIDC', 'http://localhost:8081/auth/callback')
 ON CONFLICT DO NOTHING;
 
--- Insert sample application
-INSERT INTO applications (id, name, api_key, opa_endpoint, status)
+-- Insert sample application; policies/demo_policy.rego declares its policy package
+INSERT INTO applications (id, org_id, name, api_key, opa_endpoint, status)
 VALUES 
-    (uuid_generate_v4(), 'Demo App', 'demo-api-key-12345', 'http://localhost:8181', 'active')
+    ('6f1d3c2a-9b7e-4d5f-8a1c-2e3b4c5d6e7f', 'd3b07384-d9a0-4c9f-8b1e-5a1c2f3e4d5c', 'Demo App', 'demo-api-key-12345', 'org_d3b07384d9a04c9f8b1e5a1c2f3e4d5c.app_6f1d3c2a9b7e4d5f8a1c2e3b4c5d6e7f', 'active')
 ON CONFLICT DO NOTHING;
 
 -- Log initialization completion